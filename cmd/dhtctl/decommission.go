@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// decommissionPoll is how often runDecommission reports progress.
+const decommissionPoll = time.Second
+
+// runDecommission has one node hand its token ranges to their new owners
+// and leave the ring, following its progress until it is done.
+func runDecommission(args []string) error {
+	fs, nodes, timeout := clusterFlags("decommission")
+	wait := fs.Duration("wait", 30*time.Minute, "How long to follow the handoff before giving up (it carries on regardless)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dhtctl decommission -nodes addr [-wait duration]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	addrs := splitNodes(*nodes)
+	if len(addrs) != 1 {
+		fs.Usage()
+		return errors.New("give exactly the node to decommission")
+	}
+	addr := addrs[0]
+	client := &http.Client{Timeout: *timeout}
+	status, err := decommissionRequest(client, http.MethodPost, addr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("decommissioning %s\n", status.NodeID)
+
+	deadline := time.Now().Add(*wait)
+	last := -1
+	for status.State == "streaming" {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("still handing off after %v; follow it at http://%s/admin/decommission", *wait, addr)
+		}
+		time.Sleep(decommissionPoll)
+		if status, err = decommissionRequest(client, http.MethodGet, addr); err != nil {
+			return err
+		}
+		if status.HandedOff != last {
+			last = status.HandedOff
+			fmt.Printf("handed off %d of %d ranges: %d keys, %d bytes\n", status.HandedOff, status.Ranges, status.Keys, status.Bytes)
+		}
+	}
+	for _, e := range status.Errors {
+		fmt.Printf("  %s\n", e)
+	}
+	if status.State != "left" {
+		return fmt.Errorf("decommission of %s %s", status.NodeID, status.State)
+	}
+	fmt.Printf("%s left the ring and can be stopped\n", status.NodeID)
+	return nil
+}
+
+func decommissionRequest(client *http.Client, method, addr string) (api.DecommissionStatus, error) {
+	var status api.DecommissionStatus
+	err := nodeRequest(client, method, addr, "/admin/decommission", &status)
+	return status, err
+}
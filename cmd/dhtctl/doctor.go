@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// finding is a single doctor result. Severity is one of ok, warn, or fail.
+type finding struct {
+	severity string
+	check    string
+	message  string
+}
+
+// limits are the thresholds doctor checks nodes against.
+type limits struct {
+	maxSkew        time.Duration
+	maxHintBacklog int
+	maxDiskPercent float64
+}
+
+func runDoctor(args []string) error {
+	fs, nodes, timeout := clusterFlags("doctor")
+	var l limits
+	fs.DurationVar(&l.maxSkew, "max-skew", time.Second, "Clock skew between dhtctl and a node above which a warning is raised")
+	fs.IntVar(&l.maxHintBacklog, "max-hint-backlog", 1000, "Hints queued on a node above which a warning is raised")
+	fs.Float64Var(&l.maxDiskPercent, "max-disk-percent", 90, "Use of a node's data file system at or above which the check fails")
+	fs.Parse(args)
+
+	results := fetchStats(splitNodes(*nodes), *timeout)
+	findings := diagnose(results, l)
+
+	failed := 0
+	for _, f := range findings {
+		fmt.Printf("[%-4s] %-18s %s\n", f.severity, f.check, f.message)
+		if f.severity == "fail" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+func diagnose(results []nodeStats, l limits) []finding {
+	var findings []finding
+	var up []nodeStats
+	for _, r := range results {
+		if r.err != nil {
+			findings = append(findings, finding{"fail", "reachability", fmt.Sprintf("%s is unreachable: %v; check the process and network path", r.addr, r.err)})
+			continue
+		}
+		up = append(up, r)
+	}
+	if len(up) == 0 {
+		return append(findings, finding{"fail", "reachability", "no nodes responded; nothing else can be checked"})
+	}
+	findings = append(findings, finding{"ok", "reachability", fmt.Sprintf("%d of %d nodes responded", len(up), len(results))})
+
+	findings = append(findings, checkQuorum(up)...)
+	findings = append(findings, checkClockSkew(up, l.maxSkew)...)
+	findings = append(findings, checkVersions(up)...)
+	findings = append(findings, checkPanics(up)...)
+	findings = append(findings, checkHintBacklog(up, l.maxHintBacklog)...)
+	findings = append(findings, checkDiskSpace(up, l.maxDiskPercent)...)
+	return findings
+}
+
+// checkQuorum verifies that the live ring members can satisfy the configured R and W.
+func checkQuorum(up []nodeStats) []finding {
+	var findings []finding
+	for _, r := range up {
+		s := r.stats
+		alive := 0
+		for _, state := range s.Peers {
+			if state == "alive" {
+				alive++
+			}
+		}
+		replicas := min(s.ReplicationFactor, alive)
+		switch {
+		case replicas < s.WriteQuorum || replicas < s.ReadQuorum:
+			findings = append(findings, finding{"fail", "quorum", fmt.Sprintf(
+				"%s sees %d alive replicas but needs R=%d W=%d; add nodes or lower -r/-w", r.addr, replicas, s.ReadQuorum, s.WriteQuorum)})
+		case s.ReadQuorum+s.WriteQuorum <= s.ReplicationFactor:
+			findings = append(findings, finding{"warn", "quorum", fmt.Sprintf(
+				"%s uses R+W<=N (R=%d W=%d N=%d); reads may miss the latest write", r.addr, s.ReadQuorum, s.WriteQuorum, s.ReplicationFactor)})
+		default:
+			findings = append(findings, finding{"ok", "quorum", fmt.Sprintf(
+				"%s can satisfy R=%d W=%d with %d replicas", r.addr, s.ReadQuorum, s.WriteQuorum, replicas)})
+		}
+	}
+	return findings
+}
+
+// checkClockSkew compares each node's reported time, corrected by half the
+// request latency, against the local clock.
+func checkClockSkew(up []nodeStats, maxSkew time.Duration) []finding {
+	var findings []finding
+	now := time.Now()
+	for _, r := range up {
+		skew := now.Sub(r.stats.Time.Add(r.latency / 2))
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > maxSkew {
+			findings = append(findings, finding{"warn", "clock-skew", fmt.Sprintf(
+				"%s is %s away from this host; check NTP on the node", r.addr, skew.Round(time.Millisecond))})
+		}
+	}
+	if len(findings) == 0 {
+		findings = append(findings, finding{"ok", "clock-skew", fmt.Sprintf("all nodes within %s", maxSkew)})
+	}
+	return findings
+}
+
+func checkVersions(up []nodeStats) []finding {
+	versions := make(map[string][]string)
+	for _, r := range up {
+		versions[r.stats.Version] = append(versions[r.stats.Version], r.addr)
+	}
+	if len(versions) == 1 {
+		return []finding{{"ok", "version", fmt.Sprintf("all nodes run %s", up[0].stats.Version)}}
+	}
+
+	names := make([]string, 0, len(versions))
+	for v := range versions {
+		names = append(names, v)
+	}
+	sort.Strings(names)
+	msg := "mixed versions:"
+	for _, v := range names {
+		msg += fmt.Sprintf(" %s=%v", v, versions[v])
+	}
+	return []finding{{"warn", "version", msg + "; finish the rolling upgrade"}}
+}
+
+// checkPanics flags nodes whose handlers have panicked since startup.
+func checkPanics(up []nodeStats) []finding {
+	var findings []finding
+	for _, r := range up {
+		if r.stats.Panics > 0 {
+			findings = append(findings, finding{"warn", "panics", fmt.Sprintf(
+				"%s recovered from %d handler panics; check its logs for stack traces", r.addr, r.stats.Panics)})
+		}
+	}
+	if len(findings) == 0 {
+		findings = append(findings, finding{"ok", "panics", "no handler panics reported"})
+	}
+	return findings
+}
+
+// checkHintBacklog flags nodes holding more hints than maxBacklog for peers
+// that were down, which the peers have not taken back yet.
+func checkHintBacklog(up []nodeStats, maxBacklog int) []finding {
+	var findings []finding
+	enabled := 0
+	for _, r := range up {
+		if !r.stats.HintedHandoff {
+			continue
+		}
+		enabled++
+		if r.stats.HintBacklog > maxBacklog {
+			findings = append(findings, finding{"warn", "hint-backlog", fmt.Sprintf(
+				"%s has %d hints (%d bytes) queued; check that the peers they are for are up", r.addr, r.stats.HintBacklog, r.stats.HintBytes)})
+		}
+	}
+	switch {
+	case len(findings) > 0:
+	case enabled == 0:
+		findings = append(findings, finding{"ok", "hint-backlog", "hinted handoff is not enabled; nothing queued"})
+	default:
+		findings = append(findings, finding{"ok", "hint-backlog", fmt.Sprintf("no node has more than %d hints queued", maxBacklog)})
+	}
+	return findings
+}
+
+// checkDiskSpace fails nodes whose data file system is at least maxPercent
+// full, and warns within ten points of it.
+func checkDiskSpace(up []nodeStats, maxPercent float64) []finding {
+	var findings []finding
+	onDisk := 0
+	for _, r := range up {
+		if !r.stats.OnDisk {
+			continue
+		}
+		onDisk++
+		switch used := r.stats.DiskPercent; {
+		case used >= maxPercent:
+			findings = append(findings, finding{"fail", "disk-space", fmt.Sprintf(
+				"%s has used %.0f%% of its data disk; free space or add nodes", r.addr, used)})
+		case used >= maxPercent-10:
+			findings = append(findings, finding{"warn", "disk-space", fmt.Sprintf(
+				"%s has used %.0f%% of its data disk, close to %.0f%%", r.addr, used, maxPercent)})
+		}
+	}
+	switch {
+	case len(findings) > 0:
+	case onDisk == 0:
+		findings = append(findings, finding{"ok", "disk-space", "no node keeps data on disk"})
+	default:
+		findings = append(findings, finding{"ok", "disk-space", fmt.Sprintf("all data disks below %.0f%%", maxPercent-10)})
+	}
+	return findings
+}
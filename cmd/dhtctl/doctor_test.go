@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestDiagnose(t *testing.T) {
+	healthy := func(addr string, edit func(*api.StatsResponse)) nodeStats {
+		s := api.StatsResponse{
+			Version:           "v1",
+			Time:              time.Now(),
+			ReplicationFactor: 2,
+			ReadQuorum:        2,
+			WriteQuorum:       2,
+			Peers:             map[string]string{"a": "alive", "b": "alive"},
+		}
+		if edit != nil {
+			edit(&s)
+		}
+		return nodeStats{addr: addr, stats: s}
+	}
+	l := limits{maxSkew: time.Second, maxHintBacklog: 100, maxDiskPercent: 90}
+
+	tests := []struct {
+		name    string
+		results []nodeStats
+		want    map[string]string // check -> worst severity
+	}{
+		{
+			name:    "in-memory cluster without hints",
+			results: []nodeStats{healthy("a", nil), healthy("b", nil)},
+			want:    map[string]string{"reachability": "ok", "quorum": "ok", "hint-backlog": "ok", "disk-space": "ok"},
+		},
+		{
+			name: "hint backlog over the limit",
+			results: []nodeStats{
+				healthy("a", func(s *api.StatsResponse) { s.HintedHandoff, s.HintBacklog = true, 5 }),
+				healthy("b", func(s *api.StatsResponse) { s.HintedHandoff, s.HintBacklog, s.HintBytes = true, 500, 1<<20 }),
+			},
+			want: map[string]string{"hint-backlog": "warn"},
+		},
+		{
+			name: "hint backlog within the limit",
+			results: []nodeStats{
+				healthy("a", func(s *api.StatsResponse) { s.HintedHandoff, s.HintBacklog = true, 100 }),
+			},
+			want: map[string]string{"hint-backlog": "ok"},
+		},
+		{
+			name: "disk close to full",
+			results: []nodeStats{
+				healthy("a", func(s *api.StatsResponse) { s.OnDisk, s.DiskPercent = true, 40 }),
+				healthy("b", func(s *api.StatsResponse) { s.OnDisk, s.DiskPercent = true, 85 }),
+			},
+			want: map[string]string{"disk-space": "warn"},
+		},
+		{
+			name: "disk full",
+			results: []nodeStats{
+				healthy("a", func(s *api.StatsResponse) { s.OnDisk, s.DiskPercent = true, 85 }),
+				healthy("b", func(s *api.StatsResponse) { s.OnDisk, s.DiskPercent = true, 97 }),
+			},
+			want: map[string]string{"disk-space": "fail"},
+		},
+		{
+			name:    "unreachable node",
+			results: []nodeStats{healthy("a", nil), {addr: "b", err: errors.New("connection refused")}},
+			want:    map[string]string{"reachability": "fail", "disk-space": "ok"},
+		},
+		{
+			name:    "no node reachable",
+			results: []nodeStats{{addr: "a", err: errors.New("connection refused")}},
+			want:    map[string]string{"reachability": "fail"},
+		},
+	}
+	rank := map[string]int{"ok": 0, "warn": 1, "fail": 2}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			worst := make(map[string]string)
+			for _, f := range diagnose(tt.results, l) {
+				if current, ok := worst[f.check]; !ok || rank[f.severity] > rank[current] {
+					worst[f.check] = f.severity
+				}
+			}
+			for check, want := range tt.want {
+				if got := worst[check]; got != want {
+					t.Errorf("Expected %s to be %s, got %q", check, want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/client"
+)
+
+// keyClient parses the flags of a key command, which takes one of nargs
+// arguments, and returns a client routing by key through the seeds in
+// -nodes, the arguments and the request timeout.
+func keyClient(name, usage string, args []string, nargs ...int) (*client.Client, []string, time.Duration, error) {
+	fs, nodes, timeout := clusterFlags(name)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dhtctl "+usage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if !wantArgs(fs, nargs) {
+		fs.Usage()
+		return nil, nil, 0, errors.New("wrong number of arguments")
+	}
+	return client.New(splitNodes(*nodes)), fs.Args(), *timeout, nil
+}
+
+func wantArgs(fs *flag.FlagSet, nargs []int) bool {
+	for _, n := range nargs {
+		if fs.NArg() == n {
+			return true
+		}
+	}
+	return false
+}
+
+// runGet writes the value of a key to stdout.
+func runGet(args []string) error {
+	c, args, timeout, err := keyClient("get", "get [-nodes addrs] key", args, 1)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	response, err := c.Get(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if !response.Found {
+		return fmt.Errorf("key %s not found", args[0])
+	}
+	_, err = os.Stdout.Write(response.Value)
+	return err
+}
+
+// runPut stores the value given after the key, or stdin without one.
+func runPut(args []string) error {
+	c, args, timeout, err := keyClient("put", "put [-nodes addrs] key [value]", args, 1, 2)
+	if err != nil {
+		return err
+	}
+	var value []byte
+	if len(args) == 2 {
+		value = []byte(args[1])
+	} else if value, err = io.ReadAll(os.Stdin); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.Put(ctx, args[0], value); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "stored %d bytes under %s in %s\n", len(value), args[0], time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// runDelete deletes a key.
+func runDelete(args []string) error {
+	c, args, timeout, err := keyClient("del", "del [-nodes addrs] key", args, 1)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.Delete(ctx, args[0])
+}
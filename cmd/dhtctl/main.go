@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+const usage = `usage: dhtctl <command> [flags]
+
+commands:
+  get      print the value of a key
+  put      store a value, given or read from stdin, under a key
+  del      delete a key
+  status   print one line of health per node
+  stats    print the full /stats of every node as JSON
+  members  list ring members and whether they answer; "members remove" evicts a dead one
+  doctor   run cluster checks and print actionable findings
+  ring     report ring ownership; "ring balance --plan" proposes vnode counts
+  snapshot snapshot node storage; --cluster snapshots every node at one HLC time
+  restore  load snapshot files into a cluster of any size
+  repair   repair a node's token ranges now; "repair status" reports anti-entropy progress
+  decommission hand a node's ranges to their new owners and remove it from the ring
+  rebalance follow the ranges that joining and leaving nodes move, as they move
+
+DHTCTL_TOKEN, when set, is sent as the bearer token of every request.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if token := os.Getenv("DHTCTL_TOKEN"); token != "" {
+		http.DefaultTransport = &bearerTransport{token: token, next: http.DefaultTransport}
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "get":
+		err = runGet(os.Args[2:])
+	case "put":
+		err = runPut(os.Args[2:])
+	case "del":
+		err = runDelete(os.Args[2:])
+	case "status":
+		err = runStatus(os.Args[2:])
+	case "stats":
+		err = runStats(os.Args[2:])
+	case "members":
+		err = runMembers(os.Args[2:])
+	case "repair":
+		err = runRepair(os.Args[2:])
+	case "doctor":
+		err = runDoctor(os.Args[2:])
+	case "ring":
+		err = runRing(os.Args[2:])
+	case "snapshot":
+		err = runSnapshot(os.Args[2:])
+	case "restore":
+		err = runRestore(os.Args[2:])
+	case "decommission":
+		err = runDecommission(os.Args[2:])
+	case "rebalance":
+		err = runRebalance(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dhtctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// clusterFlags registers the flags shared by every command.
+func clusterFlags(name string) (*flag.FlagSet, *string, *time.Duration) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	nodes := fs.String("nodes", "127.0.0.1:8080", "Comma-separated node addresses (host:port)")
+	timeout := fs.Duration("timeout", 3*time.Second, "Per-node request timeout")
+	return fs, nodes, timeout
+}
+
+func splitNodes(csv string) []string {
+	var nodes []string
+	for _, p := range strings.Split(csv, ",") {
+		if n := strings.TrimSpace(p); n != "" {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// nodeStats is the outcome of fetching /stats from a single node.
+type nodeStats struct {
+	addr    string
+	stats   api.StatsResponse
+	latency time.Duration
+	err     error
+}
+
+// fetchStats queries /stats on every node concurrently, preserving input order.
+func fetchStats(addrs []string, timeout time.Duration) []nodeStats {
+	client := &http.Client{Timeout: timeout}
+	results := make([]nodeStats, len(addrs))
+	done := make(chan struct{}, len(addrs))
+	for i, addr := range addrs {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			results[i] = fetchNodeStats(client, addr)
+		}()
+	}
+	for range addrs {
+		<-done
+	}
+	return results
+}
+
+func fetchNodeStats(client *http.Client, addr string) nodeStats {
+	result := nodeStats{addr: addr}
+	start := time.Now()
+	resp, err := client.Get(fmt.Sprintf("http://%s/stats", addr))
+	result.latency = time.Since(start)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		result.err = fmt.Errorf("returned status %d", resp.StatusCode)
+		return result
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result.stats); err != nil {
+		result.err = err
+	}
+	return result
+}
+
+// nodeRequest sends method to path on the node at addr and decodes the
+// JSON reply into out, turning an error reply into an error naming the node.
+func nodeRequest(client *http.Client, method, addr, path string, out any) error {
+	req, err := http.NewRequest(method, fmt.Sprintf("http://%s%s", addr, path), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		var payload struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&payload) != nil || payload.Error == "" {
+			payload.Error = fmt.Sprintf("returned status %d", resp.StatusCode)
+		}
+		return fmt.Errorf("%s: %s", addr, payload.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// bearerTransport sends token with every request, for nodes whose admin
+// endpoints or public API require one.
+type bearerTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// runMembers lists the ring members and whether they answer, or with
+// "remove id" evicts a member that died for good.
+func runMembers(args []string) error {
+	if len(args) > 0 && args[0] == "remove" {
+		return runMembersRemove(args[1:])
+	}
+	fs, nodes, timeout := clusterFlags("members")
+	fs.Parse(args)
+
+	topology, err := fetchRing(splitNodes(*nodes), *timeout)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(topology.Nodes))
+	addrs := make([]string, 0, len(topology.Nodes))
+	for nodeID := range topology.Nodes {
+		ids = append(ids, nodeID)
+	}
+	sort.Strings(ids)
+	for _, nodeID := range ids {
+		addrs = append(addrs, topology.Nodes[nodeID])
+	}
+	down := 0
+	for i, r := range fetchStats(addrs, *timeout) {
+		if r.err != nil {
+			down++
+			fmt.Printf("%-16s %-24s DOWN  %v\n", ids[i], r.addr, r.err)
+			continue
+		}
+		fmt.Printf("%-16s %-24s UP    keys=%d latency=%s\n", ids[i], r.addr, r.stats.KeyCount, r.latency.Round(time.Millisecond))
+	}
+	fmt.Printf("%d members, %d down, epoch=%d\n", len(ids), down, topology.Epoch)
+	return nil
+}
+
+// runMembersRemove has a node evict a dead member from every ring.
+func runMembersRemove(args []string) error {
+	fs, nodes, timeout := clusterFlags("members remove")
+	operator := fs.String("operator", os.Getenv("USER"), "Operator recorded in the eviction log of the node")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dhtctl members remove [-nodes addr] id")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	addrs := splitNodes(*nodes)
+	if fs.NArg() != 1 || len(addrs) == 0 {
+		fs.Usage()
+		return errors.New("give the ID of the node to remove")
+	}
+
+	var removal api.MemberRemoval
+	client := &http.Client{Timeout: *timeout, Transport: &operatorTransport{operator: *operator, next: http.DefaultTransport}}
+	if err := nodeRequest(client, http.MethodPost, addrs[0], "/admin/members/"+fs.Arg(0)+"/remove", &removal); err != nil {
+		return err
+	}
+	for _, e := range removal.Errors {
+		fmt.Printf("  %s\n", e)
+	}
+	fmt.Printf("removed %s (%s, incarnation %d)\n", removal.Member.NodeID, removal.Member.Address, removal.Member.Incarnation)
+	if len(removal.Errors) > 0 {
+		return fmt.Errorf("%d peers still hold %s in their rings", len(removal.Errors), removal.Member.NodeID)
+	}
+	return nil
+}
+
+// operatorTransport names the operator of an eviction to the node.
+type operatorTransport struct {
+	operator string
+	next     http.RoundTripper
+}
+
+func (t *operatorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Operator", t.operator)
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// runRebalance follows the rebalance feed of every node, printing each
+// range that a bootstrap or decommission moves as it happens, until
+// interrupted or every feed ends.
+func runRebalance(args []string) error {
+	fs, nodes, _ := clusterFlags("rebalance")
+	fs.Parse(args)
+
+	addrs := splitNodes(*nodes)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := 0
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := followRebalance(addr, func(event api.RebalanceEvent) {
+				mu.Lock()
+				defer mu.Unlock()
+				fmt.Println(formatRebalanceEvent(event))
+			})
+			if err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				failed++
+				fmt.Printf("%-24s FAILED %v\n", addr, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if failed > 0 {
+		return fmt.Errorf("%d nodes could not be followed", failed)
+	}
+	return nil
+}
+
+// followRebalance calls handle with every event of the node's rebalance
+// feed until the feed ends.
+func followRebalance(addr string, handle func(api.RebalanceEvent)) error {
+	resp, err := http.Get(fmt.Sprintf("http://%s/admin/rebalance/watch", addr))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("returned status %d", resp.StatusCode)
+	}
+	feed := bufio.NewScanner(resp.Body)
+	feed.Buffer(nil, 1<<20)
+	for feed.Scan() {
+		data, ok := strings.CutPrefix(feed.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event api.RebalanceEvent
+		// The reset event carries no progress
+		if json.Unmarshal([]byte(data), &event) == nil && event.Type != "" {
+			handle(event)
+		}
+	}
+	return feed.Err()
+}
+
+func formatRebalanceEvent(event api.RebalanceEvent) string {
+	progress := fmt.Sprintf("%d/%d ranges (%.0f%%), %d keys, %d bytes", event.Moved, event.Ranges, event.Percent, event.Keys, event.Bytes)
+	line := fmt.Sprintf("%s %s %-12s", event.Time.Local().Format("15:04:05"), event.NodeID, event.Operation)
+	switch event.Type {
+	case api.RebalanceStarted:
+		return fmt.Sprintf("%s started: %d ranges to move", line, event.Ranges)
+	case api.RebalanceRangeMoved:
+		return fmt.Sprintf("%s moved %s, %s", line, event.Range, progress)
+	case api.RebalanceRangeFailed:
+		return fmt.Sprintf("%s FAILED %s: %s", line, event.Range, event.Error)
+	case api.RebalanceFinished:
+		return fmt.Sprintf("%s %s: %s", line, event.State, progress)
+	}
+	return fmt.Sprintf("%s %s", line, event.Type)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// runRepair has each node repair the token ranges it replicates right
+// away, or with "status" reports how far anti-entropy has got.
+func runRepair(args []string) error {
+	if len(args) > 0 && args[0] == "status" {
+		return runRepairStatus(args[1:])
+	}
+	fs, nodes, _ := clusterFlags("repair")
+	key := fs.String("key", "", "Repair only the range holding this key")
+	start := fs.String("start", "", "Start of the token range to repair, in hex as repair status lists it")
+	end := fs.String("end", "", "End of the token range to repair, in hex")
+	wait := fs.Duration("wait", 30*time.Minute, "How long each node may take to repair")
+	fs.Parse(args)
+
+	query := url.Values{}
+	for name, value := range map[string]string{"key": *key, "start": *start, "end": *end} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	path := "/admin/repair"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	client := &http.Client{Timeout: *wait}
+	failed := 0
+	for _, addr := range splitNodes(*nodes) {
+		var report api.RepairReport
+		if err := nodeRequest(client, http.MethodPost, addr, path, &report); err != nil {
+			failed++
+			fmt.Printf("%-24s FAILED %v\n", addr, err)
+			continue
+		}
+		fmt.Printf("%-24s node=%s ranges=%d keys=%d pushed=%d pulled=%d\n", addr, report.NodeID, len(report.Ranges), report.Keys, report.Pushed, report.Pulled)
+		for _, r := range report.Ranges {
+			if r.Error != "" {
+				fmt.Printf("  (%s, %s] %s\n", r.Start, r.End, r.Error)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d nodes did not repair", failed)
+	}
+	return nil
+}
+
+func runRepairStatus(args []string) error {
+	fs, nodes, timeout := clusterFlags("repair status")
+	fs.Parse(args)
+
+	client := &http.Client{Timeout: *timeout}
+	failed := 0
+	for _, addr := range splitNodes(*nodes) {
+		var status api.RepairStatus
+		if err := nodeRequest(client, http.MethodGet, addr, "/admin/repair/status", &status); err != nil {
+			failed++
+			fmt.Printf("%-24s FAILED %v\n", addr, err)
+			continue
+		}
+		oldest := "never"
+		if !status.OldestRepair.IsZero() {
+			oldest = time.Since(status.OldestRepair).Round(time.Second).String() + " ago"
+		}
+		fmt.Printf("%-24s node=%s repaired=%d/%d oldest=%s interval=%s\n", addr, status.NodeID, status.Repaired, status.Ranges, oldest, status.Interval)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d nodes did not report", failed)
+	}
+	return nil
+}
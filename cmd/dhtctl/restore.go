@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// runRestore loads snapshot files into a cluster. Nodes route every entry
+// through their own ring, so the cluster need not have the topology, or
+// even the number of nodes, the snapshots were taken on.
+func runRestore(args []string) error {
+	fs, nodes, _ := clusterFlags("restore")
+	manifestPath := fs.String("manifest", "", "Manifest from dhtctl snapshot --cluster; the files must then be exactly the snapshots it lists")
+	wait := fs.Duration("wait", 10*time.Minute, "How long one node may take to restore one file")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dhtctl restore [-nodes addrs] [-manifest file] snapshot-file...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		fs.Usage()
+		return errors.New("no snapshot files given")
+	}
+	addrs := splitNodes(*nodes)
+	if len(addrs) == 0 {
+		return errors.New("no nodes given")
+	}
+	files := make([][]byte, len(paths))
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[i] = data
+	}
+	if *manifestPath != "" {
+		if err := checkManifest(*manifestPath, paths, files); err != nil {
+			return err
+		}
+	}
+
+	// Spread the files over the nodes; each node writes the entries of its
+	// files to their owners, wherever those are
+	client := &http.Client{Timeout: *wait}
+	results := make([]api.RestoreResponse, len(files))
+	errs := make([]error, len(files))
+	done := make(chan struct{}, len(files))
+	for i := range files {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			results[i], errs[i] = requestRestore(client, addrs[i%len(addrs)], files[i])
+		}()
+	}
+	for range files {
+		<-done
+	}
+
+	failed := 0
+	for i, path := range paths {
+		addr := addrs[i%len(addrs)]
+		if errs[i] != nil {
+			failed++
+			fmt.Printf("%-32s via %-24s FAILED %v\n", path, addr, errs[i])
+			continue
+		}
+		r := results[i]
+		fmt.Printf("%-32s via %-24s node=%s restored=%d current=%d expired=%d failed=%d\n",
+			path, addr, r.NodeID, r.Restored, r.Current, r.Expired, r.Failed)
+		for _, e := range r.Errors {
+			fmt.Printf("  %s\n", e)
+		}
+		if r.Failed > 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d snapshot files were not fully restored", failed, len(files))
+	}
+	return nil
+}
+
+// checkManifest verifies that files are exactly the node snapshots the
+// manifest at path lists, matching them by digest.
+func checkManifest(path string, paths []string, files [][]byte) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var manifest api.ClusterSnapshot
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	if len(manifest.Failed) > 0 {
+		return fmt.Errorf("manifest %s is incomplete: %d nodes did not take the snapshot", path, len(manifest.Failed))
+	}
+	want := make(map[string]string, len(manifest.Nodes))
+	for _, node := range manifest.Nodes {
+		want[node.SHA256] = node.NodeID
+	}
+	for i, file := range files {
+		sum := sha256.Sum256(file)
+		digest := hex.EncodeToString(sum[:])
+		if _, ok := want[digest]; !ok {
+			return fmt.Errorf("%s is not a snapshot listed in %s", paths[i], path)
+		}
+		delete(want, digest)
+	}
+	for _, nodeID := range want {
+		return fmt.Errorf("missing the snapshot of node %s listed in %s", nodeID, path)
+	}
+	return nil
+}
+
+func requestRestore(client *http.Client, addr string, file []byte) (api.RestoreResponse, error) {
+	resp, err := client.Post(fmt.Sprintf("http://%s/admin/restore", addr), "application/json", bytes.NewReader(file))
+	if err != nil {
+		return api.RestoreResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var payload struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&payload) != nil || payload.Error == "" {
+			payload.Error = fmt.Sprintf("returned status %d", resp.StatusCode)
+		}
+		return api.RestoreResponse{}, errors.New(payload.Error)
+	}
+	var restore api.RestoreResponse
+	if err := json.NewDecoder(resp.Body).Decode(&restore); err != nil {
+		return api.RestoreResponse{}, err
+	}
+	return restore, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func runRing(args []string) error {
+	if len(args) < 1 || args[0] != "balance" {
+		return fmt.Errorf("usage: dhtctl ring balance [--plan] [flags]")
+	}
+	fs, nodes, timeout := clusterFlags("ring balance")
+	plan := fs.Bool("plan", false, "Search for vnode counts that even out ownership and print the plan as JSON")
+	moveWeight := fs.Float64("move-weight", 1, "Cost of moving the whole key space, relative to ownership variance")
+	iterations := fs.Int("iterations", 20000, "Candidate adjustments tried by the search")
+	maxVNodes := fs.Int("max-vnodes", 0, "Most vnodes one node may be given (0 means twice the current count)")
+	seed := fs.Int64("seed", 1, "Random seed for a reproducible plan")
+	fs.Parse(args[1:])
+
+	topology, err := fetchRing(splitNodes(*nodes), *timeout)
+	if err != nil {
+		return err
+	}
+	members := make([]ring.NodeID, 0, len(topology.Nodes))
+	for nodeID := range topology.Nodes {
+		members = append(members, ring.NodeID(nodeID))
+	}
+	options := ring.BalanceOptions{MaxVNodes: *maxVNodes, Seed: *seed}
+	if *plan {
+		options.MoveWeight = *moveWeight
+		options.Iterations = *iterations
+	}
+	result, err := ring.Balance(members, topology.VNodes, options)
+	if err != nil {
+		return err
+	}
+	if *plan {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+
+	sort.Slice(members, func(i, j int) bool { return members[i] < members[j] })
+	for _, nodeID := range members {
+		fmt.Printf("%-24s vnodes=%d ownership=%.2f%%\n", nodeID, topology.VNodes, result.Current[nodeID]*100)
+	}
+	fmt.Printf("variance=%.4f epoch=%d\n", result.CurrentVariance, topology.Epoch)
+	return nil
+}
+
+// fetchRing returns the topology from the first node that answers /ring.
+func fetchRing(addrs []string, timeout time.Duration) (api.RingResponse, error) {
+	client := &http.Client{Timeout: timeout}
+	var lastErr error
+	for _, addr := range addrs {
+		resp, err := client.Get(fmt.Sprintf("http://%s/ring", addr))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var topology api.RingResponse
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("%s returned status %d", addr, resp.StatusCode)
+		} else if lastErr = json.NewDecoder(resp.Body).Decode(&topology); lastErr == nil {
+			resp.Body.Close()
+			return topology, nil
+		}
+		resp.Body.Close()
+	}
+	return api.RingResponse{}, fmt.Errorf("no node returned the ring: %v", lastErr)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func runSnapshot(args []string) error {
+	fs, nodes, timeout := clusterFlags("snapshot")
+	cluster := fs.Bool("cluster", false, "Snapshot every ring member rather than only -nodes")
+	id := fs.String("id", "", "Snapshot ID (default: the snapshot time, e.g. 20240108T105800Z)")
+	lead := fs.Duration("lead", 2*time.Second, "How far ahead to schedule the snapshot so every node takes it at the same HLC time")
+	out := fs.String("out", "", "Where to write the manifest (default: snapshot-<id>.json)")
+	fs.Parse(args)
+
+	addrs := splitNodes(*nodes)
+	manifest := api.ClusterSnapshot{At: time.Now().Add(*lead).UTC()}
+	if *cluster {
+		topology, err := fetchRing(addrs, *timeout)
+		if err != nil {
+			return err
+		}
+		manifest.RingEpoch = topology.Epoch
+		addrs = addrs[:0]
+		for _, address := range topology.Nodes {
+			addrs = append(addrs, address)
+		}
+		sort.Strings(addrs)
+	}
+	manifest.ID = *id
+	if manifest.ID == "" {
+		manifest.ID = manifest.At.Format("20060102T150405Z")
+	}
+	if *out == "" {
+		*out = "snapshot-" + manifest.ID + ".json"
+	}
+
+	// Nodes hold the request until the snapshot time, so allow for the lead
+	client := &http.Client{Timeout: *timeout + *lead}
+	results := make([]api.NodeSnapshot, len(addrs))
+	errs := make([]error, len(addrs))
+	done := make(chan struct{}, len(addrs))
+	for i, addr := range addrs {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			results[i], errs[i] = requestSnapshot(client, addr, api.SnapshotRequest{ID: manifest.ID, At: manifest.At})
+		}()
+	}
+	for range addrs {
+		<-done
+	}
+	for i, addr := range addrs {
+		if errs[i] != nil {
+			if manifest.Failed == nil {
+				manifest.Failed = make(map[string]string)
+			}
+			manifest.Failed[addr] = errs[i].Error()
+			fmt.Printf("%-24s FAILED %v\n", addr, errs[i])
+			continue
+		}
+		results[i].Address = addr
+		manifest.Nodes = append(manifest.Nodes, results[i])
+		fmt.Printf("%-24s OK     node=%s keys=%d bytes=%d path=%s\n", addr, results[i].NodeID, results[i].Keys, results[i].Bytes, results[i].Path)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("manifest written to %s\n", *out)
+	if len(manifest.Failed) > 0 {
+		return fmt.Errorf("%d of %d nodes did not take the snapshot; the manifest is incomplete", len(manifest.Failed), len(addrs))
+	}
+	return nil
+}
+
+func requestSnapshot(client *http.Client, addr string, req api.SnapshotRequest) (api.NodeSnapshot, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return api.NodeSnapshot{}, err
+	}
+	resp, err := client.Post(fmt.Sprintf("http://%s/admin/snapshot", addr), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return api.NodeSnapshot{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var payload struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&payload) != nil || payload.Error == "" {
+			payload.Error = fmt.Sprintf("returned status %d", resp.StatusCode)
+		}
+		return api.NodeSnapshot{}, errors.New(payload.Error)
+	}
+	var snapshot api.NodeSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return api.NodeSnapshot{}, err
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// runStats prints the /stats of every node as one JSON object keyed by
+// address, for reading or piping into other tools; unreachable nodes are
+// reported on stderr.
+func runStats(args []string) error {
+	fs, nodes, timeout := clusterFlags("stats")
+	fs.Parse(args)
+
+	results := fetchStats(splitNodes(*nodes), *timeout)
+	stats := make(map[string]api.StatsResponse, len(results))
+	down := 0
+	for _, r := range results {
+		if r.err != nil {
+			down++
+			fmt.Fprintf(os.Stderr, "%s: %v\n", r.addr, r.err)
+			continue
+		}
+		stats[r.addr] = r.stats
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(stats); err != nil {
+		return err
+	}
+	if down > 0 {
+		return fmt.Errorf("%d of %d nodes unreachable", down, len(results))
+	}
+	return nil
+}
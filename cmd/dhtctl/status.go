@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func runStatus(args []string) error {
+	fs, nodes, timeout := clusterFlags("status")
+	fs.Parse(args)
+
+	results := fetchStats(splitNodes(*nodes), *timeout)
+	down := 0
+	for _, r := range results {
+		if r.err != nil {
+			down++
+			fmt.Printf("%-24s DOWN  %v\n", r.addr, r.err)
+			continue
+		}
+		s := r.stats
+		fmt.Printf("%-24s UP    node=%s version=%s uptime=%s keys=%d qps=%.1f 5xx=%.2f%% latency=%s\n",
+			r.addr, s.NodeID, s.Version, (time.Duration(s.UptimeSeconds) * time.Second).String(),
+			s.KeyCount, s.QPS, s.ServerErrorRate*100, r.latency.Round(time.Millisecond))
+	}
+	if down > 0 {
+		return fmt.Errorf("%d of %d nodes unreachable", down, len(results))
+	}
+	return nil
+}
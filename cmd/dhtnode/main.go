@@ -4,7 +4,6 @@ import (
 	"context"
 	"flag"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -15,14 +14,7 @@ import (
 )
 
 func main() {
-	cfg := config.Flags()
-
-	flag.StringVar(&cfg.NodeID, "node-id", "", "Unique node identifier")
-	flag.StringVar(&cfg.BindAddr, "bind", ":8080", "Bind address, e.g. 0.0.0.0:8080")
-	flag.StringVar(&cfg.SeedsCSV, "seeds", "", "Comma-separated seed addresses for gossip (host:port)")
-	flag.IntVar(&cfg.ReplicationFactor, "replication-factor", 3, "Replication factor N")
-	flag.IntVar(&cfg.ReadQuorum, "r", 2, "Read quorum R")
-	flag.IntVar(&cfg.WriteQuorum, "w", 2, "Write quorum W")
+	cfg := config.Flags(flag.CommandLine)
 	flag.Parse()
 
 	if err := cfg.Validate(); err != nil {
@@ -31,20 +23,24 @@ func main() {
 
 	srv := server.NewHTTPServer(cfg)
 
-	go func() {
-		if err := srv.Start(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server error: %v", err)
-		}
-	}()
+	if err := srv.Start(); err != nil {
+		log.Fatalf("failed to start node %s: %v", cfg.NodeID, err)
+	}
 
 	log.Printf("node %s listening on %s", cfg.NodeID, cfg.BindAddr)
+	if cfg.AdminAddr != "" {
+		log.Printf("node %s serving admin endpoints on %s", cfg.NodeID, cfg.AdminAddr)
+	}
+	if cfg.GRPCAddr != "" {
+		log.Printf("node %s serving gRPC on %s", cfg.NodeID, cfg.GRPCAddr)
+	}
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	if err := srv.Stop(ctx); err != nil {
 		log.Printf("graceful shutdown error: %v", err)
@@ -0,0 +1,127 @@
+// Package access tracks how often and how recently keys are read, in
+// bounded memory. It keeps the Space-Saving summary: a fixed number of
+// counters, each reassigned from the least read key to a new one when all
+// are taken. Keys read often keep their counter and an accurate count;
+// a key that is not tracked has been read less often than every tracked
+// key.
+package access
+
+import (
+	"cmp"
+	"container/heap"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Stats is what is known about the reads of a key. Count overstates the
+// reads by at most Error, which counts the reads of the keys the counter
+// tracked before.
+type Stats struct {
+	Key      string
+	Count    uint64
+	Error    uint64
+	LastRead time.Time
+}
+
+// Tracker counts reads of at most a fixed number of keys. The zero value
+// tracks nothing; it is safe for concurrent use.
+type Tracker struct {
+	mu       sync.Mutex
+	capacity int
+	counters counters
+	byKey    map[string]*counter
+}
+
+type counter struct {
+	Stats
+	index int
+}
+
+// counters is a min-heap of counters by count.
+type counters []*counter
+
+func (c counters) Len() int           { return len(c) }
+func (c counters) Less(i, j int) bool { return c[i].Count < c[j].Count }
+func (c counters) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+	c[i].index, c[j].index = i, j
+}
+func (c *counters) Push(x any) {
+	e := x.(*counter)
+	e.index = len(*c)
+	*c = append(*c, e)
+}
+func (c *counters) Pop() any {
+	old := *c
+	e := old[len(old)-1]
+	*c = old[:len(old)-1]
+	return e
+}
+
+// NewTracker returns a tracker of at most capacity keys. A tracker with
+// no capacity tracks nothing.
+func NewTracker(capacity int) *Tracker {
+	return &Tracker{capacity: capacity, byKey: make(map[string]*counter, max(capacity, 0))}
+}
+
+// Record notes a read of key at now.
+func (t *Tracker) Record(key string, now time.Time) {
+	if t == nil || t.capacity <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.byKey[key]; ok {
+		c.Count++
+		c.LastRead = now
+		heap.Fix(&t.counters, c.index)
+		return
+	}
+	if len(t.counters) < t.capacity {
+		c := &counter{Stats: Stats{Key: key, Count: 1, LastRead: now}}
+		heap.Push(&t.counters, c)
+		t.byKey[key] = c
+		return
+	}
+	// Take over the counter of the least read key
+	c := t.counters[0]
+	delete(t.byKey, c.Key)
+	c.Stats = Stats{Key: key, Count: c.Count + 1, Error: c.Count, LastRead: now}
+	t.byKey[key] = c
+	heap.Fix(&t.counters, 0)
+}
+
+// Lookup returns the reads of key, or false when it is not tracked.
+func (t *Tracker) Lookup(key string) (Stats, bool) {
+	if t == nil {
+		return Stats{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.byKey[key]
+	if !ok {
+		return Stats{}, false
+	}
+	return c.Stats, true
+}
+
+// Top returns the n most read keys, most read first.
+func (t *Tracker) Top(n int) []Stats {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	top := make([]Stats, 0, len(t.counters))
+	for _, c := range t.counters {
+		top = append(top, c.Stats)
+	}
+	t.mu.Unlock()
+	slices.SortFunc(top, func(a, b Stats) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return top[:min(n, len(top))]
+}
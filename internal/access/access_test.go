@@ -0,0 +1,66 @@
+package access
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordCountsReads(t *testing.T) {
+	tracker := NewTracker(10)
+	start := time.Unix(1000, 0)
+	for i := range 3 {
+		tracker.Record("a", start.Add(time.Duration(i)*time.Second))
+	}
+	tracker.Record("b", start)
+
+	got, ok := tracker.Lookup("a")
+	if !ok || got.Count != 3 || got.Error != 0 || !got.LastRead.Equal(start.Add(2*time.Second)) {
+		t.Errorf("Expected a read 3 times, last at +2s, got %+v", got)
+	}
+	if _, ok := tracker.Lookup("c"); ok {
+		t.Errorf("Expected c not to be tracked")
+	}
+}
+
+func TestRecordEvictsLeastRead(t *testing.T) {
+	tracker := NewTracker(2)
+	now := time.Now()
+	for range 5 {
+		tracker.Record("hot", now)
+	}
+	tracker.Record("cold", now)
+	tracker.Record("new", now)
+
+	if _, ok := tracker.Lookup("cold"); ok {
+		t.Errorf("Expected cold to lose its counter")
+	}
+	got, ok := tracker.Lookup("new")
+	if !ok || got.Count != 2 || got.Error != 1 {
+		t.Errorf("Expected new to take over cold's count of 1, got %+v", got)
+	}
+	if hot, _ := tracker.Lookup("hot"); hot.Count != 5 {
+		t.Errorf("Expected hot to keep its count of 5, got %d", hot.Count)
+	}
+}
+
+func TestTop(t *testing.T) {
+	tracker := NewTracker(10)
+	now := time.Now()
+	for key, reads := range map[string]int{"a": 1, "b": 3, "c": 2} {
+		for range reads {
+			tracker.Record(key, now)
+		}
+	}
+	top := tracker.Top(2)
+	if len(top) != 2 || top[0].Key != "b" || top[1].Key != "c" {
+		t.Errorf("Expected the top 2 to be [b c], got %+v", top)
+	}
+}
+
+func TestZeroCapacityTracksNothing(t *testing.T) {
+	tracker := NewTracker(0)
+	tracker.Record("a", time.Now())
+	if _, ok := tracker.Lookup("a"); ok || len(tracker.Top(10)) != 0 {
+		t.Errorf("Expected nothing tracked")
+	}
+}
@@ -0,0 +1,149 @@
+// Package alerts evaluates threshold rules, such as "hint_backlog>1000",
+// against readings of a node's metrics and reports when each rule starts
+// and stops firing.
+package alerts
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics are the readings a rule may test.
+var Metrics = []string{
+	"hint_backlog",        // hints queued for peers that were down
+	"quorum_failure_rate", // reads and writes that failed quorum per request
+	"server_error_rate",   // share of requests answered with a 5xx
+	"disk_percent",        // use of the file system holding the data
+	"memory_percent",      // use of the key and byte limits
+	"qps",                 // requests per second
+}
+
+// ops lists the comparisons a rule may make, longest first so that ">="
+// is not read as ">".
+var ops = []string{">=", "<=", ">", "<"}
+
+// Rule fires while a metric compares to Threshold as Op says.
+type Rule struct {
+	Metric    string
+	Op        string
+	Threshold float64
+}
+
+// Parse reads a rule written as "METRIC OP THRESHOLD", such as
+// "disk_percent>=90"; spaces around OP are optional.
+func Parse(spec string) (Rule, error) {
+	for _, op := range ops {
+		metric, threshold, ok := strings.Cut(spec, op)
+		if !ok {
+			continue
+		}
+		r := Rule{Metric: strings.TrimSpace(metric), Op: op}
+		if !slices.Contains(Metrics, r.Metric) {
+			return Rule{}, fmt.Errorf("rule %q: unexpected metric %q (want one of %s)", spec, r.Metric, strings.Join(Metrics, ", "))
+		}
+		var err error
+		if r.Threshold, err = strconv.ParseFloat(strings.TrimSpace(threshold), 64); err != nil {
+			return Rule{}, fmt.Errorf("rule %q: unexpected threshold %q", spec, strings.TrimSpace(threshold))
+		}
+		return r, nil
+	}
+	return Rule{}, fmt.Errorf("unexpected rule %q (want METRIC OP THRESHOLD, OP one of %s)", spec, strings.Join(ops, " "))
+}
+
+// ParseAll parses every rule in specs.
+func ParseAll(specs []string) ([]Rule, error) {
+	var rules []Rule
+	for _, spec := range specs {
+		r, err := Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// String returns the rule as Parse reads it.
+func (r Rule) String() string {
+	return r.Metric + r.Op + strconv.FormatFloat(r.Threshold, 'g', -1, 64)
+}
+
+// Holds reports whether value breaches the rule.
+func (r Rule) Holds(value float64) bool {
+	switch r.Op {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	}
+	return false
+}
+
+// State is where a rule stood at its last evaluation.
+type State struct {
+	Rule   Rule
+	Firing bool
+	// Value is the last reading of the metric, and Since the time the
+	// rule last started or stopped firing; both are zero until the
+	// metric is first read.
+	Value float64
+	Since time.Time
+}
+
+// Engine tracks whether each of a set of rules is firing. It is safe for
+// concurrent use.
+type Engine struct {
+	mu     sync.Mutex
+	states []State
+}
+
+// NewEngine returns an engine in which no rule is firing.
+func NewEngine(rules []Rule) *Engine {
+	e := &Engine{states: make([]State, len(rules))}
+	for i, r := range rules {
+		e.states[i].Rule = r
+	}
+	return e
+}
+
+// Evaluate checks every rule against readings, keyed by metric, and
+// returns the states of the rules that started or stopped firing. A rule
+// whose metric has no reading keeps its state.
+func (e *Engine) Evaluate(readings map[string]float64, now time.Time) []State {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var changed []State
+	for i := range e.states {
+		st := &e.states[i]
+		value, ok := readings[st.Rule.Metric]
+		if !ok {
+			continue
+		}
+		st.Value = value
+		if firing := st.Rule.Holds(value); firing != st.Firing || st.Since.IsZero() {
+			// The first reading starts the clock but only a firing rule
+			// is news
+			report := firing != st.Firing
+			st.Firing, st.Since = firing, now
+			if report {
+				changed = append(changed, *st)
+			}
+		}
+	}
+	return changed
+}
+
+// States returns the state of every rule, in the order they were given.
+func (e *Engine) States() []State {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.states)
+}
@@ -0,0 +1,74 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Rule
+	}{
+		{"hint_backlog>1000", Rule{"hint_backlog", ">", 1000}},
+		{"disk_percent >= 90", Rule{"disk_percent", ">=", 90}},
+		{"qps<0.5", Rule{"qps", "<", 0.5}},
+		{"quorum_failure_rate<=0.01", Rule{"quorum_failure_rate", "<=", 0.01}},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.spec, err)
+		}
+		if r != tt.want {
+			t.Errorf("Expected %q to parse as %+v, got %+v", tt.spec, tt.want, r)
+		}
+	}
+	for _, spec := range []string{"", "hint_backlog", "open_files>10", "qps>many", "qps=10"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+	if r, _ := Parse("disk_percent >= 90"); r.String() != "disk_percent>=90" {
+		t.Errorf("Expected the rule to print as disk_percent>=90, got %s", r)
+	}
+}
+
+func TestEngineReportsTransitions(t *testing.T) {
+	rules, err := ParseAll([]string{"hint_backlog>100", "qps<1"})
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	e := NewEngine(rules)
+	start := time.Now()
+
+	// A rule that does not fire at first is not reported
+	if changed := e.Evaluate(map[string]float64{"hint_backlog": 5, "qps": 10}, start); len(changed) != 0 {
+		t.Errorf("Expected no transitions, got %+v", changed)
+	}
+	changed := e.Evaluate(map[string]float64{"hint_backlog": 500, "qps": 10}, start.Add(time.Minute))
+	if len(changed) != 1 || changed[0].Rule != rules[0] || !changed[0].Firing || changed[0].Value != 500 {
+		t.Fatalf("Expected hint_backlog to start firing, got %+v", changed)
+	}
+	// Still firing is not news, and a missing reading keeps the state
+	if changed := e.Evaluate(map[string]float64{"qps": 10}, start.Add(2*time.Minute)); len(changed) != 0 {
+		t.Errorf("Expected no transitions, got %+v", changed)
+	}
+	changed = e.Evaluate(map[string]float64{"hint_backlog": 0, "qps": 10}, start.Add(3*time.Minute))
+	if len(changed) != 1 || changed[0].Firing {
+		t.Fatalf("Expected hint_backlog to stop firing, got %+v", changed)
+	}
+
+	states := e.States()
+	if len(states) != 2 || states[0].Firing || !states[0].Since.Equal(start.Add(3*time.Minute)) || !states[1].Since.Equal(start) {
+		t.Errorf("Unexpected states %+v", states)
+	}
+}
+
+func TestEngineReportsRuleFiringAtFirstReading(t *testing.T) {
+	e := NewEngine([]Rule{{"disk_percent", ">=", 90}})
+	changed := e.Evaluate(map[string]float64{"disk_percent": 95}, time.Now())
+	if len(changed) != 1 || !changed[0].Firing {
+		t.Errorf("Expected disk_percent to start firing, got %+v", changed)
+	}
+}
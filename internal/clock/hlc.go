@@ -0,0 +1,86 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Timestamp is a hybrid logical clock reading: wall-clock nanoseconds plus a
+// logical counter that orders events sharing the same wall time.
+type Timestamp struct {
+	WallTime int64  `json:"wall_time"`
+	Logical  uint32 `json:"logical"`
+}
+
+// Time returns the wall-clock component as a time.Time.
+func (t Timestamp) Time() time.Time {
+	return time.Unix(0, t.WallTime)
+}
+
+// Before returns true if t orders strictly before other.
+func (t Timestamp) Before(other Timestamp) bool {
+	return t.WallTime < other.WallTime || (t.WallTime == other.WallTime && t.Logical < other.Logical)
+}
+
+// HLC is a hybrid logical clock. It never moves backwards, even if the
+// physical clock does, and absorbs timestamps observed from other nodes.
+type HLC struct {
+	mu   sync.Mutex
+	last Timestamp
+	now  func() time.Time
+}
+
+// NewHLC creates a hybrid logical clock backed by the system clock.
+func NewHLC() *HLC {
+	return &HLC{now: time.Now}
+}
+
+// NewHLCWithClock creates a hybrid logical clock that reads physical time
+// from now, such as a fake clock in tests.
+func NewHLCWithClock(now func() time.Time) *HLC {
+	return &HLC{now: now}
+}
+
+// Now returns a timestamp greater than any previously returned or observed.
+func (h *HLC) Now() Timestamp {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	physical := h.now().UnixNano()
+	if physical > h.last.WallTime {
+		h.last = Timestamp{WallTime: physical}
+	} else {
+		h.last.Logical++
+	}
+	return h.last
+}
+
+// Update merges a timestamp received from another node and returns a new
+// local timestamp that happens after both.
+func (h *HLC) Update(remote Timestamp) Timestamp {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	physical := h.now().UnixNano()
+	switch {
+	case physical > h.last.WallTime && physical > remote.WallTime:
+		h.last = Timestamp{WallTime: physical}
+	case remote.WallTime > h.last.WallTime:
+		h.last = Timestamp{WallTime: remote.WallTime, Logical: remote.Logical + 1}
+	case h.last.WallTime > remote.WallTime:
+		h.last.Logical++
+	default:
+		h.last.Logical = max(h.last.Logical, remote.Logical) + 1
+	}
+	return h.last
+}
+
+// Drift returns how far the wall time of ts is from the local physical clock.
+// The result is always non-negative.
+func (h *HLC) Drift(ts Timestamp) time.Duration {
+	d := time.Duration(ts.WallTime - h.now().UnixNano())
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,50 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHLCMonotonic(t *testing.T) {
+	fixed := time.Unix(100, 0)
+	h := &HLC{now: func() time.Time { return fixed }}
+
+	t1 := h.Now()
+	t2 := h.Now()
+	if !t1.Before(t2) {
+		t.Errorf("Expected %v to be before %v", t1, t2)
+	}
+
+	// Physical clock moves backwards; HLC must not
+	fixed = time.Unix(50, 0)
+	t3 := h.Now()
+	if !t2.Before(t3) {
+		t.Errorf("Expected %v to be before %v after clock regression", t2, t3)
+	}
+}
+
+func TestHLCUpdate(t *testing.T) {
+	h := &HLC{now: func() time.Time { return time.Unix(100, 0) }}
+
+	remote := Timestamp{WallTime: time.Unix(200, 0).UnixNano(), Logical: 3}
+	got := h.Update(remote)
+	if !remote.Before(got) {
+		t.Errorf("Expected update result %v to be after remote %v", got, remote)
+	}
+	if next := h.Now(); !got.Before(next) {
+		t.Errorf("Expected %v to be before %v", got, next)
+	}
+}
+
+func TestHLCDrift(t *testing.T) {
+	h := &HLC{now: func() time.Time { return time.Unix(100, 0) }}
+
+	ahead := Timestamp{WallTime: time.Unix(110, 0).UnixNano()}
+	behind := Timestamp{WallTime: time.Unix(90, 0).UnixNano()}
+	if d := h.Drift(ahead); d != 10*time.Second {
+		t.Errorf("Expected drift 10s, got %v", d)
+	}
+	if d := h.Drift(behind); d != 10*time.Second {
+		t.Errorf("Expected drift 10s, got %v", d)
+	}
+}
@@ -69,6 +69,22 @@ func Compare(a, b VectorClock) int {
 	return 0 // concurrent or equal
 }
 
+// Equal reports whether two vector clocks hold the same counters. Missing
+// entries count as zero, so a nil clock equals an empty one.
+func Equal(a, b VectorClock) bool {
+	for k, av := range a {
+		if b[k] != av {
+			return false
+		}
+	}
+	for k, bv := range b {
+		if a[k] != bv {
+			return false
+		}
+	}
+	return true
+}
+
 // Increment increments the counter for nodeID in the clock.
 func (vc VectorClock) Increment(nodeID string) {
 	if vc == nil {
@@ -110,3 +110,18 @@ func TestVectorClockCopy(t *testing.T) {
 		t.Error("Copy should not be affected by changes to original")
 	}
 }
+
+func TestVectorClockEqual(t *testing.T) {
+	vc1 := VectorClock{"node1": 1, "node2": 2}
+	vc2 := VectorClock{"node2": 2, "node1": 1}
+	if !Equal(vc1, vc2) {
+		t.Error("Clocks with the same counters should be equal")
+	}
+	vc2.Increment("node1")
+	if Equal(vc1, vc2) {
+		t.Error("Clocks with different counters should not be equal")
+	}
+	if !Equal(nil, New()) {
+		t.Error("A nil clock should equal an empty one")
+	}
+}
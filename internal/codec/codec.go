@@ -0,0 +1,130 @@
+// Package codec compresses the bodies nodes send each other. Every codec is
+// known by the name nodes advertise to their peers; a node sends a peer its
+// bodies with the first codec in its own order of preference that the peer
+// supports too, and as they are when the two share none. A node that
+// advertises nothing, as one from before codecs were negotiated, is sent
+// bodies as they are, so mixed clusters keep working through an upgrade.
+//
+// snappy, zstd, gzip and none are built in. Further codecs are added with
+// Register by a build that links an implementation.
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// None sends bodies as they are. Every node supports it.
+const None = "none"
+
+var (
+	// ErrTooLarge is returned for a body that decodes to more than the
+	// limit it was decoded with.
+	ErrTooLarge = errors.New("codec: decoded body exceeds limit")
+	// ErrCorrupt is returned for a body that is not valid for its codec.
+	ErrCorrupt = errors.New("codec: corrupt input")
+)
+
+// A Codec compresses and decompresses whole bodies.
+type Codec interface {
+	// Name is the name the codec is advertised and negotiated by.
+	Name() string
+	// Encode returns src compressed.
+	Encode(src []byte) ([]byte, error)
+	// Decode returns src decompressed, or ErrTooLarge once it grows past
+	// limit bytes.
+	Decode(src []byte, limit int64) ([]byte, error)
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Codec{}
+)
+
+func init() {
+	Register(none{})
+	Register(snappyCodec{})
+	Register(zstdCodec{})
+	Register(gzipCodec{})
+}
+
+// Register makes c available by its name. It panics if a codec of that
+// name is already registered.
+func Register(c Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := registry[c.Name()]; dup {
+		panic("codec: Register called twice for " + c.Name())
+	}
+	registry[c.Name()] = c
+}
+
+// Lookup returns the codec registered as name.
+func Lookup(name string) (Codec, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	c, ok := registry[name]
+	return c, ok
+}
+
+// Names lists the registered codecs, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parse checks that every name in an order of preference is registered and
+// returns the order with None appended if it was missing, so that a node can
+// always fall back to sending bodies as they are.
+func Parse(names []string) ([]string, error) {
+	out := make([]string, 0, len(names)+1)
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := Lookup(name); !ok {
+			return nil, fmt.Errorf("unknown codec %q (want one of %v)", name, Names())
+		}
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	if !seen[None] {
+		out = append(out, None)
+	}
+	return out, nil
+}
+
+// Negotiate returns the first codec in local that remote supports too, or
+// None when they share none.
+func Negotiate(local, remote []string) string {
+	for _, name := range local {
+		for _, theirs := range remote {
+			if name == theirs {
+				return name
+			}
+		}
+	}
+	return None
+}
+
+// none passes bodies through unchanged.
+type none struct{}
+
+func (none) Name() string { return None }
+
+func (none) Encode(src []byte) ([]byte, error) { return src, nil }
+
+func (none) Decode(src []byte, limit int64) ([]byte, error) {
+	if int64(len(src)) > limit {
+		return nil, ErrTooLarge
+	}
+	return src, nil
+}
@@ -0,0 +1,135 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	random := make([]byte, 100_000)
+	for i := range random {
+		random[i] = byte(rng.Uint32())
+	}
+	inputs := map[string][]byte{
+		"empty":      {},
+		"short":      []byte("abc"),
+		"repetitive": []byte(strings.Repeat(`{"key":"user:1","value":"aGVsbG8="},`, 5000)),
+		"random":     random,
+		"run":        bytes.Repeat([]byte{'x'}, 200_000),
+	}
+	for _, name := range Names() {
+		c, _ := Lookup(name)
+		for input, src := range inputs {
+			encoded, err := c.Encode(src)
+			if err != nil {
+				t.Fatalf("Expected %s to encode %s, got %v", name, input, err)
+			}
+			decoded, err := c.Decode(encoded, int64(len(src)))
+			if err != nil || !bytes.Equal(decoded, src) {
+				t.Errorf("Expected %s to round trip %s, got %d bytes and %v", name, input, len(decoded), err)
+			}
+			if name != None && input == "repetitive" && len(encoded) > len(src)/4 {
+				t.Errorf("Expected %s to compress %s, got %d of %d bytes", name, input, len(encoded), len(src))
+			}
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	src := bytes.Repeat([]byte("abcd"), 1000)
+	for _, name := range Names() {
+		c, _ := Lookup(name)
+		encoded, _ := c.Encode(src)
+		if _, err := c.Decode(encoded, int64(len(src))-1); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("Expected %s to refuse a body over the limit, got %v", name, err)
+		}
+	}
+
+	s, _ := Lookup("snappy")
+	encoded, _ := s.Encode(src)
+	for _, corrupt := range [][]byte{{}, encoded[:len(encoded)/2], append([]byte{0x05, 0x06}, 0x01, 0x02)} {
+		if _, err := s.Decode(corrupt, 1<<20); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Expected snappy to refuse %v, got %v", corrupt, err)
+		}
+	}
+}
+
+func TestSnappyDecodesAllTags(t *testing.T) {
+	// "abcd" as a literal, then copies of it with one, two and four byte
+	// offsets, as other snappy encoders write them
+	src := []byte{
+		16,
+		3 << 2, 'a', 'b', 'c', 'd',
+		0<<2 | 0x01, 4,
+		3<<2 | 0x02, 8, 0,
+		3<<2 | 0x03, 4, 0, 0, 0,
+	}
+	s, _ := Lookup("snappy")
+	got, err := s.Decode(src, 100)
+	if err != nil || string(got) != strings.Repeat("abcd", 4) {
+		t.Errorf("Expected every tag decoded, got %q and %v", got, err)
+	}
+}
+
+// FuzzDecode feeds every codec arbitrary bodies, which it must refuse or
+// decode within the limit, and round trips them as plain bodies.
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("abc"))
+	f.Add([]byte(strings.Repeat("abcd", 100)))
+	for _, name := range Names() {
+		c, _ := Lookup(name)
+		encoded, _ := c.Encode([]byte(strings.Repeat(`{"key":"user:1"},`, 50)))
+		f.Add(encoded)
+	}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		const limit = 1 << 16
+		for _, name := range Names() {
+			c, _ := Lookup(name)
+			decoded, err := c.Decode(src, limit)
+			if err != nil && !errors.Is(err, ErrCorrupt) && !errors.Is(err, ErrTooLarge) {
+				t.Errorf("Expected %s to refuse a bad body as corrupt or too large, got %v", name, err)
+			}
+			if len(decoded) > limit {
+				t.Errorf("Expected %s to decode at most %d bytes, got %d", name, limit, len(decoded))
+			}
+
+			encoded, err := c.Encode(src)
+			if err != nil {
+				t.Fatalf("Expected %s to encode, got %v", name, err)
+			}
+			decoded, err = c.Decode(encoded, int64(len(src)))
+			if err != nil || !bytes.Equal(decoded, src) {
+				t.Errorf("Expected %s to round trip %d bytes, got %d and %v", name, len(src), len(decoded), err)
+			}
+		}
+	})
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		local, remote []string
+		want          string
+	}{
+		{[]string{"snappy", "gzip", None}, []string{"gzip", "snappy", None}, "snappy"},
+		{[]string{"snappy", "gzip", None}, []string{"zstd", "gzip", None}, "gzip"},
+		{[]string{"snappy", None}, []string{"gzip", None}, None},
+		{[]string{"snappy", None}, nil, None},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.local, tt.remote); got != tt.want {
+			t.Errorf("Expected %v with %v to negotiate %s, got %s", tt.local, tt.remote, tt.want, got)
+		}
+	}
+
+	if order, err := Parse([]string{"gzip", "snappy"}); err != nil || strings.Join(order, ",") != "gzip,snappy,none" {
+		t.Errorf("Expected none appended to the order, got %v and %v", order, err)
+	}
+	if _, err := Parse([]string{"lz5"}); err == nil {
+		t.Errorf("Expected an unknown codec to be refused")
+	}
+}
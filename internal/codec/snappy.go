@@ -0,0 +1,30 @@
+package codec
+
+import (
+	"github.com/klauspost/compress/snappy"
+)
+
+// snappyCodec uses the snappy block format: the decoded length as a
+// uvarint, then a run of literals and back references.
+type snappyCodec struct{}
+
+func (snappyCodec) Name() string { return "snappy" }
+
+func (snappyCodec) Encode(src []byte) ([]byte, error) {
+	return snappy.Encode(nil, src), nil
+}
+
+func (snappyCodec) Decode(src []byte, limit int64) ([]byte, error) {
+	n, err := snappy.DecodedLen(src)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	if int64(n) > limit {
+		return nil, ErrTooLarge
+	}
+	out, err := snappy.Decode(nil, src)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return out, nil
+}
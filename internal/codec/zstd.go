@@ -0,0 +1,47 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdCodec compresses about as well as gzip at close to the speed of
+// snappy.
+type zstdCodec struct{}
+
+// zstdEncoder is shared by every Encode; EncodeAll is safe for concurrent
+// use.
+var zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		panic("codec: " + err.Error())
+	}
+	return enc
+})
+
+func (zstdCodec) Name() string { return "zstd" }
+
+func (zstdCodec) Encode(src []byte) ([]byte, error) {
+	return zstdEncoder().EncodeAll(src, nil), nil
+}
+
+// Decode streams the body so that a frame claiming to be larger than it is
+// cannot allocate past limit.
+func (zstdCodec) Decode(src []byte, limit int64) ([]byte, error) {
+	zr, err := zstd.NewReader(bytes.NewReader(src), zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	if int64(len(out)) > limit {
+		return nil, ErrTooLarge
+	}
+	return out, nil
+}
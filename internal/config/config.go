@@ -4,31 +4,247 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/amirderis/DHT/internal/alerts"
+	"github.com/amirderis/DHT/internal/codec"
+	"github.com/amirderis/DHT/internal/identity"
+	"github.com/amirderis/DHT/internal/metrics"
+	"github.com/amirderis/DHT/internal/schedule"
 )
 
 // Config captures node runtime configuration.
 type Config struct {
-	NodeID            string
-	BindAddr          string
+	NodeID string
+	// DataDir holds the persisted node identity, stats history and
+	// snapshots; empty disables persistence and falls back to the hostname
+	// as NodeID.
+	DataDir string
+	// Incarnation is loaded from DataDir and bumped on every start; zero
+	// when DataDir is unset.
+	Incarnation uint64
+	BindAddr    string
+	// GRPCAddr is the listen address of the gRPC API; empty disables it.
+	GRPCAddr          string
 	SeedsCSV          string
 	Seeds             []string
 	ReplicationFactor int
 	ReadQuorum        int
 	WriteQuorum       int
+	// Datacenter is the datacenter this node announces to its peers. A
+	// request with a local_quorum consistency counts only the replicas in
+	// the same datacenter as its coordinator; empty counts every replica.
+	Datacenter   string
+	ReapInterval time.Duration
+	// BootstrapExpect is the number of nodes that must join before a fresh
+	// node accepts writes; zero disables the wait.
+	BootstrapExpect int
+	// MaxConcurrentStreams bounds the HTTP/2 streams a single client
+	// connection may have open on either listener.
+	MaxConcurrentStreams int
+	// MaxKeys and MaxBytes bound the in-memory engine; zero means unbounded.
+	MaxKeys  int
+	MaxBytes int64
+	// TombstoneGrace is how long tombstones are kept before the engine may
+	// drop them to stay within its bounds, and how long the chunks of a
+	// deleted chunked value are kept before they are cleaned up.
+	TombstoneGrace time.Duration
+	// ChunkSize is the largest value stored as a single entry; larger values
+	// are split into chunks of this size behind a manifest.
+	ChunkSize int
+	// MaxValueBytes bounds the size of a single PUT body.
+	MaxValueBytes int64
+	// AccessTrackedKeys bounds the keys whose reads this node counts for
+	// key metadata and /admin/hotkeys; zero counts none.
+	AccessTrackedKeys int
+	// IdempotencyTTL is how long a coordinator remembers the response to a
+	// write sent with an Idempotency-Key, replaying it to retries. A
+	// negative TTL ignores the header.
+	IdempotencyTTL time.Duration
+	// ScanCursorTTL is how long an idle /scan cursor keeps its snapshot.
+	ScanCursorTTL time.Duration
+	// PeerTimeout bounds every request to another node. A client deadline
+	// (X-Timeout) can shorten it but never extend it.
+	PeerTimeout time.Duration
+	// LWW checks the X-Timestamp a client sends with a write against the
+	// coordinator's clock, as MaxClockDrift and DriftPolicy say, advances
+	// the coordinator's hybrid clock to timestamps it accepts and stores
+	// them as the time of the write. Of two concurrent versions, replicas
+	// keep the one written last by that time.
+	LWW bool
+	// MaxClockDrift bounds how far a client timestamp may deviate from the
+	// coordinator's clock before DriftPolicy applies.
+	MaxClockDrift time.Duration
+	// DriftPolicy is either "reject" or "warn".
+	DriftPolicy string
+	// PeerTransport is how the node sends replica reads and writes, joins,
+	// leaves, pings and range listings to its peers: PeerTransportHTTP or
+	// PeerTransportGRPC. A node accepts both on BindAddr either way.
+	PeerTransport string
+	// PeerCodecs lists the codecs this node compresses internal HTTP bodies
+	// with, in order of preference; each peer is sent bodies with the first
+	// it supports too. "none" is always supported and comes last unless
+	// listed earlier.
+	PeerCodecsCSV string
+	PeerCodecs    []string
+	// AdminAddr serves the health, readiness, stats and /admin/ endpoints
+	// on a separate listener, so that they can be firewalled apart from the
+	// public API; empty keeps them on BindAddr.
+	AdminAddr string
+	// Middleware chains per listener as comma-separated names, outermost
+	// first. See KnownMiddleware for the accepted names.
+	PublicMiddlewareCSV   string
+	InternalMiddlewareCSV string
+	AdminMiddlewareCSV    string
+	PublicMiddleware      []string
+	InternalMiddleware    []string
+	AdminMiddleware       []string
+	// AuthToken is the bearer token required by the auth middleware. Its
+	// bearer sees every key and may use the admin endpoints.
+	AuthToken string
+	// ClusterToken, when set, is the bearer token nodes present to each
+	// other: the internal HTTP endpoints and the gRPC Replica service
+	// refuse requests without it, and the node sends it to its peers.
+	// Every node of a cluster needs the same one.
+	ClusterToken string
+	// AdminToken, when set, is the bearer token the admin endpoints
+	// require, wherever they are served, in place of the auth middleware.
+	// It grants nothing on the public and internal endpoints. Health and
+	// readiness probes need no token.
+	AdminToken string
+	// TenantTokensCSV lists tenants as comma-separated name=token pairs.
+	// The auth middleware also accepts a tenant's token, confining its
+	// bearer to the keys of the namespace named after the tenant.
+	TenantTokensCSV string
+	// Tenants maps each tenant token to its tenant.
+	Tenants map[string]string
+	// RateLimit is the sustained requests per second allowed by the
+	// ratelimit middleware on each listener, with bursts up to RateBurst.
+	RateLimit float64
+	RateBurst int
+	// MetricsBackend is one of metrics.Backends. Prometheus is scraped from
+	// /metrics; StatsD pushes to StatsDAddr.
+	MetricsBackend string
+	StatsDAddr     string
+	// MirrorAddr is a node of a shadow cluster that receives a copy of
+	// MirrorPercent percent of client reads and writes; empty disables it.
+	MirrorAddr    string
+	MirrorPercent float64
+	// SloppyQuorum lets writes count fallback nodes past the preference
+	// list towards W, as hints for the replicas that are down, instead of
+	// failing when too few of the N replicas are reachable.
+	SloppyQuorum bool
+	// MaxSiblings caps the concurrent versions of a key; zero leaves them
+	// uncapped. SiblingOverflow is what happens past it: under
+	// SiblingOverflowLWW each replica collapses the versions it stores
+	// into the latest write, and reads that find more across replicas
+	// return the latest and repair the replicas to it. Under
+	// SiblingOverflowReject a client write that would leave more is
+	// refused, while replicas still keep every version that replication
+	// or repair brings them.
+	MaxSiblings     int
+	SiblingOverflow string
+	// JoinStagger is the minimum time between two new members a seed lets
+	// into the ring, so that an autoscaling burst activates gradually.
+	// Zero admits joins as they come.
+	JoinStagger time.Duration
+	// HintDir holds writes for replicas that were down, to be handed off
+	// when they come back. It defaults to DataDir/hints; empty disables
+	// hinted handoff.
+	HintDir string
+	// MaxHintsPerTarget, MaxHintBytes and HintTTL bound the hint store.
+	MaxHintsPerTarget int
+	MaxHintBytes      int64
+	HintTTL           time.Duration
+	// MaxQPS is the request rate a node is sized for, used as the QPS
+	// dimension of its capacity score. Zero falls back to RateLimit; with
+	// neither set QPS does not count towards the score.
+	MaxQPS float64
+	// CapacityWebhook receives a POST whenever the cluster capacity score
+	// crosses CapacityHighWater or CapacityLowWater (percentages); empty
+	// disables it.
+	CapacityWebhook   string
+	CapacityHighWater float64
+	CapacityLowWater  float64
+	// BackgroundWindows are the times, as comma-separated schedule windows
+	// such as "mon-fri 22:00-06:00", in which heavy background jobs run at
+	// full rate. Outside them a job runs on one scheduled tick in
+	// BackgroundThrottle, or not at all when it is zero. Without windows
+	// jobs always run at full rate.
+	BackgroundWindowsCSV string
+	BackgroundWindows    schedule.Schedule
+	BackgroundThrottle   int
+	// AlertRules are comma-separated thresholds on this node's metrics,
+	// such as "hint_backlog>1000,disk_percent>=90", checked every
+	// AlertInterval. A rule that starts or stops firing is logged and, if
+	// AlertWebhook is set, posted to it.
+	AlertRulesCSV string
+	AlertRules    []alerts.Rule
+	AlertWebhook  string
+	AlertInterval time.Duration
+	// RepairInterval is how often anti-entropy means to repair each token
+	// range this node is the primary replica of; it works through them one
+	// at a time, at most RepairConcurrency at once, transferring at most
+	// RepairRate bytes per second between them. A negative interval
+	// disables anti-entropy.
+	RepairInterval    time.Duration
+	RepairRate        int64
+	RepairConcurrency int
+	// AuditInterval is how often the replica auditor samples AuditSample of
+	// this node's keys and checks that each has a copy on every replica. A
+	// negative interval disables the auditor.
+	AuditInterval time.Duration
+	AuditSample   int
+	// MaxReplicaRequests bounds the replica reads and writes from peers
+	// served at once, and MaxTransferRequests the batch writes and range
+	// listings; requests over either bound are turned away with 503. The
+	// public API has no such bound. MaxPeerTransfers bounds the range
+	// listings served to any one peer, so that nodes joining at once share
+	// the transfer slots.
+	MaxReplicaRequests  int
+	MaxTransferRequests int
+	MaxPeerTransfers    int
+	// StandbyFor makes the node a warm standby for the node with this ID:
+	// it takes the ID as its own but stays out of the ring, copying the
+	// primary's ranges every StandbyInterval until it is promoted to take
+	// over the primary's tokens. StandbyPromoteAfter promotes it once the
+	// primary has been unreachable that long; zero leaves promotion to an
+	// operator.
+	StandbyFor          string
+	StandbyInterval     time.Duration
+	StandbyPromoteAfter time.Duration
 }
 
-// Flags returns a zero-value config for flag binding.
-func Flags() *Config {
-	return &Config{}
-}
+const (
+	DriftPolicyReject = "reject"
+	DriftPolicyWarn   = "warn"
+)
+
+// Policies for writes that would exceed MaxSiblings.
+const (
+	SiblingOverflowLWW    = "lww"
+	SiblingOverflowReject = "reject"
+)
+
+// Transports a node may use for requests to its peers.
+const (
+	PeerTransportHTTP = "http"
+	PeerTransportGRPC = "grpc"
+)
+
+// DefaultPeerCodecs is the order of preference of the codecs a node
+// compresses internal bodies with unless configured otherwise.
+const DefaultPeerCodecs = "snappy,gzip"
+
+// KnownMiddleware lists the middleware names a listener chain may use.
+var KnownMiddleware = []string{"metrics", "logging", "auth", "ratelimit", "gzip", "recovery"}
 
 // Validate finalizes and validates the configuration.
 func (c *Config) Validate() error {
-	if c.NodeID == "" {
-		// Default node id to hostname if available
-		c.NodeID = generateDefaultNodeID()
-	}
 	if c.BindAddr == "" {
 		c.BindAddr = ":8080"
 	}
@@ -41,24 +257,279 @@ func (c *Config) Validate() error {
 	if c.WriteQuorum <= 0 {
 		c.WriteQuorum = 2
 	}
+	if c.ReapInterval <= 0 {
+		c.ReapInterval = 30 * time.Second
+	}
+	if c.MaxConcurrentStreams <= 0 {
+		c.MaxConcurrentStreams = 250
+	}
+	if c.BootstrapExpect < 0 {
+		return fmt.Errorf("unexpected bootstrap expectation %d", c.BootstrapExpect)
+	}
+	if c.MaxKeys < 0 || c.MaxBytes < 0 {
+		return fmt.Errorf("unexpected memory bounds (max-keys=%d max-bytes=%d)", c.MaxKeys, c.MaxBytes)
+	}
+	if c.TombstoneGrace <= 0 {
+		c.TombstoneGrace = time.Hour
+	}
+	if c.ChunkSize <= 0 {
+		c.ChunkSize = 1 << 20
+	}
+	if c.MaxValueBytes <= 0 {
+		c.MaxValueBytes = 64 << 20
+	}
+	if c.ScanCursorTTL <= 0 {
+		c.ScanCursorTTL = 5 * time.Minute
+	}
+	if c.PeerTimeout <= 0 {
+		c.PeerTimeout = 5 * time.Second
+	}
+	if c.MaxClockDrift <= 0 {
+		c.MaxClockDrift = 5 * time.Second
+	}
+	if c.DriftPolicy == "" {
+		c.DriftPolicy = DriftPolicyReject
+	}
+	if c.DriftPolicy != DriftPolicyReject && c.DriftPolicy != DriftPolicyWarn {
+		return fmt.Errorf("unexpected clock drift policy %q (want %q or %q)", c.DriftPolicy, DriftPolicyReject, DriftPolicyWarn)
+	}
+	if c.PeerTransport == "" {
+		c.PeerTransport = PeerTransportHTTP
+	}
+	if c.PeerTransport != PeerTransportHTTP && c.PeerTransport != PeerTransportGRPC {
+		return fmt.Errorf("unexpected peer transport %q (want %q or %q)", c.PeerTransport, PeerTransportHTTP, PeerTransportGRPC)
+	}
+	if c.PeerCodecsCSV == "" {
+		c.PeerCodecsCSV = DefaultPeerCodecs
+	}
+	if c.AccessTrackedKeys < 0 {
+		return fmt.Errorf("unexpected access tracked keys %d", c.AccessTrackedKeys)
+	}
+	if c.MaxSiblings < 0 {
+		return fmt.Errorf("unexpected max siblings %d", c.MaxSiblings)
+	}
+	if c.SiblingOverflow == "" {
+		c.SiblingOverflow = SiblingOverflowLWW
+	}
+	if c.SiblingOverflow != SiblingOverflowLWW && c.SiblingOverflow != SiblingOverflowReject {
+		return fmt.Errorf("unexpected sibling overflow policy %q (want %q or %q)", c.SiblingOverflow, SiblingOverflowLWW, SiblingOverflowReject)
+	}
 	if c.ReadQuorum > c.ReplicationFactor || c.WriteQuorum > c.ReplicationFactor {
 		return fmt.Errorf("unexpected replication configuration(R=%d W=%d N=%d)", c.ReadQuorum, c.WriteQuorum, c.ReplicationFactor)
 	}
+	if c.MetricsBackend == "" {
+		c.MetricsBackend = metrics.BackendPrometheus
+	}
+	if !slices.Contains(metrics.Backends, c.MetricsBackend) {
+		return fmt.Errorf("unexpected metrics backend %q (want one of %s)", c.MetricsBackend, strings.Join(metrics.Backends, ", "))
+	}
+	if c.MetricsBackend == metrics.BackendStatsD && c.StatsDAddr == "" {
+		return errors.New("metrics backend statsd requires a statsd address")
+	}
+	if c.MirrorPercent < 0 || c.MirrorPercent > 100 {
+		return fmt.Errorf("unexpected mirror percentage %v (want 0 to 100)", c.MirrorPercent)
+	}
+	if c.JoinStagger < 0 {
+		return fmt.Errorf("unexpected join stagger %v", c.JoinStagger)
+	}
+	if c.HintDir == "" && c.DataDir != "" {
+		c.HintDir = filepath.Join(c.DataDir, "hints")
+	}
+	if c.MaxHintsPerTarget < 0 || c.MaxHintBytes < 0 {
+		return fmt.Errorf("unexpected hint bounds (max-hints-per-target=%d max-hint-bytes=%d)", c.MaxHintsPerTarget, c.MaxHintBytes)
+	}
+	if c.HintTTL <= 0 {
+		c.HintTTL = 3 * time.Hour
+	}
+	if c.MaxQPS < 0 {
+		return fmt.Errorf("unexpected max qps %v", c.MaxQPS)
+	}
+	if c.MaxQPS == 0 {
+		c.MaxQPS = c.RateLimit
+	}
+	if c.CapacityHighWater == 0 {
+		c.CapacityHighWater = 80
+	}
+	if c.CapacityLowWater < 0 || c.CapacityLowWater >= c.CapacityHighWater || c.CapacityHighWater > 100 {
+		return fmt.Errorf("unexpected capacity thresholds (low=%v high=%v, want 0 <= low < high <= 100)", c.CapacityLowWater, c.CapacityHighWater)
+	}
+	if c.RepairInterval == 0 {
+		c.RepairInterval = time.Hour
+	}
+	if c.RepairRate <= 0 {
+		c.RepairRate = 1 << 20
+	}
+	if c.RepairConcurrency <= 0 {
+		c.RepairConcurrency = 1
+	}
+	if c.IdempotencyTTL == 0 {
+		c.IdempotencyTTL = 10 * time.Minute
+	}
+	if c.AuditInterval == 0 {
+		c.AuditInterval = 10 * time.Minute
+	}
+	if c.AuditSample <= 0 {
+		c.AuditSample = 100
+	}
+	if c.MaxReplicaRequests <= 0 {
+		c.MaxReplicaRequests = 512
+	}
+	if c.MaxTransferRequests <= 0 {
+		c.MaxTransferRequests = 8
+	}
+	if c.MaxPeerTransfers <= 0 {
+		c.MaxPeerTransfers = 2
+	}
+	if c.BackgroundThrottle < 0 {
+		return fmt.Errorf("unexpected background throttle %d", c.BackgroundThrottle)
+	}
+	if c.BackgroundWindowsCSV != "" {
+		windows, err := schedule.ParseAll(splitCSV(c.BackgroundWindowsCSV))
+		if err != nil {
+			return fmt.Errorf("unexpected background windows: %w", err)
+		}
+		c.BackgroundWindows = windows
+	}
+	if c.AlertRulesCSV != "" {
+		rules, err := alerts.ParseAll(splitCSV(c.AlertRulesCSV))
+		if err != nil {
+			return fmt.Errorf("unexpected alert rules: %w", err)
+		}
+		c.AlertRules = rules
+	}
+	if c.AlertInterval <= 0 {
+		c.AlertInterval = 30 * time.Second
+	}
 	if c.SeedsCSV != "" {
-		parts := strings.Split(c.SeedsCSV, ",")
-		for _, p := range parts {
-			s := strings.TrimSpace(p)
-			if s != "" {
-				c.Seeds = append(c.Seeds, s)
-			}
+		c.Seeds = splitCSV(c.SeedsCSV)
+	}
+	if c.StandbyFor != "" {
+		if c.NodeID != "" && c.NodeID != c.StandbyFor {
+			return fmt.Errorf("a standby takes the node id of its primary %s, got %s", c.StandbyFor, c.NodeID)
+		}
+		if len(c.Seeds) == 0 {
+			return errors.New("a standby needs seeds to learn the ring from")
+		}
+		c.NodeID = c.StandbyFor
+	}
+	if c.StandbyInterval <= 0 {
+		c.StandbyInterval = 10 * time.Second
+	}
+	if c.StandbyPromoteAfter < 0 {
+		return fmt.Errorf("unexpected standby promotion delay %v", c.StandbyPromoteAfter)
+	}
+	if err := c.parseTenants(); err != nil {
+		return err
+	}
+	var err error
+	if c.PublicMiddleware, err = c.parseMiddleware("public", c.PublicMiddlewareCSV); err != nil {
+		return err
+	}
+	if c.InternalMiddleware, err = c.parseMiddleware("internal", c.InternalMiddlewareCSV); err != nil {
+		return err
+	}
+	if c.PeerCodecs, err = codec.Parse(splitCSV(c.PeerCodecsCSV)); err != nil {
+		return fmt.Errorf("unexpected peer codecs: %w", err)
+	}
+	if c.AdminMiddleware, err = c.parseMiddleware("admin", c.AdminMiddlewareCSV); err != nil {
+		return err
+	}
+	if c.AdminToken != "" {
+		if slices.Contains(c.AdminMiddleware, "auth") {
+			return errors.New("an admin token replaces the auth middleware on the admin endpoints")
+		}
+		if c.AdminToken == c.AuthToken || c.Tenants[c.AdminToken] != "" {
+			return errors.New("the admin token must differ from the auth and tenant tokens")
+		}
+	}
+	if c.ClusterToken != "" && (c.ClusterToken == c.AuthToken || c.ClusterToken == c.AdminToken || c.Tenants[c.ClusterToken] != "") {
+		return errors.New("the cluster token must differ from the auth, admin and tenant tokens")
+	}
+	if len(c.Tenants) > 0 {
+		// A tenant must not reach other tenants' keys past the public API
+		if !slices.Contains(c.PublicMiddleware, "auth") {
+			return errors.New("tenant tokens require the auth middleware on the public listener")
+		}
+		if c.ClusterToken == "" {
+			return errors.New("tenant tokens require a cluster token on the internal endpoints")
+		}
+		if c.AdminToken == "" && c.AdminAddr == "" && !slices.Contains(c.AdminMiddleware, "auth") {
+			return errors.New("tenant tokens require an admin token, the auth middleware on the admin endpoints or a separate admin listener")
 		}
 	}
+	// Resolve the identity last so that a rejected config does not bump the incarnation
+	if c.DataDir != "" {
+		id, err := identity.Load(c.DataDir, c.NodeID)
+		if err != nil {
+			return fmt.Errorf("failed to load node identity: %w", err)
+		}
+		c.NodeID = id.NodeID
+		c.Incarnation = id.Incarnation
+	}
+	if c.NodeID == "" {
+		// Default node id to hostname if available
+		c.NodeID = generateDefaultNodeID()
+	}
 	if c.NodeID == "" {
 		return errors.New("node-id must be set or resolvable from hostname")
 	}
 	return nil
 }
 
+// parseMiddleware splits a listener's middleware chain and checks that every
+// name is known and has the settings it depends on.
+func (c *Config) parseMiddleware(listener, csv string) ([]string, error) {
+	names := splitCSV(csv)
+	for _, name := range names {
+		if !slices.Contains(KnownMiddleware, name) {
+			return nil, fmt.Errorf("unexpected %s middleware %q (want one of %s)", listener, name, strings.Join(KnownMiddleware, ", "))
+		}
+		if name == "auth" && c.AuthToken == "" && len(c.Tenants) == 0 {
+			return nil, fmt.Errorf("%s middleware auth requires an auth token or tenant tokens", listener)
+		}
+		if name == "ratelimit" && (c.RateLimit <= 0 || c.RateBurst <= 0) {
+			return nil, fmt.Errorf("%s middleware ratelimit requires a positive rate and burst (rate=%v burst=%d)", listener, c.RateLimit, c.RateBurst)
+		}
+	}
+	return names, nil
+}
+
+// tenantName matches the names namespaces may have, since a tenant's keys
+// form the namespace of its name.
+var tenantName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// parseTenants reads the name=token pairs of TenantTokensCSV into Tenants.
+func (c *Config) parseTenants() error {
+	c.Tenants = nil
+	for _, pair := range splitCSV(c.TenantTokensCSV) {
+		name, token, _ := strings.Cut(pair, "=")
+		if !tenantName.MatchString(name) {
+			return fmt.Errorf("unexpected tenant name %q (want 1 to 64 letters, digits, '_', '.' or '-')", name)
+		}
+		if token == "" {
+			return fmt.Errorf("tenant %s has no token", name)
+		}
+		if token == c.AuthToken || c.Tenants[token] != "" {
+			return fmt.Errorf("tenant %s shares its token with another tenant or the auth token", name)
+		}
+		if c.Tenants == nil {
+			c.Tenants = make(map[string]string)
+		}
+		c.Tenants[token] = name
+	}
+	return nil
+}
+
+func splitCSV(csv string) []string {
+	var out []string
+	for _, p := range strings.Split(csv, ",") {
+		if s := strings.TrimSpace(p); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
 func generateDefaultNodeID() string {
 	// For now, hostname is sufficient; later we may compose with a short ID
 	if h, err := osHostname(); err == nil && h != "" {
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"flag"
+	"time"
+)
+
+// Flags binds the flags of the dhtnode daemon on fs to a new config, which
+// holds their defaults until fs is parsed.
+func Flags(fs *flag.FlagSet) *Config {
+	c := &Config{}
+	fs.StringVar(&c.NodeID, "node-id", "", "Unique node identifier")
+	fs.StringVar(&c.DataDir, "data-dir", "", "Directory for persistent node state such as the generated node identity, stats history and snapshots")
+	fs.StringVar(&c.BindAddr, "bind", ":8080", "Bind address, e.g. 0.0.0.0:8080")
+	fs.StringVar(&c.GRPCAddr, "grpc-bind", "", "gRPC API bind address, e.g. 0.0.0.0:9090 (empty = disabled)")
+	fs.StringVar(&c.SeedsCSV, "seeds", "", "Comma-separated seed addresses for gossip (host:port)")
+	fs.IntVar(&c.BootstrapExpect, "expect", 0, "Number of nodes that must join before writes are accepted (0 = accept immediately)")
+	fs.IntVar(&c.ReplicationFactor, "replication-factor", 3, "Replication factor N")
+	fs.IntVar(&c.ReadQuorum, "r", 2, "Read quorum R")
+	fs.IntVar(&c.WriteQuorum, "w", 2, "Write quorum W")
+	fs.StringVar(&c.Datacenter, "datacenter", "", "Datacenter of this node, announced to peers; local_quorum reads and writes count only replicas in it")
+	fs.DurationVar(&c.ReapInterval, "reap-interval", 30*time.Second, "Interval between sweeps that remove expired keys")
+	fs.IntVar(&c.MaxConcurrentStreams, "max-concurrent-streams", 250, "Maximum concurrent HTTP/2 streams per client connection on each listener")
+	fs.IntVar(&c.MaxKeys, "max-keys", 0, "Maximum number of keys held in memory before LRU eviction (0 = unbounded)")
+	fs.Int64Var(&c.MaxBytes, "max-bytes", 0, "Maximum bytes of keys and values held in memory before LRU eviction (0 = unbounded)")
+	fs.DurationVar(&c.TombstoneGrace, "tombstone-grace", time.Hour, "Age after which tombstones may be dropped before live data when memory is bounded")
+	fs.IntVar(&c.ChunkSize, "chunk-size", 1<<20, "Values larger than this many bytes are stored as chunks behind a manifest")
+	fs.Int64Var(&c.MaxValueBytes, "max-value-bytes", 64<<20, "Maximum size in bytes of a single value")
+	fs.DurationVar(&c.PeerTimeout, "peer-timeout", 5*time.Second, "Upper bound on any request to another node; clients may set a shorter deadline with X-Timeout")
+	fs.IntVar(&c.AccessTrackedKeys, "access-tracked-keys", 10000, "How many of the most read keys have their reads counted (0 = none)")
+	fs.DurationVar(&c.IdempotencyTTL, "idempotency-ttl", 10*time.Minute, "How long the response to a write with an Idempotency-Key is replayed to retries (negative = ignore the header)")
+	fs.DurationVar(&c.ScanCursorTTL, "scan-cursor-ttl", 5*time.Minute, "How long an idle scan cursor keeps its snapshot before it expires")
+	fs.BoolVar(&c.LWW, "lww", false, "Stamp writes with the client X-Timestamp, so that the latest client write wins between concurrent versions, once it passes the -max-clock-drift check")
+	fs.DurationVar(&c.MaxClockDrift, "max-clock-drift", 5*time.Second, "Maximum allowed deviation of client timestamps from the coordinator clock")
+	fs.StringVar(&c.DriftPolicy, "clock-drift-policy", "reject", "What to do with writes exceeding max-clock-drift: reject or warn")
+	fs.StringVar(&c.PeerCodecsCSV, "peer-codecs", DefaultPeerCodecs, "Codecs internal HTTP bodies are compressed with, in order of preference; each peer gets the first it supports (none always works)")
+	fs.StringVar(&c.PeerTransport, "peer-transport", "http", "How requests to peers are sent: http (JSON) or grpc (both are always served on -bind)")
+	fs.StringVar(&c.AdminAddr, "admin-bind", "", "Bind address for health, readiness, stats and /admin/ endpoints (empty = same as -bind)")
+	fs.StringVar(&c.PublicMiddlewareCSV, "public-middleware", "metrics,recovery", "Comma-separated middleware chain for the public KV API, outermost first")
+	fs.StringVar(&c.InternalMiddlewareCSV, "internal-middleware", "metrics,recovery", "Comma-separated middleware chain for internal replication endpoints, outermost first")
+	fs.StringVar(&c.AdminMiddlewareCSV, "admin-middleware", "metrics,recovery", "Comma-separated middleware chain for admin endpoints, outermost first")
+	fs.StringVar(&c.AuthToken, "auth-token", "", "Bearer token required by the auth middleware; its bearer sees every tenant's keys")
+	fs.StringVar(&c.AdminToken, "admin-token", "", "Bearer token required by the admin endpoints instead of the auth middleware; it grants nothing on the public API")
+	fs.StringVar(&c.ClusterToken, "cluster-token", "", "Bearer token nodes present to each other; the internal endpoints and the gRPC Replica service refuse requests without it")
+	fs.StringVar(&c.TenantTokensCSV, "tenant-tokens", "", "Comma-separated tenant=token pairs; the auth middleware confines a tenant token to the keys under the tenant's name")
+	fs.Float64Var(&c.RateLimit, "rate-limit", 0, "Requests per second allowed per listener by the ratelimit middleware")
+	fs.IntVar(&c.RateBurst, "rate-burst", 100, "Burst size allowed by the ratelimit middleware")
+	fs.StringVar(&c.MetricsBackend, "metrics-backend", "prometheus", "Where metrics go: prometheus (scraped from /metrics), statsd or none")
+	fs.StringVar(&c.StatsDAddr, "statsd-addr", "", "StatsD agent address (host:port) for the statsd metrics backend")
+	fs.StringVar(&c.MirrorAddr, "mirror-addr", "", "Address of a shadow cluster node that receives a copy of sampled client traffic (empty = disabled)")
+	fs.Float64Var(&c.MirrorPercent, "mirror-percent", 10, "Percentage of client reads and writes mirrored to -mirror-addr")
+	fs.IntVar(&c.MaxSiblings, "max-siblings", 0, "Maximum concurrent versions of a key (0 = unlimited)")
+	fs.StringVar(&c.SiblingOverflow, "sibling-overflow", "lww", "What a write past -max-siblings does: lww (supersede them, latest write wins) or reject")
+	fs.BoolVar(&c.SloppyQuorum, "sloppy-quorum", false, "Let writes reach W through fallback nodes holding hints for down replicas (default strict quorum)")
+	fs.DurationVar(&c.JoinStagger, "join-stagger", time.Second, "Minimum time between new members this node admits into the ring as a seed (0 = no throttling)")
+	fs.StringVar(&c.HintDir, "hint-dir", "", "Directory for writes awaiting handoff to down replicas (empty = <data-dir>/hints, disabled without -data-dir)")
+	fs.IntVar(&c.MaxHintsPerTarget, "max-hints-per-target", 10000, "Maximum hints queued for a single down replica (0 = unbounded)")
+	fs.Int64Var(&c.MaxHintBytes, "max-hint-bytes", 256<<20, "Maximum bytes of keys and values held as hints (0 = unbounded)")
+	fs.DurationVar(&c.HintTTL, "hint-ttl", 3*time.Hour, "Hints older than this are dropped and left to read repair")
+	fs.Float64Var(&c.MaxQPS, "max-qps", 0, "Requests per second a node is sized for, used by its capacity score (0 = -rate-limit)")
+	fs.StringVar(&c.CapacityWebhook, "capacity-webhook", "", "URL that receives a POST when the cluster capacity score crosses a threshold (empty = disabled)")
+	fs.Float64Var(&c.CapacityHighWater, "capacity-high-water", 80, "Cluster capacity score, in percent, above which the cluster needs to scale out")
+	fs.Float64Var(&c.CapacityLowWater, "capacity-low-water", 20, "Cluster capacity score, in percent, below which the cluster can scale in")
+	fs.StringVar(&c.BackgroundWindowsCSV, "background-windows", "", "Comma-separated local time windows such as \"mon-fri 22:00-06:00\" in which heavy background jobs run at full rate (empty = always)")
+	fs.IntVar(&c.BackgroundThrottle, "background-throttle", 4, "Outside -background-windows, heavy background jobs run on one tick in this many (0 = paused)")
+	fs.StringVar(&c.AlertRulesCSV, "alert-rules", "", "Comma-separated thresholds such as \"hint_backlog>1000,disk_percent>=90\" on this node's metrics that raise an alert (empty = none)")
+	fs.StringVar(&c.AlertWebhook, "alert-webhook", "", "URL that receives a POST when an alert rule starts or stops firing (empty = log only)")
+	fs.DurationVar(&c.AlertInterval, "alert-interval", 30*time.Second, "How often the alert rules are checked")
+	fs.DurationVar(&c.RepairInterval, "repair-interval", time.Hour, "How often anti-entropy repairs each token range this node is primary for (negative = disabled)")
+	fs.Int64Var(&c.RepairRate, "repair-rate", 1<<20, "Bytes per second anti-entropy may transfer")
+	fs.IntVar(&c.RepairConcurrency, "repair-concurrency", 1, "Token ranges anti-entropy repairs at once")
+	fs.DurationVar(&c.AuditInterval, "audit-interval", 10*time.Minute, "How often the replica auditor checks a sample of keys for missing copies (negative = disabled)")
+	fs.IntVar(&c.AuditSample, "audit-sample", 100, "Keys the replica auditor checks each time")
+	fs.IntVar(&c.MaxReplicaRequests, "max-replica-requests", 512, "Replica reads and writes from peers served at once")
+	fs.IntVar(&c.MaxTransferRequests, "max-transfer-requests", 8, "Batch writes and range listings from peers served at once")
+	fs.IntVar(&c.MaxPeerTransfers, "max-peer-transfers", 2, "Range listings served at once to any one peer")
+	fs.StringVar(&c.StandbyFor, "standby-for", "", "Run as a warm standby for the node with this ID, copying its ranges until promoted to take over its tokens (empty = regular node)")
+	fs.DurationVar(&c.StandbyInterval, "standby-interval", 10*time.Second, "How often a standby copies its primary's ranges")
+	fs.DurationVar(&c.StandbyPromoteAfter, "standby-promote-after", 0, "Promote a standby once its primary has been unreachable this long (0 = only by POST /admin/standby/promote)")
+	return c
+}
+
+// Defaults returns a config holding the flag defaults of the dhtnode
+// daemon, for nodes configured other than from its command line.
+func Defaults() *Config {
+	return Flags(flag.NewFlagSet("dhtnode", flag.ContinueOnError))
+}
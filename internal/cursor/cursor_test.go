@@ -0,0 +1,46 @@
+package cursor
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	c := Cursor{Listing: Export, Prefix: "orders/", Token: 42, Key: "orders/7", Snapshot: "abc"}
+	got, err := Decode(Export, c.Encode())
+	if err != nil {
+		t.Fatalf("Failed to decode cursor: %v", err)
+	}
+	if got != c {
+		t.Errorf("Expected %+v, got %+v", c, got)
+	}
+}
+
+func TestDecodeRefusesForeignCursors(t *testing.T) {
+	scan := Cursor{Listing: Scan, Key: "k"}.Encode()
+	for _, raw := range []string{"", "not base64!", "a2V5", scan} {
+		if _, err := Decode(Range, raw); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected %q to be refused, got %v", raw, err)
+		}
+	}
+}
+
+func TestBefore(t *testing.T) {
+	c := Cursor{Token: 10, Key: "m"}
+	tests := []struct {
+		token uint64
+		key   string
+		want  bool
+	}{
+		{9, "z", true},
+		{10, "a", true},
+		{10, "m", true},
+		{10, "n", false},
+		{11, "a", false},
+	}
+	for _, tt := range tests {
+		if got := c.Before(tt.token, tt.key); got != tt.want {
+			t.Errorf("Expected (%d, %q) before the cursor: %t, got %t", tt.token, tt.key, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,465 @@
+// Package hints keeps the writes a coordinator could not deliver to their
+// intended replicas, queued per target node on disk so that they survive a
+// coordinator restart until they are handed off.
+package hints
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+)
+
+// fileSuffix marks a target's queue file in the store directory.
+const fileSuffix = ".hints"
+
+// ErrFull reports that accepting a hint would exceed the store's limits.
+var ErrFull = errors.New("hint store is full")
+
+// Hint is a write destined for Target that has not been delivered yet.
+type Hint struct {
+	Target string `json:"target"`
+	Key    string `json:"key"`
+	Value  []byte `json:"value"`
+	// Version and Timestamp are those of the write, so that replaying it
+	// never overwrites a newer value the target received meanwhile.
+	Version   clock.VectorClock `json:"version,omitempty"`
+	Timestamp time.Time         `json:"timestamp,omitzero"`
+	ExpiresAt time.Time         `json:"expires_at,omitzero"` // expiry of the value itself
+	Tombstone bool              `json:"tombstone,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	// ContentType and Meta are those the value was written with.
+	ContentType string            `json:"content_type,omitempty"`
+	Meta        map[string]string `json:"meta,omitempty"`
+	// Seq orders the hints of a target. Add sets it, and Ack takes that of
+	// the last hint delivered.
+	Seq uint64 `json:"seq"`
+}
+
+func (h Hint) size() int64 {
+	return int64(len(h.Key) + len(h.Value))
+}
+
+// Limits bounds a store. A zero field means unbounded.
+type Limits struct {
+	// MaxHintsPerTarget caps the queue of a single target node so one long
+	// outage cannot crowd out hints for the others.
+	MaxHintsPerTarget int
+	// MaxBytes caps the key plus value bytes held across all targets.
+	MaxBytes int64
+	// TTL drops hints that are older than this; a replica down for longer
+	// must be repaired by anti-entropy instead.
+	TTL time.Duration
+}
+
+// Store is a set of per-target FIFO queues. Every queue is mirrored in
+// memory and kept in a file of JSON lines that is only appended to: a hint
+// is a line, and an acknowledgement is a line naming the sequence number
+// of the last hint it removes. Expired hints are dropped in memory only,
+// as they are still expired when the file is loaded again. Once the lines
+// no longer needed outnumber the hints still queued, the file is compacted
+// to just those hints, so draining a queue costs time in proportion to its
+// length.
+type Store struct {
+	dir    string
+	limits Limits
+	now    func() time.Time
+
+	mu     sync.Mutex
+	queues map[string]*queue
+	bytes  int64
+	// next is the sequence number the next hint added gets. It is shared
+	// by the queues so that a queue emptied and started again never reuses
+	// the number of a hint still being delivered.
+	next uint64
+}
+
+// compactMinLines is how many lines a queue file must have that are no
+// longer needed before it is compacted, so that short queues are not
+// rewritten on every acknowledgement.
+const compactMinLines = 64
+
+type queue struct {
+	hints []Hint
+	lines int      // in the file
+	file  *os.File // open for appending
+}
+
+// ackRecord is the line an acknowledgement appends: every hint up to and
+// including sequence number AckedThrough has been delivered.
+type ackRecord struct {
+	AckedThrough uint64 `json:"acked_through"`
+}
+
+// record is a line of a queue file, either a hint or an acknowledgement.
+type record struct {
+	Hint
+	AckedThrough *uint64 `json:"acked_through,omitempty"`
+}
+
+// Open loads the queues kept in dir, creating it when needed. A line cut
+// short by a crash during an append is dropped.
+func Open(dir string, limits Limits) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, limits: limits, now: time.Now, queues: make(map[string]*queue)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), fileSuffix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		raw, err := hex.DecodeString(name)
+		if err != nil {
+			continue
+		}
+		if err := s.load(string(raw)); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Store) path(target string) string {
+	return filepath.Join(s.dir, hex.EncodeToString([]byte(target))+fileSuffix)
+}
+
+// load reads a target's queue file, rewriting it when lines were damaged.
+func (s *Store) load(target string) error {
+	data, err := os.ReadFile(s.path(target))
+	if err != nil {
+		return err
+	}
+	q := &queue{}
+	var next uint64
+	damaged := false
+	now := s.now()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			damaged = true
+			continue
+		}
+		q.lines++
+		if r.AckedThrough != nil {
+			q.drop(*r.AckedThrough)
+			continue
+		}
+		next = max(next, r.Seq+1)
+		if s.expired(r.Hint, now) {
+			continue
+		}
+		q.hints = append(q.hints, r.Hint)
+	}
+	for _, h := range q.hints {
+		s.bytes += h.size()
+	}
+	s.next = max(s.next, next)
+	s.queues[target] = q
+	if damaged || len(q.hints) == 0 || q.compactable() {
+		return s.rewrite(target, q)
+	}
+	return nil
+}
+
+// drop removes the hints numbered up to through and returns them.
+func (q *queue) drop(through uint64) []Hint {
+	n := 0
+	for n < len(q.hints) && q.hints[n].Seq <= through {
+		n++
+	}
+	dropped := q.hints[:n]
+	q.hints = q.hints[n:]
+	return dropped
+}
+
+// compactable reports whether enough of the file's lines are no longer
+// needed to rewrite it.
+func (q *queue) compactable() bool {
+	dead := q.lines - len(q.hints)
+	return dead >= compactMinLines && dead > len(q.hints)
+}
+
+// appendLine appends a line to a target's queue file and syncs it to disk.
+// Callers must hold s.mu.
+func (s *Store) appendLine(target string, q *queue, v any) error {
+	if q.file == nil {
+		f, err := os.OpenFile(s.path(target), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		q.file = f
+	}
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := q.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := q.file.Sync(); err != nil {
+		return err
+	}
+	q.lines++
+	return nil
+}
+
+// Add appends a hint to its target's queue and syncs it to disk before
+// returning. It returns ErrFull when a limit would be exceeded.
+func (s *Store) Add(h Hint) error {
+	if h.Target == "" {
+		return errors.New("hint has no target")
+	}
+	if h.CreatedAt.IsZero() {
+		h.CreatedAt = s.now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.queues[h.Target]
+	if q != nil && s.limits.MaxHintsPerTarget > 0 && len(q.hints) >= s.limits.MaxHintsPerTarget {
+		return fmt.Errorf("%w: %d hints queued for %s", ErrFull, len(q.hints), h.Target)
+	}
+	if s.limits.MaxBytes > 0 && s.bytes+h.size() > s.limits.MaxBytes {
+		return fmt.Errorf("%w: %d of %d bytes used", ErrFull, s.bytes, s.limits.MaxBytes)
+	}
+	if q == nil {
+		q = &queue{}
+		s.queues[h.Target] = q
+	}
+	h.Seq = s.next
+	if err := s.appendLine(h.Target, q, h); err != nil {
+		return err
+	}
+	q.hints = append(q.hints, h)
+	s.next++
+	s.bytes += h.size()
+	return nil
+}
+
+// Peek returns up to n of the oldest live hints for target without removing them.
+func (s *Store) Peek(target string, n int) []Hint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queues[target]
+	if q == nil {
+		return nil
+	}
+	s.expire(target, q)
+	n = min(n, len(q.hints))
+	return append([]Hint(nil), q.hints[:n]...)
+}
+
+// Ack removes the hints for target up to and including the one numbered
+// through, once they have been delivered, recording it with a line appended
+// to the queue file and synced. Hints are named by sequence number rather
+// than counted, so that hints expired or added since they were peeked at
+// do not shift which ones are removed.
+func (s *Store) Ack(target string, through uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queues[target]
+	if q == nil {
+		return nil
+	}
+	dropped := q.drop(through)
+	if len(dropped) == 0 {
+		return nil
+	}
+	for _, h := range dropped {
+		s.bytes -= h.size()
+	}
+	if len(q.hints) == 0 || q.compactable() {
+		return s.rewrite(target, q)
+	}
+	return s.appendLine(target, q, ackRecord{AckedThrough: through})
+}
+
+// Drop removes every hint queued for target, as when it leaves the ring.
+func (s *Store) Drop(target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queues[target]
+	if q == nil {
+		return nil
+	}
+	for _, h := range q.hints {
+		s.bytes -= h.size()
+	}
+	q.hints = nil
+	return s.rewrite(target, q)
+}
+
+// Expire drops every hint past the TTL or whose value has expired and
+// returns how many were dropped.
+func (s *Store) Expire() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := 0
+	for target, q := range s.queues {
+		n, err := s.expire(target, q)
+		dropped += n
+		if err != nil {
+			return dropped, err
+		}
+	}
+	return dropped, nil
+}
+
+// expire drops the expired hints of one queue. The file keeps them until
+// it is compacted. Callers must hold s.mu.
+func (s *Store) expire(target string, q *queue) (int, error) {
+	now := s.now()
+	live := q.hints[:0]
+	for _, h := range q.hints {
+		if s.expired(h, now) {
+			s.bytes -= h.size()
+			continue
+		}
+		live = append(live, h)
+	}
+	dropped := len(q.hints) - len(live)
+	if dropped == 0 {
+		return 0, nil
+	}
+	clear(q.hints[len(live):])
+	q.hints = live
+	if len(q.hints) == 0 || q.compactable() {
+		return dropped, s.rewrite(target, q)
+	}
+	return dropped, nil
+}
+
+func (s *Store) expired(h Hint, now time.Time) bool {
+	if !h.ExpiresAt.IsZero() && !now.Before(h.ExpiresAt) {
+		return true
+	}
+	return s.limits.TTL > 0 && now.Sub(h.CreatedAt) >= s.limits.TTL
+}
+
+// rewrite replaces a target's queue file with the hints still queued,
+// through a temporary file that is synced before it is renamed over the
+// old one, and the directory after, so that a crash leaves either the old
+// contents or the new. An empty queue removes the file. Callers must hold
+// s.mu.
+func (s *Store) rewrite(target string, q *queue) error {
+	if q.file != nil {
+		q.file.Close()
+		q.file = nil
+	}
+	path := s.path(target)
+	if len(q.hints) == 0 {
+		delete(s.queues, target)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return syncDir(s.dir)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, h := range q.hints {
+		if err := enc.Encode(h); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := writeSynced(tmp, buf.Bytes()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	q.lines = len(q.hints)
+	return syncDir(s.dir)
+}
+
+// writeSynced writes data to a new file at path and syncs it to disk.
+func writeSynced(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir makes the renames and removals in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Targets returns the nodes that have hints queued, sorted.
+func (s *Store) Targets() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	targets := make([]string, 0, len(s.queues))
+	for target := range s.queues {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// Len returns the number of hints queued for target, including expired
+// hints that have not been dropped yet.
+func (s *Store) Len(target string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q := s.queues[target]; q != nil {
+		return len(q.hints)
+	}
+	return 0
+}
+
+// Bytes returns the key plus value bytes held across all targets.
+func (s *Store) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytes
+}
+
+// Close releases the open queue files. Queued hints stay on disk.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	for _, q := range s.queues {
+		if q.file == nil {
+			continue
+		}
+		if err := q.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		q.file = nil
+	}
+	return firstErr
+}
@@ -0,0 +1,176 @@
+package hints
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStoreSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Limits{})
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if err := s.Add(Hint{Target: "node-1", Key: key, Value: []byte("v")}); err != nil {
+			t.Fatalf("Failed to add hint: %v", err)
+		}
+	}
+	if err := s.Add(Hint{Target: "node/2", Key: "d", Value: []byte("v")}); err != nil {
+		t.Fatalf("Failed to add hint: %v", err)
+	}
+	if err := s.Ack("node-1", s.Peek("node-1", 1)[0].Seq); err != nil {
+		t.Fatalf("Failed to ack hint: %v", err)
+	}
+	s.Close()
+
+	reopened, err := Open(dir, Limits{})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+	if got := reopened.Targets(); len(got) != 2 || got[0] != "node-1" || got[1] != "node/2" {
+		t.Errorf("Expected both targets after reopen, got %v", got)
+	}
+	hints := reopened.Peek("node-1", 10)
+	if len(hints) != 2 || hints[0].Key != "b" || hints[1].Key != "c" {
+		t.Errorf("Expected hints b and c in order, got %+v", hints)
+	}
+	if got := reopened.Bytes(); got != 6 {
+		t.Errorf("Expected 6 bytes accounted, got %d", got)
+	}
+}
+
+func TestStoreDropsTornLine(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(dir, Limits{})
+	s.Add(Hint{Target: "node-1", Key: "a", Value: []byte("v")})
+	s.Close()
+
+	f, err := os.OpenFile(s.path("node-1"), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("Failed to open queue file: %v", err)
+	}
+	f.WriteString(`{"target":"node-1","key":"b`)
+	f.Close()
+
+	reopened, err := Open(dir, Limits{})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+	if n := reopened.Len("node-1"); n != 1 {
+		t.Errorf("Expected the torn hint to be dropped, got %d hints", n)
+	}
+	if err := reopened.Add(Hint{Target: "node-1", Key: "c"}); err != nil || reopened.Len("node-1") != 2 {
+		t.Errorf("Expected appends to work after recovery, got %v", err)
+	}
+}
+
+func TestStoreLimits(t *testing.T) {
+	s, _ := Open(t.TempDir(), Limits{MaxHintsPerTarget: 2, MaxBytes: 10})
+	defer s.Close()
+
+	s.Add(Hint{Target: "node-1", Key: "a", Value: []byte("1")})
+	s.Add(Hint{Target: "node-1", Key: "b", Value: []byte("2")})
+	if err := s.Add(Hint{Target: "node-1", Key: "c"}); !errors.Is(err, ErrFull) {
+		t.Errorf("Expected ErrFull past the per-target cap, got %v", err)
+	}
+	if err := s.Add(Hint{Target: "node-2", Key: "d", Value: []byte("123456")}); !errors.Is(err, ErrFull) {
+		t.Errorf("Expected ErrFull past the byte cap, got %v", err)
+	}
+	if err := s.Add(Hint{Target: "node-2", Key: "d", Value: []byte("12345")}); err != nil {
+		t.Errorf("Expected hint within the byte cap to be accepted, got %v", err)
+	}
+}
+
+func TestStoreExpiry(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s, _ := Open(t.TempDir(), Limits{TTL: time.Minute})
+	defer s.Close()
+	s.now = func() time.Time { return now }
+
+	s.Add(Hint{Target: "node-1", Key: "old"})
+	s.Add(Hint{Target: "node-1", Key: "short-lived", ExpiresAt: now.Add(time.Second)})
+	now = now.Add(30 * time.Second)
+	s.Add(Hint{Target: "node-1", Key: "new"})
+
+	now = now.Add(45 * time.Second)
+	dropped, err := s.Expire()
+	if err != nil || dropped != 2 {
+		t.Errorf("Expected 2 expired hints to be dropped, got %d, %v", dropped, err)
+	}
+	if hints := s.Peek("node-1", 10); len(hints) != 1 || hints[0].Key != "new" {
+		t.Errorf("Expected only the new hint to remain, got %+v", hints)
+	}
+}
+
+func TestStoreAppendsAcks(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(dir, Limits{})
+	for i := range 200 {
+		s.Add(Hint{Target: "node-1", Key: fmt.Sprint(i)})
+	}
+	before, _ := os.Stat(s.path("node-1"))
+	if err := s.Ack("node-1", s.Peek("node-1", 2)[1].Seq); err != nil {
+		t.Fatalf("Failed to ack hints: %v", err)
+	}
+	after, _ := os.Stat(s.path("node-1"))
+	if !os.SameFile(before, after) || after.Size() <= before.Size() {
+		t.Errorf("Expected the ack appended to the queue file, got %d bytes from %d", after.Size(), before.Size())
+	}
+	s.Close()
+
+	reopened, _ := Open(dir, Limits{})
+	if hints := reopened.Peek("node-1", 1); len(hints) != 1 || hints[0].Key != "2" {
+		t.Errorf("Expected the acked hints gone after reopen, got %+v", hints)
+	}
+	for range 60 {
+		reopened.Ack("node-1", reopened.Peek("node-1", 2)[1].Seq)
+	}
+	q := reopened.queues["node-1"]
+	if q.lines-len(q.hints) > max(len(q.hints), compactMinLines) {
+		t.Errorf("Expected the queue file compacted, got %d lines for %d hints", q.lines, len(q.hints))
+	}
+	reopened.Close()
+
+	again, _ := Open(dir, Limits{})
+	defer again.Close()
+	if hints := again.Peek("node-1", 1); again.Len("node-1") != 78 || hints[0].Key != "122" {
+		t.Errorf("Expected 78 hints from 122 after compaction, got %d from %+v", again.Len("node-1"), hints)
+	}
+}
+
+func TestStoreAckNamesDeliveredHints(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s, _ := Open(t.TempDir(), Limits{})
+	defer s.Close()
+	s.now = func() time.Time { return now }
+
+	s.Add(Hint{Target: "node-1", Key: "short-lived", ExpiresAt: now.Add(time.Second)})
+	s.Add(Hint{Target: "node-1", Key: "a"})
+	s.Add(Hint{Target: "node-1", Key: "b"})
+	peeked := s.Peek("node-1", 2)
+
+	// short-lived expires while it and a are being delivered
+	now = now.Add(time.Minute)
+	s.Expire()
+	if err := s.Ack("node-1", peeked[1].Seq); err != nil {
+		t.Fatalf("Failed to ack hints: %v", err)
+	}
+	if hints := s.Peek("node-1", 10); len(hints) != 1 || hints[0].Key != "b" {
+		t.Errorf("Expected b, never delivered, to stay queued, got %+v", hints)
+	}
+
+	// A queue emptied and started again does not reuse sequence numbers
+	peeked = s.Peek("node-1", 1)
+	s.Drop("node-1")
+	s.Add(Hint{Target: "node-1", Key: "c"})
+	s.Ack("node-1", peeked[0].Seq)
+	if hints := s.Peek("node-1", 10); len(hints) != 1 || hints[0].Key != "c" {
+		t.Errorf("Expected c, added after the queue was emptied, to stay queued, got %+v", hints)
+	}
+}
@@ -0,0 +1,92 @@
+package identity
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileName is the identity file kept in the node's data directory.
+const fileName = "node-identity.json"
+
+// Identity is what a node persists so that restarts keep the same ring
+// position. Vnode tokens are derived from the NodeID, so keeping the ID
+// keeps the tokens.
+type Identity struct {
+	NodeID string `json:"node_id"`
+	// Incarnation is bumped on every start so peers can tell restarts apart.
+	// It follows the wall clock in Unix nanoseconds, as the incarnation of a
+	// node without a data directory does, so that neither kind of start looks
+	// older to peers than the other.
+	Incarnation uint64 `json:"incarnation"`
+}
+
+// Load reads the identity stored in dir, creating one when none exists. A
+// non-empty nodeID names a new identity and must match an existing one;
+// otherwise a random UUID is generated. The incarnation is advanced to the
+// current time, or past the saved one if the clock is behind it, and saved
+// before Load returns.
+func Load(dir, nodeID string) (Identity, error) {
+	path := filepath.Join(dir, fileName)
+	var id Identity
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		id.NodeID = nodeID
+		if id.NodeID == "" {
+			if id.NodeID, err = newUUID(); err != nil {
+				return Identity{}, err
+			}
+		}
+	case err != nil:
+		return Identity{}, err
+	default:
+		if err := json.Unmarshal(data, &id); err != nil {
+			return Identity{}, fmt.Errorf("invalid identity file %s: %w", path, err)
+		}
+		if id.NodeID == "" {
+			return Identity{}, fmt.Errorf("identity file %s has no node id", path)
+		}
+		if nodeID != "" && nodeID != id.NodeID {
+			return Identity{}, fmt.Errorf("node-id %q does not match %q persisted in %s", nodeID, id.NodeID, path)
+		}
+	}
+
+	id.Incarnation = max(id.Incarnation+1, uint64(time.Now().UnixNano()))
+	if err := save(dir, id); err != nil {
+		return Identity{}, err
+	}
+	return id, nil
+}
+
+// save writes the identity through a temporary file so a crash never leaves it truncated.
+func save(dir string, id Identity) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(id, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, fileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, fileName))
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,70 @@
+package identity
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestLoadGeneratesAndKeepsIdentity(t *testing.T) {
+	dir := t.TempDir()
+	started := uint64(time.Now().UnixNano())
+
+	first, err := Load(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to create identity: %v", err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(first.NodeID) {
+		t.Errorf("Expected a version 4 UUID, got %q", first.NodeID)
+	}
+	if first.Incarnation < started {
+		t.Errorf("Expected the first incarnation to follow the clock from %d, got %d", started, first.Incarnation)
+	}
+
+	second, err := Load(dir, "")
+	if err != nil {
+		t.Fatalf("Failed to reload identity: %v", err)
+	}
+	if second.NodeID != first.NodeID {
+		t.Errorf("Expected node id to survive restart, got %q then %q", first.NodeID, second.NodeID)
+	}
+	if second.Incarnation <= first.Incarnation {
+		t.Errorf("Expected incarnation to be bumped past %d, got %d", first.Incarnation, second.Incarnation)
+	}
+}
+
+func TestLoadIncarnationFollowsClock(t *testing.T) {
+	started := uint64(time.Now().UnixNano())
+	tests := map[string]struct {
+		saved uint64
+		want  func(got uint64) bool
+	}{
+		// A counter saved before incarnations followed the clock
+		"counter": {saved: 3, want: func(got uint64) bool { return got >= started }},
+		// A clock that went back since the last start
+		"ahead": {saved: started + uint64(time.Hour), want: func(got uint64) bool { return got == started+uint64(time.Hour)+1 }},
+	}
+	for name, tt := range tests {
+		dir := t.TempDir()
+		if err := save(dir, Identity{NodeID: "node-a", Incarnation: tt.saved}); err != nil {
+			t.Fatalf("Failed to save identity: %v", err)
+		}
+		id, err := Load(dir, "")
+		if err != nil || !tt.want(id.Incarnation) {
+			t.Errorf("Expected the %s incarnation advanced from %d, got %d, %v", name, tt.saved, id.Incarnation, err)
+		}
+	}
+}
+
+func TestLoadExplicitNodeID(t *testing.T) {
+	dir := t.TempDir()
+	if id, err := Load(dir, "node-a"); err != nil || id.NodeID != "node-a" {
+		t.Fatalf("Expected node-a to be persisted, got %+v, %v", id, err)
+	}
+	if _, err := Load(dir, "node-a"); err != nil {
+		t.Errorf("Expected matching node id to load, got %v", err)
+	}
+	if _, err := Load(dir, "node-b"); err == nil {
+		t.Error("Expected error when node id differs from the persisted one")
+	}
+}
@@ -0,0 +1,176 @@
+// Package lifecycle starts and stops the subsystems of a node in
+// dependency order: a subsystem starts after the subsystems it depends on
+// and stops before them.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds the start and the stop of a subsystem that sets no
+// timeout of its own.
+const DefaultTimeout = 5 * time.Second
+
+// Subsystem is one part of a node that is started and stopped as a whole.
+type Subsystem struct {
+	Name      string
+	DependsOn []string
+	// Start brings the subsystem up and returns; work it leaves running
+	// must end when Stop is called. A nil Start starts nothing.
+	Start func(ctx context.Context) error
+	// Stop ends the work of the subsystem, giving up once ctx ends. A nil
+	// Stop stops nothing.
+	Stop func(ctx context.Context) error
+	// Timeout bounds Start and Stop each; zero means DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Loop returns a subsystem that runs run in a goroutine of its own; run
+// must return once stop is closed. Stopping it waits for run to return.
+func Loop(name string, run func(stop <-chan struct{}), dependsOn ...string) Subsystem {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	return Subsystem{
+		Name:      name,
+		DependsOn: dependsOn,
+		Start: func(context.Context) error {
+			go func() {
+				defer close(done)
+				run(stop)
+			}()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			close(stop)
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return fmt.Errorf("still running: %w", ctx.Err())
+			}
+		},
+	}
+}
+
+// Manager starts and stops a set of subsystems.
+type Manager struct {
+	mu         sync.Mutex
+	subsystems []Subsystem
+	started    []Subsystem // in start order
+}
+
+// Add registers subsystems; it must be called before Start.
+func (m *Manager) Add(subsystems ...Subsystem) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subsystems = append(m.subsystems, subsystems...)
+}
+
+// Start starts every subsystem after those it depends on. When one fails
+// to start, the ones already started are stopped again and the error names
+// the subsystem that failed.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.started) > 0 {
+		return errors.New("already started")
+	}
+	ordered, err := order(m.subsystems)
+	if err != nil {
+		return err
+	}
+	for _, sub := range ordered {
+		if err := call(ctx, sub, sub.Start); err != nil {
+			stopErr := m.stopLocked(context.Background())
+			return errors.Join(fmt.Errorf("start %s: %w", sub.Name, err), stopErr)
+		}
+		m.started = append(m.started, sub)
+	}
+	return nil
+}
+
+// Stop stops the started subsystems in the reverse of the order they
+// started in. A subsystem that fails to stop, or takes longer than its
+// timeout, does not hold up the rest; the error lists every one that
+// failed.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stopLocked(ctx)
+}
+
+func (m *Manager) stopLocked(ctx context.Context) error {
+	var errs []error
+	for i := len(m.started) - 1; i >= 0; i-- {
+		sub := m.started[i]
+		if err := call(ctx, sub, sub.Stop); err != nil {
+			errs = append(errs, fmt.Errorf("stop %s: %w", sub.Name, err))
+		}
+	}
+	m.started = nil
+	return errors.Join(errs...)
+}
+
+// call runs fn, a Start or Stop of sub, within the subsystem's timeout.
+func call(ctx context.Context, sub Subsystem, fn func(context.Context) error) error {
+	if fn == nil {
+		return nil
+	}
+	timeout := sub.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// order sorts subsystems so that each follows those it depends on, keeping
+// the order they were added in otherwise.
+func order(subsystems []Subsystem) ([]Subsystem, error) {
+	byName := make(map[string]Subsystem, len(subsystems))
+	for _, sub := range subsystems {
+		if _, dup := byName[sub.Name]; dup {
+			return nil, fmt.Errorf("subsystem %s added twice", sub.Name)
+		}
+		byName[sub.Name] = sub
+	}
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(subsystems))
+	ordered := make([]Subsystem, 0, len(subsystems))
+	var visit func(sub Subsystem) error
+	visit = func(sub Subsystem) error {
+		switch state[sub.Name] {
+		case visiting:
+			return fmt.Errorf("subsystem %s depends on itself", sub.Name)
+		case visited:
+			return nil
+		}
+		state[sub.Name] = visiting
+		for _, name := range sub.DependsOn {
+			dep, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("subsystem %s depends on unknown subsystem %s", sub.Name, name)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[sub.Name] = visited
+		ordered = append(ordered, sub)
+		return nil
+	}
+	for _, sub := range subsystems {
+		if err := visit(sub); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,99 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder builds subsystems that log their starts and stops.
+type recorder struct {
+	log []string
+}
+
+func (r *recorder) sub(name string, deps ...string) Subsystem {
+	return Subsystem{
+		Name:      name,
+		DependsOn: deps,
+		Start: func(context.Context) error {
+			r.log = append(r.log, "start "+name)
+			return nil
+		},
+		Stop: func(context.Context) error {
+			r.log = append(r.log, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func TestDependencyOrder(t *testing.T) {
+	r := &recorder{}
+	var m Manager
+	m.Add(r.sub("listeners", "storage", "metrics"), r.sub("storage", "metrics"), r.sub("metrics"), r.sub("repair", "listeners"))
+	if err := m.Start(t.Context()); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	if err := m.Stop(t.Context()); err != nil {
+		t.Fatalf("Failed to stop: %v", err)
+	}
+	want := []string{
+		"start metrics", "start storage", "start listeners", "start repair",
+		"stop repair", "stop listeners", "stop storage", "stop metrics",
+	}
+	if !slices.Equal(r.log, want) {
+		t.Errorf("Expected %v, got %v", want, r.log)
+	}
+}
+
+func TestStartFailureStopsStarted(t *testing.T) {
+	r := &recorder{}
+	broken := r.sub("listeners", "storage")
+	broken.Start = func(context.Context) error { return errors.New("address in use") }
+	var m Manager
+	m.Add(r.sub("storage"), broken, r.sub("repair", "listeners"))
+	err := m.Start(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "start listeners: address in use") {
+		t.Fatalf("Expected the failed subsystem to be named, got %v", err)
+	}
+	if want := []string{"start storage", "stop storage"}; !slices.Equal(r.log, want) {
+		t.Errorf("Expected %v, got %v", want, r.log)
+	}
+}
+
+func TestInvalidDependencies(t *testing.T) {
+	r := &recorder{}
+	var cyclic Manager
+	cyclic.Add(r.sub("a", "b"), r.sub("b", "a"))
+	if err := cyclic.Start(t.Context()); err == nil || !strings.Contains(err.Error(), "depends on itself") {
+		t.Errorf("Expected a dependency cycle to be rejected, got %v", err)
+	}
+	var unknown Manager
+	unknown.Add(r.sub("a", "missing"))
+	if err := unknown.Start(t.Context()); err == nil || !strings.Contains(err.Error(), "unknown subsystem missing") {
+		t.Errorf("Expected an unknown dependency to be rejected, got %v", err)
+	}
+	if len(r.log) != 0 {
+		t.Errorf("Expected nothing to start, got %v", r.log)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	r := &recorder{}
+	stuck := Loop("stuck", func(<-chan struct{}) { select {} })
+	stuck.Timeout = 10 * time.Millisecond
+	var m Manager
+	m.Add(r.sub("storage"), stuck, Loop("ticker", func(stop <-chan struct{}) { <-stop }, "storage"))
+	if err := m.Start(t.Context()); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	err := m.Stop(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "stop stuck: still running") || strings.Contains(err.Error(), "ticker") {
+		t.Errorf("Expected only the stuck loop to fail to stop, got %v", err)
+	}
+	if r.log[len(r.log)-1] != "stop storage" {
+		t.Errorf("Expected a stuck subsystem not to hold up the rest, got %v", r.log)
+	}
+}
@@ -1,13 +1,150 @@
 package membership
 
+import (
+	"maps"
+	"sort"
+	"sync"
+)
+
 // Placeholder for gossip-based membership and failure detection.
-// Phase 4 will implement SWIM-like or memberlist-based gossip.
+// Phase 4 will implement SWIM-like or memberlist-based gossip. Until then
+// a Cluster only tracks what this node has observed directly: peers are
+// marked dead when requests to them fail and alive when they answer again.
 
 type Node struct {
 	ID   string
 	Addr string
+	// Incarnation increases every time the node restarts so that peers can
+	// tell a rejoining node apart from stale announcements of its old address.
+	Incarnation uint64
+}
+
+// State is this node's view of a peer.
+type State int
+
+const (
+	Alive State = iota
+	Dead
+)
+
+func (s State) String() string {
+	if s == Dead {
+		return "dead"
+	}
+	return "alive"
+}
+
+// Event reports that a peer changed state.
+type Event struct {
+	NodeID string
+	State  State
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind by
+// before further events are dropped for it.
+const subscriberBuffer = 64
+
+// Cluster tracks the liveness of peers and notifies subscribers of changes.
+// Peers it has not heard about are alive. It also keeps the metadata each
+// peer announced about itself when it joined.
+type Cluster struct {
+	mu          sync.Mutex
+	dead        map[string]bool
+	meta        map[string]map[string]string
+	subscribers []chan Event
+}
+
+func NewCluster() *Cluster {
+	return &Cluster{dead: make(map[string]bool), meta: make(map[string]map[string]string)}
+}
+
+// MarkAlive records that nodeID answered, notifying subscribers if it was dead.
+func (c *Cluster) MarkAlive(nodeID string) {
+	c.set(nodeID, Alive)
 }
 
-type Cluster struct{}
+// MarkDead records that nodeID could not be reached, notifying subscribers
+// if it was alive.
+func (c *Cluster) MarkDead(nodeID string) {
+	c.set(nodeID, Dead)
+}
+
+func (c *Cluster) set(nodeID string, state State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dead[nodeID] == (state == Dead) {
+		return
+	}
+	if state == Dead {
+		c.dead[nodeID] = true
+	} else {
+		delete(c.dead, nodeID)
+	}
+	for _, ch := range c.subscribers {
+		select {
+		case ch <- Event{NodeID: nodeID, State: state}:
+		default:
+		}
+	}
+}
+
+// Forget drops what is known about nodeID, which left the cluster for good,
+// without notifying subscribers.
+func (c *Cluster) Forget(nodeID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.dead, nodeID)
+	delete(c.meta, nodeID)
+}
+
+// SetMeta records the metadata nodeID announced, replacing what it
+// announced before.
+func (c *Cluster) SetMeta(nodeID string, meta map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(meta) == 0 {
+		delete(c.meta, nodeID)
+		return
+	}
+	c.meta[nodeID] = maps.Clone(meta)
+}
 
-func NewCluster() *Cluster { return &Cluster{} }
+// Meta returns the metadata nodeID announced, or nil if it announced none.
+func (c *Cluster) Meta(nodeID string) map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.meta[nodeID])
+}
+
+// State returns the current view of nodeID.
+func (c *Cluster) State(nodeID string) State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dead[nodeID] {
+		return Dead
+	}
+	return Alive
+}
+
+// Dead returns the peers currently marked dead, sorted.
+func (c *Cluster) Dead() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]string, 0, len(c.dead))
+	for nodeID := range c.dead {
+		out = append(out, nodeID)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Subscribe returns a channel receiving every later state change. Events
+// are dropped for a subscriber that falls too far behind, so subscribers
+// should also reconcile periodically with State or Dead.
+func (c *Cluster) Subscribe() <-chan Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan Event, subscriberBuffer)
+	c.subscribers = append(c.subscribers, ch)
+	return ch
+}
@@ -0,0 +1,54 @@
+// Package metrics abstracts where the node's measurements go, so operators
+// can scrape them with Prometheus or push them to a StatsD agent.
+package metrics
+
+import (
+	"fmt"
+	"time"
+)
+
+// Backend names accepted by New.
+const (
+	BackendPrometheus = "prometheus"
+	BackendStatsD     = "statsd"
+	BackendNone       = "none"
+)
+
+// Backends lists the accepted backend names.
+var Backends = []string{BackendPrometheus, BackendStatsD, BackendNone}
+
+// Metrics records measurements by name. Names are lower snake case without
+// a prefix; each backend adds its own. Implementations are safe for
+// concurrent use.
+type Metrics interface {
+	// Count adds delta to a monotonically increasing counter.
+	Count(name string, delta int64)
+	// Gauge sets the current value of a measurement.
+	Gauge(name string, value float64)
+	// Observe records one duration sample.
+	Observe(name string, d time.Duration)
+}
+
+// New returns the named backend. addr is the StatsD agent address and is
+// ignored by the other backends.
+func New(backend, addr string) (Metrics, error) {
+	switch backend {
+	case BackendPrometheus:
+		return NewPrometheus("dht"), nil
+	case BackendStatsD:
+		return NewStatsD(addr, "dht")
+	case BackendNone:
+		return Discard, nil
+	default:
+		return nil, fmt.Errorf("unexpected metrics backend %q", backend)
+	}
+}
+
+// Discard drops every measurement.
+var Discard Metrics = discard{}
+
+type discard struct{}
+
+func (discard) Count(string, int64)           {}
+func (discard) Gauge(string, float64)         {}
+func (discard) Observe(string, time.Duration) {}
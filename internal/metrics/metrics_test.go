@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusExposition(t *testing.T) {
+	p := NewPrometheus("dht")
+	p.Count("requests", 2)
+	p.Count("requests", 1)
+	p.Gauge("keys", 42)
+	p.Observe("request_duration", 500*time.Millisecond)
+	p.Observe("request_duration", time.Second)
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE dht_requests_total counter\ndht_requests_total 3\n",
+		"# TYPE dht_keys gauge\ndht_keys 42\n",
+		"dht_request_duration_seconds_sum 1.5\ndht_request_duration_seconds_count 2\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected exposition to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestStatsDPackets(t *testing.T) {
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer agent.Close()
+
+	s, err := NewStatsD(agent.LocalAddr().String(), "dht")
+	if err != nil {
+		t.Fatalf("Failed to create statsd sink: %v", err)
+	}
+	defer s.Close()
+	s.Count("requests", 1)
+	s.Gauge("keys", 7)
+	s.Observe("request_duration", 1500*time.Microsecond)
+
+	buf := make([]byte, 512)
+	for _, want := range []string{"dht.requests:1|c", "dht.keys:7|g", "dht.request_duration:1.5|ms"} {
+		_ = agent.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := agent.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Failed to read packet: %v", err)
+		}
+		if got := string(buf[:n]); got != want {
+			t.Errorf("Expected packet %q, got %q", want, got)
+		}
+	}
+}
+
+func TestNewRejectsUnknownBackend(t *testing.T) {
+	if _, err := New("graphite", ""); err == nil {
+		t.Errorf("Expected an error for an unknown backend")
+	}
+}
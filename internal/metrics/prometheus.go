@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Prometheus keeps measurements in memory and serves them in the Prometheus
+// text exposition format. Counters gain a "_total" suffix and durations are
+// exposed as summaries in seconds without quantiles.
+type Prometheus struct {
+	prefix    string
+	mu        sync.Mutex
+	counters  map[string]int64
+	gauges    map[string]float64
+	summaries map[string]*summary
+}
+
+type summary struct {
+	count int64
+	sum   time.Duration
+}
+
+// NewPrometheus returns an empty registry whose metric names start with prefix and "_".
+func NewPrometheus(prefix string) *Prometheus {
+	return &Prometheus{
+		prefix:    prefix,
+		counters:  make(map[string]int64),
+		gauges:    make(map[string]float64),
+		summaries: make(map[string]*summary),
+	}
+}
+
+func (p *Prometheus) Count(name string, delta int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counters[name] += delta
+}
+
+func (p *Prometheus) Gauge(name string, value float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gauges[name] = value
+}
+
+func (p *Prometheus) Observe(name string, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.summaries[name]
+	if !ok {
+		s = &summary{}
+		p.summaries[name] = s
+	}
+	s.count++
+	s.sum += d
+}
+
+// ServeHTTP writes every metric, sorted by name within each kind.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, name := range sortedKeys(p.counters) {
+		full := p.prefix + "_" + name + "_total"
+		fmt.Fprintf(w, "# TYPE %s counter\n%s %d\n", full, full, p.counters[name])
+	}
+	for _, name := range sortedKeys(p.gauges) {
+		full := p.prefix + "_" + name
+		fmt.Fprintf(w, "# TYPE %s gauge\n%s %s\n", full, full, strconv.FormatFloat(p.gauges[name], 'g', -1, 64))
+	}
+	for _, name := range sortedKeys(p.summaries) {
+		full := p.prefix + "_" + name + "_seconds"
+		s := p.summaries[name]
+		fmt.Fprintf(w, "# TYPE %s summary\n%s_sum %s\n%s_count %d\n", full, full, strconv.FormatFloat(s.sum.Seconds(), 'g', -1, 64), full, s.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
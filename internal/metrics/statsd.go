@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// StatsD pushes every measurement to a StatsD agent over UDP as it happens.
+// Delivery is best effort: send errors are dropped like lost datagrams.
+type StatsD struct {
+	prefix string
+	conn   net.Conn
+}
+
+// NewStatsD sends to the agent at addr, prefixing names with prefix and ".".
+func NewStatsD(addr, prefix string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial statsd agent %s: %w", addr, err)
+	}
+	return &StatsD{prefix: prefix, conn: conn}, nil
+}
+
+func (s *StatsD) Count(name string, delta int64) {
+	s.send(name, strconv.FormatInt(delta, 10), "c")
+}
+
+func (s *StatsD) Gauge(name string, value float64) {
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g")
+}
+
+func (s *StatsD) Observe(name string, d time.Duration) {
+	s.send(name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64), "ms")
+}
+
+// Close releases the UDP socket.
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+func (s *StatsD) send(name, value, kind string) {
+	_, _ = fmt.Fprintf(s.conn, "%s.%s:%s|%s", s.prefix, name, value, kind)
+}
@@ -0,0 +1,84 @@
+// Package quorum evaluates how many replicas a read or write must hear
+// from: the R or W a request asks for, and whether the replicas that
+// answered reach it. The HTTP, gRPC and batch paths share it so that a
+// request means the same on each.
+package quorum
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Named levels a request may give instead of a replica count, relative to
+// the replication factor N.
+const (
+	One         = "one"          // a single replica
+	Quorum      = "quorum"       // a majority, N/2+1
+	All         = "all"          // every replica
+	LocalQuorum = "local_quorum" // a majority of the replicas in the local datacenter
+)
+
+// Parse reads the quorum a request asks for, written as a positive count
+// or a named level, for a replication factor of n. It returns def when raw
+// is empty or neither, so that a header carrying some other consistency
+// option leaves the default in place.
+func Parse(raw string, n, def int) int {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "":
+		return def
+	case One:
+		return 1
+	case Quorum, LocalQuorum:
+		return Majority(n)
+	case All:
+		return max(n, 1)
+	}
+	count, err := strconv.Atoi(raw)
+	if err != nil {
+		return def
+	}
+	return Requested(count, def)
+}
+
+// Local reports whether raw asks for a quorum of the local datacenter. The
+// count Parse returns for it holds when every replica is local; callers
+// that know the datacenters of the replicas count with Majority of the
+// local ones instead.
+func Local(raw string) bool {
+	return strings.ToLower(strings.TrimSpace(raw)) == LocalQuorum
+}
+
+// Downgraded reports whether Effective lowers q for replicas.
+func Downgraded(q, replicas int) bool {
+	return Effective(q, replicas) < q
+}
+
+// Requested returns the count a request gave, or def when it gave none.
+func Requested(count, def int) int {
+	if count > 0 {
+		return count
+	}
+	return def
+}
+
+// Majority is the smallest count that overlaps any other majority of n.
+func Majority(n int) int {
+	return n/2 + 1
+}
+
+// Effective downgrades q to the replicas there are, so that a ring of
+// fewer nodes than the replication factor can still reach its quorum.
+func Effective(q, replicas int) int {
+	return max(min(q, replicas), 1)
+}
+
+// Met reports whether acks replicas reach q of replicas.
+func Met(acks, q, replicas int) bool {
+	return acks >= Effective(q, replicas)
+}
+
+// Reachable reports whether acks replicas, with pending yet to answer,
+// can still reach q.
+func Reachable(acks, pending, q int) bool {
+	return acks+pending >= q
+}
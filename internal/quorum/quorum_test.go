@@ -0,0 +1,144 @@
+package quorum
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw    string
+		n, def int
+		want   int
+	}{
+		{"", 3, 2, 2},
+		{"1", 3, 2, 1},
+		{"3", 3, 2, 3},
+		{"5", 3, 2, 5},
+		{"0", 3, 2, 2},
+		{"-1", 3, 2, 2},
+		{"two", 3, 2, 2},
+		{"bounded(5s)", 3, 2, 2},
+		{"one", 3, 2, 1},
+		{"ONE", 5, 3, 1},
+		{"quorum", 3, 1, 2},
+		{"quorum", 4, 1, 3},
+		{"quorum", 5, 1, 3},
+		{"quorum", 1, 2, 1},
+		{" all ", 3, 2, 3},
+		{"all", 5, 2, 5},
+		{"all", 0, 2, 1},
+		{"local_quorum", 3, 1, 2},
+		{"LOCAL_QUORUM", 5, 1, 3},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.raw, tt.n, tt.def); got != tt.want {
+			t.Errorf("Parse(%q, %d, %d): expected %d, got %d", tt.raw, tt.n, tt.def, tt.want, got)
+		}
+	}
+}
+
+func TestRequested(t *testing.T) {
+	tests := []struct {
+		count, def, want int
+	}{
+		{0, 2, 2},
+		{-3, 2, 2},
+		{1, 2, 1},
+		{4, 2, 4},
+	}
+	for _, tt := range tests {
+		if got := Requested(tt.count, tt.def); got != tt.want {
+			t.Errorf("Requested(%d, %d): expected %d, got %d", tt.count, tt.def, tt.want, got)
+		}
+	}
+}
+
+func TestEffective(t *testing.T) {
+	tests := []struct {
+		q, replicas, want int
+	}{
+		{2, 3, 2},
+		{3, 3, 3},
+		{3, 2, 2},
+		{2, 1, 1},
+		{2, 0, 1},
+		{0, 3, 1},
+	}
+	for _, tt := range tests {
+		if got := Effective(tt.q, tt.replicas); got != tt.want {
+			t.Errorf("Effective(%d, %d): expected %d, got %d", tt.q, tt.replicas, tt.want, got)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want bool
+	}{
+		{"local_quorum", true},
+		{" Local_Quorum ", true},
+		{"quorum", false},
+		{"2", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := Local(tt.raw); got != tt.want {
+			t.Errorf("Local(%q): expected %v, got %v", tt.raw, tt.want, got)
+		}
+	}
+}
+
+func TestDowngraded(t *testing.T) {
+	tests := []struct {
+		q, replicas int
+		want        bool
+	}{
+		{2, 3, false},
+		{3, 3, false},
+		{3, 2, true},
+		{2, 0, true},
+		{1, 0, false},
+	}
+	for _, tt := range tests {
+		if got := Downgraded(tt.q, tt.replicas); got != tt.want {
+			t.Errorf("Downgraded(%d, %d): expected %v, got %v", tt.q, tt.replicas, tt.want, got)
+		}
+	}
+}
+
+func TestMet(t *testing.T) {
+	tests := []struct {
+		acks, q, replicas int
+		want              bool
+	}{
+		{2, 2, 3, true},
+		{1, 2, 3, false},
+		{3, 2, 3, true},
+		{1, 2, 1, true},
+		{0, 2, 1, false},
+		{2, 3, 2, true},
+		{0, 1, 0, false},
+	}
+	for _, tt := range tests {
+		if got := Met(tt.acks, tt.q, tt.replicas); got != tt.want {
+			t.Errorf("Met(%d, %d, %d): expected %v, got %v", tt.acks, tt.q, tt.replicas, tt.want, got)
+		}
+	}
+}
+
+func TestReachable(t *testing.T) {
+	tests := []struct {
+		acks, pending, q int
+		want             bool
+	}{
+		{0, 3, 2, true},
+		{1, 1, 2, true},
+		{1, 0, 2, false},
+		{0, 1, 2, false},
+		{2, 0, 2, true},
+	}
+	for _, tt := range tests {
+		if got := Reachable(tt.acks, tt.pending, tt.q); got != tt.want {
+			t.Errorf("Reachable(%d, %d, %d): expected %v, got %v", tt.acks, tt.pending, tt.q, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package ring
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// BalanceOptions tunes the simulated annealing search behind Balance.
+type BalanceOptions struct {
+	// MoveWeight trades data movement against evenness: the cost of a plan
+	// is its ownership variance plus MoveWeight times the fraction of the
+	// key space whose primary owner changes.
+	MoveWeight float64
+	// Iterations is the number of candidate adjustments tried.
+	Iterations int
+	// MaxVNodes caps the vnodes a single node may be given. Zero means
+	// twice the current per-node count.
+	MaxVNodes int
+	// Seed makes the search reproducible.
+	Seed int64
+}
+
+// BalancePlan is a proposed vnode count per node. Node n keeps the tokens
+// of "n-vnode-0" through "n-vnode-(count-1)", so a plan only adds or drops
+// tokens at the end of each node's sequence and never relocates one.
+type BalancePlan struct {
+	VNodes          map[NodeID]int     `json:"vnodes"`
+	Ownership       map[NodeID]float64 `json:"ownership"`
+	Current         map[NodeID]float64 `json:"current_ownership"`
+	Variance        float64            `json:"variance"`
+	CurrentVariance float64            `json:"current_variance"`
+	Moved           float64            `json:"moved"`
+}
+
+// token is one vnode position in an offline ring layout.
+type token struct {
+	hash uint64
+	node int
+}
+
+// Balance searches for per-node vnode counts that minimise ownership
+// variance and data movement together, starting from every node holding
+// vnodeCount vnodes. Variance is measured on ownership normalised to the
+// fair share, so 0 means every node owns exactly 1/len(nodes) of the ring.
+func Balance(nodes []NodeID, vnodeCount int, opts BalanceOptions) (BalancePlan, error) {
+	if len(nodes) == 0 {
+		return BalancePlan{}, fmt.Errorf("no nodes in ring")
+	}
+	if vnodeCount <= 0 {
+		return BalancePlan{}, fmt.Errorf("vnode count must be positive")
+	}
+	if opts.MaxVNodes <= 0 {
+		opts.MaxVNodes = 2 * vnodeCount
+	}
+	if opts.MaxVNodes < vnodeCount {
+		return BalancePlan{}, fmt.Errorf("max vnodes %d is below the current count %d", opts.MaxVNodes, vnodeCount)
+	}
+	nodes = append([]NodeID(nil), nodes...)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+
+	// Hash every token a node could be given once up front
+	hashes := make([][]uint64, len(nodes))
+	for n, nodeID := range nodes {
+		hashes[n] = make([]uint64, opts.MaxVNodes)
+		for i := range hashes[n] {
+			hashes[n][i] = hash64(fmt.Sprintf(vnodeIDFormat, nodeID, i))
+		}
+	}
+	layout := func(counts []int) []token {
+		var tokens []token
+		for n, count := range counts {
+			for _, h := range hashes[n][:count] {
+				tokens = append(tokens, token{h, n})
+			}
+		}
+		sort.Slice(tokens, func(i, j int) bool { return tokens[i].hash < tokens[j].hash })
+		return tokens
+	}
+
+	current := make([]int, len(nodes))
+	for n := range current {
+		current[n] = vnodeCount
+	}
+	base := layout(current)
+	baseOwnership := ownership(base, len(nodes))
+	cost := func(counts []int) (float64, []float64, float64) {
+		tokens := layout(counts)
+		owned := ownership(tokens, len(nodes))
+		moved := movedFraction(base, tokens)
+		return variance(owned) + opts.MoveWeight*moved, owned, moved
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	counts := append([]int(nil), current...)
+	bestCounts := append([]int(nil), counts...)
+	currentCost, _, _ := cost(counts)
+	bestCost := currentCost
+	step := max(1, vnodeCount/10)
+	temperature := max(currentCost, 1e-6)
+	cooling := math.Pow(1e-4, 1/float64(max(opts.Iterations, 1)))
+	for i := 0; i < opts.Iterations; i++ {
+		n := rng.Intn(len(nodes))
+		delta := rng.Intn(2*step+1) - step
+		next := min(max(counts[n]+delta, 1), opts.MaxVNodes)
+		if delta == 0 || next == counts[n] {
+			continue
+		}
+		previous := counts[n]
+		counts[n] = next
+		candidate, _, _ := cost(counts)
+		if candidate <= currentCost || rng.Float64() < math.Exp((currentCost-candidate)/temperature) {
+			currentCost = candidate
+			if candidate < bestCost {
+				bestCost = candidate
+				copy(bestCounts, counts)
+			}
+		} else {
+			counts[n] = previous
+		}
+		temperature *= cooling
+	}
+
+	_, owned, moved := cost(bestCounts)
+	plan := BalancePlan{
+		VNodes:          make(map[NodeID]int, len(nodes)),
+		Ownership:       make(map[NodeID]float64, len(nodes)),
+		Current:         make(map[NodeID]float64, len(nodes)),
+		Variance:        variance(owned),
+		CurrentVariance: variance(baseOwnership),
+		Moved:           moved,
+	}
+	for n, nodeID := range nodes {
+		plan.VNodes[nodeID] = bestCounts[n]
+		plan.Ownership[nodeID] = owned[n]
+		plan.Current[nodeID] = baseOwnership[n]
+	}
+	return plan, nil
+}
+
+// ownership returns the fraction of the ring each node is primary for. A
+// token owns the arc from its predecessor up to itself.
+func ownership(tokens []token, nodes int) []float64 {
+	owned := make([]float64, nodes)
+	for i, t := range tokens {
+		// Unsigned subtraction wraps the first token's arc around zero
+		arc := t.hash - tokens[(i+len(tokens)-1)%len(tokens)].hash
+		if len(tokens) == 1 {
+			arc = math.MaxUint64
+		}
+		owned[t.node] += float64(arc) / math.MaxUint64
+	}
+	return owned
+}
+
+// variance is the variance of ownership normalised to the fair share.
+func variance(owned []float64) float64 {
+	fair := 1 / float64(len(owned))
+	var sum float64
+	for _, o := range owned {
+		d := o/fair - 1
+		sum += d * d
+	}
+	return sum / float64(len(owned))
+}
+
+// movedFraction returns the fraction of the ring whose primary owner differs
+// between two layouts. Every arc between consecutive boundaries of either
+// layout has a single owner in each.
+func movedFraction(from, to []token) float64 {
+	bounds := make([]uint64, 0, len(from)+len(to))
+	for _, t := range from {
+		bounds = append(bounds, t.hash)
+	}
+	for _, t := range to {
+		bounds = append(bounds, t.hash)
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+
+	var moved float64
+	for i, b := range bounds {
+		arc := b - bounds[(i+len(bounds)-1)%len(bounds)]
+		if arc == 0 {
+			continue
+		}
+		if successor(from, b) != successor(to, b) {
+			moved += float64(arc) / math.MaxUint64
+		}
+	}
+	return moved
+}
+
+// successor returns the node owning position h in a layout.
+func successor(tokens []token, h uint64) int {
+	idx := sort.Search(len(tokens), func(i int) bool { return tokens[i].hash >= h })
+	if idx == len(tokens) {
+		idx = 0
+	}
+	return tokens[idx].node
+}
@@ -0,0 +1,67 @@
+package ring
+
+import "testing"
+
+func TestBalanceReducesVariance(t *testing.T) {
+	nodes := []NodeID{"node1", "node2", "node3", "node4", "node5"}
+	plan, err := Balance(nodes, 8, BalanceOptions{Iterations: 2000, Seed: 1})
+	if err != nil {
+		t.Fatalf("Failed to balance: %v", err)
+	}
+	if plan.Variance >= plan.CurrentVariance {
+		t.Errorf("Expected variance below %f, got %f", plan.CurrentVariance, plan.Variance)
+	}
+	if len(plan.VNodes) != len(nodes) {
+		t.Errorf("Expected %d nodes in plan, got %d", len(nodes), len(plan.VNodes))
+	}
+	var total float64
+	for _, nodeID := range nodes {
+		if count := plan.VNodes[nodeID]; count < 1 || count > 16 {
+			t.Errorf("Expected vnodes for %s within [1, 16], got %d", nodeID, count)
+		}
+		total += plan.Ownership[nodeID]
+	}
+	if total < 0.999 || total > 1.001 {
+		t.Errorf("Expected ownership to sum to 1, got %f", total)
+	}
+}
+
+func TestBalanceMoveWeightLimitsMovement(t *testing.T) {
+	nodes := []NodeID{"node1", "node2", "node3", "node4"}
+	free, err := Balance(nodes, 10, BalanceOptions{Iterations: 1000, Seed: 7})
+	if err != nil {
+		t.Fatalf("Failed to balance: %v", err)
+	}
+	if free.Moved == 0 {
+		t.Fatalf("Expected an unweighted plan to move data")
+	}
+	pinned, err := Balance(nodes, 10, BalanceOptions{MoveWeight: 1000, Iterations: 1000, Seed: 7})
+	if err != nil {
+		t.Fatalf("Failed to balance: %v", err)
+	}
+	if pinned.Moved != 0 {
+		t.Errorf("Expected a heavily weighted plan to keep every token, moved %f", pinned.Moved)
+	}
+	for nodeID, count := range pinned.VNodes {
+		if count != 10 {
+			t.Errorf("Expected %s to keep 10 vnodes, got %d", nodeID, count)
+		}
+	}
+}
+
+func TestMovedFraction(t *testing.T) {
+	layout := []token{{100, 0}, {200, 1}}
+	if moved := movedFraction(layout, layout); moved != 0 {
+		t.Errorf("Expected no movement between identical layouts, got %f", moved)
+	}
+	swapped := []token{{100, 1}, {200, 0}}
+	if moved := movedFraction(layout, swapped); moved < 0.999 {
+		t.Errorf("Expected the whole ring to move, got %f", moved)
+	}
+}
+
+func TestBalanceRejectsEmptyRing(t *testing.T) {
+	if _, err := Balance(nil, 10, BalanceOptions{}); err == nil {
+		t.Errorf("Expected error for empty ring")
+	}
+}
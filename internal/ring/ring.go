@@ -2,8 +2,12 @@ package ring
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math"
+	"slices"
 	"sort"
 	"sync"
 )
@@ -20,23 +24,30 @@ type VNode struct {
 
 // Ring implements consistent hashing with virtual nodes
 type Ring struct {
-	mu         sync.RWMutex
-	vnodes     []VNode
-	nodes      map[NodeID]string // nodeID -> address
-	vnodeCount int               // Number of virtual nodes per physical node
-	ringSize   uint64            // Size of the hash ring (2^64)
+	mu           sync.RWMutex
+	vnodes       []VNode
+	nodes        map[NodeID]string // nodeID -> address
+	incarnations map[NodeID]uint64 // nodeID -> incarnation of its current address
+	vnodeCount   int               // Number of virtual nodes per physical node
+	ringSize     uint64            // Size of the hash ring (2^64)
+	epoch        uint64            // Bumped on every membership or address change
 }
 
+// ErrStaleIncarnation is returned when a node rejoins with an incarnation
+// that is not newer than the one already recorded.
+var ErrStaleIncarnation = errors.New("stale incarnation")
+
 // New creates a new consistent hashing ring
 func New(vnodeCount int) *Ring {
 	if vnodeCount <= 0 {
 		vnodeCount = 100 // Default virtual nodes per physical node
 	}
 	return &Ring{
-		vnodes:     make([]VNode, 0),
-		nodes:      make(map[NodeID]string),
-		vnodeCount: vnodeCount,
-		ringSize:   math.MaxUint64, //2 ^ 64 - 1
+		vnodes:       make([]VNode, 0),
+		nodes:        make(map[NodeID]string),
+		incarnations: make(map[NodeID]uint64),
+		vnodeCount:   vnodeCount,
+		ringSize:     math.MaxUint64, //2 ^ 64 - 1
 	}
 }
 
@@ -48,12 +59,71 @@ func (r *Ring) AddNode(nodeID NodeID, address string) error {
 	if _, exists := r.nodes[nodeID]; exists {
 		return fmt.Errorf("node %s already exists", nodeID)
 	}
+	r.addNode(nodeID, address, 0)
+	return nil
+}
+
+// JoinNode adds a node or, when a node with the same ID is already a member,
+// updates its address if incarnation is newer than the recorded one. A node
+// keeps its ID across restarts, so its vnodes stay in place. JoinNode returns
+// the previous address when it changed so callers can drop connections to it.
+func (r *Ring) JoinNode(nodeID NodeID, address string, incarnation uint64) (previous string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, exists := r.nodes[nodeID]
+	if !exists {
+		r.addNode(nodeID, address, incarnation)
+		return "", nil
+	}
+	known := r.incarnations[nodeID]
+	switch {
+	case incarnation > known:
+		r.nodes[nodeID] = address
+		r.incarnations[nodeID] = incarnation
+		if current != address {
+			r.epoch++
+			return current, nil
+		}
+		return "", nil
+	case incarnation == known && address == current:
+		return "", nil
+	default:
+		return "", fmt.Errorf("node %s at %s with incarnation %d (have %d at %s): %w", nodeID, address, incarnation, known, current, ErrStaleIncarnation)
+	}
+}
 
+// Epoch returns a counter that changes whenever membership or a member's
+// address changes, so clients can tell when their view of the ring is stale.
+func (r *Ring) Epoch() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.epoch
+}
+
+// VNodeCount returns the number of virtual nodes per physical node.
+func (r *Ring) VNodeCount() int {
+	return r.vnodeCount
+}
+
+// Incarnation returns the incarnation recorded for a node.
+func (r *Ring) Incarnation(nodeID NodeID) (uint64, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	incarnation, exists := r.incarnations[nodeID]
+	return incarnation, exists
+}
+
+// addNode records a node and creates its virtual nodes. Callers must hold r.mu.
+func (r *Ring) addNode(nodeID NodeID, address string, incarnation uint64) {
 	r.nodes[nodeID] = address
+	r.incarnations[nodeID] = incarnation
+	r.epoch++
 
 	// Create virtual nodes for this physical node
 	for i := 0; i < r.vnodeCount; i++ {
-		vnodeID := fmt.Sprintf("%s-vnode-%d", nodeID, i)
+		vnodeID := fmt.Sprintf(vnodeIDFormat, nodeID, i)
 		hash := r.hash(vnodeID)
 
 		vnode := VNode{
@@ -69,8 +139,6 @@ func (r *Ring) AddNode(nodeID NodeID, address string) error {
 	sort.Slice(r.vnodes, func(i, j int) bool {
 		return r.vnodes[i].Hash < r.vnodes[j].Hash
 	})
-
-	return nil
 }
 
 // RemoveNode removes a physical node and all its virtual nodes
@@ -93,6 +161,8 @@ func (r *Ring) RemoveNode(nodeID NodeID) error {
 
 	// Remove the physical node
 	delete(r.nodes, nodeID)
+	delete(r.incarnations, nodeID)
+	r.epoch++
 
 	return nil
 }
@@ -113,8 +183,134 @@ func (r *Ring) GetPreferenceList(key string, N int) ([]NodeID, error) {
 	keyHash := r.hash(key)
 
 	// Find the first vnode clockwise from the key's position
-	startIdx := r.findSuccessorIndex(keyHash)
+	return r.preferenceListLocked(r.findSuccessorIndex(keyHash), N), nil
+}
+
+// TokenRange is the arc of the ring (Start, End] whose keys belong to the
+// vnode at End. The range of the first vnode wraps past zero, and a ring
+// with a single vnode has one range holding every key.
+type TokenRange struct {
+	Start, End uint64
+}
+
+// Contains reports whether a key hashing to hash falls in the range.
+func (t TokenRange) Contains(hash uint64) bool {
+	if t.Start < t.End {
+		return hash > t.Start && hash <= t.End
+	}
+	return hash > t.Start || hash <= t.End
+}
+
+// Overlaps reports whether the range shares any position with o.
+func (t TokenRange) Overlaps(o TokenRange) bool {
+	return t.Contains(o.End) || o.Contains(t.End)
+}
+
+// KeyHash returns the position of key on the ring.
+func KeyHash(key string) uint64 {
+	return hash64(key)
+}
+
+// Ranges returns the token ranges of the ring in ring order.
+func (r *Ring) Ranges() []TokenRange {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
+	ranges := make([]TokenRange, len(r.vnodes))
+	for i, vnode := range r.vnodes {
+		prev := r.vnodes[(i+len(r.vnodes)-1)%len(r.vnodes)]
+		ranges[i] = TokenRange{Start: prev.Hash, End: vnode.Hash}
+	}
+	return ranges
+}
+
+// RangeReplicas returns the N nodes responsible for the keys of a range,
+// ordered like the preference list of any of them.
+func (r *Ring) RangeReplicas(tr TokenRange, N int) ([]NodeID, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.vnodes) == 0 {
+		return nil, fmt.Errorf("no nodes in ring")
+	}
+	if N <= 0 || N > len(r.nodes) {
+		N = len(r.nodes)
+	}
+	return r.preferenceListLocked(r.findSuccessorIndex(tr.End), N), nil
+}
+
+// Clone returns a copy of the ring that changes independently of it.
+func (r *Ring) Clone() *Ring {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clone := New(r.vnodeCount)
+	clone.vnodes = append(clone.vnodes, r.vnodes...)
+	for nodeID, address := range r.nodes {
+		clone.nodes[nodeID] = address
+	}
+	for nodeID, incarnation := range r.incarnations {
+		clone.incarnations[nodeID] = incarnation
+	}
+	clone.epoch = r.epoch
+	return clone
+}
+
+// Move is a token range whose N replicas differ between two rings.
+type Move struct {
+	Range TokenRange
+	From  []NodeID // replicas before, in preference order
+	To    []NodeID // replicas after
+}
+
+// Diff returns the token ranges whose N replicas differ between before
+// and after, in ring order. The ranges are bounded by the vnodes of both
+// rings, so each lies within a single range of either.
+func Diff(before, after *Ring, N int) []Move {
+	before.mu.RLock()
+	tokens := make([]uint64, 0, len(before.vnodes))
+	for _, vnode := range before.vnodes {
+		tokens = append(tokens, vnode.Hash)
+	}
+	before.mu.RUnlock()
+	after.mu.RLock()
+	for _, vnode := range after.vnodes {
+		tokens = append(tokens, vnode.Hash)
+	}
+	after.mu.RUnlock()
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i] < tokens[j] })
+	tokens = slices.Compact(tokens)
+
+	var moves []Move
+	for i, end := range tokens {
+		tr := TokenRange{Start: tokens[(i+len(tokens)-1)%len(tokens)], End: end}
+		from := before.replicasAt(end, N)
+		to := after.replicasAt(end, N)
+		if !slices.Equal(from, to) {
+			moves = append(moves, Move{tr, from, to})
+		}
+	}
+	return moves
+}
+
+// replicasAt returns the N replicas of the keys hashing to hash, or none
+// when the ring is empty.
+func (r *Ring) replicasAt(hash uint64, N int) []NodeID {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.vnodes) == 0 {
+		return nil
+	}
+	if N <= 0 || N > len(r.nodes) {
+		N = len(r.nodes)
+	}
+	return r.preferenceListLocked(r.findSuccessorIndex(hash), N)
+}
+
+// preferenceListLocked collects the first N distinct nodes clockwise from
+// the vnode at startIdx. Callers must hold r.mu.
+func (r *Ring) preferenceListLocked(startIdx, N int) []NodeID {
 	// Collect unique nodes in order of proximity
 	seen := make(map[NodeID]bool)
 	preferenceList := make([]NodeID, 0, N)
@@ -130,7 +326,7 @@ func (r *Ring) GetPreferenceList(key string, N int) ([]NodeID, error) {
 		}
 	}
 
-	return preferenceList, nil
+	return preferenceList
 }
 
 // GetNodeAddress returns the address for a given node ID
@@ -176,8 +372,30 @@ func (r *Ring) findSuccessorIndex(hash uint64) int {
 	return idx
 }
 
+// vnodeIDFormat names the i-th vnode of a node; the vnode's position on
+// the ring is the hash of its name.
+const vnodeIDFormat = "%s-vnode-%d"
+
+// placementScheme describes how keys are placed on the ring: the hash
+// function, how vnode positions derive from node IDs and how a key finds
+// its replicas. It must change whenever any of them does.
+const placementScheme = "hash=md5[0:8];vnode=" + vnodeIDFormat + ";replicas=distinct-successors"
+
+// Fingerprint identifies how r places keys, from its placement scheme and
+// vnode count. Rings with different fingerprints put the same key on
+// different replicas, so their nodes must never share a ring.
+func (r *Ring) Fingerprint() string {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s;vnodes=%d", placementScheme, r.vnodeCount))
+	return hex.EncodeToString(sum[:8])
+}
+
 // hash computes a 64-bit hash of the input string
 func (r *Ring) hash(input string) uint64 {
+	return hash64(input)
+}
+
+// hash64 is the ring's hash function, shared with the offline balancer.
+func hash64(input string) uint64 {
 	h := md5.Sum([]byte(input))
 	// Take first 8 bytes to convert the 16 bytes md5 hash into uint64
 	return uint64(h[0])<<56 | uint64(h[1])<<48 | uint64(h[2])<<40 | uint64(h[3])<<32 |
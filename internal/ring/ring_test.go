@@ -1,7 +1,10 @@
 package ring
 
 import (
+	"errors"
 	"math"
+	"slices"
+	"strconv"
 	"testing"
 )
 
@@ -145,3 +148,187 @@ func TestRingDuplicateNode(t *testing.T) {
 		t.Error("Expected error when adding duplicate node")
 	}
 }
+
+func TestRingRejoinNode(t *testing.T) {
+	ring := New(10)
+	if _, err := ring.JoinNode("node1", "127.0.0.1:8080", 1); err != nil {
+		t.Fatalf("Failed to join node1: %v", err)
+	}
+	before, _ := ring.GetPreferenceList("some-key", 1)
+
+	// Restart on a new address with a newer incarnation
+	previous, err := ring.JoinNode("node1", "127.0.0.1:9090", 2)
+	if err != nil {
+		t.Fatalf("Failed to rejoin node1: %v", err)
+	}
+	if previous != "127.0.0.1:8080" {
+		t.Errorf("Expected previous address 127.0.0.1:8080, got %q", previous)
+	}
+	if addr, _ := ring.GetNodeAddress("node1"); addr != "127.0.0.1:9090" {
+		t.Errorf("Expected updated address, got %s", addr)
+	}
+	if len(ring.vnodes) != 10 {
+		t.Errorf("Expected rejoin to keep 10 vnodes, got %d", len(ring.vnodes))
+	}
+	after, _ := ring.GetPreferenceList("some-key", 1)
+	if before[0] != after[0] {
+		t.Errorf("Expected key ownership to be unchanged, got %s then %s", before[0], after[0])
+	}
+
+	// Repeating the same announcement is a no-op
+	if previous, err := ring.JoinNode("node1", "127.0.0.1:9090", 2); err != nil || previous != "" {
+		t.Errorf("Expected idempotent rejoin, got %q, %v", previous, err)
+	}
+
+	// A delayed announcement from the old process is rejected
+	if _, err := ring.JoinNode("node1", "127.0.0.1:8080", 1); !errors.Is(err, ErrStaleIncarnation) {
+		t.Errorf("Expected ErrStaleIncarnation, got %v", err)
+	}
+	if incarnation, _ := ring.Incarnation("node1"); incarnation != 2 {
+		t.Errorf("Expected incarnation 2, got %d", incarnation)
+	}
+}
+
+func TestRingEpoch(t *testing.T) {
+	ring := New(10)
+	start := ring.Epoch()
+
+	ring.AddNode("node1", "127.0.0.1:8080")
+	ring.JoinNode("node2", "127.0.0.1:8081", 1)
+	if ring.Epoch() != start+2 {
+		t.Errorf("Expected epoch to advance once per added node, got %d", ring.Epoch())
+	}
+
+	before := ring.Epoch()
+	ring.JoinNode("node2", "127.0.0.1:8081", 1)
+	ring.JoinNode("node2", "127.0.0.1:8081", 2)
+	if ring.Epoch() != before {
+		t.Errorf("Expected epoch to stay unchanged without a topology change, got %d", ring.Epoch())
+	}
+
+	ring.JoinNode("node2", "127.0.0.1:9091", 3)
+	ring.RemoveNode("node1")
+	if ring.Epoch() != before+2 {
+		t.Errorf("Expected epoch to advance on address change and removal, got %d", ring.Epoch())
+	}
+}
+
+func TestRingRanges(t *testing.T) {
+	ring := New(10)
+	for _, id := range []NodeID{"node1", "node2", "node3"} {
+		if err := ring.AddNode(id, string(id)); err != nil {
+			t.Fatalf("Failed to add %s: %v", id, err)
+		}
+	}
+	ranges := ring.Ranges()
+	if len(ranges) != 30 {
+		t.Fatalf("Expected one range per vnode, got %d", len(ranges))
+	}
+
+	// Every key falls in exactly one range, whose replicas are the key's
+	for i := range 200 {
+		key := "key-" + strconv.Itoa(i)
+		hash := KeyHash(key)
+		var owner []TokenRange
+		for _, tr := range ranges {
+			if tr.Contains(hash) {
+				owner = append(owner, tr)
+			}
+		}
+		if len(owner) != 1 {
+			t.Fatalf("Expected %s in exactly one range, got %d", key, len(owner))
+		}
+		want, _ := ring.GetPreferenceList(key, 2)
+		got, err := ring.RangeReplicas(owner[0], 2)
+		if err != nil || !slices.Equal(got, want) {
+			t.Errorf("Expected the replicas of %s to be %v, got %v, %v", key, want, got, err)
+		}
+	}
+
+	single := New(1)
+	single.AddNode("node1", "node1")
+	if ranges := single.Ranges(); len(ranges) != 1 || !ranges[0].Contains(0) || !ranges[0].Contains(math.MaxUint64) {
+		t.Errorf("Expected a single vnode to own the whole ring, got %+v", ranges)
+	}
+}
+
+func TestTokenRangeOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b TokenRange
+		want bool
+	}{
+		{TokenRange{0, 10}, TokenRange{5, 20}, true},
+		{TokenRange{0, 10}, TokenRange{10, 20}, false},
+		{TokenRange{0, 10}, TokenRange{2, 4}, true},
+		{TokenRange{100, 10}, TokenRange{5, 8}, true},
+		{TokenRange{100, 10}, TokenRange{20, 50}, false},
+		{TokenRange{100, 10}, TokenRange{90, 110}, true},
+		{TokenRange{7, 7}, TokenRange{20, 50}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Overlaps(tt.b); got != tt.want {
+			t.Errorf("Expected %+v overlapping %+v to be %v, got %v", tt.a, tt.b, tt.want, got)
+		}
+		if got := tt.b.Overlaps(tt.a); got != tt.want {
+			t.Errorf("Expected %+v overlapping %+v to be %v, got %v", tt.b, tt.a, tt.want, got)
+		}
+	}
+}
+
+func TestRingFingerprint(t *testing.T) {
+	r := New(20)
+	r.AddNode("a", "a:1")
+	if r.Fingerprint() != New(20).Fingerprint() {
+		t.Error("Expected the fingerprint not to depend on the members")
+	}
+	if r.Fingerprint() == New(40).Fingerprint() {
+		t.Error("Expected the fingerprint to change with the vnode count")
+	}
+}
+
+func TestRingDiff(t *testing.T) {
+	before := New(10)
+	before.AddNode("node1", "node1")
+	before.AddNode("node2", "node2")
+	after := before.Clone()
+	after.AddNode("node3", "node3")
+	if before.Size() != 2 {
+		t.Fatalf("Expected the clone to change independently, got %d nodes", before.Size())
+	}
+
+	moves := Diff(before, after, 2)
+	if len(moves) == 0 {
+		t.Fatalf("Expected a new node to take over some ranges")
+	}
+	for _, move := range moves {
+		if !slices.Contains(move.To, "node3") || slices.Contains(move.From, "node3") {
+			t.Errorf("Expected every move to hand a range to node3, got %+v", move)
+		}
+	}
+
+	// A key moves exactly when its preference list changes
+	for i := range 200 {
+		key := "key-" + strconv.Itoa(i)
+		from, _ := before.GetPreferenceList(key, 2)
+		to, _ := after.GetPreferenceList(key, 2)
+		var found []Move
+		for _, move := range moves {
+			if move.Range.Contains(KeyHash(key)) {
+				found = append(found, move)
+			}
+		}
+		if slices.Equal(from, to) {
+			if len(found) != 0 {
+				t.Errorf("Expected %s not to move, got %+v", key, found)
+			}
+			continue
+		}
+		if len(found) != 1 || !slices.Equal(found[0].From, from) || !slices.Equal(found[0].To, to) {
+			t.Errorf("Expected %s to move from %v to %v, got %+v", key, from, to, found)
+		}
+	}
+
+	if moves := Diff(after, after, 2); len(moves) != 0 {
+		t.Errorf("Expected no moves between equal rings, got %d", len(moves))
+	}
+}
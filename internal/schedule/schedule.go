@@ -0,0 +1,143 @@
+// Package schedule describes recurring weekly time windows, such as the
+// nightly hours in which a node may run heavy background jobs at full rate.
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Window is a daily time range on some days of the week, in local time. A
+// range that ends before it starts runs past midnight and belongs to the
+// day it starts on.
+type Window struct {
+	Days       [7]bool // indexed by time.Weekday
+	Start, End time.Duration
+}
+
+// Parse reads a window written as "[DAYS ]HH:MM-HH:MM". DAYS is "*", a day
+// such as "sat", a range such as "mon-fri", or several of those joined
+// with "+"; without it the window applies every day. "24:00" ends a window
+// at midnight.
+func Parse(spec string) (Window, error) {
+	var w Window
+	fields := strings.Fields(spec)
+	var days, hours string
+	switch len(fields) {
+	case 1:
+		days, hours = "*", fields[0]
+	case 2:
+		days, hours = fields[0], fields[1]
+	default:
+		return Window{}, fmt.Errorf("unexpected window %q (want [DAYS ]HH:MM-HH:MM)", spec)
+	}
+	if err := w.parseDays(days); err != nil {
+		return Window{}, fmt.Errorf("window %q: %w", spec, err)
+	}
+	start, end, ok := strings.Cut(hours, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("window %q: unexpected hours %q (want HH:MM-HH:MM)", spec, hours)
+	}
+	var err error
+	if w.Start, err = parseClock(start); err != nil {
+		return Window{}, fmt.Errorf("window %q: %w", spec, err)
+	}
+	if w.End, err = parseClock(end); err != nil {
+		return Window{}, fmt.Errorf("window %q: %w", spec, err)
+	}
+	if w.Start == w.End {
+		return Window{}, fmt.Errorf("window %q is empty", spec)
+	}
+	return w, nil
+}
+
+func (w *Window) parseDays(spec string) error {
+	for _, part := range strings.Split(spec, "+") {
+		if part == "*" {
+			for d := range w.Days {
+				w.Days[d] = true
+			}
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := parseDay(first)
+		if err != nil {
+			return err
+		}
+		to := from
+		if isRange {
+			if to, err = parseDay(last); err != nil {
+				return err
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			w.Days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseDay(name string) (int, error) {
+	for d, day := range weekdays {
+		if strings.EqualFold(name, day) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unexpected day %q (want one of %s)", name, strings.Join(weekdays, ", "))
+}
+
+func parseClock(hhmm string) (time.Duration, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(hhmm, "%d:%d", &h, &m); err != nil || len(hhmm) != 5 || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("unexpected time %q (want HH:MM)", hhmm)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// Contains reports whether t falls inside the window.
+func (w Window) Contains(t time.Time) bool {
+	// Wall clock time rather than time since midnight, which DST shifts
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	today := t.Weekday()
+	if w.Start < w.End {
+		return w.Days[today] && offset >= w.Start && offset < w.End
+	}
+	// Past midnight the window belongs to the previous day
+	yesterday := (today + 6) % 7
+	return (w.Days[today] && offset >= w.Start) || (w.Days[yesterday] && offset < w.End)
+}
+
+// Schedule is a set of windows. An empty schedule is always open.
+type Schedule []Window
+
+// ParseAll parses every window in specs.
+func ParseAll(specs []string) (Schedule, error) {
+	var s Schedule
+	for _, spec := range specs {
+		w, err := Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, w)
+	}
+	return s, nil
+}
+
+// Open reports whether t falls inside one of the windows.
+func (s Schedule) Open(t time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for _, w := range s {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func at(day time.Weekday, hhmm string) time.Time {
+	// 2024-01-07 was a Sunday
+	t, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-07 "+hhmm, time.Local)
+	return t.AddDate(0, 0, int(day))
+}
+
+func TestWindowContains(t *testing.T) {
+	tests := []struct {
+		spec string
+		at   time.Time
+		want bool
+	}{
+		{"01:00-05:00", at(time.Wednesday, "03:00"), true},
+		{"01:00-05:00", at(time.Wednesday, "05:00"), false},
+		{"mon-fri 09:00-18:00", at(time.Friday, "12:00"), true},
+		{"mon-fri 09:00-18:00", at(time.Saturday, "12:00"), false},
+		{"fri-mon 00:00-24:00", at(time.Sunday, "12:00"), true},
+		{"fri-mon 00:00-24:00", at(time.Tuesday, "12:00"), false},
+		{"sat+sun 10:00-12:00", at(time.Sunday, "11:59"), true},
+		// A window past midnight belongs to the day it starts on
+		{"fri 22:00-06:00", at(time.Saturday, "05:00"), true},
+		{"fri 22:00-06:00", at(time.Friday, "05:00"), false},
+		{"fri 22:00-06:00", at(time.Friday, "23:00"), true},
+	}
+	for _, tt := range tests {
+		w, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.spec, err)
+		}
+		if got := w.Contains(tt.at); got != tt.want {
+			t.Errorf("Expected %q to contain %v: %t, got %t", tt.spec, tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestParseRejectsInvalidWindows(t *testing.T) {
+	for _, spec := range []string{"", "09:00", "9:00-10:00", "25:00-26:00", "10:00-10:00", "funday 01:00-02:00", "mon fri 01:00-02:00"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
+
+func TestScheduleOpen(t *testing.T) {
+	if !Schedule(nil).Open(time.Now()) {
+		t.Errorf("Expected an empty schedule to be always open")
+	}
+	s, err := ParseAll([]string{"01:00-02:00", "sat+sun 10:00-16:00"})
+	if err != nil {
+		t.Fatalf("Failed to parse schedule: %v", err)
+	}
+	if !s.Open(at(time.Saturday, "11:00")) || s.Open(at(time.Monday, "11:00")) {
+		t.Errorf("Expected the schedule to be open on saturday only")
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// Every node answers a replica write with how it took it: applied to its
+// own storage, buffered as a hint for a replica it stands in for, or
+// rejected as stale. A write's X-Consistency-Ack picks the weakest of those
+// that counts towards W. The default, "buffered", lets the hints of a
+// sloppy quorum count; "applied" counts only replicas of the preference
+// list that stored the write, so such a write fails rather than succeeding
+// on hints alone.
+
+// ackHeader selects the acknowledgements a write counts.
+const ackHeader = "X-Consistency-Ack"
+
+type ackContextKey struct{}
+
+// parseAckLevel reads the acknowledgement a write demands; empty means
+// api.AckBuffered.
+func parseAckLevel(raw string) (string, error) {
+	switch raw {
+	case "", api.AckBuffered:
+		return api.AckBuffered, nil
+	case api.AckApplied:
+		return api.AckApplied, nil
+	}
+	return "", fmt.Errorf("invalid %s %q, want %s or %s", ackHeader, raw, api.AckApplied, api.AckBuffered)
+}
+
+// withAckLevel makes the writes under ctx count only level or stronger.
+func withAckLevel(ctx context.Context, level string) context.Context {
+	return context.WithValue(ctx, ackContextKey{}, level)
+}
+
+// countsBuffered reports whether the writes under ctx count hints.
+func countsBuffered(ctx context.Context) bool {
+	level, ok := ctx.Value(ackContextKey{}).(string)
+	return !ok || level == api.AckBuffered
+}
+
+// checkAck turns a node's answer to a replica write into an error, unless
+// it took the write as want.
+func checkAck(address, want string, resp api.ReplicateResponse) error {
+	switch {
+	case resp.Ack == api.AckStale || (resp.Ack == "" && resp.Error == storage.ErrStaleVersion.Error()):
+		return fmt.Errorf("remote node %s: %w", address, storage.ErrStaleVersion)
+	case !resp.Success:
+		return fmt.Errorf("remote node %s failed to store value", address)
+	case resp.Ack != "" && resp.Ack != want:
+		return fmt.Errorf("remote node %s acknowledged the write as %s, not %s", address, resp.Ack, want)
+	}
+	return nil
+}
+
+// sentAck is the acknowledgement a replica write with hintFor expects.
+func sentAck(hintFor string) string {
+	if hintFor != "" {
+		return api.AckBuffered
+	}
+	return api.AckApplied
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestReplicaAcks(t *testing.T) {
+	s := newTestServer(t)
+	post := func(req api.ReplicateRequest) api.ReplicateResponse {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/internal/storage/"+req.Key, bytes.NewReader(body)))
+		var resp api.ReplicateResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode replica response: %v", err)
+		}
+		return resp
+	}
+	write := api.ReplicateRequest{Key: "key", Value: []byte("v"), Version: map[string]uint64{"a": 2}, Checksum: crc32.ChecksumIEEE([]byte("v"))}
+	if resp := post(write); resp.Ack != api.AckApplied {
+		t.Errorf("Expected the write to be applied, got %+v", resp)
+	}
+	write.Version = map[string]uint64{"a": 1}
+	if resp := post(write); resp.Ack != api.AckStale {
+		t.Errorf("Expected an older version to be stale, got %+v", resp)
+	}
+
+	tests := []struct {
+		want string
+		resp api.ReplicateResponse
+		err  bool
+	}{
+		{api.AckApplied, api.ReplicateResponse{Success: true, Ack: api.AckApplied}, false},
+		{api.AckApplied, api.ReplicateResponse{Success: true}, false},
+		{api.AckApplied, api.ReplicateResponse{Success: true, Ack: api.AckBuffered}, true},
+		{api.AckBuffered, api.ReplicateResponse{Success: true, Ack: api.AckBuffered}, false},
+		{api.AckApplied, api.ReplicateResponse{Ack: api.AckStale}, true},
+		{api.AckApplied, api.ReplicateResponse{Error: "failed to store value"}, true},
+	}
+	for _, tt := range tests {
+		if err := checkAck("peer", tt.want, tt.resp); (err != nil) != tt.err {
+			t.Errorf("checkAck(%s, %+v): expected error %v, got %v", tt.want, tt.resp, tt.err, err)
+		}
+	}
+	if err := checkAck("peer", api.AckApplied, api.ReplicateResponse{Ack: api.AckStale}); !errors.Is(err, storage.ErrStaleVersion) {
+		t.Errorf("Expected a stale ack to be ErrStaleVersion, got %v", err)
+	}
+	if _, err := parseAckLevel("durable"); err == nil {
+		t.Errorf("Expected an unknown ack level to be refused")
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/alerts"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// Alert rules watch this node's own metrics, for clusters without an
+// external alerting stack. Every node checks its rules on its own; a rule
+// that starts or stops firing is logged as a JSON line and posted to the
+// alert webhook.
+
+// alertMeter keeps the counters the last alert check read, so that rates
+// cover the interval between checks rather than the whole uptime.
+type alertMeter struct {
+	mu             sync.Mutex
+	requests       int64
+	serverErrors   int64
+	quorumFailures int64
+}
+
+// rates returns the server errors and quorum failures per request since
+// the previous call, and false when no request was served in between.
+func (m *alertMeter) rates(requests, serverErrors, quorumFailures int64) (float64, float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	served := float64(requests - m.requests)
+	errors := float64(serverErrors - m.serverErrors)
+	failures := float64(quorumFailures - m.quorumFailures)
+	m.requests, m.serverErrors, m.quorumFailures = requests, serverErrors, quorumFailures
+	if served <= 0 {
+		return 0, 0, false
+	}
+	return errors / served, failures / served, true
+}
+
+// alertReadings reads the metrics alert rules test. The hint backlog is
+// left out without a hint store, and the rates when no request was served
+// since the last check.
+func (s *HTTPServer) alertReadings() map[string]float64 {
+	c := s.nodeCapacity()
+	readings := map[string]float64{
+		"disk_percent":   c.DiskPercent,
+		"memory_percent": c.MemoryPercent,
+		"qps":            c.QPS,
+	}
+	if s.hints != nil {
+		readings["hint_backlog"] = float64(s.hintBacklog())
+	}
+	if errorRate, failureRate, ok := s.alertMeter.rates(s.stats.requests.Value(), s.stats.serverErrors.Value(), s.stats.quorumFailures.Value()); ok {
+		readings["server_error_rate"] = errorRate
+		readings["quorum_failure_rate"] = failureRate
+	}
+	return readings
+}
+
+// runAlerts checks the alert rules every cfg.AlertInterval until stop is
+// closed.
+func (s *HTTPServer) runAlerts(stop <-chan struct{}) {
+	if len(s.cfg.AlertRules) == 0 {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.AlertInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.checkAlerts(time.Now())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// checkAlerts evaluates the alert rules and raises an alert for each one
+// that started or stopped firing.
+func (s *HTTPServer) checkAlerts(now time.Time) {
+	for _, st := range s.alerts.Evaluate(s.alertReadings(), now) {
+		event := api.AlertEvent{
+			NodeID:    s.cfg.NodeID,
+			Rule:      st.Rule.String(),
+			Metric:    st.Rule.Metric,
+			Value:     st.Value,
+			Threshold: st.Rule.Threshold,
+			State:     alertState(st),
+			Time:      now.UTC(),
+		}
+		s.raiseAlert(event)
+	}
+}
+
+func alertState(st alerts.State) string {
+	if st.Firing {
+		return api.AlertFiring
+	}
+	return api.AlertResolved
+}
+
+// raiseAlert logs event and posts it to the alert webhook. A webhook that
+// fails is not retried, as the log still has the alert.
+func (s *HTTPServer) raiseAlert(event api.AlertEvent) {
+	// Rules compare with < and >, which read better unescaped
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(event); err != nil {
+		return
+	}
+	data := buf.Bytes()
+	s.logger.Printf("alert: %s", data)
+	if event.State == api.AlertFiring {
+		s.metrics.Count("alerts_fired", 1)
+	}
+	if s.cfg.AlertWebhook == "" {
+		return
+	}
+	if err := s.notifyAlert(data); err != nil {
+		s.logger.Printf("failed to notify alert webhook: %v\n", err)
+		s.metrics.Count("alert_webhook_failures", 1)
+	}
+}
+
+func (s *HTTPServer) notifyAlert(data []byte) error {
+	resp, err := s.webhookClient.Post(s.cfg.AlertWebhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// handleAlerts serves GET /admin/alerts, the state of every alert rule.
+func (s *HTTPServer) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	response := api.AlertsResponse{NodeID: s.cfg.NodeID, Alerts: []api.AlertStatus{}}
+	for _, st := range s.alerts.States() {
+		response.Alerts = append(response.Alerts, api.AlertStatus{
+			Rule:  st.Rule.String(),
+			State: alertState(st),
+			Value: st.Value,
+			Since: st.Since,
+		})
+	}
+	s.writeJSON(w, response)
+}
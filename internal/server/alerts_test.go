@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestAlerts(t *testing.T) {
+	events := make(chan api.AlertEvent, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event api.AlertEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer webhook.Close()
+	a, ts := startTestNodeWith(t, "a", func(cfg *config.Config) {
+		cfg.MaxKeys = 4
+		cfg.PublicMiddlewareCSV = "metrics"
+		cfg.AlertRulesCSV = "memory_percent>=50,quorum_failure_rate>0.5"
+		cfg.AlertWebhook = webhook.URL
+	})
+	logger := &recordingLogger{}
+	a.logger = logger
+	// Writes cannot reach the second replica
+	a.ring.JoinNode("c", "127.0.0.1:1", 1)
+
+	a.checkAlerts(time.Now())
+	if len(events) != 0 {
+		t.Fatalf("Expected no alerts on an idle node, got %d", len(events))
+	}
+
+	a.storage.Put("key-1", []byte("value"))
+	a.storage.Put("key-2", []byte("value"))
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/kv/key", strings.NewReader("value"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 without a write quorum, got %d", resp.StatusCode)
+	}
+	// The webhook is called before checkAlerts returns
+	a.checkAlerts(time.Now())
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 alerts, got %d", len(events))
+	}
+	fired := map[string]api.AlertEvent{}
+	for range 2 {
+		event := <-events
+		fired[event.Rule] = event
+	}
+	if event := fired["memory_percent>=50"]; event.State != api.AlertFiring || event.NodeID != "a" || event.Value < 50 || event.Threshold != 50 {
+		t.Errorf("Expected memory_percent>=50 to fire, got %+v", event)
+	}
+	if event := fired["quorum_failure_rate>0.5"]; event.State != api.AlertFiring || event.Value != 1 {
+		t.Errorf("Expected quorum_failure_rate>0.5 to fire at 1, got %+v", event)
+	}
+	logged := 0
+	for _, line := range logger.lines {
+		if strings.HasPrefix(line, `alert: {"node_id":"a","rule":"`) {
+			logged++
+		}
+	}
+	if logged != 2 {
+		t.Errorf("Expected the alerts to be logged, got %q", logger.lines)
+	}
+
+	// Requests that succeed bring the failure rate back down
+	a.stats.requests.Add(3)
+	a.checkAlerts(time.Now())
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 alert, got %d", len(events))
+	}
+	if event := <-events; event.Rule != "quorum_failure_rate>0.5" || event.State != api.AlertResolved {
+		t.Errorf("Expected quorum_failure_rate>0.5 to resolve, got %+v", event)
+	}
+
+	rec := httptest.NewRecorder()
+	a.handleAlerts(rec, httptest.NewRequest(http.MethodGet, "/admin/alerts", nil))
+	var alerts api.AlertsResponse
+	json.NewDecoder(rec.Body).Decode(&alerts)
+	if len(alerts.Alerts) != 2 || alerts.Alerts[0].State != api.AlertFiring || alerts.Alerts[1].State != api.AlertResolved {
+		t.Errorf("Expected one firing and one resolved rule, got %+v", alerts)
+	}
+}
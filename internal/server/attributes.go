@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// A PUT can describe its value with a Content-Type header and user
+// metadata in X-Meta-* headers, which are stored and replicated with the
+// value and returned with it: as fields of a JSON GET, and as headers of a
+// raw or range GET and of a HEAD. Over gRPC they are the content_type and
+// meta fields of PutRequest and GetResponse. Nodes never interpret them. A write
+// without them stores a value without them, so they never carry over from
+// the version a write replaces.
+
+// metaHeaderPrefix starts the headers that carry user metadata.
+const metaHeaderPrefix = "X-Meta-"
+
+// maxMetaEntries and maxMetaBytes bound the user metadata of a value, and
+// maxContentTypeBytes its content type, so that they stay small beside it.
+const (
+	maxMetaEntries      = 16
+	maxMetaBytes        = 2 << 10
+	maxContentTypeBytes = 256
+)
+
+// valueAttributes are the content type and user metadata a write stores
+// with its value.
+type valueAttributes struct {
+	contentType string
+	meta        map[string]string
+}
+
+type attributesKey struct{}
+
+// withAttributes has the writes made with ctx store attrs with their values.
+func withAttributes(ctx context.Context, attrs valueAttributes) context.Context {
+	return context.WithValue(ctx, attributesKey{}, attrs)
+}
+
+// attributesFrom returns the attributes a write made with ctx stores.
+func attributesFrom(ctx context.Context) valueAttributes {
+	attrs, _ := ctx.Value(attributesKey{}).(valueAttributes)
+	return attrs
+}
+
+// parseAttributes reads the attributes of a PUT from its headers. Metadata
+// names are case-insensitive and kept in lower case.
+func parseAttributes(h http.Header) (valueAttributes, error) {
+	var meta map[string]string
+	for name, values := range h {
+		if !strings.HasPrefix(name, metaHeaderPrefix) || len(name) == len(metaHeaderPrefix) {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[strings.TrimPrefix(name, metaHeaderPrefix)] = strings.Join(values, ",")
+	}
+	return newAttributes(h.Get("Content-Type"), meta)
+}
+
+// newAttributes checks a content type and metadata against the limits on
+// them, with metadata names in lower case as they are kept.
+func newAttributes(contentType string, meta map[string]string) (valueAttributes, error) {
+	var attrs valueAttributes
+	if contentType != "" {
+		if len(contentType) > maxContentTypeBytes {
+			return valueAttributes{}, fmt.Errorf("content type exceeds %d bytes", maxContentTypeBytes)
+		}
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return valueAttributes{}, fmt.Errorf("invalid content type %q: %v", contentType, err)
+		}
+		attrs.contentType = contentType
+	}
+	if len(meta) > maxMetaEntries {
+		return valueAttributes{}, fmt.Errorf("values carry at most %d metadata entries, got %d", maxMetaEntries, len(meta))
+	}
+	size := 0
+	for name, value := range meta {
+		if !validMetaName(name) || strings.ContainsAny(value, "\r\n") {
+			return valueAttributes{}, fmt.Errorf("invalid metadata entry %q", name)
+		}
+		if attrs.meta == nil {
+			attrs.meta = make(map[string]string, len(meta))
+		}
+		attrs.meta[strings.ToLower(name)] = value
+		size += len(name) + len(value)
+	}
+	if size > maxMetaBytes {
+		return valueAttributes{}, fmt.Errorf("metadata exceeds %d bytes", maxMetaBytes)
+	}
+	return attrs, nil
+}
+
+// validMetaName reports whether name can be sent back as the name of an
+// X-Meta-* header, which it is by raw and range GETs.
+func validMetaName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// setAttributeHeaders describes a value sent as is with the content type
+// and metadata it was written with, application/octet-stream when it was
+// written without a content type.
+func setAttributeHeaders(w http.ResponseWriter, response api.GetResponse) {
+	contentType := response.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	for name, value := range response.Meta {
+		w.Header().Set(metaHeaderPrefix+name, value)
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/pkg/api"
+	"github.com/amirderis/DHT/pkg/api/dhtpb"
+)
+
+func TestValueAttributes(t *testing.T) {
+	chunked := func(cfg *config.Config) { cfg.ChunkSize = 8 }
+	a, _ := startTestNodeWith(t, "a", chunked)
+	b, _ := startTestNodeWith(t, "b", chunked)
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	put := func(key, value string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/kv/"+key, strings.NewReader(value))
+		maps.Copy(req.Header, header)
+		rec := httptest.NewRecorder()
+		a.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	get := func(key string, raw bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/kv/"+key, nil)
+		if raw {
+			req.Header.Set("Accept", "application/octet-stream")
+		}
+		rec := httptest.NewRecorder()
+		a.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	attrs := http.Header{"Content-Type": {"image/png"}, "X-Meta-Owner": {"alice"}}
+
+	for _, key := range []string{"small", "large"} {
+		value := "png"
+		if key == "large" {
+			value = "a png larger than one chunk"
+		}
+		if rec := put(key, value, attrs); rec.Code != http.StatusOK {
+			t.Fatalf("Expected %s written, got %d: %s", key, rec.Code, rec.Body.String())
+		}
+		var response api.GetResponse
+		json.NewDecoder(get(key, false).Body).Decode(&response)
+		if response.ContentType != "image/png" || response.Meta["owner"] != "alice" {
+			t.Errorf("Expected %s read with its content type and metadata, got %q %v", key, response.ContentType, response.Meta)
+		}
+		rec := get(key, true)
+		if rec.Body.String() != value || rec.Header().Get("Content-Type") != "image/png" || rec.Header().Get("X-Meta-Owner") != "alice" {
+			t.Errorf("Expected %s sent raw with its headers, got %q %v", key, rec.Body.String(), rec.Header())
+		}
+	}
+	if stored, ok := b.versions.GetVersioned("small"); !ok || stored.ContentType != "image/png" || stored.Meta["owner"] != "alice" {
+		t.Errorf("Expected the replica to keep the attributes, got %+v", stored)
+	}
+
+	// A write without attributes stores none
+	put("small", "text", nil)
+	if rec := get("small", true); rec.Header().Get("Content-Type") != "application/octet-stream" || rec.Header().Get("X-Meta-Owner") != "" {
+		t.Errorf("Expected the attributes replaced, got %v", rec.Header())
+	}
+
+	tooMany := http.Header{}
+	for i := range maxMetaEntries + 1 {
+		tooMany.Set(fmt.Sprintf("X-Meta-K%d", i), "v")
+	}
+	for name, header := range map[string]http.Header{"too many": tooMany, "bad type": {"Content-Type": {"not a type;"}}} {
+		if rec := put("small", "x", header); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", name, rec.Code)
+		}
+	}
+
+	// The same attributes travel over gRPC
+	kv := &kvService{s: a}
+	if _, err := kv.Put(t.Context(), &dhtpb.PutRequest{Key: "grpc", Value: []byte("png"), ContentType: "image/png", Meta: map[string]string{"Owner": "bob"}}); err != nil {
+		t.Fatalf("Failed to put over gRPC: %v", err)
+	}
+	if rec := get("grpc", true); rec.Header().Get("Content-Type") != "image/png" || rec.Header().Get("X-Meta-Owner") != "bob" {
+		t.Errorf("Expected the gRPC write stored with its attributes, got %v", rec.Header())
+	}
+	put("small", "png", attrs)
+	if got, err := kv.Get(t.Context(), &dhtpb.GetRequest{Key: "small"}); err != nil || got.ContentType != "image/png" || got.Meta["owner"] != "alice" {
+		t.Errorf("Expected a gRPC read with the attributes, got %v and %v", got, err)
+	}
+	for name, meta := range map[string]map[string]string{"bad name": {"a b": "v"}, "bad value": {"k": "a\nb"}} {
+		if _, err := kv.Put(t.Context(), &dhtpb.PutRequest{Key: "grpc", Value: []byte("x"), Meta: meta}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected InvalidArgument for %s, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// The replica auditor checks that keys still have a copy on every replica
+// after nodes failed or were replaced. Every AuditInterval it samples
+// AuditSample keys of this node's storage, asks each replica of a key
+// whether it holds the key, and pushes this node's copy to the replicas
+// that answered without it. Replicas that do not answer are counted but
+// left to hinted handoff. The share of sampled keys short of a copy is
+// reported as the under_replicated_ratio gauge.
+
+// maxAuditedKeys bounds the keys a ReplicaAudit lists.
+const maxAuditedKeys = 20
+
+// replicaAuditor holds the outcome of the last audit.
+type replicaAuditor struct {
+	mu   sync.Mutex
+	last api.ReplicaAudit
+}
+
+// runAudit audits a sample of keys every AuditInterval until stop is closed.
+func (s *HTTPServer) runAudit(stop <-chan struct{}) {
+	if s.cfg.AuditInterval < 0 {
+		return
+	}
+	// Stopping abandons the audit in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	ticker := time.NewTicker(s.cfg.AuditInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		if s.isStandby() || s.checkBootstrapped() != nil || !s.allowJob("audit", time.Now()) {
+			continue
+		}
+		s.auditReplicas(ctx)
+	}
+}
+
+// auditReplicas audits a sample of the keys this node holds and repairs
+// those missing from a replica.
+func (s *HTTPServer) auditReplicas(ctx context.Context) api.ReplicaAudit {
+	self := ring.NodeID(s.cfg.NodeID)
+	report := api.ReplicaAudit{NodeID: s.cfg.NodeID, At: time.Now()}
+	entries, _ := s.versions.Sample(s.cfg.AuditSample)
+	for _, entry := range entries {
+		preferenceList, err := s.ring.GetPreferenceList(entry.Key, s.cfg.ReplicationFactor)
+		if err != nil || !slices.Contains(preferenceList, self) {
+			continue
+		}
+		report.Sampled++
+		audited := api.AuditedKey{Key: entry.Key}
+		var missing []ring.NodeID
+		for _, nodeID := range preferenceList {
+			audited.Replicas = append(audited.Replicas, string(nodeID))
+			meta := s.replicaMetadata(ctx, nodeID, entry.Key)
+			switch {
+			case meta.Error != "":
+				report.Unreachable++
+			case meta.Found && !meta.Corrupt:
+				audited.Live = append(audited.Live, string(nodeID))
+			case nodeID != self:
+				// A corrupt local copy is left to read repair, which
+				// fetches a healthy one
+				missing = append(missing, nodeID)
+			}
+		}
+		if len(audited.Live) == len(preferenceList) {
+			continue
+		}
+		report.UnderReplicated++
+		audited.Repaired = len(missing) > 0 && len(audited.Live)+len(missing) == len(preferenceList)
+		for _, nodeID := range missing {
+			address, _ := s.ring.GetNodeAddress(nodeID)
+			if err := s.pushKey(ctx, address, entry.Key); err != nil {
+				s.logger.Printf("audit failed to copy key: %s to replica %s: %v\n", entry.Key, nodeID, err)
+				audited.Repaired = false
+			}
+		}
+		if audited.Repaired {
+			report.Repaired++
+		}
+		if len(report.Keys) < maxAuditedKeys {
+			report.Keys = append(report.Keys, audited)
+		}
+	}
+
+	ratio := 0.0
+	if report.Sampled > 0 {
+		ratio = float64(report.UnderReplicated) / float64(report.Sampled)
+	}
+	s.metrics.Gauge("under_replicated_ratio", ratio)
+	s.metrics.Count("audit_repairs", int64(report.Repaired))
+	s.auditor.mu.Lock()
+	s.auditor.last = report
+	s.auditor.mu.Unlock()
+	if report.UnderReplicated > 0 {
+		s.logger.Printf("audit found %d of %d sampled keys under-replicated, repaired %d\n", report.UnderReplicated, report.Sampled, report.Repaired)
+	}
+	return report
+}
+
+// handleAudit serves /admin/audit: GET returns the last audit and POST
+// runs one now.
+func (s *HTTPServer) handleAudit(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.auditor.mu.Lock()
+		report := s.auditor.last
+		s.auditor.mu.Unlock()
+		if report.At.IsZero() {
+			s.writeError(w, http.StatusNotFound, "no audit has run yet")
+			return
+		}
+		s.writeJSON(w, report)
+	case http.MethodPost:
+		if err := s.checkBootstrapped(); err != nil {
+			s.writeOpError(w, err)
+			return
+		}
+		s.writeJSON(w, s.auditReplicas(r.Context()))
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+	}
+}
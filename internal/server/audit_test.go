@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestReplicaAudit(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	for _, key := range []string{"kept", "lost"} {
+		if _, err := a.put(t.Context(), key, []byte(key), nil, 2, time.Time{}); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+	// b loses its copy, as a replaced node would
+	if err := b.storeDelete("lost"); err != nil {
+		t.Fatalf("Failed to drop lost from b: %v", err)
+	}
+
+	audit := func(method string) (int, api.ReplicaAudit) {
+		rec := httptest.NewRecorder()
+		a.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, "/admin/audit", nil))
+		var report api.ReplicaAudit
+		json.NewDecoder(rec.Body).Decode(&report)
+		return rec.Code, report
+	}
+	if code, _ := audit(http.MethodGet); code != http.StatusNotFound {
+		t.Errorf("Expected 404 before the first audit, got %d", code)
+	}
+	_, report := audit(http.MethodPost)
+	if report.Sampled != 2 || report.UnderReplicated != 1 || report.Repaired != 1 {
+		t.Fatalf("Expected 1 of 2 keys under-replicated and repaired, got %+v", report)
+	}
+	if len(report.Keys) != 1 || report.Keys[0].Key != "lost" || !slices.Equal(report.Keys[0].Live, []string{"a"}) {
+		t.Errorf("Expected lost found only on a, got %+v", report.Keys)
+	}
+	if got, ok := b.versions.GetVersioned("lost"); !ok || string(got.Value) != "lost" {
+		t.Errorf("Expected the audit to copy lost back to b, got %+v", got)
+	}
+
+	_, report = audit(http.MethodPost)
+	if report.UnderReplicated != 0 {
+		t.Errorf("Expected no under-replicated keys after the repair, got %+v", report)
+	}
+	if code, last := audit(http.MethodGet); code != http.StatusOK || !last.At.Equal(report.At) {
+		t.Errorf("Expected the last audit, got %d %+v", code, last)
+	}
+}
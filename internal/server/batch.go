@@ -0,0 +1,547 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/internal/membership"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// POST /kv/_batch reads or writes many keys in one request. The
+// coordinator groups the keys by their preference list and sends each
+// replica a single /internal/batch/get or /internal/batch request for the
+// keys it holds, so that a batch costs one round trip per replica rather
+// than one per key. Each key then meets its quorum on its own, with the
+// same resolution, read repair and hints as a single GET or PUT, and gets
+// its own status in the response. Unlike a single request the coordinator
+// waits for every replica of the batch, within the request's deadline.
+// Writes of chunked values or to coalescing namespaces take the single-key
+// path.
+
+// maxBatchKeys bounds the keys or items of one batch.
+const maxBatchKeys = 1000
+
+// batchGroup is the keys of a batch that share a preference list, as
+// indexes into the batch.
+type batchGroup struct {
+	replicas []ring.NodeID
+	indexes  []int
+}
+
+// batchReply is one replica's answer for the keys of a group.
+type batchReply struct {
+	nodeID ring.NodeID
+	items  []api.ReplicateGetResponse
+	err    error
+}
+
+// handleBatch serves POST /kv/_batch.
+func (s *HTTPServer) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req api.BatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.cfg.MaxValueBytes)).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	switch n := len(req.Keys) + len(req.Items); {
+	case len(req.Keys) > 0 && len(req.Items) > 0:
+		s.writeError(w, http.StatusBadRequest, "a batch either reads keys or writes items")
+		return
+	case n == 0:
+		s.writeError(w, http.StatusBadRequest, "empty batch")
+		return
+	case n > maxBatchKeys:
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("batch of %d keys exceeds %d", n, maxBatchKeys))
+		return
+	}
+	ctx, cancel, err := s.requestContext(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer cancel()
+
+	var results []api.BatchResult
+	if len(req.Items) > 0 {
+		level, ackErr := parseAckLevel(r.Header.Get(ackHeader))
+		if ackErr != nil {
+			s.writeError(w, http.StatusBadRequest, ackErr.Error())
+			return
+		}
+		ctx = withAckLevel(ctx, level)
+		for i := range req.Items {
+			req.Items[i].Key = tenantKey(ctx, req.Items[i].Key)
+		}
+		results, err = s.batchPut(ctx, req.Items, s.getQuorumFromHeader(r, writeConsistencyHeader, s.cfg.WriteQuorum))
+	} else {
+		for i := range req.Keys {
+			req.Keys[i] = tenantKey(ctx, req.Keys[i])
+		}
+		results, err = s.batchGet(ctx, req.Keys, s.getQuorumFromHeader(r, readConsistencyHeader, s.cfg.ReadQuorum))
+	}
+	if err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	for i := range results {
+		results[i].Key = clientKey(ctx, results[i].Key)
+	}
+	s.metrics.Count("batch_keys", int64(len(results)))
+	s.writeJSON(w, api.BatchResponse{Results: results})
+}
+
+// batchGet reads keys from readQuorum replicas each.
+func (s *HTTPServer) batchGet(ctx context.Context, keys []string, readQuorum int) ([]api.BatchResult, error) {
+	if err := s.checkStandby(); err != nil {
+		return nil, err
+	}
+	results := make([]api.BatchResult, len(keys))
+	var valid []int
+	for i, key := range keys {
+		if err := s.checkBatchKey(key); err != nil {
+			results[i] = errorResult(key, err)
+			continue
+		}
+		valid = append(valid, i)
+	}
+	groups, err := s.groupKeys(keys, valid)
+	if err != nil {
+		return nil, err
+	}
+	replies := s.readGroups(ctx, keys, groups, readQuorum)
+	for g, group := range groups {
+		for pos, i := range group.indexes {
+			reads, corrupt, statuses := groupReads(group, replies[g], pos)
+			response, err := s.resolveReads(ctx, keys[i], reads, corrupt, statuses, readQuorum)
+			if err == nil {
+				response, err = s.assembleValue(ctx, keys[i], response, readQuorum)
+			}
+			if err != nil {
+				results[i] = errorResult(keys[i], err)
+				continue
+			}
+			status := http.StatusOK
+			if !response.Found {
+				status = http.StatusNotFound
+			}
+			results[i] = api.BatchResult{
+				Key:      keys[i],
+				Status:   status,
+				Value:    response.Value,
+				Found:    response.Found,
+				Versions: response.Versions,
+				Checksum: response.Checksum,
+				Siblings: response.Siblings,
+			}
+		}
+	}
+	return results, nil
+}
+
+// batchPut writes items to writeQuorum replicas each.
+func (s *HTTPServer) batchPut(ctx context.Context, items []api.BatchItem, writeQuorum int) ([]api.BatchResult, error) {
+	if err := s.checkStandby(); err != nil {
+		return nil, err
+	}
+	if err := s.checkBootstrapped(); err != nil {
+		return nil, err
+	}
+	results := make([]api.BatchResult, len(items))
+	keys := make([]string, len(items))
+	seen := make(map[string]bool, len(items))
+	var grouped []int
+	for i, item := range items {
+		keys[i] = item.Key
+		switch err := s.checkBatchKey(item.Key); {
+		case err != nil:
+			results[i] = errorResult(item.Key, err)
+		case seen[item.Key]:
+			results[i] = errorResult(item.Key, &opError{http.StatusBadRequest, "key appears twice in the batch: " + item.Key})
+		case s.namespaceValueType(item.Key) != "":
+			seen[item.Key] = true
+			response, err := s.putTyped(ctx, item.Key, s.namespaceValueType(item.Key), item.Value, s.cfg.ReadQuorum, writeQuorum, time.Time{})
+			if err != nil {
+				results[i] = errorResult(item.Key, err)
+				continue
+			}
+			results[i] = api.BatchResult{Key: item.Key, Status: http.StatusOK, Version: response.Version}
+		case len(item.Value) > s.cfg.ChunkSize || isManifest(item.Value) || s.coalesceWindow(item.Key) > 0:
+			seen[item.Key] = true
+			response, err := s.put(ctx, item.Key, item.Value, item.Context, writeQuorum, time.Time{})
+			if err != nil {
+				results[i] = errorResult(item.Key, err)
+				continue
+			}
+			results[i] = api.BatchResult{Key: item.Key, Status: http.StatusOK, Version: response.Version}
+		default:
+			seen[item.Key] = true
+			grouped = append(grouped, i)
+		}
+	}
+	groups, err := s.groupKeys(keys, grouped)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read what the replicas hold first, as a single write does, for the
+	// version a blind write supersedes and the chunks it replaces
+	held := s.readGroups(ctx, keys, groups, 0)
+	var wg sync.WaitGroup
+	for g, group := range groups {
+		values := make([]*storage.VersionedValue, len(group.indexes))
+		previous := make([][]byte, len(group.indexes))
+		for pos, i := range group.indexes {
+			reads, _, _ := groupReads(group, held[g], pos)
+			previous[pos] = newestRead(reads).Value
+			version, err := s.batchVersion(items[i], reads)
+			if err != nil {
+				results[i] = errorResult(items[i].Key, storeError(items[i].Key, err))
+				continue
+			}
+			values[pos] = storage.NewVersionedValue(items[i].Value, version)
+		}
+		count := s.quorumFor(ctx, writeQuorum, group.replicas, true)
+		s.reportDowngrade(ctx, count, true)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stale, statuses := s.writeGroup(ctx, keys, group, values)
+			for pos, i := range group.indexes {
+				switch {
+				case values[pos] == nil:
+				case count.met(count.acked(statuses[pos])):
+					results[i] = api.BatchResult{Key: keys[i], Status: http.StatusOK, Version: values[pos].Version}
+					s.dropChunks(keys[i], previous[pos], "")
+					s.mirrorPut(keys[i], items[i].Value, time.Time{})
+				case stale[pos]:
+					results[i] = errorResult(keys[i], storeError(keys[i], storage.ErrStaleVersion))
+				default:
+					results[i] = errorResult(keys[i], s.quorumError(ctx, keys[i], statuses[pos], &opError{http.StatusServiceUnavailable, "insufficient replicas available for write quorum for key: " + keys[i]}))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// checkBatchKey applies the checks a single request makes of its key.
+func (s *HTTPServer) checkBatchKey(key string) error {
+	if key == "" {
+		return &opError{http.StatusBadRequest, "key cannot be empty"}
+	}
+	return s.checkNamespace(key)
+}
+
+// batchVersion is nextVersion for a batch item, with the replicas' clocks
+// already read.
+func (s *HTTPServer) batchVersion(item api.BatchItem, reads []replicaRead) (clock.VectorClock, error) {
+	current, _ := s.versions.GetVersioned(item.Key)
+	base := clock.VectorClock(item.Context)
+	if base.IsEmpty() {
+		base = clock.New()
+		if current != nil {
+			base = base.Merge(current.Context())
+		}
+		for _, read := range reads {
+			for _, version := range readVersions(read.ReplicateGetResponse) {
+				base = base.Merge(version.Version)
+			}
+		}
+	} else if current != nil && clock.Compare(base, current.Version) < 0 {
+		return nil, storage.ErrStaleVersion
+	} else if s.cfg.MaxSiblings > 0 && s.cfg.SiblingOverflow == config.SiblingOverflowReject {
+		var held []clock.VectorClock
+		if current != nil {
+			for _, version := range current.Versions() {
+				held = append(held, version.Version)
+			}
+		}
+		for _, read := range reads {
+			for _, version := range readVersions(read.ReplicateGetResponse) {
+				held = append(held, version.Version)
+			}
+		}
+		if err := s.checkSiblings(base, held); err != nil {
+			return nil, err
+		}
+	}
+	return s.advance(base, current), nil
+}
+
+// groupKeys groups the keys at indexes by their preference list.
+func (s *HTTPServer) groupKeys(keys []string, indexes []int) ([]batchGroup, error) {
+	var groups []batchGroup
+	byReplicas := make(map[string]int)
+	for _, i := range indexes {
+		preferenceList, err := s.ring.GetPreferenceList(keys[i], s.cfg.ReplicationFactor)
+		if err != nil {
+			return nil, &opError{http.StatusInternalServerError, "failed to get preference list for key: " + keys[i]}
+		}
+		ids := make([]string, len(preferenceList))
+		for j, nodeID := range preferenceList {
+			ids[j] = string(nodeID)
+		}
+		id := strings.Join(ids, ",")
+		g, ok := byReplicas[id]
+		if !ok {
+			g = len(groups)
+			byReplicas[id] = g
+			groups = append(groups, batchGroup{replicas: preferenceList})
+		}
+		groups[g].indexes = append(groups[g].indexes, i)
+	}
+	return groups, nil
+}
+
+// readGroups asks the replicas of every group for its keys at once and
+// returns each group's replies once readQuorum replicas have answered, or
+// every replica when readQuorum is zero, or ctx ends.
+func (s *HTTPServer) readGroups(ctx context.Context, keys []string, groups []batchGroup, readQuorum int) [][]batchReply {
+	replies := make([][]batchReply, len(groups))
+	var wg sync.WaitGroup
+	for g, group := range groups {
+		groupKeys := make([]string, len(group.indexes))
+		for pos, i := range group.indexes {
+			groupKeys[pos] = keys[i]
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			replies[g] = s.readGroup(ctx, groupKeys, group.replicas, readQuorum)
+		}()
+	}
+	wg.Wait()
+	return replies
+}
+
+// readGroup is readFromNodes for the keys of one group.
+func (s *HTTPServer) readGroup(ctx context.Context, keys []string, replicas []ring.NodeID, readQuorum int) []batchReply {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan batchReply, len(replicas))
+	pending := 0
+	var replies []batchReply
+	for _, nodeID := range replicas {
+		if nodeID == ring.NodeID(s.cfg.NodeID) {
+			items := make([]api.ReplicateGetResponse, len(keys))
+			for i, key := range keys {
+				items[i], _ = s.localRead(key)
+			}
+			results <- batchReply{nodeID: nodeID, items: items}
+			pending++
+			continue
+		}
+		address, exists := s.ring.GetNodeAddress(nodeID)
+		if !exists {
+			replies = append(replies, batchReply{nodeID: nodeID, err: errors.New(replicaUnknownID)})
+			continue
+		}
+		pending++
+		go func() {
+			items, err := s.fetchBatch(ctx, address, keys)
+			results <- batchReply{nodeID, items, err}
+		}()
+	}
+	count := s.quorumFor(ctx, readQuorum, replicas, false)
+	answered := 0
+	for ; pending > 0 && (readQuorum == 0 || !count.met(answered)); pending-- {
+		var reply batchReply
+		select {
+		case reply = <-results:
+		case <-ctx.Done():
+			return replies
+		}
+		if reply.err == nil {
+			answered++
+		}
+		replies = append(replies, reply)
+	}
+	return replies
+}
+
+// groupReads picks out the reads of the key at pos in its group's replies,
+// sorted as readFromNodes sorts them.
+func groupReads(group batchGroup, replies []batchReply, pos int) ([]replicaRead, []ring.NodeID, replicaStatuses) {
+	var reads []replicaRead
+	var corrupt []ring.NodeID
+	statuses := make(replicaStatuses, len(group.replicas))
+	for _, nodeID := range group.replicas {
+		statuses[nodeID] = replicaNoAnswer
+	}
+	for _, reply := range replies {
+		switch {
+		case reply.err != nil:
+			statuses[reply.nodeID] = readStatus(reply.err)
+		case reply.items[pos].Corrupt:
+			statuses[reply.nodeID] = replicaCorrupt
+			corrupt = append(corrupt, reply.nodeID)
+		default:
+			statuses[reply.nodeID] = replicaOK
+			reads = append(reads, replicaRead{reply.nodeID, reply.items[pos]})
+		}
+	}
+	return reads, corrupt, statuses
+}
+
+// writeGroup writes the values of a group, nil for the items that failed
+// already, to every replica of the group, and returns whether a replica
+// found each item stale and how each replica answered it.
+// A replica that fails the batch as a whole is written key by key.
+func (s *HTTPServer) writeGroup(ctx context.Context, keys []string, group batchGroup, values []*storage.VersionedValue) ([]bool, []replicaStatuses) {
+	stale := make([]bool, len(values))
+	statuses := make([]replicaStatuses, len(values))
+	var items []storage.KeyedVersionedValue
+	var positions []int
+	for pos, value := range values {
+		statuses[pos] = make(replicaStatuses, len(group.replicas))
+		if value != nil {
+			items = append(items, storage.KeyedVersionedValue{Key: keys[group.indexes[pos]], Value: value})
+			positions = append(positions, pos)
+		}
+	}
+	if len(items) == 0 {
+		return stale, statuses
+	}
+
+	var mu sync.Mutex
+	record := func(nodeID ring.NodeID, pos int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		statuses[pos][nodeID] = writeStatus(err)
+		stale[pos] = stale[pos] || errors.Is(err, storage.ErrStaleVersion)
+	}
+	var wg sync.WaitGroup
+	for _, nodeID := range group.replicas {
+		if nodeID == ring.NodeID(s.cfg.NodeID) {
+			err := s.storeBatch(items)
+			for j, item := range items {
+				if err != nil {
+					// One stale item fails the batch; store the others alone
+					record(nodeID, positions[j], s.storeVersioned(item.Key, item.Value))
+					continue
+				}
+				record(nodeID, positions[j], nil)
+			}
+			if err == nil {
+				s.synced.note()
+			}
+			continue
+		}
+		address, exists := s.ring.GetNodeAddress(nodeID)
+		if !exists {
+			for _, pos := range positions {
+				statuses[pos][nodeID] = replicaUnknownID
+			}
+			continue
+		}
+		if s.cluster.State(string(nodeID)) == membership.Dead {
+			for j, item := range items {
+				statuses[positions[j]][nodeID] = replicaDead
+				s.storeHint(nodeID, item.Key, item.Value)
+			}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.sendBatch(ctx, address, items)
+			if errors.Is(err, errUnreachable) {
+				s.cluster.MarkDead(string(nodeID))
+			}
+			for j, item := range items {
+				switch {
+				case err == nil:
+					record(nodeID, positions[j], nil)
+				case errors.Is(err, errUnreachable), errors.Is(err, errReplicaBusy):
+					s.storeHint(nodeID, item.Key, item.Value)
+					record(nodeID, positions[j], err)
+				case ctx.Err() != nil:
+					record(nodeID, positions[j], err)
+				default:
+					record(nodeID, positions[j], s.writeToRemoteNode(ctx, address, item.Key, item.Value))
+				}
+			}
+			if err != nil {
+				s.logger.Printf("failed to write a batch of %d keys to remote node %s, error: %v\n", len(items), address, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return stale, statuses
+}
+
+// errorResult is the result of a key whose read or write failed.
+func errorResult(key string, err error) api.BatchResult {
+	var deadlineErr *deadlineError
+	var opErr *opError
+	switch {
+	case errors.As(err, &deadlineErr):
+		return api.BatchResult{Key: key, Status: http.StatusGatewayTimeout, Error: err.Error()}
+	case errors.As(err, &opErr):
+		return api.BatchResult{Key: key, Status: opErr.status, Error: opErr.message}
+	}
+	return api.BatchResult{Key: key, Status: http.StatusInternalServerError, Error: err.Error()}
+}
+
+// fetchBatch reads keys from the replica at address in one request.
+func (s *HTTPServer) fetchBatch(ctx context.Context, address string, keys []string) ([]api.ReplicateGetResponse, error) {
+	items, err := s.transport.GetBatch(ctx, address, keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) != len(keys) {
+		return nil, fmt.Errorf("remote node %s answered %d of %d keys", address, len(items), len(keys))
+	}
+	for _, item := range items {
+		if item.Found && crc32.ChecksumIEEE(item.Value) != item.Checksum {
+			return nil, fmt.Errorf("remote node %s: %w", address, errChecksumMismatch)
+		}
+	}
+	return items, nil
+}
+
+// sendBatch writes items to the replica at address in one request.
+func (s *HTTPServer) sendBatch(ctx context.Context, address string, items []storage.KeyedVersionedValue) error {
+	req := api.ReplicateBatchRequest{Items: make([]api.ReplicateRequest, len(items))}
+	for i, item := range items {
+		req.Items[i] = replicateRequest(item.Key, item.Value, "")
+	}
+	return s.transport.ReplicateBatch(ctx, address, req)
+}
+
+// handleInternalBatchGet serves POST /internal/batch/get, this replica's
+// copies of several keys.
+func (s *HTTPServer) handleInternalBatchGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	var req api.ReplicateBatchGetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	s.writeJSON(w, api.ReplicateBatchGetResponse{Items: s.localReads(req.Keys)})
+}
+
+// localReads reads keys from this replica.
+func (s *HTTPServer) localReads(keys []string) []api.ReplicateGetResponse {
+	items := make([]api.ReplicateGetResponse, len(keys))
+	for i, key := range keys {
+		items[i], _ = s.localRead(key)
+		items[i].Key = key
+	}
+	return items
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestBatch(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+
+	post := func(body string) (*http.Response, api.BatchResponse) {
+		t.Helper()
+		resp, err := http.Post("http://"+a.cfg.BindAddr+"/kv/_batch", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to post batch: %v", err)
+		}
+		defer resp.Body.Close()
+		var result api.BatchResponse
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp, result
+	}
+
+	resp, result := post(`{"items":[{"key":"k1","value":"djE="},{"key":"k2","value":"djI="},{"key":"k3","value":"djM="}]}`)
+	if resp.StatusCode != http.StatusOK || len(result.Results) != 3 {
+		t.Fatalf("Expected 3 results, got status %d and %+v", resp.StatusCode, result)
+	}
+	for _, r := range result.Results {
+		if r.Status != http.StatusOK || len(r.Version) == 0 {
+			t.Errorf("Expected %s to be written with a version, got %+v", r.Key, r)
+		}
+	}
+	for _, key := range []string{"k1", "k2", "k3"} {
+		if _, ok := b.storage.Get(key); !ok {
+			t.Errorf("Expected %s to reach b", key)
+		}
+	}
+
+	_, result = post(`{"keys":["k1","k3","missing"]}`)
+	if len(result.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %+v", result)
+	}
+	if r := result.Results[0]; r.Key != "k1" || !r.Found || string(r.Value) != "v1" {
+		t.Errorf("Expected k1 to read v1, got %+v", r)
+	}
+	if r := result.Results[1]; r.Key != "k3" || !r.Found || string(r.Value) != "v3" {
+		t.Errorf("Expected k3 to read v3, got %+v", r)
+	}
+	if r := result.Results[2]; r.Found || r.Status != http.StatusNotFound {
+		t.Errorf("Expected missing to be not found, got %+v", r)
+	}
+
+	// A write with a stale context fails alone
+	if _, err := a.put(t.Context(), "k1", []byte("v1 again"), nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	stale, _ := json.Marshal(api.BatchRequest{Items: []api.BatchItem{
+		{Key: "k1", Value: []byte("old"), Context: map[string]uint64{"a": 1}},
+		{Key: "k2", Value: []byte("new")},
+	}})
+	_, result = post(string(stale))
+	if r := result.Results[0]; r.Status != http.StatusConflict {
+		t.Errorf("Expected a stale write to conflict, got %+v", r)
+	}
+	if r := result.Results[1]; r.Status != http.StatusOK {
+		t.Errorf("Expected k2 to be written, got %+v", r)
+	}
+
+	for _, body := range []string{`{}`, `{"keys":["a"],"items":[{"key":"b"}]}`, `{"keys":[""]}`} {
+		if resp, result := post(body); resp.StatusCode == http.StatusOK && result.Results[0].Status != http.StatusBadRequest {
+			t.Errorf("Expected %s to be refused, got %d and %+v", body, resp.StatusCode, result)
+		}
+	}
+
+	c, _ := startTestNodeWith(t, "c", func(cfg *config.Config) { cfg.PeerTransport = config.PeerTransportGRPC })
+	t.Cleanup(func() { c.transport.Close() })
+	items, err := c.fetchBatch(t.Context(), b.cfg.BindAddr, []string{"k2", "missing"})
+	if err != nil || len(items) != 2 || string(items[0].Value) != "new" || items[1].Found {
+		t.Errorf("Expected a batch read over gRPC, got %+v, %v", items, err)
+	}
+}
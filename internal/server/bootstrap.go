@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/membership"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// A node started with seeds streams the token ranges it takes over before
+// it reports ready, so that reads routed to it do not come back empty. It
+// diffs the ring it joined against the same ring without itself, and
+// copies every key of each range it gained, metadata and all, from one of
+// the range's previous replicas, found through their range listings. A
+// range remembers the last key copied, so when a replica fails mid-range
+// the transfer resumes from there with the next one. A copied range is
+// verified against the listing it was copied from and streamed again if
+// it does not match. Failed ranges are retried a few times before the node
+// gives up on them and leaves them to anti-entropy.
+
+// bootstrapAttempts bounds the passes over the ranges still to stream.
+const bootstrapAttempts = 3
+
+// maxBootstrapErrors bounds the failures a BootstrapStatus lists.
+const maxBootstrapErrors = 10
+
+// bootstrapRetryDelay is the pause before streaming failed ranges again.
+var bootstrapRetryDelay = 5 * time.Second
+
+// bootstrapProgress tracks the ranges a joining node streams.
+type bootstrapProgress struct {
+	mu      sync.Mutex
+	status  api.BootstrapStatus
+	cursors map[ring.TokenRange]string // last key copied of each range
+}
+
+func newBootstrapProgress() *bootstrapProgress {
+	return &bootstrapProgress{
+		status:  api.BootstrapStatus{State: "joining"},
+		cursors: make(map[ring.TokenRange]string),
+	}
+}
+
+// join announces this node to its seeds, streams the ranges it took over
+// and then reports ready, unless stop is closed first. A standby instead
+// shadows its primary until it is promoted.
+func (s *HTTPServer) join(stop <-chan struct{}) {
+	if s.cfg.StandbyFor != "" {
+		s.runStandby(stop)
+		return
+	}
+	s.announce(stop)
+
+	// Stopping abandons the transfer
+	ctx, cancel := contextUntil(stop)
+	defer cancel()
+	s.streamGainedRanges(ctx)
+	s.readyFlag.Store(true)
+}
+
+// contextUntil returns a context that is canceled once stop is closed.
+func contextUntil(stop <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// gainedRanges returns the ranges this node replicates that other nodes
+// held before it joined.
+func (s *HTTPServer) gainedRanges() []ring.Move {
+	self := ring.NodeID(s.cfg.NodeID)
+	before := s.ring.Clone()
+	before.RemoveNode(self)
+	var gained []ring.Move
+	for _, move := range ring.Diff(before, s.ring, s.cfg.ReplicationFactor) {
+		if len(move.From) > 0 && slices.Contains(move.To, self) {
+			gained = append(gained, move)
+		}
+	}
+	return gained
+}
+
+// streamGainedRanges copies the keys of every gained range from its
+// previous replicas, retrying the ranges that fail.
+func (s *HTTPServer) streamGainedRanges(ctx context.Context) {
+	remaining := s.gainedRanges()
+	p := s.bootstrap
+	p.mu.Lock()
+	p.status.State = "streaming"
+	p.status.Ranges = len(remaining)
+	p.status.StartedAt = time.Now()
+	p.mu.Unlock()
+	s.logger.Printf("streaming %d token ranges from their previous owners\n", len(remaining))
+	s.publishBootstrap(api.RebalanceStarted, nil, nil)
+
+	var errs []string
+	for attempt := 1; len(remaining) > 0; attempt++ {
+		var failed []ring.Move
+		errs = errs[:0]
+		for _, move := range remaining {
+			if err := s.streamRange(ctx, move); err != nil {
+				failed = append(failed, move)
+				errs = append(errs, fmt.Sprintf("range %s: %v", rangeName(move.Range), err))
+				s.publishBootstrap(api.RebalanceRangeFailed, &move.Range, err)
+				continue
+			}
+			s.metrics.Count("bootstrap_ranges", 1)
+			p.mu.Lock()
+			p.status.Streamed++
+			p.mu.Unlock()
+			s.publishBootstrap(api.RebalanceRangeMoved, &move.Range, nil)
+		}
+		remaining = failed
+		if len(remaining) == 0 || attempt == bootstrapAttempts || ctx.Err() != nil {
+			break
+		}
+		s.logger.Printf("failed to stream %d token ranges, retrying in %v\n", len(remaining), bootstrapRetryDelay)
+		select {
+		case <-time.After(bootstrapRetryDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	p.mu.Lock()
+	p.status.FinishedAt = time.Now()
+	p.status.State = "done"
+	if len(remaining) > 0 {
+		p.status.State = "failed"
+		p.status.Errors = slices.Clone(errs[:min(len(errs), maxBootstrapErrors)])
+	}
+	s.logger.Printf("streamed %d of %d token ranges: %d keys, %d bytes\n", p.status.Streamed, p.status.Ranges, p.status.Keys, p.status.Bytes)
+	p.mu.Unlock()
+	s.publishBootstrap(api.RebalanceFinished, nil, nil)
+}
+
+// streamRange copies the keys of move's range from the first of its
+// previous replicas that can serve them all, resuming after the last key
+// copied by an earlier attempt.
+func (s *HTTPServer) streamRange(ctx context.Context, move ring.Move) error {
+	var errs []string
+	for _, nodeID := range move.From {
+		address, exists := s.ring.GetNodeAddress(nodeID)
+		if !exists || s.cluster.State(string(nodeID)) == membership.Dead {
+			errs = append(errs, fmt.Sprintf("%s: unavailable", nodeID))
+			continue
+		}
+		err := s.streamRangeFrom(ctx, move.Range, address)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", nodeID, err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return fmt.Errorf("no previous replica served the range: %s", strings.Join(errs, "; "))
+}
+
+// streamRangeFrom copies the keys of tr held by the node at address,
+// recording each one copied.
+func (s *HTTPServer) streamRangeFrom(ctx context.Context, tr ring.TokenRange, address string) error {
+	listing, _, err := s.fetchRangeListing(ctx, address, tr)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(listing.Entries))
+	for _, entry := range listing.Entries {
+		keys = append(keys, entry.Key)
+	}
+	slices.Sort(keys)
+
+	p := s.bootstrap
+	p.mu.Lock()
+	cursor := p.cursors[tr]
+	p.mu.Unlock()
+	for _, key := range keys {
+		if key <= cursor {
+			continue
+		}
+		n, err := s.copyKey(ctx, address, key)
+		if err != nil {
+			return err
+		}
+		s.metrics.Count("bootstrap_keys", 1)
+		s.metrics.Count("bootstrap_bytes", int64(n))
+		p.mu.Lock()
+		p.cursors[tr] = key
+		p.status.Keys++
+		p.status.Bytes += int64(n)
+		p.mu.Unlock()
+	}
+	if err := s.verifyRange(listing); err != nil {
+		// The next attempt copies the whole range again
+		p.mu.Lock()
+		delete(p.cursors, tr)
+		p.mu.Unlock()
+		s.metrics.Count("bootstrap_verify_failures", 1)
+		return err
+	}
+	return nil
+}
+
+// verifyRange checks that this node holds every entry of a range listing
+// it streamed, comparing the digest of the listing with that of the same
+// keys here. Writes that reached this node while it streamed leave newer
+// versions that the digests cannot tell from stale ones, so on a mismatch
+// it looks for the keys held in no version as new as the listing's.
+func (s *HTTPServer) verifyRange(source api.RangeListing) error {
+	now := time.Now()
+	want := make([]api.RangeEntry, 0, len(source.Entries))
+	held := make(map[string]api.RangeEntry, len(source.Entries))
+	for _, entry := range source.Entries {
+		if !entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt) {
+			// Expired since it was listed, so there was nothing to copy
+			continue
+		}
+		want = append(want, entry)
+		if value, ok := s.versions.GetVersioned(entry.Key); ok {
+			held[entry.Key] = rangeEntry(entry.Key, value)
+		}
+	}
+	theirs, mine := rangeDigest(want), rangeDigest(slices.Collect(maps.Values(held)))
+	if theirs == mine {
+		return nil
+	}
+	behind := 0
+	for _, entry := range want {
+		copied, ok := held[entry.Key]
+		switch {
+		case !ok:
+			behind++
+		case clock.Equal(copied.Version, entry.Version):
+			if rangeDigest([]api.RangeEntry{copied}) != rangeDigest([]api.RangeEntry{entry}) {
+				behind++
+			}
+		case clock.Compare(copied.Version, entry.Version) <= 0:
+			behind++
+		}
+	}
+	if behind > 0 {
+		return fmt.Errorf("range digest %.16s does not match the source's %.16s: %d of %d keys missing or different", mine, theirs, behind, len(want))
+	}
+	return nil
+}
+
+// bootstrapStatus returns a copy of the bootstrap progress.
+func (s *HTTPServer) bootstrapStatus() api.BootstrapStatus {
+	p := s.bootstrap
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := p.status
+	status.NodeID = s.cfg.NodeID
+	status.Errors = slices.Clone(p.status.Errors)
+	return status
+}
+
+// handleBootstrapStatus serves GET /admin/bootstrap/status.
+func (s *HTTPServer) handleBootstrapStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	s.writeJSON(w, s.bootstrapStatus())
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestBootstrapStreaming(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	keys := make([]string, 40)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+		if _, err := a.put(t.Context(), keys[i], []byte("value-"+keys[i]), nil, 2, time.Time{}); err != nil {
+			t.Fatalf("Failed to put %s: %v", keys[i], err)
+		}
+	}
+	// A value with a TTL and a tombstone stream with their metadata
+	expiresAt := time.Now().Add(time.Hour)
+	if _, err := a.put(t.Context(), "expiring", []byte("value"), nil, 2, expiresAt); err != nil {
+		t.Fatalf("Failed to put expiring: %v", err)
+	}
+	a.put(t.Context(), "deleted", []byte("value"), nil, 2, time.Time{})
+	if err := a.deleteValue(t.Context(), "deleted", []byte("value"), 2); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	c := startTestNode(t, "c")
+	c.cfg.Seeds = []string{a.cfg.BindAddr, b.cfg.BindAddr}
+	c.readyFlag.Store(false)
+	rec := httptest.NewRecorder()
+	c.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a joining node not to be ready, got %d", rec.Code)
+	}
+
+	// With a turning range listings away, c streams every range from b
+	for a.transferLimit.tryAcquire() {
+	}
+	c.join(make(chan struct{}))
+
+	status := c.bootstrapStatus()
+	if status.State != "done" || status.Ranges == 0 || status.Streamed != status.Ranges {
+		t.Fatalf("Expected every gained range to be streamed, got %+v", status)
+	}
+	owned := 0
+	for _, key := range keys {
+		prefList, _ := c.ring.GetPreferenceList(key, 2)
+		if !slices.Contains(prefList, "c") {
+			continue
+		}
+		owned++
+		if value, _ := c.storage.Get(key); string(value) != "value-"+key {
+			t.Errorf("Expected c to hold %s after joining, got %q", key, value)
+		}
+	}
+	for _, key := range []string{"expiring", "deleted"} {
+		prefList, _ := c.ring.GetPreferenceList(key, 2)
+		if !slices.Contains(prefList, "c") {
+			continue
+		}
+		owned++
+		source, _ := b.versions.GetVersioned(key)
+		copied, ok := c.versions.GetVersioned(key)
+		if !ok || rangeDigest([]api.RangeEntry{rangeEntry(key, copied)}) != rangeDigest([]api.RangeEntry{rangeEntry(key, source)}) {
+			t.Errorf("Expected c to hold %s as b does, got %+v and %+v", key, copied, source)
+		}
+	}
+	if owned == 0 || status.Keys != owned {
+		t.Errorf("Expected %d keys streamed, got %d", owned, status.Keys)
+	}
+	rec = httptest.NewRecorder()
+	c.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected c to be ready once streamed, got %d", rec.Code)
+	}
+}
+
+func TestVerifyRange(t *testing.T) {
+	s := newTestServer(t)
+	stored := storage.NewVersionedValue([]byte("value"), clock.VectorClock{"a": 2})
+	s.versions.PutVersioned("key", stored)
+	held, _ := s.versions.GetVersioned("key")
+	entry := rangeEntry("key", held)
+
+	if err := s.verifyRange(api.RangeListing{Entries: []api.RangeEntry{entry}}); err != nil {
+		t.Errorf("Expected a range held as listed to verify, got %v", err)
+	}
+	older := entry
+	older.Version = map[string]uint64{"a": 1}
+	if err := s.verifyRange(api.RangeListing{Entries: []api.RangeEntry{older}}); err != nil {
+		t.Errorf("Expected a newer version here to verify, got %v", err)
+	}
+	expired := api.RangeEntry{Key: "gone", Version: map[string]uint64{"a": 1}, ExpiresAt: time.Now().Add(-time.Second)}
+	if err := s.verifyRange(api.RangeListing{Entries: []api.RangeEntry{entry, expired}}); err != nil {
+		t.Errorf("Expected a key expired since it was listed to be skipped, got %v", err)
+	}
+
+	missing := api.RangeEntry{Key: "missing", Version: map[string]uint64{"a": 1}}
+	if err := s.verifyRange(api.RangeListing{Entries: []api.RangeEntry{entry, missing}}); err == nil || !strings.Contains(err.Error(), "1 of 2 keys") {
+		t.Errorf("Expected a missing key to fail verification, got %v", err)
+	}
+	different := entry
+	different.ExpiresAt = time.Now().Add(time.Hour)
+	if err := s.verifyRange(api.RangeListing{Entries: []api.RangeEntry{different}}); err == nil {
+		t.Error("Expected the same version with another expiry to fail verification")
+	}
+}
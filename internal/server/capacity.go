@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// Capacity signals tell an autoscaler when to add or remove nodes. Each
+// node scores how close it is to its memory, disk and QPS limits;
+// /admin/capacity averages the scores of the ring and classifies the
+// cluster against the configured thresholds, and the capacity webhook is
+// told whenever that classification changes.
+
+// capacityCheckInterval is how often the cluster capacity is checked
+// against the thresholds of the webhook.
+const capacityCheckInterval = 30 * time.Second
+
+// capacityMeter keeps what capacity readings need between calls.
+type capacityMeter struct {
+	mu       sync.Mutex
+	requests int64
+	at       time.Time
+	qps      float64
+	// state is the cluster state last reported to the webhook.
+	state string
+}
+
+// minQPSWindow is the shortest interval a QPS reading is measured over;
+// readings closer together repeat the previous rate.
+const minQPSWindow = time.Second
+
+// rate returns the request rate since the previous reading.
+func (m *capacityMeter) rate(requests int64, now time.Time) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elapsed := now.Sub(m.at); elapsed >= minQPSWindow {
+		if !m.at.IsZero() {
+			m.qps = float64(requests-m.requests) / elapsed.Seconds()
+		}
+		m.requests, m.at = requests, now
+	}
+	return m.qps
+}
+
+// transition records state and returns the state it replaces.
+func (m *capacityMeter) transition(state string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	previous := m.state
+	m.state = state
+	return previous
+}
+
+// nodeCapacity measures this node.
+func (s *HTTPServer) nodeCapacity() api.NodeCapacity {
+	c := api.NodeCapacity{NodeID: s.cfg.NodeID}
+	st := s.storage.Stats()
+	if s.cfg.MaxBytes > 0 {
+		c.MemoryPercent = percent(float64(st.Bytes), float64(s.cfg.MaxBytes))
+	}
+	if s.cfg.MaxKeys > 0 {
+		c.MemoryPercent = max(c.MemoryPercent, percent(float64(st.Keys), float64(s.cfg.MaxKeys)))
+	}
+	if dir := s.dataDir(); dir != "" {
+		if used, err := diskUsage(dir); err == nil {
+			c.DiskPercent = used
+		}
+	}
+	c.QPS = s.capacity.rate(s.stats.requests.Value(), time.Now())
+	if s.cfg.MaxQPS > 0 {
+		c.QPSPercent = percent(c.QPS, s.cfg.MaxQPS)
+	}
+	c.Score = max(c.MemoryPercent, c.DiskPercent, c.QPSPercent)
+	return c
+}
+
+// dataDir is the directory whose file system this node fills.
+func (s *HTTPServer) dataDir() string {
+	if s.cfg.DataDir != "" {
+		return s.cfg.DataDir
+	}
+	return s.cfg.HintDir
+}
+
+func percent(used, limit float64) float64 {
+	return min(100, 100*used/limit)
+}
+
+// clusterCapacity measures every ring member. Nodes that cannot be reached
+// are listed with Error set and left out of the scores.
+func (s *HTTPServer) clusterCapacity() api.ClusterCapacity {
+	nodes := s.ring.GetNodes()
+	ids := make([]ring.NodeID, 0, len(nodes))
+	for nodeID := range nodes {
+		ids = append(ids, nodeID)
+	}
+	slices.Sort(ids)
+
+	results := make([]api.NodeCapacity, len(ids))
+	var wg sync.WaitGroup
+	for i, nodeID := range ids {
+		if nodeID == ring.NodeID(s.cfg.NodeID) {
+			results[i] = s.nodeCapacity()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := s.readRemoteCapacity(nodes[nodeID])
+			if err != nil {
+				c = api.NodeCapacity{NodeID: string(nodeID), Error: err.Error()}
+			}
+			results[i] = c
+		}()
+	}
+	wg.Wait()
+
+	cluster := api.ClusterCapacity{Time: time.Now().UTC(), Nodes: results}
+	answered := 0
+	for _, c := range results {
+		if c.Error != "" {
+			continue
+		}
+		answered++
+		cluster.Score += c.Score
+		cluster.MaxScore = max(cluster.MaxScore, c.Score)
+	}
+	if answered > 0 {
+		cluster.Score /= float64(answered)
+	}
+	switch {
+	case cluster.Score >= s.cfg.CapacityHighWater:
+		cluster.State = api.CapacityHigh
+	case cluster.Score < s.cfg.CapacityLowWater:
+		cluster.State = api.CapacityLow
+	default:
+		cluster.State = api.CapacityNormal
+	}
+	return cluster
+}
+
+func (s *HTTPServer) readRemoteCapacity(address string) (api.NodeCapacity, error) {
+	return s.transport.Capacity(context.Background(), address)
+}
+
+// runCapacityWatch checks the cluster capacity periodically until stop
+// is closed. Only the ring member with the lowest ID calls the webhook,
+// so that a change is reported once rather than by every node.
+func (s *HTTPServer) runCapacityWatch(stop <-chan struct{}) {
+	if s.cfg.CapacityWebhook == "" {
+		return
+	}
+	ticker := time.NewTicker(capacityCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if s.leadsCapacityWatch() {
+				s.checkCapacity()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *HTTPServer) leadsCapacityWatch() bool {
+	for nodeID := range s.ring.GetNodes() {
+		if nodeID < ring.NodeID(s.cfg.NodeID) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkCapacity posts a CapacityEvent to the webhook when the cluster
+// state differs from the one last seen. The first check only records the
+// state unless the cluster already needs scaling.
+func (s *HTTPServer) checkCapacity() {
+	cluster := s.clusterCapacity()
+	s.metrics.Gauge("capacity_score", cluster.Score)
+	previous := s.capacity.transition(cluster.State)
+	if previous == cluster.State || (previous == "" && cluster.State == api.CapacityNormal) {
+		return
+	}
+	if previous == "" {
+		previous = api.CapacityNormal
+	}
+	if err := s.notifyCapacity(api.CapacityEvent{Previous: previous, State: cluster.State, Capacity: cluster}); err != nil {
+		s.logger.Printf("failed to notify capacity webhook: %v\n", err)
+		// Report the change again on the next check
+		s.capacity.transition(previous)
+		s.metrics.Count("capacity_webhook_failures", 1)
+	}
+}
+
+func (s *HTTPServer) notifyCapacity(event api.CapacityEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	resp, err := s.webhookClient.Post(s.cfg.CapacityWebhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// handleInternalCapacity serves GET /internal/capacity.
+func (s *HTTPServer) handleInternalCapacity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	s.writeJSON(w, s.nodeCapacity())
+}
+
+// handleCapacity serves GET /admin/capacity.
+func (s *HTTPServer) handleCapacity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	s.writeJSON(w, s.clusterCapacity())
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestCapacity(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	a.ring.JoinNode("c", "127.0.0.1:1", 1)
+	b.cfg.MaxKeys = 10
+	for i := range 9 {
+		b.storage.Put("key-"+strconv.Itoa(i), []byte("value"))
+	}
+
+	cluster := a.clusterCapacity()
+	if len(cluster.Nodes) != 3 {
+		t.Fatalf("Expected 3 nodes, got %+v", cluster.Nodes)
+	}
+	if got := cluster.Nodes[1]; got.NodeID != "b" || got.MemoryPercent != 90 || got.Score != 90 {
+		t.Errorf("Expected b at 90%% of its memory, got %+v", got)
+	}
+	if cluster.Nodes[2].Error == "" {
+		t.Errorf("Expected an error for the unreachable node c")
+	}
+	if cluster.Score != 45 || cluster.MaxScore != 90 || cluster.State != api.CapacityNormal {
+		t.Errorf("Expected score 45, max 90 and state normal, got %+v", cluster)
+	}
+
+	events := make(chan api.CapacityEvent, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event api.CapacityEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer webhook.Close()
+	a.cfg.CapacityWebhook = webhook.URL
+	a.checkCapacity()
+	select {
+	case event := <-events:
+		t.Errorf("Expected no webhook call for a normal cluster, got %+v", event)
+	default:
+	}
+
+	a.cfg.CapacityHighWater = 40
+	a.checkCapacity()
+	select {
+	case event := <-events:
+		if event.Previous != api.CapacityNormal || event.State != api.CapacityHigh {
+			t.Errorf("Expected a transition from normal to high, got %+v", event)
+		}
+	default:
+		t.Errorf("Expected a webhook call when crossing the high water mark")
+	}
+	a.checkCapacity()
+	if len(events) != 0 {
+		t.Errorf("Expected no webhook call while the state is unchanged")
+	}
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// manifestMagic prefixes a stored value that describes a chunked value
+// rather than holding it. The leading NUL keeps it out of text payloads.
+const manifestMagic = "\x00dht-chunked\x00"
+
+// chunkManifest is stored under the user's key in place of a value larger
+// than cfg.ChunkSize. The chunks live under keys derived from the key and
+// the value's digest, so a half-written overwrite never mixes chunks of two
+// values and readers keep seeing the old manifest until the new one lands.
+type chunkManifest struct {
+	Digest    string `json:"digest"` // hex SHA-256 of the whole value
+	Size      int    `json:"size"`
+	ChunkSize int    `json:"chunk_size"`
+	Chunks    int    `json:"chunks"`
+	// Stream names the chunks of a value that was streamed in, and so
+	// chunked before its digest was known; their keys use it in place of
+	// the digest.
+	Stream string `json:"stream,omitempty"`
+	// ChunkDigests identifies the content of every chunk written with
+	// this manifest; manifests written before it was added omit it.
+	ChunkDigests []string `json:"chunk_digests,omitempty"`
+	// Previous describes the chunked value this one replaced. Its chunks
+	// are kept until the next overwrite so that reads can fall back to it
+	// while this value is only partially replicated.
+	Previous *chunkManifest `json:"previous,omitempty"`
+}
+
+// isManifest reports whether a stored value is a chunk manifest.
+func isManifest(value []byte) bool {
+	return bytes.HasPrefix(value, []byte(manifestMagic))
+}
+
+func decodeManifest(value []byte) (chunkManifest, error) {
+	var m chunkManifest
+	if err := json.Unmarshal(value[len(manifestMagic):], &m); err != nil {
+		return chunkManifest{}, err
+	}
+	if len(m.Digest) != sha256.Size*2 || m.Chunks < 0 || (m.Chunks > 0 && m.ChunkSize <= 0) || (len(m.ChunkDigests) > 0 && len(m.ChunkDigests) != m.Chunks) {
+		return chunkManifest{}, fmt.Errorf("unexpected chunk manifest (digest=%q chunks=%d)", m.Digest, m.Chunks)
+	}
+	if m.Previous != nil && (len(m.Previous.Digest) != sha256.Size*2 || m.Previous.Chunks < 0) {
+		return chunkManifest{}, fmt.Errorf("unexpected previous chunk manifest (digest=%q chunks=%d)", m.Previous.Digest, m.Previous.Chunks)
+	}
+	return m, nil
+}
+
+func (m chunkManifest) encode() []byte {
+	data, _ := json.Marshal(m)
+	return append([]byte(manifestMagic), data...)
+}
+
+// chunkID tells apart the chunks of different values under one key.
+func (m chunkManifest) chunkID() string {
+	if m.Stream != "" {
+		return m.Stream
+	}
+	return m.Digest[:16]
+}
+
+// chunkKey derives the key of chunk i. The key avoids "/" so chunks are
+// accounted under the same namespace as the key they belong to.
+func (m chunkManifest) chunkKey(key string, i int) string {
+	return fmt.Sprintf("%s~chunk.%s.%d", key, m.chunkID(), i)
+}
+
+// putChunked splits value into chunks of cfg.ChunkSize, writes each chunk
+// with the same quorum and expiry as a regular value, and then writes the
+// manifest under key. The manifest remembers the chunked value it replaces;
+// chunks of the one before that are removed once the manifest is in place.
+// Only the manifest carries the causal context.
+func (s *HTTPServer) putChunked(ctx context.Context, key string, value []byte, causal clock.VectorClock, writeQuorum int, expiresAt time.Time) (api.PutResponse, error) {
+	sum := sha256.Sum256(value)
+	m := chunkManifest{
+		Digest:    hex.EncodeToString(sum[:]),
+		Size:      len(value),
+		ChunkSize: s.cfg.ChunkSize,
+		Chunks:    (len(value) + s.cfg.ChunkSize - 1) / s.cfg.ChunkSize,
+	}
+	m.ChunkDigests = make([]string, m.Chunks)
+	// The attributes of the value go with its manifest only
+	chunkCtx := withAttributes(ctx, valueAttributes{})
+	for i := 0; i < m.Chunks; i++ {
+		end := min((i+1)*m.ChunkSize, len(value))
+		chunk := value[i*m.ChunkSize : end]
+		if _, err := s.putValue(chunkCtx, m.chunkKey(key, i), chunk, nil, writeQuorum, expiresAt); err != nil {
+			return api.PutResponse{}, err
+		}
+		m.ChunkDigests[i] = chunkDigest(chunk)
+	}
+	return s.putManifest(ctx, key, m, causal, writeQuorum, expiresAt)
+}
+
+// putManifest writes m under key once its chunks are in place, remembering
+// the chunked value it replaces and removing the chunks of the one before.
+func (s *HTTPServer) putManifest(ctx context.Context, key string, m chunkManifest, causal clock.VectorClock, writeQuorum int, expiresAt time.Time) (api.PutResponse, error) {
+	previous := s.storedValue(ctx, key)
+	var replaced *chunkManifest
+	if isManifest(previous) {
+		if pm, err := decodeManifest(previous); err == nil && pm.chunkID() == m.chunkID() {
+			m.Previous = pm.Previous
+		} else if err == nil {
+			replaced = pm.Previous
+			pm.Previous = nil
+			m.Previous = &pm
+		}
+	}
+	response, err := s.putValue(ctx, key, m.encode(), causal, writeQuorum, expiresAt)
+	if err != nil {
+		return api.PutResponse{}, err
+	}
+	if replaced != nil && replaced.chunkID() != m.chunkID() && replaced.chunkID() != m.Previous.chunkID() {
+		s.dropManifestChunks(key, *replaced)
+	}
+	return response, nil
+}
+
+// getChunked reassembles the value described by a manifest, reading every
+// chunk with readQuorum and checking the result against the manifest. When
+// the chunks of a partially replicated write are incomplete, the value it
+// replaced is returned instead if that one is still whole.
+func (s *HTTPServer) getChunked(ctx context.Context, key string, manifest []byte, readQuorum int) ([]byte, error) {
+	m, err := decodeManifest(manifest)
+	if err != nil {
+		return nil, &opError{http.StatusInternalServerError, "corrupt chunk manifest for key: " + key}
+	}
+	value, err := s.assembleChunks(ctx, key, m, readQuorum)
+	var torn *tornValueError
+	if !errors.As(err, &torn) {
+		return value, err
+	}
+	s.metrics.Count("torn_reads", 1)
+	if m.Previous != nil {
+		if previous, prevErr := s.assembleChunks(ctx, key, *m.Previous, readQuorum); prevErr == nil {
+			s.logger.Printf("%v, returning the previous value\n", torn)
+			return previous, nil
+		}
+	}
+	return nil, &opError{http.StatusServiceUnavailable, torn.Error()}
+}
+
+// tornValueError reports a chunked value whose chunks do not all belong to
+// the write that stored its manifest, e.g. because that write only reached
+// some replicas.
+type tornValueError struct {
+	key    string
+	reason string
+}
+
+func (e *tornValueError) Error() string {
+	return fmt.Sprintf("chunked value for key: %s is incomplete: %s", e.key, e.reason)
+}
+
+// assembleChunks reads and concatenates the chunks of m.
+func (s *HTTPServer) assembleChunks(ctx context.Context, key string, m chunkManifest, readQuorum int) ([]byte, error) {
+	value, err := s.chunkRange(ctx, key, m, 0, m.Size, readQuorum)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(value); len(value) != m.Size || hex.EncodeToString(sum[:]) != m.Digest {
+		return nil, &tornValueError{key, "reassembled value does not match its manifest"}
+	}
+	return value, nil
+}
+
+// chunkRange returns bytes [start, end) of the value m describes, reading
+// only the chunks that overlap them. Every chunk read is checked against
+// the manifest, but only assembleChunks can check the value as a whole.
+func (s *HTTPServer) chunkRange(ctx context.Context, key string, m chunkManifest, start, end, readQuorum int) ([]byte, error) {
+	if end <= start {
+		return []byte{}, nil
+	}
+	first, last := start/m.ChunkSize, (end-1)/m.ChunkSize
+	if last >= m.Chunks {
+		return nil, &tornValueError{key, fmt.Sprintf("%d chunks cannot hold %d bytes", m.Chunks, m.Size)}
+	}
+	value := make([]byte, 0, (last-first+1)*m.ChunkSize)
+	for i := first; i <= last; i++ {
+		chunk, err := s.getValue(ctx, m.chunkKey(key, i), readQuorum)
+		if err != nil {
+			return nil, err
+		}
+		if !chunk.Found {
+			return nil, &tornValueError{key, fmt.Sprintf("chunk %d of %d missing", i, m.Chunks)}
+		}
+		if len(m.ChunkDigests) > 0 && chunkDigest(chunk.Value) != m.ChunkDigests[i] {
+			return nil, &tornValueError{key, fmt.Sprintf("chunk %d of %d is from another write", i, m.Chunks)}
+		}
+		if len(chunk.Value) != min((i+1)*m.ChunkSize, m.Size)-i*m.ChunkSize {
+			return nil, &tornValueError{key, fmt.Sprintf("chunk %d of %d has %d bytes", i, m.Chunks, len(chunk.Value))}
+		}
+		value = append(value, chunk.Value...)
+	}
+	offset := first * m.ChunkSize
+	return value[start-offset : end-offset], nil
+}
+
+// chunkDigest identifies the content of one chunk in a manifest.
+func chunkDigest(chunk []byte) string {
+	sum := sha256.Sum256(chunk)
+	return hex.EncodeToString(sum[:8])
+}
+
+// dropChunks deletes the local chunks of a replaced or deleted value and
+// of the value it had replaced, unless they are shared with the value now
+// stored under key, whose chunks keepID names.
+func (s *HTTPServer) dropChunks(key string, previous []byte, keepID string) {
+	if !isManifest(previous) {
+		return
+	}
+	m, err := decodeManifest(previous)
+	if err != nil {
+		return
+	}
+	if m.chunkID() != keepID {
+		s.dropManifestChunks(key, m)
+	}
+	if m.Previous != nil && m.Previous.chunkID() != keepID {
+		s.dropManifestChunks(key, *m.Previous)
+	}
+}
+
+func (s *HTTPServer) dropManifestChunks(key string, m chunkManifest) {
+	for i := 0; i < m.Chunks; i++ {
+		if err := s.storeDelete(m.chunkKey(key, i)); err != nil {
+			s.logger.Printf("failed to delete chunk %d of key: %s, error: %v\n", i, key, err)
+		}
+	}
+}
+
+// chunkCleanup is the removal of the chunks of a deleted value, due once
+// the tombstone grace period has passed.
+type chunkCleanup struct {
+	key      string
+	manifest chunkManifest
+	due      time.Time
+}
+
+type chunkCleanups struct {
+	mu      sync.Mutex
+	pending []chunkCleanup // in due order
+}
+
+func (s *HTTPServer) scheduleChunkCleanup(key string, manifest []byte) {
+	m, err := decodeManifest(manifest)
+	if err != nil {
+		return
+	}
+	s.cleanups.mu.Lock()
+	defer s.cleanups.mu.Unlock()
+	s.cleanups.pending = append(s.cleanups.pending, chunkCleanup{key: key, manifest: m, due: time.Now().Add(s.cfg.TombstoneGrace)})
+}
+
+// cleanupChunks removes the chunks of deleted values whose grace period
+// has passed from every replica of each chunk. Chunks shared with a value
+// written to the key since are kept.
+func (s *HTTPServer) cleanupChunks(now time.Time) {
+	s.cleanups.mu.Lock()
+	n := 0
+	for n < len(s.cleanups.pending) && !now.Before(s.cleanups.pending[n].due) {
+		n++
+	}
+	due := slices.Clone(s.cleanups.pending[:n])
+	s.cleanups.pending = s.cleanups.pending[n:]
+	s.cleanups.mu.Unlock()
+
+	for _, c := range due {
+		keep := map[string]bool{}
+		if current, ok := s.versions.GetVersioned(c.key); ok && !current.Tombstone && isManifest(current.Value) {
+			if m, err := decodeManifest(current.Value); err == nil {
+				keep[m.chunkID()] = true
+				if m.Previous != nil {
+					keep[m.Previous.chunkID()] = true
+				}
+			}
+		}
+		for _, m := range []*chunkManifest{&c.manifest, c.manifest.Previous} {
+			if m != nil && !keep[m.chunkID()] {
+				s.deleteReplicatedChunks(c.key, *m)
+			}
+		}
+	}
+}
+
+// deleteReplicatedChunks removes the chunks of m from all their replicas.
+// Unreachable replicas keep their copy.
+func (s *HTTPServer) deleteReplicatedChunks(key string, m chunkManifest) {
+	removed := 0
+	for i := 0; i < m.Chunks; i++ {
+		chunkKey := m.chunkKey(key, i)
+		preferenceList, err := s.ring.GetPreferenceList(chunkKey, s.cfg.ReplicationFactor)
+		if err != nil {
+			continue
+		}
+		for _, nodeID := range preferenceList {
+			if err := s.deleteReplica(nodeID, chunkKey); err != nil {
+				s.logger.Printf("failed to delete chunk %d of key: %s on node %s, error: %v\n", i, key, nodeID, err)
+				continue
+			}
+			removed++
+		}
+	}
+	s.metrics.Count("chunks_cleaned", int64(removed))
+}
+
+func (s *HTTPServer) deleteReplica(nodeID ring.NodeID, key string) error {
+	if nodeID == ring.NodeID(s.cfg.NodeID) {
+		return s.storeDelete(key)
+	}
+	address, ok := s.ring.GetNodeAddress(nodeID)
+	if !ok {
+		return fmt.Errorf("node %s not found in ring", nodeID)
+	}
+	return s.transport.Delete(context.Background(), address, key)
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChunkedValues(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.WriteQuorum = 1
+	s.cfg.ReadQuorum = 1
+	s.cfg.ChunkSize = 4
+	s.cfg.MaxValueBytes = 16
+
+	do := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, "/kv/big", strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do(http.MethodPut, "0123456789"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for chunked put, got %d", rec.Code)
+	}
+	if n := s.storage.Len(); n != 4 {
+		t.Errorf("Expected manifest plus 3 chunks, got %d keys", n)
+	}
+	if rec := do(http.MethodGet, ""); !strings.Contains(rec.Body.String(), `"value":"MDEyMzQ1Njc4OQ=="`) {
+		t.Errorf("Expected reassembled value, got %s", rec.Body.String())
+	}
+
+	if rec := do(http.MethodPut, "tiny"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for plain put, got %d", rec.Code)
+	}
+	if n := s.storage.Len(); n != 1 {
+		t.Errorf("Expected chunks of the replaced value to be dropped, got %d keys", n)
+	}
+
+	if rec := do(http.MethodPut, strings.Repeat("x", 17)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 above the value limit, got %d", rec.Code)
+	}
+}
+
+func TestTornChunkedValues(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.WriteQuorum = 1
+	s.cfg.ReadQuorum = 1
+	s.cfg.ChunkSize = 4
+
+	for _, value := range []string{"0123456789", "abcdefghij"} {
+		if _, err := s.put(t.Context(), "big", []byte(value), nil, 1, time.Time{}); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	manifest, _ := s.storage.Get("big")
+	m, err := decodeManifest(manifest)
+	if err != nil || m.Previous == nil {
+		t.Fatalf("Expected the manifest to remember the replaced value, got %+v, %v", m, err)
+	}
+
+	// Lose a chunk of the latest write, as if it had not been replicated here
+	s.storage.Delete(m.chunkKey("big", 1))
+	got, err := s.get(t.Context(), "big", 1)
+	if err != nil || string(got.Value) != "0123456789" {
+		t.Errorf("Expected the previous complete value, got %q, %v", got.Value, err)
+	}
+
+	s.storage.Delete(m.Previous.chunkKey("big", 0))
+	_, err = s.get(t.Context(), "big", 1)
+	var opErr *opError
+	if !errors.As(err, &opErr) || opErr.status != http.StatusServiceUnavailable || !strings.Contains(opErr.message, "chunk 1 of 3 missing") {
+		t.Errorf("Expected 503 naming the missing chunk, got %v", err)
+	}
+
+	if _, err := s.put(t.Context(), "big", []byte("ABCDEFGHIJ"), nil, 1, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if _, ok := s.storage.Get(m.Previous.chunkKey("big", 1)); ok {
+		t.Errorf("Expected the chunks of the oldest value to be dropped")
+	}
+	if _, ok := s.storage.Get(m.chunkKey("big", 0)); !ok {
+		t.Errorf("Expected the chunks of the replaced value to be kept")
+	}
+}
+
+func TestDeleteChunkedValues(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	a.cfg.ChunkSize = 4
+
+	if _, err := a.put(t.Context(), "big", []byte("0123456789"), nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := a.delete(t.Context(), "big", a.cfg.WriteQuorum); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	for _, s := range []*HTTPServer{a, b} {
+		if got, ok := s.versions.GetVersioned("big"); !ok || !got.Tombstone {
+			t.Errorf("Expected a tombstone for the manifest on %s, got %+v", s.cfg.NodeID, got)
+		}
+		if n := s.storage.Len(); n != 3 {
+			t.Errorf("Expected the chunks to outlive the delete until the grace period ends on %s, got %d keys", s.cfg.NodeID, n)
+		}
+	}
+	if got, err := a.get(t.Context(), "big", 2); err != nil || got.Found {
+		t.Errorf("Expected the deleted value to read as missing, got %+v, %v", got, err)
+	}
+
+	a.cleanupChunks(time.Now().Add(a.cfg.TombstoneGrace))
+	for _, s := range []*HTTPServer{a, b} {
+		if n := s.storage.Len(); n != 0 {
+			t.Errorf("Expected the chunks to be removed from %s, got %d keys", s.cfg.NodeID, n)
+		}
+	}
+}
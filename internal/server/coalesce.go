@@ -0,0 +1,71 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// writeFunc performs a write once coalescing is done with it.
+type writeFunc func(key string, value []byte, causal clock.VectorClock, writeQuorum int, expiresAt time.Time) (api.PutResponse, error)
+
+// coalescer merges bursts of writes to the same key. The first write opens a
+// window; writes arriving before it closes replace the pending value, and
+// only the last one is replicated. Every write in the burst waits for that
+// single replication and returns its outcome.
+type coalescer struct {
+	mu      sync.Mutex
+	pending map[string]*pendingWrite
+	write   writeFunc
+	// merged counts writes that were superseded before replication.
+	merged func()
+}
+
+type pendingWrite struct {
+	value       []byte
+	causal      clock.VectorClock
+	writeQuorum int
+	expiresAt   time.Time
+	done        chan struct{}
+	response    api.PutResponse
+	err         error
+}
+
+func newCoalescer(write writeFunc, merged func()) *coalescer {
+	return &coalescer{pending: make(map[string]*pendingWrite), write: write, merged: merged}
+}
+
+// put queues a write to key and blocks until the window it joined has been
+// flushed. The flush uses the strictest write quorum requested in the burst
+// and the causal context of the write it keeps.
+func (c *coalescer) put(key string, value []byte, causal clock.VectorClock, writeQuorum int, expiresAt time.Time, window time.Duration) (api.PutResponse, error) {
+	c.mu.Lock()
+	p, ok := c.pending[key]
+	if ok {
+		p.value = value
+		p.causal = causal
+		p.writeQuorum = max(p.writeQuorum, writeQuorum)
+		p.expiresAt = expiresAt
+		c.merged()
+	} else {
+		p = &pendingWrite{value: value, causal: causal, writeQuorum: writeQuorum, expiresAt: expiresAt, done: make(chan struct{})}
+		c.pending[key] = p
+		time.AfterFunc(window, func() { c.flush(key, p) })
+	}
+	c.mu.Unlock()
+
+	<-p.done
+	return p.response, p.err
+}
+
+func (c *coalescer) flush(key string, p *pendingWrite) {
+	c.mu.Lock()
+	delete(c.pending, key)
+	c.mu.Unlock()
+
+	// p is no longer reachable by put, so its fields are stable
+	p.response, p.err = c.write(key, p.value, p.causal, p.writeQuorum, p.expiresAt)
+	close(p.done)
+}
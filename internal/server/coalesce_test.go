@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCoalescedWrites(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.WriteQuorum = 1
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/namespaces/telemetry", strings.NewReader(`{"coalesce_window_ms":200}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a namespace, got %d", rec.Code)
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/kv/telemetry/cpu", strings.NewReader(strconv.Itoa(i))))
+			codes[i] = rec.Code
+		}()
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("Expected write %d to succeed, got %d", i, code)
+		}
+	}
+	if got := s.stats.coalesced.Value(); got != 4 {
+		t.Errorf("Expected 4 writes merged into one, got %d", got)
+	}
+	if _, ok := s.storage.Get("telemetry/cpu"); !ok {
+		t.Errorf("Expected the last write of the burst to be stored")
+	}
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/amirderis/DHT/internal/codec"
+)
+
+// Nodes compress the bodies they send each other with a codec negotiated
+// per peer. Each node advertises the codecs it supports, in its order of
+// preference, in its membership metadata under api.MetaCodecs and in the
+// X-Codecs header of every internal request and response. A node sends a peer bodies in the first of its own
+// codecs the peer advertised, marked with Content-Encoding, and asks for
+// responses the same way. Until a peer has advertised anything, and for a
+// peer from before codecs were negotiated, which never does, bodies go as
+// they are.
+const codecsHeader = "X-Codecs"
+
+const (
+	// minCompressBytes is the smallest body worth compressing.
+	minCompressBytes = 512
+	// maxPeerBodyBytes bounds what a compressed internal body may expand
+	// to, so that a small body cannot exhaust memory.
+	maxPeerBodyBytes = 1 << 30
+)
+
+// peerCodecs tracks the codecs each peer advertised, by address.
+type peerCodecs struct {
+	// local is this node's order of preference, ending in codec.None.
+	local []string
+	mu    sync.RWMutex
+	peers map[string][]string
+}
+
+func newPeerCodecs(local []string) *peerCodecs {
+	return &peerCodecs{local: local, peers: make(map[string][]string)}
+}
+
+// advertised is the value of the X-Codecs header this node sends.
+func (p *peerCodecs) advertised() string {
+	return strings.Join(p.local, ",")
+}
+
+// learn records what the peer at address advertised. An empty header is a
+// peer that supports no codec.
+func (p *peerCodecs) learn(address, header string) {
+	p.learnAll(address, parseCodecs(header))
+}
+
+// parseCodecs splits an X-Codecs header.
+func parseCodecs(header string) []string {
+	var codecs []string
+	for name := range strings.SplitSeq(header, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			codecs = append(codecs, name)
+		}
+	}
+	return codecs
+}
+
+func (p *peerCodecs) learnAll(address string, codecs []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers[address] = codecs
+}
+
+// forget drops what the peer at address advertised, as a new process there
+// may support different codecs.
+func (p *peerCodecs) forget(address string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.peers, address)
+}
+
+// advertisedBy returns the codecs the peer at address advertised.
+func (p *peerCodecs) advertisedBy(address string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.peers[address]
+}
+
+// codec returns the codec bodies sent to address are compressed with.
+func (p *peerCodecs) codec(address string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return codec.Negotiate(p.local, p.peers[address])
+}
+
+// encodeBody compresses a request body for address and sets the headers
+// that advertise this node's codecs and name the one used.
+func (p *peerCodecs) encodeBody(req *http.Request, address string, body []byte) error {
+	req.Header.Set(codecsHeader, p.advertised())
+	name := p.codec(address)
+	if name == codec.None || len(body) < minCompressBytes {
+		return nil
+	}
+	c, _ := codec.Lookup(name)
+	encoded, err := c.Encode(body)
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(encoded))
+	req.ContentLength = int64(len(encoded))
+	req.GetBody = nil
+	req.Header.Set("Content-Encoding", name)
+	return nil
+}
+
+// decodeResponse learns the codecs the peer at address advertised in resp
+// and decompresses its body.
+func (p *peerCodecs) decodeResponse(address string, resp *http.Response) error {
+	p.learn(address, resp.Header.Get(codecsHeader))
+	body, err := decodeBody(resp.Header.Get("Content-Encoding"), resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return err
+	}
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	return nil
+}
+
+// decodeBody returns body decompressed with the codec named by
+// encoding, or body itself when there is none.
+func decodeBody(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	if encoding == "" || encoding == codec.None || encoding == "identity" {
+		return body, nil
+	}
+	c, ok := codec.Lookup(encoding)
+	if !ok {
+		return nil, errUnknownCodec
+	}
+	defer body.Close()
+	raw, err := io.ReadAll(io.LimitReader(body, maxPeerBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := c.Decode(raw, maxPeerBodyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(decoded)), nil
+}
+
+var errUnknownCodec = errors.New("unknown content encoding")
+
+// negotiateCodecs wraps the internal API: it decompresses request bodies,
+// advertises this node's codecs and compresses responses for peers that
+// advertised theirs.
+func (s *HTTPServer) negotiateCodecs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := decodeBody(r.Header.Get("Content-Encoding"), r.Body)
+		if errors.Is(err, errUnknownCodec) {
+			s.writeError(w, http.StatusUnsupportedMediaType, "unsupported content encoding: "+r.Header.Get("Content-Encoding"))
+			return
+		}
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid compressed body: "+err.Error())
+			return
+		}
+		r.Body = body
+		r.Header.Del("Content-Encoding")
+		w.Header().Set(codecsHeader, s.codecs.advertised())
+
+		name := codec.Negotiate(s.codecs.local, parseCodecs(r.Header.Get(codecsHeader)))
+		if name == codec.None {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &codecResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		cw.finish(name)
+	})
+}
+
+// codecResponseWriter holds a response back until the handler is done, so
+// that it can be compressed whole. No internal response is streamed.
+type codecResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *codecResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *codecResponseWriter) Write(p []byte) (int, error) {
+	return w.body.Write(p)
+}
+
+func (w *codecResponseWriter) finish(name string) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	body := w.body.Bytes()
+	if len(body) >= minCompressBytes {
+		c, _ := codec.Lookup(name)
+		if encoded, err := c.Encode(body); err == nil {
+			body = encoded
+			w.Header().Set("Content-Encoding", name)
+		}
+	}
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(body)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *codecResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/codec"
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestPeerCodecs(t *testing.T) {
+	a, _ := startTestNodeWith(t, "a", func(cfg *config.Config) { cfg.PeerCodecsCSV = "snappy,gzip" })
+	b, _ := startTestNodeWith(t, "b", func(cfg *config.Config) { cfg.PeerCodecsCSV = "gzip" })
+	peer, err := a.sendJoin(b.cfg.BindAddr)
+	if err != nil {
+		t.Fatalf("Expected a to join through b, got %v", err)
+	}
+	if got := peer.Meta[api.MetaCodecs]; got != "gzip,none" {
+		t.Errorf("Expected b to announce its codecs in its metadata, got %q", got)
+	}
+	if err := a.joinMember(peer); err != nil {
+		t.Fatalf("Failed to add b: %v", err)
+	}
+	if got := a.codecs.codec(b.cfg.BindAddr); got != "gzip" {
+		t.Errorf("Expected a to send b gzip, the codec both support, got %s", got)
+	}
+	if got := b.codecs.codec(a.cfg.BindAddr); got != "gzip" {
+		t.Errorf("Expected b to learn a's codecs from its join, got %s", got)
+	}
+
+	value := []byte(strings.Repeat("compressible ", 1000))
+	if _, err := a.put(t.Context(), "key", value, nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if stored, ok := b.storage.Get("key"); !ok || !bytes.Equal(stored, value) {
+		t.Errorf("Expected the compressed write to reach b intact, got %d bytes", len(stored))
+	}
+	got, err := a.get(t.Context(), "key", 2)
+	if err != nil || !bytes.Equal(got.Value, value) {
+		t.Errorf("Expected to read the value back from both nodes, got %d bytes, %v", len(got.Value), err)
+	}
+	for _, m := range a.memberStates() {
+		if m.NodeID == "b" && (m.Codec != "gzip" || !slices.Equal(m.Codecs, []string{"gzip", "none"})) {
+			t.Errorf("Expected b listed with its codecs, got %+v", m)
+		}
+	}
+
+	// A peer that advertises no codecs is sent bodies as they are
+	var encodings []string
+	legacy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	legacy.Config.Protocols = a.server.Protocols
+	legacy.Start()
+	defer legacy.Close()
+	address := strings.TrimPrefix(legacy.URL, "http://")
+	a.codecs.learnAll(address, []string{"snappy"})
+	if err := a.transport.Ping(t.Context(), address); err != nil {
+		t.Fatalf("Expected the legacy peer to answer, got %v", err)
+	}
+	if got := a.codecs.codec(address); got != codec.None {
+		t.Errorf("Expected a response without codecs to downgrade the peer, got %s", got)
+	}
+	if err := a.transport.Leave(t.Context(), address, api.Member{NodeID: strings.Repeat("a", 1000)}); err != nil {
+		t.Fatalf("Expected the legacy peer to accept the leave, got %v", err)
+	}
+	if encodings[len(encodings)-1] != "" {
+		t.Errorf("Expected an uncompressed body, got %q", encodings[len(encodings)-1])
+	}
+
+	// A body in a codec the node does not support is refused
+	req := httptest.NewRequest(http.MethodPost, "/internal/batch", strings.NewReader("{}"))
+	req.Header.Set("Content-Encoding", "lz5")
+	rec := httptest.NewRecorder()
+	a.server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/amirderis/DHT/internal/quorum"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// A request that gives local_quorum as its R or W counts only the replicas
+// of a key in the coordinator's datacenter, as announced in membership
+// metadata, and needs a majority of those. Replicas elsewhere are still
+// read from and written to, but their answers do not count, and a write
+// short of local replicas does not fall back to a sloppy quorum. A key
+// with no replica in the local datacenter cannot reach a local quorum.
+//
+// A quorum larger than the replicas counted, as on a ring of fewer nodes
+// than the replication factor, is lowered to them. Each request that had
+// its quorum lowered counts once in quorum_downgrades and is answered with
+// an X-Quorum-Downgraded header, or metadata over gRPC, such as "W=3->2",
+// giving the quorum asked for and the one applied.
+const quorumDowngradedHeader = "X-Quorum-Downgraded"
+
+type quorumContextKey struct{}
+
+// quorumScope is how the quorums of one client request are counted and
+// where their downgrades are reported.
+type quorumScope struct {
+	localRead, localWrite bool
+	// report adds a downgrade to the response
+	report              func(downgrade string)
+	readOnce, writeOnce sync.Once
+}
+
+func quorumScopeFrom(ctx context.Context) *quorumScope {
+	scope, _ := ctx.Value(quorumContextKey{}).(*quorumScope)
+	return scope
+}
+
+// withQuorumScope scopes the quorums of r, reporting downgrades in the
+// header of w.
+func withQuorumScope(w http.ResponseWriter, r *http.Request) *http.Request {
+	scope := &quorumScope{
+		localRead:  quorum.Local(r.Header.Get(readConsistencyHeader)),
+		localWrite: quorum.Local(r.Header.Get(writeConsistencyHeader)),
+		report:     func(downgrade string) { w.Header().Add(quorumDowngradedHeader, downgrade) },
+	}
+	return r.WithContext(context.WithValue(r.Context(), quorumContextKey{}, scope))
+}
+
+// withGRPCQuorumScope scopes the quorums of a gRPC call, which asks for a
+// local quorum in the same headers as over HTTP, sent as metadata, and
+// reports downgrades in its header metadata.
+func withGRPCQuorumScope(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	local := func(header string) bool {
+		values := md.Get(header)
+		return len(values) > 0 && quorum.Local(values[0])
+	}
+	scope := &quorumScope{
+		localRead:  local(readConsistencyHeader),
+		localWrite: local(writeConsistencyHeader),
+		report: func(downgrade string) {
+			grpc.SetHeader(ctx, metadata.Pairs(quorumDowngradedHeader, downgrade))
+		},
+	}
+	return context.WithValue(ctx, quorumContextKey{}, scope)
+}
+
+// everyReplica counts every replica towards the quorums of ctx, for
+// writes that wait for all of them wherever they are.
+func everyReplica(ctx context.Context) context.Context {
+	scope := quorumScopeFrom(ctx)
+	if scope == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, quorumContextKey{}, &quorumScope{report: scope.report})
+}
+
+// replicaCount is the quorum of one read or write of a key and the
+// replicas that count towards it.
+type replicaCount struct {
+	q        int
+	replicas int
+	local    map[ring.NodeID]bool // nil when every replica counts
+}
+
+// counts reports whether an answer from nodeID counts towards the quorum.
+func (c replicaCount) counts(nodeID ring.NodeID) bool {
+	return c.local == nil || c.local[nodeID]
+}
+
+// need is the quorum after any downgrade.
+func (c replicaCount) need() int {
+	return quorum.Effective(c.q, c.replicas)
+}
+
+// met reports whether acks counted answers reach the quorum.
+func (c replicaCount) met(acks int) bool {
+	return quorum.Met(acks, c.q, c.replicas)
+}
+
+// acked counts the replicas in statuses that answered ok and count.
+func (c replicaCount) acked(statuses replicaStatuses) int {
+	acks := 0
+	for nodeID, status := range statuses {
+		if status == replicaOK && c.counts(nodeID) {
+			acks++
+		}
+	}
+	return acks
+}
+
+// quorumFor counts the quorum q of a read, or a write when write is set,
+// of a key replicated on prefList.
+func (s *HTTPServer) quorumFor(ctx context.Context, q int, prefList []ring.NodeID, write bool) replicaCount {
+	scope := quorumScopeFrom(ctx)
+	local := scope != nil && s.cfg.Datacenter != "" && ((write && scope.localWrite) || (!write && scope.localRead))
+	if !local {
+		return replicaCount{q: q, replicas: len(prefList)}
+	}
+	c := replicaCount{local: make(map[ring.NodeID]bool)}
+	for _, nodeID := range prefList {
+		if s.memberMeta(string(nodeID))[api.MetaDatacenter] == s.cfg.Datacenter {
+			c.local[nodeID] = true
+		}
+	}
+	c.replicas = len(c.local)
+	c.q = quorum.Majority(c.replicas)
+	return c
+}
+
+// reportDowngrade counts and reports c if its quorum was lowered, once per
+// client request and kind. Work outside a client request, such as a
+// restore, counts every downgrade.
+func (s *HTTPServer) reportDowngrade(ctx context.Context, c replicaCount, write bool) {
+	if !quorum.Downgraded(c.q, c.replicas) {
+		return
+	}
+	name := "R"
+	if write {
+		name = "W"
+	}
+	downgrade := fmt.Sprintf("%s=%d->%d", name, c.q, c.need())
+	scope := quorumScopeFrom(ctx)
+	if scope == nil {
+		s.countDowngrade()
+		return
+	}
+	once := &scope.readOnce
+	if write {
+		once = &scope.writeOnce
+	}
+	once.Do(func() {
+		s.countDowngrade()
+		scope.report(downgrade)
+	})
+}
+
+func (s *HTTPServer) countDowngrade() {
+	s.stats.quorumDowngrades.Add(1)
+	s.metrics.Count("quorum_downgrades", 1)
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/pkg/api"
+	"github.com/amirderis/DHT/pkg/api/dhtpb"
+)
+
+func TestLocalQuorum(t *testing.T) {
+	inDC := func(dc string) func(*config.Config) {
+		return func(cfg *config.Config) {
+			cfg.Datacenter = dc
+			cfg.ReplicationFactor = 3
+		}
+	}
+	a, _ := startTestNodeWith(t, "a", inDC("east"))
+	c, _ := startTestNodeWith(t, "c", inDC("west"))
+	// b shares a's datacenter but is down; c is up in the other one
+	for _, m := range []api.Member{
+		{NodeID: "b", Address: "127.0.0.1:1", Incarnation: 1, Meta: map[string]string{api.MetaDatacenter: "east"}},
+		{NodeID: "c", Address: c.cfg.BindAddr, Incarnation: 1, Meta: map[string]string{api.MetaDatacenter: "west"}},
+	} {
+		if err := a.joinMember(m); err != nil {
+			t.Fatalf("Failed to join %s: %v", m.NodeID, err)
+		}
+	}
+	a.cluster.MarkDead("b")
+
+	request := func(method, header, consistency string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/kv/key", strings.NewReader("value"))
+		req.Header.Set(header, consistency)
+		rec := httptest.NewRecorder()
+		a.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := request(http.MethodPut, writeConsistencyHeader, "2"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected W=2 to be met by a and c, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := request(http.MethodPut, writeConsistencyHeader, "local_quorum"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a local quorum write to fail with b down, got %d", rec.Code)
+	}
+	if rec := request(http.MethodGet, readConsistencyHeader, "local_quorum"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a local quorum read to fail with b down, got %d", rec.Code)
+	}
+	if rec := request(http.MethodGet, readConsistencyHeader, "quorum"); rec.Code != http.StatusOK {
+		t.Errorf("Expected a quorum read to be met by a and c, got %d", rec.Code)
+	}
+
+	// Once b is back a and b make the local quorum without c
+	b, _ := startTestNodeWith(t, "b", inDC("east"))
+	a.joinMember(api.Member{NodeID: "b", Address: b.cfg.BindAddr, Incarnation: 2, Meta: map[string]string{api.MetaDatacenter: "east"}})
+	a.cluster.MarkAlive("b")
+	if rec := request(http.MethodPut, writeConsistencyHeader, "local_quorum"); rec.Code != http.StatusOK {
+		t.Errorf("Expected a local quorum write to be met by a and b, got %d: %s", rec.Code, rec.Body)
+	}
+	if members := a.memberStates(); len(members) != 3 || members[2].Meta[api.MetaDatacenter] != "west" {
+		t.Errorf("Expected the members listed with their datacenters, got %+v", members)
+	}
+}
+
+func TestQuorumDowngrade(t *testing.T) {
+	s := newTestServer(t)
+	put := func(consistency string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/kv/key", strings.NewReader("value"))
+		req.Header.Set(writeConsistencyHeader, consistency)
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	// A single node holds one replica of the three asked for
+	rec := put("all")
+	if rec.Code != http.StatusOK || rec.Header().Get(quorumDowngradedHeader) != "W=3->1" {
+		t.Errorf("Expected W=all downgraded to 1 and reported, got %d %q", rec.Code, rec.Header().Get(quorumDowngradedHeader))
+	}
+	if got := s.stats.quorumDowngrades.Value(); got != 1 {
+		t.Errorf("Expected 1 downgrade counted, got %d", got)
+	}
+	if rec := put("1"); rec.Header().Get(quorumDowngradedHeader) != "" || s.stats.quorumDowngrades.Value() != 1 {
+		t.Errorf("Expected W=1 not to be reported as downgraded, got %q", rec.Header().Get(quorumDowngradedHeader))
+	}
+
+	var header metadata.MD
+	k := &kvService{s: s}
+	ctx := grpc.NewContextWithServerTransportStream(t.Context(), &headerStream{header: &header})
+	if _, err := k.Put(ctx, &dhtpb.PutRequest{Key: "key", Value: []byte("value"), WriteQuorum: 3}); err != nil {
+		t.Fatalf("Failed to put over gRPC: %v", err)
+	}
+	if got := header.Get(quorumDowngradedHeader); len(got) != 1 || got[0] != "W=3->1" {
+		t.Errorf("Expected the downgrade in the gRPC header, got %v", got)
+	}
+}
+
+// headerStream records the header a gRPC handler sets.
+type headerStream struct {
+	grpc.ServerTransportStream
+	header *metadata.MD
+}
+
+func (h *headerStream) SetHeader(md metadata.MD) error {
+	*h.header = metadata.Join(*h.header, md)
+	return nil
+}
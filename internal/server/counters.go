@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// A counter is a key holding a storage.Counter: every node that
+// coordinates an increment adds it to its own entry, so increments through
+// different nodes are concurrent writes that replicas and reads merge
+// rather than one overwriting the other. Increments through the same node
+// take turns, each reading the count the previous one wrote, which holds
+// as long as R + W > N.
+
+// counterLocks serializes the increments this node coordinates per key.
+type counterLocks struct {
+	stripes [64]sync.Mutex
+}
+
+// lock locks the stripe of key and returns it for unlocking.
+func (l *counterLocks) lock(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	mu := &l.stripes[h.Sum32()%uint32(len(l.stripes))]
+	mu.Lock()
+	return mu
+}
+
+// handleCounters serves GET /counters/{key} and POST /counters/{key}/incr.
+func (s *HTTPServer) handleCounters(w http.ResponseWriter, r *http.Request) {
+	r = withQuorumScope(w, r)
+	key := r.URL.Path[len("/counters/"):]
+	incr := false
+	if r.Method == http.MethodPost {
+		key, incr = strings.CutSuffix(key, "/incr")
+	}
+	if key == "" {
+		s.writeError(w, http.StatusBadRequest, "key cannot be empty")
+		return
+	}
+	if r.Method != http.MethodGet && !incr {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	ctx, cancel, err := s.requestContext(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer cancel()
+	key = tenantKey(ctx, key)
+	readQuorum := s.getQuorumFromHeader(r, readConsistencyHeader, s.cfg.ReadQuorum)
+
+	var response api.CounterResponse
+	if incr {
+		var req api.CounterIncrement
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid increment: "+err.Error())
+			return
+		}
+		if req.Delta == 0 {
+			s.writeError(w, http.StatusBadRequest, "delta must not be zero")
+			return
+		}
+		writeQuorum := s.getQuorumFromHeader(r, writeConsistencyHeader, s.cfg.WriteQuorum)
+		response, err = s.increment(ctx, key, req.Delta, readQuorum, writeQuorum)
+	} else {
+		response, err = s.readCounter(ctx, key, readQuorum)
+	}
+	if err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	response.Key = clientKey(ctx, key)
+	s.writeJSON(w, response)
+}
+
+// readCounter returns the value of the counter stored under key, zero if
+// there is none.
+func (s *HTTPServer) readCounter(ctx context.Context, key string, readQuorum int) (api.CounterResponse, error) {
+	read, err := s.get(ctx, key, readQuorum)
+	if err != nil {
+		return api.CounterResponse{}, err
+	}
+	counter, err := mergedCounter(key, read)
+	if err != nil {
+		return api.CounterResponse{}, err
+	}
+	return api.CounterResponse{Value: counter.Value(), Version: causalContext(read)}, nil
+}
+
+// convergeAttempts bounds how often a write of a counter, set or map is
+// retried from a fresh read after it was refused as stale.
+const convergeAttempts = 5
+
+// increment adds delta to the counter stored under key. The write covers
+// every version it read, and this node's entry carries its earlier
+// increments forward. An increment through another node that lands
+// between the read and the write gets the write refused as stale, in
+// which case it is retried with this node's entries as first counted, so
+// that replicas which took the failed write do not count delta twice.
+func (s *HTTPServer) increment(ctx context.Context, key string, delta int64, readQuorum, writeQuorum int) (api.CounterResponse, error) {
+	defer s.counters.lock(key).Unlock()
+	var mine *storage.Counter
+	var err error
+	for range convergeAttempts {
+		var read api.GetResponse
+		if read, err = s.get(ctx, key, readQuorum); err != nil {
+			return api.CounterResponse{}, err
+		}
+		var counter storage.Counter
+		if counter, err = mergedCounter(key, read); err != nil {
+			return api.CounterResponse{}, err
+		}
+		if mine == nil {
+			counter.Add(s.cfg.NodeID, delta)
+			mine = &counter
+		} else {
+			counter = counter.Merge(*mine)
+		}
+		var written api.PutResponse
+		if written, err = s.put(ctx, key, counter.Encode(), causalContext(read), writeQuorum, time.Time{}); err == nil {
+			s.metrics.Count("counter_increments", 1)
+			return api.CounterResponse{Value: counter.Value(), Version: written.Version}, nil
+		}
+		var opErr *opError
+		if !errors.As(err, &opErr) || opErr.status != http.StatusConflict {
+			return api.CounterResponse{}, err
+		}
+		s.metrics.Count("counter_retries", 1)
+	}
+	return api.CounterResponse{}, err
+}
+
+// mergedCounter merges the counters a read of key returned, one per
+// sibling. A key that holds anything but a counter is a conflict.
+func mergedCounter(key string, read api.GetResponse) (storage.Counter, error) {
+	var counter storage.Counter
+	for _, value := range readValues(read) {
+		c, err := storage.DecodeCounter(value)
+		if !storage.IsCounter(value) || err != nil {
+			return storage.Counter{}, &opError{http.StatusConflict, "key does not hold a counter: " + key}
+		}
+		counter = counter.Merge(c)
+	}
+	return counter, nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestCounters(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	incr := func(s *HTTPServer, body string) (int, api.CounterResponse) {
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/counters/hits/incr", strings.NewReader(body)))
+		var resp api.CounterResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec.Code, resp
+	}
+
+	// Increments through both nodes at once are all counted
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node := a
+			if i%2 == 1 {
+				node = b
+			}
+			if code, _ := incr(node, `{"delta":1}`); code != http.StatusOK {
+				t.Errorf("Expected 200 for an increment, got %d", code)
+			}
+		}()
+	}
+	wg.Wait()
+	if code, resp := incr(b, `{"delta":-5}`); code != http.StatusOK || resp.Value != 15 || resp.Key != "hits" {
+		t.Errorf("Expected a decrement to leave 15, got %d %+v", code, resp)
+	}
+	for _, s := range []*HTTPServer{a, b} {
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/counters/hits", nil))
+		var resp api.CounterResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Value != 15 {
+			t.Errorf("Expected node %s to read 15, got %+v, %v", s.cfg.NodeID, resp, err)
+		}
+	}
+
+	// Concurrent versions a read finds are summed, not picked between
+	var fromA, fromB storage.Counter
+	fromA.Add("a", 4)
+	fromB.Add("b", 2)
+	a.versions.PutVersioned("split", storage.NewVersionedValue(fromA.Encode(), clock.VectorClock{"a": 1}))
+	b.versions.PutVersioned("split", storage.NewVersionedValue(fromB.Encode(), clock.VectorClock{"b": 1}))
+	if resp, err := a.readCounter(t.Context(), "split", 2); err != nil || resp.Value != 6 {
+		t.Errorf("Expected siblings to merge to 6, got %+v, %v", resp, err)
+	}
+
+	if code, _ := incr(a, `{"delta":0}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a zero delta, got %d", code)
+	}
+	a.put(t.Context(), "plain", []byte("value"), nil, 2, time.Time{})
+	rec := httptest.NewRecorder()
+	a.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/counters/plain/incr", strings.NewReader(`{"delta":1}`)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 incrementing a key that is not a counter, got %d", rec.Code)
+	}
+}
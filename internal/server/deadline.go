@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/amirderis/DHT/internal/ring"
+)
+
+// A client may bound a whole request with the X-Timeout header. The
+// coordinator runs its replica sub-requests under that deadline and, when
+// it passes before the quorum is reached, answers 504 with what each
+// replica had answered by then. Sub-requests are never given longer than
+// cfg.PeerTimeout.
+
+// Replica statuses reported by a deadlineError.
+const (
+	replicaOK        = "ok"
+	replicaStale     = "stale"
+	replicaCorrupt   = "corrupt"
+	replicaDead      = "dead"
+	replicaNoAnswer  = "no answer before deadline"
+	replicaUnknownID = "not in ring"
+)
+
+// replicaStatuses records how each replica of a quorum request answered.
+type replicaStatuses map[ring.NodeID]string
+
+// deadlineError reports a request whose deadline passed before it reached
+// its quorum.
+type deadlineError struct {
+	key      string
+	replicas replicaStatuses
+}
+
+func (e *deadlineError) Error() string {
+	ids := make([]string, 0, len(e.replicas))
+	for nodeID := range e.replicas {
+		ids = append(ids, string(nodeID))
+	}
+	sort.Strings(ids)
+	message := "deadline exceeded before reaching quorum for key: " + e.key
+	for _, id := range ids {
+		message += fmt.Sprintf("; %s: %s", id, e.replicas[ring.NodeID(id)])
+	}
+	return message
+}
+
+// quorumError counts a request that failed to reach quorum and returns a
+// deadlineError when ctx ended, and fallback otherwise.
+func (s *HTTPServer) quorumError(ctx context.Context, key string, replicas replicaStatuses, fallback error) error {
+	s.stats.quorumFailures.Add(1)
+	if ctx.Err() == nil {
+		return fallback
+	}
+	return &deadlineError{key, replicas}
+}
+
+// writeDeadlineError answers 504 with the status of every replica.
+func (s *HTTPServer) writeDeadlineError(w http.ResponseWriter, err *deadlineError) {
+	replicas := make(map[string]string, len(err.replicas))
+	for nodeID, status := range err.replicas {
+		replicas[string(nodeID)] = status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusGatewayTimeout)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":    "deadline exceeded before reaching quorum for key: " + err.key,
+		"replicas": replicas,
+	})
+}
+
+// parseRequestTimeout reads the X-Timeout header, given as whole
+// milliseconds ("250") or a Go duration ("1.5s"). Zero means no deadline.
+func parseRequestTimeout(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	if millis, err := strconv.Atoi(raw); err == nil {
+		if millis <= 0 {
+			return 0, fmt.Errorf("timeout must be positive, got %q", raw)
+		}
+		return time.Duration(millis) * time.Millisecond, nil
+	}
+	timeout, err := time.ParseDuration(raw)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q", raw)
+	}
+	return timeout, nil
+}
+
+// requestContext returns the context the replica sub-requests of r run
+// under: r's own, bounded by its X-Timeout when set.
+func (s *HTTPServer) requestContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	timeout, err := parseRequestTimeout(r.Header.Get(timeoutHeader))
+	if err != nil {
+		return nil, nil, err
+	}
+	if timeout == 0 {
+		ctx, cancel := context.WithCancel(r.Context())
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return ctx, cancel, nil
+}
+
+// detach keeps the deadline of ctx but not its cancellation, for replica
+// writes that go on in the background after the coordinator has answered.
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return context.WithCancel(detached)
+}
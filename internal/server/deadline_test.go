@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/membership"
+)
+
+func TestRequestDeadline(t *testing.T) {
+	a := startTestNode(t, "a")
+	release := make(chan struct{})
+	slow := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	slow.Config.Protocols = a.server.Protocols
+	slow.Start()
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+	a.ring.JoinNode("slow", slow.Listener.Addr().String(), 1)
+
+	do := func(method, timeout string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/kv/key", strings.NewReader("value"))
+		req.Header.Set(timeoutHeader, timeout)
+		a.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := do(http.MethodGet, "soon"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid timeout, got %d", rec.Code)
+	}
+	for _, method := range []string{http.MethodPut, http.MethodGet} {
+		start := time.Now()
+		rec := do(method, "100")
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Fatalf("Expected %s to time out with 504, got %d: %s", method, rec.Code, rec.Body)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected %s to give up at its deadline, took %s", method, elapsed)
+		}
+		var body struct {
+			Replicas map[string]string `json:"replicas"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if body.Replicas["a"] != replicaOK || body.Replicas["slow"] != replicaNoAnswer {
+			t.Errorf("Expected %s to find a ok and slow without an answer, got %v", method, body.Replicas)
+		}
+	}
+	if a.cluster.State("slow") == membership.Dead {
+		t.Errorf("Expected a slow replica not to be marked dead")
+	}
+}
@@ -0,0 +1,347 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/membership"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// Decommissioning a node hands every token range it replicates to the
+// nodes that take it over once the node is gone, so that removing it does
+// not drop a replica of each key it held. The node diffs its ring against
+// the same ring without itself, sends each new owner the keys of the range
+// it lacks or holds an older version of, and lists the range on the new
+// owner again to verify receipt. Only when every range is verified does it
+// ask its peers to remove it from their rings, leave its own and report
+// itself not ready; until then it keeps serving as before. Writes that
+// land between the last verification and the peers removing the node are
+// left to read repair and anti-entropy.
+
+// decommissionAttempts bounds the passes over the ranges not yet handed off.
+const decommissionAttempts = 3
+
+// maxDecommissionErrors bounds the failures a DecommissionStatus lists.
+const maxDecommissionErrors = 10
+
+// decommissionRetryDelay is the pause before handing off failed ranges again.
+var decommissionRetryDelay = 5 * time.Second
+
+// decommissionProgress tracks the handoff of a departing node.
+type decommissionProgress struct {
+	mu     sync.Mutex
+	status api.DecommissionStatus
+}
+
+func newDecommissionProgress() *decommissionProgress {
+	return &decommissionProgress{status: api.DecommissionStatus{State: "active"}}
+}
+
+// handleDecommission serves POST /admin/decommission, which starts
+// decommissioning this node, and GET, which reports the progress.
+func (s *HTTPServer) handleDecommission(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.writeJSON(w, s.decommissionStatus())
+	case http.MethodPost:
+		p := s.decommission
+		p.mu.Lock()
+		switch p.status.State {
+		case "streaming":
+			p.mu.Unlock()
+			s.writeError(w, http.StatusConflict, "decommission already running")
+			return
+		case "left":
+			p.mu.Unlock()
+			s.writeError(w, http.StatusConflict, "node already left the ring")
+			return
+		}
+		p.status = api.DecommissionStatus{State: "streaming", StartedAt: time.Now()}
+		p.mu.Unlock()
+		s.logger.Printf("decommissioning node %s\n", s.cfg.NodeID)
+		go func() {
+			ctx, cancel := contextUntil(s.stopCh)
+			defer cancel()
+			s.runDecommission(ctx)
+		}()
+		w.WriteHeader(http.StatusAccepted)
+		s.writeJSON(w, s.decommissionStatus())
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+	}
+}
+
+// lostRanges returns the ranges this node replicates that change owners
+// once it leaves.
+func (s *HTTPServer) lostRanges() []ring.Move {
+	self := ring.NodeID(s.cfg.NodeID)
+	after := s.ring.Clone()
+	after.RemoveNode(self)
+	var lost []ring.Move
+	for _, move := range ring.Diff(s.ring, after, s.cfg.ReplicationFactor) {
+		if slices.Contains(move.From, self) {
+			lost = append(lost, move)
+		}
+	}
+	return lost
+}
+
+// runDecommission hands off every lost range, retrying the ranges that
+// fail, and leaves the ring once all of them are verified.
+func (s *HTTPServer) runDecommission(ctx context.Context) {
+	remaining := s.lostRanges()
+	p := s.decommission
+	p.mu.Lock()
+	p.status.Ranges = len(remaining)
+	p.mu.Unlock()
+	s.publishDecommission(api.RebalanceStarted, nil, nil)
+
+	var errs []string
+	for attempt := 1; len(remaining) > 0; attempt++ {
+		var failed []ring.Move
+		errs = errs[:0]
+		for _, move := range remaining {
+			if err := s.handOffMove(ctx, move); err != nil {
+				failed = append(failed, move)
+				errs = append(errs, fmt.Sprintf("range %s: %v", rangeName(move.Range), err))
+				s.publishDecommission(api.RebalanceRangeFailed, &move.Range, err)
+				continue
+			}
+			s.metrics.Count("decommission_ranges", 1)
+			p.mu.Lock()
+			p.status.HandedOff++
+			p.mu.Unlock()
+			s.publishDecommission(api.RebalanceRangeMoved, &move.Range, nil)
+		}
+		remaining = failed
+		if len(remaining) == 0 || attempt == decommissionAttempts || ctx.Err() != nil {
+			break
+		}
+		s.logger.Printf("failed to hand off %d token ranges, retrying in %v\n", len(remaining), decommissionRetryDelay)
+		select {
+		case <-time.After(decommissionRetryDelay):
+		case <-ctx.Done():
+		}
+	}
+	if len(remaining) == 0 {
+		errs = s.leaveRing(ctx)
+	}
+
+	p.mu.Lock()
+	p.status.FinishedAt = time.Now()
+	p.status.Errors = slices.Clone(errs[:min(len(errs), maxDecommissionErrors)])
+	if len(remaining) > 0 {
+		p.status.State = "failed"
+		s.logger.Printf("decommission failed: %d of %d token ranges not handed off\n", len(remaining), p.status.Ranges)
+	} else {
+		p.status.State = "left"
+		s.logger.Printf("node %s left the ring after handing off %d token ranges: %d keys, %d bytes\n", s.cfg.NodeID, p.status.Ranges, p.status.Keys, p.status.Bytes)
+	}
+	p.mu.Unlock()
+	s.publishDecommission(api.RebalanceFinished, nil, nil)
+}
+
+// handOffMove hands the range of move to each node that replicates it
+// once this node leaves but does not yet.
+func (s *HTTPServer) handOffMove(ctx context.Context, move ring.Move) error {
+	for _, nodeID := range move.To {
+		if slices.Contains(move.From, nodeID) {
+			continue
+		}
+		address, exists := s.ring.GetNodeAddress(nodeID)
+		if !exists || s.cluster.State(string(nodeID)) == membership.Dead {
+			return fmt.Errorf("new owner %s is unavailable", nodeID)
+		}
+		if err := s.handOffRange(ctx, move.Range, address); err != nil {
+			return fmt.Errorf("new owner %s: %w", nodeID, err)
+		}
+	}
+	return nil
+}
+
+// handOffRange sends the node at address every key of tr it lacks or
+// holds an older version of, then lists tr there again to verify that it
+// holds them all.
+func (s *HTTPServer) handOffRange(ctx context.Context, tr ring.TokenRange, address string) error {
+	remote, _, err := s.fetchRangeListing(ctx, address, tr)
+	if err != nil {
+		return err
+	}
+	local := s.rangeListing(tr)
+	held := listedVersions(remote)
+	for _, entry := range local.Entries {
+		if holdsVersion(held, entry) {
+			continue
+		}
+		value, ok := s.versions.GetVersioned(entry.Key)
+		if !ok {
+			continue
+		}
+		if err := s.writeToRemoteNode(ctx, address, entry.Key, value); err != nil && !errors.Is(err, storage.ErrStaleVersion) {
+			return err
+		}
+		s.metrics.Count("decommission_keys", 1)
+		p := s.decommission
+		p.mu.Lock()
+		p.status.Keys++
+		p.status.Bytes += int64(len(value.Value))
+		p.mu.Unlock()
+	}
+
+	remote, _, err = s.fetchRangeListing(ctx, address, tr)
+	if err != nil {
+		return fmt.Errorf("verifying: %w", err)
+	}
+	held = listedVersions(remote)
+	missing := 0
+	for _, entry := range local.Entries {
+		if !holdsVersion(held, entry) {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return fmt.Errorf("verifying: %d of %d keys missing", missing, len(local.Entries))
+	}
+	return nil
+}
+
+// listedVersions indexes the versions of a range listing by key.
+func listedVersions(listing api.RangeListing) map[string]clock.VectorClock {
+	versions := make(map[string]clock.VectorClock, len(listing.Entries))
+	for _, entry := range listing.Entries {
+		versions[entry.Key] = entry.Version
+	}
+	return versions
+}
+
+// holdsVersion reports whether held has entry's key at its version or a
+// newer one.
+func holdsVersion(held map[string]clock.VectorClock, entry api.RangeEntry) bool {
+	theirs, ok := held[entry.Key]
+	if !ok {
+		return false
+	}
+	mine := clock.VectorClock(entry.Version)
+	return clock.Equal(theirs, mine) || clock.Compare(theirs, mine) > 0
+}
+
+// leaveRing asks every peer to remove this node from its ring, then leaves
+// its own, and returns the peers it could not tell.
+func (s *HTTPServer) leaveRing(ctx context.Context) []string {
+	self := ring.NodeID(s.cfg.NodeID)
+	var errs []string
+	for nodeID, address := range s.ring.GetNodes() {
+		if nodeID == self {
+			continue
+		}
+		if err := s.sendLeave(ctx, address); err != nil {
+			errs = append(errs, fmt.Sprintf("peer %s did not remove this node: %v", nodeID, err))
+		}
+	}
+	s.readyFlag.Store(false)
+	s.ring.RemoveNode(self)
+	return errs
+}
+
+func (s *HTTPServer) sendLeave(ctx context.Context, address string) error {
+	return s.transport.Leave(ctx, address, s.self())
+}
+
+// handleInternalLeave removes a decommissioned peer from the ring. Only the
+// incarnation the ring knows may leave, so that a late request cannot
+// remove a node that has since rejoined.
+func (s *HTTPServer) handleInternalLeave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	var m api.Member
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil || m.NodeID == "" {
+		s.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := s.removeMember(m); err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeMember removes a peer that left from the ring, drops the hints
+// queued for it and repairs the ranges it replicated along with this node.
+// A decommissioned peer handed its ranges off before leaving but an evicted
+// one could not, and the repair only sends what the new replicas lack.
+func (s *HTTPServer) removeMember(m api.Member) error {
+	if m.NodeID == s.cfg.NodeID {
+		return &opError{http.StatusBadRequest, "a node cannot remove itself"}
+	}
+	nodeID := ring.NodeID(m.NodeID)
+	incarnation, known := s.ring.Incarnation(nodeID)
+	if known && incarnation != m.Incarnation {
+		return &opError{http.StatusConflict, fmt.Sprintf("node %s is at incarnation %d, not %d", m.NodeID, incarnation, m.Incarnation)}
+	}
+	if !known {
+		return nil
+	}
+	before := s.ring.Clone()
+	s.ring.RemoveNode(nodeID)
+	s.cluster.Forget(m.NodeID)
+	if s.hints != nil {
+		if err := s.hints.Drop(m.NodeID); err != nil {
+			s.logger.Printf("failed to drop hints for node %s: %v\n", m.NodeID, err)
+		}
+	}
+	s.logger.Printf("node %s left the ring\n", m.NodeID)
+	go func() {
+		ctx, cancel := contextUntil(s.stopCh)
+		defer cancel()
+		s.reReplicate(ctx, before, nodeID)
+	}()
+	return nil
+}
+
+// reReplicate repairs the ranges this node replicates that nodeID was a
+// replica of in before, so that the nodes taking its place get its keys.
+func (s *HTTPServer) reReplicate(ctx context.Context, before *ring.Ring, nodeID ring.NodeID) {
+	self := ring.NodeID(s.cfg.NodeID)
+	ranges := make(map[ring.TokenRange]bool)
+	for _, move := range ring.Diff(before, s.ring, s.cfg.ReplicationFactor) {
+		if slices.Contains(move.From, nodeID) && slices.Contains(move.To, self) {
+			for _, tr := range s.replicatedRanges(move.Range) {
+				ranges[tr] = true
+			}
+		}
+	}
+	for tr := range ranges {
+		if ctx.Err() != nil {
+			return
+		}
+		if !s.claimRepair(tr) {
+			continue
+		}
+		if result := s.repairRange(ctx, tr); result.Error != "" {
+			s.logger.Printf("failed to re-replicate range %s-%s after node %s left: %s\n", result.Start, result.End, nodeID, result.Error)
+		}
+	}
+}
+
+// decommissionStatus returns a copy of the decommission progress.
+func (s *HTTPServer) decommissionStatus() api.DecommissionStatus {
+	p := s.decommission
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := p.status
+	status.NodeID = s.cfg.NodeID
+	status.Errors = slices.Clone(p.status.Errors)
+	return status
+}
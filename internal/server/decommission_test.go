@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestDecommission(t *testing.T) {
+	nodes := []*HTTPServer{startTestNode(t, "a"), startTestNode(t, "b"), startTestNode(t, "c")}
+	for _, x := range nodes {
+		for _, y := range nodes {
+			x.ring.JoinNode(ring.NodeID(y.cfg.NodeID), y.cfg.BindAddr, y.incarnation)
+		}
+	}
+	a, c := nodes[0], nodes[2]
+	keys := make([]string, 40)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+		if _, err := a.put(t.Context(), keys[i], []byte("value-"+keys[i]), nil, 2, time.Time{}); err != nil {
+			t.Fatalf("Failed to put %s: %v", keys[i], err)
+		}
+	}
+
+	// Progress is published on the rebalance feed, apart from key watches
+	resp, err := http.Get("http://" + c.cfg.BindAddr + "/admin/rebalance/watch")
+	if err != nil {
+		t.Fatalf("Failed to watch rebalancing: %v", err)
+	}
+	defer resp.Body.Close()
+	keyWatch := c.watches.subscribe("")
+	defer c.watches.unsubscribe(keyWatch)
+
+	rec := httptest.NewRecorder()
+	c.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/decommission", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected the decommission to start, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var events []api.RebalanceEvent
+	feed := bufio.NewScanner(resp.Body)
+	for feed.Scan() {
+		data, ok := strings.CutPrefix(feed.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event api.RebalanceEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("Failed to decode rebalance event %s: %v", data, err)
+		}
+		events = append(events, event)
+		if event.Type == api.RebalanceFinished {
+			break
+		}
+	}
+	status := c.decommissionStatus()
+	if status.State != "left" || status.Ranges == 0 || status.HandedOff != status.Ranges || len(status.Errors) > 0 {
+		t.Errorf("Expected every range to be handed off, got %+v", status)
+	}
+	if len(events) != status.Ranges+2 || events[0].Type != api.RebalanceStarted || events[0].Operation != api.RebalanceDecommission {
+		t.Fatalf("Expected a start, %d moves and a finish, got %+v", status.Ranges, events)
+	}
+	for i, event := range events[1 : len(events)-1] {
+		if event.Type != api.RebalanceRangeMoved || event.Range == "" || event.Moved != i+1 || event.NodeID != "c" {
+			t.Errorf("Expected range %d to be moved, got %+v", i+1, event)
+		}
+	}
+	if last := events[len(events)-1]; last.State != "left" || last.Percent != 100 || last.Keys != status.Keys {
+		t.Errorf("Expected the decommission to finish at 100%%, got %+v", last)
+	}
+	for len(keyWatch.events) > 0 {
+		if ev := <-keyWatch.events; ev.rebalance != nil {
+			t.Errorf("Expected key watches not to see rebalance events, got %+v", ev.rebalance)
+		}
+	}
+
+	// Every key keeps both replicas on the nodes that remain
+	for _, x := range nodes[:2] {
+		if _, ok := x.ring.GetNodeAddress("c"); ok {
+			t.Errorf("Expected %s to have removed c from its ring", x.cfg.NodeID)
+		}
+	}
+	for _, key := range keys {
+		prefList, _ := a.ring.GetPreferenceList(key, 2)
+		for _, nodeID := range prefList {
+			owner := nodes[slices.IndexFunc(nodes, func(x *HTTPServer) bool { return x.cfg.NodeID == string(nodeID) })]
+			if value, _ := owner.storage.Get(key); string(value) != "value-"+key {
+				t.Errorf("Expected %s to hold %s after c left, got %q", nodeID, key, value)
+			}
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	c.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a decommissioned node not to be ready, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	c.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/decommission", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected a second decommission to be refused, got %d", rec.Code)
+	}
+
+	// A leave for an incarnation the ring does not know is refused
+	rec = httptest.NewRecorder()
+	a.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/internal/leave", strings.NewReader(`{"node_id":"b","address":"x","incarnation":99}`)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected a stale leave to be refused, got %d", rec.Code)
+	}
+}
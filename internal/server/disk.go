@@ -0,0 +1,18 @@
+//go:build linux || darwin
+
+package server
+
+import "syscall"
+
+// diskUsage returns how full, in percent, the file system holding dir is
+// for unprivileged writers.
+func diskUsage(dir string) (float64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	if st.Blocks == 0 {
+		return 0, nil
+	}
+	return percent(float64(st.Blocks-st.Bavail), float64(st.Blocks)), nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package server
+
+import "errors"
+
+func diskUsage(string) (float64, error) {
+	return 0, errors.New("disk usage is not supported on this platform")
+}
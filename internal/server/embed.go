@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// The exported methods below serve library mode (pkg/dhtnode): they run
+// the operations of the /kv/ handlers for a caller in the same process,
+// with the node's configured quorums and the caller's context as the
+// request deadline.
+
+// Get reads key as GET /kv/{key} does.
+func (s *HTTPServer) Get(ctx context.Context, key string) (api.GetResponse, error) {
+	if key == "" {
+		return api.GetResponse{}, &opError{http.StatusBadRequest, "key cannot be empty"}
+	}
+	return s.get(ctx, key, s.cfg.ReadQuorum)
+}
+
+// Put writes value under key as PUT /kv/{key} does, expiring it after ttl
+// unless ttl is zero.
+func (s *HTTPServer) Put(ctx context.Context, key string, value []byte, ttl time.Duration) (api.PutResponse, error) {
+	if key == "" {
+		return api.PutResponse{}, &opError{http.StatusBadRequest, "key cannot be empty"}
+	}
+	if int64(len(value)) > s.cfg.MaxValueBytes {
+		return api.PutResponse{}, &opError{http.StatusRequestEntityTooLarge, fmt.Sprintf("value exceeds %d bytes", s.cfg.MaxValueBytes)}
+	}
+	if ttl < 0 {
+		return api.PutResponse{}, &opError{http.StatusBadRequest, "ttl cannot be negative"}
+	}
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	return s.put(ctx, key, value, nil, s.cfg.WriteQuorum, expiresAt)
+}
+
+// Delete removes key as DELETE /kv/{key} does.
+func (s *HTTPServer) Delete(ctx context.Context, key string) error {
+	if key == "" {
+		return &opError{http.StatusBadRequest, "key cannot be empty"}
+	}
+	return s.delete(ctx, key, s.cfg.WriteQuorum)
+}
+
+// Ready reports whether /readyz would answer that the node is ready.
+func (s *HTTPServer) Ready() bool {
+	return s.readyFlag.Load() && s.checkBootstrapped() == nil
+}
+
+// ErrorStatus returns the HTTP status the /kv/ handlers answer err with.
+func ErrorStatus(err error) int {
+	var deadlineErr *deadlineError
+	if errors.As(err, &deadlineErr) {
+		return http.StatusGatewayTimeout
+	}
+	var opErr *opError
+	if errors.As(err, &opErr) {
+		return opErr.status
+	}
+	return http.StatusInternalServerError
+}
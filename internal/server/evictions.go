@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// Every eviction a node carries out is kept in its eviction log, served at
+// GET /admin/members/evictions, with when it happened, the address it was
+// requested from and the operator the request named in X-Operator. With
+// cfg.DataDir set the log is appended to evictions.jsonl there, one record
+// per line synced before the eviction is answered, and read back on start.
+
+const (
+	// evictionsFile holds the eviction log in the data directory.
+	evictionsFile = "evictions.jsonl"
+	// maxEvictions bounds the evictions kept in memory and served; the
+	// file keeps all of them.
+	maxEvictions = 1000
+	// operatorHeader names the operator requesting an eviction.
+	operatorHeader = "X-Operator"
+)
+
+type evictionLog struct {
+	mu      sync.Mutex
+	entries []api.Eviction
+	// path is the file the log is appended to, empty when it is only
+	// kept in memory
+	path string
+}
+
+// loadEvictions reads the eviction log kept in dir, if any. A line torn by
+// a crash is cut off so that later records start on a line of their own.
+func loadEvictions(dir string) (*evictionLog, error) {
+	l := &evictionLog{path: filepath.Join(dir, evictionsFile)}
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return l, err
+	}
+	if end := bytes.LastIndexByte(data, '\n') + 1; end < len(data) {
+		data = data[:end]
+		if err := os.Truncate(l.path, int64(end)); err != nil {
+			return l, err
+		}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		var e api.Eviction
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		l.entries = appendBounded(l.entries, e, maxEvictions)
+	}
+	return l, nil
+}
+
+// record adds e to the log, syncing it to disk first when the log is
+// persisted.
+func (l *evictionLog) record(e api.Eviction) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = appendBounded(l.entries, e, maxEvictions)
+	if l.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// list returns the evictions in the log, oldest first.
+func (l *evictionLog) list() []api.Eviction {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]api.Eviction{}, l.entries...)
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestEvictionLogSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	l, err := loadEvictions(dir)
+	if err != nil {
+		t.Fatalf("Failed to open the eviction log: %v", err)
+	}
+	for _, id := range []string{"c", "d"} {
+		if err := l.record(api.Eviction{Member: api.Member{NodeID: id}, At: time.Now(), From: "10.0.0.1:5000", Operator: "alice"}); err != nil {
+			t.Fatalf("Failed to record an eviction: %v", err)
+		}
+	}
+	f, _ := os.OpenFile(filepath.Join(dir, evictionsFile), os.O_WRONLY|os.O_APPEND, 0o644)
+	f.WriteString(`{"member":{"node_id":"e"`)
+	f.Close()
+
+	reopened, err := loadEvictions(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen the eviction log: %v", err)
+	}
+	if got := reopened.list(); len(got) != 2 || got[0].Member.NodeID != "c" || got[1].Operator != "alice" {
+		t.Errorf("Expected both evictions after a restart and the torn one skipped, got %+v", got)
+	}
+	reopened.record(api.Eviction{Member: api.Member{NodeID: "f"}})
+	if again, _ := loadEvictions(dir); len(again.list()) != 3 {
+		t.Errorf("Expected an eviction recorded after the torn line to be kept, got %+v", again.list())
+	}
+}
@@ -0,0 +1,366 @@
+package server
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+
+	"github.com/amirderis/DHT/internal/cursor"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+	"github.com/amirderis/DHT/pkg/api/dhtpb"
+)
+
+// An export streams the values this node owns, one record per key, for
+// moving data out of the cluster; an import writes such records through
+// the normal write path, for moving data in. Records are JSON lines of
+// api.SnapshotEntry, or with format=binary length-prefixed protobuf
+// ReplicateRequests as peers send each other. A chunked value is exported
+// whole and its chunks are left out, so that records hold the values
+// clients wrote rather than the way they are stored. Records come in ring
+// order, by the token of their key, so that an export split into pages
+// with limit= resumes at the same place whichever nodes own the keys by
+// then. Both push their connection's deadlines out as each record moves,
+// so that they can run as long as the data takes.
+
+const (
+	exportFormatJSON   = "ndjson"
+	exportFormatBinary = "binary"
+	// exportPage is how many keys an export lists from storage at a time.
+	exportPage = 1000
+)
+
+// exportFormat reads the format query parameter, ndjson by default.
+func exportFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", exportFormatJSON:
+		return exportFormatJSON, nil
+	case exportFormatBinary:
+		return exportFormatBinary, nil
+	default:
+		return "", fmt.Errorf("unexpected format %q (want %s or %s)", format, exportFormatJSON, exportFormatBinary)
+	}
+}
+
+// handleExport serves GET /admin/export?format=&prefix=&primary=. It
+// streams every live value with the given prefix whose key this node is a
+// replica of, or with primary=true only those it is the primary replica
+// of, so that exporting from every node covers each key once. With
+// limit=n it streams the first n and sets the X-Cursor header to the
+// cursor that continues the export, passed back as cursor=. An export
+// that fails to read a value aborts the response, which clients see as a
+// broken stream rather than one that ended early.
+func (s *HTTPServer) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	query := r.URL.Query()
+	format, err := exportFormat(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := 0
+	if raw := query.Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 {
+			s.writeError(w, http.StatusBadRequest, "invalid limit: "+raw)
+			return
+		}
+	}
+	position := cursor.Cursor{Listing: cursor.Export, Prefix: query.Get("prefix")}
+	var resume *cursor.Cursor
+	if raw := query.Get("cursor"); raw != "" {
+		if position, err = cursor.Decode(cursor.Export, raw); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		resume = &position
+	}
+
+	primary := query.Get("primary") == "true"
+	// Without a limit the keys are listed a page at a time as the export
+	// goes; with one they are listed at once, to name the cursor that
+	// continues the export before the first record is sent
+	pageSize := exportPage
+	if limit > 0 {
+		pageSize = limit + 1
+	}
+	keys := s.exportKeys(position.Prefix, resume, primary, pageSize)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		last := keys[limit-1]
+		w.Header().Set(cursorHeader, cursor.Cursor{Listing: cursor.Export, Prefix: position.Prefix, Token: last.token, Key: last.key}.Encode())
+	}
+	if format == exportFormatBinary {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	rc := http.NewResponseController(w)
+	out := bufio.NewWriter(w)
+	enc := json.NewEncoder(out)
+	exported := 0
+	for len(keys) > 0 {
+		for _, key := range keys {
+			extendDeadlines(rc)
+			written, err := s.writeExportRecord(r.Context(), out, enc, format, key.key)
+			if err != nil {
+				s.logger.Printf("export aborted at key %s: %v\n", key.key, err)
+				s.metrics.Count("export_failures", 1)
+				panic(http.ErrAbortHandler)
+			}
+			if written {
+				exported++
+			}
+		}
+		if limit > 0 || len(keys) < pageSize {
+			break
+		}
+		last := keys[len(keys)-1]
+		keys = s.exportKeys(position.Prefix, &cursor.Cursor{Token: last.token, Key: last.key}, primary, pageSize)
+	}
+	if err := out.Flush(); err != nil {
+		return
+	}
+	s.metrics.Count("exported_entries", int64(exported))
+}
+
+// writeExportRecord writes the record of key to out in format, reporting
+// false for a key that is no longer live.
+func (s *HTTPServer) writeExportRecord(ctx context.Context, out io.Writer, enc *json.Encoder, format, key string) (bool, error) {
+	record, ok, err := s.exportRecord(ctx, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	if format == exportFormatBinary {
+		_, err = protodelim.MarshalTo(out, dhtpb.FromReplicateRequest(record))
+		return err == nil, err
+	}
+	err = enc.Encode(api.SnapshotEntry{
+		Key:         record.Key,
+		Value:       record.Value,
+		Version:     record.Version,
+		UpdatedAt:   record.Timestamp,
+		ExpiresAt:   record.ExpiresAt,
+		ContentType: record.ContentType,
+		Meta:        record.Meta,
+	})
+	return err == nil, err
+}
+
+// exportKey is a key an export covers and its position on the ring.
+type exportKey struct {
+	token uint64
+	key   string
+}
+
+// exportKeys lists the first n live keys with prefix an export from this
+// node covers, after resume when it is set, in ring order. However many
+// keys it scans, it holds at most twice n at a time.
+func (s *HTTPServer) exportKeys(prefix string, resume *cursor.Cursor, primary bool, n int) []exportKey {
+	var keys []exportKey
+	first := func() {
+		slices.SortFunc(keys, func(a, b exportKey) int {
+			if c := cmp.Compare(a.token, b.token); c != 0 {
+				return c
+			}
+			return strings.Compare(a.key, b.key)
+		})
+		keys = keys[:min(len(keys), n)]
+	}
+	from := ""
+	for {
+		var entries []storage.ScanEntry
+		entries, from = s.versions.Scan(prefix, from, exportPage)
+		for _, entry := range entries {
+			if entry.Tombstone || chunkKeyPattern.MatchString(entry.Key) || !s.exports(entry.Key, primary) {
+				continue
+			}
+			token := ring.KeyHash(entry.Key)
+			if resume != nil && resume.Before(token, entry.Key) {
+				continue
+			}
+			keys = append(keys, exportKey{token: token, key: entry.Key})
+			if len(keys) >= 2*n {
+				first()
+			}
+		}
+		if from == "" {
+			break
+		}
+	}
+	first()
+	return keys
+}
+
+// exports reports whether an export from this node covers key.
+func (s *HTTPServer) exports(key string, primary bool) bool {
+	preferenceList, err := s.ring.GetPreferenceList(key, s.cfg.ReplicationFactor)
+	if err != nil || len(preferenceList) == 0 {
+		return false
+	}
+	if primary {
+		return preferenceList[0] == ring.NodeID(s.cfg.NodeID)
+	}
+	for _, nodeID := range preferenceList {
+		if nodeID == ring.NodeID(s.cfg.NodeID) {
+			return true
+		}
+	}
+	return false
+}
+
+// exportRecord reads the record of key, reassembling a chunked value
+// from its chunks. It reports false for a value that expired or was
+// deleted since it was listed.
+func (s *HTTPServer) exportRecord(ctx context.Context, key string) (api.ReplicateRequest, bool, error) {
+	stored, ok := s.versions.GetVersioned(key)
+	if !ok || stored.Tombstone {
+		return api.ReplicateRequest{}, false, nil
+	}
+	value := stored.Value
+	if isManifest(value) {
+		var err error
+		if value, err = s.getChunked(ctx, key, value, s.cfg.ReadQuorum); err != nil {
+			return api.ReplicateRequest{}, false, err
+		}
+	}
+	return api.ReplicateRequest{
+		Key:         key,
+		Value:       value,
+		Version:     stored.Version,
+		ExpiresAt:   stored.ExpiresAt,
+		Timestamp:   stored.Timestamp,
+		Checksum:    crc32.ChecksumIEEE(value),
+		ContentType: stored.ContentType,
+		Meta:        stored.Meta,
+	}, true, nil
+}
+
+// maxImportErrors bounds the failures an ImportResponse lists.
+const maxImportErrors = 10
+
+// handleImport serves POST /admin/import?format=, whose body holds records
+// as an export writes them. Each record is written like a PUT of its
+// value, to the owners of its key under this node's ring: the version it
+// carries is not kept, so a record supersedes what the cluster holds.
+// Expired records are skipped. A record that cannot be read ends the
+// import with 400, after the records before it were written.
+func (s *HTTPServer) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	if err := s.checkBootstrapped(); err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	format, err := exportFormat(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rc := http.NewResponseController(w)
+	body := deadlineReader{r: r.Body, rc: rc}
+	next := s.jsonRecords(body)
+	if format == exportFormatBinary {
+		next = s.binaryRecords(body)
+	}
+
+	var response api.ImportResponse
+	now := time.Now()
+	for n := 1; ; n++ {
+		extendDeadlines(rc)
+		record, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid record %d (%d imported): %v", n, response.Imported, err))
+			return
+		}
+		if !record.ExpiresAt.IsZero() && !now.Before(record.ExpiresAt) {
+			response.Expired++
+			continue
+		}
+		if err := s.importRecord(r.Context(), record); err != nil {
+			response.Failed++
+			if len(response.Errors) < maxImportErrors {
+				response.Errors = append(response.Errors, fmt.Sprintf("key %s: %v", record.Key, err))
+			}
+			continue
+		}
+		response.Imported++
+	}
+	s.metrics.Count("imported_entries", int64(response.Imported))
+	s.logger.Printf("imported %d records: %d expired, %d failed\n", response.Imported, response.Expired, response.Failed)
+	s.writeJSON(w, response)
+}
+
+// jsonRecords returns a function that reads the next JSON line of body,
+// or io.EOF after the last one.
+func (s *HTTPServer) jsonRecords(body io.Reader) func() (api.ReplicateRequest, error) {
+	dec := json.NewDecoder(body)
+	return func() (api.ReplicateRequest, error) {
+		var entry api.SnapshotEntry
+		if err := dec.Decode(&entry); err != nil {
+			return api.ReplicateRequest{}, err
+		}
+		if entry.Key == "" {
+			return api.ReplicateRequest{}, errors.New("key cannot be empty")
+		}
+		return api.ReplicateRequest{Key: entry.Key, Value: entry.Value, ExpiresAt: entry.ExpiresAt, ContentType: entry.ContentType, Meta: entry.Meta}, nil
+	}
+}
+
+// binaryRecords returns a function that reads the next length-prefixed
+// record of body, or io.EOF after the last one.
+func (s *HTTPServer) binaryRecords(body io.Reader) func() (api.ReplicateRequest, error) {
+	in := bufio.NewReader(body)
+	// A record holds a value and its metadata
+	opts := protodelim.UnmarshalOptions{MaxSize: s.cfg.MaxValueBytes + 64<<10}
+	return func() (api.ReplicateRequest, error) {
+		var record dhtpb.ReplicateRequest
+		if err := opts.UnmarshalFrom(in, &record); err != nil {
+			return api.ReplicateRequest{}, err
+		}
+		req := record.API()
+		if req.Key == "" {
+			return api.ReplicateRequest{}, errors.New("key cannot be empty")
+		}
+		if crc32.ChecksumIEEE(req.Value) != req.Checksum {
+			return api.ReplicateRequest{}, fmt.Errorf("key %s: %w", req.Key, errChecksumMismatch)
+		}
+		return req, nil
+	}
+}
+
+// importRecord writes a record as a PUT would, merging it into a set or
+// map when its namespace holds those and it is sent as a document.
+func (s *HTTPServer) importRecord(ctx context.Context, record api.ReplicateRequest) error {
+	if int64(len(record.Value)) > s.cfg.MaxValueBytes {
+		return fmt.Errorf("value exceeds %d bytes", s.cfg.MaxValueBytes)
+	}
+	var err error
+	if valueType := s.namespaceValueType(record.Key); valueType != "" && !storage.Converges(record.Value) {
+		_, err = s.putTyped(ctx, record.Key, valueType, record.Value, s.cfg.ReadQuorum, s.cfg.WriteQuorum, record.ExpiresAt)
+	} else {
+		ctx = withAttributes(ctx, valueAttributes{contentType: record.ContentType, meta: record.Meta})
+		_, err = s.put(ctx, record.Key, record.Value, nil, s.cfg.WriteQuorum, record.ExpiresAt)
+	}
+	return err
+}
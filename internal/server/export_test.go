@@ -0,0 +1,207 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestExportImport(t *testing.T) {
+	chunked := func(cfg *config.Config) { cfg.ChunkSize = 4 }
+	a, _ := startTestNodeWith(t, "a", chunked)
+	b, _ := startTestNodeWith(t, "b", chunked)
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	values := map[string]string{"alpha": "value-alpha", "bravo": "value-bravo", "charlie": "value-charlie", "big": "0123456789"}
+	for key, value := range values {
+		if _, err := a.put(t.Context(), key, []byte(value), nil, 2, time.Time{}); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+	if _, err := a.put(t.Context(), "ttl", []byte("value-ttl"), nil, 2, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to put ttl: %v", err)
+	}
+	values["ttl"] = "value-ttl"
+
+	export := func(node *HTTPServer, query string) []byte {
+		rec := httptest.NewRecorder()
+		node.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/export?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		return rec.Body.Bytes()
+	}
+	records := func(data []byte) map[string]api.SnapshotEntry {
+		entries := map[string]api.SnapshotEntry{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var entry api.SnapshotEntry
+			if err := dec.Decode(&entry); err == io.EOF {
+				return entries
+			} else if err != nil {
+				t.Fatalf("Failed to decode export: %v", err)
+			}
+			entries[entry.Key] = entry
+		}
+	}
+
+	// Chunks are left out and the chunked value exported whole
+	all := records(export(a, ""))
+	if len(all) != len(values) {
+		t.Fatalf("Expected %d records, got %d", len(values), len(all))
+	}
+	for key, value := range values {
+		if string(all[key].Value) != value || len(all[key].Version) == 0 {
+			t.Errorf("Expected %s exported as %q with its version, got %+v", key, value, all[key])
+		}
+	}
+	if all["ttl"].ExpiresAt.IsZero() || !all["alpha"].ExpiresAt.IsZero() {
+		t.Errorf("Expected only ttl to expire, got %v and %v", all["ttl"].ExpiresAt, all["alpha"].ExpiresAt)
+	}
+	if got := records(export(a, "prefix=b")); len(got) != 2 {
+		t.Errorf("Expected 2 records under prefix b, got %d", len(got))
+	}
+	// Pages resume after the cursor in ring order and cover every key once
+	paged, query := map[string]api.SnapshotEntry{}, "limit=2"
+	for pages := 0; query != ""; pages++ {
+		if pages > len(values) {
+			t.Fatalf("Expected the export to end, got %d records", len(paged))
+		}
+		rec := httptest.NewRecorder()
+		a.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/export?"+query, nil))
+		page := records(rec.Body.Bytes())
+		if len(page) > 2 {
+			t.Errorf("Expected at most 2 records per page, got %d", len(page))
+		}
+		for key, entry := range page {
+			if _, ok := paged[key]; ok {
+				t.Errorf("Expected %s exported once, got it again", key)
+			}
+			paged[key] = entry
+		}
+		query = ""
+		if next := rec.Header().Get("X-Cursor"); next != "" {
+			query = "limit=2&cursor=" + next
+		}
+	}
+	if len(paged) != len(values) {
+		t.Errorf("Expected the pages to hold %d records, got %d", len(values), len(paged))
+	}
+	// Every key has one primary replica
+	primaryA, primaryB := records(export(a, "primary=true")), records(export(b, "primary=true"))
+	for key := range primaryA {
+		if _, ok := primaryB[key]; ok {
+			t.Errorf("Expected %s exported by one primary only", key)
+		}
+	}
+	if len(primaryA)+len(primaryB) != len(values) {
+		t.Errorf("Expected the primaries to export %d records, got %d and %d", len(values), len(primaryA), len(primaryB))
+	}
+
+	dst := newTestServer(t)
+	dst.cfg.ReadQuorum, dst.cfg.WriteQuorum = 1, 1
+	dst.cfg.ChunkSize = 4
+	rec := httptest.NewRecorder()
+	dst.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/import?format=binary", bytes.NewReader(export(a, "format=binary"))))
+	var imported api.ImportResponse
+	json.NewDecoder(rec.Body).Decode(&imported)
+	if rec.Code != http.StatusOK || imported.Imported != len(values) || imported.Failed != 0 {
+		t.Fatalf("Expected %d records imported, got %d %+v", len(values), rec.Code, imported)
+	}
+	for key, value := range values {
+		req := httptest.NewRequest(http.MethodGet, "/kv/"+key, nil)
+		req.Header.Set("Accept", "application/octet-stream")
+		rec := httptest.NewRecorder()
+		dst.server.Handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Body.String() != value {
+			t.Errorf("Expected %s imported as %q, got %d %q", key, value, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Records before a malformed one are written
+	body := `{"key":"delta","value":"ZA=="}` + "\n" + `{"key":"expired","value":"eA==","expires_at":"2000-01-01T00:00:00Z"}` + "\nnot json\n"
+	rec = httptest.NewRecorder()
+	dst.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/import", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid record 3 (1 imported)") {
+		t.Errorf("Expected 400 at the third record, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got, ok := dst.versions.GetVersioned("delta"); !ok || string(got.Value) != "d" {
+		t.Errorf("Expected delta imported, got %+v", got)
+	}
+	if _, ok := dst.versions.GetVersioned("expired"); ok {
+		t.Errorf("Expected the expired record to be skipped")
+	}
+}
+
+func TestExportImportOutlastTimeouts(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.ReadQuorum, s.cfg.WriteQuorum = 1, 1
+	ts := httptest.NewUnstartedServer(s.server.Handler)
+	ts.Config.ReadTimeout = 100 * time.Millisecond
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	// Records trickle in over several times the listener's timeouts
+	pr, pw := io.Pipe()
+	go func() {
+		for i := range 4 {
+			time.Sleep(75 * time.Millisecond)
+			fmt.Fprintf(pw, `{"key":"slow-%d","value":"dg=="}`+"\n", i)
+		}
+		pw.Close()
+	}()
+	resp, err := http.Post(ts.URL+"/admin/import", "application/x-ndjson", pr)
+	if err != nil {
+		t.Fatalf("Expected the slow import to complete, got %v", err)
+	}
+	var imported api.ImportResponse
+	json.NewDecoder(resp.Body).Decode(&imported)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || imported.Imported != 4 {
+		t.Fatalf("Expected 4 records imported, got %d %+v", resp.StatusCode, imported)
+	}
+
+	// An export of more keys than it lists at a time covers each once,
+	// read slowly over several times the listener's timeouts
+	value := bytes.Repeat([]byte("v"), 16<<10)
+	for i := range exportPage + 10 {
+		s.versions.PutVersioned(fmt.Sprintf("key-%d", i), &storage.VersionedValue{Value: value, Version: clock.VectorClock{"a": 1}})
+	}
+	resp, err = http.Get(ts.URL + "/admin/export")
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	defer resp.Body.Close()
+	seen := map[string]bool{}
+	dec := json.NewDecoder(resp.Body)
+	for n := 0; ; n++ {
+		if n == 1 {
+			time.Sleep(250 * time.Millisecond)
+		}
+		var entry api.SnapshotEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Expected the slow export to complete, got %v after %d records", err, len(seen))
+		}
+		if seen[entry.Key] {
+			t.Errorf("Expected %s exported once, got it again", entry.Key)
+		}
+		seen[entry.Key] = true
+	}
+	if len(seen) != exportPage+14 {
+		t.Errorf("Expected %d records, got %d", exportPage+14, len(seen))
+	}
+}
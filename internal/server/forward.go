@@ -0,0 +1,26 @@
+package server
+
+import (
+	"context"
+	"slices"
+
+	"github.com/amirderis/DHT/internal/ring"
+)
+
+// Any node can take a client request for any key. Reads, writes and
+// deletes for a key this node is not a replica of are coordinated from
+// here against the key's preference list.
+
+// storedValue returns the value stored under key as is: the local copy on
+// a replica of key, or else the copy a single replica returns.
+func (s *HTTPServer) storedValue(ctx context.Context, key string) []byte {
+	preferenceList, err := s.ring.GetPreferenceList(key, s.cfg.ReplicationFactor)
+	if err == nil && !slices.Contains(preferenceList, ring.NodeID(s.cfg.NodeID)) {
+		if response, err := s.getValue(ctx, key, 1); err == nil && response.Found {
+			return response.Value
+		}
+		return nil
+	}
+	value, _ := s.storage.Get(key)
+	return value
+}
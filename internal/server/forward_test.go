@@ -0,0 +1,56 @@
+package server
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/ring"
+)
+
+func TestNonOwnerCoordinates(t *testing.T) {
+	a, b, c := startTestNode(t, "a"), startTestNode(t, "b"), startTestNode(t, "c")
+	nodes := map[ring.NodeID]*HTTPServer{"a": a, "b": b, "c": c}
+	for _, s := range nodes {
+		for id, peer := range nodes {
+			s.ring.JoinNode(id, peer.cfg.BindAddr, 1)
+		}
+	}
+
+	// Pick a key that c holds no replica of
+	var key string
+	var prefList []ring.NodeID
+	for i := 0; ; i++ {
+		key = "key-" + strconv.Itoa(i)
+		if prefList, _ = c.ring.GetPreferenceList(key, 2); !slices.Contains(prefList, "c") {
+			break
+		}
+	}
+
+	if _, err := c.put(t.Context(), key, []byte("value"), nil, 1, time.Time{}); err != nil {
+		t.Fatalf("Failed to put through a non-owner: %v", err)
+	}
+	if _, ok := c.storage.Get(key); ok {
+		t.Errorf("Expected the non-owner not to keep a copy")
+	}
+	waitFor(t, func() bool {
+		_, ok := nodes[prefList[0]].storage.Get(key)
+		return ok
+	})
+	if got, err := c.get(t.Context(), key, 1); err != nil || !got.Found || string(got.Value) != "value" {
+		t.Errorf("Expected the non-owner to read from a replica, got %+v, %v", got, err)
+	}
+
+	if err := c.delete(t.Context(), key, 2); err != nil {
+		t.Fatalf("Failed to delete through a non-owner: %v", err)
+	}
+	for _, nodeID := range prefList {
+		if _, ok := nodes[nodeID].storage.Get(key); ok {
+			t.Errorf("Expected the delete to reach replica %s", nodeID)
+		}
+	}
+	if _, ok := c.versions.GetVersioned(key); ok {
+		t.Errorf("Expected the non-owner not to keep a tombstone")
+	}
+}
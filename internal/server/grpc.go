@@ -0,0 +1,457 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"hash/crc32"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/cursor"
+	"github.com/amirderis/DHT/internal/quorum"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+	"github.com/amirderis/DHT/pkg/api/dhtpb"
+)
+
+// defaultScanPageSize is the number of keys sent per Scan message when the client does not choose.
+const defaultScanPageSize = 100
+
+// retryAfterTrailer carries the seconds a throttled Join waits, like the
+// Retry-After header of /internal/join.
+const retryAfterTrailer = "retry-after"
+
+// grpcMessageOverhead is the headroom above MaxValueBytes allowed per gRPC message.
+const grpcMessageOverhead = 64 << 10
+
+func newGRPCServer(s *HTTPServer) *grpc.Server {
+	srv := grpc.NewServer(s.grpcServerOptions()...)
+	dhtpb.RegisterKVServer(srv, &kvService{s: s})
+	dhtpb.RegisterReplicaServer(srv, &replicaService{s: s})
+	return srv
+}
+
+func (s *HTTPServer) grpcServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.MaxConcurrentStreams(uint32(s.cfg.MaxConcurrentStreams)),
+		// Leave room for the key and other fields next to a maximal value
+		grpc.MaxRecvMsgSize(int(s.cfg.MaxValueBytes) + grpcMessageOverhead),
+		grpc.MaxSendMsgSize(int(s.cfg.MaxValueBytes) + grpcMessageOverhead),
+		grpc.ChainUnaryInterceptor(s.epochUnary, s.recoverUnary, s.authorizeUnary),
+		grpc.ChainStreamInterceptor(s.epochStream, s.recoverStream, s.authorizeStream),
+	}
+}
+
+// recoverUnary turns a handler panic into an Internal error, logging the stack trace.
+func (s *HTTPServer) recoverUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer s.recoverRPC(info.FullMethod, &err)
+	return handler(ctx, req)
+}
+
+// recoverStream is the streaming counterpart of recoverUnary.
+func (s *HTTPServer) recoverStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer s.recoverRPC(info.FullMethod, &err)
+	return handler(srv, ss)
+}
+
+func (s *HTTPServer) recoverRPC(method string, err *error) {
+	if p := recover(); p != nil {
+		s.stats.panics.Add(1)
+		s.metrics.Count("panics", 1)
+		s.logger.Printf("panic serving %s: %v\n%s", method, p, debug.Stack())
+		*err = status.Error(codes.Internal, "internal server error")
+	}
+}
+
+// authorizeUnary checks the bearer token an RPC carries in its
+// authorization metadata, as authorizeRPC says.
+func (s *HTTPServer) authorizeUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.authorizeRPC(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authorizeStream is the streaming counterpart of authorizeUnary.
+func (s *HTTPServer) authorizeStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authorizeRPC(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &scopedStream{ss, ctx})
+}
+
+// scopedStream is a server stream whose context carries the tenant of the
+// RPC.
+type scopedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *scopedStream) Context() context.Context {
+	return s.ctx
+}
+
+// authorizeRPC requires the cluster token on the Replica service, like
+// requirePeerToken, and on the KV service the auth or a tenant token when
+// the public listener requires the auth middleware, like requireToken. It
+// returns ctx tagged with the tenant of a tenant token, whose keys the KV
+// service then scopes to the tenant's namespace.
+func (s *HTTPServer) authorizeRPC(ctx context.Context, method string) (context.Context, error) {
+	var got []byte
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			got = []byte(values[0])
+		}
+	}
+	switch {
+	case strings.HasPrefix(method, "/"+dhtpb.Replica_ServiceDesc.ServiceName+"/"):
+		if s.cfg.ClusterToken == "" || subtle.ConstantTimeCompare(got, []byte("Bearer "+s.cfg.ClusterToken)) == 1 {
+			return ctx, nil
+		}
+		return nil, status.Error(codes.Unauthenticated, "missing or invalid cluster token")
+	case !slices.Contains(s.cfg.PublicMiddleware, "auth"):
+		return ctx, nil
+	case s.cfg.AuthToken != "" && subtle.ConstantTimeCompare(got, []byte("Bearer "+s.cfg.AuthToken)) == 1:
+		return ctx, nil
+	}
+	if tenant, ok := s.tenantFor(got); ok {
+		return context.WithValue(ctx, tenantContextKey{}, tenant), nil
+	}
+	return nil, status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+}
+
+// kvService implements the public client API over gRPC with the same
+// quorum semantics as the /kv/ HTTP endpoints.
+type kvService struct {
+	dhtpb.UnimplementedKVServer
+	s *HTTPServer
+}
+
+func (k *kvService) Get(ctx context.Context, req *dhtpb.GetRequest) (*dhtpb.GetResponse, error) {
+	if req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "key cannot be empty")
+	}
+	ctx = withGRPCQuorumScope(ctx)
+	readQuorum := quorum.Requested(int(req.ReadQuorum), k.s.cfg.ReadQuorum)
+	resp, err := k.s.get(ctx, tenantKey(ctx, req.Key), readQuorum)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp.Key = req.Key
+	return dhtpb.FromGetResponse(resp), nil
+}
+
+func (k *kvService) Put(ctx context.Context, req *dhtpb.PutRequest) (*dhtpb.PutResponse, error) {
+	if req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "key cannot be empty")
+	}
+	ctx = withGRPCQuorumScope(ctx)
+	if int64(len(req.Value)) > k.s.cfg.MaxValueBytes {
+		return nil, status.Errorf(codes.ResourceExhausted, "value exceeds %d bytes", k.s.cfg.MaxValueBytes)
+	}
+	if req.Checksum != 0 && crc32.ChecksumIEEE(req.Value) != req.Checksum {
+		return nil, status.Error(codes.DataLoss, errChecksumMismatch.Error())
+	}
+	var expiresAt time.Time
+	if req.TtlSeconds != 0 {
+		ttl, err := ttlFromSeconds(req.TtlSeconds)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		expiresAt = time.Now().Add(ttl)
+	}
+	if k.s.cfg.LWW && req.Timestamp != 0 {
+		if err := k.s.checkClockDrift(clock.Timestamp{WallTime: req.Timestamp}, req.Key); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		ctx = withWriteTime(ctx, time.Unix(0, req.Timestamp))
+	}
+	writeQuorum := quorum.Requested(int(req.WriteQuorum), k.s.cfg.WriteQuorum)
+	level, err := parseAckLevel(req.Ack)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	ctx = withAckLevel(ctx, level)
+	key := tenantKey(ctx, req.Key)
+	if valueType := k.s.namespaceValueType(key); valueType != "" {
+		// As over HTTP, the value is a document merged into the set or
+		// map the key holds
+		resp, err := k.s.putTyped(ctx, key, valueType, req.Value, k.s.cfg.ReadQuorum, writeQuorum, expiresAt)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+		return &dhtpb.PutResponse{Version: resp.Version}, nil
+	}
+	attrs, err := newAttributes(req.ContentType, req.Meta)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	resp, err := k.s.put(withAttributes(ctx, attrs), key, req.Value, req.Context, writeQuorum, expiresAt)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &dhtpb.PutResponse{Version: resp.Version}, nil
+}
+
+func (k *kvService) Delete(ctx context.Context, req *dhtpb.DeleteRequest) (*dhtpb.DeleteResponse, error) {
+	if req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "key cannot be empty")
+	}
+	ctx = withGRPCQuorumScope(ctx)
+	writeQuorum := quorum.Requested(int(req.WriteQuorum), k.s.cfg.WriteQuorum)
+	level, err := parseAckLevel(req.Ack)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := k.s.delete(withAckLevel(ctx, level), tenantKey(ctx, req.Key), writeQuorum); err != nil {
+		return nil, grpcError(err)
+	}
+	return &dhtpb.DeleteResponse{}, nil
+}
+
+// Scan streams the live keys held by this node one page per message. The
+// cursor of each page resumes the scan after it, here or at GET /scan.
+// Like there, the keys of a tenant are listed without their namespace and
+// the chunks of chunked values are left out.
+func (k *kvService) Scan(req *dhtpb.ScanRequest, stream grpc.ServerStreamingServer[dhtpb.ScanResponse]) error {
+	ctx := stream.Context()
+	pageSize := defaultScanPageSize
+	if req.PageSize > 0 {
+		pageSize = int(req.PageSize)
+	}
+	position := cursor.Cursor{Listing: cursor.Scan, Prefix: req.Prefix}
+	if req.Cursor != "" {
+		var err error
+		if position, err = cursor.Decode(cursor.Scan, req.Cursor); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		position.Snapshot = ""
+	}
+	for {
+		after := ""
+		if position.Key != "" {
+			after = tenantKey(ctx, position.Key)
+		}
+		keys, next := k.s.storage.Scan(tenantKey(ctx, position.Prefix), after, pageSize)
+		kept := keys[:0]
+		for _, key := range keys {
+			if !chunkKeyPattern.MatchString(key) {
+				kept = append(kept, clientKey(ctx, key))
+			}
+		}
+		response := &dhtpb.ScanResponse{Keys: kept}
+		if next != "" {
+			position.Key = clientKey(ctx, next)
+			response.Cursor = position.Encode()
+		}
+		if next != "" && len(kept) == 0 {
+			// A page of chunks only is not worth a message
+			continue
+		}
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+	}
+}
+
+// Watch streams writes applied to this node's storage until the client
+// disconnects, the server stops, or the watcher falls too far behind. The
+// chunks of chunked values are left out, as over HTTP.
+func (k *kvService) Watch(req *dhtpb.WatchRequest, stream grpc.ServerStreamingServer[dhtpb.WatchEvent]) error {
+	w := k.s.watches.subscribe(tenantKey(stream.Context(), req.Prefix))
+	defer k.s.watches.unsubscribe(w)
+	for {
+		select {
+		case ev, ok := <-w.events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watcher fell behind")
+			}
+			if chunkKeyPattern.MatchString(ev.key) {
+				continue
+			}
+			event := ev.proto()
+			event.Key = clientKey(stream.Context(), event.Key)
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		case <-k.s.stopCh:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+func (k *kvService) Ring(context.Context, *dhtpb.RingRequest) (*dhtpb.RingResponse, error) {
+	return dhtpb.FromRingResponse(k.s.ringResponse()), nil
+}
+
+// replicaService implements the internal replication API over gRPC with
+// the same semantics as the /internal/ HTTP endpoints.
+type replicaService struct {
+	dhtpb.UnimplementedReplicaServer
+	s *HTTPServer
+}
+
+func (r *replicaService) Get(_ context.Context, req *dhtpb.ReplicateGetRequest) (*dhtpb.ReplicateGetResponse, error) {
+	if err := r.s.acquireRPC(r.s.replicaLimit); err != nil {
+		return nil, err
+	}
+	defer r.s.replicaLimit.release()
+	if req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "key cannot be empty")
+	}
+	resp, _ := r.s.localRead(req.Key)
+	resp.Key = req.Key
+	return dhtpb.FromReplicateGetResponse(resp), nil
+}
+
+func (r *replicaService) GetBatch(_ context.Context, req *dhtpb.ReplicateBatchGetRequest) (*dhtpb.ReplicateBatchGetResponse, error) {
+	if err := r.s.acquireRPC(r.s.replicaLimit); err != nil {
+		return nil, err
+	}
+	defer r.s.replicaLimit.release()
+	resp := &dhtpb.ReplicateBatchGetResponse{Items: make([]*dhtpb.ReplicateGetResponse, len(req.Keys))}
+	for i, item := range r.s.localReads(req.Keys) {
+		resp.Items[i] = dhtpb.FromReplicateGetResponse(item)
+	}
+	return resp, nil
+}
+
+func (r *replicaService) Replicate(_ context.Context, req *dhtpb.ReplicateRequest) (*dhtpb.ReplicateResponse, error) {
+	if err := r.s.acquireRPC(r.s.replicaLimit); err != nil {
+		return nil, err
+	}
+	defer r.s.replicaLimit.release()
+	if req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "key cannot be empty")
+	}
+	value, err := replicateValue(req.API())
+	if err != nil {
+		return nil, status.Error(codes.DataLoss, err.Error())
+	}
+	if req.HintFor != "" {
+		if err := r.s.storeHint(ring.NodeID(req.HintFor), req.Key, value); err != nil {
+			return &dhtpb.ReplicateResponse{Success: false, Error: err.Error()}, nil
+		}
+		return &dhtpb.ReplicateResponse{Success: true, Ack: api.AckBuffered}, nil
+	}
+	if err := r.s.storeVersioned(req.Key, value); err != nil {
+		if errors.Is(err, storage.ErrStaleVersion) {
+			return &dhtpb.ReplicateResponse{Success: false, Error: err.Error(), Ack: api.AckStale}, nil
+		}
+		return &dhtpb.ReplicateResponse{Success: false, Error: "failed to store value"}, nil
+	}
+	return &dhtpb.ReplicateResponse{Success: true, Ack: api.AckApplied}, nil
+}
+
+func (r *replicaService) ReplicateBatch(_ context.Context, req *dhtpb.ReplicateBatchRequest) (*dhtpb.ReplicateResponse, error) {
+	if err := r.s.acquireRPC(r.s.transferLimit); err != nil {
+		return nil, err
+	}
+	defer r.s.transferLimit.release()
+	items := make([]storage.KeyedVersionedValue, 0, len(req.Items))
+	for _, item := range req.Items {
+		if item.Key == "" {
+			return nil, status.Error(codes.InvalidArgument, "key cannot be empty")
+		}
+		value, err := replicateValue(item.API())
+		if err != nil {
+			return nil, status.Error(codes.DataLoss, err.Error())
+		}
+		items = append(items, storage.KeyedVersionedValue{Key: item.Key, Value: value})
+	}
+	if err := r.s.storeBatch(items); err != nil {
+		return &dhtpb.ReplicateResponse{Success: false, Error: "failed to store batch"}, nil
+	}
+	return &dhtpb.ReplicateResponse{Success: true, Ack: api.AckApplied}, nil
+}
+
+func (r *replicaService) Join(ctx context.Context, req *dhtpb.Member) (*dhtpb.Member, error) {
+	if req.NodeId == "" || req.Address == "" {
+		return nil, status.Error(codes.InvalidArgument, "member needs a node id and an address")
+	}
+	wait, err := r.s.admitMember(req.API())
+	if wait > 0 {
+		grpc.SetTrailer(ctx, metadata.Pairs(retryAfterTrailer, strconv.Itoa(retryAfterSeconds(wait))))
+		return nil, status.Error(codes.ResourceExhausted, "too many nodes joining, retry later")
+	}
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return dhtpb.FromMember(r.s.self()), nil
+}
+
+func (r *replicaService) Leave(_ context.Context, req *dhtpb.Member) (*dhtpb.LeaveResponse, error) {
+	if req.NodeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "member needs a node id")
+	}
+	if err := r.s.removeMember(req.API()); err != nil {
+		return nil, grpcError(err)
+	}
+	return &dhtpb.LeaveResponse{}, nil
+}
+
+func (r *replicaService) Ping(context.Context, *dhtpb.PingRequest) (*dhtpb.PingResponse, error) {
+	return &dhtpb.PingResponse{}, nil
+}
+
+func (r *replicaService) ListRange(req *dhtpb.ListRangeRequest, stream grpc.ServerStreamingServer[dhtpb.RangeEntry]) error {
+	source, err := r.s.acquirePeerRPC(stream.Context(), r.s.peerTransfers)
+	if err != nil {
+		return err
+	}
+	defer r.s.peerTransfers.release(source)
+	if err := r.s.acquireRPC(r.s.transferLimit); err != nil {
+		return err
+	}
+	defer r.s.transferLimit.release()
+	listing := r.s.rangeListing(ring.TokenRange{Start: req.Start, End: req.End})
+	for _, entry := range listing.Entries {
+		if err := stream.Send(dhtpb.FromRangeEntry(entry)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grpcError maps an opError's HTTP status onto the closest gRPC code.
+func grpcError(err error) error {
+	var deadlineErr *deadlineError
+	if errors.As(err, &deadlineErr) {
+		return status.Error(codes.DeadlineExceeded, deadlineErr.Error())
+	}
+	var opErr *opError
+	if !errors.As(err, &opErr) {
+		return status.Error(codes.Internal, err.Error())
+	}
+	code := codes.Internal
+	switch opErr.status {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.Aborted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	}
+	return status.Error(code, opErr.message)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/amirderis/DHT/pkg/api/dhtpb"
+)
+
+// sendStream collects the messages a server-streaming gRPC handler sends.
+type sendStream[T any] struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *T
+}
+
+func newSendStream[T any](ctx context.Context) *sendStream[T] {
+	return &sendStream[T]{ctx: ctx, sent: make(chan *T, 100)}
+}
+
+func (s *sendStream[T]) Context() context.Context { return s.ctx }
+
+func (s *sendStream[T]) Send(msg *T) error {
+	s.sent <- msg
+	return nil
+}
+
+func TestGRPCLeavesOutChunks(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.ReadQuorum, s.cfg.WriteQuorum = 1, 1
+	s.cfg.ChunkSize = 16
+	k := &kvService{s: s}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	watch := newSendStream[dhtpb.WatchEvent](ctx)
+	done := make(chan error, 1)
+	go func() { done <- k.Watch(&dhtpb.WatchRequest{}, watch) }()
+	waitFor(t, func() bool {
+		s.watches.mu.Lock()
+		defer s.watches.mu.Unlock()
+		return len(s.watches.watchers) == 1
+	})
+
+	if _, err := k.Put(t.Context(), &dhtpb.PutRequest{Key: "big", Value: []byte(strings.Repeat("x", 40))}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if _, err := k.Put(t.Context(), &dhtpb.PutRequest{Key: "small", Value: []byte("x")}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	scan := newSendStream[dhtpb.ScanResponse](t.Context())
+	if err := k.Scan(&dhtpb.ScanRequest{PageSize: 1}, scan); err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	close(scan.sent)
+	var keys []string
+	for page := range scan.sent {
+		keys = append(keys, page.Keys...)
+	}
+	if strings.Join(keys, ",") != "big,small" {
+		t.Errorf("Expected the scan to list big and small only, got %v", keys)
+	}
+
+	var watched []string
+	for len(watched) < 2 {
+		select {
+		case ev := <-watch.sent:
+			watched = append(watched, ev.Key)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected events for big and small, got %v", watched)
+		}
+	}
+	if strings.Join(watched, ",") != "big,small" {
+		t.Errorf("Expected the watch to send big and small only, got %v", watched)
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/amirderis/DHT/internal/hints"
+	"github.com/amirderis/DHT/internal/membership"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+)
+
+// Hinted handoff: a write that cannot reach a replica because the replica
+// is down is kept as a hint on the coordinator and delivered once the
+// membership view reports the replica alive again. Replicas marked dead are
+// not contacted by writes; they are probed every hintProbeInterval instead.
+
+// hintProbeInterval is how often dead peers are probed and hints for live
+// peers are retried.
+const hintProbeInterval = 5 * time.Second
+
+// hintReplayBatch is how many hints are read from the store at a time.
+const hintReplayBatch = 100
+
+// maxAsyncReplications bounds the background writes to replicas a quorum
+// write did not wait for.
+const maxAsyncReplications = 256
+
+// errHintsDisabled reports a hint this node has no store for.
+var errHintsDisabled = errors.New("hinted handoff is disabled on this node")
+
+// errUnreachable reports a peer that could not be contacted at all, as
+// opposed to one that answered with an error.
+var errUnreachable = errors.New("node unreachable")
+
+// storeHint queues a write for a replica that could not take it. Hints
+// kept by the coordinator do not count towards the write quorum; hints
+// kept by fallback nodes do under a sloppy quorum.
+func (s *HTTPServer) storeHint(nodeID ring.NodeID, key string, value *storage.VersionedValue) error {
+	if s.hints == nil {
+		return errHintsDisabled
+	}
+	err := s.hints.Add(hints.Hint{
+		Target:      string(nodeID),
+		Key:         key,
+		Value:       value.Value,
+		Version:     value.Version,
+		Timestamp:   value.Timestamp,
+		ExpiresAt:   value.ExpiresAt,
+		Tombstone:   value.Tombstone,
+		ContentType: value.ContentType,
+		Meta:        value.Meta,
+	})
+	if err != nil {
+		s.logger.Printf("failed to store hint for node %s for key: %s, error: %v\n", nodeID, key, err)
+		return err
+	}
+	s.metrics.Count("hints_stored", 1)
+	return nil
+}
+
+// writeToFallbacks continues the walk around the ring past the n nodes of
+// the preference list and asks live nodes to keep value as a hint for one
+// of the missed replicas each, until needed of them have. It returns how
+// many did.
+func (s *HTTPServer) writeToFallbacks(ctx context.Context, key string, value *storage.VersionedValue, n int, missed []ring.NodeID, needed int) int {
+	walk, walkErr := s.ring.GetPreferenceList(key, s.ring.Size())
+	if walkErr != nil {
+		return 0
+	}
+	written := 0
+	for _, nodeID := range walk[min(n, len(walk)):] {
+		if written >= needed || len(missed) == 0 {
+			break
+		}
+		if s.cluster.State(string(nodeID)) == membership.Dead {
+			continue
+		}
+		var err error
+		if nodeID == ring.NodeID(s.cfg.NodeID) {
+			err = s.storeHint(missed[0], key, value)
+		} else if address, ok := s.ring.GetNodeAddress(nodeID); !ok {
+			continue
+		} else if err = s.sendReplica(ctx, address, key, value, string(missed[0])); errors.Is(err, errUnreachable) {
+			s.cluster.MarkDead(string(nodeID))
+		}
+		if err != nil {
+			s.logger.Printf("failed to write hint for %s to fallback node %s for key: %s, error: %v\n", missed[0], nodeID, key, err)
+			continue
+		}
+		missed = missed[1:]
+		written++
+		s.metrics.Count("sloppy_writes", 1)
+	}
+	return written
+}
+
+// runHandoff delivers hints when events reports their target alive and
+// periodically probes dead peers, until stop is closed.
+func (s *HTTPServer) runHandoff(events <-chan membership.Event, stop <-chan struct{}) {
+	ticker := time.NewTicker(hintProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case ev := <-events:
+			// Outside the background windows the periodic retries deliver
+			if ev.State == membership.Alive && s.cfg.BackgroundWindows.Open(time.Now()) {
+				s.handOff(ring.NodeID(ev.NodeID))
+			}
+		case <-ticker.C:
+			s.probeDead()
+			if s.allowJob("handoff", time.Now()) {
+				s.handOffAll()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// probeDead marks dead peers that answer a ping alive again.
+func (s *HTTPServer) probeDead() {
+	for _, nodeID := range s.cluster.Dead() {
+		address, ok := s.ring.GetNodeAddress(ring.NodeID(nodeID))
+		if !ok {
+			continue
+		}
+		if s.ping(address) {
+			s.cluster.MarkAlive(nodeID)
+		}
+	}
+}
+
+// ping reports whether the peer at address answers.
+func (s *HTTPServer) ping(address string) bool {
+	return s.transport.Ping(context.Background(), address) == nil
+}
+
+// handOffAll drops expired hints and retries the hints of live targets,
+// covering targets whose alive event was missed or whose handoff failed.
+func (s *HTTPServer) handOffAll() {
+	if s.hints == nil {
+		return
+	}
+	if _, err := s.hints.Expire(); err != nil {
+		s.logger.Printf("failed to expire hints: %v\n", err)
+	}
+	for _, target := range s.hints.Targets() {
+		if s.cluster.State(target) == membership.Alive {
+			s.handOff(ring.NodeID(target))
+		}
+	}
+}
+
+// handOff delivers the hints queued for nodeID in order. A hint the target
+// already holds a newer version for is dropped; delivery stops at the
+// first other failure and resumes on a later attempt.
+func (s *HTTPServer) handOff(nodeID ring.NodeID) {
+	if s.hints == nil {
+		return
+	}
+	address, ok := s.ring.GetNodeAddress(nodeID)
+	if !ok {
+		return
+	}
+	for {
+		batch := s.hints.Peek(string(nodeID), hintReplayBatch)
+		delivered := 0
+		var through uint64
+		var err error
+		for _, h := range batch {
+			value := &storage.VersionedValue{Value: h.Value, Version: h.Version, Timestamp: h.Timestamp, ExpiresAt: h.ExpiresAt, Tombstone: h.Tombstone, ContentType: h.ContentType, Meta: h.Meta}
+			value.Seal()
+			if err = s.writeToRemoteNode(context.Background(), address, h.Key, value); errors.Is(err, storage.ErrStaleVersion) {
+				err = nil
+			}
+			if err != nil {
+				break
+			}
+			delivered++
+			through = h.Seq
+		}
+		if delivered > 0 {
+			if ackErr := s.hints.Ack(string(nodeID), through); ackErr != nil {
+				s.logger.Printf("failed to acknowledge hints for node %s: %v\n", nodeID, ackErr)
+				return
+			}
+			s.metrics.Count("hints_delivered", int64(delivered))
+			s.logger.Printf("handed off %d hints to node %s\n", delivered, nodeID)
+		}
+		if errors.Is(err, errUnreachable) {
+			s.cluster.MarkDead(string(nodeID))
+		}
+		if err != nil || len(batch) < hintReplayBatch {
+			return
+		}
+	}
+}
+
+// hintBacklog is how many hints are queued for all peers.
+func (s *HTTPServer) hintBacklog() int {
+	backlog := 0
+	for _, target := range s.hints.Targets() {
+		backlog += s.hints.Len(target)
+	}
+	return backlog
+}
+
+// handlePing answers liveness probes from peers.
+func (s *HTTPServer) handlePing(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// replicaWrite is the outcome of one replica write of a quorum write.
+type replicaWrite struct {
+	nodeID  ring.NodeID
+	address string
+	err     error
+}
+
+// finishInBackground hands the replica writes a quorum write did not wait
+// for to finishWrites, in one of at most maxAsyncReplications background
+// completions. With no slot free the writes are cancelled and every replica
+// that had not answered gets a hint instead, as handoff delivers it later.
+func (s *HTTPServer) finishInBackground(key string, value *storage.VersionedValue, results <-chan replicaWrite, pending int, statuses replicaStatuses, cancel context.CancelFunc) {
+	select {
+	case s.asyncSlots <- struct{}{}:
+	default:
+		cancel()
+		for nodeID, status := range statuses {
+			if status == replicaNoAnswer {
+				s.metrics.Count("async_replications_dropped", 1)
+				s.storeHint(nodeID, key, value)
+			}
+		}
+		return
+	}
+	go func() {
+		defer func() { <-s.asyncSlots }()
+		defer cancel()
+		s.finishWrites(key, value, results, pending)
+	}()
+}
+
+// finishWrites collects the replica writes a quorum write did not wait for,
+// so that all N replicas usually hold the value without waiting for read
+// repair. A replica that turned out to be unreachable gets a hint instead.
+func (s *HTTPServer) finishWrites(key string, value *storage.VersionedValue, results <-chan replicaWrite, pending int) {
+	for range pending {
+		result := <-results
+		if result.err == nil || errors.Is(result.err, storage.ErrStaleVersion) {
+			s.metrics.Count("async_replications", 1)
+			continue
+		}
+		s.metrics.Count("async_replication_failures", 1)
+		switch {
+		case errors.Is(result.err, errUnreachable):
+			s.cluster.MarkDead(string(result.nodeID))
+			s.storeHint(result.nodeID, key, value)
+		case errors.Is(result.err, context.DeadlineExceeded), errors.Is(result.err, errReplicaBusy):
+			// Slow rather than dead: leave membership alone but keep the
+			// write for handoff in case it never landed
+			s.storeHint(result.nodeID, key, value)
+		}
+		s.logger.Printf("failed to replicate to remote node %s for key: %s in the background, error: %v\n", result.address, key, result.err)
+	}
+}
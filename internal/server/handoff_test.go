@@ -0,0 +1,89 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/hints"
+	"github.com/amirderis/DHT/internal/membership"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestHintedHandoff(t *testing.T) {
+	a, b, c := startTestNode(t, "a"), startTestNode(t, "b"), startTestNode(t, "c")
+	a.cfg.ReplicationFactor = 3
+	store, err := hints.Open(t.TempDir(), hints.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to open hint store: %v", err)
+	}
+	a.hints = store
+	a.ring.JoinNode("b", "127.0.0.1:1", 1)
+	a.ring.JoinNode("c", c.cfg.BindAddr, 1)
+
+	// Pick a key that a writes to b before reaching its write quorum
+	var key string
+	for i := 0; ; i++ {
+		key = "key-" + strconv.Itoa(i)
+		if prefList, _ := a.ring.GetPreferenceList(key, 3); prefList[2] != "b" {
+			break
+		}
+	}
+	if _, err := a.put(t.Context(), key, []byte("value"), nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Failed to put with one replica down: %v", err)
+	}
+	if a.cluster.State("b") != membership.Dead || store.Len("b") != 1 {
+		t.Fatalf("Expected b to be marked dead with one hint, got %v and %d hints", a.cluster.State("b"), store.Len("b"))
+	}
+
+	stop := make(chan struct{})
+	go a.runHandoff(a.cluster.Subscribe(), stop)
+	t.Cleanup(func() { close(stop) })
+	if err := a.joinMember(api.Member{NodeID: "b", Address: b.cfg.BindAddr, Incarnation: 2}); err != nil {
+		t.Fatalf("Failed to rejoin b: %v", err)
+	}
+	waitFor(t, func() bool { return store.Len("b") == 0 })
+	if value, _ := b.storage.Get(key); string(value) != "value" {
+		t.Errorf("Expected the hint to be handed off to b, got %q", value)
+	}
+}
+
+func TestSloppyQuorum(t *testing.T) {
+	a, c := startTestNode(t, "a"), startTestNode(t, "c")
+	store, err := hints.Open(t.TempDir(), hints.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to open hint store: %v", err)
+	}
+	c.hints = store
+	a.ring.JoinNode("b", "127.0.0.1:1", 1)
+	a.ring.JoinNode("c", c.cfg.BindAddr, 1)
+
+	// Pick a key whose strict replicas are a and the down node b
+	var key string
+	for i := 0; ; i++ {
+		key = "key-" + strconv.Itoa(i)
+		if prefList, _ := a.ring.GetPreferenceList(key, 3); prefList[2] == "c" {
+			break
+		}
+	}
+	if _, err := a.put(t.Context(), key, []byte("value"), nil, 2, time.Time{}); err == nil {
+		t.Fatalf("Expected a strict quorum write to fail with b down")
+	}
+
+	a.cfg.SloppyQuorum = true
+	if _, err := a.put(withAckLevel(t.Context(), api.AckApplied), key, []byte("value"), nil, 2, time.Time{}); err == nil {
+		t.Fatalf("Expected a write counting only applied acks to fail with b down")
+	}
+	if queued := store.Peek("b", 10); len(queued) != 0 {
+		t.Errorf("Expected no hint on c for a write demanding applied acks, got %+v", queued)
+	}
+	if _, err := a.put(t.Context(), key, []byte("value"), nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Expected a sloppy quorum write to reach W through c: %v", err)
+	}
+	if queued := store.Peek("b", 10); len(queued) != 1 || queued[0].Key != key {
+		t.Errorf("Expected c to hold a hint for b, got %+v", queued)
+	}
+	if _, ok := c.storage.Get(key); ok {
+		t.Errorf("Expected the fallback to keep the write only as a hint")
+	}
+}
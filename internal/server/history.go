@@ -0,0 +1,218 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// The stats history keeps a sample of the node's counters every minute for
+// the last day and rolls them up hourly for the last month, so that an
+// incident can be looked into without an external metrics stack. It is
+// saved to cfg.DataDir, when set, after every sample.
+
+const (
+	// historyFile holds the stats history in the data directory.
+	historyFile = "stats-history.json"
+	// maxMinuteSamples and maxHourSamples bound the two resolutions.
+	maxMinuteSamples = 24 * 60
+	maxHourSamples   = 30 * 24
+
+	resolutionMinute = "minute"
+	resolutionHour   = "hour"
+)
+
+type statsHistory struct {
+	mu      sync.Mutex
+	Minutes []api.StatsSample `json:"minutes"`
+	Hours   []api.StatsSample `json:"hours"`
+
+	// last holds the counters of the previous sample; samples record the
+	// difference. It starts over with the process.
+	last     api.StatsSample
+	sampling bool
+}
+
+// sample records the minute ending at now from the cumulative counters in
+// totals. When now starts a new hour, the minutes of the previous one are
+// rolled up.
+func (h *statsHistory) sample(now time.Time, totals api.StatsSample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	last, sampling := h.last, h.sampling
+	h.last, h.sampling = totals, true
+	if !sampling {
+		return
+	}
+	minute := api.StatsSample{
+		Time:         now.Add(-statsHistoryInterval).Truncate(time.Minute).UTC(),
+		Requests:     totals.Requests - last.Requests,
+		ClientErrors: totals.ClientErrors - last.ClientErrors,
+		ServerErrors: totals.ServerErrors - last.ServerErrors,
+		ReadRepairs:  totals.ReadRepairs - last.ReadRepairs,
+		Evictions:    totals.Evictions - last.Evictions,
+		Keys:         totals.Keys,
+		Bytes:        totals.Bytes,
+	}
+	minute.QPS = float64(minute.Requests) / statsHistoryInterval.Seconds()
+	h.add(minute)
+}
+
+// add appends a minute sample, rolling up the previous hour first when the
+// sample starts a new one. Callers must hold h.mu.
+func (h *statsHistory) add(minute api.StatsSample) {
+	hour := minute.Time.Truncate(time.Hour)
+	if n := len(h.Minutes); n > 0 && h.Minutes[n-1].Time.Truncate(time.Hour).Before(hour) {
+		h.Hours = appendBounded(h.Hours, h.rollup(h.Minutes[n-1].Time.Truncate(time.Hour)), maxHourSamples)
+	}
+	h.Minutes = appendBounded(h.Minutes, minute, maxMinuteSamples)
+}
+
+// rollup summarizes the minute samples of the hour starting at hour.
+// Callers must hold h.mu.
+func (h *statsHistory) rollup(hour time.Time) api.StatsSample {
+	sum := api.StatsSample{Time: hour}
+	for _, m := range h.Minutes {
+		if m.Time.Truncate(time.Hour) != hour {
+			continue
+		}
+		sum.Requests += m.Requests
+		sum.ClientErrors += m.ClientErrors
+		sum.ServerErrors += m.ServerErrors
+		sum.ReadRepairs += m.ReadRepairs
+		sum.Evictions += m.Evictions
+		sum.Keys = max(sum.Keys, m.Keys)
+		sum.Bytes = max(sum.Bytes, m.Bytes)
+	}
+	sum.QPS = float64(sum.Requests) / time.Hour.Seconds()
+	return sum
+}
+
+func appendBounded[T any](items []T, item T, limit int) []T {
+	if len(items) >= limit {
+		items = append(items[:0], items[len(items)-limit+1:]...)
+	}
+	return append(items, item)
+}
+
+// query returns the samples of resolution starting at or after since.
+func (h *statsHistory) query(resolution string, since time.Time) []api.StatsSample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	samples := h.Minutes
+	if resolution == resolutionHour {
+		samples = h.Hours
+	}
+	out := make([]api.StatsSample, 0, len(samples))
+	for _, sample := range samples {
+		if !sample.Time.Before(since) {
+			out = append(out, sample)
+		}
+	}
+	return out
+}
+
+// loadHistory reads the history saved in dir; a missing file starts empty.
+func loadHistory(dir string) (*statsHistory, error) {
+	h := &statsHistory{}
+	data, err := os.ReadFile(filepath.Join(dir, historyFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return h, err
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return &statsHistory{}, fmt.Errorf("invalid stats history %s: %w", filepath.Join(dir, historyFile), err)
+	}
+	return h, nil
+}
+
+// save writes the history to dir through a temporary file so a crash never
+// leaves it truncated.
+func (h *statsHistory) save(dir string) error {
+	h.mu.Lock()
+	data, err := json.Marshal(h)
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, historyFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, historyFile))
+}
+
+// statsHistoryInterval is how often the stats history takes a sample.
+const statsHistoryInterval = time.Minute
+
+// runStatsHistory samples the stats every minute until stop is closed.
+func (s *HTTPServer) runStatsHistory(stop <-chan struct{}) {
+	ticker := time.NewTicker(statsHistoryInterval)
+	defer ticker.Stop()
+	s.sampleStats(time.Now())
+	for {
+		select {
+		case now := <-ticker.C:
+			s.sampleStats(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *HTTPServer) sampleStats(now time.Time) {
+	st := s.storage.Stats()
+	s.history.sample(now, api.StatsSample{
+		Requests:     s.stats.requests.Value(),
+		ClientErrors: s.stats.clientErrors.Value(),
+		ServerErrors: s.stats.serverErrors.Value(),
+		ReadRepairs:  s.stats.readRepairs.Value(),
+		Evictions:    s.storage.Evictions(),
+		Keys:         st.Keys,
+		Bytes:        st.Bytes,
+	})
+	if s.cfg.DataDir == "" {
+		return
+	}
+	if err := s.history.save(s.cfg.DataDir); err != nil {
+		s.logger.Printf("failed to save stats history: %v\n", err)
+	}
+}
+
+// handleStatsHistory serves GET /admin/stats/history?resolution=minute|hour&since=RFC3339.
+func (s *HTTPServer) handleStatsHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	resolution := r.URL.Query().Get("resolution")
+	if resolution == "" {
+		resolution = resolutionMinute
+	}
+	if resolution != resolutionMinute && resolution != resolutionHour {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("unexpected resolution %q (want %q or %q)", resolution, resolutionMinute, resolutionHour))
+		return
+	}
+	var since time.Time
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, raw); err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid since: "+raw)
+			return
+		}
+	}
+	s.writeJSON(w, api.StatsHistory{Resolution: resolution, Samples: s.history.query(resolution, since)})
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestStatsHistory(t *testing.T) {
+	dir := t.TempDir()
+	h := &statsHistory{}
+	start := time.Date(2024, 1, 8, 10, 58, 0, 0, time.UTC)
+	for i := range 4 {
+		h.sample(start.Add(time.Duration(i)*time.Minute), api.StatsSample{Requests: int64(60 * i), Keys: 10 - i})
+	}
+	minutes := h.query(resolutionMinute, time.Time{})
+	if len(minutes) != 3 || minutes[0].Time != start || minutes[0].Requests != 60 || minutes[0].QPS != 1 {
+		t.Fatalf("Expected 3 minute samples of 60 requests from 10:58, got %+v", minutes)
+	}
+	hours := h.query(resolutionHour, time.Time{})
+	if len(hours) != 1 || hours[0].Time != start.Truncate(time.Hour) || hours[0].Requests != 120 || hours[0].Keys != 9 {
+		t.Errorf("Expected 10:00 rolled up once 11:00 began, got %+v", hours)
+	}
+	if got := h.query(resolutionMinute, start.Add(time.Minute)); len(got) != 2 {
+		t.Errorf("Expected 2 samples since 10:59, got %d", len(got))
+	}
+
+	if err := h.save(dir); err != nil {
+		t.Fatalf("Failed to save history: %v", err)
+	}
+	loaded, err := loadHistory(dir)
+	if err != nil {
+		t.Fatalf("Failed to load history: %v", err)
+	}
+	if len(loaded.Minutes) != 3 || len(loaded.Hours) != 1 {
+		t.Errorf("Expected the history to survive a restart, got %d minutes and %d hours", len(loaded.Minutes), len(loaded.Hours))
+	}
+
+	s := newTestServer(t)
+	s.history = loaded
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/stats/history?resolution=hour", nil))
+	var resp api.StatsHistory
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || len(resp.Samples) != 1 {
+		t.Errorf("Expected one hourly sample, got %+v, %v", resp, err)
+	}
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/stats/history?resolution=day", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown resolution, got %d", rec.Code)
+	}
+}
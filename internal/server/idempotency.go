@@ -0,0 +1,207 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentReplayHeader marks a response replayed from an earlier request
+// with the same idempotency key.
+const idempotentReplayHeader = "Idempotent-Replayed"
+
+const (
+	// maxIdempotencyKeyBytes bounds the Idempotency-Key header.
+	maxIdempotencyKeyBytes = 255
+	// maxIdempotentResults bounds the results a coordinator remembers; past
+	// it the oldest are forgotten before they expire.
+	maxIdempotentResults = 10000
+	// maxIdempotentBody bounds the response body kept for a replay. Write
+	// responses are small; a larger one is not kept at all.
+	maxIdempotentBody = 64 << 10
+)
+
+// idempotencyKey scopes a client's idempotency key to the key it wrote,
+// so that keys chosen by different clients for different keys never meet.
+type idempotencyKey struct {
+	key   string
+	token string
+}
+
+// idempotentResult is the response to the first request with an
+// idempotency key. done is closed once the request has finished; until then
+// retries wait for it rather than running alongside.
+type idempotentResult struct {
+	id        idempotencyKey
+	method    string
+	done      chan struct{}
+	status    int
+	header    http.Header
+	body      []byte
+	kept      bool
+	expiresAt time.Time
+}
+
+// idempotencyCache remembers the outcome of recent writes by idempotency
+// key, oldest first.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	results map[idempotencyKey]*idempotentResult
+	order   []*idempotentResult
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{ttl: ttl, results: make(map[idempotencyKey]*idempotentResult)}
+}
+
+// begin returns the result recorded for id, or registers a new one that the
+// caller then owns and must finish.
+func (c *idempotencyCache) begin(id idempotencyKey, method string, now time.Time) (*idempotentResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if res, ok := c.results[id]; ok && now.Before(res.expiresAt) {
+		return res, false
+	}
+	c.trim(now, maxIdempotentResults-1)
+	res := &idempotentResult{id: id, method: method, done: make(chan struct{}), expiresAt: now.Add(c.ttl)}
+	c.results[id] = res
+	c.order = append(c.order, res)
+	return res, true
+}
+
+// finish records the response to res, or forgets res when the response is
+// not worth replaying, and releases any retries waiting for it.
+func (c *idempotencyCache) finish(res *idempotentResult, status int, header http.Header, body []byte, keep bool) {
+	c.mu.Lock()
+	res.status, res.header, res.body, res.kept = status, header, body, keep
+	if !keep && c.results[res.id] == res {
+		delete(c.results, res.id)
+	}
+	c.mu.Unlock()
+	close(res.done)
+}
+
+// reap forgets expired results and returns how many were forgotten.
+func (c *idempotencyCache) reap(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.trim(now, maxIdempotentResults)
+}
+
+// trim forgets expired results, then the oldest until at most limit remain.
+// A request still running when its result is forgotten finishes as usual,
+// but its retries run again.
+func (c *idempotencyCache) trim(now time.Time, limit int) int {
+	removed := 0
+	for len(c.order) > 0 {
+		res := c.order[0]
+		if c.results[res.id] == res {
+			if len(c.results) <= limit && now.Before(res.expiresAt) {
+				break
+			}
+			delete(c.results, res.id)
+			removed++
+		}
+		c.order[0] = nil
+		c.order = c.order[1:]
+	}
+	return removed
+}
+
+// keepsResponse reports whether a response with status settles the write.
+// Server errors, timeouts and rate limiting say nothing about whether the
+// write happened, so a retry after one runs again.
+func keepsResponse(status int) bool {
+	return status < http.StatusInternalServerError && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests
+}
+
+// idempotent runs a PUT or DELETE of key at most once per idempotency key
+// within the configured TTL. A retry gets the original response, marked with
+// Idempotent-Replayed, instead of writing a new version; a retry that
+// arrives while the original is still running waits for it. Reusing an
+// idempotency key for a different method of the same key is refused.
+func (s *HTTPServer) idempotent(w http.ResponseWriter, r *http.Request, key, token string, handle func(http.ResponseWriter)) {
+	if len(token) > maxIdempotencyKeyBytes {
+		s.writeError(w, http.StatusBadRequest, "invalid "+idempotencyKeyHeader+": longer than 255 bytes")
+		return
+	}
+	id := idempotencyKey{key: key, token: token}
+	for {
+		res, owner := s.idempotency.begin(id, r.Method, time.Now())
+		if owner {
+			rec := &recordingWriter{ResponseWriter: w}
+			handle(rec)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			keep := keepsResponse(rec.status) && !rec.overflow
+			s.idempotency.finish(res, rec.status, rec.header, rec.body.Bytes(), keep)
+			return
+		}
+		if res.method != r.Method {
+			s.writeError(w, http.StatusUnprocessableEntity, idempotencyKeyHeader+" "+token+" was already used for a "+res.method+" of this key")
+			return
+		}
+		select {
+		case <-res.done:
+		case <-r.Context().Done():
+			s.writeError(w, http.StatusServiceUnavailable, "request canceled while waiting for the original request with this "+idempotencyKeyHeader)
+			return
+		}
+		if !res.kept {
+			// The original failed in a way that settles nothing; run
+			// this one instead
+			continue
+		}
+		s.stats.idempotentReplays.Add(1)
+		s.metrics.Count("idempotent_replays", 1)
+		for name, values := range res.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set(idempotentReplayHeader, "true")
+		w.WriteHeader(res.status)
+		_, _ = w.Write(res.body)
+		return
+	}
+}
+
+// recordingWriter passes a response through while keeping a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+		w.header = w.Header().Clone()
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.overflow {
+		if w.body.Len()+len(p) > maxIdempotentBody {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
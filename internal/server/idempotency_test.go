@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	s := newTestServer(t)
+	send := func(method, key, value, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/kv/"+key, strings.NewReader(value))
+		if token != "" {
+			req.Header.Set(idempotencyKeyHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	version := func(rec *httptest.ResponseRecorder) string {
+		var response api.PutResponse
+		json.NewDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(&response)
+		return fmt.Sprint(response.Version)
+	}
+
+	first := send(http.MethodPut, "order", "v1", "put-1")
+	if first.Code != http.StatusOK || first.Header().Get(idempotentReplayHeader) != "" {
+		t.Fatalf("Expected the first write to run, got %d %v", first.Code, first.Header())
+	}
+	retry := send(http.MethodPut, "order", "v1", "put-1")
+	if retry.Code != http.StatusOK || retry.Header().Get(idempotentReplayHeader) != "true" {
+		t.Fatalf("Expected the retry replayed, got %d %v", retry.Code, retry.Header())
+	}
+	if version(retry) != version(first) || retry.Header().Get(sessionHeader) != first.Header().Get(sessionHeader) {
+		t.Errorf("Expected the original response, got %s after %s", retry.Body.String(), first.Body.String())
+	}
+	if stored, _ := s.versions.GetVersioned("order"); fmt.Sprint(map[string]uint64(stored.Version)) != version(first) {
+		t.Errorf("Expected the retry to leave the version alone, got %v", stored.Version)
+	}
+	if got := s.stats.idempotentReplays.Value(); got != 1 {
+		t.Errorf("Expected 1 replay counted, got %d", got)
+	}
+
+	// The same token for another key, or without a token, writes again
+	if rec := send(http.MethodPut, "other", "v1", "put-1"); rec.Header().Get(idempotentReplayHeader) != "" {
+		t.Errorf("Expected a token to be scoped to its key, got %v", rec.Header())
+	}
+	if rec := send(http.MethodPut, "order", "v2", ""); version(rec) == version(first) {
+		t.Errorf("Expected a write without a token to bump the version, got %s", rec.Body.String())
+	}
+
+	// Reusing a token for a delete is refused
+	if rec := send(http.MethodDelete, "order", "", "put-1"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a reused token, got %d", rec.Code)
+	}
+	if rec := send(http.MethodDelete, "order", "", "delete-1"); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected the delete to run, got %d", rec.Code)
+	}
+	if rec := send(http.MethodDelete, "order", "", "delete-1"); rec.Code != http.StatusNoContent || rec.Header().Get(idempotentReplayHeader) != "true" {
+		t.Errorf("Expected the delete replayed, got %d %v", rec.Code, rec.Header())
+	}
+
+	// A write that settles nothing is not remembered
+	id := idempotencyKey{key: "order", token: "failed-1"}
+	res, _ := s.idempotency.begin(id, http.MethodPut, time.Now())
+	s.idempotency.finish(res, http.StatusServiceUnavailable, nil, nil, keepsResponse(http.StatusServiceUnavailable))
+	if _, owner := s.idempotency.begin(id, http.MethodPut, time.Now()); !owner {
+		t.Errorf("Expected a retry after a 503 to run again")
+	}
+	if rec := send(http.MethodPut, "order", "v", strings.Repeat("t", maxIdempotencyKeyBytes+1)); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an overlong token, got %d", rec.Code)
+	}
+	s.idempotency.reap(time.Now().Add(s.cfg.IdempotencyTTL))
+	if rec := send(http.MethodPut, "order", "v1", "put-1"); rec.Header().Get(idempotentReplayHeader) != "" {
+		t.Errorf("Expected the token forgotten after its TTL, got %v", rec.Header())
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// Heavy background jobs, such as hint replay and chunk cleanup, run at full
+// rate inside cfg.BackgroundWindows and are throttled outside them so that
+// they stay out of the way of client traffic during business hours.
+
+// jobThrottle counts the scheduled ticks of each job outside the windows.
+type jobThrottle struct {
+	mu    sync.Mutex
+	ticks map[string]int
+}
+
+// allowJob reports whether the job may run on its tick at now: always
+// inside the background windows, and on one tick in cfg.BackgroundThrottle
+// outside them.
+func (s *HTTPServer) allowJob(job string, now time.Time) bool {
+	if s.cfg.BackgroundWindows.Open(now) {
+		return true
+	}
+	s.jobs.mu.Lock()
+	defer s.jobs.mu.Unlock()
+	if s.jobs.ticks == nil {
+		s.jobs.ticks = make(map[string]int)
+	}
+	tick := s.jobs.ticks[job]
+	s.jobs.ticks[job] = tick + 1
+	if s.cfg.BackgroundThrottle > 0 && tick%s.cfg.BackgroundThrottle == 0 {
+		return true
+	}
+	s.metrics.Count("background_jobs_deferred", 1)
+	return false
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/schedule"
+)
+
+func TestBackgroundWindows(t *testing.T) {
+	s := newTestServer(t)
+	windows, err := schedule.ParseAll([]string{"01:00-05:00"})
+	if err != nil {
+		t.Fatalf("Failed to parse windows: %v", err)
+	}
+	s.cfg.BackgroundWindows = windows
+	s.cfg.BackgroundThrottle = 3
+
+	night := time.Date(2024, 1, 8, 3, 0, 0, 0, time.Local)
+	day := time.Date(2024, 1, 8, 12, 0, 0, 0, time.Local)
+	if !s.allowJob("handoff", night) || !s.allowJob("handoff", night) {
+		t.Errorf("Expected jobs to run on every tick inside a window")
+	}
+	var runs []bool
+	for range 4 {
+		runs = append(runs, s.allowJob("handoff", day))
+	}
+	if !slices.Equal(runs, []bool{true, false, false, true}) {
+		t.Errorf("Expected jobs to run on one tick in 3 outside the windows, got %v", runs)
+	}
+
+	s.cfg.BackgroundThrottle = 0
+	if s.allowJob("chunk_cleanup", day) {
+		t.Errorf("Expected jobs to pause outside the windows without a throttle")
+	}
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func (s *HTTPServer) self() api.Member {
+	return api.Member{NodeID: s.cfg.NodeID, Address: s.cfg.BindAddr, Incarnation: s.incarnation, Placement: s.ring.Fingerprint(), Meta: s.localMeta()}
+}
+
+// localMeta is the membership metadata this node announces.
+func (s *HTTPServer) localMeta() map[string]string {
+	meta := map[string]string{api.MetaCodecs: s.codecs.advertised()}
+	if s.cfg.Datacenter != "" {
+		meta[api.MetaDatacenter] = s.cfg.Datacenter
+	}
+	return meta
+}
+
+// memberMeta is the membership metadata nodeID announced.
+func (s *HTTPServer) memberMeta(nodeID string) map[string]string {
+	if nodeID == s.cfg.NodeID {
+		return s.localMeta()
+	}
+	return s.cluster.Meta(nodeID)
+}
+
+// announce tells every seed about this incarnation, adds the seeds to the
+// ring from their replies and copies their namespaces. A restarted node is accepted under its old ID.
+func (s *HTTPServer) announce(stop <-chan struct{}) {
+	for _, seed := range s.cfg.Seeds {
+		peer, err := s.sendJoin(seed)
+		var throttled *joinThrottledError
+		for errors.As(err, &throttled) {
+			// Jitter spreads out the nodes the seed turned away together
+			wait := throttled.retryAfter + rand.N(throttled.retryAfter/2+1)
+			s.logger.Printf("seed %s throttled the join, retrying in %v\n", seed, wait)
+			select {
+			case <-time.After(wait):
+			case <-stop:
+				return
+			}
+			peer, err = s.sendJoin(seed)
+		}
+		if err == nil {
+			err = s.checkPlacement(peer)
+		}
+		if err != nil {
+			s.logger.Printf("failed to announce to seed %s: %v\n", seed, err)
+			continue
+		}
+		if err := s.joinMember(peer); err != nil {
+			s.logger.Printf("failed to add seed %s: %v\n", seed, err)
+		}
+		if err := s.syncNamespaces(seed); err != nil {
+			s.logger.Printf("failed to copy namespaces from seed %s: %v\n", seed, err)
+		}
+	}
+}
+
+func (s *HTTPServer) sendJoin(address string) (api.Member, error) {
+	return s.transport.Join(context.Background(), address, s.self())
+}
+
+// joinMember records a member in the ring. When a known node comes back on a
+// new address, pooled connections are closed so no request reuses a
+// connection to the old process.
+func (s *HTTPServer) joinMember(m api.Member) error {
+	if m.NodeID == s.cfg.NodeID && m.Incarnation != s.incarnation {
+		return fmt.Errorf("node id %s is already in use by incarnation %d", m.NodeID, m.Incarnation)
+	}
+	previous, err := s.ring.JoinNode(ring.NodeID(m.NodeID), m.Address, m.Incarnation)
+	if err != nil {
+		return err
+	}
+	s.cluster.MarkAlive(m.NodeID)
+	if previous != "" {
+		s.logger.Printf("node %s moved from %s to %s\n", m.NodeID, previous, m.Address)
+		s.transport.Forget(previous)
+	}
+	if len(m.Meta) > 0 {
+		// A member listed without metadata keeps what it announced itself
+		s.cluster.SetMeta(m.NodeID, m.Meta)
+	}
+	if codecs, ok := m.Meta[api.MetaCodecs]; ok {
+		// Members listed by a peer may not carry their codecs; the
+		// member's next response advertises them anyway
+		s.codecs.learn(m.Address, codecs)
+	}
+	return nil
+}
+
+// handleInternalJoin accepts a peer announcement and replies with this node's identity.
+func (s *HTTPServer) handleInternalJoin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	var m api.Member
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil || m.NodeID == "" || m.Address == "" {
+		s.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	wait, err := s.admitMember(m)
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+		s.writeError(w, http.StatusServiceUnavailable, "too many nodes joining, retry later")
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	s.writeJSON(w, s.self())
+}
+
+// admitMember records a member that announced itself, unless it places
+// keys differently or the join stagger turns it away for the returned wait.
+func (s *HTTPServer) admitMember(m api.Member) (time.Duration, error) {
+	if err := s.checkPlacement(m); err != nil {
+		return 0, err
+	}
+	if _, known := s.ring.GetNodeAddress(ring.NodeID(m.NodeID)); !known && s.cfg.JoinStagger > 0 {
+		// Only new members take over ranges; restarted ones keep their vnodes
+		if wait := s.joins.admit(time.Now(), s.cfg.JoinStagger); wait > 0 {
+			return wait, nil
+		}
+	}
+	return 0, s.joinMember(m)
+}
+
+// checkPlacement refuses a member whose placement fingerprint differs from
+// this node's: the two would disagree on the replicas of every key, and
+// each would read and write where the other never looks.
+func (s *HTTPServer) checkPlacement(m api.Member) error {
+	if mine := s.ring.Fingerprint(); m.Placement != mine {
+		return fmt.Errorf("node %s places keys with fingerprint %q, not %q as this cluster does", m.NodeID, m.Placement, mine)
+	}
+	return nil
+}
+
+// retryAfterSeconds rounds wait up to the whole seconds of a Retry-After.
+func retryAfterSeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
+
+// joinGate spaces out the new members a seed admits into the ring.
+type joinGate struct {
+	mu   sync.Mutex
+	next time.Time // earliest time the next new member is admitted
+}
+
+// admit reserves an activation slot, or returns how long until one frees up.
+func (g *joinGate) admit(now time.Time, stagger time.Duration) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if wait := g.next.Sub(now); wait > 0 {
+		return wait
+	}
+	g.next = now.Add(stagger)
+	return 0
+}
+
+// joinThrottledError is returned by sendJoin when a seed asks to retry later.
+type joinThrottledError struct {
+	retryAfter time.Duration
+}
+
+func (e *joinThrottledError) Error() string {
+	return fmt.Sprintf("join throttled, retry in %v", e.retryAfter)
+}
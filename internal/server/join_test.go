@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/internal/ring"
+)
+
+func TestJoinStagger(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.JoinStagger = time.Minute
+
+	join := func(id string) *httptest.ResponseRecorder {
+		body := `{"node_id":"` + id + `","address":"127.0.0.1:1","incarnation":1,"placement":"` + s.ring.Fingerprint() + `"}`
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/internal/join", strings.NewReader(body)))
+		return rec
+	}
+	if rec := join("n1"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the first new member to be admitted, got %d", rec.Code)
+	}
+	rec := join("n2")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected the second new member to be told to retry in 60s, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := join("n1"); rec.Code != http.StatusOK {
+		t.Errorf("Expected a known member to re-announce freely, got %d", rec.Code)
+	}
+	if s.ring.Size() != 2 {
+		t.Errorf("Expected only n1 to join the ring, got %d nodes", s.ring.Size())
+	}
+}
+
+func TestJoinPlacement(t *testing.T) {
+	a := startTestNode(t, "a")
+	b, _ := startTestNodeWith(t, "b", func(cfg *config.Config) { cfg.Seeds = []string{a.cfg.BindAddr} })
+	b.ring = ring.New(vnodesPerNode * 2)
+	b.ring.JoinNode("b", b.cfg.BindAddr, b.incarnation)
+
+	// Each side refuses the other, as they place keys differently
+	if _, err := a.admitMember(b.self()); err == nil {
+		t.Error("Expected a member with another placement fingerprint to be refused")
+	}
+	b.announce(nil)
+	if _, ok := a.ring.GetNodeAddress("b"); ok {
+		t.Error("Expected the seed not to admit b")
+	}
+	if _, ok := b.ring.GetNodeAddress("a"); ok {
+		t.Error("Expected b not to add the seed")
+	}
+
+	member := a.self()
+	member.NodeID, member.Address = "c", "127.0.0.1:1"
+	if _, err := a.admitMember(member); err != nil {
+		t.Errorf("Expected a member with the same fingerprint to be admitted, got %v", err)
+	}
+}
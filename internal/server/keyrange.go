@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/cursor"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// A range scan walks the keys in key order, which the ring scatters over
+// every node: GET /kv/?start=a&end=b&limit=n asks every node for its first
+// n keys in [a, b) and merges the copies of each key by version. A node
+// that stopped at n may hold more keys before the end of the range than
+// the page shows, so the page ends at the smallest last key of such a node
+// and the cursor continues after the last key the coordinator resolved.
+// Cursors hold nothing on the nodes and never expire, so a range can be
+// resumed across restarts and topology changes. With prefix=p the
+// scan only covers keys starting with p, and with values=false the nodes
+// list keys and versions without sending their values.
+
+// handleKeyRange serves GET /kv/, one page of the keys in a range.
+func (s *HTTPServer) handleKeyRange(w http.ResponseWriter, r *http.Request) {
+	if err := s.checkBootstrapped(); err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	query := r.URL.Query()
+	limit := defaultScanPageSize
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > maxBatchKeys {
+			s.writeError(w, http.StatusBadRequest, "invalid limit: "+raw)
+			return
+		}
+		limit = n
+	}
+	start, end := query.Get("start"), query.Get("end")
+	withValues := true
+	if raw := query.Get("values"); raw != "" {
+		var err error
+		if withValues, err = strconv.ParseBool(raw); err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid values: "+raw)
+			return
+		}
+	}
+	var resume *cursor.Cursor
+	if raw := query.Get("cursor"); raw != "" {
+		c, err := cursor.Decode(cursor.Range, raw)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		resume = &c
+	}
+	ctx, cancel, err := s.requestContext(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer cancel()
+
+	req := api.KeyRangeRequest{Prefix: tenantKey(ctx, query.Get("prefix")), Start: tenantKey(ctx, start), Limit: limit, KeysOnly: !withValues}
+	if resume != nil {
+		req.Start = tenantKey(ctx, resume.Key) + "\x00"
+	}
+	if err := s.checkNamespace(req.Prefix); err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	if end != "" {
+		req.End = tenantKey(ctx, end)
+	}
+	items, next, err := s.scanKeyRange(ctx, req)
+	if err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	response := api.KeyRangeResponse{Items: make([]api.ScanItem, 0, len(items))}
+	for _, item := range items {
+		value := item.Value
+		if isManifest(value) {
+			if value, err = s.getChunked(ctx, item.Key, value, 1); err != nil {
+				s.writeOpError(w, err)
+				return
+			}
+		}
+		response.Items = append(response.Items, api.ScanItem{Key: clientKey(ctx, item.Key), Value: value, ExpiresAt: item.ExpiresAt, Version: item.Version})
+	}
+	if next != "" {
+		response.Cursor = cursor.Cursor{Listing: cursor.Range, Key: clientKey(ctx, strings.TrimSuffix(next, "\x00"))}.Encode()
+	}
+	s.writeJSON(w, response)
+}
+
+// scanKeyRange gathers the listings of req from every node and returns the
+// newest version of each live key in order, with the start of the next
+// page or "" when the range is exhausted. It fails if no replica of some
+// token range answered, as the keys of that range would be missing.
+func (s *HTTPServer) scanKeyRange(ctx context.Context, req api.KeyRangeRequest) ([]api.ReplicateGetResponse, string, error) {
+	listings := make(map[ring.NodeID]api.KeyRangeListing)
+	nodes := s.ring.GetNodes()
+	statuses := make(replicaStatuses, len(nodes))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for nodeID, address := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var listing api.KeyRangeListing
+			if nodeID == ring.NodeID(s.cfg.NodeID) {
+				listing = s.localKeyRange(req)
+			} else {
+				var err error
+				listing, err = s.transport.Scan(ctx, address, req)
+				if err != nil {
+					s.logger.Printf("failed to scan keys of node %s: %v\n", nodeID, err)
+					mu.Lock()
+					statuses[nodeID] = replicaDead
+					if ctx.Err() != nil {
+						statuses[nodeID] = replicaNoAnswer
+					}
+					mu.Unlock()
+					return
+				}
+			}
+			mu.Lock()
+			listings[nodeID] = listing
+			statuses[nodeID] = replicaOK
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, tr := range s.ring.Ranges() {
+		replicas, err := s.ring.RangeReplicas(tr, s.cfg.ReplicationFactor)
+		if err != nil {
+			return nil, "", &opError{http.StatusServiceUnavailable, err.Error()}
+		}
+		if !slices.ContainsFunc(replicas, func(id ring.NodeID) bool { return statuses[id] == replicaOK }) {
+			return nil, "", s.quorumError(ctx, req.Start, statuses, &opError{http.StatusServiceUnavailable, "no replica answered for part of the key range"})
+		}
+	}
+
+	// Keys past the last key of a node that stopped at the limit may be
+	// missing copies, so they wait for the next page.
+	var bound string
+	bounded := false
+	reads := make(map[string][]replicaRead)
+	for nodeID, listing := range listings {
+		if listing.Next != "" && (!bounded || listing.Next < bound) {
+			bound, bounded = listing.Next, true
+		}
+		for _, item := range listing.Items {
+			reads[item.Key] = append(reads[item.Key], replicaRead{nodeID, item})
+		}
+	}
+	keys := make([]string, 0, len(reads))
+	for key := range reads {
+		if !bounded || key <= bound {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	now := time.Now()
+	items := make([]api.ReplicateGetResponse, 0, req.Limit)
+	for _, key := range keys {
+		newest := newestRead(reads[key])
+		if !newest.Found || newest.Tombstone || (!newest.ExpiresAt.IsZero() && !now.Before(newest.ExpiresAt)) {
+			continue
+		}
+		newest.Key = key
+		items = append(items, newest)
+		if len(items) == req.Limit {
+			// The smallest key after key
+			return items, key + "\x00", nil
+		}
+	}
+	if bounded {
+		return items, bound + "\x00", nil
+	}
+	return items, "", nil
+}
+
+// localKeyRange lists this node's copies of the keys req covers, leaving
+// out chunks of chunked values.
+func (s *HTTPServer) localKeyRange(req api.KeyRangeRequest) api.KeyRangeListing {
+	listing := api.KeyRangeListing{Items: []api.ReplicateGetResponse{}}
+	add := func(key string) {
+		if chunkKeyPattern.MatchString(key) {
+			return
+		}
+		if read, _ := s.localCopy(key); read.Found || read.Tombstone {
+			if req.KeysOnly {
+				read.Value, read.Checksum = nil, 0
+			}
+			listing.Items = append(listing.Items, read)
+		}
+	}
+	from := max(req.Start, req.Prefix)
+	limit := req.Limit
+	if from != "" && strings.HasPrefix(from, req.Prefix) && (req.End == "" || from < req.End) {
+		// Scan continues strictly after its cursor, so from is read on its own
+		if _, ok := s.versions.GetVersioned(from); ok {
+			add(from)
+			limit--
+		}
+	}
+	if limit <= 0 {
+		listing.Next = from
+		return listing
+	}
+	entries, next := s.versions.Scan(req.Prefix, from, limit)
+	for _, entry := range entries {
+		if req.End != "" && entry.Key >= req.End {
+			return listing
+		}
+		add(entry.Key)
+	}
+	listing.Next = next
+	return listing
+}
+
+// handleInternalScan serves a replica's listing of a key range.
+func (s *HTTPServer) handleInternalScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	query := r.URL.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		s.writeError(w, http.StatusBadRequest, "invalid limit: "+query.Get("limit"))
+		return
+	}
+	keysOnly, _ := strconv.ParseBool(query.Get("keys_only"))
+	s.writeJSON(w, s.localKeyRange(api.KeyRangeRequest{Prefix: query.Get("prefix"), Start: query.Get("start"), End: query.Get("end"), Limit: limit, KeysOnly: keysOnly}))
+}
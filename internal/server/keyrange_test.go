@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestKeyRangeScan(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k6", "k7", "k9", "x1"} {
+		if _, err := a.put(t.Context(), key, []byte("v"+key[1:]), nil, 2, time.Time{}); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+	if err := a.delete(t.Context(), "k4", 2); err != nil {
+		t.Fatalf("Failed to delete k4: %v", err)
+	}
+	// b alone holds k5 and a newer k3
+	b.versions.PutVersioned("k5", storage.NewVersionedValue([]byte("v5"), clock.VectorClock{"b": 1}))
+	b.versions.PutVersioned("k3", storage.NewVersionedValue([]byte("v3 again"), clock.VectorClock{"a": 5, "b": 5}))
+
+	scan := func(query string) api.KeyRangeResponse {
+		t.Helper()
+		resp, err := http.Get("http://" + a.cfg.BindAddr + "/kv/?" + query)
+		if err != nil {
+			t.Fatalf("Failed to scan: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		var page api.KeyRangeResponse
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatalf("Failed to decode page: %v", err)
+		}
+		return page
+	}
+
+	var keys, values []string
+	query := "start=k2&end=k9&limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatalf("Expected the scan to end, got keys %v", keys)
+		}
+		page := scan(query)
+		for _, item := range page.Items {
+			keys = append(keys, item.Key)
+			values = append(values, string(item.Value))
+		}
+		if page.Cursor == "" {
+			break
+		}
+		query = "end=k9&limit=2&cursor=" + page.Cursor
+	}
+	if want := []string{"k2", "k3", "k5", "k6", "k7"}; !slices.Equal(keys, want) {
+		t.Errorf("Expected keys %v, got %v", want, keys)
+	}
+	if want := []string{"v2", "v3 again", "v5", "v6", "v7"}; !slices.Equal(values, want) {
+		t.Errorf("Expected values %v, got %v", want, values)
+	}
+
+	if page := scan("limit=100"); len(page.Items) != 8 || page.Cursor != "" {
+		t.Errorf("Expected all 8 live keys on one page, got %+v", page)
+	}
+	page := scan("prefix=k&values=false")
+	if len(page.Items) != 7 || page.Cursor != "" {
+		t.Fatalf("Expected the 7 live keys under k, got %+v", page)
+	}
+	for _, item := range page.Items {
+		if !strings.HasPrefix(item.Key, "k") || item.Value != nil || len(item.Version) == 0 {
+			t.Errorf("Expected a key under k with a version and no value, got %+v", item)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Peers share a replica's capacity with its clients. Replica reads and
+// writes (/internal/storage and the gRPC Replica service) and bulk
+// transfers (/internal/batch and the range listings of anti-entropy) each
+// run under their own bound on concurrent requests, so that a repair storm
+// from peers cannot take the goroutines, memory and storage bandwidth the
+// public API needs. The public API is not bounded here. A request over its
+// bound is turned away at once with 503 rather than queued; the peer keeps
+// what it meant to send as a hint, or repairs it on its next pass. Range
+// listings are also bounded per peer, so that nodes joining together each
+// get a share of the transfer slots rather than the first to ask taking
+// all of them.
+
+// errReplicaBusy reports a peer that turned a request away because it was
+// serving as many internal requests as it allows.
+var errReplicaBusy = errors.New("replica busy")
+
+// concurrencyLimit bounds how many requests of one class run at once.
+type concurrencyLimit struct {
+	name  string
+	slots chan struct{}
+}
+
+func newConcurrencyLimit(name string, n int) *concurrencyLimit {
+	return &concurrencyLimit{name: name, slots: make(chan struct{}, n)}
+}
+
+// tryAcquire takes a slot if one is free.
+func (l *concurrencyLimit) tryAcquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *concurrencyLimit) release() {
+	<-l.slots
+}
+
+// limit rejects requests with 503 while l has no free slot.
+func (s *HTTPServer) limit(l *concurrencyLimit, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !l.tryAcquire() {
+			w.Header().Set("Retry-After", "1")
+			s.writeError(w, http.StatusServiceUnavailable, s.reject(l))
+			return
+		}
+		defer l.release()
+		next(w, r)
+	}
+}
+
+// peerLimit bounds how many requests of one class each peer runs at once.
+type peerLimit struct {
+	name    string
+	n       int
+	mu      sync.Mutex
+	running map[string]int // requests in progress by peer host
+}
+
+func newPeerLimit(name string, n int) *peerLimit {
+	return &peerLimit{name: name, n: n, running: make(map[string]int)}
+}
+
+// tryAcquire takes one of source's slots if one is free.
+func (l *peerLimit) tryAcquire(source string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running[source] >= l.n {
+		return false
+	}
+	l.running[source]++
+	return true
+}
+
+func (l *peerLimit) release(source string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running[source]--; l.running[source] <= 0 {
+		delete(l.running, source)
+	}
+}
+
+// sourceHost is the host a peer connected from, without the port that
+// differs between its connections.
+func sourceHost(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// limitPeer rejects requests with 503 while their peer has no free slot in l.
+func (s *HTTPServer) limitPeer(l *peerLimit, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		source := sourceHost(r.RemoteAddr)
+		if !l.tryAcquire(source) {
+			w.Header().Set("Retry-After", "1")
+			s.writeError(w, http.StatusServiceUnavailable, s.rejectPeer(l, source))
+			return
+		}
+		defer l.release(source)
+		next(w, r)
+	}
+}
+
+// acquirePeerRPC is the gRPC counterpart of limitPeer; the caller releases
+// the returned source's slot in l when it returns nil.
+func (s *HTTPServer) acquirePeerRPC(ctx context.Context, l *peerLimit) (string, error) {
+	var source string
+	if p, ok := peer.FromContext(ctx); ok {
+		source = sourceHost(p.Addr.String())
+	}
+	if !l.tryAcquire(source) {
+		return "", status.Error(codes.ResourceExhausted, s.rejectPeer(l, source))
+	}
+	return source, nil
+}
+
+// acquireRPC is the gRPC counterpart of limit, answering ResourceExhausted
+// so that peers can tell it from an unreachable node; the caller releases
+// l when it returns nil.
+func (s *HTTPServer) acquireRPC(l *concurrencyLimit) error {
+	if !l.tryAcquire() {
+		return status.Error(codes.ResourceExhausted, s.reject(l))
+	}
+	return nil
+}
+
+// reject counts a request l turned away and describes why.
+func (s *HTTPServer) reject(l *concurrencyLimit) string {
+	s.metrics.Count(l.name+"_rejected", 1)
+	return fmt.Sprintf("%v: %d %s requests in progress", errReplicaBusy, cap(l.slots), l.name)
+}
+
+// rejectPeer counts a request l turned away from source and describes why.
+func (s *HTTPServer) rejectPeer(l *peerLimit, source string) string {
+	s.metrics.Count(l.name+"_rejected", 1)
+	return fmt.Sprintf("%v: %d %s requests in progress from %s", errReplicaBusy, l.n, l.name, source)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/hints"
+	"github.com/amirderis/DHT/internal/membership"
+)
+
+func TestInternalConcurrencyLimits(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	store, err := hints.Open(t.TempDir(), hints.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to open hint store: %v", err)
+	}
+	a.hints = store
+
+	fill := func(l *concurrencyLimit) {
+		for l.tryAcquire() {
+		}
+	}
+	drain := func(l *concurrencyLimit) {
+		for range len(l.slots) {
+			l.release()
+		}
+	}
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	// A busy transfer limit leaves replica requests and the public API alone
+	fill(b.transferLimit)
+	if rec := serve(http.MethodPost, "/internal/batch", `{"items":[]}`); rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected a busy batch write to get 503 with Retry-After, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/internal/range?start=0&end=0", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a busy range listing to get 503, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/internal/storage/missing", ""); rec.Code == http.StatusServiceUnavailable {
+		t.Errorf("Expected replica reads to be unaffected by the transfer limit")
+	}
+	if rec := serve(http.MethodGet, "/kv/missing", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the public API to be unaffected, got %d", rec.Code)
+	}
+	drain(b.transferLimit)
+	if rec := serve(http.MethodGet, "/internal/range?start=0&end=0", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected range listings to be served again, got %d", rec.Code)
+	}
+
+	// A peer with as many range listings in progress as it may have waits,
+	// while other peers are still served
+	busy := sourceHost(httptest.NewRequest(http.MethodGet, "/", nil).RemoteAddr)
+	for b.peerTransfers.tryAcquire(busy) {
+	}
+	if rec := serve(http.MethodGet, "/internal/range?start=0&end=0", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a busy peer's range listing to get 503, got %d", rec.Code)
+	}
+	other := httptest.NewRequest(http.MethodGet, "/internal/scan?prefix=a", nil)
+	other.RemoteAddr = "192.0.2.2:1234"
+	rec := httptest.NewRecorder()
+	b.server.Handler.ServeHTTP(rec, other)
+	if rec.Code == http.StatusServiceUnavailable {
+		t.Errorf("Expected another peer's listing to be unaffected, got %d", rec.Code)
+	}
+	for range b.cfg.MaxPeerTransfers {
+		b.peerTransfers.release(busy)
+	}
+
+	// A replica turning a write away is busy, not dead: the write misses
+	// its quorum but the coordinator keeps it as a hint for the replica
+	fill(b.replicaLimit)
+	if _, err := a.put(t.Context(), "busy", []byte("value"), nil, 2, time.Time{}); err == nil {
+		t.Errorf("Expected a write needing the busy replica to fail")
+	}
+	if store.Len("b") != 1 {
+		t.Errorf("Expected one hint for the busy replica, got %d", store.Len("b"))
+	}
+	if a.cluster.State("b") == membership.Dead {
+		t.Errorf("Expected a busy replica not to be marked dead")
+	}
+	drain(b.replicaLimit)
+}
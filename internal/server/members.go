@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/amirderis/DHT/internal/membership"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// A node that died for good cannot decommission itself, so an operator
+// evicts it instead: POST /admin/members/{id}/remove on any other node
+// removes it from that node's ring and asks every peer to do the same,
+// as if the node had left. Each node then repairs the ranges the evicted
+// node replicated along with it, which copies their keys to the nodes
+// taking its place. Only a node this node has marked dead and that still
+// does not answer a ping may be evicted; a live one is decommissioned.
+// Evictions are recorded in the eviction log.
+
+// handleMembers serves GET /admin/members, the ring members with their
+// incarnations and whether this node sees them alive, GET
+// /admin/members/evictions, the evictions carried out by this node, and
+// POST /admin/members/{id}/remove.
+func (s *HTTPServer) handleMembers(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/admin/members" || r.URL.Path == "/admin/members/evictions" {
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+			return
+		}
+		if r.URL.Path == "/admin/members" {
+			s.writeJSON(w, s.memberStates())
+		} else {
+			s.writeJSON(w, s.evictions.list())
+		}
+		return
+	}
+	id, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/members/"), "/")
+	if !ok || id == "" || action != "remove" {
+		s.writeError(w, http.StatusNotFound, "not found: "+r.URL.Path)
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	removal, err := s.evictMember(id)
+	if err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	for nodeID, address := range s.ring.GetNodes() {
+		if nodeID == ring.NodeID(s.cfg.NodeID) {
+			continue
+		}
+		if err := s.transport.Leave(r.Context(), address, removal.Member); err != nil {
+			removal.Errors = append(removal.Errors, fmt.Sprintf("peer %s did not remove node %s: %v", nodeID, id, err))
+		}
+	}
+	s.logger.Printf("audit: evicted node %s (%s, incarnation %d) on request from %s, %d peers not told\n", id, removal.Member.Address, removal.Member.Incarnation, r.RemoteAddr, len(removal.Errors))
+	eviction := api.Eviction{Member: removal.Member, At: time.Now().UTC(), From: r.RemoteAddr, Operator: r.Header.Get(operatorHeader), Errors: removal.Errors}
+	if err := s.evictions.record(eviction); err != nil {
+		s.logger.Printf("failed to record the eviction of node %s: %v\n", id, err)
+	}
+	s.metrics.Count("members_evicted", 1)
+	s.writeJSON(w, removal)
+}
+
+// evictMember removes the dead node id from this node's ring.
+func (s *HTTPServer) evictMember(id string) (api.MemberRemoval, error) {
+	if id == s.cfg.NodeID {
+		return api.MemberRemoval{}, &opError{http.StatusBadRequest, "a node cannot evict itself; decommission it instead"}
+	}
+	nodeID := ring.NodeID(id)
+	address, known := s.ring.GetNodeAddress(nodeID)
+	incarnation, _ := s.ring.Incarnation(nodeID)
+	if !known {
+		return api.MemberRemoval{}, &opError{http.StatusNotFound, "unknown node: " + id}
+	}
+	if s.cluster.State(id) != membership.Dead || s.ping(address) {
+		return api.MemberRemoval{}, &opError{http.StatusConflict, fmt.Sprintf("node %s is not dead; decommission it instead", id)}
+	}
+	m := api.Member{NodeID: id, Address: address, Incarnation: incarnation}
+	if err := s.removeMember(m); err != nil {
+		return api.MemberRemoval{}, err
+	}
+	return api.MemberRemoval{Member: m}, nil
+}
+
+// memberStates lists the ring members sorted by ID.
+func (s *HTTPServer) memberStates() []api.MemberState {
+	members := []api.MemberState{}
+	for nodeID, address := range s.ring.GetNodes() {
+		incarnation, _ := s.ring.Incarnation(nodeID)
+		members = append(members, api.MemberState{
+			Member: api.Member{NodeID: string(nodeID), Address: address, Incarnation: incarnation, Meta: s.memberMeta(string(nodeID))},
+			State:  s.cluster.State(string(nodeID)).String(),
+			Codecs: s.codecs.advertisedBy(address),
+			Codec:  s.codecs.codec(address),
+		})
+	}
+	slices.SortFunc(members, func(a, b api.MemberState) int { return strings.Compare(a.NodeID, b.NodeID) })
+	return members
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestEvictMember(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	c, cServer := startTestNodeWith(t, "c", nil)
+	nodes := []*HTTPServer{a, b, c}
+	for _, x := range nodes {
+		for _, y := range nodes {
+			x.ring.JoinNode(ring.NodeID(y.cfg.NodeID), y.cfg.BindAddr, y.incarnation)
+		}
+	}
+	keys := make([]string, 40)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+		if _, err := a.put(t.Context(), keys[i], []byte("value-"+keys[i]), nil, 2, time.Time{}); err != nil {
+			t.Fatalf("Failed to put %s: %v", keys[i], err)
+		}
+	}
+	evict := func(x *HTTPServer, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/members/"+id+"/remove", nil)
+		req.Header.Set(operatorHeader, "alice")
+		rec := httptest.NewRecorder()
+		x.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := evict(a, "c"); rec.Code != http.StatusConflict {
+		t.Errorf("Expected a live node not to be evicted, got %d", rec.Code)
+	}
+	if rec := evict(a, "a"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a node not to evict itself, got %d", rec.Code)
+	}
+	if rec := evict(a, "x"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected an unknown node to be reported, got %d", rec.Code)
+	}
+
+	cServer.Close()
+	a.cluster.MarkDead("c")
+	rec := evict(a, "c")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected c to be evicted, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var removal api.MemberRemoval
+	if err := json.Unmarshal(rec.Body.Bytes(), &removal); err != nil {
+		t.Fatalf("Failed to decode the removal: %v", err)
+	}
+	if removal.Member.NodeID != "c" || removal.Member.Incarnation != c.incarnation || len(removal.Errors) > 0 {
+		t.Errorf("Expected c to be removed everywhere, got %+v", removal)
+	}
+	for _, x := range nodes[:2] {
+		if _, ok := x.ring.GetNodeAddress("c"); ok {
+			t.Errorf("Expected %s to have removed c from its ring", x.cfg.NodeID)
+		}
+	}
+	rec = httptest.NewRecorder()
+	a.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/members/evictions", nil))
+	var evictions []api.Eviction
+	if err := json.Unmarshal(rec.Body.Bytes(), &evictions); err != nil {
+		t.Fatalf("Failed to decode the evictions: %v", err)
+	}
+	if len(evictions) != 1 || evictions[0].Member.NodeID != "c" || evictions[0].Operator != "alice" || evictions[0].From == "" || evictions[0].At.IsZero() {
+		t.Errorf("Expected the eviction of c by alice to be recorded, got %+v", evictions)
+	}
+
+	// The keys c held are copied to the node that took its place
+	waitFor(t, func() bool {
+		for _, key := range keys {
+			for _, x := range nodes[:2] {
+				if value, _ := x.storage.Get(key); string(value) != "value-"+key {
+					return false
+				}
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+const metadataQueryParam = "metadata"
+
+// wantsMetadata reports whether a GET asks for metadata instead of the value.
+func wantsMetadata(r *http.Request) bool {
+	return r.URL.Query().Get(metadataQueryParam) == "true"
+}
+
+// handleMetadata serves GET /kv/{key}?metadata=true by asking every member
+// of the key's preference list what it holds.
+func (s *HTTPServer) handleMetadata(w http.ResponseWriter, r *http.Request, key string) {
+	if err := s.checkNamespace(key); err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	preferenceList, err := s.ring.GetPreferenceList(key, s.cfg.ReplicationFactor)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "failed to get preference list for key: "+key)
+		return
+	}
+
+	response := api.KeyMetadata{Key: clientKey(r.Context(), key), Replicas: make([]api.ReplicaMetadata, 0, len(preferenceList))}
+	for _, nodeID := range preferenceList {
+		replica := s.replicaMetadata(r.Context(), nodeID, key)
+		response.Replicas = append(response.Replicas, replica)
+		if (replica.Found || replica.Tombstone) && replica.UpdatedAt.After(response.UpdatedAt) {
+			response.Found = replica.Found
+			response.Size = replica.Size
+			response.Chunks = replica.Chunks
+			response.UpdatedAt = replica.UpdatedAt
+			response.ExpiresAt = replica.ExpiresAt
+			response.Tombstone = replica.Tombstone
+			response.Version = replica.Version
+		}
+		response.Reads += replica.Reads
+		if replica.LastRead.After(response.LastRead) {
+			response.LastRead = replica.LastRead
+		}
+	}
+	if !response.Found {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	s.writeJSON(w, response)
+}
+
+// replicaMetadata describes the copy of key held by nodeID. Unreachable
+// replicas are reported with Error set rather than failing the request.
+func (s *HTTPServer) replicaMetadata(ctx context.Context, nodeID ring.NodeID, key string) api.ReplicaMetadata {
+	address, _ := s.ring.GetNodeAddress(nodeID)
+	if nodeID == ring.NodeID(s.cfg.NodeID) {
+		return s.localMetadata(key)
+	}
+	meta, err := s.readRemoteMetadata(ctx, address, key)
+	if err != nil {
+		return api.ReplicaMetadata{NodeID: string(nodeID), Address: address, Error: err.Error()}
+	}
+	return meta
+}
+
+// localMetadata describes the local copy of key, reporting the logical size
+// of chunked values from their manifest. A tombstone is reported as not
+// found, with the clock and time of the delete.
+func (s *HTTPServer) localMetadata(key string) api.ReplicaMetadata {
+	meta := api.ReplicaMetadata{NodeID: s.cfg.NodeID, Address: s.cfg.BindAddr}
+	if reads, ok := s.access.Lookup(key); ok {
+		meta.Reads, meta.LastRead = reads.Count, reads.LastRead
+	}
+	item, err := s.versions.GetVersionedChecked(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return meta
+	}
+	if err != nil {
+		meta.Corrupt = true
+		return meta
+	}
+	meta.Version = item.Context()
+	for _, version := range item.Versions() {
+		meta.Versions = append(meta.Versions, version.Version)
+	}
+	meta.UpdatedAt = item.Timestamp
+	meta.ExpiresAt = item.ExpiresAt
+	if item.Tombstone {
+		meta.Tombstone = true
+		return meta
+	}
+	meta.Found = true
+	meta.Digest = valueDigest(item.Value)
+	meta.Size = len(item.Value)
+	if isManifest(item.Value) {
+		if m, err := decodeManifest(item.Value); err == nil {
+			meta.Size = m.Size
+			meta.Chunks = m.Chunks
+		}
+	}
+	return meta
+}
+
+func (s *HTTPServer) readRemoteMetadata(ctx context.Context, address, key string) (api.ReplicaMetadata, error) {
+	return s.transport.Metadata(ctx, address, key)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestKeyMetadata(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.WriteQuorum = 1
+	s.cfg.ReplicationFactor = 2
+	s.cfg.ChunkSize = 4
+	s.ring.JoinNode("unreachable", "127.0.0.1:1", 1)
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/kv/key", strings.NewReader("0123456789")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for put, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kv/key?metadata=true", nil))
+	var meta api.KeyMetadata
+	if err := json.NewDecoder(rec.Body).Decode(&meta); err != nil {
+		t.Fatalf("Failed to decode metadata: %v", err)
+	}
+	if !meta.Found || meta.Size != 10 || meta.Chunks != 3 || meta.UpdatedAt.IsZero() {
+		t.Errorf("Expected a 10 byte value in 3 chunks, got %+v", meta)
+	}
+	if len(meta.Replicas) != 2 {
+		t.Fatalf("Expected both replicas to be reported, got %+v", meta.Replicas)
+	}
+	for _, replica := range meta.Replicas {
+		if replica.NodeID == "unreachable" && replica.Error == "" {
+			t.Errorf("Expected an error for the unreachable replica, got %+v", replica)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kv/missing?metadata=true", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing key, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/kv/key", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 for delete, got %d", rec.Code)
+	}
+	deleted, _ := s.versions.GetVersioned("key")
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kv/key?metadata=true", nil))
+	meta = api.KeyMetadata{}
+	if err := json.NewDecoder(rec.Body).Decode(&meta); err != nil {
+		t.Fatalf("Failed to decode metadata: %v", err)
+	}
+	if rec.Code != http.StatusNotFound || meta.Found || !meta.Tombstone {
+		t.Errorf("Expected 404 reporting the tombstone of a deleted key, got %d with %+v", rec.Code, meta)
+	}
+	if deleted == nil || !clock.Equal(meta.Version, deleted.Version) || meta.UpdatedAt.IsZero() {
+		t.Errorf("Expected the clock and time of the delete, got %+v", meta)
+	}
+}
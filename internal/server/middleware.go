@@ -0,0 +1,252 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Middleware wraps a handler with a cross-cutting concern.
+type Middleware func(http.Handler) http.Handler
+
+// chain wraps h so that the first middleware listed is the outermost.
+func chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// buildChain wraps h with the named middlewares. Names are checked by
+// config.Validate, so unknown names here are a programming error.
+func (s *HTTPServer) buildChain(h http.Handler, names []string) http.Handler {
+	mws := make([]Middleware, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case "metrics":
+			mws = append(mws, s.countRequests)
+		case "logging":
+			mws = append(mws, s.logRequests)
+		case "auth":
+			mws = append(mws, s.requireToken)
+		case "ratelimit":
+			mws = append(mws, s.rateLimit(newTokenBucket(s.cfg.RateLimit, s.cfg.RateBurst)))
+		case "gzip":
+			mws = append(mws, compress)
+		case "recovery":
+			mws = append(mws, s.recoverPanics)
+		default:
+			panic("unknown middleware " + name)
+		}
+	}
+	return chain(h, mws...)
+}
+
+// logRequests logs one line per request with its status and duration.
+func (s *HTTPServer) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		s.logger.Printf("%s %s %s %d %s\n", r.RemoteAddr, r.Method, r.URL.Path, status, time.Since(start).Round(time.Microsecond))
+	})
+}
+
+// recoverPanics turns a handler panic into a 500 response, logging the stack
+// trace and counting it instead of letting net/http drop the connection.
+func (s *HTTPServer) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			s.stats.panics.Add(1)
+			s.metrics.Count("panics", 1)
+			s.logger.Printf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, p, debug.Stack())
+			if rec.status == 0 {
+				s.writeError(rec, http.StatusInternalServerError, "internal server error")
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// requireToken rejects requests that carry neither the configured bearer
+// token nor a tenant's, and tags the requests of a tenant with it.
+func (s *HTTPServer) requireToken(next http.Handler) http.Handler {
+	want := []byte("Bearer " + s.cfg.AuthToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if s.cfg.AuthToken != "" && subtle.ConstantTimeCompare(got, want) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if tenant, ok := s.tenantFor(got); ok {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, tenant)))
+			return
+		}
+		s.writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+	})
+}
+
+// requireAdminToken rejects admin requests without the admin token when
+// one is configured, letting health and readiness probes through.
+func (s *HTTPServer) requireAdminToken(next http.Handler) http.Handler {
+	if s.cfg.AdminToken == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.cfg.AdminToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || subtle.ConstantTimeCompare(got, want) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.writeError(w, http.StatusUnauthorized, "missing or invalid admin token")
+	})
+}
+
+// requirePeerToken rejects internal requests without the cluster token
+// when one is configured.
+func (s *HTTPServer) requirePeerToken(next http.Handler) http.Handler {
+	if s.cfg.ClusterToken == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.cfg.ClusterToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.writeError(w, http.StatusUnauthorized, "missing or invalid cluster token")
+	})
+}
+
+// rateLimit rejects requests once the listener's token bucket is empty.
+func (s *HTTPServer) rateLimit(bucket *tokenBucket) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !bucket.allow(time.Now()) {
+				s.writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tokenBucket refills at rate tokens per second up to burst.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// compress gzips responses for clients that accept it.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipResponseWriter{ResponseWriter: w, plain: r.Method == http.MethodHead}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// gzipResponseWriter starts compressing on the first body write. Responses
+// whose headers describe the body as sent, as for a HEAD or a 206, event
+// streams that must reach the client event by event, and bodiless
+// responses such as 204 are passed through untouched.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	// plain passes the response through uncompressed
+	plain       bool
+	wroteHeader bool
+	gz          *gzip.Writer
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if !g.wroteHeader && status >= http.StatusOK {
+		g.wroteHeader = true
+		switch {
+		case status == http.StatusNoContent, status == http.StatusNotModified, status == http.StatusPartialContent,
+			strings.HasPrefix(g.Header().Get("Content-Type"), "text/event-stream"),
+			g.Header().Get("Content-Encoding") != "":
+			g.plain = true
+		case !g.plain:
+			g.Header().Set("Content-Encoding", "gzip")
+			g.Header().Del("Content-Length")
+		}
+	}
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.plain {
+		return g.ResponseWriter.Write(p)
+	}
+	if g.gz == nil {
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	return g.gz.Write(p)
+}
+
+// Flush sends what has been compressed so far, for streamed responses.
+func (g *gzipResponseWriter) Flush() {
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, to
+// extend the deadlines of streamed responses.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+func (g *gzipResponseWriter) close() {
+	if g.gz != nil {
+		g.gz.Close()
+	}
+}
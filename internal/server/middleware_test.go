@@ -0,0 +1,315 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/pkg/api"
+	"github.com/amirderis/DHT/pkg/api/dhtpb"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := chain(http.NotFoundHandler(), tag("outer"), tag("inner"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if strings.Join(order, ",") != "outer,inner" {
+		t.Errorf("Expected outer middleware to run first, got %v", order)
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.AuthToken = "secret"
+	h := s.buildChain(http.HandlerFunc(s.handleHealth), []string{"auth"})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with token, got %d", rec.Code)
+	}
+}
+
+func TestTenantTokens(t *testing.T) {
+	cfg := &config.Config{
+		NodeID: "test-node", BindAddr: "127.0.0.1:0", ReplicationFactor: 1, ReadQuorum: 1, WriteQuorum: 1,
+		AuthToken: "admin", TenantTokensCSV: "acme=acme-token,globex=globex-token",
+		PublicMiddlewareCSV: "auth", AdminMiddlewareCSV: "auth",
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("Expected tenants to require a cluster token")
+	}
+	cfg.ClusterToken = "cluster"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Failed to validate config: %v", err)
+	}
+	s := NewHTTPServer(cfg)
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("acme-token", http.MethodPut, "/kv/orders", "acme's"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected a tenant to write to its own namespace, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do("globex-token", http.MethodPut, "/kv/orders", "globex's"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected another tenant to write the same name, got %d: %s", rec.Code, rec.Body)
+	}
+	rec := do("acme-token", http.MethodGet, "/kv/orders", "")
+	var got api.GetResponse
+	json.NewDecoder(rec.Body).Decode(&got)
+	if rec.Code != http.StatusOK || string(got.Value) != "acme's" || got.Key != "orders" {
+		t.Errorf("Expected a tenant to read back its own key, got %d %+v", rec.Code, got)
+	}
+	if rec := do("globex-token", http.MethodGet, "/kv/acme/orders", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a tenant not to reach another tenant's key by name, got %d: %s", rec.Code, rec.Body)
+	}
+	rec = do("admin", http.MethodGet, "/kv/globex/orders", "")
+	json.NewDecoder(rec.Body).Decode(&got)
+	if rec.Code != http.StatusOK || string(got.Value) != "globex's" {
+		t.Errorf("Expected the auth token to read across tenants, got %d %+v", rec.Code, got)
+	}
+
+	rec = do("acme-token", http.MethodGet, "/scan", "")
+	var scan api.ScanResponse
+	json.NewDecoder(rec.Body).Decode(&scan)
+	if len(scan.Items) != 1 || scan.Items[0].Key != "orders" || string(scan.Items[0].Value) != "acme's" {
+		t.Errorf("Expected a tenant scan to list only its own keys, got %+v", scan.Items)
+	}
+
+	for _, path := range []string{"/namespaces", "/admin/repair/status"} {
+		if rec := do("acme-token", http.MethodGet, path, ""); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected a tenant to be refused %s, got %d", path, rec.Code)
+		}
+	}
+	if rec := do("", http.MethodGet, "/kv/orders", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an empty token to be refused, got %d", rec.Code)
+	}
+
+	// Only the cluster token reaches the internal endpoints
+	for _, token := range []string{"", "acme-token", "admin"} {
+		if rec := do(token, http.MethodGet, "/internal/storage/acme/orders", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %q to be refused the internal endpoints, got %d", token, rec.Code)
+		}
+	}
+	if rec := do("cluster", http.MethodGet, "/internal/storage/acme/orders", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected the cluster token to read a replica, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// and the gRPC Replica service, while the KV service scopes tenants
+	rpc := func(token, method string) (context.Context, error) {
+		ctx := metadata.NewIncomingContext(t.Context(), metadata.Pairs("authorization", "Bearer "+token))
+		return s.authorizeRPC(ctx, method)
+	}
+	if _, err := rpc("acme-token", dhtpb.Replica_Get_FullMethodName); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected a tenant token to be refused the Replica service, got %v", err)
+	}
+	if _, err := rpc("cluster", dhtpb.Replica_Replicate_FullMethodName); err != nil {
+		t.Errorf("Expected the cluster token to be allowed the Replica service, got %v", err)
+	}
+	if _, err := rpc("", dhtpb.KV_Get_FullMethodName); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected an empty token to be refused the KV service, got %v", err)
+	}
+	ctx, err := rpc("acme-token", dhtpb.KV_Get_FullMethodName)
+	if err != nil {
+		t.Fatalf("Expected a tenant token to be allowed the KV service, got %v", err)
+	}
+	kv := &kvService{s: s}
+	if resp, err := kv.Get(ctx, &dhtpb.GetRequest{Key: "orders"}); err != nil || string(resp.Value) != "acme's" || resp.Key != "orders" {
+		t.Errorf("Expected a tenant to read its own key over gRPC, got %+v, %v", resp, err)
+	}
+	if resp, err := kv.Get(ctx, &dhtpb.GetRequest{Key: "globex/orders"}); err != nil || resp.Found {
+		t.Errorf("Expected a tenant not to reach another tenant's key over gRPC, got %+v, %v", resp, err)
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	cfg := &config.Config{
+		NodeID: "test-node", BindAddr: "127.0.0.1:0", ReplicationFactor: 1, ReadQuorum: 1, WriteQuorum: 1,
+		AuthToken: "data", AdminToken: "ops", PublicMiddlewareCSV: "auth",
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Failed to validate config: %v", err)
+	}
+	s := NewHTTPServer(cfg)
+	do := func(token, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, path := range []string{"/admin/config", "/admin/members", "/admin/ring", "/stats"} {
+		if rec := do("data", path); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the auth token to be refused %s, got %d", path, rec.Code)
+		}
+		if rec := do("ops", path); rec.Code != http.StatusOK {
+			t.Errorf("Expected the admin token to be allowed %s, got %d: %s", path, rec.Code, rec.Body)
+		}
+	}
+	if rec := do("", "/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("Expected health probes to need no token, got %d", rec.Code)
+	}
+	if rec := do("ops", "/kv/key"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the admin token to grant nothing on the public API, got %d", rec.Code)
+	}
+
+	rec := do("ops", "/admin/config")
+	if body := rec.Body.String(); strings.Contains(body, `"ops"`) || strings.Contains(body, `"data"`) || !strings.Contains(body, `"NodeID":"test-node"`) {
+		t.Errorf("Expected the config without its tokens, got %s", body)
+	}
+	var members []api.MemberState
+	json.NewDecoder(do("ops", "/admin/members").Body).Decode(&members)
+	if len(members) != 1 || members[0].NodeID != "test-node" || members[0].State != "alive" {
+		t.Errorf("Expected the node to list itself alive, got %+v", members)
+	}
+
+	cfg = &config.Config{NodeID: "test-node", AuthToken: "same", AdminToken: "same"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected an admin token equal to the auth token to be refused")
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(1, 2)
+	now := time.Now()
+	if !b.allow(now) || !b.allow(now) {
+		t.Fatal("Expected burst of 2 to be allowed")
+	}
+	if b.allow(now) {
+		t.Error("Expected third request in the same instant to be limited")
+	}
+	if !b.allow(now.Add(time.Second)) {
+		t.Error("Expected a token to be refilled after one second")
+	}
+}
+
+func TestCompress(t *testing.T) {
+	s := newTestServer(t)
+	h := s.buildChain(http.HandlerFunc(s.handleHealth), []string{"gzip"})
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip encoding, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to open gzip body: %v", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if string(body) != "ok\n" {
+		t.Errorf("Expected body ok, got %q", body)
+	}
+
+	// Responses whose headers describe the body as sent, and event
+	// streams, pass through
+	plain := map[string]http.HandlerFunc{
+		"head": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "10")
+			w.WriteHeader(http.StatusOK)
+		},
+		"range": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "2")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte("ok"))
+		},
+		"events": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: ok\n\n"))
+		},
+	}
+	for name, handler := range plain {
+		method := http.MethodGet
+		if name == "head" {
+			method = http.MethodHead
+		}
+		req := httptest.NewRequest(method, "/kv/a", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		s.buildChain(handler, []string{"gzip"}).ServeHTTP(rec, req)
+		if rec.Header().Get("Content-Encoding") != "" || (name != "events" && rec.Header().Get("Content-Length") == "") {
+			t.Errorf("Expected the %s response passed through, got %v", name, rec.Header())
+		}
+	}
+
+	// Deadlines set behind it reach the connection
+	var deadline time.Time
+	extend := s.buildChain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+			t.Errorf("Expected the write deadline extended through gzip, got %v", err)
+		}
+	}), []string{"gzip"})
+	req = httptest.NewRequest(http.MethodGet, "/kv/a", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	extend.ServeHTTP(&deadlineRecorder{ResponseRecorder: httptest.NewRecorder(), deadline: &deadline}, req)
+	if deadline.IsZero() {
+		t.Errorf("Expected the deadline to reach the underlying writer")
+	}
+}
+
+// deadlineRecorder records the write deadline set on it.
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadline *time.Time
+}
+
+func (d *deadlineRecorder) SetWriteDeadline(deadline time.Time) error {
+	*d.deadline = deadline
+	return nil
+}
+
+func TestRecoverPanics(t *testing.T) {
+	s := newTestServer(t)
+	h := s.buildChain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("Unknown command")
+	}), []string{"metrics", "recovery"})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kv/a", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 after panic, got %d", rec.Code)
+	}
+	if n := s.stats.panics.Value(); n != 1 {
+		t.Errorf("Expected 1 counted panic, got %d", n)
+	}
+	if n := s.stats.serverErrors.Value(); n != 1 {
+		t.Errorf("Expected the panic to count as a server error, got %d", n)
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// Mirroring copies a sample of client reads and writes to a shadow cluster
+// once they have been served here, e.g. to validate a migration or a new
+// storage engine against production traffic. It never delays or fails the
+// client request: mirrored requests run in the background, are dropped when
+// too many are in flight, and their outcome only shows in /admin/mirror.
+
+// maxMirrorInFlight bounds the mirrored requests running at once.
+const maxMirrorInFlight = 64
+
+// maxMirrorSamples is how many recent divergences /admin/mirror keeps.
+const maxMirrorSamples = 100
+
+type mirror struct {
+	addr    string
+	percent float64
+	slots   chan struct{}
+
+	mirrored atomic.Int64
+	dropped  atomic.Int64
+	failed   atomic.Int64
+	diverged atomic.Int64
+
+	mu      sync.Mutex
+	samples []api.MirrorDivergence
+}
+
+// newMirror returns nil when mirroring is disabled.
+func newMirror(addr string, percent float64) *mirror {
+	if addr == "" || percent <= 0 {
+		return nil
+	}
+	return &mirror{addr: addr, percent: percent, slots: make(chan struct{}, maxMirrorInFlight)}
+}
+
+// acquire samples one request and reserves an in-flight slot for it.
+func (m *mirror) acquire() bool {
+	if m == nil || rand.Float64()*100 >= m.percent {
+		return false
+	}
+	select {
+	case m.slots <- struct{}{}:
+		return true
+	default:
+		m.dropped.Add(1)
+		return false
+	}
+}
+
+func (m *mirror) release() {
+	<-m.slots
+}
+
+func (m *mirror) record(d api.MirrorDivergence) {
+	m.diverged.Add(1)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.samples) == maxMirrorSamples {
+		m.samples = append(m.samples[:0], m.samples[1:]...)
+	}
+	m.samples = append(m.samples, d)
+}
+
+func (m *mirror) report() api.MirrorReport {
+	m.mu.Lock()
+	samples := append([]api.MirrorDivergence{}, m.samples...)
+	m.mu.Unlock()
+	return api.MirrorReport{
+		Target:   m.addr,
+		Percent:  m.percent,
+		Mirrored: m.mirrored.Load(),
+		Dropped:  m.dropped.Load(),
+		Failed:   m.failed.Load(),
+		Diverged: m.diverged.Load(),
+		Samples:  samples,
+	}
+}
+
+// mirrorGet reads key from the mirror and compares it with the response
+// served by this cluster.
+func (s *HTTPServer) mirrorGet(key string, primary api.GetResponse) {
+	s.mirrorRequest(key, http.MethodGet, nil, nil, func(status int, body []byte) string {
+		var shadow api.GetResponse
+		if status != http.StatusOK && status != http.StatusNotFound {
+			return fmt.Sprintf("mirror returned status %d", status)
+		}
+		if status == http.StatusOK {
+			if err := json.Unmarshal(body, &shadow); err != nil {
+				return "mirror returned an invalid response"
+			}
+		}
+		switch {
+		case shadow.Found != primary.Found:
+			return fmt.Sprintf("found on primary: %t, on mirror: %t", primary.Found, shadow.Found)
+		case !bytes.Equal(shadow.Value, primary.Value):
+			return fmt.Sprintf("values differ (%d bytes on primary, %d on mirror)", len(primary.Value), len(shadow.Value))
+		}
+		return ""
+	})
+}
+
+// mirrorPut writes value to the mirror with the TTL left before expiresAt.
+func (s *HTTPServer) mirrorPut(key string, value []byte, expiresAt time.Time) {
+	header := http.Header{}
+	header.Set(checksumHeader, strconv.FormatUint(uint64(crc32.ChecksumIEEE(value)), 10))
+	if !expiresAt.IsZero() {
+		header.Set(ttlSecondsHeader, strconv.FormatInt(int64(max((time.Until(expiresAt)+time.Second-1)/time.Second, 1)), 10))
+	}
+	s.mirrorRequest(key, http.MethodPut, value, header, expectStatus(http.StatusOK))
+}
+
+func (s *HTTPServer) mirrorDelete(key string) {
+	s.mirrorRequest(key, http.MethodDelete, nil, nil, expectStatus(http.StatusNoContent))
+}
+
+func expectStatus(want int) func(int, []byte) string {
+	return func(status int, _ []byte) string {
+		if status != want {
+			return fmt.Sprintf("mirror returned status %d", status)
+		}
+		return ""
+	}
+}
+
+// mirrorRequest sends a sampled request to the mirror in the background.
+// compare describes how the mirror's answer diverges, or returns "".
+func (s *HTTPServer) mirrorRequest(key, method string, body []byte, header http.Header, compare func(status int, body []byte) string) {
+	m := s.mirror
+	if !m.acquire() {
+		return
+	}
+	go func() {
+		defer m.release()
+		m.mirrored.Add(1)
+		s.metrics.Count("mirrored_requests", 1)
+
+		req, err := http.NewRequest(method, fmt.Sprintf("http://%s/kv/%s", m.addr, key), bytes.NewReader(body))
+		if err != nil {
+			m.failed.Add(1)
+			return
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			m.failed.Add(1)
+			s.metrics.Count("mirror_failures", 1)
+			return
+		}
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			m.failed.Add(1)
+			s.metrics.Count("mirror_failures", 1)
+			return
+		}
+		if reason := compare(resp.StatusCode, respBody); reason != "" {
+			m.record(api.MirrorDivergence{Key: key, Op: method, Reason: reason, Time: time.Now().UTC()})
+			s.metrics.Count("mirror_divergences", 1)
+		}
+	}()
+}
+
+// handleMirror serves GET /admin/mirror.
+func (s *HTTPServer) handleMirror(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	if s.mirror == nil {
+		s.writeError(w, http.StatusNotFound, "mirroring is disabled")
+		return
+	}
+	s.writeJSON(w, s.mirror.report())
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestMirror(t *testing.T) {
+	shadow := startTestNode(t, "shadow")
+	cfg := &config.Config{NodeID: "test-node", BindAddr: "127.0.0.1:0", WriteQuorum: 1, MirrorAddr: shadow.cfg.BindAddr, MirrorPercent: 100}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Failed to validate config: %v", err)
+	}
+	s := NewHTTPServer(cfg)
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/kv/key", strings.NewReader("value")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for put, got %d", rec.Code)
+	}
+	waitFor(t, func() bool { return s.mirror.mirrored.Load() == 1 && len(s.mirror.slots) == 0 })
+	if value, _ := shadow.storage.Get("key"); string(value) != "value" {
+		t.Fatalf("Expected the write to be mirrored, got %q", value)
+	}
+
+	shadow.storage.Put("key", []byte("diverged"))
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kv/key", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for get, got %d", rec.Code)
+	}
+	waitFor(t, func() bool { return s.mirror.diverged.Load() == 1 })
+
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/mirror", nil))
+	var report api.MirrorReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode mirror report: %v", err)
+	}
+	if report.Mirrored != 2 || len(report.Samples) != 1 || report.Samples[0].Op != http.MethodGet {
+		t.Errorf("Expected one diverged read out of two mirrored requests, got %+v", report)
+	}
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// Keys of the form "{namespace}/{key}" belong to a namespace, which must be
+// created through /namespaces/ before it can be used. Keys without a "/"
+// live in the default namespace, which always exists. The namespace is part
+// of the key, so it is carried through the ring hash, storage and
+// replication without any change to them.
+
+var namespaceName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// namespaceRegistry is this node's copy of the cluster's namespaces. Changes
+// are broadcast to every member of the ring and new nodes copy the registry
+// from their seeds.
+type namespaceRegistry struct {
+	mu    sync.RWMutex
+	items map[string]api.Namespace
+}
+
+func newNamespaceRegistry() *namespaceRegistry {
+	return &namespaceRegistry{items: make(map[string]api.Namespace)}
+}
+
+func (n *namespaceRegistry) get(name string) (api.Namespace, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	ns, ok := n.items[name]
+	return ns, ok
+}
+
+// add records ns unless it already exists, and returns the stored namespace.
+func (n *namespaceRegistry) add(ns api.Namespace) (api.Namespace, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if existing, ok := n.items[ns.Name]; ok {
+		return existing, false
+	}
+	n.items[ns.Name] = ns
+	return ns, true
+}
+
+// set records ns, replacing the settings of an existing namespace.
+func (n *namespaceRegistry) set(ns api.Namespace) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.items[ns.Name] = ns
+}
+
+func (n *namespaceRegistry) remove(name string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, ok := n.items[name]
+	delete(n.items, name)
+	return ok
+}
+
+// list returns the namespaces sorted by name.
+func (n *namespaceRegistry) list() []api.Namespace {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	out := make([]api.Namespace, 0, len(n.items))
+	for _, ns := range n.items {
+		out = append(out, ns)
+	}
+	slices.SortFunc(out, func(a, b api.Namespace) int { return strings.Compare(a.Name, b.Name) })
+	return out
+}
+
+// checkNamespace rejects keys in a namespace that has not been created.
+func (s *HTTPServer) checkNamespace(key string) error {
+	name := storage.Namespace(key)
+	if name == "" {
+		return nil
+	}
+	if _, ok := s.namespaces.get(name); !ok && !s.isTenant(name) {
+		return &opError{http.StatusNotFound, "namespace not found: " + name}
+	}
+	return nil
+}
+
+// coalesceWindow returns how long writes to key wait for later writes to the same key.
+func (s *HTTPServer) coalesceWindow(key string) time.Duration {
+	ns, ok := s.namespaces.get(storage.Namespace(key))
+	if !ok {
+		return 0
+	}
+	return time.Duration(ns.CoalesceWindowMillis) * time.Millisecond
+}
+
+// namespaceValueType returns the type every value of key's namespace has,
+// empty for plain values.
+func (s *HTTPServer) namespaceValueType(key string) string {
+	ns, _ := s.namespaces.get(storage.Namespace(key))
+	return ns.ValueType
+}
+
+// handleNamespaces serves GET /namespaces and GET/PUT/DELETE /namespaces/{name}.
+// A PUT body may carry the namespace settings; a PUT to an existing
+// namespace with a body replaces its settings.
+func (s *HTTPServer) handleNamespaces(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/namespaces"), "/")
+	if name == "" {
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+			return
+		}
+		s.writeJSON(w, s.namespaceList())
+		return
+	}
+	if !namespaceName.MatchString(name) {
+		s.writeError(w, http.StatusBadRequest, "invalid namespace name: "+name)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		ns, ok := s.namespaces.get(name)
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "namespace not found: "+name)
+			return
+		}
+		s.writeJSON(w, ns)
+	case http.MethodPut:
+		if err := s.checkBootstrapped(); err != nil {
+			s.writeOpError(w, err)
+			return
+		}
+		var settings api.Namespace
+		err := json.NewDecoder(r.Body).Decode(&settings)
+		if err != nil && !errors.Is(err, io.EOF) {
+			s.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if settings.CoalesceWindowMillis < 0 {
+			s.writeError(w, http.StatusBadRequest, "coalesce window must not be negative")
+			return
+		}
+		if settings.ValueType != "" && !validValueType(settings.ValueType) {
+			s.writeError(w, http.StatusBadRequest, "unknown value type: "+settings.ValueType)
+			return
+		}
+		ns, created := s.namespaces.add(api.Namespace{Name: name, CreatedAt: time.Now().UTC(), CoalesceWindowMillis: settings.CoalesceWindowMillis, ValueType: settings.ValueType})
+		if !created && err == nil {
+			ns.CoalesceWindowMillis = settings.CoalesceWindowMillis
+			ns.ValueType = settings.ValueType
+			s.namespaces.set(ns)
+		}
+		if created || err == nil {
+			s.broadcastNamespace(http.MethodPut, ns)
+		}
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		}
+		s.writeJSON(w, ns)
+	case http.MethodDelete:
+		if err := s.checkBootstrapped(); err != nil {
+			s.writeOpError(w, err)
+			return
+		}
+		ns, ok := s.namespaces.get(name)
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "namespace not found: "+name)
+			return
+		}
+		s.dropNamespace(name)
+		s.broadcastNamespace(http.MethodDelete, ns)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+	}
+}
+
+// namespaceList describes every namespace with this node's share of its data.
+func (s *HTTPServer) namespaceList() api.NamespacesResponse {
+	stats := s.storage.Stats()
+	response := api.NamespacesResponse{Namespaces: s.namespaces.list()}
+	for i, ns := range response.Namespaces {
+		response.Namespaces[i].Keys = stats.Namespaces[ns.Name].Keys
+		response.Namespaces[i].Bytes = stats.Namespaces[ns.Name].Bytes
+	}
+	return response
+}
+
+// dropNamespace forgets a namespace and deletes its keys from local storage.
+func (s *HTTPServer) dropNamespace(name string) {
+	s.namespaces.remove(name)
+	prefix := name + "/"
+	cursor := ""
+	for {
+		keys, next := s.storage.Scan(prefix, cursor, defaultScanPageSize)
+		for _, key := range keys {
+			if err := s.storeDelete(key); err != nil {
+				s.logger.Printf("failed to delete key: %s of namespace %s, error: %v\n", key, name, err)
+			}
+		}
+		if next == "" {
+			return
+		}
+		cursor = next
+	}
+}
+
+// broadcastNamespace applies a namespace change on every other ring member.
+// Members that miss it pick the registry up again when they next join.
+func (s *HTTPServer) broadcastNamespace(method string, ns api.Namespace) {
+	for nodeID, address := range s.ring.GetNodes() {
+		if nodeID == ring.NodeID(s.cfg.NodeID) {
+			continue
+		}
+		if err := s.sendNamespace(address, method, ns); err != nil {
+			s.logger.Printf("failed to send namespace %s to node %s: %v\n", ns.Name, nodeID, err)
+		}
+	}
+}
+
+func (s *HTTPServer) sendNamespace(address, method string, ns api.Namespace) error {
+	if method == http.MethodDelete {
+		return s.transport.DeleteNamespace(context.Background(), address, ns)
+	}
+	return s.transport.PutNamespace(context.Background(), address, ns)
+}
+
+// syncNamespaces copies the namespace registry of a seed.
+func (s *HTTPServer) syncNamespaces(address string) error {
+	namespaces, err := s.transport.Namespaces(context.Background(), address)
+	if err != nil {
+		return err
+	}
+	for _, ns := range namespaces {
+		s.namespaces.add(ns)
+	}
+	return nil
+}
+
+// handleInternalNamespaces applies namespace changes broadcast by peers.
+func (s *HTTPServer) handleInternalNamespaces(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/internal/namespaces"), "/")
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		s.writeJSON(w, api.NamespacesResponse{Namespaces: s.namespaces.list()})
+	case name != "" && r.Method == http.MethodPut:
+		var ns api.Namespace
+		if err := json.NewDecoder(r.Body).Decode(&ns); err != nil || ns.Name != name {
+			s.writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		s.namespaces.set(ns)
+		w.WriteHeader(http.StatusNoContent)
+	case name != "" && r.Method == http.MethodDelete:
+		s.dropNamespace(name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+	}
+}
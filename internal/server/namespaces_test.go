@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNamespaces(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.WriteQuorum = 1
+	s.cfg.ReadQuorum = 1
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do(http.MethodPut, "/kv/app/key", "value"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a namespace that was not created, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/kv/plain", "value"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the default namespace to accept writes, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/namespaces/app", ""); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a namespace, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/namespaces/app", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 creating an existing namespace, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/namespaces/a%2Fb", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid name, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/kv/app/key", "value"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 writing to a created namespace, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/namespaces", ""); !strings.Contains(rec.Body.String(), `"name":"app"`) || !strings.Contains(rec.Body.String(), `"keys":1`) {
+		t.Errorf("Expected app to be listed with one key, got %s", rec.Body.String())
+	}
+
+	if rec := do(http.MethodDelete, "/namespaces/app", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 deleting a namespace, got %d", rec.Code)
+	}
+	if _, ok := s.storage.Get("app/key"); ok {
+		t.Errorf("Expected keys of a deleted namespace to be removed")
+	}
+	if _, ok := s.storage.Get("plain"); !ok {
+		t.Errorf("Expected keys of other namespaces to survive")
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+)
+
+// Logger receives the messages the node logs. *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, args ...any)
+}
+
+// stdoutLogger prints messages to standard output, as the node does by
+// default.
+type stdoutLogger struct{}
+
+func (stdoutLogger) Printf(format string, args ...any) {
+	fmt.Printf(format, args...)
+}
+
+// Option replaces a dependency NewHTTPServer would otherwise build from the
+// config, so that embedders and tests can supply their own.
+type Option func(*HTTPServer)
+
+// WithStorage serves keys from store instead of an in-memory engine sized
+// by the config's memory limits.
+func WithStorage(store storage.Store) Option {
+	return func(s *HTTPServer) { s.storage = store }
+}
+
+// WithRing places the node on r instead of a new ring. The node joins r
+// itself, so r only needs to hold the peers known in advance.
+func WithRing(r *ring.Ring) Option {
+	return func(s *HTTPServer) { s.ring = r }
+}
+
+// WithClock timestamps writes and snapshots with hlc instead of a clock
+// backed by the system time.
+func WithClock(hlc *clock.HLC) Option {
+	return func(s *HTTPServer) { s.hlc = hlc }
+}
+
+// WithTransport sends requests to peers through transport instead of the
+// shared HTTP/2 peer transport. The peer timeout still applies.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(s *HTTPServer) { s.client.Transport = transport }
+}
+
+// WithPeerTransport sends requests to peers through t instead of the
+// transport cfg.PeerTransport names.
+func WithPeerTransport(t Transport) Option {
+	return func(s *HTTPServer) { s.transport = t }
+}
+
+// WithLogger sends the node's log messages to logger instead of standard
+// output.
+func WithLogger(logger Logger) Option {
+	return func(s *HTTPServer) { s.logger = logger }
+}
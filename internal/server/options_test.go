@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+)
+
+func TestServerOptions(t *testing.T) {
+	store := storage.NewSharded(storage.DefaultShards)
+	store.Versioned().PutVersioned("preloaded", storage.NewVersionedValue([]byte("value"), clock.VectorClock{"test-node": 1}))
+	r := ring.New(vnodesPerNode)
+	r.JoinNode("peer", "peer.invalid:80", 1)
+	hlc := clock.NewHLCWithClock(func() time.Time { return time.Unix(100, 0) })
+	var peerRequests atomic.Int32
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		peerRequests.Add(1)
+		return nil, errors.New("peer unreachable")
+	})
+	logger := &recordingLogger{}
+
+	cfg := &config.Config{NodeID: "test-node", BindAddr: "127.0.0.1:0", ReplicationFactor: 2, ReadQuorum: 1, WriteQuorum: 2}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Failed to validate config: %v", err)
+	}
+	s := NewHTTPServer(cfg, WithStorage(store), WithRing(r), WithClock(hlc), WithTransport(transport), WithLogger(logger))
+
+	if resp, err := s.Get(t.Context(), "preloaded"); err != nil || string(resp.Value) != "value" {
+		t.Errorf("Expected reads to be served from the given store, got %+v, %v", resp, err)
+	}
+	if nodes := r.GetNodes(); len(nodes) != 2 || nodes["test-node"] != cfg.BindAddr {
+		t.Errorf("Expected the node to join the given ring, got %v", nodes)
+	}
+	if got := s.hlc.Now(); got.WallTime != time.Unix(100, 0).UnixNano() {
+		t.Errorf("Expected timestamps from the given clock, got %+v", got)
+	}
+	if _, err := s.Put(t.Context(), "key", []byte("value"), 0); err == nil {
+		t.Errorf("Expected the write to fail without the peer")
+	}
+	if peerRequests.Load() == 0 {
+		t.Errorf("Expected peer requests to go through the given transport")
+	}
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if !slices.ContainsFunc(logger.lines, func(line string) bool { return strings.Contains(line, "peer unreachable") }) {
+		t.Errorf("Expected the failed write to be logged through the given logger, got %q", logger.lines)
+	}
+}
@@ -0,0 +1,288 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+	"github.com/amirderis/DHT/pkg/api/dhtpb"
+)
+
+// Every node serves the Replica gRPC service on BindAddr next to the
+// internal HTTP API: the listener hands requests with a gRPC content type
+// to it, so peers reach it at the address the ring already advertises.
+// With PeerTransport set to grpc, a node sends its replica reads and
+// writes, joins, leaves, pings and range listings over one long-lived gRPC
+// connection per peer instead of as JSON over HTTP. Either way it accepts
+// both, so a cluster can switch node by node.
+
+// servePeerGRPC passes gRPC requests to the peer gRPC server and every
+// other request to next.
+func (s *HTTPServer) servePeerGRPC(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			s.peerGRPC.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newPeerGRPCServer(s *HTTPServer) *grpc.Server {
+	srv := grpc.NewServer(s.grpcServerOptions()...)
+	dhtpb.RegisterReplicaServer(srv, &replicaService{s: s})
+	return srv
+}
+
+// peerConns keeps one gRPC connection per peer address.
+type peerConns struct {
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+	opts  []grpc.DialOption
+}
+
+func newPeerConns(maxMessageSize int) *peerConns {
+	return &peerConns{
+		conns: make(map[string]*grpc.ClientConn),
+		opts: []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMessageSize), grpc.MaxCallSendMsgSize(maxMessageSize)),
+		},
+	}
+}
+
+// client returns a Replica client on the connection to address, which
+// connects lazily on the first call.
+func (p *peerConns) client(address string) (dhtpb.ReplicaClient, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conn, ok := p.conns[address]
+	if !ok {
+		var err error
+		if conn, err = grpc.NewClient(address, p.opts...); err != nil {
+			return nil, err
+		}
+		p.conns[address] = conn
+	}
+	return dhtpb.NewReplicaClient(conn), nil
+}
+
+// drop closes the connection to an address a peer has moved away from.
+func (p *peerConns) drop(address string) {
+	p.mu.Lock()
+	conn, ok := p.conns[address]
+	delete(p.conns, address)
+	p.mu.Unlock()
+	if ok {
+		conn.Close()
+	}
+}
+
+func (p *peerConns) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for address, conn := range p.conns {
+		errs = append(errs, conn.Close())
+		delete(p.conns, address)
+	}
+	return errors.Join(errs...)
+}
+
+// stopPeers closes the transport's connections to peers.
+func (s *HTTPServer) stopPeers(context.Context) error {
+	return s.transport.Close()
+}
+
+// grpcTransport sends the requests the Replica service covers over gRPC,
+// and the rest over HTTP.
+type grpcTransport struct {
+	*httpTransport
+	conns   *peerConns
+	timeout time.Duration
+}
+
+func newGRPCTransport(httpT *httpTransport, maxMessageSize int, timeout time.Duration) *grpcTransport {
+	return &grpcTransport{httpTransport: httpT, conns: newPeerConns(maxMessageSize), timeout: timeout}
+}
+
+// peerClient returns the Replica client for address, with ctx bounded by
+// the peer timeout the HTTP client applies to every request.
+func (t *grpcTransport) peerClient(ctx context.Context, address string) (dhtpb.ReplicaClient, context.Context, context.CancelFunc, error) {
+	client, err := t.conns.client(address)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if t.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+t.token)
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	return client, ctx, cancel, nil
+}
+
+// writeError maps the failure of a replica write to the errors a
+// Transport returns for writes.
+func writeError(ctx context.Context, address string, err error) error {
+	switch {
+	case ctx.Err() != nil:
+		// A peer that ran out of the request's time is slow, not down
+		return fmt.Errorf("remote node %s: %w", address, ctx.Err())
+	case status.Code(err) == codes.ResourceExhausted:
+		return fmt.Errorf("remote node %s: %w", address, errReplicaBusy)
+	case status.Code(err) == codes.Unavailable, status.Code(err) == codes.DeadlineExceeded:
+		return fmt.Errorf("%w: %v", errUnreachable, err)
+	}
+	return fmt.Errorf("remote node %s: %v", address, err)
+}
+
+func (t *grpcTransport) Replicate(ctx context.Context, address string, req api.ReplicateRequest) error {
+	client, callCtx, cancel, err := t.peerClient(ctx, address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUnreachable, err)
+	}
+	defer cancel()
+	resp, err := client.Replicate(callCtx, dhtpb.FromReplicateRequest(req))
+	if err != nil {
+		return writeError(ctx, address, err)
+	}
+	return checkAck(address, sentAck(req.HintFor), resp.API())
+}
+
+func (t *grpcTransport) ReplicateBatch(ctx context.Context, address string, req api.ReplicateBatchRequest) error {
+	client, callCtx, cancel, err := t.peerClient(ctx, address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUnreachable, err)
+	}
+	defer cancel()
+	batch := &dhtpb.ReplicateBatchRequest{Items: make([]*dhtpb.ReplicateRequest, len(req.Items))}
+	for i, item := range req.Items {
+		batch.Items[i] = dhtpb.FromReplicateRequest(item)
+	}
+	resp, err := client.ReplicateBatch(callCtx, batch)
+	if err != nil {
+		return writeError(ctx, address, err)
+	}
+	return checkAck(address, api.AckApplied, resp.API())
+}
+
+func (t *grpcTransport) Get(ctx context.Context, address, key string) (api.ReplicateGetResponse, error) {
+	client, ctx, cancel, err := t.peerClient(ctx, address)
+	if err != nil {
+		return api.ReplicateGetResponse{}, err
+	}
+	defer cancel()
+	resp, err := client.Get(ctx, &dhtpb.ReplicateGetRequest{Key: key})
+	if err != nil {
+		return api.ReplicateGetResponse{}, err
+	}
+	return resp.API(), nil
+}
+
+func (t *grpcTransport) GetBatch(ctx context.Context, address string, keys []string) ([]api.ReplicateGetResponse, error) {
+	client, ctx, cancel, err := t.peerClient(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	resp, err := client.GetBatch(ctx, &dhtpb.ReplicateBatchGetRequest{Keys: keys})
+	if err != nil {
+		return nil, err
+	}
+	items := make([]api.ReplicateGetResponse, len(resp.Items))
+	for i, item := range resp.Items {
+		items[i] = item.API()
+	}
+	return items, nil
+}
+
+func (t *grpcTransport) Join(ctx context.Context, address string, self api.Member) (api.Member, error) {
+	client, ctx, cancel, err := t.peerClient(ctx, address)
+	if err != nil {
+		return api.Member{}, err
+	}
+	defer cancel()
+	var trailer metadata.MD
+	peer, err := client.Join(ctx, dhtpb.FromMember(self), grpc.Trailer(&trailer))
+	if status.Code(err) == codes.ResourceExhausted {
+		if values := trailer.Get(retryAfterTrailer); len(values) > 0 {
+			if seconds, err := strconv.Atoi(values[0]); err == nil && seconds > 0 {
+				return api.Member{}, &joinThrottledError{time.Duration(seconds) * time.Second}
+			}
+		}
+	}
+	if err != nil {
+		return api.Member{}, fmt.Errorf("seed %s: %w", address, err)
+	}
+	return peer.API(), nil
+}
+
+func (t *grpcTransport) Leave(ctx context.Context, address string, self api.Member) error {
+	client, ctx, cancel, err := t.peerClient(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	_, err = client.Leave(ctx, dhtpb.FromMember(self))
+	return err
+}
+
+func (t *grpcTransport) Ping(ctx context.Context, address string) error {
+	client, ctx, cancel, err := t.peerClient(ctx, address)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	_, err = client.Ping(ctx, &dhtpb.PingRequest{})
+	return err
+}
+
+// ListRange streams the listing rather than receiving it as one response.
+func (t *grpcTransport) ListRange(ctx context.Context, address string, tr ring.TokenRange) (api.RangeListing, int, error) {
+	client, ctx, cancel, err := t.peerClient(ctx, address)
+	if err != nil {
+		return api.RangeListing{}, 0, err
+	}
+	defer cancel()
+	stream, err := client.ListRange(ctx, &dhtpb.ListRangeRequest{Start: tr.Start, End: tr.End})
+	if err != nil {
+		return api.RangeListing{}, 0, err
+	}
+	listing := api.RangeListing{Entries: []api.RangeEntry{}}
+	size := 0
+	for {
+		entry, err := stream.Recv()
+		if err == io.EOF {
+			return listing, size, nil
+		}
+		if err != nil {
+			return api.RangeListing{}, 0, err
+		}
+		size += proto.Size(entry)
+		listing.Entries = append(listing.Entries, entry.API())
+	}
+}
+
+func (t *grpcTransport) Forget(address string) {
+	t.conns.drop(address)
+	t.httpTransport.Forget(address)
+}
+
+func (t *grpcTransport) Close() error {
+	t.httpTransport.Close()
+	return t.conns.close()
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"errors"
+	"hash/crc32"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/internal/membership"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+)
+
+func TestPeerGRPCTransport(t *testing.T) {
+	overGRPC := func(cfg *config.Config) { cfg.PeerTransport = config.PeerTransportGRPC }
+	a, _ := startTestNodeWith(t, "a", overGRPC)
+	b, _ := startTestNodeWith(t, "b", overGRPC)
+	for _, s := range []*HTTPServer{a, b} {
+		t.Cleanup(func() { s.transport.Close() })
+	}
+
+	// b joins through a over the Replica service on a's HTTP listener
+	peer, err := b.sendJoin(a.cfg.BindAddr)
+	if err != nil {
+		t.Fatalf("Failed to join over gRPC: %v", err)
+	}
+	if peer.NodeID != "a" || peer.Address != a.cfg.BindAddr {
+		t.Errorf("Expected the seed to answer as a, got %+v", peer)
+	}
+	if address, ok := a.ring.GetNodeAddress("b"); !ok || address != b.cfg.BindAddr {
+		t.Errorf("Expected a to admit b at %s, got %q", b.cfg.BindAddr, address)
+	}
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+
+	if _, err := a.put(t.Context(), "key", []byte("value"), nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Failed to put over gRPC: %v", err)
+	}
+	if value, ok := b.storage.Get("key"); !ok || string(value) != "value" {
+		t.Errorf("Expected the write to reach b, got %q", value)
+	}
+	resp, err := a.readFromRemoteNode(t.Context(), b.cfg.BindAddr, "key")
+	if err != nil || !resp.Found || string(resp.Value) != "value" {
+		t.Errorf("Expected a remote read over gRPC, got %+v, %v", resp, err)
+	}
+	listing, n, err := a.fetchRangeListing(t.Context(), b.cfg.BindAddr, ring.TokenRange{})
+	if err != nil || len(listing.Entries) != 1 || listing.Entries[0].Key != "key" || n == 0 {
+		t.Errorf("Expected b to stream its one key, got %+v, %d, %v", listing, n, err)
+	}
+
+	a.cluster.MarkDead("b")
+	a.probeDead()
+	if a.cluster.State("b") == membership.Dead {
+		t.Errorf("Expected a gRPC ping to bring b back")
+	}
+
+	value := &storage.VersionedValue{Value: []byte("busy"), Version: map[string]uint64{"a": 9}, Checksum: crc32.ChecksumIEEE([]byte("busy"))}
+	for b.replicaLimit.tryAcquire() {
+	}
+	if err := a.sendReplica(t.Context(), b.cfg.BindAddr, "busy", value, ""); !errors.Is(err, errReplicaBusy) {
+		t.Errorf("Expected a busy replica over gRPC, got %v", err)
+	}
+	for range len(b.replicaLimit.slots) {
+		b.replicaLimit.release()
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+	if err := a.sendReplica(t.Context(), closed, "key", value, ""); !errors.Is(err, errUnreachable) {
+		t.Errorf("Expected a closed port to be unreachable, got %v", err)
+	}
+}
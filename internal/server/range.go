@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A GET with a Range header naming a single byte range of the value is
+// answered 206 with those bytes alone rather than the JSON response. For a
+// chunked value the coordinator reads only the chunks the range overlaps,
+// so a client can fetch or resume a large value piece by piece. The ETag
+// identifies the value the bytes came from; a client stitching parts
+// together restarts when it changes. Any other Range header is ignored.
+
+// byteRange is the one range of a Range header. A suffix range
+// ("bytes=-500") has first < 0 and last holding its length; an open range
+// ("bytes=500-") has last < 0.
+type byteRange struct {
+	first, last int
+}
+
+// parseByteRange reads a Range header naming a single byte range.
+func parseByteRange(header string) (byteRange, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return byteRange{}, false
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return byteRange{}, false
+	}
+	if first == "" {
+		length, err := strconv.Atoi(last)
+		if err != nil || length < 0 {
+			return byteRange{}, false
+		}
+		return byteRange{-1, length}, true
+	}
+	start, err := strconv.Atoi(first)
+	if err != nil || start < 0 {
+		return byteRange{}, false
+	}
+	if last == "" {
+		return byteRange{start, -1}, true
+	}
+	end, err := strconv.Atoi(last)
+	if err != nil || end < start {
+		return byteRange{}, false
+	}
+	return byteRange{start, end}, true
+}
+
+// resolve returns the half-open span of a size-byte value the range
+// covers, or false when it covers none of it.
+func (br byteRange) resolve(size int) (start, end int, ok bool) {
+	switch {
+	case br.first < 0:
+		if br.last == 0 || size == 0 {
+			return 0, 0, false
+		}
+		return max(0, size-br.last), size, true
+	case br.first >= size:
+		return 0, 0, false
+	case br.last < 0:
+		return br.first, size, true
+	}
+	return br.first, min(br.last, size-1) + 1, true
+}
+
+// errRangeNotSatisfiable reports a range beyond the end of the value.
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// valueRange is the part of a value a range read returns.
+type valueRange struct {
+	data  []byte
+	start int
+	size  int // of the whole value
+	etag  string
+}
+
+// handleRangeGet serves a GET of key carrying a single byte range.
+func (s *HTTPServer) handleRangeGet(ctx context.Context, w http.ResponseWriter, key string, br byteRange, readQuorum int, sess session) {
+	if err := s.checkStandby(); err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	if err := s.checkNamespace(key); err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	response, err := s.getValue(ctx, key, readQuorum)
+	if err == nil {
+		response, err = s.readYourWrites(ctx, key, sess, response, s.getValue)
+	}
+	if err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	if !response.Found {
+		response.Key = clientKey(ctx, response.Key)
+		w.WriteHeader(http.StatusNotFound)
+		s.writeJSON(w, response)
+		return
+	}
+	part, err := s.readRange(ctx, key, response.Value, br, readQuorum)
+	if errors.Is(err, errRangeNotSatisfiable) {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", part.size))
+		s.writeError(w, http.StatusRequestedRangeNotSatisfiable, fmt.Sprintf("%s for %d bytes", err, part.size))
+		return
+	}
+	if err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	s.metrics.Count("range_reads", 1)
+	setCausalContext(w, response)
+	setAttributeHeaders(w, response)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", part.start, part.start+len(part.data)-1, part.size))
+	w.Header().Set("Content-Length", strconv.Itoa(len(part.data)))
+	w.Header().Set("ETag", `"`+part.etag+`"`)
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(part.data)
+}
+
+// readRange returns the part of a stored value br covers. Like a full
+// read, a chunked value falls back to the value it replaced when the
+// chunks of a partially replicated write are incomplete.
+func (s *HTTPServer) readRange(ctx context.Context, key string, stored []byte, br byteRange, readQuorum int) (valueRange, error) {
+	if !isManifest(stored) {
+		start, end, ok := br.resolve(len(stored))
+		if !ok {
+			return valueRange{size: len(stored)}, errRangeNotSatisfiable
+		}
+		sum := sha256.Sum256(stored)
+		return valueRange{stored[start:end], start, len(stored), hex.EncodeToString(sum[:])}, nil
+	}
+
+	m, err := decodeManifest(stored)
+	if err != nil {
+		return valueRange{}, &opError{http.StatusInternalServerError, "corrupt chunk manifest for key: " + key}
+	}
+	part, err := s.manifestRange(ctx, key, m, br, readQuorum)
+	var torn *tornValueError
+	if !errors.As(err, &torn) {
+		return part, err
+	}
+	s.metrics.Count("torn_reads", 1)
+	if m.Previous != nil {
+		if previous, prevErr := s.manifestRange(ctx, key, *m.Previous, br, readQuorum); prevErr == nil {
+			s.logger.Printf("%v, returning the previous value\n", torn)
+			return previous, nil
+		}
+	}
+	return valueRange{}, &opError{http.StatusServiceUnavailable, torn.Error()}
+}
+
+// manifestRange reads the part of the value m describes that br covers.
+func (s *HTTPServer) manifestRange(ctx context.Context, key string, m chunkManifest, br byteRange, readQuorum int) (valueRange, error) {
+	start, end, ok := br.resolve(m.Size)
+	if !ok {
+		return valueRange{size: m.Size}, errRangeNotSatisfiable
+	}
+	data, err := s.chunkRange(ctx, key, m, start, end, readQuorum)
+	if err != nil {
+		return valueRange{}, err
+	}
+	return valueRange{data, start, m.Size, m.Digest}, nil
+}
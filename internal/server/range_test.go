@@ -0,0 +1,80 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRangeReads(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.WriteQuorum = 1
+	s.cfg.ReadQuorum = 1
+	s.cfg.ChunkSize = 4
+
+	get := func(key, byteRange string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/kv/"+key, nil)
+		req.Header.Set("Range", byteRange)
+		s.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	for _, key := range []string{"big", "small"} {
+		value := "0123456789"
+		if key == "small" {
+			s.cfg.ChunkSize = 1 << 20
+		}
+		if _, err := s.put(t.Context(), key, []byte(value), nil, 1, time.Time{}); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+		sum := sha256.Sum256([]byte(value))
+		for byteRange, want := range map[string]string{
+			"bytes=3-5":  "bytes 3-5/10 345",
+			"bytes=7-":   "bytes 7-9/10 789",
+			"bytes=-2":   "bytes 8-9/10 89",
+			"bytes=8-99": "bytes 8-9/10 89",
+			"bytes=-99":  "bytes 0-9/10 0123456789",
+			// the largest end a range can give
+			"bytes=0-9223372036854775807": "bytes 0-9/10 0123456789",
+		} {
+			rec := get(key, byteRange)
+			if rec.Code != http.StatusPartialContent {
+				t.Fatalf("Expected 206 for %s of %s, got %d: %s", byteRange, key, rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Get("Content-Range") + " " + rec.Body.String(); got != want {
+				t.Errorf("Expected %q for %s of %s, got %q", want, byteRange, key, got)
+			}
+			if etag := rec.Header().Get("ETag"); etag != `"`+hex.EncodeToString(sum[:])+`"` {
+				t.Errorf("Expected the value digest as ETag of %s, got %s", key, etag)
+			}
+		}
+		rec := get(key, "bytes=10-")
+		if rec.Code != http.StatusRequestedRangeNotSatisfiable || rec.Header().Get("Content-Range") != "bytes */10" {
+			t.Errorf("Expected 416 past the end of %s, got %d %q", key, rec.Code, rec.Header().Get("Content-Range"))
+		}
+		if rec := get(key, "bytes=0-1,4-5"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"found":true`) {
+			t.Errorf("Expected several ranges to be ignored for %s, got %d", key, rec.Code)
+		}
+	}
+
+	// Only the chunks a range overlaps are read
+	manifest, _ := s.storage.Get("big")
+	m, err := decodeManifest(manifest)
+	if err != nil {
+		t.Fatalf("Failed to decode manifest: %v", err)
+	}
+	s.storage.Delete(m.chunkKey("big", 0))
+	if rec := get("big", "bytes=4-9"); rec.Code != http.StatusPartialContent || rec.Body.String() != "456789" {
+		t.Errorf("Expected the range to skip the lost chunk, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := get("big", "bytes=2-5"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 for a range over the lost chunk, got %d", rec.Code)
+	}
+	if rec := get("missing", "bytes=0-1"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing key, got %d", rec.Code)
+	}
+}
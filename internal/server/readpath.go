@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// Read paths counted in /stats and metrics, from cheapest to most expensive.
+const (
+	// readPathLocal answers from local storage without contacting peers.
+	readPathLocal = "local"
+	// readPathBounded answers from a single replica, possibly remote, that
+	// synced with its peers within the staleness bound of the read.
+	readPathBounded = "bounded"
+	// readPathDigest answers from local storage after peers confirmed the
+	// value by digest, so no peer transfers the value.
+	readPathDigest = "digest"
+	// readPathQuorum fetches the value from readQuorum replicas.
+	readPathQuorum = "quorum"
+)
+
+func (s *HTTPServer) countRead(path string) {
+	switch path {
+	case readPathLocal:
+		s.stats.localReads.Add(1)
+	case readPathBounded:
+		s.stats.boundedReads.Add(1)
+	case readPathDigest:
+		s.stats.digestReads.Add(1)
+	case readPathQuorum:
+		s.stats.quorumReads.Add(1)
+	}
+	s.metrics.Count("reads_"+path, 1)
+}
+
+// valueDigest identifies a stored value in replica metadata.
+func valueDigest(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+// digestRead serves key from this node, which is in the preference list,
+// once readQuorum-1 other replicas report the same digest. It returns false
+// as soon as a replica disagrees or too few replicas answer, and the caller
+// falls back to a full quorum read that can resolve the difference.
+func (s *HTTPServer) digestRead(ctx context.Context, key string, preferenceList []ring.NodeID, readQuorum int) (api.GetResponse, bool) {
+	timings := timingsFrom(ctx)
+	started := time.Now()
+	local, found := s.localRead(key)
+	timings.since("local", started)
+	if local.Corrupt {
+		return api.GetResponse{}, false
+	}
+	// The clocks of every version tell apart replicas that hold the same
+	// value with different siblings
+	digest, context := valueDigest(local.Value), readContext(local)
+	count := s.quorumFor(ctx, readQuorum, preferenceList, false)
+	confirmed := 0
+	if count.counts(ring.NodeID(s.cfg.NodeID)) {
+		confirmed++
+	}
+	for _, nodeID := range preferenceList {
+		if count.met(confirmed) {
+			break
+		}
+		if nodeID == ring.NodeID(s.cfg.NodeID) {
+			continue
+		}
+		started := time.Now()
+		meta := s.replicaMetadata(ctx, nodeID, key)
+		timings.replica(nodeID, started)
+		if meta.Error != "" {
+			continue
+		}
+		if meta.Corrupt || meta.Found != found || (found && (meta.Digest != digest || !clock.Equal(meta.Version, context))) {
+			return api.GetResponse{}, false
+		}
+		if count.counts(nodeID) {
+			confirmed++
+		}
+	}
+	if !count.met(confirmed) {
+		return api.GetResponse{}, false
+	}
+	s.synced.note()
+	return readResponse(key, local), true
+}
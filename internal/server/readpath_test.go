@@ -0,0 +1,61 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadPaths(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+
+	if _, err := a.put(t.Context(), "key", []byte("value"), nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if resp, err := a.get(t.Context(), "key", 2); err != nil || string(resp.Value) != "value" {
+		t.Fatalf("Expected value from digest read, got %+v, %v", resp, err)
+	}
+	if got := a.stats.digestReads.Value(); got != 1 {
+		t.Errorf("Expected matching replicas to take the digest path, got %d", got)
+	}
+
+	b.storage.Put("key", []byte("diverged"))
+	if _, err := a.get(t.Context(), "key", 2); err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	if got := a.stats.quorumReads.Value(); got != 1 {
+		t.Errorf("Expected diverged replicas to fall back to a quorum read, got %d", got)
+	}
+
+	if _, err := a.get(t.Context(), "key", 1); err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	if got := a.stats.localReads.Value(); got != 1 {
+		t.Errorf("Expected R=1 to be served locally, got %d", got)
+	}
+}
+
+func TestReadRepair(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+
+	if _, err := a.put(t.Context(), "key", []byte("value"), nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	b.storage.Put("key", []byte("diverged"))
+	if resp, err := a.get(t.Context(), "key", 2); err != nil || string(resp.Value) != "value" {
+		t.Fatalf("Expected the newest version from a quorum read, got %+v, %v", resp, err)
+	}
+
+	for deadline := time.Now().Add(time.Second); a.stats.readRepairs.Value() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if got := a.stats.readRepairs.Value(); got != 1 {
+		t.Fatalf("Expected the stale replica to be repaired, got %d repairs", got)
+	}
+	if value, _ := b.storage.Get("key"); string(value) != "value" {
+		t.Errorf("Expected the repaired replica to hold the newest value, got %q", value)
+	}
+}
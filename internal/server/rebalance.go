@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// Bootstrap and decommission publish their progress to the watch hub as
+// rebalance events, which GET /admin/rebalance/watch streams like a key
+// watch, cursors included. Dashboards and dhtctl rebalance follow moves
+// with it instead of polling the status endpoints.
+
+// rangeName writes tr as rebalance events and errors show it.
+func rangeName(tr ring.TokenRange) string {
+	return fmt.Sprintf("(%s, %s]", rangeBound(tr.Start), rangeBound(tr.End))
+}
+
+// publishBootstrap publishes an event of the bootstrap with its status now.
+func (s *HTTPServer) publishBootstrap(eventType string, tr *ring.TokenRange, err error) {
+	status := s.bootstrapStatus()
+	s.publishRebalance(api.RebalanceEvent{
+		Operation: api.RebalanceBootstrap,
+		Type:      eventType,
+		State:     status.State,
+		Ranges:    status.Ranges,
+		Moved:     status.Streamed,
+		Keys:      status.Keys,
+		Bytes:     status.Bytes,
+	}, tr, err)
+}
+
+// publishDecommission publishes an event of the decommission with its
+// status now.
+func (s *HTTPServer) publishDecommission(eventType string, tr *ring.TokenRange, err error) {
+	status := s.decommissionStatus()
+	s.publishRebalance(api.RebalanceEvent{
+		Operation: api.RebalanceDecommission,
+		Type:      eventType,
+		State:     status.State,
+		Ranges:    status.Ranges,
+		Moved:     status.HandedOff,
+		Keys:      status.Keys,
+		Bytes:     status.Bytes,
+	}, tr, err)
+}
+
+func (s *HTTPServer) publishRebalance(event api.RebalanceEvent, tr *ring.TokenRange, err error) {
+	event.NodeID = s.cfg.NodeID
+	event.Time = time.Now().UTC()
+	if tr != nil {
+		event.Range = rangeName(*tr)
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	event.Percent = 100
+	if event.Ranges > 0 {
+		event.Percent = 100 * float64(event.Moved) / float64(event.Ranges)
+	}
+	s.watches.publish(watchEvent{rebalance: &event})
+}
+
+// handleRebalanceWatch serves GET /admin/rebalance/watch, the rebalance
+// events of this node as server-sent events.
+func (s *HTTPServer) handleRebalanceWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	s.handleWatch(w, r, &watcher{rebalance: true})
+}
@@ -0,0 +1,540 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/membership"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// Anti-entropy repairs the token ranges this node is the primary replica
+// of, one at a time, so that replicas converge even on keys nobody reads.
+// It starts a repair every RepairInterval divided by the number of those
+// ranges, picking the range repaired longest ago, and keeps at most
+// RepairConcurrency running. A repair compares this node's listing of the
+// range with every other replica's and pushes or pulls each key one side
+// lacks or holds an older version of, with the transfers of all repairs
+// together held to RepairRate bytes per second.
+
+// repairScheduler tracks the anti-entropy state of every token range.
+type repairScheduler struct {
+	mu       sync.Mutex
+	last     map[ring.TokenRange]api.RangeRepair // outcome of the last repair
+	running  map[ring.TokenRange]bool
+	throttle byteThrottle
+	bytes    int64
+}
+
+func newRepairScheduler(rate int64) *repairScheduler {
+	return &repairScheduler{
+		last:     make(map[ring.TokenRange]api.RangeRepair),
+		running:  make(map[ring.TokenRange]bool),
+		throttle: byteThrottle{rate: rate},
+	}
+}
+
+// byteThrottle spreads transfers so that they average at most rate bytes
+// per second.
+type byteThrottle struct {
+	mu   sync.Mutex
+	rate int64
+	next time.Time
+}
+
+// pace accounts n transferred bytes and returns how long the caller must
+// wait before transferring more. A rate of zero does not throttle.
+func (t *byteThrottle) pace(n int, now time.Time) time.Duration {
+	if t.rate <= 0 {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	t.next = t.next.Add(time.Duration(int64(n) * int64(time.Second) / t.rate))
+	return t.next.Sub(now)
+}
+
+// runAntiEntropy starts range repairs until stop is closed.
+func (s *HTTPServer) runAntiEntropy(stop <-chan struct{}) {
+	if s.cfg.RepairInterval < 0 {
+		return
+	}
+	// Stopping abandons the repairs in progress
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for {
+		pause := s.cfg.RepairInterval / time.Duration(max(1, len(s.primaryRanges())))
+		select {
+		case <-time.After(pause):
+		case <-stop:
+			return
+		}
+		// A standby shares its primary's ID but none of its ranges yet
+		if s.isStandby() || !s.allowJob("anti_entropy", time.Now()) {
+			continue
+		}
+		tr, ok := s.nextRepair()
+		if !ok {
+			continue
+		}
+		go s.repairRange(ctx, tr)
+	}
+}
+
+// primaryRanges returns the token ranges this node is the primary replica of.
+func (s *HTTPServer) primaryRanges() []ring.TokenRange {
+	var ranges []ring.TokenRange
+	for _, tr := range s.ring.Ranges() {
+		replicas, err := s.ring.RangeReplicas(tr, 1)
+		if err == nil && replicas[0] == ring.NodeID(s.cfg.NodeID) {
+			ranges = append(ranges, tr)
+		}
+	}
+	return ranges
+}
+
+// nextRepair claims the range to repair next, the one repaired longest
+// ago, unless RepairConcurrency repairs are already running.
+func (s *HTTPServer) nextRepair() (ring.TokenRange, bool) {
+	ranges := s.primaryRanges()
+	s.repairs.mu.Lock()
+	defer s.repairs.mu.Unlock()
+	if len(s.repairs.running) >= s.cfg.RepairConcurrency {
+		return ring.TokenRange{}, false
+	}
+	var next ring.TokenRange
+	var oldest time.Time
+	found := false
+	for _, tr := range ranges {
+		if s.repairs.running[tr] {
+			continue
+		}
+		at := s.repairs.last[tr].LastRepaired
+		if !found || at.Before(oldest) {
+			next, oldest, found = tr, at, true
+		}
+	}
+	if found {
+		s.repairs.running[next] = true
+	}
+	return next, found
+}
+
+// repairRange brings every replica of tr up to date with this node and
+// this node with them, and records the outcome.
+func (s *HTTPServer) repairRange(ctx context.Context, tr ring.TokenRange) (result api.RangeRepair) {
+	result = api.RangeRepair{Start: rangeBound(tr.Start), End: rangeBound(tr.End)}
+	defer func() {
+		result.LastRepaired = time.Now()
+		s.repairs.mu.Lock()
+		s.repairs.last[tr] = result
+		delete(s.repairs.running, tr)
+		s.repairs.mu.Unlock()
+		s.metrics.Count("repair_ranges", 1)
+		s.metrics.Count("repair_keys_pushed", int64(result.Pushed))
+		s.metrics.Count("repair_keys_pulled", int64(result.Pulled))
+	}()
+
+	replicas, err := s.ring.RangeReplicas(tr, s.cfg.ReplicationFactor)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	for _, nodeID := range replicas {
+		result.Replicas = append(result.Replicas, string(nodeID))
+	}
+	keys := make(map[string]bool)
+	for _, nodeID := range replicas {
+		if nodeID == ring.NodeID(s.cfg.NodeID) {
+			continue
+		}
+		// Writes for a dead replica are kept as hints and handed off
+		// when it comes back
+		address, exists := s.ring.GetNodeAddress(nodeID)
+		if !exists || s.cluster.State(string(nodeID)) == membership.Dead {
+			continue
+		}
+		if err := s.repairWith(ctx, tr, address, keys, &result); err != nil {
+			if result.Error == "" {
+				result.Error = fmt.Sprintf("replica %s: %v", nodeID, err)
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	result.Keys = len(keys)
+	return result
+}
+
+// repairWith reconciles tr with the replica at address, adding the keys
+// compared to keys.
+func (s *HTTPServer) repairWith(ctx context.Context, tr ring.TokenRange, address string, keys map[string]bool, result *api.RangeRepair) error {
+	remote, n, err := s.fetchRangeListing(ctx, address, tr)
+	if err != nil {
+		return err
+	}
+	if err := s.paceRepair(ctx, n); err != nil {
+		return err
+	}
+	local := s.rangeListing(tr)
+	versions := make(map[string]clock.VectorClock, len(local.Entries))
+	siblings := make(map[string]int, len(local.Entries))
+	for _, entry := range local.Entries {
+		versions[entry.Key] = entry.Version
+		siblings[entry.Key] = entry.Siblings
+		keys[entry.Key] = true
+	}
+	remoteKeys := make(map[string]bool, len(remote.Entries))
+
+	var firstErr error
+	for _, entry := range remote.Entries {
+		remoteKeys[entry.Key] = true
+		keys[entry.Key] = true
+		mine, held := versions[entry.Key]
+		theirs := clock.VectorClock(entry.Version)
+		if held && clock.Equal(mine, theirs) && siblings[entry.Key] == entry.Siblings {
+			continue
+		}
+		push := held && clock.Compare(mine, theirs) > 0
+		if !push {
+			// Missing here, older, or concurrent: take the replica's
+			// versions, which join concurrent ones here as siblings, and
+			// send the result back unless they were simply newer
+			if err := s.pullKey(ctx, address, entry.Key); err != nil {
+				firstErr = firstError(firstErr, err)
+				continue
+			}
+			result.Pulled++
+			push = held && clock.Compare(mine, theirs) == 0
+		}
+		if push {
+			if err := s.pushKey(ctx, address, entry.Key); err != nil {
+				firstErr = firstError(firstErr, err)
+				continue
+			}
+			result.Pushed++
+		}
+	}
+	for _, entry := range local.Entries {
+		if remoteKeys[entry.Key] {
+			continue
+		}
+		if err := s.pushKey(ctx, address, entry.Key); err != nil {
+			firstErr = firstError(firstErr, err)
+			continue
+		}
+		result.Pushed++
+	}
+	return firstErr
+}
+
+// firstError keeps the first of two errors.
+func firstError(first, err error) error {
+	if first != nil {
+		return first
+	}
+	return err
+}
+
+// pullKey stores the replica's version of key here.
+func (s *HTTPServer) pullKey(ctx context.Context, address, key string) error {
+	n, err := s.copyKey(ctx, address, key)
+	if err != nil {
+		return err
+	}
+	return s.paceRepair(ctx, n)
+}
+
+// copyKey stores the version of key held by the node at address here and
+// returns the size of its value.
+func (s *HTTPServer) copyKey(ctx context.Context, address, key string) (int, error) {
+	resp, err := s.readFromRemoteNode(ctx, address, key)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Corrupt {
+		// Another replica may hold a sound copy
+		return 0, fmt.Errorf("key %s at %s: %w", key, address, storage.ErrCorrupt)
+	}
+	if !versioned(resp) {
+		return 0, nil
+	}
+	value := replicaValue(resp.Value, resp.Version, resp)
+	value.Tombstone = resp.Tombstone
+	if err := s.storeVersioned(key, value); err != nil && !errors.Is(err, storage.ErrStaleVersion) {
+		return 0, err
+	}
+	n := len(resp.Value)
+	for _, sibling := range resp.Siblings {
+		n += len(sibling.Value)
+	}
+	return n, nil
+}
+
+// pushKey sends this node's version of key to the replica.
+func (s *HTTPServer) pushKey(ctx context.Context, address, key string) error {
+	value, ok := s.versions.GetVersioned(key)
+	if !ok {
+		return nil
+	}
+	if err := s.writeToRemoteNode(ctx, address, key, value); err != nil && !errors.Is(err, storage.ErrStaleVersion) {
+		return err
+	}
+	return s.paceRepair(ctx, len(value.Value))
+}
+
+// paceRepair accounts n bytes of repair traffic and waits as long as the
+// repair rate asks.
+func (s *HTTPServer) paceRepair(ctx context.Context, n int) error {
+	s.repairs.mu.Lock()
+	s.repairs.bytes += int64(n)
+	s.repairs.mu.Unlock()
+	s.metrics.Count("repair_bytes", int64(n))
+	wait := s.repairs.throttle.pace(n, time.Now())
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rangeListing lists the keys this node holds in tr, tombstones included.
+func (s *HTTPServer) rangeListing(tr ring.TokenRange) api.RangeListing {
+	entries, _ := s.versions.Scan("", "", 0)
+	listing := api.RangeListing{Entries: []api.RangeEntry{}}
+	for _, entry := range entries {
+		if tr.Contains(ring.KeyHash(entry.Key)) {
+			listing.Entries = append(listing.Entries, api.RangeEntry{
+				Key:       entry.Key,
+				Version:   entry.Version,
+				Tombstone: entry.Tombstone,
+				Timestamp: entry.Timestamp,
+				ExpiresAt: entry.ExpiresAt,
+				Checksum:  entry.Checksum,
+				Siblings:  entry.Siblings,
+			})
+		}
+	}
+	return listing
+}
+
+// rangeEntry is the listing entry of value, stored under key.
+func rangeEntry(key string, value *storage.VersionedValue) api.RangeEntry {
+	return api.RangeEntry{
+		Key:       key,
+		Version:   value.Context(),
+		Tombstone: value.Tombstone,
+		Timestamp: value.Timestamp,
+		ExpiresAt: value.ExpiresAt,
+		Checksum:  value.Checksum,
+		Siblings:  len(value.Siblings),
+	}
+}
+
+// rangeDigest hashes range listing entries in key order, metadata and all,
+// so that two nodes holding the same copies agree on it. A tombstone's
+// checksum is left out, as tombstones are copied without their value.
+func rangeDigest(entries []api.RangeEntry) string {
+	sorted := slices.SortedFunc(slices.Values(entries), func(a, b api.RangeEntry) int { return strings.Compare(a.Key, b.Key) })
+	h := sha256.New()
+	for _, e := range sorted {
+		checksum := e.Checksum
+		if e.Tombstone {
+			checksum = 0
+		}
+		fmt.Fprintf(h, "%q %s %t %s %s %d %d\n", e.Key, clock.VectorClock(e.Version), e.Tombstone, e.Timestamp.UTC().Format(time.RFC3339Nano), e.ExpiresAt.UTC().Format(time.RFC3339Nano), checksum, e.Siblings)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fetchRangeListing asks the replica at address for its listing of tr and
+// reports the size of the response.
+func (s *HTTPServer) fetchRangeListing(ctx context.Context, address string, tr ring.TokenRange) (api.RangeListing, int, error) {
+	return s.transport.ListRange(ctx, address, tr)
+}
+
+// handleInternalRange serves a replica's listing of one token range.
+func (s *HTTPServer) handleInternalRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	start, err := strconv.ParseUint(r.URL.Query().Get("start"), 10, 64)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid range start")
+		return
+	}
+	end, err := strconv.ParseUint(r.URL.Query().Get("end"), 10, 64)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid range end")
+		return
+	}
+	s.writeJSON(w, s.rangeListing(ring.TokenRange{Start: start, End: end}))
+}
+
+// handleRepair serves POST /admin/repair, which repairs token ranges this
+// node replicates right away and reports what it took. It repairs the
+// ranges overlapping the one between the hex ring positions start and end,
+// given as /admin/repair/status lists them, or the range holding key, or
+// with neither every range the node replicates. The repair runs for as
+// long as the request, paced by RepairRate, and skips the ranges
+// anti-entropy is repairing at the time. A full repair can take far longer
+// than the listener's timeouts, so it holds the connection's deadlines
+// open until the report is written.
+func (s *HTTPServer) handleRepair(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	target, err := repairTarget(r.URL.Query())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ranges := s.replicatedRanges(target)
+	if len(ranges) == 0 {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("node replicates no token range in (%s, %s]", rangeBound(target.Start), rangeBound(target.End)))
+		return
+	}
+	release := holdDeadlines(http.NewResponseController(w))
+	defer release()
+	report := api.RepairReport{NodeID: s.cfg.NodeID, Ranges: make([]api.RangeRepair, 0, len(ranges))}
+	for _, tr := range ranges {
+		if !s.claimRepair(tr) {
+			report.Ranges = append(report.Ranges, api.RangeRepair{Start: rangeBound(tr.Start), End: rangeBound(tr.End), Running: true, Error: "already being repaired"})
+			continue
+		}
+		result := s.repairRange(r.Context(), tr)
+		report.Ranges = append(report.Ranges, result)
+		report.Keys += result.Keys
+		report.Pushed += result.Pushed
+		report.Pulled += result.Pulled
+	}
+	s.logger.Printf("repaired %d token ranges on request: %d keys compared, %d pushed, %d pulled\n", len(ranges), report.Keys, report.Pushed, report.Pulled)
+	s.writeJSON(w, report)
+}
+
+// repairTarget returns the part of the ring a repair request asks for, the
+// whole ring if it names none.
+func repairTarget(query url.Values) (ring.TokenRange, error) {
+	key, start, end := query.Get("key"), query.Get("start"), query.Get("end")
+	switch {
+	case key != "" && (start != "" || end != ""):
+		return ring.TokenRange{}, errors.New("give either a key or a token range, not both")
+	case key != "":
+		hash := ring.KeyHash(key)
+		return ring.TokenRange{Start: hash - 1, End: hash}, nil
+	case start == "" && end == "":
+		return ring.TokenRange{}, nil
+	}
+	var tr ring.TokenRange
+	var err error
+	if tr.Start, err = strconv.ParseUint(start, 16, 64); err != nil {
+		return ring.TokenRange{}, errors.New("invalid range start")
+	}
+	if tr.End, err = strconv.ParseUint(end, 16, 64); err != nil {
+		return ring.TokenRange{}, errors.New("invalid range end")
+	}
+	return tr, nil
+}
+
+// replicatedRanges returns the token ranges overlapping target that this
+// node is a replica of.
+func (s *HTTPServer) replicatedRanges(target ring.TokenRange) []ring.TokenRange {
+	var ranges []ring.TokenRange
+	for _, tr := range s.ring.Ranges() {
+		if !tr.Overlaps(target) {
+			continue
+		}
+		replicas, err := s.ring.RangeReplicas(tr, s.cfg.ReplicationFactor)
+		if err == nil && slices.Contains(replicas, ring.NodeID(s.cfg.NodeID)) {
+			ranges = append(ranges, tr)
+		}
+	}
+	return ranges
+}
+
+// claimRepair marks tr as being repaired unless a repair of it is running.
+func (s *HTTPServer) claimRepair(tr ring.TokenRange) bool {
+	s.repairs.mu.Lock()
+	defer s.repairs.mu.Unlock()
+	if s.repairs.running[tr] {
+		return false
+	}
+	s.repairs.running[tr] = true
+	return true
+}
+
+// handleRepairStatus serves GET /admin/repair/status.
+func (s *HTTPServer) handleRepairStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	s.writeJSON(w, s.repairStatus())
+}
+
+func (s *HTTPServer) repairStatus() api.RepairStatus {
+	ranges := s.primaryRanges()
+	status := api.RepairStatus{
+		NodeID:      s.cfg.NodeID,
+		Ranges:      len(ranges),
+		Interval:    s.cfg.RepairInterval.String(),
+		RateBytes:   s.cfg.RepairRate,
+		Concurrency: s.cfg.RepairConcurrency,
+		RangeStatus: make([]api.RangeRepair, 0, len(ranges)),
+	}
+	s.repairs.mu.Lock()
+	defer s.repairs.mu.Unlock()
+	status.BytesTransferred = s.repairs.bytes
+	never := false
+	for _, tr := range ranges {
+		last, repaired := s.repairs.last[tr]
+		if !repaired {
+			never = true
+			last = api.RangeRepair{Start: rangeBound(tr.Start), End: rangeBound(tr.End)}
+			if replicas, err := s.ring.RangeReplicas(tr, s.cfg.ReplicationFactor); err == nil {
+				for _, nodeID := range replicas {
+					last.Replicas = append(last.Replicas, string(nodeID))
+				}
+			}
+		} else {
+			status.Repaired++
+			if status.OldestRepair.IsZero() || last.LastRepaired.Before(status.OldestRepair) {
+				status.OldestRepair = last.LastRepaired
+			}
+		}
+		last.Running = s.repairs.running[tr]
+		status.RangeStatus = append(status.RangeStatus, last)
+	}
+	if never {
+		status.OldestRepair = time.Time{}
+	}
+	return status
+}
+
+// rangeBound formats a ring position for RangeRepair.
+func rangeBound(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestAntiEntropy(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	put := func(node *HTTPServer, key, value string, version clock.VectorClock) {
+		node.versions.PutVersioned(key, storage.NewVersionedValue([]byte(value), version))
+	}
+	put(a, "only-a", "a", clock.VectorClock{"a": 1})
+	put(b, "only-b", "b", clock.VectorClock{"b": 1})
+	put(a, "newer-b", "old", clock.VectorClock{"a": 1})
+	put(b, "newer-b", "new", clock.VectorClock{"a": 1, "b": 1})
+	put(a, "deleted", "value", clock.VectorClock{"a": 1})
+	put(b, "deleted", "value", clock.VectorClock{"a": 1})
+	tombstone := storage.NewVersionedValue([]byte("value"), clock.VectorClock{"a": 2})
+	tombstone.Tombstone = true
+	a.versions.PutVersioned("deleted", tombstone)
+	put(a, "concurrent", "from-a", clock.VectorClock{"a": 1})
+	put(b, "concurrent", "from-b", clock.VectorClock{"b": 1})
+
+	// Each node repairs the ranges it is the primary replica of
+	for _, node := range []*HTTPServer{a, b} {
+		for _, tr := range node.primaryRanges() {
+			if result := node.repairRange(t.Context(), tr); result.Error != "" {
+				t.Errorf("Expected range %s-%s to be repaired, got %s", result.Start, result.End, result.Error)
+			}
+		}
+	}
+	for _, node := range []*HTTPServer{a, b} {
+		for key, want := range map[string]string{"only-a": "a", "only-b": "b", "newer-b": "new"} {
+			if got, ok := node.versions.GetVersioned(key); !ok || string(got.Value) != want {
+				t.Errorf("Expected %s on %s to be %q, got %+v", key, node.cfg.NodeID, want, got)
+			}
+		}
+		if got, ok := node.versions.GetVersioned("deleted"); !ok || !got.Tombstone {
+			t.Errorf("Expected the delete to reach %s, got %+v", node.cfg.NodeID, got)
+		}
+	}
+	fromA, _ := a.versions.GetVersioned("concurrent")
+	fromB, _ := b.versions.GetVersioned("concurrent")
+	if len(fromA.Versions()) != 2 || len(fromB.Versions()) != 2 || !clock.Equal(fromA.Context(), clock.VectorClock{"a": 1, "b": 1}) || !clock.Equal(fromA.Context(), fromB.Context()) {
+		t.Errorf("Expected both nodes to keep the concurrent versions as siblings, got %+v and %+v", fromA, fromB)
+	}
+
+	rec := httptest.NewRecorder()
+	a.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/repair/status", nil))
+	var status api.RepairStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode repair status: %v", err)
+	}
+	if status.Ranges == 0 || status.Repaired != status.Ranges || status.OldestRepair.IsZero() || status.BytesTransferred == 0 {
+		t.Errorf("Expected every range of a to be repaired, got %+v", status)
+	}
+	if tr, ok := a.nextRepair(); !ok || !a.repairs.last[tr].LastRepaired.Equal(status.OldestRepair) {
+		t.Errorf("Expected the range repaired longest ago to be next")
+	}
+}
+
+func TestOperatorRepair(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	a.versions.PutVersioned("lost", storage.NewVersionedValue([]byte("value"), clock.VectorClock{"a": 1}))
+	a.versions.PutVersioned("other", storage.NewVersionedValue([]byte("value"), clock.VectorClock{"a": 1}))
+
+	repair := func(query string) (int, api.RepairReport) {
+		rec := httptest.NewRecorder()
+		b.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/repair"+query, nil))
+		var report api.RepairReport
+		json.NewDecoder(rec.Body).Decode(&report)
+		return rec.Code, report
+	}
+
+	code, report := repair("?key=lost")
+	if code != http.StatusOK || len(report.Ranges) != 1 || report.Pulled != 1 {
+		t.Fatalf("Expected the range of the key to be repaired with one key pulled, got %d %+v", code, report)
+	}
+	if got, ok := b.versions.GetVersioned("lost"); !ok || string(got.Value) != "value" {
+		t.Errorf("Expected the repair to copy the key to b, got %+v", got)
+	}
+
+	code, report = repair("")
+	if code != http.StatusOK || len(report.Ranges) != len(b.ring.Ranges()) {
+		t.Fatalf("Expected every range to be repaired, got %d %+v", code, report)
+	}
+	if _, ok := b.versions.GetVersioned("other"); !ok {
+		t.Errorf("Expected a full repair to copy every key to b")
+	}
+
+	tr := b.ring.Ranges()[0]
+	code, report = repair("?start=" + rangeBound(tr.Start) + "&end=" + rangeBound(tr.End))
+	if code != http.StatusOK || len(report.Ranges) != 1 || report.Ranges[0].Start != rangeBound(tr.Start) {
+		t.Errorf("Expected the named range to be repaired, got %d %+v", code, report)
+	}
+
+	b.claimRepair(tr)
+	if _, report = repair("?start=" + rangeBound(tr.Start) + "&end=" + rangeBound(tr.End)); len(report.Ranges) != 1 || !report.Ranges[0].Running {
+		t.Errorf("Expected a range being repaired to be skipped, got %+v", report)
+	}
+
+	for _, query := range []string{"?key=k&start=0&end=1", "?start=zz&end=1", "?start=1"} {
+		if code, _ := repair(query); code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be rejected, got %d", query, code)
+		}
+	}
+}
+
+func TestRepairOutlastsWriteTimeout(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	a.versions.PutVersioned("lost", storage.NewVersionedValue(bytes.Repeat([]byte("v"), 1000), clock.VectorClock{"a": 1}))
+	b.repairs.throttle.rate = 2000
+	ts := httptest.NewUnstartedServer(b.server.Handler)
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	// Paced at 2000 bytes a second, copying the value alone takes half
+	// a second
+	resp, err := http.Post(ts.URL+"/admin/repair", "", nil)
+	if err != nil {
+		t.Fatalf("Expected the slow repair to report, got %v", err)
+	}
+	defer resp.Body.Close()
+	var report api.RepairReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil || resp.StatusCode != http.StatusOK || report.Pulled != 1 {
+		t.Errorf("Expected a report of one key pulled, got %d %+v %v", resp.StatusCode, report, err)
+	}
+}
+
+func TestRepairThrottle(t *testing.T) {
+	throttle := byteThrottle{rate: 1000}
+	now := time.Now()
+	if wait := throttle.pace(500, now); wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait 500ms after half a second's bytes, got %s", wait)
+	}
+	if wait := throttle.pace(500, now.Add(250*time.Millisecond)); wait != 750*time.Millisecond {
+		t.Errorf("Expected waits to add up, got %s", wait)
+	}
+	if wait := throttle.pace(100, now.Add(5*time.Second)); wait != 100*time.Millisecond {
+		t.Errorf("Expected an idle throttle not to bank bytes, got %s", wait)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/amirderis/DHT/internal/quorum"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// Restoring does not depend on the topology a snapshot was taken under.
+// Every entry of a snapshot file is routed by its own key through this
+// node's ring and written to the owners found there, keeping the version
+// it was snapshotted with. A cluster of any size can therefore take the
+// files of another: dhtctl restore spreads them over its nodes, and the
+// copies of a key that several old replicas held simply land on the same
+// new owners again.
+
+const (
+	// maxRestoreErrors bounds the failures a RestoreResponse lists.
+	maxRestoreErrors = 10
+	// maxRestoreBytes bounds the snapshot file a restore reads. Entries are
+	// read and written one at a time, so it bounds how long a restore can
+	// hold its connection rather than the memory it takes.
+	maxRestoreBytes = 64 << 30
+)
+
+// handleRestore serves POST /admin/restore, whose body is a snapshot file.
+// Its entries are written as they are read, pushing the connection's
+// deadlines out as each one moves, so that a file of any size is restored
+// within one request. A file that turns out to be malformed ends the
+// restore with 400, after the entries before the fault were written.
+func (s *HTTPServer) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	if err := s.checkBootstrapped(); err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	rc := http.NewResponseController(w)
+	body := deadlineReader{r: http.MaxBytesReader(w, r.Body, maxRestoreBytes), rc: rc}
+
+	var response api.RestoreResponse
+	now := time.Now()
+	file, err := readSnapshotFile(body, func(entry api.SnapshotEntry) {
+		extendDeadlines(rc)
+		if entry.Key == "" {
+			return
+		}
+		if !entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt) {
+			response.Expired++
+			return
+		}
+		current, err := s.restoreEntry(r.Context(), entry)
+		switch {
+		case err != nil:
+			response.Failed++
+			if len(response.Errors) < maxRestoreErrors {
+				response.Errors = append(response.Errors, err.Error())
+			}
+		case current:
+			response.Current++
+		default:
+			response.Restored++
+		}
+	})
+	response.ID, response.NodeID = file.ID, file.NodeID
+	s.metrics.Count("restored_entries", int64(response.Restored))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		s.writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("snapshot file exceeds %d bytes (%d restored)", tooLarge.Limit, response.Restored))
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid snapshot file (%d restored): %v", response.Restored, err))
+		return
+	}
+	s.logger.Printf("restored snapshot %s of node %s: %d restored, %d current, %d expired, %d failed\n",
+		file.ID, file.NodeID, response.Restored, response.Current, response.Expired, response.Failed)
+	s.writeJSON(w, response)
+}
+
+// readSnapshotFile reads the snapshot file in body, passing each of its
+// entries to restore as it is read, and returns its description.
+func readSnapshotFile(body io.Reader, restore func(api.SnapshotEntry)) (api.NodeSnapshot, error) {
+	var snapshot api.NodeSnapshot
+	dec := json.NewDecoder(body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return snapshot, err
+	}
+	described := map[string]json.RawMessage{}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return snapshot, err
+		}
+		name, _ := token.(string)
+		if name != "entries" {
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return snapshot, err
+			}
+			described[name] = value
+			continue
+		}
+		if token, err = dec.Token(); err != nil {
+			return snapshot, err
+		}
+		if token == nil {
+			continue
+		}
+		if token != json.Delim('[') {
+			return snapshot, fmt.Errorf("expected entries, got %v", token)
+		}
+		for dec.More() {
+			var entry api.SnapshotEntry
+			if err := dec.Decode(&entry); err != nil {
+				return snapshot, err
+			}
+			restore(entry)
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return snapshot, err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return snapshot, err
+	}
+	data, _ := json.Marshal(described)
+	return snapshot, json.Unmarshal(data, &snapshot)
+}
+
+// expectDelim reads the next token of dec, which must be delim.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, got %v", delim, token)
+	}
+	return nil
+}
+
+// restoreEntry writes entry to every owner of its key, reporting whether
+// the owners already held a newer version.
+func (s *HTTPServer) restoreEntry(ctx context.Context, entry api.SnapshotEntry) (bool, error) {
+	preferenceList, err := s.ring.GetPreferenceList(entry.Key, s.cfg.ReplicationFactor)
+	if err != nil {
+		return false, fmt.Errorf("key %s: %w", entry.Key, err)
+	}
+	value := replicaValue(entry.Value, entry.Version, api.ReplicateGetResponse{Timestamp: entry.UpdatedAt, ExpiresAt: entry.ExpiresAt, ContentType: entry.ContentType, Meta: entry.Meta})
+	successCount, stale, _ := s.writeToNodes(ctx, entry.Key, value, preferenceList, len(preferenceList))
+	if quorum.Met(successCount, s.cfg.WriteQuorum, len(preferenceList)) {
+		return false, nil
+	}
+	if stale {
+		return true, nil
+	}
+	return false, fmt.Errorf("key %s: reached %d of %d owners", entry.Key, successCount, len(preferenceList))
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestRestoreIntoNewTopology(t *testing.T) {
+	old := newTestServer(t)
+	old.cfg.DataDir = t.TempDir()
+	keys := []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot"}
+	for _, key := range keys {
+		if _, err := old.put(t.Context(), key, []byte("value-"+key), nil, 1, time.Time{}); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+	snapshot, err := old.writeSnapshot("backup", old.hlc.Now())
+	if err != nil {
+		t.Fatalf("Failed to write snapshot: %v", err)
+	}
+	data, err := os.ReadFile(snapshot.Path)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot file: %v", err)
+	}
+
+	// Restore the single node's snapshot into three nodes keeping two
+	// replicas of every key
+	nodes := []*HTTPServer{startTestNode(t, "a"), startTestNode(t, "b"), startTestNode(t, "c")}
+	for _, x := range nodes {
+		for _, y := range nodes {
+			x.ring.JoinNode(ring.NodeID(y.cfg.NodeID), y.cfg.BindAddr, 1)
+		}
+	}
+	restore := func() api.RestoreResponse {
+		rec := httptest.NewRecorder()
+		nodes[0].server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/restore", bytes.NewReader(data)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp api.RestoreResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode restore response: %v", err)
+		}
+		return resp
+	}
+
+	if resp := restore(); resp.Restored != len(keys) || resp.Failed != 0 || resp.NodeID != "test-node" {
+		t.Fatalf("Expected %d entries restored, got %+v", len(keys), resp)
+	}
+	held := map[string]int{}
+	for _, key := range keys {
+		want, _ := old.versions.GetVersioned(key)
+		owners, err := nodes[0].ring.GetPreferenceList(key, 2)
+		if err != nil {
+			t.Fatalf("Failed to get preference list: %v", err)
+		}
+		for _, owner := range owners {
+			for _, node := range nodes {
+				if node.cfg.NodeID != string(owner) {
+					continue
+				}
+				// Stragglers finish in the background
+				waitFor(t, func() bool {
+					_, ok := node.versions.GetVersioned(key)
+					return ok
+				})
+				got, _ := node.versions.GetVersioned(key)
+				if string(got.Value) != "value-"+key || !clock.Equal(got.Version, want.Version) {
+					t.Errorf("Expected %s on %s at version %v, got %q at %v", key, owner, want.Version, got.Value, got.Version)
+				}
+				held[node.cfg.NodeID]++
+			}
+		}
+	}
+	if len(held) < 2 {
+		t.Errorf("Expected the keys to be spread over the new nodes, got %v", held)
+	}
+
+	// Restoring again is harmless, and leaves newer writes alone
+	if _, err := nodes[0].put(t.Context(), "alpha", []byte("newer"), nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if resp := restore(); resp.Current != 1 || resp.Restored != len(keys)-1 {
+		t.Errorf("Expected one entry current and the rest restored again, got %+v", resp)
+	}
+	if got, err := nodes[0].get(t.Context(), "alpha", 2); err != nil || string(got.Value) != "newer" {
+		t.Errorf("Expected the newer write to survive the restore, got %q, %v", got.Value, err)
+	}
+}
+
+func TestRestoreStreamsEntries(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.ReadQuorum, s.cfg.WriteQuorum = 1, 1
+	ts := httptest.NewUnstartedServer(s.server.Handler)
+	ts.Config.ReadTimeout = 100 * time.Millisecond
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	// Entries trickle in over several times the listener's timeouts, with
+	// the description of the file after them
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte(`{"entries":[`))
+		for i := range 4 {
+			time.Sleep(75 * time.Millisecond)
+			if i > 0 {
+				pw.Write([]byte(","))
+			}
+			fmt.Fprintf(pw, `{"key":"slow-%d","value":"dg==","version":{"a":1}}`, i)
+		}
+		pw.Write([]byte(`],"id":"backup","node_id":"old"}`))
+		pw.Close()
+	}()
+	resp, err := http.Post(ts.URL+"/admin/restore", "application/json", pr)
+	if err != nil {
+		t.Fatalf("Expected the slow restore to complete, got %v", err)
+	}
+	var restored api.RestoreResponse
+	json.NewDecoder(resp.Body).Decode(&restored)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || restored.Restored != 4 || restored.ID != "backup" || restored.NodeID != "old" {
+		t.Fatalf("Expected 4 entries of backup restored, got %d %+v", resp.StatusCode, restored)
+	}
+
+	// Entries before a fault in the file are written
+	rec := httptest.NewRecorder()
+	body := `{"id":"torn","entries":[{"key":"before","value":"dg==","version":{"a":1}},{"key":`
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/restore", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "(1 restored)") {
+		t.Errorf("Expected 400 after one entry, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := s.versions.GetVersioned("before"); !ok {
+		t.Errorf("Expected the entry before the fault restored")
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/cursor"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// maxScanCursors bounds the open cursors per node, since each one holds a
+// copy of the data it covers.
+const maxScanCursors = 64
+
+// chunkKeyPattern matches the keys chunkManifest.chunkKey derives.
+var chunkKeyPattern = regexp.MustCompile(`~chunk\.[0-9a-f]{16}\.[0-9]+$`)
+
+// scanCursor is a snapshot of this node's keys under a prefix. Pages are
+// served from the snapshot while it lasts, so writes made after the scan
+// started are not seen; a page resumes after the key the client's cursor
+// names, so that a page asked for twice is served twice.
+type scanCursor struct {
+	mu        sync.Mutex
+	items     []storage.KeyedValue
+	expiresAt time.Time
+}
+
+// scanCursors holds open cursors by ID. A cursor expires when it has not
+// been read for cfg.ScanCursorTTL.
+type scanCursors struct {
+	mu      sync.Mutex
+	cursors map[string]*scanCursor
+}
+
+func newScanCursors() *scanCursors {
+	return &scanCursors{cursors: make(map[string]*scanCursor)}
+}
+
+// open registers a cursor and returns its ID, or false when too many are open.
+func (c *scanCursors) open(cur *scanCursor) (string, bool) {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	id := hex.EncodeToString(b[:])
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cursors) >= maxScanCursors {
+		return "", false
+	}
+	c.cursors[id] = cur
+	return id, true
+}
+
+func (c *scanCursors) get(id string, now time.Time) (*scanCursor, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cur, ok := c.cursors[id]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(cur.expiresAt) {
+		delete(c.cursors, id)
+		return nil, false
+	}
+	return cur, true
+}
+
+func (c *scanCursors) close(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.cursors[id]
+	delete(c.cursors, id)
+	return ok
+}
+
+// reap drops expired cursors and returns how many were dropped.
+func (c *scanCursors) reap(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for id, cur := range c.cursors {
+		cur.mu.Lock()
+		expired := !now.Before(cur.expiresAt)
+		cur.mu.Unlock()
+		if expired {
+			delete(c.cursors, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// handleScan pages through the keys held by this node. GET /scan?prefix=p
+// snapshots the matching keys and returns the first page with a cursor;
+// GET /scan?cursor=c returns the page after c and DELETE /scan?cursor=c
+// releases the snapshot early. A cursor outlives its snapshot: once the
+// snapshot expired the scan resumes after c from a new one. Chunked
+// values are returned reassembled and their chunks are not listed.
+func (s *HTTPServer) handleScan(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var resume *cursor.Cursor
+	if raw := query.Get("cursor"); raw != "" {
+		c, err := cursor.Decode(cursor.Scan, raw)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		resume = &c
+	}
+	if r.Method == http.MethodDelete && resume != nil {
+		if !s.scans.close(resume.Snapshot) {
+			s.writeError(w, http.StatusNotFound, "scan cursor not found or expired: "+query.Get("cursor"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	limit := defaultScanPageSize
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			s.writeError(w, http.StatusBadRequest, "invalid limit: "+raw)
+			return
+		}
+		limit = n
+	}
+
+	now := time.Now()
+	next := cursor.Cursor{Listing: cursor.Scan, Prefix: query.Get("prefix")}
+	after := ""
+	if resume != nil {
+		next.Prefix, next.Snapshot = resume.Prefix, resume.Snapshot
+		after = tenantKey(r.Context(), resume.Key)
+	}
+	prefix := tenantKey(r.Context(), next.Prefix)
+	cur, ok := s.scans.get(next.Snapshot, now)
+	if !ok {
+		if err := s.checkNamespace(prefix); err != nil {
+			s.writeOpError(w, err)
+			return
+		}
+		items := s.snapshot(prefix)
+		if resume != nil {
+			items = items[sort.Search(len(items), func(i int) bool { return items[i].Key > after }):]
+		}
+		cur = &scanCursor{items: items, expiresAt: now.Add(s.cfg.ScanCursorTTL)}
+		if next.Snapshot, ok = s.scans.open(cur); !ok {
+			s.writeError(w, http.StatusServiceUnavailable, "too many open scan cursors")
+			return
+		}
+	}
+
+	cur.mu.Lock()
+	defer cur.mu.Unlock()
+	pos := 0
+	if resume != nil {
+		pos = sort.Search(len(cur.items), func(i int) bool { return cur.items[i].Key > after })
+	}
+	end := min(pos+limit, len(cur.items))
+	response := api.ScanResponse{Items: make([]api.ScanItem, 0, end-pos)}
+	for _, item := range cur.items[pos:end] {
+		value := item.Value
+		if isManifest(value) {
+			var err error
+			if value, err = s.getChunked(r.Context(), item.Key, value, 1); err != nil {
+				s.writeOpError(w, err)
+				return
+			}
+		}
+		response.Items = append(response.Items, api.ScanItem{Key: clientKey(r.Context(), item.Key), Value: value, ExpiresAt: item.ExpiresAt})
+	}
+	cur.expiresAt = now.Add(s.cfg.ScanCursorTTL)
+	if end < len(cur.items) {
+		next.Key = clientKey(r.Context(), cur.items[end-1].Key)
+		response.Cursor = next.Encode()
+		response.CursorExpiresAt = cur.expiresAt
+	} else {
+		s.scans.close(next.Snapshot)
+	}
+	s.writeJSON(w, response)
+}
+
+// snapshot copies the keys under prefix, leaving out chunks of chunked values.
+func (s *HTTPServer) snapshot(prefix string) []storage.KeyedValue {
+	items := s.storage.Snapshot(prefix)
+	kept := items[:0]
+	for _, item := range items {
+		if !chunkKeyPattern.MatchString(item.Key) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
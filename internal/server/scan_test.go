@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestScanCursorSnapshot(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.WriteQuorum = 1
+	for _, k := range []string{"c", "a", "b"} {
+		s.storage.Put(k, []byte(k))
+	}
+
+	page := func(query string) (int, api.ScanResponse) {
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/scan?"+query, nil))
+		var resp api.ScanResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec.Code, resp
+	}
+
+	_, first := page("limit=2")
+	if len(first.Items) != 2 || first.Items[0].Key != "a" || first.Cursor == "" {
+		t.Fatalf("Expected first page [a b] with a cursor, got %+v", first)
+	}
+	s.storage.Put("c", []byte("changed"))
+	s.storage.Put("d", []byte("d"))
+
+	_, second := page("limit=2&cursor=" + first.Cursor)
+	if len(second.Items) != 1 || string(second.Items[0].Value) != "c" || second.Cursor != "" {
+		t.Errorf("Expected last page [c] from the snapshot, got %+v", second)
+	}
+	_, again := page("limit=2&cursor=" + first.Cursor)
+	if len(again.Items) != 2 || string(again.Items[0].Value) != "changed" || again.Items[1].Key != "d" {
+		t.Errorf("Expected a released cursor to resume after b from current data, got %+v", again)
+	}
+
+	s.cfg.ScanCursorTTL = time.Nanosecond
+	_, expiring := page("limit=1&prefix=")
+	time.Sleep(time.Millisecond)
+	code, resumed := page("limit=1&cursor=" + expiring.Cursor)
+	if code != http.StatusOK || len(resumed.Items) != 1 || resumed.Items[0].Key != "b" {
+		t.Errorf("Expected an expired cursor to resume after a, got %d %+v", code, resumed)
+	}
+	if code, _ := page("cursor=" + first.Cursor[1:]); code != http.StatusBadRequest {
+		t.Errorf("Expected a malformed cursor to be refused, got %d", code)
+	}
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kv/?cursor="+first.Cursor, nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a scan cursor to be refused by a range scan, got %d", rec.Code)
+	}
+}
@@ -1,18 +1,33 @@
 package server
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"maps"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
+	"google.golang.org/grpc"
+
+	"github.com/amirderis/DHT/internal/access"
+	"github.com/amirderis/DHT/internal/alerts"
+	"github.com/amirderis/DHT/internal/clock"
 	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/internal/hints"
+	"github.com/amirderis/DHT/internal/lifecycle"
+	"github.com/amirderis/DHT/internal/membership"
+	"github.com/amirderis/DHT/internal/metrics"
+	"github.com/amirderis/DHT/internal/quorum"
 	"github.com/amirderis/DHT/internal/ring"
 	"github.com/amirderis/DHT/internal/storage"
 	"github.com/amirderis/DHT/pkg/api"
@@ -21,61 +36,335 @@ import (
 const (
 	readConsistencyHeader  = "X-Consistency-R"
 	writeConsistencyHeader = "X-Consistency-W"
+	ttlSecondsHeader       = "X-TTL-Seconds"
+	timestampHeader        = "X-Timestamp"
+	checksumHeader         = "X-Checksum"
+	timeoutHeader          = "X-Timeout"
+	sessionHeader          = "X-Session"
+	cursorHeader           = "X-Cursor"
+	ttlQueryParam          = "ttl"
 )
 
+// vnodesPerNode is the number of virtual nodes each physical node owns.
+const vnodesPerNode = 20
+
 type HTTPServer struct {
 	cfg       *config.Config
 	server    *http.Server
+	admin     *http.Server // nil unless cfg.AdminAddr is set
 	readyFlag atomic.Bool
-	storage   storage.Engine
-	ring      *ring.Ring
-	client    *http.Client
+	// bootstrapped latches once the ring has reached cfg.BootstrapExpect nodes.
+	bootstrapped atomic.Bool
+	storage      storage.Store
+	// versions is a versioned view over storage used by the read/write path.
+	versions     storage.VersionedEngine
+	ring         *ring.Ring
+	client       *http.Client
+	stopCh       chan struct{}
+	hlc          *clock.HLC
+	stats        *stats
+	history      *statsHistory
+	evictions    *evictionLog
+	metrics      metrics.Metrics
+	watches      *watchHub
+	namespaces   *namespaceRegistry
+	coalescer    *coalescer
+	scans        *scanCursors
+	idempotency  *idempotencyCache
+	codecs       *peerCodecs
+	mirror       *mirror // nil unless cfg.MirrorAddr is set
+	cluster      *membership.Cluster
+	asyncSlots   chan struct{} // bounds background replica writes
+	hints        *hints.Store  // nil unless cfg.HintDir is set
+	joins        joinGate
+	cleanups     chunkCleanups
+	counters     counterLocks
+	jobs         jobThrottle
+	repairs      *repairScheduler
+	bootstrap    *bootstrapProgress
+	decommission *decommissionProgress
+	standby      *standbyProgress
+	lifecycle    *lifecycle.Manager
+	// replicaLimit and transferLimit bound concurrent internal requests,
+	// and peerTransfers the range listings of each peer.
+	replicaLimit  *concurrencyLimit
+	transferLimit *concurrencyLimit
+	peerTransfers *peerLimit
+	capacity      capacityMeter
+	alerts        *alerts.Engine
+	// access counts the reads this node serves of its most read keys.
+	access     *access.Tracker
+	alertMeter alertMeter
+	auditor    replicaAuditor
+	synced     syncClock
+	// webhookClient calls the capacity and alert webhooks, which are not
+	// peers.
+	webhookClient *http.Client
+	// incarnation distinguishes this process from earlier runs of the same node.
+	incarnation uint64
+	grpc        *grpc.Server // nil unless cfg.GRPCAddr is set
+	// peerGRPC serves the Replica service to peers on BindAddr, and
+	// transport carries this node's requests to them.
+	peerGRPC  *grpc.Server
+	transport Transport
+	logger    Logger
 }
 
-func NewHTTPServer(cfg *config.Config) *HTTPServer {
-	mux := http.NewServeMux()
+// NewHTTPServer builds a node from cfg, with the dependencies opts supply
+// in place of the ones it would build itself.
+func NewHTTPServer(cfg *config.Config, opts ...Option) *HTTPServer {
 	s := &HTTPServer{
 		cfg:     cfg,
-		storage: storage.NewInMemory(),
-		ring:    ring.New(20), // 20 virtual nodes per physical node
+		storage: storage.NewShardedWithLimits(storage.DefaultShards, storage.Limits{MaxKeys: cfg.MaxKeys, MaxBytes: cfg.MaxBytes, TombstoneGrace: cfg.TombstoneGrace, MaxSiblings: maxStoredSiblings(cfg)}),
+		ring:    ring.New(vnodesPerNode),
 		client: &http.Client{
+			Timeout:   cfg.PeerTimeout,
+			Transport: newPeerTransport(),
+		},
+		stopCh:      make(chan struct{}),
+		hlc:         clock.NewHLC(),
+		stats:       newStats(),
+		watches:     newWatchHub(),
+		namespaces:  newNamespaceRegistry(),
+		scans:       newScanCursors(),
+		idempotency: newIdempotencyCache(cfg.IdempotencyTTL),
+		mirror:      newMirror(cfg.MirrorAddr, cfg.MirrorPercent),
+		cluster:     membership.NewCluster(),
+		asyncSlots:  make(chan struct{}, maxAsyncReplications),
+		webhookClient: &http.Client{
 			Timeout: 5 * time.Second,
 		},
+		incarnation:   cfg.Incarnation,
+		repairs:       newRepairScheduler(cfg.RepairRate),
+		bootstrap:     newBootstrapProgress(),
+		decommission:  newDecommissionProgress(),
+		standby:       newStandbyProgress(cfg.StandbyFor),
+		lifecycle:     &lifecycle.Manager{},
+		alerts:        alerts.NewEngine(cfg.AlertRules),
+		access:        access.NewTracker(cfg.AccessTrackedKeys),
+		replicaLimit:  newConcurrencyLimit("replica", cfg.MaxReplicaRequests),
+		transferLimit: newConcurrencyLimit("transfer", cfg.MaxTransferRequests),
+		peerTransfers: newPeerLimit("peer_transfer", cfg.MaxPeerTransfers),
+		logger:        stdoutLogger{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.codecs = newPeerCodecs(cfg.PeerCodecs)
+	if s.transport == nil {
+		s.transport = newTransport(cfg, s.client, s.codecs)
+	}
+	s.versions = s.storage.Versioned()
+	// A flush serves every write of a burst, so it runs without any one
+	// request's deadline
+	s.coalescer = newCoalescer(func(key string, value []byte, causal clock.VectorClock, writeQuorum int, expiresAt time.Time) (api.PutResponse, error) {
+		return s.write(context.Background(), key, value, causal, writeQuorum, expiresAt)
+	}, func() {
+		s.stats.coalesced.Add(1)
+		s.metrics.Count("coalesced_writes", 1)
+	})
+	m, err := metrics.New(cfg.MetricsBackend, cfg.StatsDAddr)
+	if err != nil {
+		s.logger.Printf("metrics disabled: %v\n", err)
+		m = metrics.Discard
+	}
+	s.metrics = m
+	s.history = &statsHistory{}
+	s.evictions = &evictionLog{}
+	if cfg.DataDir != "" {
+		if s.history, err = loadHistory(cfg.DataDir); err != nil {
+			s.logger.Printf("starting a new stats history: %v\n", err)
+		}
+		if s.evictions, err = loadEvictions(cfg.DataDir); err != nil {
+			s.logger.Printf("failed to read the eviction log: %v\n", err)
+		}
+	}
+	if cfg.HintDir != "" {
+		hintStore, err := hints.Open(cfg.HintDir, hints.Limits{MaxHintsPerTarget: cfg.MaxHintsPerTarget, MaxBytes: cfg.MaxHintBytes, TTL: cfg.HintTTL})
+		if err != nil {
+			s.logger.Printf("hinted handoff disabled: %v\n", err)
+		} else {
+			s.hints = hintStore
+		}
+	}
+	if s.incarnation == 0 || cfg.StandbyFor != "" {
+		// Without a persisted identity, wall clock time still increases
+		// across restarts. A standby's own count says nothing about the
+		// primary's, so it relies on the clock to take over with a newer one
+		s.incarnation = uint64(time.Now().UnixNano())
 	}
 
-	// Initialize ring with this node
-	s.ring.AddNode(ring.NodeID(cfg.NodeID), cfg.BindAddr)
-
-	// Health and readiness endpoints
-	mux.HandleFunc("/healthz", s.handleHealth)
-	mux.HandleFunc("/readyz", s.handleReady)
+	// Initialize ring with this node; a standby only joins once promoted
+	if cfg.StandbyFor == "" {
+		s.ring.JoinNode(ring.NodeID(cfg.NodeID), cfg.BindAddr, s.incarnation)
+	}
 
-	// KV API endpoints
-	mux.HandleFunc("/kv/", s.handleKV)
+	// Public KV API endpoints
+	public := http.NewServeMux()
+	public.HandleFunc("/kv/", s.handleKV)
+	public.HandleFunc("/ring", s.handleRing)
+	public.HandleFunc("/scan", s.handleScan)
+	public.HandleFunc("/counters/", s.handleCounters)
+	public.Handle("/namespaces", s.adminOnly(http.HandlerFunc(s.handleNamespaces)))
+	public.Handle("/namespaces/", s.adminOnly(http.HandlerFunc(s.handleNamespaces)))
 
 	// Internal storage endpoints
-	mux.HandleFunc("/internal/storage/", s.handleInternalStorage)
+	internal := http.NewServeMux()
+	internal.HandleFunc("/internal/storage/", s.limit(s.replicaLimit, s.handleInternalStorage))
+	internal.HandleFunc("/internal/batch", s.limit(s.transferLimit, s.handleInternalBatch))
+	internal.HandleFunc("/internal/batch/get", s.limit(s.replicaLimit, s.handleInternalBatchGet))
+	internal.HandleFunc("/internal/range", s.limitPeer(s.peerTransfers, s.limit(s.transferLimit, s.handleInternalRange)))
+	internal.HandleFunc("/internal/scan", s.limitPeer(s.peerTransfers, s.limit(s.transferLimit, s.handleInternalScan)))
+	internal.HandleFunc("/internal/join", s.handleInternalJoin)
+	internal.HandleFunc("/internal/leave", s.handleInternalLeave)
+	internal.HandleFunc("/internal/ping", s.handlePing)
+	internal.HandleFunc("/internal/members", s.handleInternalMembers)
+	internal.HandleFunc("/internal/capacity", s.handleInternalCapacity)
+	internal.HandleFunc("/internal/namespaces", s.handleInternalNamespaces)
+	internal.HandleFunc("/internal/namespaces/", s.handleInternalNamespaces)
+
+	// Health, readiness, stats and admin endpoints
+	admin := http.NewServeMux()
+	admin.HandleFunc("/healthz", s.handleHealth)
+	admin.HandleFunc("/readyz", s.handleReady)
+	admin.HandleFunc("/stats", s.handleStats)
+	admin.HandleFunc("/admin/stats/history", s.handleStatsHistory)
+	admin.HandleFunc("/admin/storage", s.handleStorageStats)
+	admin.HandleFunc("/admin/tombstones", s.handleTombstones)
+	admin.HandleFunc("/admin/tombstones/purge", s.handleTombstonePurge)
+	admin.HandleFunc("/admin/sample", s.handleSample)
+	admin.HandleFunc("/admin/hotkeys", s.handleHotKeys)
+	admin.HandleFunc("/admin/mirror", s.handleMirror)
+	admin.HandleFunc("/admin/capacity", s.handleCapacity)
+	admin.HandleFunc("/admin/alerts", s.handleAlerts)
+	admin.HandleFunc("/admin/snapshot", s.handleSnapshot)
+	admin.HandleFunc("/admin/restore", s.handleRestore)
+	admin.HandleFunc("/admin/export", s.handleExport)
+	admin.HandleFunc("/admin/import", s.handleImport)
+	admin.HandleFunc("/admin/repair", s.handleRepair)
+	admin.HandleFunc("/admin/repair/status", s.handleRepairStatus)
+	admin.HandleFunc("/admin/audit", s.handleAudit)
+	admin.HandleFunc("/admin/bootstrap/status", s.handleBootstrapStatus)
+	admin.HandleFunc("/admin/decommission", s.handleDecommission)
+	admin.HandleFunc("/admin/rebalance/watch", s.handleRebalanceWatch)
+	admin.HandleFunc("/admin/members", s.handleMembers)
+	admin.HandleFunc("/admin/members/", s.handleMembers)
+	admin.HandleFunc("/admin/ring", s.handleRing)
+	admin.HandleFunc("/admin/config", s.handleConfig)
+	admin.HandleFunc("/admin/standby", s.handleStandby)
+	admin.HandleFunc("/admin/standby/", s.handleStandby)
+	admin.Handle("/debug/vars", expvar.Handler())
+	if prom, ok := s.metrics.(*metrics.Prometheus); ok {
+		admin.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			s.reportGauges()
+			prom.ServeHTTP(w, r)
+		})
+	}
+
+	// Each listener gets its own middleware chain. Internal endpoints always
+	// share BindAddr because the ring advertises a single address per node;
+	// admin endpoints move to their own listener when AdminAddr is set.
+	mux := http.NewServeMux()
+	mux.Handle("/", s.buildChain(public, cfg.PublicMiddleware))
+	mux.Handle("/internal/", s.requirePeerToken(s.buildChain(s.adminOnly(s.negotiateCodecs(internal)), cfg.InternalMiddleware)))
+	adminHandler := s.buildChain(s.requireAdminToken(s.adminOnly(admin)), cfg.AdminMiddleware)
+	if cfg.AdminAddr == "" {
+		for _, path := range []string{"/healthz", "/readyz", "/stats", "/metrics", "/debug/vars", "/admin/"} {
+			mux.Handle(path, adminHandler)
+		}
+	} else {
+		s.admin = newListener(cfg.AdminAddr, s.stampEpoch(adminHandler), cfg.MaxConcurrentStreams)
+	}
+	s.peerGRPC = newPeerGRPCServer(s)
+	s.server = newListener(cfg.BindAddr, s.servePeerGRPC(s.stampEpoch(mux)), cfg.MaxConcurrentStreams)
+
+	if cfg.GRPCAddr != "" {
+		s.grpc = newGRPCServer(s)
+	}
+
+	s.lifecycle.Add(s.subsystems()...)
 
-	s.server = &http.Server{
-		Addr:         cfg.BindAddr,
-		Handler:      mux,
+	// A node joining through seeds becomes ready once it has streamed the
+	// ranges it takes over
+	s.readyFlag.Store(len(cfg.Seeds) == 0)
+
+	return s
+}
+
+func newListener(addr string, handler http.Handler, maxConcurrentStreams int) *http.Server {
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      handler,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	enableHTTP2(srv, maxConcurrentStreams)
+	return srv
+}
 
-	// Set ready true after initialization
-	s.readyFlag.Store(true)
+// enableHTTP2 lets clients multiplex requests over a few connections by
+// serving HTTP/2 without TLS (h2c) alongside HTTP/1.1.
+func enableHTTP2(srv *http.Server, maxConcurrentStreams int) {
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	srv.Protocols = &protocols
+	srv.HTTP2 = &http.HTTP2Config{MaxConcurrentStreams: maxConcurrentStreams}
+}
 
-	return s
+// newPeerTransport returns a transport that speaks h2c to other nodes so
+// replication traffic shares a single connection per peer.
+func newPeerTransport() *http.Transport {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Protocols = &protocols
+	return transport
+}
+
+// Handler returns the handler served on BindAddr, for embedding the node in tests.
+func (s *HTTPServer) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// Ring returns the node's view of the ring.
+func (s *HTTPServer) Ring() *ring.Ring {
+	return s.ring
 }
 
+// Start starts the subsystems of the node in dependency order and returns
+// once all of them are up.
 func (s *HTTPServer) Start() error {
-	return s.server.ListenAndServe()
+	return s.lifecycle.Start(context.Background())
 }
 
+// Stop stops the subsystems of the node in the reverse order, each within
+// its own timeout and ctx.
 func (s *HTTPServer) Stop(ctx context.Context) error {
-	return s.server.Shutdown(ctx)
+	return s.lifecycle.Stop(ctx)
+}
+
+// runReaper periodically removes expired keys from local storage,
+// expired scan cursors and idempotent results until stop is closed.
+func (s *HTTPServer) runReaper(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.cfg.ReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if removed := s.storage.ReapExpired(); removed > 0 {
+				s.logger.Printf("reaped %d expired keys\n", removed)
+			}
+			s.scans.reap(time.Now())
+			s.idempotency.reap(time.Now())
+			if s.allowJob("chunk_cleanup", time.Now()) {
+				s.cleanupChunks(time.Now())
+			}
+		case <-stop:
+			return
+		}
+	}
 }
 
 func (s *HTTPServer) handleHealth(w http.ResponseWriter, r *http.Request) {
@@ -86,142 +375,554 @@ func (s *HTTPServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 func (s *HTTPServer) handleReady(w http.ResponseWriter, r *http.Request) {
 	if !s.readyFlag.Load() {
 		w.WriteHeader(http.StatusServiceUnavailable)
+		if status := s.bootstrapStatus(); status.State == "streaming" {
+			_, _ = fmt.Fprintf(w, "streaming data: %d of %d ranges\n", status.Streamed, status.Ranges)
+			return
+		}
+		if s.decommissionStatus().State == "left" {
+			_, _ = fmt.Fprintln(w, "decommissioned")
+			return
+		}
+		if s.isStandby() {
+			_, _ = fmt.Fprintf(w, "standby for node %s\n", s.cfg.StandbyFor)
+			return
+		}
 		_, _ = fmt.Fprintln(w, "not ready")
 		return
 	}
+	if err := s.checkBootstrapped(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintln(w, err.Error())
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	_, _ = fmt.Fprintln(w, "ready")
 }
 
-// handleKV routes GET/PUT/DELETE requests for a key to appropriate handlers
+// handleKV routes GET/HEAD/PUT/DELETE requests for a key to appropriate handlers
 func (s *HTTPServer) handleKV(w http.ResponseWriter, r *http.Request) {
+	w, r = withTimings(w, r)
+	r = withQuorumScope(w, r)
 	key := r.URL.Path[len("/kv/"):]
+	if key == "" && r.Method == http.MethodGet {
+		s.handleKeyRange(w, r)
+		return
+	}
 	if key == "" {
 		s.writeError(w, http.StatusBadRequest, "key cannot be empty")
 		return
 	}
+	if key == "_batch" && r.Method == http.MethodPost {
+		s.handleBatch(w, r)
+		return
+	}
+	if r.Method == http.MethodGet {
+		// A key ending in /watch is still read as usual, unless the
+		// request asks for an event stream
+		if key == "_watch" {
+			s.handleWatch(w, r, &watcher{prefix: tenantKey(r.Context(), r.URL.Query().Get("prefix"))})
+			return
+		}
+		if watched, ok := strings.CutSuffix(key, "/watch"); ok && watched != "" && strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			s.handleWatch(w, r, &watcher{key: tenantKey(r.Context(), watched)})
+			return
+		}
+	}
+	key = tenantKey(r.Context(), key)
+	if s.misdirected(r, key) {
+		s.writeError(w, http.StatusMisdirectedRequest, "ring changed and this node no longer holds key: "+key)
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
+		if wantsMetadata(r) {
+			s.handleMetadata(w, r, key)
+			return
+		}
 		s.handleGet(w, r, key)
-	case http.MethodPut:
-		s.handlePut(w, r, key)
-	case http.MethodDelete:
-		s.handleDelete(w, r, key)
+	case http.MethodHead:
+		s.handleGet(w, r, key)
+	case http.MethodPut, http.MethodDelete:
+		if token := r.Header.Get(idempotencyKeyHeader); token != "" && s.cfg.IdempotencyTTL > 0 {
+			s.idempotent(w, r, key, token, func(w http.ResponseWriter) { s.handleWrite(w, r, key) })
+			return
+		}
+		s.handleWrite(w, r, key)
 	default:
 		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
 	}
 }
 
 func (s *HTTPServer) handleGet(w http.ResponseWriter, r *http.Request, key string) {
-	readQuorum := s.getQuorumFromHeader(r, readConsistencyHeader, s.cfg.ReadQuorum)
+	bound, bounded, err := parseBoundedStaleness(r.Header.Get(readConsistencyHeader))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx, cancel, err := s.requestContext(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer cancel()
+	sess, err := parseSession(r.Header.Get(sessionHeader))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if br, ok := parseByteRange(r.Header.Get("Range")); ok && r.Method != http.MethodHead {
+		if bounded {
+			s.writeError(w, http.StatusBadRequest, "range reads need a read quorum, not bounded staleness")
+			return
+		}
+		s.handleRangeGet(ctx, w, key, br, s.getQuorumFromHeader(r, readConsistencyHeader, s.cfg.ReadQuorum), sess)
+		return
+	}
+	if wantsRawValue(r) && r.Method == http.MethodGet {
+		if bounded {
+			s.writeError(w, http.StatusBadRequest, "raw reads need a read quorum, not bounded staleness")
+			return
+		}
+		s.handleStreamGet(ctx, w, key, s.getQuorumFromHeader(r, readConsistencyHeader, s.cfg.ReadQuorum), sess)
+		return
+	}
+	var response api.GetResponse
+	if bounded {
+		response, err = s.getBounded(ctx, key, bound)
+	} else {
+		response, err = s.get(ctx, key, s.getQuorumFromHeader(r, readConsistencyHeader, s.cfg.ReadQuorum))
+	}
+	if err == nil {
+		response, err = s.readYourWrites(ctx, key, sess, response, s.get)
+	}
+	if err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	setCausalContext(w, response)
+	setTTL(w, &response)
+	response.Key = clientKey(ctx, response.Key)
+	status := http.StatusOK
+	if !response.Found {
+		status = http.StatusNotFound
+	}
+	if r.Method == http.MethodHead {
+		if response.Found {
+			setAttributeHeaders(w, response)
+		}
+		setValueHeaders(w, response)
+		w.WriteHeader(status)
+		return
+	}
+	w.WriteHeader(status)
+	s.writeJSON(w, response)
+}
+
+// setValueHeaders describes the value a HEAD request read in place of the
+// body a GET would return: its length and checksum.
+func setValueHeaders(w http.ResponseWriter, response api.GetResponse) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(response.Value)))
+	if response.Found {
+		w.Header().Set(checksumHeader, strconv.FormatUint(uint64(response.Checksum), 10))
+	}
+}
+
+// get reads key from readQuorum replicas of its preference list. Replicas
+// whose copy fails checksum verification do not count towards the quorum and
+// are repaired in the background from the value that is returned.
+func (s *HTTPServer) get(ctx context.Context, key string, readQuorum int) (api.GetResponse, error) {
+	if err := s.checkStandby(); err != nil {
+		return api.GetResponse{}, err
+	}
+	if err := s.checkNamespace(key); err != nil {
+		return api.GetResponse{}, err
+	}
+	response, err := s.getValue(ctx, key, readQuorum)
+	if err != nil {
+		return api.GetResponse{}, err
+	}
+	return s.assembleValue(ctx, key, response, readQuorum)
+}
+
+// assembleValue reassembles the chunked values a read returned, merges
+// typed values into their document, sets the checksum of the value and
+// mirrors the read.
+func (s *HTTPServer) assembleValue(ctx context.Context, key string, response api.GetResponse, readQuorum int) (api.GetResponse, error) {
+	response = typedDocument(response)
+	var err error
+	if response.Found && isManifest(response.Value) {
+		if response.Value, err = s.getChunked(ctx, key, response.Value, readQuorum); err != nil {
+			return api.GetResponse{}, err
+		}
+	}
+	for i, sibling := range response.Siblings {
+		if isManifest(sibling.Value) {
+			if response.Siblings[i].Value, err = s.getChunked(ctx, key, sibling.Value, readQuorum); err != nil {
+				return api.GetResponse{}, err
+			}
+		}
+	}
+	if response.Found {
+		response.Checksum = crc32.ChecksumIEEE(response.Value)
+	}
+	s.mirrorGet(key, response)
+	return response, nil
+}
 
+// getValue reads the value stored under key as is, without reassembling chunks.
+func (s *HTTPServer) getValue(ctx context.Context, key string, readQuorum int) (api.GetResponse, error) {
+	timings := timingsFrom(ctx)
+	started := time.Now()
 	preferenceList, err := s.ring.GetPreferenceList(key, s.cfg.ReplicationFactor)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, "failed to get preference list for key: "+key)
-		return
+		return api.GetResponse{}, &opError{http.StatusInternalServerError, "failed to get preference list for key: " + key}
 	}
+	timings.since("route", started)
+	s.reportDowngrade(ctx, s.quorumFor(ctx, readQuorum, preferenceList, false), false)
 
-	// If we only have one node or read quorum=1, just read locally
-	if len(preferenceList) == 1 || readQuorum == 1 {
-		value, found := s.storage.Get(key)
-		response := api.GetResponse{
-			Key:   key,
-			Value: value,
-			Found: found,
+	// If we only have one node or read quorum=1, just read locally, unless
+	// this node is not a replica of key and only coordinates the read
+	owner := slices.Contains(preferenceList, ring.NodeID(s.cfg.NodeID))
+	if owner && (len(preferenceList) == 1 || readQuorum == 1) {
+		started = time.Now()
+		s.access.Record(key, started)
+		item, found, err := s.storage.GetChecked(key)
+		timings.since("local", started)
+		if err == nil {
+			s.countRead(readPathLocal)
+			return readResponse(key, api.ReplicateGetResponse{
+				Value:       item.Value,
+				Version:     item.Version,
+				Found:       found,
+				ExpiresAt:   item.ExpiresAt,
+				ContentType: item.ContentType,
+				Meta:        item.Meta,
+				Siblings:    replicaSiblings(key, item.Siblings),
+			}), nil
 		}
-		if found {
-			w.WriteHeader(http.StatusOK)
-		} else {
-			w.WriteHeader(http.StatusNotFound)
+		if len(preferenceList) == 1 {
+			return api.GetResponse{}, &opError{http.StatusInternalServerError, "corrupt replica for key: " + key}
+		}
+		s.logger.Printf("local replica for key: %s is corrupt, reading from peers\n", key)
+	} else if owner {
+		if response, ok := s.digestRead(ctx, key, preferenceList, readQuorum); ok {
+			s.countRead(readPathDigest)
+			return response, nil
 		}
-		s.writeJSON(w, response)
-		return
 	}
+	s.countRead(readPathQuorum)
 
 	// Read from multiple nodes
-	responses := s.readFromNodes(key, preferenceList, readQuorum)
-	if len(responses) < readQuorum {
-		message := fmt.Sprintf("expected %d replicas, got %d", readQuorum, len(responses))
-		s.writeError(w, http.StatusServiceUnavailable, message)
-		return
+	reads, corrupt, statuses := s.readFromNodes(ctx, key, preferenceList, readQuorum)
+	started = time.Now()
+	defer timings.since("merge", started)
+	return s.resolveReads(ctx, key, reads, corrupt, statuses, readQuorum)
+}
+
+// resolveReads turns the healthy reads of key into the value a quorum read
+// returns, failing when fewer than readQuorum replicas answered, and repairs
+// the replicas left stale or corrupt in the background.
+func (s *HTTPServer) resolveReads(ctx context.Context, key string, reads []replicaRead, corrupt []ring.NodeID, statuses replicaStatuses, readQuorum int) (api.GetResponse, error) {
+	response := newestRead(reads)
+	// statuses holds every replica of key, whether or not it answered
+	count := s.quorumFor(ctx, readQuorum, slices.Collect(maps.Keys(statuses)), false)
+	acks := 0
+	for _, read := range reads {
+		if count.counts(read.nodeID) {
+			acks++
+		}
+	}
+	if !count.met(acks) && !(response.Tombstone && supersedesAll(response, reads)) {
+		message := fmt.Sprintf("expected %d replicas, got %d", count.need(), acks)
+		if len(corrupt) > 0 {
+			message += fmt.Sprintf(" (%d corrupt)", len(corrupt))
+		}
+		return api.GetResponse{}, s.quorumError(ctx, key, statuses, &opError{http.StatusServiceUnavailable, message})
 	}
 
-	// For now, return the first successful response
-	// TODO: Implement conflict resolution in Phase 3
-	var response api.GetResponse
-	for _, resp := range responses {
-		if resp.Found {
-			response = resp
-			break
+	if s.overflowsToLWW(len(readVersions(response))) {
+		// Collapse to the latest write under the clocks of all of them
+		response.Version = readContext(response)
+		response.Siblings = nil
+	}
+	if response.Found || response.Tombstone {
+		// Replicas missing any of the versions get the whole set
+		if stale := append(staleReplicas(reads, response), corrupt...); len(stale) > 0 {
+			go s.repairReplicas(response, stale)
 		}
 	}
-	if response.Found {
-		w.WriteHeader(http.StatusOK)
-	} else {
-		w.WriteHeader(http.StatusNotFound)
+	result := readResponse(key, response)
+	if len(result.Siblings) > 0 {
+		s.metrics.Count("sibling_reads", 1)
 	}
-	s.writeJSON(w, response)
+	return result, nil
+}
+
+// handleWrite serves a PUT or DELETE of key.
+func (s *HTTPServer) handleWrite(w http.ResponseWriter, r *http.Request, key string) {
+	if r.Method == http.MethodDelete {
+		s.handleDelete(w, r, key)
+		return
+	}
+	s.handlePut(w, r, key)
 }
 
 func (s *HTTPServer) handlePut(w http.ResponseWriter, r *http.Request, key string) {
 	writeQuorum := s.getQuorumFromHeader(r, writeConsistencyHeader, s.cfg.WriteQuorum)
-	body, err := io.ReadAll(r.Body)
+	ttl, err := s.getTTL(r)
 	if err != nil {
-		s.writeError(w, http.StatusBadRequest, "failed to read request body")
+		s.writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	defer r.Body.Close()
-
-	preferenceList, err := s.ring.GetPreferenceList(key, s.cfg.ReplicationFactor)
+	var clientTime time.Time
+	if s.cfg.LWW {
+		if raw := r.Header.Get(timestampHeader); raw != "" {
+			ts, err := parseClientTimestamp(raw)
+			if err != nil {
+				s.writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err := s.checkClockDrift(ts, key); err != nil {
+				s.writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			clientTime = time.Unix(0, ts.WallTime)
+		}
+	}
+	causal, err := parseCausalContext(causalContextHeader, r.Header.Get(causalContextHeader))
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, "failed to get preference list for key: "+key)
+		s.writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	// Create version (placeholder for vector clock)
-	version := map[string]uint64{s.cfg.NodeID: 1}
-
-	// If we only have one node or write quorum=1, just write locally
-	if len(preferenceList) == 1 || writeQuorum == 1 {
-		if err := s.storage.Put(key, body); err != nil {
-			s.writeError(w, http.StatusInternalServerError, "failed to store value")
+	ifMatch := r.Header.Get(ifMatchHeader)
+	valueType, err := s.valueType(r, key)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if valueType != "" && ifMatch != "" {
+		s.writeError(w, http.StatusBadRequest, ifMatchHeader+" does not apply to "+valueType+" values")
+		return
+	}
+	if ifMatch != "" && causal != nil {
+		s.writeError(w, http.StatusBadRequest, "set either "+causalContextHeader+" or "+ifMatchHeader)
+		return
+	}
+	if ifMatch != "" {
+		if causal, err = parseCausalContext(ifMatchHeader, ifMatch); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-
-		response := api.PutResponse{Version: version}
-		w.WriteHeader(http.StatusOK)
-		s.writeJSON(w, response)
+	}
+	checksum, err := parseChecksum(r.Header.Get(checksumHeader))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	// Write to multiple nodes
-	successCount := s.writeToNodes(key, body, version, preferenceList, writeQuorum)
-	if successCount < writeQuorum {
-		s.writeError(w, http.StatusServiceUnavailable, "insufficient replicas available for write quorum for key: "+key)
+	sess, err := parseSession(r.Header.Get(sessionHeader))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	level, err := parseAckLevel(r.Header.Get(ackHeader))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	attrs, err := parseAttributes(r.Header)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx, cancel, err := s.requestContext(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer cancel()
+	ctx = withAckLevel(ctx, level)
+	if valueType == "" {
+		ctx = withAttributes(ctx, attrs)
+	}
+	if !clientTime.IsZero() {
+		ctx = withWriteTime(ctx, clientTime)
+	}
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	body := http.MaxBytesReader(w, r.Body, s.cfg.MaxValueBytes)
+	defer r.Body.Close()
 
-	response := api.PutResponse{Version: version}
+	var response api.PutResponse
+	if valueType != "" {
+		var document []byte
+		if document, err = io.ReadAll(body); err != nil {
+			s.writeOpError(w, bodyError(err))
+			return
+		}
+		if err := checkBodyChecksum(document, checksum); err != nil {
+			s.writeOpError(w, err)
+			return
+		}
+		response, err = s.putTyped(ctx, key, valueType, document, s.getQuorumFromHeader(r, readConsistencyHeader, s.cfg.ReadQuorum), writeQuorum, expiresAt)
+	} else if s.streamsPut(r) {
+		if ifMatch != "" {
+			err = s.checkMatch(ctx, key, causal)
+		}
+		if err == nil {
+			response, err = s.putStream(ctx, key, deadlineReader{body, http.NewResponseController(w)}, checksum, causal, writeQuorum, expiresAt)
+		}
+	} else {
+		var value []byte
+		if value, err = io.ReadAll(body); err != nil {
+			s.writeOpError(w, bodyError(err))
+			return
+		}
+		if err := checkBodyChecksum(value, checksum); err != nil {
+			s.writeOpError(w, err)
+			return
+		}
+		if ifMatch != "" {
+			response, err = s.putIfMatch(ctx, key, value, causal, writeQuorum, expiresAt)
+		} else {
+			response, err = s.put(ctx, key, value, causal, writeQuorum, expiresAt)
+		}
+	}
+	var condErr *conditionError
+	if errors.As(err, &condErr) {
+		s.writeConditionError(ctx, w, condErr)
+		return
+	}
+	if err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	w.Header().Set(sessionHeader, sess.record(key, response.Version).encode())
 	w.WriteHeader(http.StatusOK)
 	s.writeJSON(w, response)
 }
 
-// writeToNodes writes to multiple nodes and returns success count
-func (s *HTTPServer) writeToNodes(key string, value []byte, version map[string]uint64, prefList []ring.NodeID, writeQuorum int) int {
-	successCount := 0
+// put writes key to writeQuorum replicas of its preference list, first
+// coalescing it with other writes to the key when its namespace asks for it.
+// causal is the version the write supersedes; without one the write
+// supersedes whatever the replicas hold.
+func (s *HTTPServer) put(ctx context.Context, key string, value []byte, causal clock.VectorClock, writeQuorum int, expiresAt time.Time) (api.PutResponse, error) {
+	if err := s.checkStandby(); err != nil {
+		return api.PutResponse{}, err
+	}
+	if err := s.checkBootstrapped(); err != nil {
+		return api.PutResponse{}, err
+	}
+	if err := s.checkNamespace(key); err != nil {
+		return api.PutResponse{}, err
+	}
+	var response api.PutResponse
+	var err error
+	// A coalesced write runs apart from its request, counting hints and
+	// storing no attributes or client timestamp. A counter, set or map is
+	// never coalesced, as each write of it carries changes the next does
+	// not, and neither is a value larger than a chunk, which would be held
+	// until the window closes
+	attrs := attributesFrom(ctx)
+	if window := s.coalesceWindow(key); window > 0 && len(value) <= s.cfg.ChunkSize && countsBuffered(ctx) && !storage.Converges(value) && attrs.contentType == "" && attrs.meta == nil && writeTimeFrom(ctx).IsZero() {
+		response, err = s.coalescer.put(key, value, causal, writeQuorum, expiresAt, window)
+	} else {
+		response, err = s.write(ctx, key, value, causal, writeQuorum, expiresAt)
+	}
+	if err == nil {
+		s.mirrorPut(key, value, expiresAt)
+	}
+	return response, err
+}
 
-	for _, nodeID := range prefList {
-		if successCount >= writeQuorum {
-			break
+// write stores a value, splitting values larger than cfg.ChunkSize into
+// chunks behind a manifest.
+func (s *HTTPServer) write(ctx context.Context, key string, value []byte, causal clock.VectorClock, writeQuorum int, expiresAt time.Time) (api.PutResponse, error) {
+	// A small value that looks like a manifest is chunked too so that it
+	// reads back as written
+	if len(value) > s.cfg.ChunkSize || isManifest(value) {
+		return s.putChunked(ctx, key, value, causal, writeQuorum, expiresAt)
+	}
+	previous := s.storedValue(ctx, key)
+	response, err := s.putValue(ctx, key, value, causal, writeQuorum, expiresAt)
+	if err == nil {
+		s.dropChunks(key, previous, "")
+	}
+	return response, err
+}
+
+// putValue writes value under key as is, versioned with a clock that
+// follows causal and advances this node's counter.
+func (s *HTTPServer) putValue(ctx context.Context, key string, value []byte, causal clock.VectorClock, writeQuorum int, expiresAt time.Time) (api.PutResponse, error) {
+	started := time.Now()
+	preferenceList, err := s.ring.GetPreferenceList(key, s.cfg.ReplicationFactor)
+	if err != nil {
+		return api.PutResponse{}, &opError{http.StatusInternalServerError, "failed to get preference list for key: " + key}
+	}
+	timingsFrom(ctx).since("route", started)
+
+	// With one node or write quorum=1 the local write alone acknowledges the
+	// write, so the version comes from the local clock, unless this node is
+	// not a replica of key and only coordinates the write. The other
+	// replicas still get it in the background.
+	localOnly := slices.Contains(preferenceList, ring.NodeID(s.cfg.NodeID)) && (len(preferenceList) == 1 || writeQuorum == 1)
+	version, err := s.nextVersion(ctx, key, causal, preferenceList, localOnly)
+	if err != nil {
+		return api.PutResponse{}, storeError(key, err)
+	}
+	vv := storage.NewVersionedValue(value, version)
+	vv.ExpiresAt = expiresAt
+	if at := writeTimeFrom(ctx); !at.IsZero() {
+		vv.Timestamp = at
+	}
+	attrs := attributesFrom(ctx)
+	vv.ContentType, vv.Meta = attrs.contentType, attrs.meta
+
+	count := s.quorumFor(ctx, writeQuorum, preferenceList, true)
+	s.reportDowngrade(ctx, count, true)
+	successCount, stale, statuses := s.writeToNodes(ctx, key, vv, preferenceList, writeQuorum)
+	if !count.met(successCount) {
+		if stale {
+			return api.PutResponse{}, storeError(key, storage.ErrStaleVersion)
 		}
+		return api.PutResponse{}, s.quorumError(ctx, key, statuses, &opError{http.StatusServiceUnavailable, "insufficient replicas available for write quorum for key: " + key})
+	}
+	return api.PutResponse{Version: vv.Version}, nil
+}
 
+// writeToNodes writes to all of prefList at once and returns the success
+// count, whether any replica rejected the write as stale and how each
+// replica answered. It returns as soon as writeQuorum nodes have the
+// write, the quorum can no longer be reached or ctx ends; replicas still
+// answering then finish in the background, within the deadline of ctx.
+func (s *HTTPServer) writeToNodes(ctx context.Context, key string, value *storage.VersionedValue, prefList []ring.NodeID, writeQuorum int) (int, bool, replicaStatuses) {
+	count := s.quorumFor(ctx, writeQuorum, prefList, true)
+	successCount := 0
+	stale := false
+	var missed []ring.NodeID // down replicas, in preference order
+	statuses := make(replicaStatuses, len(prefList))
+
+	timings := timingsFrom(ctx)
+	replicaCtx, cancel := detach(ctx)
+	results := make(chan replicaWrite, len(prefList))
+	pending := 0
+	for _, nodeID := range prefList {
 		// If it's this node, write locally
 		if nodeID == ring.NodeID(s.cfg.NodeID) {
-			if err := s.storage.Put(key, value); err == nil {
-				successCount++
+			started := time.Now()
+			err := s.storeVersioned(key, value)
+			timings.since("local", started)
+			if err == nil {
+				if count.counts(nodeID) {
+					successCount++
+				}
+				statuses[nodeID] = replicaOK
 			} else {
-				fmt.Printf("failed to write to local node %s for key: %s, error: %v\n", s.cfg.NodeID, key, err)
+				stale = stale || errors.Is(err, storage.ErrStaleVersion)
+				statuses[nodeID] = writeStatus(err)
+				s.logger.Printf("failed to write to local node %s for key: %s, error: %v\n", s.cfg.NodeID, key, err)
 			}
 			continue
 		}
@@ -229,57 +930,204 @@ func (s *HTTPServer) writeToNodes(key string, value []byte, version map[string]u
 		// Write to remote node
 		address, exists := s.ring.GetNodeAddress(nodeID)
 		if !exists {
-			fmt.Printf("node %s not found in ring for key: %s\n", nodeID, key)
+			statuses[nodeID] = replicaUnknownID
+			s.logger.Printf("node %s not found in ring for key: %s\n", nodeID, key)
 			continue
 		}
-		if err := s.writeToRemoteNode(address, key, value, version); err == nil {
-			successCount++
-		} else {
-			fmt.Printf("failed to write to remote node %s for key: %s, error: %v\n", address, key, err)
+		if s.cluster.State(string(nodeID)) == membership.Dead {
+			statuses[nodeID] = replicaDead
+			s.storeHint(nodeID, key, value)
+			missed = append(missed, nodeID)
+			continue
 		}
+		statuses[nodeID] = replicaNoAnswer
+		pending++
+		go func() {
+			started := time.Now()
+			err := s.writeToRemoteNode(replicaCtx, address, key, value)
+			timings.replica(nodeID, started)
+			results <- replicaWrite{nodeID, address, err}
+		}()
+	}
+
+	need := count.need()
+collect:
+	for pending > 0 && !count.met(successCount) && quorum.Reachable(successCount, pending, need) {
+		var result replicaWrite
+		select {
+		case result = <-results:
+		case <-ctx.Done():
+			break collect
+		}
+		pending--
+		statuses[result.nodeID] = writeStatus(result.err)
+		if result.err == nil {
+			if count.counts(result.nodeID) {
+				successCount++
+			}
+			continue
+		}
+		stale = stale || errors.Is(result.err, storage.ErrStaleVersion)
+		if errors.Is(result.err, errUnreachable) {
+			s.cluster.MarkDead(string(result.nodeID))
+			s.storeHint(result.nodeID, key, value)
+			missed = append(missed, result.nodeID)
+		}
+		if errors.Is(result.err, errReplicaBusy) {
+			s.storeHint(result.nodeID, key, value)
+		}
+		s.logger.Printf("failed to write to remote node %s for key: %s, error: %v\n", result.address, key, result.err)
+	}
+	if pending > 0 {
+		s.finishInBackground(key, value, results, pending, statuses, cancel)
+	} else {
+		cancel()
+	}
+	if !count.met(successCount) && count.local == nil && len(missed) > 0 && s.cfg.SloppyQuorum && countsBuffered(ctx) && ctx.Err() == nil {
+		successCount += s.writeToFallbacks(ctx, key, value, len(prefList), missed, need-successCount)
+	}
+	// A replica publishes what it stores; a coordinator that holds no copy
+	// of key publishes what it got a replica to store
+	if successCount > 0 && !slices.Contains(prefList, ring.NodeID(s.cfg.NodeID)) {
+		s.watches.publish(watchEvent{deleted: value.Tombstone, key: key, value: append([]byte(nil), value.Value...), version: value.Version.Copy()})
 	}
-	return successCount
+	return successCount, stale, statuses
 }
 
-func (s *HTTPServer) writeToRemoteNode(address, key string, value []byte, version map[string]uint64) error {
-	req := api.ReplicateRequest{
-		Key:     key,
-		Value:   value,
-		Version: version,
+// writeStatus describes the outcome of one replica write.
+func writeStatus(err error) string {
+	switch {
+	case err == nil:
+		return replicaOK
+	case errors.Is(err, storage.ErrStaleVersion):
+		return replicaStale
+	case errors.Is(err, context.DeadlineExceeded):
+		return replicaNoAnswer
 	}
-	var jsonData bytes.Buffer
-	if err := json.NewEncoder(&jsonData).Encode(req); err != nil {
-		return err
+	return err.Error()
+}
+
+func (s *HTTPServer) writeToRemoteNode(ctx context.Context, address, key string, value *storage.VersionedValue) error {
+	return s.sendReplica(ctx, address, key, value, "")
+}
+
+// sendReplica replicates value to the node at address, which keeps it as a
+// hint when hintFor names the replica it stands in for.
+func (s *HTTPServer) sendReplica(ctx context.Context, address, key string, value *storage.VersionedValue, hintFor string) error {
+	return s.transport.Replicate(ctx, address, replicateRequest(key, value, hintFor))
+}
+
+// replicateRequest is the replica write of value and its siblings under key.
+func replicateRequest(key string, value *storage.VersionedValue, hintFor string) api.ReplicateRequest {
+	var siblings []api.ReplicateRequest
+	for _, sibling := range value.Siblings {
+		siblings = append(siblings, replicateRequest(key, sibling, ""))
 	}
-	url := fmt.Sprintf("http://%s/internal/storage/%s", address, key)
-	resp, err := s.client.Post(url, "application/json", strings.NewReader(jsonData.String()))
-	if err != nil {
-		return err
+	return api.ReplicateRequest{
+		Key:         key,
+		Value:       value.Value,
+		Version:     value.Version,
+		ExpiresAt:   value.ExpiresAt,
+		Timestamp:   value.Timestamp,
+		Checksum:    value.Checksum,
+		HintFor:     hintFor,
+		Tombstone:   value.Tombstone,
+		ContentType: value.ContentType,
+		Meta:        value.Meta,
+		Siblings:    siblings,
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("remote node %s returned status %d", address, resp.StatusCode)
+func (s *HTTPServer) handleDelete(w http.ResponseWriter, r *http.Request, key string) {
+	writeQuorum := s.getQuorumFromHeader(r, writeConsistencyHeader, s.cfg.WriteQuorum)
+	level, err := parseAckLevel(r.Header.Get(ackHeader))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
+	ctx, cancel, err := s.requestContext(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer cancel()
+	if err := s.delete(withAckLevel(ctx, level), key, writeQuorum); err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	var result api.ReplicateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+// delete writes a tombstone for key to its replicas through the same
+// quorum machinery as a put, under a version that supersedes the value
+// the replicas hold.
+func (s *HTTPServer) delete(ctx context.Context, key string, writeQuorum int) error {
+	if err := s.checkStandby(); err != nil {
+		return err
+	}
+	if err := s.checkBootstrapped(); err != nil {
 		return err
 	}
-	if !result.Success {
-		return fmt.Errorf("remote node %s failed to store value", address)
+	if err := s.checkNamespace(key); err != nil {
+		return err
 	}
-
+	previous := s.storedValue(ctx, key)
+	if err := s.deleteValue(ctx, key, previous, writeQuorum); err != nil {
+		return err
+	}
+	if !isManifest(previous) {
+		s.dropChunks(key, previous, "")
+	}
+	s.mirrorDelete(key)
 	return nil
 }
 
-func (s *HTTPServer) handleDelete(w http.ResponseWriter, _ *http.Request, key string) {
-	if err := s.storage.Delete(key); err != nil {
-		s.writeError(w, http.StatusInternalServerError, "failed to delete key")
-		return
+// deleteValue replaces previous, the value stored under key, with a
+// tombstone. The tombstone of a chunked value keeps its manifest and goes
+// to every replica rather than a quorum, so that none of them keeps
+// serving the value while its chunks are removed; each replica storing it
+// schedules that removal once cfg.TombstoneGrace has passed, leaving time
+// for the delete to reach replicas that missed it.
+func (s *HTTPServer) deleteValue(ctx context.Context, key string, previous []byte, writeQuorum int) error {
+	started := time.Now()
+	preferenceList, err := s.ring.GetPreferenceList(key, s.cfg.ReplicationFactor)
+	if err != nil {
+		return &opError{http.StatusInternalServerError, "failed to get preference list for key: " + key}
 	}
+	timingsFrom(ctx).since("route", started)
+	chunked := isManifest(previous)
+	localOnly := !chunked && slices.Contains(preferenceList, ring.NodeID(s.cfg.NodeID)) && (len(preferenceList) == 1 || writeQuorum == 1)
+	version, err := s.nextVersion(ctx, key, nil, preferenceList, localOnly)
+	if err != nil {
+		return storeError(key, err)
+	}
+	var value []byte
+	if chunked {
+		value = previous
+	}
+	tombstone := storage.NewVersionedValue(value, version)
+	tombstone.Tombstone = true
+	tombstone.Seal()
 
-	w.WriteHeader(http.StatusNoContent)
+	count := s.quorumFor(ctx, writeQuorum, preferenceList, true)
+	s.reportDowngrade(ctx, count, true)
+	var successCount int
+	var stale bool
+	var statuses replicaStatuses
+	if !chunked {
+		successCount, stale, statuses = s.writeToNodes(ctx, key, tombstone, preferenceList, writeQuorum)
+	} else {
+		_, stale, statuses = s.writeToNodes(everyReplica(ctx), key, tombstone, preferenceList, len(preferenceList))
+		successCount = count.acked(statuses)
+	}
+	if !count.met(successCount) {
+		if stale {
+			return storeError(key, storage.ErrStaleVersion)
+		}
+		return s.quorumError(ctx, key, statuses, &opError{http.StatusServiceUnavailable, "insufficient replicas available for write quorum for key: " + key})
+	}
+	return nil
 }
 
 func (s *HTTPServer) handleInternalStorage(w http.ResponseWriter, r *http.Request) {
@@ -291,13 +1139,12 @@ func (s *HTTPServer) handleInternalStorage(w http.ResponseWriter, r *http.Reques
 
 	switch r.Method {
 	case http.MethodGet:
-		value, found := s.storage.Get(key)
-		response := api.ReplicateGetResponse{
-			Key:   key,
-			Value: value,
-			Found: found,
+		if wantsMetadata(r) {
+			s.writeJSON(w, s.localMetadata(key))
+			return
 		}
-		if found {
+		response, found := s.localRead(key)
+		if found || response.Corrupt || response.Tombstone {
 			w.WriteHeader(http.StatusOK)
 		} else {
 			w.WriteHeader(http.StatusNotFound)
@@ -309,29 +1156,99 @@ func (s *HTTPServer) handleInternalStorage(w http.ResponseWriter, r *http.Reques
 			s.writeError(w, http.StatusBadRequest, "invalid request body")
 			return
 		}
-		if err := s.storage.Put(key, req.Value); err != nil {
+		value, err := replicateValue(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			s.writeJSON(w, api.ReplicateResponse{Success: false, Error: err.Error()})
+			return
+		}
+		if req.HintFor != "" {
+			if err := s.storeHint(ring.NodeID(req.HintFor), key, value); err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				s.writeJSON(w, api.ReplicateResponse{Success: false, Error: err.Error()})
+				return
+			}
+			s.writeJSON(w, api.ReplicateResponse{Success: true, Ack: api.AckBuffered})
+			return
+		}
+		if err := s.storeVersioned(key, value); err != nil {
 			response := api.ReplicateResponse{
 				Success: false,
 				Error:   "failed to store value",
 			}
-			w.WriteHeader(http.StatusInternalServerError)
+			if errors.Is(err, storage.ErrStaleVersion) {
+				response.Error = err.Error()
+				response.Ack = api.AckStale
+				w.WriteHeader(http.StatusConflict)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
 			s.writeJSON(w, response)
 			return
 		}
 
-		response := api.ReplicateResponse{Success: true}
+		s.synced.note()
+		response := api.ReplicateResponse{Success: true, Ack: api.AckApplied}
 		w.WriteHeader(http.StatusOK)
 		s.writeJSON(w, response)
+	case http.MethodDelete:
+		// Removes the local copy outright; used to clean up chunks
+		if err := s.storeDelete(key); err != nil {
+			s.writeError(w, http.StatusInternalServerError, "failed to delete key")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
 	default:
 		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
 	}
 }
 
+// handleInternalBatch stores several replicated values with a single storage batch.
+func (s *HTTPServer) handleInternalBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	var req api.ReplicateBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	items := make([]storage.KeyedVersionedValue, 0, len(req.Items))
+	for _, item := range req.Items {
+		if item.Key == "" {
+			s.writeError(w, http.StatusBadRequest, "key cannot be empty")
+			return
+		}
+		value, err := replicateValue(item)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		items = append(items, storage.KeyedVersionedValue{Key: item.Key, Value: value})
+	}
+	if err := s.storeBatch(items); err != nil {
+		response := api.ReplicateResponse{
+			Success: false,
+			Error:   "failed to store batch",
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		s.writeJSON(w, response)
+		return
+	}
+	s.synced.note()
+
+	response := api.ReplicateResponse{Success: true, Ack: api.AckApplied}
+	w.WriteHeader(http.StatusOK)
+	s.writeJSON(w, response)
+}
+
 func (s *HTTPServer) writeJSON(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(v); err != nil {
 		// Log error but don't write to response as headers may already be sent
-		fmt.Printf("failed to encode JSON response: %v\n", err)
+		s.logger.Printf("failed to encode JSON response: %v\n", err)
 	}
 }
 
@@ -342,69 +1259,325 @@ func (s *HTTPServer) writeError(w http.ResponseWriter, status int, message strin
 	json.NewEncoder(w).Encode(errorResp)
 }
 
+// checkBootstrapped refuses writes until cfg.BootstrapExpect nodes have
+// joined, so a lone first node does not accept data that the full ring would
+// place elsewhere. Once reached, later membership changes do not block writes.
+func (s *HTTPServer) checkBootstrapped() error {
+	if s.bootstrapped.Load() {
+		return nil
+	}
+	size := s.ring.Size()
+	if size < s.cfg.BootstrapExpect {
+		return &opError{http.StatusServiceUnavailable, fmt.Sprintf("cluster bootstrapping: %d of %d expected nodes have joined", size, s.cfg.BootstrapExpect)}
+	}
+	if s.bootstrapped.CompareAndSwap(false, true) && s.cfg.BootstrapExpect > 0 {
+		s.logger.Printf("cluster bootstrapped with %d nodes\n", size)
+	}
+	return nil
+}
+
+// opError is a failed KV operation together with the HTTP status it maps to.
+type opError struct {
+	status  int
+	message string
+}
+
+func (e *opError) Error() string { return e.message }
+
+func (s *HTTPServer) writeOpError(w http.ResponseWriter, err error) {
+	var deadlineErr *deadlineError
+	if errors.As(err, &deadlineErr) {
+		s.writeDeadlineError(w, deadlineErr)
+		return
+	}
+	var opErr *opError
+	if errors.As(err, &opErr) {
+		s.writeError(w, opErr.status, opErr.message)
+		return
+	}
+	s.writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// getQuorumFromHeader reads the R or W a request gives in headerName.
 func (s *HTTPServer) getQuorumFromHeader(r *http.Request, headerName string, defaultValue int) int {
-	if headerValue := r.Header.Get(headerName); headerValue != "" {
-		var quorum int
-		quorum, err := strconv.Atoi(headerValue)
-		if err == nil && quorum > 0 {
-			return quorum
+	return quorum.Parse(r.Header.Get(headerName), s.cfg.ReplicationFactor, defaultValue)
+}
+
+// checkClockDrift guards writes against clients with broken clocks when
+// cfg.LWW is set. A client timestamp further than MaxClockDrift from the
+// coordinator HLC is rejected or logged depending on DriftPolicy; accepted
+// timestamps advance the HLC and are stored as the time of the write.
+func (s *HTTPServer) checkClockDrift(ts clock.Timestamp, key string) error {
+	if drift := s.hlc.Drift(ts); drift > s.cfg.MaxClockDrift {
+		if s.cfg.DriftPolicy == config.DriftPolicyReject {
+			return fmt.Errorf("client timestamp deviates from coordinator clock by %v (max %v)", drift, s.cfg.MaxClockDrift)
 		}
+		s.logger.Printf("client timestamp for key: %s deviates from coordinator clock by %v (max %v)\n", key, drift, s.cfg.MaxClockDrift)
+		return nil
 	}
-	return defaultValue
+	s.hlc.Update(ts)
+	return nil
 }
 
-func (s *HTTPServer) readFromNodes(key string, prefList []ring.NodeID, readQuorum int) []api.GetResponse {
-	responses := make([]api.GetResponse, 0, len(prefList))
+type writeTimeKey struct{}
 
-	for _, nodeID := range prefList {
-		if len(responses) >= readQuorum {
-			break
+// withWriteTime has the writes made with ctx stamped with at, the client
+// timestamp of an LWW write, instead of the coordinator's clock.
+func withWriteTime(ctx context.Context, at time.Time) context.Context {
+	return context.WithValue(ctx, writeTimeKey{}, at)
+}
+
+// writeTimeFrom returns the time a write made with ctx is stamped with, or
+// zero for the coordinator's clock.
+func writeTimeFrom(ctx context.Context) time.Time {
+	at, _ := ctx.Value(writeTimeKey{}).(time.Time)
+	return at
+}
+
+// parseClientTimestamp accepts either RFC3339 or integer Unix nanoseconds.
+func parseClientTimestamp(raw string) (clock.Timestamp, error) {
+	if nanos, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return clock.Timestamp{WallTime: nanos}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return clock.Timestamp{}, fmt.Errorf("invalid timestamp %q", raw)
+	}
+	return clock.Timestamp{WallTime: t.UnixNano()}, nil
+}
+
+// parseChecksum reads the optional CRC32 (IEEE) of a PUT body, in decimal.
+func parseChecksum(raw string) (*uint32, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	sum, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s header %q", checksumHeader, raw)
+	}
+	checksum := uint32(sum)
+	return &checksum, nil
+}
+
+// getTTL reads the optional TTL from the X-TTL-Seconds header or the ttl
+// query parameter. The header gives it in whole seconds; the parameter may
+// also be a Go duration ("1h30m").
+func (s *HTTPServer) getTTL(r *http.Request) (time.Duration, error) {
+	if raw := r.Header.Get(ttlSecondsHeader); raw != "" {
+		seconds, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s header %q", ttlSecondsHeader, raw)
 		}
+		return ttlFromSeconds(seconds)
+	}
+	raw := r.URL.Query().Get(ttlQueryParam)
+	if raw == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return ttlFromSeconds(seconds)
+	}
+	ttl, err := time.ParseDuration(raw)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid ttl %q", raw)
+	}
+	return ttl, nil
+}
+
+// maxTTLSeconds is the longest TTL, in seconds, a time.Duration can hold.
+const maxTTLSeconds = math.MaxInt64 / int64(time.Second)
 
-		// If it's this node, read locally
+// ttlFromSeconds converts a TTL given in whole seconds, refusing those that
+// are not positive or would overflow a time.Duration.
+func ttlFromSeconds(seconds int64) (time.Duration, error) {
+	if seconds <= 0 {
+		return 0, fmt.Errorf("ttl must be positive, got %d", seconds)
+	}
+	if seconds > maxTTLSeconds {
+		return 0, fmt.Errorf("ttl must be at most %d seconds, got %d", maxTTLSeconds, seconds)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// setTTL reports the time a value read has left before it expires, in the
+// response and its X-TTL-Seconds header.
+func setTTL(w http.ResponseWriter, response *api.GetResponse) {
+	if !response.Found || response.ExpiresAt.IsZero() {
+		return
+	}
+	left := time.Until(response.ExpiresAt)
+	response.TTLSeconds = max(int64((left+time.Second-1)/time.Second), 0)
+	w.Header().Set(ttlSecondsHeader, strconv.FormatInt(response.TTLSeconds, 10))
+}
+
+// replicaRead is the answer of one replica to a quorum read.
+type replicaRead struct {
+	nodeID ring.NodeID
+	api.ReplicateGetResponse
+}
+
+// readFromNodes asks every replica in prefList at once and collects the
+// first readQuorum healthy reads, returning separately the replicas that
+// reported a corrupt copy and how each replica answered. A tombstone at
+// least as new as every read so far ends the read early: the key was
+// deleted, and the replicas not yet heard from at best hold the value the
+// delete removed. Requests still outstanding at that point, or when ctx
+// ends, are cancelled.
+func (s *HTTPServer) readFromNodes(ctx context.Context, key string, prefList []ring.NodeID, readQuorum int) ([]replicaRead, []ring.NodeID, replicaStatuses) {
+	responses := make([]replicaRead, 0, len(prefList))
+	var corrupt []ring.NodeID
+	statuses := make(replicaStatuses, len(prefList))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type reply struct {
+		read replicaRead
+		err  error
+	}
+	timings := timingsFrom(ctx)
+	results := make(chan reply, len(prefList))
+	pending := 0
+	for _, nodeID := range prefList {
 		if nodeID == ring.NodeID(s.cfg.NodeID) {
-			value, found := s.storage.Get(key)
-			responses = append(responses, api.GetResponse{
-				Key:   key,
-				Value: value,
-				Found: found,
-			})
+			// If it's this node, read locally
+			started := time.Now()
+			resp, _ := s.localRead(key)
+			timings.since("local", started)
+			results <- reply{read: replicaRead{nodeID, resp}}
+			statuses[nodeID] = replicaNoAnswer
+			pending++
 			continue
 		}
-
 		// Read from remote node
 		address, exists := s.ring.GetNodeAddress(nodeID)
 		if !exists {
+			statuses[nodeID] = replicaUnknownID
 			continue
 		}
+		statuses[nodeID] = replicaNoAnswer
+		pending++
+		go func() {
+			started := time.Now()
+			resp, err := s.readFromRemoteNode(ctx, address, key)
+			timings.replica(nodeID, started)
+			results <- reply{replicaRead{nodeID, resp}, err}
+		}()
+	}
 
-		resp, err := s.readFromRemoteNode(address, key)
-		if err == nil {
-			responses = append(responses, resp)
+	count := s.quorumFor(ctx, readQuorum, prefList, false)
+	acks := 0
+	for ; pending > 0 && !count.met(acks); pending-- {
+		var r reply
+		select {
+		case r = <-results:
+		default:
+			// Take replies already in, such as the local read, even when
+			// ctx has ended by now
+			select {
+			case r = <-results:
+			case <-ctx.Done():
+				return responses, corrupt, statuses
+			}
+		}
+		read := r.read
+		switch {
+		case r.err != nil:
+			// A failed read counts as neither healthy nor corrupt
+			statuses[read.nodeID] = readStatus(r.err)
+		case read.Corrupt:
+			statuses[read.nodeID] = replicaCorrupt
+			corrupt = append(corrupt, read.nodeID)
+		case read.Tombstone && supersedesAll(read.ReplicateGetResponse, responses):
+			statuses[read.nodeID] = replicaOK
+			s.metrics.Count("tombstone_reads", 1)
+			return append(responses, read), corrupt, statuses
+		default:
+			statuses[read.nodeID] = replicaOK
+			responses = append(responses, read)
+			if count.counts(read.nodeID) {
+				acks++
+			}
 		}
 	}
-	return responses
+	return responses, corrupt, statuses
 }
 
-func (s *HTTPServer) readFromRemoteNode(address, key string) (api.GetResponse, error) {
-	url := fmt.Sprintf("http://%s/internal/storage/%s", address, key)
-	resp, err := s.client.Get(url)
+// readStatus describes a failed replica read.
+func readStatus(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return replicaNoAnswer
+	}
+	return err.Error()
+}
+
+// localRead reads key from local storage to serve a read, which it counts
+// as an access of the key.
+func (s *HTTPServer) localRead(key string) (api.ReplicateGetResponse, bool) {
+	s.access.Record(key, time.Now())
+	return s.localCopy(key)
+}
+
+// localCopy reads key from local storage in replica form, flagging a value
+// that failed checksum verification as corrupt and reporting a tombstone
+// with the clock of the delete.
+func (s *HTTPServer) localCopy(key string) (api.ReplicateGetResponse, bool) {
+	item, found, err := s.storage.GetChecked(key)
 	if err != nil {
-		return api.GetResponse{}, err
+		s.logger.Printf("local replica for key: %s is corrupt: %v\n", key, err)
+		return api.ReplicateGetResponse{Key: key, Corrupt: true}, false
 	}
-	defer resp.Body.Close()
+	if !found {
+		if deleted, ok := s.versions.GetVersioned(key); ok && deleted.Tombstone {
+			return api.ReplicateGetResponse{Key: key, Version: deleted.Version, ExpiresAt: deleted.ExpiresAt, Timestamp: deleted.Timestamp, Tombstone: true, SyncedAt: s.synced.syncedAt(), Siblings: replicaSiblings(key, deleted.Siblings)}, false
+		}
+	}
+	return api.ReplicateGetResponse{
+		Key:         key,
+		Value:       item.Value,
+		Version:     item.Version,
+		Found:       found,
+		ExpiresAt:   item.ExpiresAt,
+		Timestamp:   item.UpdatedAt,
+		Checksum:    crc32.ChecksumIEEE(item.Value),
+		SyncedAt:    s.synced.syncedAt(),
+		ContentType: item.ContentType,
+		Meta:        item.Meta,
+		Siblings:    replicaSiblings(key, item.Siblings),
+	}, found
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return api.GetResponse{}, fmt.Errorf("remote node returned status %d", resp.StatusCode)
+// repairReplicas overwrites stale or corrupt replicas with the value a
+// quorum read returned. A replica that has since moved past that version
+// rejects the repair as stale.
+func (s *HTTPServer) repairReplicas(healthy api.ReplicateGetResponse, replicas []ring.NodeID) {
+	value := replicaValue(healthy.Value, healthy.Version, healthy)
+	value.Tombstone = healthy.Tombstone
+	for _, nodeID := range replicas {
+		var err error
+		if nodeID == ring.NodeID(s.cfg.NodeID) {
+			err = s.storeVersioned(healthy.Key, value)
+		} else if address, exists := s.ring.GetNodeAddress(nodeID); exists {
+			err = s.writeToRemoteNode(context.Background(), address, healthy.Key, value)
+		}
+		if err != nil {
+			s.logger.Printf("failed to repair replica %s for key: %s, error: %v\n", nodeID, healthy.Key, err)
+			continue
+		}
+		s.stats.readRepairs.Add(1)
+		s.metrics.Count("read_repairs", 1)
+		s.logger.Printf("repaired replica %s for key: %s\n", nodeID, healthy.Key)
 	}
+}
 
-	var result api.ReplicateGetResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return api.GetResponse{}, err
+func (s *HTTPServer) readFromRemoteNode(ctx context.Context, address, key string) (api.ReplicateGetResponse, error) {
+	result, err := s.transport.Get(ctx, address, key)
+	if err != nil {
+		return api.ReplicateGetResponse{}, err
+	}
+	for _, version := range append([]api.ReplicateGetResponse{result}, result.Siblings...) {
+		if version.Found && crc32.ChecksumIEEE(version.Value) != version.Checksum {
+			return api.ReplicateGetResponse{}, fmt.Errorf("remote node %s: %w", address, errChecksumMismatch)
+		}
 	}
-	return api.GetResponse{
-		Key:   result.Key,
-		Value: result.Value,
-		Found: result.Found,
-	}, nil
+	return result, nil
 }
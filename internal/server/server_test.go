@@ -0,0 +1,559 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/internal/hints"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+	"github.com/amirderis/DHT/pkg/api/dhtpb"
+)
+
+func newTestServer(t *testing.T) *HTTPServer {
+	t.Helper()
+	cfg := &config.Config{NodeID: "test-node", BindAddr: "127.0.0.1:0"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Failed to validate config: %v", err)
+	}
+	return NewHTTPServer(cfg)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestHTTPServerServesH2C(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewUnstartedServer(s.server.Handler)
+	ts.Config.Protocols = s.server.Protocols
+	ts.Config.HTTP2 = s.server.HTTP2
+	ts.Start()
+	defer ts.Close()
+
+	h2c := &http.Client{Transport: newPeerTransport()}
+	resp, err := h2c.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("Failed h2c request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2 response, got %s", resp.Proto)
+	}
+
+	resp, err = http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("Failed HTTP/1.1 request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Errorf("Expected HTTP/1.1 clients to keep working, got %s", resp.Proto)
+	}
+}
+
+func TestHTTPServerStreamLimit(t *testing.T) {
+	s := newTestServer(t)
+	if got := s.server.HTTP2.MaxConcurrentStreams; got != 250 {
+		t.Errorf("Expected default of 250 concurrent streams, got %d", got)
+	}
+}
+
+func TestBootstrapExpectBlocksWrites(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.BootstrapExpect = 2
+	s.cfg.WriteQuorum = 1
+
+	put := func() int {
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/kv/key", strings.NewReader("value")))
+		return rec.Code
+	}
+	if code := put(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the cluster bootstraps, got %d", code)
+	}
+
+	s.ring.JoinNode("peer", "127.0.0.1:9999", 1)
+	if code := put(); code != http.StatusOK {
+		t.Errorf("Expected 200 once enough nodes joined, got %d", code)
+	}
+
+	s.ring.RemoveNode("peer")
+	if code := put(); code != http.StatusOK {
+		t.Errorf("Expected writes to keep working after bootstrap, got %d", code)
+	}
+}
+
+// startTestNode serves a node on a real listener so peers can reach it.
+func startTestNode(t *testing.T, id string) *HTTPServer {
+	t.Helper()
+	s, _ := startTestNodeWith(t, id, nil)
+	return s
+}
+
+// startTestNodeWith is startTestNode with configure applied to the config,
+// also returning the test server so that the node can be taken down.
+func startTestNodeWith(t *testing.T, id string, configure func(*config.Config)) (*HTTPServer, *httptest.Server) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	cfg := &config.Config{NodeID: id, BindAddr: l.Addr().String(), ReplicationFactor: 2, ReadQuorum: 2, WriteQuorum: 2}
+	if configure != nil {
+		configure(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Failed to validate config: %v", err)
+	}
+	s := NewHTTPServer(cfg)
+	ts := httptest.NewUnstartedServer(s.server.Handler)
+	ts.Listener.Close()
+	ts.Listener = l
+	ts.Config.Protocols = s.server.Protocols
+	ts.Config.HTTP2 = s.server.HTTP2
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func TestPutTTL(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	put := func(path, header string) int {
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader("value"))
+		if header != "" {
+			req.Header.Set(ttlSecondsHeader, header)
+		}
+		rec := httptest.NewRecorder()
+		a.server.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := put("/kv/key", "60"); code != http.StatusOK {
+		t.Fatalf("Expected a put with a TTL to succeed, got %d", code)
+	}
+	// Both replicas expire the value at the time the coordinator chose
+	local, _, _ := a.storage.GetChecked("key")
+	remote, _, _ := b.storage.GetChecked("key")
+	if local.ExpiresAt.IsZero() || !local.ExpiresAt.Equal(remote.ExpiresAt) {
+		t.Errorf("Expected the replicas to agree on the expiry, got %v and %v", local.ExpiresAt, remote.ExpiresAt)
+	}
+
+	rec := httptest.NewRecorder()
+	b.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kv/key", nil))
+	var got api.GetResponse
+	json.NewDecoder(rec.Body).Decode(&got)
+	if got.TTLSeconds <= 0 || got.TTLSeconds > 60 || !got.ExpiresAt.Equal(local.ExpiresAt) {
+		t.Errorf("Expected the remaining TTL in the response, got %+v", got)
+	}
+	if header := rec.Header().Get(ttlSecondsHeader); header != strconv.FormatInt(got.TTLSeconds, 10) {
+		t.Errorf("Expected the remaining TTL in the %s header, got %q", ttlSecondsHeader, header)
+	}
+
+	if code := put("/kv/key", "1m"); code != http.StatusBadRequest {
+		t.Errorf("Expected %s to take whole seconds only, got %d", ttlSecondsHeader, code)
+	}
+	if code := put("/kv/key", strconv.FormatInt(maxTTLSeconds+1, 10)); code != http.StatusBadRequest {
+		t.Errorf("Expected a TTL that overflows a duration to be refused, got %d", code)
+	}
+	if code := put("/kv/other?ttl=30", ""); code != http.StatusOK {
+		t.Fatalf("Expected a put with a ttl parameter to succeed, got %d", code)
+	}
+	rec = httptest.NewRecorder()
+	a.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kv/other", nil))
+	if left, err := strconv.Atoi(rec.Header().Get(ttlSecondsHeader)); err != nil || left <= 0 || left > 30 {
+		t.Errorf("Expected the ttl parameter to set the TTL, got %q", rec.Header().Get(ttlSecondsHeader))
+	}
+
+	// The gRPC API takes the same TTLs
+	k := &kvService{s: a}
+	for _, ttl := range []int64{-1, maxTTLSeconds + 1, math.MaxInt64} {
+		if _, err := k.Put(t.Context(), &dhtpb.PutRequest{Key: "grpc", Value: []byte("v"), TtlSeconds: ttl}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected a TTL of %d seconds to be refused over gRPC, got %v", ttl, err)
+		}
+	}
+	if _, err := k.Put(t.Context(), &dhtpb.PutRequest{Key: "grpc", Value: []byte("v"), TtlSeconds: 30}); err != nil {
+		t.Fatalf("Failed to put with a TTL over gRPC: %v", err)
+	}
+	item, _, _ := a.storage.GetChecked("grpc")
+	if item.ExpiresAt.IsZero() || time.Until(item.ExpiresAt) > 30*time.Second {
+		t.Errorf("Expected the gRPC TTL to set the expiry, got %v", item.ExpiresAt)
+	}
+	if got, err := k.Get(t.Context(), &dhtpb.GetRequest{Key: "grpc"}); err != nil || got.ExpiresAt != item.ExpiresAt.UnixNano() {
+		t.Errorf("Expected a gRPC read to return the stored expiry %v, got %v and %v", item.ExpiresAt, got, err)
+	}
+	k.Put(t.Context(), &dhtpb.PutRequest{Key: "forever", Value: []byte("v")})
+	if got, err := k.Get(t.Context(), &dhtpb.GetRequest{Key: "forever"}); err != nil || got.ExpiresAt != 0 {
+		t.Errorf("Expected no expiry for a value written without a TTL, got %v and %v", got, err)
+	}
+	rec = httptest.NewRecorder()
+	a.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kv/forever", nil))
+	if strings.Contains(rec.Body.String(), "expires_at") {
+		t.Errorf("Expected no expiry in the JSON of a value without a TTL, got %s", rec.Body.String())
+	}
+}
+
+func TestLWWClientTimestamp(t *testing.T) {
+	a, _ := startTestNodeWith(t, "a", func(cfg *config.Config) {
+		cfg.ReplicationFactor, cfg.ReadQuorum, cfg.WriteQuorum = 1, 1, 1
+		cfg.LWW = true
+	})
+	put := func(at time.Time) int {
+		req := httptest.NewRequest(http.MethodPut, "/kv/key", strings.NewReader("value"))
+		req.Header.Set(timestampHeader, strconv.FormatInt(at.UnixNano(), 10))
+		rec := httptest.NewRecorder()
+		a.server.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	at := time.Now().Add(-2 * time.Second)
+	if code := put(at); code != http.StatusOK {
+		t.Fatalf("Expected a write within the drift bound to succeed, got %d", code)
+	}
+	stored, ok := a.versions.GetVersioned("key")
+	if !ok || !stored.Timestamp.Equal(time.Unix(0, at.UnixNano())) {
+		t.Errorf("Expected the write to be stamped with the client timestamp %v, got %+v", at, stored)
+	}
+	if code := put(time.Now().Add(time.Hour)); code != http.StatusBadRequest {
+		t.Errorf("Expected a client timestamp past the drift bound to be refused, got %d", code)
+	}
+}
+
+func TestHeadKey(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	rec := httptest.NewRecorder()
+	a.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/kv/key", strings.NewReader("value")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected put to succeed, got %d", rec.Code)
+	}
+
+	head := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		b.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, path, nil))
+		return rec
+	}
+	rec = head("/kv/key")
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Fatalf("Expected 200 without a body, got %d: %q", rec.Code, rec.Body)
+	}
+	if length := rec.Header().Get("Content-Length"); length != "5" {
+		t.Errorf("Expected the value's length, got %q", length)
+	}
+	if checksum := rec.Header().Get(checksumHeader); checksum != strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte("value"))), 10) {
+		t.Errorf("Expected the value's checksum, got %q", checksum)
+	}
+	if context := rec.Header().Get(causalContextHeader); !strings.Contains(context, `"a":1`) {
+		t.Errorf("Expected the version in %s, got %q", causalContextHeader, context)
+	}
+
+	if rec := head("/kv/missing"); rec.Code != http.StatusNotFound || rec.Body.Len() != 0 || rec.Header().Get("Content-Length") != "0" {
+		t.Errorf("Expected 404 without a body, got %d: %q", rec.Code, rec.Body)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for condition")
+		}
+	}
+}
+
+func TestWireChecksums(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.WriteQuorum = 1
+
+	req := httptest.NewRequest(http.MethodPut, "/kv/key", strings.NewReader("value"))
+	req.Header.Set(checksumHeader, "1")
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a body that does not match its checksum, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/kv/key", strings.NewReader("value"))
+	req.Header.Set(checksumHeader, strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte("value"))), 10))
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a body matching its checksum, got %d", rec.Code)
+	}
+	if resp, err := s.get(t.Context(), "key", 1); err != nil || resp.Checksum != crc32.ChecksumIEEE([]byte("value")) {
+		t.Errorf("Expected the checksum of the value in the response, got %+v, %v", resp, err)
+	}
+
+	body := `{"key":"other","value":"dmFsdWU=","checksum":1}`
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/internal/storage/other", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a replica to refuse a corrupted value, got %d", rec.Code)
+	}
+	if _, ok := s.storage.Get("other"); ok {
+		t.Errorf("Expected the corrupted value not to be stored")
+	}
+}
+
+func TestWriteOneReplicates(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	store, err := hints.Open(t.TempDir(), hints.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to open hint store: %v", err)
+	}
+	a.hints = store
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+
+	// W=1 answers once a has the write and b gets it in the background
+	if _, err := a.put(t.Context(), "key", []byte("value"), nil, 1, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	waitFor(t, func() bool {
+		value, _ := b.storage.Get("key")
+		return string(value) == "value"
+	})
+	if err := a.delete(t.Context(), "key", 1); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	waitFor(t, func() bool {
+		_, ok := b.storage.Get("key")
+		return !ok
+	})
+
+	// and a replica that cannot take it gets a hint
+	c := startTestNode(t, "c")
+	c.hints = store
+	c.ring.JoinNode("d", "127.0.0.1:1", 1)
+	if _, err := c.put(t.Context(), "down", []byte("value"), nil, 1, time.Time{}); err != nil {
+		t.Fatalf("Failed to put with the other replica down: %v", err)
+	}
+	waitFor(t, func() bool { return store.Len("d") == 1 })
+}
+
+func TestClusterToken(t *testing.T) {
+	for _, transport := range []string{config.PeerTransportHTTP, config.PeerTransportGRPC} {
+		withToken := func(token string) func(*config.Config) {
+			return func(cfg *config.Config) {
+				cfg.ClusterToken = token
+				cfg.PeerTransport = transport
+			}
+		}
+		a, _ := startTestNodeWith(t, "a", withToken("cluster"))
+		b, _ := startTestNodeWith(t, "b", withToken("cluster"))
+		c, _ := startTestNodeWith(t, "c", withToken("other"))
+		a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+		c.ring.JoinNode("b", b.cfg.BindAddr, 1)
+
+		if _, err := a.put(t.Context(), "key", []byte("value"), nil, 2, time.Time{}); err != nil {
+			t.Errorf("Expected peers sharing the cluster token to replicate over %s, got %v", transport, err)
+		}
+		if _, err := c.put(t.Context(), "key", []byte("value"), nil, 2, time.Time{}); err == nil {
+			t.Errorf("Expected a peer with another cluster token to be refused over %s", transport)
+		}
+	}
+}
+
+func TestAsyncReplicationAfterQuorum(t *testing.T) {
+	a, b, c := startTestNode(t, "a"), startTestNode(t, "b"), startTestNode(t, "c")
+	for _, s := range []*HTTPServer{a, b, c} {
+		s.ring.JoinNode("a", a.cfg.BindAddr, 1)
+		s.ring.JoinNode("b", b.cfg.BindAddr, 1)
+		s.ring.JoinNode("c", c.cfg.BindAddr, 1)
+	}
+	a.cfg.ReplicationFactor = 3
+
+	if _, err := a.put(t.Context(), "key", []byte("value"), nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	waitFor(t, func() bool {
+		for _, s := range []*HTTPServer{a, b, c} {
+			if _, ok := s.storage.Get("key"); !ok {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestQuorumFanOut(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	cancelled := make(chan struct{}, 1)
+	release := make(chan struct{})
+	slow := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			cancelled <- struct{}{}
+		case <-release:
+		}
+	}))
+	slow.Config.Protocols = a.server.Protocols
+	slow.Start()
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	a.ring.JoinNode("slow", slow.Listener.Addr().String(), 1)
+	prefList := []ring.NodeID{"slow", "a", "b"}
+
+	start := time.Now()
+	vv := storage.NewVersionedValue([]byte("value"), clock.VectorClock{"a": 1})
+	if successes, _, _ := a.writeToNodes(t.Context(), "key", vv, prefList, 2); successes != 2 {
+		t.Fatalf("Expected 2 successful writes, got %d", successes)
+	}
+	reads, _, _ := a.readFromNodes(t.Context(), "key", prefList, 2)
+	if len(reads) != 2 {
+		t.Fatalf("Expected 2 reads, got %d", len(reads))
+	}
+	for _, read := range reads {
+		if read.nodeID == "slow" || string(read.Value) != "value" {
+			t.Errorf("Expected value from a fast replica, got %+v", read)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the slow replica not to hold up the quorum, took %s", elapsed)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("Expected the straggling read to be cancelled")
+	}
+}
+
+func TestBackgroundWritesBounded(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	store, err := hints.Open(t.TempDir(), hints.Limits{})
+	if err != nil {
+		t.Fatalf("Failed to open hint store: %v", err)
+	}
+	a.hints = store
+	cancelled := make(chan struct{}, 1)
+	slow := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		cancelled <- struct{}{}
+	}))
+	slow.Config.Protocols = a.server.Protocols
+	slow.Start()
+	t.Cleanup(slow.Close)
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	a.ring.JoinNode("slow", slow.Listener.Addr().String(), 1)
+
+	for range maxAsyncReplications {
+		a.asyncSlots <- struct{}{}
+	}
+	vv := storage.NewVersionedValue([]byte("value"), clock.VectorClock{"a": 1})
+	if successes, _, _ := a.writeToNodes(t.Context(), "key", vv, []ring.NodeID{"slow", "a", "b"}, 2); successes != 2 {
+		t.Fatalf("Expected 2 successful writes, got %d", successes)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("Expected the straggling write to be cancelled with no slot free")
+	}
+	if hints := store.Peek("slow", 10); len(hints) != 1 || hints[0].Key != "key" {
+		t.Errorf("Expected a hint for the straggling replica, got %+v", hints)
+	}
+}
+
+func TestReplicatedDeletes(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+
+	put, err := a.put(t.Context(), "key", []byte("value"), nil, 2, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodDelete, "/kv/key", nil)
+	req.Header.Set(writeConsistencyHeader, "2")
+	rec := httptest.NewRecorder()
+	b.server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, s := range []*HTTPServer{a, b} {
+		tombstone, ok := s.versions.GetVersioned("key")
+		if !ok || !tombstone.Tombstone {
+			t.Fatalf("Expected node %s to hold a tombstone, got %+v", s.cfg.NodeID, tombstone)
+		}
+		if clock.Compare(tombstone.Version, put.Version) != 1 {
+			t.Errorf("Expected the tombstone on %s to supersede %v, got %v", s.cfg.NodeID, put.Version, tombstone.Version)
+		}
+	}
+	if resp, err := a.get(t.Context(), "key", 2); err != nil || resp.Found {
+		t.Errorf("Expected the key to stay deleted, got %+v, %v", resp, err)
+	}
+
+	// A write quorum the cluster cannot meet fails the delete
+	a.cluster.MarkDead("b")
+	if err := a.delete(t.Context(), "key", 2); err == nil {
+		t.Errorf("Expected the delete to fail without a write quorum")
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	cfg := &config.Config{NodeID: "a", BindAddr: l.Addr().String()}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Failed to validate config: %v", err)
+	}
+
+	// A taken address fails the start without leaving anything running
+	busy := NewHTTPServer(cfg)
+	if err := busy.Start(); err == nil || !strings.Contains(err.Error(), "start listeners") {
+		t.Errorf("Expected the listeners to fail to start, got %v", err)
+	}
+	l.Close()
+
+	s := NewHTTPServer(cfg)
+	if err := s.Start(); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	resp, err := http.Get("http://" + cfg.BindAddr + "/readyz")
+	if err != nil {
+		t.Fatalf("Failed to reach the started node: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a node without seeds to be ready, got %d", resp.StatusCode)
+	}
+	if err := s.Stop(t.Context()); err != nil {
+		t.Errorf("Failed to stop: %v", err)
+	}
+	if _, err := http.Get("http://" + cfg.BindAddr + "/readyz"); err == nil {
+		t.Errorf("Expected the listener to be closed after stopping")
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// A session gives a client read-your-writes consistency. Every PUT answers
+// with an X-Session token recording the version it wrote, added to the
+// token the client sent with it, if any. A read presenting the token only
+// returns a version of the key at least as new as the one the session
+// wrote: when the read quorum returned something older, the coordinator
+// reads every replica, and answers 503 if that fails or none has caught
+// up yet.
+//
+// Clocks are per key, so the token keeps one per key written, identified
+// by a digest of the key. Deletes leave no version in read responses, so
+// a key not found on any replica is returned as such.
+
+// maxSessionKeys bounds how many keys a session token remembers; the
+// least recently written are forgotten first.
+const maxSessionKeys = 64
+
+// sessionWrite is the version a session wrote to one key.
+type sessionWrite struct {
+	Key     string            `json:"k"`
+	Version clock.VectorClock `json:"v"`
+}
+
+// session is a decoded X-Session token, oldest write first.
+type session []sessionWrite
+
+// sessionKey identifies key in a token without spelling it out.
+func sessionKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func parseSession(raw string) (session, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s token", sessionHeader)
+	}
+	var sess session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("invalid %s token", sessionHeader)
+	}
+	return sess, nil
+}
+
+func (sess session) encode() string {
+	data, _ := json.Marshal(sess)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// version returns the version the session wrote to key.
+func (sess session) version(key string) (clock.VectorClock, bool) {
+	id := sessionKey(key)
+	for _, write := range sess {
+		if write.Key == id {
+			return write.Version, true
+		}
+	}
+	return nil, false
+}
+
+// record returns the session extended with a write of version to key.
+func (sess session) record(key string, version clock.VectorClock) session {
+	id := sessionKey(key)
+	next := make(session, 0, min(len(sess)+1, maxSessionKeys))
+	for _, write := range sess[max(0, len(sess)+1-maxSessionKeys):] {
+		if write.Key != id {
+			next = append(next, write)
+		}
+	}
+	return append(next, sessionWrite{id, version})
+}
+
+// covers reports whether a read returned the version the session wrote or
+// a newer one.
+func covers(response api.GetResponse, version clock.VectorClock) bool {
+	if !response.Found {
+		return false
+	}
+	context := causalContext(response)
+	return clock.Equal(context, version) || clock.Compare(context, version) > 0
+}
+
+// readYourWrites checks a read of key against the session and, when it
+// is older than the session's write, reads key again from every replica.
+func (s *HTTPServer) readYourWrites(ctx context.Context, key string, sess session, response api.GetResponse, read func(ctx context.Context, key string, readQuorum int) (api.GetResponse, error)) (api.GetResponse, error) {
+	version, ok := sess.version(key)
+	if !ok || covers(response, version) {
+		return response, nil
+	}
+	s.metrics.Count("session_retries", 1)
+	response, err := read(ctx, key, s.cfg.ReplicationFactor)
+	if err != nil || !response.Found || covers(response, version) {
+		return response, err
+	}
+	s.metrics.Count("session_misses", 1)
+	return api.GetResponse{}, &opError{http.StatusServiceUnavailable, "no replica has caught up with this session's write of key: " + key}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/storage"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	do := func(node *HTTPServer, method, key, body, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/kv/"+key, strings.NewReader(body))
+		req.Header.Set(readConsistencyHeader, "1")
+		if token != "" {
+			req.Header.Set(sessionHeader, token)
+		}
+		node.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(a, http.MethodPut, "other", "value", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	rec = do(a, http.MethodPut, "key", "v1", rec.Header().Get(sessionHeader))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	sess, err := parseSession(rec.Header().Get(sessionHeader))
+	if err != nil || len(sess) != 2 {
+		t.Fatalf("Expected the token to remember both writes, got %+v, %v", sess, err)
+	}
+
+	// A newer write that only reached a
+	version, _ := sess.version("key")
+	newer := version.Copy()
+	newer.Increment("a")
+	a.versions.PutVersioned("key", storage.NewVersionedValue([]byte("v2"), newer))
+	token := sess.record("key", newer).encode()
+
+	if rec := do(b, http.MethodGet, "key", "", ""); !strings.Contains(rec.Body.String(), `"value":"djE="`) {
+		t.Errorf("Expected b alone to return its stale v1, got %s", rec.Body.String())
+	}
+	if rec := do(b, http.MethodGet, "key", "", token); !strings.Contains(rec.Body.String(), `"value":"djI="`) {
+		t.Errorf("Expected the session to read v2 from a, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(b, http.MethodGet, "other", "", token); rec.Code != http.StatusOK {
+		t.Errorf("Expected a read of another key written in the session, got %d", rec.Code)
+	}
+
+	unseen := sess.record("key", clock.VectorClock{"a": 99}).encode()
+	if rec := do(b, http.MethodGet, "key", "", unseen); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when no replica has the session's write, got %d", rec.Code)
+	}
+	if rec := do(b, http.MethodGet, "key", "", "not a token"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid token, got %d", rec.Code)
+	}
+}
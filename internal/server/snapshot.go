@@ -0,0 +1,122 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// A snapshot is a copy of every live value this node stores, written to
+// cfg.DataDir/snapshots/{id}.json. dhtctl snapshot --cluster asks every
+// node for one at the same HLC timestamp, which is as consistent as the
+// cluster gets without pausing writes.
+
+const (
+	// snapshotDir is the directory under the data directory holding snapshots.
+	snapshotDir = "snapshots"
+	// maxSnapshotLead bounds how far in the future a snapshot may be requested.
+	maxSnapshotLead = time.Minute
+)
+
+var snapshotIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// handleSnapshot serves POST /admin/snapshot. It waits until the node's
+// HLC reaches the requested time, takes the snapshot and describes it. The
+// write deadline of the connection is pushed out past the wait and again
+// once the snapshot is written, so that the answer outlasts the listener's
+// timeout.
+func (s *HTTPServer) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	var req api.SnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !snapshotIDPattern.MatchString(req.ID) || req.ID[0] == '.' {
+		s.writeError(w, http.StatusBadRequest, "invalid snapshot id: "+req.ID)
+		return
+	}
+	if s.cfg.DataDir == "" {
+		s.writeError(w, http.StatusConflict, "snapshots need a data directory")
+		return
+	}
+	rc := http.NewResponseController(w)
+	if lead := time.Until(req.At); lead > maxSnapshotLead {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("snapshot time is %v away (max %v)", lead.Round(time.Second), maxSnapshotLead))
+		return
+	} else if lead > 0 {
+		_ = rc.SetWriteDeadline(time.Now().Add(lead + streamIdleTimeout))
+		select {
+		case <-time.After(lead):
+		case <-r.Context().Done():
+			return
+		case <-s.stopCh:
+			s.writeError(w, http.StatusServiceUnavailable, "node is shutting down")
+			return
+		}
+	}
+
+	// Never record a timestamp before the requested one, even when this
+	// node's physical clock lags behind the requester's
+	at := s.hlc.Update(clock.Timestamp{WallTime: req.At.UnixNano()})
+	snapshot, err := s.writeSnapshot(req.ID, at)
+	if err != nil {
+		s.logger.Printf("failed to write snapshot %s: %v\n", req.ID, err)
+		s.writeError(w, http.StatusInternalServerError, "failed to write snapshot")
+		return
+	}
+	_ = rc.SetWriteDeadline(time.Now().Add(streamIdleTimeout))
+	s.metrics.Count("snapshots", 1)
+	s.writeJSON(w, snapshot)
+}
+
+// writeSnapshot copies the live values into the snapshot file for id.
+func (s *HTTPServer) writeSnapshot(id string, at clock.Timestamp) (api.NodeSnapshot, error) {
+	snapshot := api.NodeSnapshot{ID: id, NodeID: s.cfg.NodeID, HLCWallTime: at.WallTime, HLCLogical: at.Logical}
+	entries := []api.SnapshotEntry{}
+	for _, item := range s.storage.Snapshot("") {
+		entries = append(entries, api.SnapshotEntry{
+			Key:         item.Key,
+			Value:       item.Value,
+			Version:     item.Version,
+			UpdatedAt:   item.UpdatedAt,
+			ExpiresAt:   item.ExpiresAt,
+			ContentType: item.ContentType,
+			Meta:        item.Meta,
+		})
+		snapshot.Bytes += int64(len(item.Value))
+	}
+	snapshot.Keys = len(entries)
+
+	data, err := json.Marshal(api.SnapshotFile{NodeSnapshot: snapshot, Entries: entries})
+	if err != nil {
+		return api.NodeSnapshot{}, err
+	}
+	dir := filepath.Join(s.cfg.DataDir, snapshotDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return api.NodeSnapshot{}, err
+	}
+	snapshot.Path = filepath.Join(dir, id+".json")
+	tmp := snapshot.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return api.NodeSnapshot{}, err
+	}
+	if err := os.Rename(tmp, snapshot.Path); err != nil {
+		return api.NodeSnapshot{}, err
+	}
+	sum := sha256.Sum256(data)
+	snapshot.SHA256 = hex.EncodeToString(sum[:])
+	return snapshot, nil
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestSnapshot(t *testing.T) {
+	s := newTestServer(t)
+	if _, err := s.put(t.Context(), "key", []byte("value"), nil, 1, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	snapshot := func(req api.SnapshotRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/snapshot", bytes.NewReader(body)))
+		return rec
+	}
+
+	if rec := snapshot(api.SnapshotRequest{ID: "first", At: time.Now()}); rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 without a data directory, got %d", rec.Code)
+	}
+	s.cfg.DataDir = t.TempDir()
+	if rec := snapshot(api.SnapshotRequest{ID: "../escape", At: time.Now()}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid id, got %d", rec.Code)
+	}
+	if rec := snapshot(api.SnapshotRequest{ID: "first", At: time.Now().Add(time.Hour)}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a snapshot too far ahead, got %d", rec.Code)
+	}
+
+	at := time.Now().Add(50 * time.Millisecond)
+	rec := snapshot(api.SnapshotRequest{ID: "first", At: at})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp api.NodeSnapshot
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode snapshot: %v", err)
+	}
+	if resp.Keys != 1 || resp.NodeID != "test-node" || resp.HLCWallTime < at.UnixNano() {
+		t.Errorf("Expected 1 key taken at or after %d, got %+v", at.UnixNano(), resp)
+	}
+	data, err := os.ReadFile(resp.Path)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot file: %v", err)
+	}
+	var file struct {
+		Entries []api.SnapshotEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil || len(file.Entries) != 1 || string(file.Entries[0].Value) != "value" {
+		t.Errorf("Expected the snapshot file to hold the value, got %+v, %v", file, err)
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != resp.SHA256 {
+		t.Errorf("Expected the digest to match the file")
+	}
+
+	// A lead longer than the listener's write timeout is still answered
+	ts := httptest.NewUnstartedServer(s.server.Handler)
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	t.Cleanup(ts.Close)
+	body, _ := json.Marshal(api.SnapshotRequest{ID: "later", At: time.Now().Add(300 * time.Millisecond)})
+	later, err := http.Post(ts.URL+"/admin/snapshot", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Expected the snapshot answered after its lead, got %v", err)
+	}
+	later.Body.Close()
+	if later.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 after a long lead, got %d", later.StatusCode)
+	}
+}
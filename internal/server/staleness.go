@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/amirderis/DHT/internal/membership"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// syncClock records when this node last exchanged data with its peers: a
+// peer replicated, repaired or handed off a value to it, or confirmed its
+// copy in a digest read. A node that is partitioned or has just restarted
+// stops advancing it, which bounded staleness reads rely on.
+type syncClock struct {
+	last atomic.Int64 // Unix nanoseconds; zero until the first exchange
+}
+
+func (c *syncClock) note() {
+	c.last.Store(time.Now().UnixNano())
+}
+
+func (c *syncClock) syncedAt() time.Time {
+	if nanos := c.last.Load(); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
+// parseBoundedStaleness reads a "bounded(Δ)" read consistency level, e.g.
+// "bounded(5s)". ok is false for any other level, which is a quorum size.
+func parseBoundedStaleness(raw string) (bound time.Duration, ok bool, err error) {
+	inner, found := strings.CutPrefix(raw, "bounded(")
+	if !found {
+		return 0, false, nil
+	}
+	inner, found = strings.CutSuffix(inner, ")")
+	if !found {
+		return 0, true, fmt.Errorf("invalid consistency level %q", raw)
+	}
+	bound, err = time.ParseDuration(inner)
+	if err != nil || bound <= 0 {
+		return 0, true, fmt.Errorf("invalid staleness bound in %q", raw)
+	}
+	return bound, true, nil
+}
+
+// getBounded serves key from a single replica when that replica synced
+// with its peers within bound, and escalates to a quorum read otherwise.
+// Chunked values are always read with a quorum.
+func (s *HTTPServer) getBounded(ctx context.Context, key string, bound time.Duration) (api.GetResponse, error) {
+	if err := s.checkNamespace(key); err != nil {
+		return api.GetResponse{}, err
+	}
+	preferenceList, err := s.ring.GetPreferenceList(key, s.cfg.ReplicationFactor)
+	if err != nil {
+		return api.GetResponse{}, &opError{http.StatusInternalServerError, "failed to get preference list for key: " + key}
+	}
+	read, ok := s.freshRead(ctx, key, preferenceList, bound)
+	if !ok || (read.Found && isManifest(read.Value)) {
+		s.metrics.Count("bounded_escalations", 1)
+		return s.get(ctx, key, s.cfg.ReadQuorum)
+	}
+	s.countRead(readPathBounded)
+	response := readResponse(key, read)
+	if response = typedDocument(response); response.Found {
+		response.Checksum = crc32.ChecksumIEEE(response.Value)
+	}
+	s.mirrorGet(key, response)
+	return response, nil
+}
+
+// freshRead reads key from the closest replica, this node when it is one,
+// and reports whether that replica synced with its peers within bound.
+func (s *HTTPServer) freshRead(ctx context.Context, key string, preferenceList []ring.NodeID, bound time.Duration) (api.ReplicateGetResponse, bool) {
+	var read api.ReplicateGetResponse
+	if slices.Contains(preferenceList, ring.NodeID(s.cfg.NodeID)) {
+		read, _ = s.localRead(key)
+	} else {
+		i := slices.IndexFunc(preferenceList, func(nodeID ring.NodeID) bool {
+			return s.cluster.State(string(nodeID)) != membership.Dead
+		})
+		if i < 0 {
+			return read, false
+		}
+		address, exists := s.ring.GetNodeAddress(preferenceList[i])
+		if !exists {
+			return read, false
+		}
+		var err error
+		if read, err = s.readFromRemoteNode(ctx, address, key); err != nil {
+			return read, false
+		}
+	}
+	if read.Corrupt || read.SyncedAt.IsZero() {
+		return read, false
+	}
+	return read, time.Since(read.SyncedAt) <= bound
+}
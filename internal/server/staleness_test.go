@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBoundedStalenessReads(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+
+	bounded := func(s *HTTPServer, level string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/kv/key", nil)
+		req.Header.Set(readConsistencyHeader, level)
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if _, err := a.put(t.Context(), "key", []byte("value"), nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	// b just received the value from a, so it synced moments ago
+	if rec := bounded(b, "bounded(1m)"); rec.Code != http.StatusOK || b.stats.boundedReads.Value() != 1 {
+		t.Errorf("Expected a single-replica read from b, got status %d and %d bounded reads", rec.Code, b.stats.boundedReads.Value())
+	}
+	// a has not heard from a peer yet and escalates to a quorum
+	if rec := bounded(a, "bounded(1m)"); rec.Code != http.StatusOK || a.stats.boundedReads.Value() != 0 || a.stats.localReads.Value()+a.stats.digestReads.Value()+a.stats.quorumReads.Value() != 1 {
+		t.Errorf("Expected a to escalate, got status %d and %d bounded reads", rec.Code, a.stats.boundedReads.Value())
+	}
+	b.synced.last.Store(time.Now().Add(-time.Hour).UnixNano())
+	if rec := bounded(b, "bounded(1m)"); rec.Code != http.StatusOK || b.stats.boundedReads.Value() != 1 {
+		t.Errorf("Expected b to escalate once its last sync is past the bound, got status %d and %d bounded reads", rec.Code, b.stats.boundedReads.Value())
+	}
+	if rec := bounded(a, "bounded(soon)"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid bound, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// A warm standby shadows one primary node. It takes the primary's node ID
+// but stays out of the ring: every StandbyInterval it refreshes its view of
+// the members from its seeds and copies from the primary the keys of each
+// range the primary replicates that it lacks or holds an older version of.
+// Promoting it announces it to every member under the primary's ID with a
+// newer incarnation, so the members move the primary's vnodes to the
+// standby's address without any range changing owners. The standby then
+// holds all of the primary's data but the writes of the last interval,
+// which anti-entropy fills in. Until it is promoted it refuses client
+// requests, as it would otherwise coordinate them as the primary.
+
+// maxStandbyErrors bounds the failures a StandbyStatus lists.
+const maxStandbyErrors = 10
+
+// standbyProgress tracks a standby and its promotion.
+type standbyProgress struct {
+	mu       sync.Mutex
+	status   api.StandbyStatus
+	promoted bool
+}
+
+func newStandbyProgress(primary string) *standbyProgress {
+	return &standbyProgress{status: api.StandbyStatus{Primary: primary, State: "syncing"}}
+}
+
+// isStandby reports whether the node is a standby not yet promoted.
+func (s *HTTPServer) isStandby() bool {
+	if s.cfg.StandbyFor == "" {
+		return false
+	}
+	s.standby.mu.Lock()
+	defer s.standby.mu.Unlock()
+	return !s.standby.promoted
+}
+
+// checkStandby refuses client requests until a standby is promoted.
+func (s *HTTPServer) checkStandby() error {
+	if s.isStandby() {
+		return &opError{http.StatusServiceUnavailable, "standby for node " + s.cfg.StandbyFor + " until promoted"}
+	}
+	return nil
+}
+
+// runStandby keeps copying the primary's ranges until the standby is
+// promoted, promoting it once the primary has been unreachable for
+// StandbyPromoteAfter.
+func (s *HTTPServer) runStandby(stop <-chan struct{}) {
+	// Stopping abandons the copy
+	ctx, cancel := contextUntil(stop)
+	defer cancel()
+	started := time.Now()
+	for s.isStandby() {
+		s.syncStandby(ctx)
+		if s.cfg.StandbyPromoteAfter > 0 {
+			seen := s.standbyStatus().PrimarySeen
+			if seen.IsZero() {
+				seen = started
+			}
+			if time.Since(seen) >= s.cfg.StandbyPromoteAfter {
+				if err := s.promote(); err != nil {
+					s.logger.Printf("failed to promote standby for %s: %v\n", s.cfg.StandbyFor, err)
+				}
+			}
+		}
+		select {
+		case <-time.After(s.cfg.StandbyInterval):
+		case <-stop:
+			return
+		}
+	}
+}
+
+// syncStandby refreshes the members and copies every range the primary
+// replicates from it.
+func (s *HTTPServer) syncStandby(ctx context.Context) {
+	if err := s.refreshMembers(ctx); err != nil {
+		s.standbyError(err)
+	}
+	primary := ring.NodeID(s.cfg.StandbyFor)
+	address, ok := s.ring.GetNodeAddress(primary)
+	if !ok {
+		s.standbyError(fmt.Errorf("primary %s is not in the ring", primary))
+		return
+	}
+	s.standby.mu.Lock()
+	s.standby.status.PrimaryAddress = address
+	s.standby.mu.Unlock()
+	if !s.ping(address) {
+		s.standbyError(fmt.Errorf("primary %s at %s is unreachable", primary, address))
+		return
+	}
+	s.standby.mu.Lock()
+	s.standby.status.PrimarySeen = time.Now()
+	s.standby.mu.Unlock()
+
+	for _, tr := range s.ring.Ranges() {
+		replicas, err := s.ring.RangeReplicas(tr, s.cfg.ReplicationFactor)
+		if err != nil || !slices.Contains(replicas, primary) {
+			continue
+		}
+		if err := s.shadowRange(ctx, address, tr); err != nil {
+			s.standbyError(fmt.Errorf("range %s: %w", rangeBound(tr.End), err))
+			return
+		}
+	}
+	s.standby.mu.Lock()
+	s.standby.status.LastSync = time.Now()
+	s.standby.mu.Unlock()
+}
+
+// shadowRange copies the keys of tr the primary at address holds in a
+// version this node lacks.
+func (s *HTTPServer) shadowRange(ctx context.Context, address string, tr ring.TokenRange) error {
+	remote, _, err := s.fetchRangeListing(ctx, address, tr)
+	if err != nil {
+		return err
+	}
+	local := s.rangeListing(tr)
+	versions := make(map[string]clock.VectorClock, len(local.Entries))
+	for _, entry := range local.Entries {
+		versions[entry.Key] = entry.Version
+	}
+	for _, entry := range remote.Entries {
+		if mine, held := versions[entry.Key]; held && clock.Compare(mine, clock.VectorClock(entry.Version)) >= 0 {
+			continue
+		}
+		n, err := s.copyKey(ctx, address, entry.Key)
+		if err != nil {
+			return err
+		}
+		s.metrics.Count("standby_keys", 1)
+		s.metrics.Count("standby_bytes", int64(n))
+		s.standby.mu.Lock()
+		s.standby.status.Keys++
+		s.standby.status.Bytes += int64(n)
+		s.standby.mu.Unlock()
+	}
+	return nil
+}
+
+// refreshMembers records the ring members the first seed that answers
+// lists. The primary is recorded as is, since this node shares its ID.
+func (s *HTTPServer) refreshMembers(ctx context.Context) error {
+	var lastErr error
+	for _, seed := range s.cfg.Seeds {
+		members, err := s.fetchMembers(ctx, seed)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, m := range members {
+			if m.NodeID == s.cfg.NodeID {
+				s.ring.JoinNode(ring.NodeID(m.NodeID), m.Address, m.Incarnation)
+				continue
+			}
+			if err := s.joinMember(m); err != nil && !errors.Is(err, ring.ErrStaleIncarnation) {
+				lastErr = err
+			}
+		}
+		return lastErr
+	}
+	return fmt.Errorf("no seed listed the members: %w", lastErr)
+}
+
+// fetchMembers asks the node at address for its ring members.
+func (s *HTTPServer) fetchMembers(ctx context.Context, address string) ([]api.Member, error) {
+	return s.transport.Members(ctx, address)
+}
+
+// handleInternalMembers serves GET /internal/members, the ring members
+// with their incarnations.
+func (s *HTTPServer) handleInternalMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	members := []api.Member{}
+	for nodeID, address := range s.ring.GetNodes() {
+		incarnation, _ := s.ring.Incarnation(nodeID)
+		members = append(members, api.Member{NodeID: string(nodeID), Address: address, Incarnation: incarnation, Meta: s.memberMeta(string(nodeID))})
+	}
+	s.writeJSON(w, members)
+}
+
+// promote takes over the primary's tokens: the standby joins its own ring
+// under the primary's ID and announces itself to every other member. It
+// refuses while the primary still answers.
+func (s *HTTPServer) promote() error {
+	if s.cfg.StandbyFor == "" {
+		return &opError{http.StatusConflict, "node is not a standby"}
+	}
+	primary := ring.NodeID(s.cfg.StandbyFor)
+	if address, ok := s.ring.GetNodeAddress(primary); ok && s.ping(address) {
+		return &opError{http.StatusConflict, fmt.Sprintf("primary %s at %s is still up", primary, address)}
+	}
+	if err := s.takeOver(primary); err != nil {
+		return err
+	}
+	s.readyFlag.Store(true)
+	s.metrics.Count("standby_promotions", 1)
+	s.logger.Printf("standby promoted to take over node %s\n", primary)
+
+	// A member that misses the announcement keeps sending to the old
+	// address until this node restarts and announces itself again
+	for nodeID, address := range s.ring.GetNodes() {
+		if nodeID == primary {
+			continue
+		}
+		if _, err := s.sendJoin(address); err != nil {
+			s.standbyError(fmt.Errorf("announce to %s: %w", nodeID, err))
+		}
+	}
+	return nil
+}
+
+// takeOver moves the primary's vnodes to this node in its own ring.
+func (s *HTTPServer) takeOver(primary ring.NodeID) error {
+	p := s.standby
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.promoted {
+		return &opError{http.StatusConflict, "standby already promoted"}
+	}
+	if known, _ := s.ring.Incarnation(primary); known >= s.incarnation {
+		return &opError{http.StatusConflict, fmt.Sprintf("primary %s has incarnation %d, not older than this standby's %d", primary, known, s.incarnation)}
+	}
+	if _, err := s.ring.JoinNode(primary, s.cfg.BindAddr, s.incarnation); err != nil {
+		return err
+	}
+	p.promoted = true
+	p.status.State = "promoted"
+	p.status.PromotedAt = time.Now()
+	return nil
+}
+
+// standbyError records a failed sync.
+func (s *HTTPServer) standbyError(err error) {
+	s.logger.Printf("standby for %s: %v\n", s.cfg.StandbyFor, err)
+	s.standby.mu.Lock()
+	s.standby.addError(err)
+	s.standby.mu.Unlock()
+}
+
+// addError records err, keeping the latest maxStandbyErrors. The caller
+// holds p.mu.
+func (p *standbyProgress) addError(err error) {
+	p.status.Errors = append(p.status.Errors, err.Error())
+	if len(p.status.Errors) > maxStandbyErrors {
+		p.status.Errors = p.status.Errors[len(p.status.Errors)-maxStandbyErrors:]
+	}
+}
+
+// standbyStatus returns a copy of the standby's state.
+func (s *HTTPServer) standbyStatus() api.StandbyStatus {
+	p := s.standby
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := p.status
+	status.Errors = slices.Clone(p.status.Errors)
+	return status
+}
+
+// handleStandby serves GET /admin/standby, which reports the standby's
+// state, and POST /admin/standby/promote, which promotes it.
+func (s *HTTPServer) handleStandby(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.StandbyFor == "" {
+		s.writeError(w, http.StatusNotFound, "node is not a standby")
+		return
+	}
+	switch {
+	case r.URL.Path == "/admin/standby" && r.Method == http.MethodGet:
+		s.writeJSON(w, s.standbyStatus())
+	case r.URL.Path == "/admin/standby/promote" && r.Method == http.MethodPost:
+		if err := s.promote(); err != nil {
+			s.writeOpError(w, err)
+			return
+		}
+		s.writeJSON(w, s.standbyStatus())
+	case r.URL.Path == "/admin/standby" || r.URL.Path == "/admin/standby/promote":
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+	default:
+		s.writeError(w, http.StatusNotFound, "not found: "+r.URL.Path)
+	}
+}
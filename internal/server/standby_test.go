@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/config"
+)
+
+func TestWarmStandby(t *testing.T) {
+	a, primary := startTestNodeWith(t, "a", nil)
+	b := startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, a.incarnation)
+	for i := range 10 {
+		key := "key-" + strconv.Itoa(i)
+		if _, err := a.put(t.Context(), key, []byte("value-"+key), nil, 2, time.Time{}); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+
+	standby, _ := startTestNodeWith(t, "", func(cfg *config.Config) {
+		cfg.StandbyFor = "a"
+		cfg.Seeds = []string{b.cfg.BindAddr}
+	})
+	if standby.cfg.NodeID != "a" {
+		t.Errorf("Expected the standby to take its primary's ID, got %s", standby.cfg.NodeID)
+	}
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		standby.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+	if rec := serve(http.MethodGet, "/kv/key-1"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected a standby to refuse reads, got %d", rec.Code)
+	}
+
+	standby.syncStandby(t.Context())
+	status := standby.standbyStatus()
+	if status.State != "syncing" || status.Keys != 10 || status.PrimaryAddress != a.cfg.BindAddr || status.PrimarySeen.IsZero() {
+		t.Fatalf("Expected the standby to copy every key of its primary, got %+v", status)
+	}
+	if _, ok := standby.ring.GetNodeAddress("b"); !ok {
+		t.Errorf("Expected the standby to learn the members from its seed")
+	}
+	standby.syncStandby(t.Context())
+	if got := standby.standbyStatus().Keys; got != 10 {
+		t.Errorf("Expected a second sync to copy nothing new, got %d keys", got)
+	}
+	if rec := serve(http.MethodPost, "/admin/standby/promote"); rec.Code != http.StatusConflict {
+		t.Errorf("Expected promotion to be refused while the primary is up, got %d", rec.Code)
+	}
+
+	primary.Close()
+	if rec := serve(http.MethodPost, "/admin/standby/promote"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected promotion once the primary is down, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if address, _ := b.ring.GetNodeAddress("a"); address != standby.cfg.BindAddr {
+		t.Errorf("Expected b to route a's tokens to the standby, got %s", address)
+	}
+	if resp, err := b.get(t.Context(), "key-3", 2); err != nil || string(resp.Value) != "value-key-3" {
+		t.Errorf("Expected a quorum read through the promoted standby, got %+v, %v", resp, err)
+	}
+	if rec := serve(http.MethodGet, "/kv/key-3"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the promoted standby to serve reads, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPost, "/admin/standby/promote"); rec.Code != http.StatusConflict {
+		t.Errorf("Expected a second promotion to be refused, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// defaultSampleSize and maxSampleSize bound the keys /admin/sample returns.
+const (
+	defaultSampleSize = 100
+	maxSampleSize     = 10000
+	// defaultHotKeys is how many keys /admin/hotkeys returns by default.
+	defaultHotKeys = 20
+)
+
+// stats holds lightweight process counters backed by expvar.
+type stats struct {
+	started      time.Time
+	requests     expvar.Int
+	clientErrors expvar.Int
+	serverErrors expvar.Int
+	panics       expvar.Int
+	coalesced    expvar.Int
+	// idempotentReplays counts writes answered from an earlier request
+	// with the same idempotency key.
+	idempotentReplays expvar.Int
+	localReads        expvar.Int
+	boundedReads      expvar.Int
+	digestReads       expvar.Int
+	quorumReads       expvar.Int
+	readRepairs       expvar.Int
+	// quorumFailures counts reads and writes that failed to reach quorum.
+	quorumFailures expvar.Int
+	// quorumDowngrades counts requests whose quorum was lowered to the
+	// replicas there were.
+	quorumDowngrades expvar.Int
+}
+
+func newStats() *stats {
+	return &stats{started: time.Now()}
+}
+
+// vars lists the counters by the names /debug/vars shows them under.
+func (st *stats) vars() *expvar.Map {
+	vars := new(expvar.Map)
+	for name, v := range map[string]*expvar.Int{
+		"requests":           &st.requests,
+		"client_errors":      &st.clientErrors,
+		"server_errors":      &st.serverErrors,
+		"panics":             &st.panics,
+		"coalesced_writes":   &st.coalesced,
+		"idempotent_replays": &st.idempotentReplays,
+		"local_reads":        &st.localReads,
+		"bounded_reads":      &st.boundedReads,
+		"digest_reads":       &st.digestReads,
+		"quorum_reads":       &st.quorumReads,
+		"read_repairs":       &st.readRepairs,
+		"quorum_failures":    &st.quorumFailures,
+		"quorum_downgrades":  &st.quorumDowngrades,
+	} {
+		vars.Set(name, v)
+	}
+	return vars
+}
+
+// publishedStats holds the counters of the nodes running in this process
+// by node ID. They are published once, as the "dht" variable, since
+// expvar.Publish refuses a name twice and a process may run several nodes.
+var (
+	publishedStats sync.Map
+	publishOnce    sync.Once
+)
+
+// publishStats shows the node's counters in /debug/vars until it stops.
+func (s *HTTPServer) publishStats(context.Context) error {
+	publishOnce.Do(func() {
+		expvar.Publish("dht", expvar.Func(func() any {
+			nodes := make(map[string]json.RawMessage)
+			publishedStats.Range(func(id, vars any) bool {
+				nodes[id.(string)] = json.RawMessage(vars.(*expvar.Map).String())
+				return true
+			})
+			return nodes
+		}))
+	})
+	publishedStats.Store(s.cfg.NodeID, s.stats.vars())
+	return nil
+}
+
+// unpublishStats removes the node's counters from /debug/vars.
+func (s *HTTPServer) unpublishStats(context.Context) error {
+	publishedStats.Delete(s.cfg.NodeID)
+	return nil
+}
+
+// Version is the build version reported in /stats; set it with -ldflags "-X".
+var Version = "dev"
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// countRequests wraps next so every request and its outcome is counted.
+func (s *HTTPServer) countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		s.metrics.Observe("request_duration", time.Since(start))
+		s.stats.requests.Add(1)
+		s.metrics.Count("requests", 1)
+		switch {
+		case rec.status >= 500:
+			s.stats.serverErrors.Add(1)
+			s.metrics.Count("server_errors", 1)
+		case rec.status >= 400:
+			s.stats.clientErrors.Add(1)
+			s.metrics.Count("client_errors", 1)
+		}
+	})
+}
+
+func (s *HTTPServer) snapshotStats() api.StatsResponse {
+	uptime := time.Since(s.stats.started).Seconds()
+	requests := s.stats.requests.Value()
+
+	snapshot := api.StatsResponse{
+		NodeID:            s.cfg.NodeID,
+		Version:           Version,
+		Time:              time.Now(),
+		UptimeSeconds:     uptime,
+		ReplicationFactor: s.cfg.ReplicationFactor,
+		ReadQuorum:        s.cfg.ReadQuorum,
+		WriteQuorum:       s.cfg.WriteQuorum,
+		KeyCount:          s.storage.Len(),
+		Evictions:         s.storage.Evictions(),
+		Purges:            s.storage.Purges(),
+		Requests:          requests,
+		Panics:            s.stats.panics.Value(),
+		CoalescedWrites:   s.stats.coalesced.Value(),
+		IdempotentReplays: s.stats.idempotentReplays.Value(),
+		LocalReads:        s.stats.localReads.Value(),
+		BoundedReads:      s.stats.boundedReads.Value(),
+		DigestReads:       s.stats.digestReads.Value(),
+		QuorumReads:       s.stats.quorumReads.Value(),
+		ReadRepairs:       s.stats.readRepairs.Value(),
+		Peers:             make(map[string]string),
+	}
+	if uptime > 0 {
+		snapshot.QPS = float64(requests) / uptime
+	}
+	if requests > 0 {
+		snapshot.ClientErrorRate = float64(s.stats.clientErrors.Value()) / float64(requests)
+		snapshot.ServerErrorRate = float64(s.stats.serverErrors.Value()) / float64(requests)
+	}
+	if s.hints != nil {
+		snapshot.HintedHandoff = true
+		snapshot.HintBacklog = s.hintBacklog()
+		snapshot.HintBytes = s.hints.Bytes()
+	}
+	if dir := s.dataDir(); dir != "" {
+		snapshot.OnDisk = true
+		snapshot.DiskPercent, _ = diskUsage(dir)
+	}
+
+	for nodeID := range s.ring.GetNodes() {
+		// Without gossip every ring member is assumed alive
+		snapshot.Peers[string(nodeID)] = "alive"
+	}
+	return snapshot
+}
+
+// gaugeInterval is how often gauges are pushed to the metrics backend.
+// Prometheus also refreshes them on every scrape.
+const gaugeInterval = 10 * time.Second
+
+// runGaugeReporter reports gauges periodically until stop is closed.
+func (s *HTTPServer) runGaugeReporter(stop <-chan struct{}) {
+	ticker := time.NewTicker(gaugeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.reportGauges()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reportGauges sends point-in-time measurements of storage and the ring.
+func (s *HTTPServer) reportGauges() {
+	st := s.storage.Stats()
+	s.metrics.Gauge("keys", float64(st.Keys))
+	s.metrics.Gauge("bytes", float64(st.Bytes))
+	s.metrics.Gauge("evictions", float64(s.storage.Evictions()))
+	s.metrics.Gauge("purges", float64(s.storage.Purges()))
+	s.metrics.Gauge("ring_nodes", float64(s.ring.Size()))
+	s.metrics.Gauge("ring_epoch", float64(s.ring.Epoch()))
+	if s.hints != nil {
+		s.metrics.Gauge("hint_bytes", float64(s.hints.Bytes()))
+	}
+}
+
+func (s *HTTPServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	s.writeJSON(w, s.snapshotStats())
+}
+
+// handleStorageStats reports key count, bytes and tombstones held by local storage.
+func (s *HTTPServer) handleStorageStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	st := s.storage.Stats()
+	response := api.StorageStatsResponse{
+		Keys:       st.Keys,
+		Bytes:      st.Bytes,
+		Tombstones: st.Tombstones,
+		Namespaces: make(map[string]api.NamespaceStats, len(st.Namespaces)),
+	}
+	for name, ns := range st.Namespaces {
+		response.Namespaces[name] = api.NamespaceStats{Keys: ns.Keys, Bytes: ns.Bytes, Tombstones: ns.Tombstones}
+	}
+	s.writeJSON(w, response)
+}
+
+// handleSample serves GET /admin/sample?n=100, a uniform random sample of
+// the keys in local storage for spot checks of the data. Chunks of chunked
+// values are sampled like any other key, as that is how they are stored.
+func (s *HTTPServer) handleSample(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	n := defaultSampleSize
+	if raw := r.URL.Query().Get("n"); raw != "" {
+		var err error
+		if n, err = strconv.Atoi(raw); err != nil || n <= 0 || n > maxSampleSize {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("n must be between 1 and %d", maxSampleSize))
+			return
+		}
+	}
+	entries, total := s.versions.Sample(n)
+	slices.SortFunc(entries, func(a, b storage.SampleEntry) int { return strings.Compare(a.Key, b.Key) })
+	response := api.SampleResponse{NodeID: s.cfg.NodeID, Total: total, Items: make([]api.SampleItem, len(entries))}
+	var size int
+	for i, e := range entries {
+		response.Items[i] = api.SampleItem{Key: e.Key, Size: e.Size, Version: e.Version}
+		size += e.Size
+	}
+	if len(entries) > 0 {
+		response.MeanSize = float64(size) / float64(len(entries))
+	}
+	s.writeJSON(w, response)
+}
+
+// handleHotKeys serves GET /admin/hotkeys?n=20, the keys this node served
+// the most reads of as a replica, for spotting keys that load one part of
+// the ring.
+func (s *HTTPServer) handleHotKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	n := defaultHotKeys
+	if raw := r.URL.Query().Get("n"); raw != "" {
+		var err error
+		if n, err = strconv.Atoi(raw); err != nil || n <= 0 {
+			s.writeError(w, http.StatusBadRequest, "invalid n: "+raw)
+			return
+		}
+	}
+	top := s.access.Top(n)
+	response := api.HotKeysResponse{NodeID: s.cfg.NodeID, Keys: make([]api.HotKey, len(top))}
+	for i, key := range top {
+		response.Keys[i] = api.HotKey{Key: key.Key, Reads: key.Count, Error: key.Error, LastRead: key.LastRead}
+	}
+	s.writeJSON(w, response)
+}
+
+// redacted stands in for the secrets /admin/config leaves out.
+const redacted = "REDACTED"
+
+// handleConfig serves GET /admin/config, the configuration the node runs
+// with after defaults and validation, without its tokens.
+func (s *HTTPServer) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	cfg := *s.cfg
+	for _, secret := range []*string{&cfg.AuthToken, &cfg.AdminToken, &cfg.ClusterToken, &cfg.TenantTokensCSV} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	// Tenants maps tokens to tenant names
+	cfg.Tenants = nil
+	s.writeJSON(w, cfg)
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestPublishStats(t *testing.T) {
+	a := startTestNode(t, "a")
+	if err := a.publishStats(t.Context()); err != nil {
+		t.Fatalf("Failed to publish stats: %v", err)
+	}
+	a.stats.requests.Add(3)
+
+	var nodes map[string]map[string]int64
+	if err := json.Unmarshal([]byte(expvar.Get("dht").String()), &nodes); err != nil {
+		t.Fatalf("Failed to decode the published stats: %v", err)
+	}
+	if got := nodes["a"]["requests"]; got != 3 {
+		t.Errorf("Expected the published request count to be 3, got %d", got)
+	}
+	a.unpublishStats(t.Context())
+	if strings.Contains(expvar.Get("dht").String(), `"a"`) {
+		t.Errorf("Expected a stopped node's stats to be removed, got %s", expvar.Get("dht").String())
+	}
+}
+
+func TestSample(t *testing.T) {
+	s := newTestServer(t)
+	for i := range 20 {
+		s.storage.Put(fmt.Sprintf("key%02d", i), []byte("0123456789"))
+	}
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/sample?n=5", nil))
+	var resp api.SampleResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || len(resp.Items) != 5 {
+		t.Fatalf("Expected 5 sampled keys, got %+v, %v", resp, err)
+	}
+	if resp.Total != 20 || resp.MeanSize != 10 {
+		t.Errorf("Expected 5 of 20 keys of 10 bytes, got total %d and mean size %v", resp.Total, resp.MeanSize)
+	}
+	if !slices.IsSortedFunc(resp.Items, func(a, b api.SampleItem) int { return strings.Compare(a.Key, b.Key) }) {
+		t.Errorf("Expected the sample sorted by key, got %+v", resp.Items)
+	}
+
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/sample?n=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for n=0, got %d", rec.Code)
+	}
+}
+
+func TestAccessTracking(t *testing.T) {
+	tracked := func(cfg *config.Config) { cfg.AccessTrackedKeys = 10 }
+	a, _ := startTestNodeWith(t, "a", tracked)
+	b, _ := startTestNodeWith(t, "b", tracked)
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	for _, key := range []string{"hot", "cold"} {
+		if _, err := a.put(t.Context(), key, []byte(key), nil, 2, time.Time{}); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		a.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	for range 3 {
+		get("/kv/hot")
+	}
+	get("/kv/cold")
+
+	var meta api.KeyMetadata
+	json.NewDecoder(get("/kv/hot?metadata=true").Body).Decode(&meta)
+	if meta.Reads < 3 || meta.LastRead.IsZero() {
+		t.Errorf("Expected at least 3 reads of hot with the last read time, got %d at %v", meta.Reads, meta.LastRead)
+	}
+	// Metadata requests are not reads
+	var again api.KeyMetadata
+	json.NewDecoder(get("/kv/hot?metadata=true").Body).Decode(&again)
+	if again.Reads != meta.Reads {
+		t.Errorf("Expected a metadata request not to count as a read, got %d then %d", meta.Reads, again.Reads)
+	}
+
+	var hot api.HotKeysResponse
+	json.NewDecoder(get("/admin/hotkeys?n=1").Body).Decode(&hot)
+	if len(hot.Keys) != 1 || hot.Keys[0].Key != "hot" || hot.Keys[0].Reads != 3 {
+		t.Errorf("Expected hot read 3 times as the hottest key, got %+v", hot.Keys)
+	}
+	if rec := get("/admin/hotkeys?n=0"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for n=0, got %d", rec.Code)
+	}
+
+	// Reads served by this node alone count too
+	req := httptest.NewRequest(http.MethodGet, "/kv/cold", nil)
+	req.Header.Set("X-Consistency-R", "1")
+	a.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	if cold, ok := a.access.Lookup("cold"); !ok || cold.Count != 2 {
+		t.Errorf("Expected 2 reads of cold, got %+v", cold)
+	}
+}
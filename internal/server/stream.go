@@ -0,0 +1,298 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// A PUT body larger than cfg.ChunkSize, or of unknown length as with
+// chunked transfer encoding, is streamed into chunks as it arrives rather
+// than read whole: each chunk is written to its replicas before the next
+// is read, and the manifest goes last, once the digest of the value is
+// known. A GET with "Accept: application/octet-stream" returns the raw
+// value instead of JSON and streams a chunked value one chunk at a time.
+// Either way a node holds about one chunk of the value at a time, so
+// values up to cfg.MaxValueBytes need not fit in memory. A conditional
+// write checks its If-Match against the versions the replicas hold before
+// it reads the body, so it streams too. Only a value that fits in one
+// chunk is coalesced, as a coalesced write is held in memory until its
+// window closes; a larger one is written at once. Typed values are read
+// whole, and streamed writes are not mirrored.
+
+// streamIdleTimeout is how long a streamed body may go without a chunk
+// moving. The listener's read and write timeouts bound a whole request,
+// which a large value streamed chunk by chunk can outlast, so a stream
+// pushes its connection's deadlines this far out as each chunk moves.
+const streamIdleTimeout = 10 * time.Second
+
+// deadlineReader extends the deadlines of a request before every read of
+// its body, including the write deadline so that the response to a long
+// upload can still be sent.
+type deadlineReader struct {
+	r  io.Reader
+	rc *http.ResponseController
+}
+
+func (d deadlineReader) Read(p []byte) (int, error) {
+	extendDeadlines(d.rc)
+	return d.r.Read(p)
+}
+
+// extendDeadlines pushes the read and write deadlines of a request
+// streamIdleTimeout out from now.
+func extendDeadlines(rc *http.ResponseController) {
+	deadline := time.Now().Add(streamIdleTimeout)
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+}
+
+// holdDeadlines keeps extending the deadlines of a request that works for
+// longer than the listener's timeouts before it answers, until the
+// returned function is called.
+func holdDeadlines(rc *http.ResponseController) (release func()) {
+	extendDeadlines(rc)
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(streamIdleTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				extendDeadlines(rc)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// streamsPut reports whether the body of r is streamed into chunks.
+func (s *HTTPServer) streamsPut(r *http.Request) bool {
+	return r.ContentLength < 0 || r.ContentLength > int64(s.cfg.ChunkSize)
+}
+
+// bodyError maps a failure to read a request body onto its response.
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return &opError{http.StatusRequestEntityTooLarge, fmt.Sprintf("value exceeds %d bytes", tooLarge.Limit)}
+	}
+	return &opError{http.StatusBadRequest, "failed to read request body"}
+}
+
+// checkBodyChecksum compares a value with the X-Checksum the client sent.
+func checkBodyChecksum(value []byte, checksum *uint32) error {
+	if checksum != nil && crc32.ChecksumIEEE(value) != *checksum {
+		return &opError{http.StatusBadRequest, errChecksumMismatch.Error()}
+	}
+	return nil
+}
+
+// putStream writes the value read from body under key, chunk by chunk. A
+// body that turns out to fit in one chunk is written like any other. When
+// the body fails or does not match checksum, the chunks already written
+// are removed and no manifest is written, so the key keeps its value.
+func (s *HTTPServer) putStream(ctx context.Context, key string, body io.Reader, checksum *uint32, causal clock.VectorClock, writeQuorum int, expiresAt time.Time) (api.PutResponse, error) {
+	first, done, err := readChunk(body, s.cfg.ChunkSize)
+	if err != nil {
+		return api.PutResponse{}, bodyError(err)
+	}
+	var next []byte
+	if !done {
+		if next, done, err = readChunk(body, s.cfg.ChunkSize); err != nil {
+			return api.PutResponse{}, bodyError(err)
+		}
+	}
+	if len(next) == 0 {
+		if err := checkBodyChecksum(first, checksum); err != nil {
+			return api.PutResponse{}, err
+		}
+		return s.put(ctx, key, first, causal, writeQuorum, expiresAt)
+	}
+
+	if err := s.checkStandby(); err != nil {
+		return api.PutResponse{}, err
+	}
+	if err := s.checkBootstrapped(); err != nil {
+		return api.PutResponse{}, err
+	}
+	if err := s.checkNamespace(key); err != nil {
+		return api.PutResponse{}, err
+	}
+	m := chunkManifest{ChunkSize: s.cfg.ChunkSize, Stream: rand.Text()[:16]}
+	digest, crc := sha256.New(), crc32.NewIEEE()
+	fail := func(err error) (api.PutResponse, error) {
+		s.deleteReplicatedChunks(key, m)
+		return api.PutResponse{}, err
+	}
+	// The attributes of the value go with its manifest only
+	chunkCtx := withAttributes(ctx, valueAttributes{})
+	for chunk := first; len(chunk) > 0; {
+		// Each chunk is a fresh buffer, as replicas past the quorum may
+		// still be sent the previous one
+		if _, err := s.putValue(chunkCtx, m.chunkKey(key, m.Chunks), chunk, nil, writeQuorum, expiresAt); err != nil {
+			return fail(err)
+		}
+		digest.Write(chunk)
+		crc.Write(chunk)
+		m.ChunkDigests = append(m.ChunkDigests, chunkDigest(chunk))
+		m.Chunks++
+		m.Size += len(chunk)
+		chunk, next = next, nil
+		if !done {
+			if next, done, err = readChunk(body, s.cfg.ChunkSize); err != nil {
+				return fail(bodyError(err))
+			}
+		}
+	}
+	if checksum != nil && crc.Sum32() != *checksum {
+		return fail(&opError{http.StatusBadRequest, errChecksumMismatch.Error()})
+	}
+	m.Digest = hex.EncodeToString(digest.Sum(nil))
+	s.metrics.Count("streamed_puts", 1)
+	return s.putManifest(ctx, key, m, causal, writeQuorum, expiresAt)
+}
+
+// readChunk reads up to size bytes of body and reports whether body ended.
+func readChunk(body io.Reader, size int) ([]byte, bool, error) {
+	chunk := make([]byte, size)
+	n, err := io.ReadFull(body, chunk)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return chunk[:n], true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return chunk, false, nil
+}
+
+// wantsRawValue reports whether a GET asks for the value itself rather
+// than the JSON response.
+func wantsRawValue(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/octet-stream")
+}
+
+// handleStreamGet serves a GET of key that asks for the raw value. A
+// chunked value is sent one chunk at a time; if a later chunk cannot be
+// read, the response is cut short rather than completed.
+func (s *HTTPServer) handleStreamGet(ctx context.Context, w http.ResponseWriter, key string, readQuorum int, sess session) {
+	if err := s.checkStandby(); err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	if err := s.checkNamespace(key); err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	response, err := s.getValue(ctx, key, readQuorum)
+	if err == nil {
+		response, err = s.readYourWrites(ctx, key, sess, response, s.getValue)
+	}
+	if err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	response.Key = clientKey(ctx, response.Key)
+	if !response.Found {
+		w.WriteHeader(http.StatusNotFound)
+		s.writeJSON(w, response)
+		return
+	}
+	setCausalContext(w, response)
+	setTTL(w, &response)
+	setAttributeHeaders(w, response)
+
+	m, first, streamed, err := s.streamManifest(ctx, key, response.Value, readQuorum)
+	if err != nil {
+		s.writeOpError(w, err)
+		return
+	}
+	if !streamed {
+		value := typedDocument(response).Value
+		if isManifest(value) {
+			if value, err = s.getChunked(ctx, key, value, readQuorum); err != nil {
+				s.writeOpError(w, err)
+				return
+			}
+		}
+		sum := sha256.Sum256(value)
+		w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		w.Header().Set(checksumHeader, strconv.FormatUint(uint64(crc32.ChecksumIEEE(value)), 10))
+		w.WriteHeader(http.StatusOK)
+		w.Write(value)
+		return
+	}
+
+	// The first chunk was read to pick the manifest; the rest follow
+	w.Header().Set("Content-Length", strconv.Itoa(m.Size))
+	w.Header().Set("ETag", `"`+m.Digest+`"`)
+	w.WriteHeader(http.StatusOK)
+	s.metrics.Count("streamed_gets", 1)
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(streamIdleTimeout))
+	if _, err := w.Write(first); err != nil {
+		return
+	}
+	for i := 1; i < m.Chunks; i++ {
+		chunk, err := s.chunkRange(ctx, key, m, i*m.ChunkSize, min((i+1)*m.ChunkSize, m.Size), readQuorum)
+		if err != nil {
+			s.logger.Printf("failed to stream chunk %d of key: %s, error: %v\n", i, key, err)
+			panic(http.ErrAbortHandler)
+		}
+		_ = rc.SetWriteDeadline(time.Now().Add(streamIdleTimeout))
+		if _, err := w.Write(chunk); err != nil {
+			return
+		}
+	}
+}
+
+// streamManifest returns the manifest of the chunked value a raw GET of
+// stored streams, with its first chunk. It reports false for a value that
+// is not chunked, or whose manifest predates per-chunk digests and so can
+// only be checked whole. The first chunk is read up front so that a
+// partially replicated write falls back to the value it replaced, as a
+// full read does.
+func (s *HTTPServer) streamManifest(ctx context.Context, key string, stored []byte, readQuorum int) (chunkManifest, []byte, bool, error) {
+	if !isManifest(stored) {
+		return chunkManifest{}, nil, false, nil
+	}
+	m, err := decodeManifest(stored)
+	if err != nil {
+		return chunkManifest{}, nil, false, &opError{http.StatusInternalServerError, "corrupt chunk manifest for key: " + key}
+	}
+	if len(m.ChunkDigests) == 0 || m.Chunks == 0 {
+		return chunkManifest{}, nil, false, nil
+	}
+	first, err := s.chunkRange(ctx, key, m, 0, min(m.ChunkSize, m.Size), readQuorum)
+	var torn *tornValueError
+	if !errors.As(err, &torn) {
+		return m, first, err == nil, err
+	}
+	s.metrics.Count("torn_reads", 1)
+	if p := m.Previous; p != nil && len(p.ChunkDigests) > 0 && p.Chunks > 0 {
+		if first, prevErr := s.chunkRange(ctx, key, *p, 0, min(p.ChunkSize, p.Size), readQuorum); prevErr == nil {
+			s.logger.Printf("%v, returning the previous value\n", torn)
+			return *p, first, true, nil
+		}
+	}
+	return chunkManifest{}, nil, false, &opError{http.StatusServiceUnavailable, torn.Error()}
+}
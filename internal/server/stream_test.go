@@ -0,0 +1,168 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestStreamedValues(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.WriteQuorum = 1
+	s.cfg.ReadQuorum = 1
+	s.cfg.ChunkSize = 4
+	s.cfg.MaxValueBytes = 16
+	// put sends body with chunked transfer encoding, of unknown length
+	put := func(body, checksum string) int {
+		req := httptest.NewRequest(http.MethodPut, "/kv/big", io.MultiReader(strings.NewReader(body)))
+		req.ContentLength = -1
+		if checksum != "" {
+			req.Header.Set(checksumHeader, checksum)
+		}
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	chunks := func() int {
+		keys, _ := s.storage.Scan("big~chunk.", "", 0)
+		return len(keys)
+	}
+
+	value := "0123456789"
+	if code := put(value, strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(value))), 10)); code != http.StatusOK {
+		t.Fatalf("Expected 200 for a streamed put, got %d", code)
+	}
+	manifest, _ := s.storage.Get("big")
+	m, err := decodeManifest(manifest)
+	sum := sha256.Sum256([]byte(value))
+	if err != nil || m.Stream == "" || m.Chunks != 3 || m.Size != 10 || m.Digest != hex.EncodeToString(sum[:]) {
+		t.Fatalf("Expected a streamed manifest of 3 chunks, got %+v, %v", m, err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/kv/big", nil)
+	req.Header.Set("Accept", "application/octet-stream")
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != value {
+		t.Fatalf("Expected the raw value streamed back, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Length") != "10" || rec.Header().Get("ETag") != `"`+m.Digest+`"` || rec.Header().Get(causalContextHeader) == "" {
+		t.Errorf("Expected the length, digest and context of the value, got %v", rec.Header())
+	}
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kv/big", nil))
+	if !strings.Contains(rec.Body.String(), `"value":"MDEyMzQ1Njc4OQ=="`) {
+		t.Errorf("Expected a JSON read to reassemble the streamed value, got %s", rec.Body.String())
+	}
+
+	// A failed stream leaves the value and removes the chunks it wrote
+	if code := put("abcdefghij", "1"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a checksum mismatch, got %d", code)
+	}
+	if code := put(strings.Repeat("x", 17), ""); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 above the value limit, got %d", code)
+	}
+	if stored, _ := s.storage.Get("big"); string(stored) != string(manifest) || chunks() != 3 {
+		t.Errorf("Expected only the first value's 3 chunks, got %d", chunks())
+	}
+
+	if code := put("tiny", ""); code != http.StatusOK {
+		t.Fatalf("Expected 200 for a short streamed put, got %d", code)
+	}
+	if stored, _ := s.storage.Get("big"); string(stored) != "tiny" || chunks() != 0 {
+		t.Errorf("Expected a value of one chunk to be stored whole, got %q and %d chunks", stored, chunks())
+	}
+
+	// A conditional write is checked before its body is read, so it
+	// streams, and a stale one reads none of it
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kv/big", nil))
+	context := rec.Header().Get(causalContextHeader)
+	putIfMatch := func(body *countingReader) int {
+		req := httptest.NewRequest(http.MethodPut, "/kv/big", body)
+		req.ContentLength = -1
+		req.Header.Set(ifMatchHeader, context)
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := putIfMatch(&countingReader{r: strings.NewReader(value)}); code != http.StatusOK || chunks() != 3 {
+		t.Fatalf("Expected a conditional put to stream, got %d and %d chunks", code, chunks())
+	}
+	body := &countingReader{r: strings.NewReader(value)}
+	if code := putIfMatch(body); code != http.StatusPreconditionFailed || body.n != 0 {
+		t.Errorf("Expected a stale conditional put refused unread, got %d after %d bytes", code, body.n)
+	}
+
+	// A value larger than a chunk is never coalesced
+	s.namespaces.set(api.Namespace{Name: "telemetry", CoalesceWindowMillis: 60000})
+	req = httptest.NewRequest(http.MethodPut, "/kv/telemetry/big", strings.NewReader(value))
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, req)
+	if stored, _ := s.storage.Get("telemetry/big"); rec.Code != http.StatusOK || !isManifest(stored) || s.stats.coalesced.Value() != 0 {
+		t.Errorf("Expected a large value streamed at once in a coalescing namespace, got %d %q", rec.Code, stored)
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestStreamedValuesOutlastTimeouts(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.WriteQuorum = 1
+	s.cfg.ReadQuorum = 1
+	s.cfg.ChunkSize = 4
+	ts := httptest.NewUnstartedServer(s.server.Handler)
+	ts.Config.ReadTimeout = 100 * time.Millisecond
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	// The body trickles in over several times the listener's timeouts
+	pr, pw := io.Pipe()
+	go func() {
+		for _, part := range []string{"0123", "4567", "89ab", "cdef"} {
+			time.Sleep(75 * time.Millisecond)
+			pw.Write([]byte(part))
+		}
+		pw.Close()
+	}()
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/kv/slow", pr)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected the slow streamed put to complete, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for a slow streamed put, got %d", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, ts.URL+"/kv/slow", nil)
+	req.Header.Set("Accept", "application/octet-stream")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "0123456789abcdef" {
+		t.Errorf("Expected the slow value streamed back, got %q", body)
+	}
+}
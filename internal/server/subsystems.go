@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/amirderis/DHT/internal/lifecycle"
+)
+
+// listenerStopTimeout bounds how long the listeners wait for requests in
+// flight when the node stops.
+const listenerStopTimeout = 10 * time.Second
+
+// subsystems lists the parts of the node the lifecycle manager starts and
+// stops. The listeners come up once the stores behind them are open, and
+// the node joins the ring, replays hints and repairs only once peers can
+// reach it; stopping the node undoes this in reverse.
+func (s *HTTPServer) subsystems() []lifecycle.Subsystem {
+	return []lifecycle.Subsystem{
+		{Name: "metrics", Stop: s.stopMetrics},
+		{Name: "expvar", Start: s.publishStats, Stop: s.unpublishStats},
+		lifecycle.Loop("gauges", s.runGaugeReporter, "metrics"),
+		lifecycle.Loop("storage", s.runReaper, "metrics"),
+		lifecycle.Loop("stats-history", s.runStatsHistory, "storage"),
+		{Name: "hints", DependsOn: []string{"metrics"}, Stop: s.stopHints},
+		{Name: "peer-connections", Stop: s.stopPeers},
+		{
+			Name:      "listeners",
+			DependsOn: []string{"storage", "hints", "peer-connections"},
+			Start:     s.startListeners,
+			Stop:      s.stopListeners,
+			Timeout:   listenerStopTimeout,
+		},
+		lifecycle.Loop("membership", s.join, "listeners"),
+		lifecycle.Loop("hint-replay", func(stop <-chan struct{}) {
+			s.runHandoff(s.cluster.Subscribe(), stop)
+		}, "hints", "membership"),
+		lifecycle.Loop("anti-entropy", s.runAntiEntropy, "storage", "membership"),
+		lifecycle.Loop("audit", s.runAudit, "storage", "membership"),
+		lifecycle.Loop("capacity-watch", s.runCapacityWatch, "membership"),
+		lifecycle.Loop("alerts", s.runAlerts, "hints", "metrics"),
+	}
+}
+
+// startListeners binds the public, admin and gRPC listeners and serves
+// them in the background.
+func (s *HTTPServer) startListeners(context.Context) error {
+	servers := []*http.Server{s.server}
+	if s.admin != nil {
+		servers = append(servers, s.admin)
+	}
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, lis := range listeners {
+			lis.Close()
+		}
+	}
+	for _, srv := range servers {
+		lis, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		listeners = append(listeners, lis)
+	}
+	if s.grpc != nil {
+		lis, err := net.Listen("tcp", s.cfg.GRPCAddr)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		go func() {
+			if err := s.grpc.Serve(lis); err != nil {
+				s.logger.Printf("grpc server error: %v\n", err)
+			}
+		}()
+	}
+	for i, srv := range servers {
+		go func() {
+			if err := srv.Serve(listeners[i]); err != nil && err != http.ErrServerClosed {
+				s.logger.Printf("server error on %s: %v\n", srv.Addr, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// stopListeners ends the requests waiting on the node and shuts the
+// listeners down, letting requests in flight finish within ctx.
+func (s *HTTPServer) stopListeners(ctx context.Context) error {
+	close(s.stopCh)
+	if s.grpc != nil {
+		stopped := make(chan struct{})
+		go func() {
+			s.grpc.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.grpc.Stop()
+		}
+	}
+	if s.admin != nil {
+		if err := s.admin.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	return s.server.Shutdown(ctx)
+}
+
+// stopHints closes the hint store.
+func (s *HTTPServer) stopHints(context.Context) error {
+	if s.hints == nil {
+		return nil
+	}
+	return s.hints.Close()
+}
+
+// stopMetrics reports the gauges a last time and closes a metrics backend
+// that holds a connection.
+func (s *HTTPServer) stopMetrics(context.Context) error {
+	s.reportGauges()
+	if closer, ok := s.metrics.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
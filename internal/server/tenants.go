@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// A tenant token confines its bearer to the namespace named after the
+// tenant: /kv/ and /scan prefix every key and prefix the tenant names with
+// "{tenant}/" and strip it from the keys they return, so no key name
+// reaches another tenant's data. The tenant's namespace always exists.
+// Only the auth token may address keys across tenants, manage namespaces
+// and use the internal and admin endpoints.
+
+type tenantContextKey struct{}
+
+// tenantFrom returns the tenant a request was authenticated as, or "" for
+// the auth token and unauthenticated listeners.
+func tenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// tenantFor returns the tenant whose token authorization carries.
+func (s *HTTPServer) tenantFor(authorization []byte) (string, bool) {
+	var found string
+	for token, tenant := range s.cfg.Tenants {
+		if subtle.ConstantTimeCompare(authorization, []byte("Bearer "+token)) == 1 {
+			found = tenant
+		}
+	}
+	return found, found != ""
+}
+
+// isTenant reports whether name is the namespace of a tenant.
+func (s *HTTPServer) isTenant(name string) bool {
+	for _, tenant := range s.cfg.Tenants {
+		if tenant == name {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantKey returns the key stored for the key a request names.
+func tenantKey(ctx context.Context, key string) string {
+	if tenant := tenantFrom(ctx); tenant != "" {
+		return tenant + "/" + key
+	}
+	return key
+}
+
+// clientKey returns the key a request knows a stored key by.
+func clientKey(ctx context.Context, key string) string {
+	if tenant := tenantFrom(ctx); tenant != "" {
+		return strings.TrimPrefix(key, tenant+"/")
+	}
+	return key
+}
+
+// adminOnly rejects requests authenticated with a tenant token.
+func (s *HTTPServer) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tenantFrom(r.Context()) != "" {
+			s.writeError(w, http.StatusForbidden, "tenant tokens cannot use "+r.URL.Path)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
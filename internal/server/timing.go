@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/ring"
+)
+
+// A /kv/ request sent with X-Debug-Timing: true is answered with a
+// Server-Timing header breaking down where the coordinator spent its time:
+// finding the replicas (route), reading or writing its own copy (local),
+// each replica request (replica, described by the node ID), reconciling the
+// replies (merge) and the request as a whole (total). Replica requests the
+// coordinator stopped waiting for once it had its quorum are not listed.
+// Comparing total with the time the client measured tells slowness in the
+// cluster apart from slowness on the way to it.
+const debugTimingHeader = "X-Debug-Timing"
+
+type timingsContextKey struct{}
+
+// timings collects the spans of one request.
+type timings struct {
+	mu    sync.Mutex
+	start time.Time
+	spans []string
+}
+
+// timingsFrom returns the timings of the request ctx belongs to, or nil
+// when the request did not ask for them. A nil *timings records nothing.
+func timingsFrom(ctx context.Context) *timings {
+	t, _ := ctx.Value(timingsContextKey{}).(*timings)
+	return t
+}
+
+// since records the time from start to now as the span name.
+func (t *timings) since(name string, start time.Time) {
+	t.record(name, "", time.Since(start))
+}
+
+// replica records the time from start to now as a request to nodeID.
+func (t *timings) replica(nodeID ring.NodeID, start time.Time) {
+	t.record("replica", string(nodeID), time.Since(start))
+}
+
+func (t *timings) record(name, desc string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	span := name
+	if desc != "" {
+		span += ";desc=" + strconv.Quote(desc)
+	}
+	span += fmt.Sprintf(";dur=%.3f", float64(d)/float64(time.Millisecond))
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+}
+
+// header returns the Server-Timing value of the spans so far, ending with
+// the total.
+func (t *timings) header() string {
+	t.record("total", "", time.Since(t.start))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return strings.Join(t.spans, ", ")
+}
+
+// withTimings starts collecting the timings of r if it asks for them,
+// returning the writer that adds the Server-Timing header to the response.
+func withTimings(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request) {
+	if on, _ := strconv.ParseBool(r.Header.Get(debugTimingHeader)); !on {
+		return w, r
+	}
+	t := &timings{start: time.Now()}
+	return &timingWriter{ResponseWriter: w, timings: t}, r.WithContext(context.WithValue(r.Context(), timingsContextKey{}, t))
+}
+
+// timingWriter sets the Server-Timing header just before the response
+// header is sent.
+type timingWriter struct {
+	http.ResponseWriter
+	timings *timings
+	sent    bool
+}
+
+func (w *timingWriter) WriteHeader(status int) {
+	if !w.sent {
+		w.sent = true
+		w.Header().Set("Server-Timing", w.timings.header())
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timingWriter) Write(p []byte) (int, error) {
+	if !w.sent {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *timingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/storage"
+)
+
+func TestDebugTiming(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+
+	send := func(method string, debug bool) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, "http://"+a.cfg.BindAddr+"/kv/key", strings.NewReader("value"))
+		if debug {
+			req.Header.Set(debugTimingHeader, "true")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send %s: %v", method, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if got := send(http.MethodPut, true).Header.Get("Server-Timing"); !strings.Contains(got, "route;dur=") || !strings.Contains(got, "local;dur=") || !strings.Contains(got, "total;dur=") {
+		t.Errorf("Expected the write to be timed, got %q", got)
+	}
+	got := send(http.MethodGet, true).Header.Get("Server-Timing")
+	for _, span := range []string{"route;dur=", "local;dur=", `replica;desc="b";dur=`, "total;dur="} {
+		if !strings.Contains(got, span) {
+			t.Errorf("Expected Server-Timing to include %s, got %q", span, got)
+		}
+	}
+	// Replicas that disagree are read in full and reconciled
+	b.versions.PutVersioned("key", storage.NewVersionedValue([]byte("newer"), clock.VectorClock{"a": 9, "b": 9}))
+	if got := send(http.MethodGet, true).Header.Get("Server-Timing"); !strings.Contains(got, "merge;dur=") {
+		t.Errorf("Expected a reconciled read to time the merge, got %q", got)
+	}
+	if got := send(http.MethodGet, false).Header.Get("Server-Timing"); got != "" {
+		t.Errorf("Expected no Server-Timing without %s, got %q", debugTimingHeader, got)
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// defaultTombstoneLimit and maxTombstoneLimit bound the tombstones
+// /admin/tombstones lists.
+const (
+	defaultTombstoneLimit = 100
+	maxTombstoneLimit     = 10000
+)
+
+// tombstonePrefix returns the key prefix of the bucket named by the request,
+// or "" for every key.
+func tombstonePrefix(r *http.Request) (string, error) {
+	bucket := r.URL.Query().Get("bucket")
+	if strings.Contains(bucket, "/") {
+		return "", fmt.Errorf("invalid bucket: %s", bucket)
+	}
+	if bucket == "" {
+		return "", nil
+	}
+	return bucket + "/", nil
+}
+
+// handleTombstones serves GET /admin/tombstones?bucket=&limit=, the
+// tombstones in local storage oldest deletion first, so operators can see
+// what delete-heavy workloads leave behind.
+func (s *HTTPServer) handleTombstones(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	prefix, err := tombstonePrefix(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := defaultTombstoneLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 || limit > maxTombstoneLimit {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxTombstoneLimit))
+			return
+		}
+	}
+	entries, total := s.versions.Tombstones(prefix, limit)
+	response := api.TombstoneList{NodeID: s.cfg.NodeID, Total: total, Tombstones: make([]api.Tombstone, len(entries))}
+	for i, e := range entries {
+		response.Tombstones[i] = api.Tombstone{Key: e.Key, Version: e.Version, DeletedAt: e.DeletedAt}
+	}
+	s.writeJSON(w, response)
+}
+
+// handleTombstonePurge serves POST /admin/tombstones/purge?bucket=, which
+// drops the local tombstones older than cfg.TombstoneGrace. The grace
+// period gives every replica time to learn of a delete; with force=true
+// younger tombstones go too, and a replica that missed their delete can
+// bring the value back through repair.
+func (s *HTTPServer) handleTombstonePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	prefix, err := tombstonePrefix(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	force := false
+	if raw := r.URL.Query().Get("force"); raw != "" {
+		if force, err = strconv.ParseBool(raw); err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid force: "+raw)
+			return
+		}
+	}
+	grace := s.cfg.TombstoneGrace
+	if force {
+		grace = 0
+	}
+	response := api.TombstonePurge{NodeID: s.cfg.NodeID, Purged: s.versions.PurgeTombstones(prefix, grace)}
+	if !force {
+		response.Grace = grace.String()
+	}
+	s.metrics.Count("tombstones_purged", int64(response.Purged))
+	s.logger.Printf("Purged %d tombstones with prefix %q (force=%t)\n", response.Purged, prefix, force)
+	s.writeJSON(w, response)
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestTombstones(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.TombstoneGrace = time.Hour
+	for _, key := range []string{"logs/1", "logs/2", "logs/3", "users/1"} {
+		s.versions.PutVersioned(key, storage.NewVersionedValue([]byte("value"), clock.VectorClock{"a": 1}))
+	}
+	for _, key := range []string{"logs/1", "logs/2", "users/1"} {
+		s.versions.DeleteVersioned(key)
+	}
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	var list api.TombstoneList
+	json.NewDecoder(do(http.MethodGet, "/admin/tombstones?bucket=logs&limit=1").Body).Decode(&list)
+	if list.Total != 2 || len(list.Tombstones) != 1 || list.Tombstones[0].Key != "logs/1" || list.Tombstones[0].Version["a"] != 1 {
+		t.Errorf("Expected the oldest of 2 tombstones in the bucket, got %+v", list)
+	}
+	if rec := do(http.MethodGet, "/admin/tombstones?limit=0"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for limit=0, got %d", rec.Code)
+	}
+
+	var purge api.TombstonePurge
+	json.NewDecoder(do(http.MethodPost, "/admin/tombstones/purge?bucket=logs").Body).Decode(&purge)
+	if purge.Purged != 0 || purge.Grace != "1h0m0s" {
+		t.Errorf("Expected tombstones within the grace period to be kept, got %+v", purge)
+	}
+	purge = api.TombstonePurge{}
+	json.NewDecoder(do(http.MethodPost, "/admin/tombstones/purge?bucket=logs&force=true").Body).Decode(&purge)
+	if purge.Purged != 2 || purge.Grace != "" {
+		t.Errorf("Expected a forced purge to drop the bucket's tombstones, got %+v", purge)
+	}
+	json.NewDecoder(do(http.MethodGet, "/admin/tombstones").Body).Decode(&list)
+	if list.Total != 1 || list.Tombstones[0].Key != "users/1" {
+		t.Errorf("Expected other buckets' tombstones to be kept, got %+v", list)
+	}
+	if _, ok := s.versions.GetVersioned("logs/3"); !ok {
+		t.Error("Expected live keys to survive the purge")
+	}
+	if rec := do(http.MethodGet, "/admin/tombstones/purge"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET on purge, got %d", rec.Code)
+	}
+}
+
+func TestTombstoneReads(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+
+	if _, err := a.put(t.Context(), "key", []byte("value"), nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	// A delete with W=1 stays on a, leaving b with the value it removed
+	if err := a.delete(t.Context(), "key", 1); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, ok := b.storage.Get("key"); !ok {
+		t.Fatalf("Expected b to still hold the deleted value")
+	}
+
+	reads, _, _ := a.readFromNodes(t.Context(), "key", []ring.NodeID{"a", "b"}, 2)
+	if len(reads) != 1 || !reads[0].Tombstone {
+		t.Errorf("Expected the read to end at the local tombstone, got %+v", reads)
+	}
+	if resp, err := a.get(t.Context(), "key", 2); err != nil || resp.Found {
+		t.Fatalf("Expected the tombstone to beat the stale value, got %+v, %v", resp, err)
+	}
+	if resp, err := b.get(t.Context(), "key", 2); err != nil || resp.Found {
+		t.Fatalf("Expected the tombstone to beat b's own stale value, got %+v, %v", resp, err)
+	}
+	waitFor(t, func() bool {
+		_, ok := b.storage.Get("key")
+		return !ok
+	})
+
+	older := replicaRead{"b", api.ReplicateGetResponse{Found: true, Value: []byte("value"), Version: map[string]uint64{"a": 1}}}
+	tombstone := replicaRead{"a", api.ReplicateGetResponse{Tombstone: true, Version: map[string]uint64{"a": 2}}}
+	if newest := newestRead([]replicaRead{older, tombstone}); !newest.Tombstone || newest.Found {
+		t.Errorf("Expected the tombstone to win the merge, got %+v", newest)
+	}
+	newer := replicaRead{"b", api.ReplicateGetResponse{Found: true, Value: []byte("again"), Version: map[string]uint64{"a": 3}}}
+	if newest := newestRead([]replicaRead{tombstone, newer}); !newest.Found || string(newest.Value) != "again" {
+		t.Errorf("Expected a write after the delete to win, got %+v", newest)
+	}
+}
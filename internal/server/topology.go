@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// ringEpochHeader carries the ring epoch on every response, and on requests
+// carries the epoch of the topology the client used to route them.
+const ringEpochHeader = "X-Ring-Epoch"
+
+// stampEpoch adds the current ring epoch to every response.
+func (s *HTTPServer) stampEpoch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ringEpochHeader, strconv.FormatUint(s.ring.Epoch(), 10))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// misdirected reports whether a client routed a request for key using an
+// outdated ring to a node that is no longer one of the key's replicas.
+// Requests without an epoch header are never misdirected.
+func (s *HTTPServer) misdirected(r *http.Request, key string) bool {
+	raw := r.Header.Get(ringEpochHeader)
+	if raw == "" {
+		return false
+	}
+	epoch, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil || epoch == s.ring.Epoch() {
+		return false
+	}
+	preferenceList, err := s.ring.GetPreferenceList(key, s.cfg.ReplicationFactor)
+	if err != nil {
+		return false
+	}
+	for _, nodeID := range preferenceList {
+		if nodeID == ring.NodeID(s.cfg.NodeID) {
+			return false
+		}
+	}
+	return true
+}
+
+// handleRing serves the topology clients need to route keys themselves.
+func (s *HTTPServer) handleRing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed: "+r.Method)
+		return
+	}
+	s.writeJSON(w, s.ringResponse())
+}
+
+// ringResponse describes the ring as the node currently sees it.
+func (s *HTTPServer) ringResponse() api.RingResponse {
+	// Read the epoch first so a concurrent change makes the reply look stale rather than fresh
+	response := api.RingResponse{
+		Epoch:             s.ring.Epoch(),
+		VNodes:            s.ring.VNodeCount(),
+		ReplicationFactor: s.cfg.ReplicationFactor,
+		Nodes:             make(map[string]string),
+	}
+	for nodeID, address := range s.ring.GetNodes() {
+		response.Nodes[string(nodeID)] = address
+	}
+	return response
+}
+
+// epochUnary sends the ring epoch as response metadata on unary RPCs.
+func (s *HTTPServer) epochUnary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	grpc.SetHeader(ctx, metadata.Pairs(ringEpochHeader, strconv.FormatUint(s.ring.Epoch(), 10)))
+	return handler(ctx, req)
+}
+
+// epochStream sends the ring epoch as response metadata on streaming RPCs.
+func (s *HTTPServer) epochStream(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ss.SetHeader(metadata.Pairs(ringEpochHeader, strconv.FormatUint(s.ring.Epoch(), 10)))
+	return handler(srv, ss)
+}
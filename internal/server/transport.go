@@ -0,0 +1,347 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// Transport carries the requests a node makes of its peers, each sent to
+// the peer's advertised address. The coordinator, hinted handoff,
+// anti-entropy, joins and the admin fan-outs all go through it, so none of
+// them builds URLs or holds a client. A replica write that cannot reach
+// its peer fails with errUnreachable, one the peer turns away for load
+// with errReplicaBusy, and one the peer holds a newer version of with
+// storage.ErrStaleVersion; a seed that throttles a join answers with a
+// *joinThrottledError.
+type Transport interface {
+	// Replicate writes one replica, or a hint when req.HintFor is set.
+	Replicate(ctx context.Context, address string, req api.ReplicateRequest) error
+	// ReplicateBatch writes several replicas, all or none.
+	ReplicateBatch(ctx context.Context, address string, req api.ReplicateBatchRequest) error
+	// Get reads the peer's copy of key.
+	Get(ctx context.Context, address, key string) (api.ReplicateGetResponse, error)
+	// GetBatch reads the peer's copies of keys, in order.
+	GetBatch(ctx context.Context, address string, keys []string) ([]api.ReplicateGetResponse, error)
+	// Metadata describes the peer's copy of key without its value.
+	Metadata(ctx context.Context, address, key string) (api.ReplicaMetadata, error)
+	// Delete removes the peer's copy of key outright.
+	Delete(ctx context.Context, address, key string) error
+	// Join announces self to the peer and returns the peer's identity.
+	Join(ctx context.Context, address string, self api.Member) (api.Member, error)
+	// Leave asks the peer to remove self from its ring.
+	Leave(ctx context.Context, address string, self api.Member) error
+	// Members lists the ring members the peer knows.
+	Members(ctx context.Context, address string) ([]api.Member, error)
+	// Ping checks that the peer answers.
+	Ping(ctx context.Context, address string) error
+	// ListRange lists the keys the peer holds in tr, with the size of the
+	// listing on the wire.
+	ListRange(ctx context.Context, address string, tr ring.TokenRange) (api.RangeListing, int, error)
+	// Scan lists the peer's copies of the keys in a key range.
+	Scan(ctx context.Context, address string, req api.KeyRangeRequest) (api.KeyRangeListing, error)
+	// Capacity reports how full the peer is.
+	Capacity(ctx context.Context, address string) (api.NodeCapacity, error)
+	// Namespaces lists the peer's namespace registry.
+	Namespaces(ctx context.Context, address string) ([]api.Namespace, error)
+	// PutNamespace creates or updates ns on the peer.
+	PutNamespace(ctx context.Context, address string, ns api.Namespace) error
+	// DeleteNamespace removes ns from the peer.
+	DeleteNamespace(ctx context.Context, address string, ns api.Namespace) error
+	// Forget drops any connection to an address a peer has moved away from.
+	Forget(address string)
+	// Close releases the transport's connections.
+	Close() error
+}
+
+// newTransport builds the transport cfg.PeerTransport names.
+func newTransport(cfg *config.Config, client *http.Client, codecs *peerCodecs) Transport {
+	httpT := &httpTransport{client: client, codecs: codecs, token: cfg.ClusterToken}
+	if cfg.PeerTransport == config.PeerTransportGRPC {
+		return newGRPCTransport(httpT, int(cfg.MaxValueBytes)+grpcMessageOverhead, cfg.PeerTimeout)
+	}
+	return httpT
+}
+
+// httpTransport sends requests to the internal HTTP API as JSON.
+type httpTransport struct {
+	client *http.Client
+	codecs *peerCodecs // nil sends every body as it is
+	token  string      // the cluster token, sent with every request if set
+}
+
+// do sends a request with an optional JSON body and returns the response
+// if it has one of the statuses in ok.
+func (t *httpTransport) do(ctx context.Context, method, address, path string, body any, ok ...int) (*http.Response, error) {
+	req, err := t.newRequest(ctx, method, address, path, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.send(req, address)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("remote node %s returned status %d", address, resp.StatusCode)
+}
+
+// newRequest builds a request with an optional JSON body, compressed with
+// the codec negotiated with the peer at address.
+func (t *httpTransport) newRequest(ctx context.Context, method, address, path string, body any) (*http.Request, error) {
+	var buf bytes.Buffer
+	var reader io.Reader
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, err
+		}
+		reader = &buf
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("http://%s%s", address, path), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	if t.codecs != nil {
+		// Negotiated codecs stand in for the gzip the client would ask for
+		req.Header.Set("Accept-Encoding", "identity")
+		if err := t.codecs.encodeBody(req, address, buf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// send sends req to the peer at address and decompresses the response.
+func (t *httpTransport) send(req *http.Request, address string) (*http.Response, error) {
+	resp, err := t.client.Do(req)
+	if err != nil || t.codecs == nil {
+		return resp, err
+	}
+	if err := t.codecs.decodeResponse(address, resp); err != nil {
+		return nil, fmt.Errorf("remote node %s: %w", address, err)
+	}
+	return resp, nil
+}
+
+// getJSON decodes the response to a GET of path into v.
+func (t *httpTransport) getJSON(ctx context.Context, address, path string, v any) error {
+	resp, err := t.do(ctx, http.MethodGet, address, path, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// sendWrite posts a replica write and maps the answer to the errors a
+// Transport returns for writes.
+func (t *httpTransport) sendWrite(ctx context.Context, address, path string, body any, want string) error {
+	req, err := t.newRequest(ctx, http.MethodPost, address, path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := t.send(req, address)
+	if err != nil {
+		// A peer that ran out of the request's time is slow, not down
+		if ctx.Err() != nil {
+			return fmt.Errorf("remote node %s: %w", address, ctx.Err())
+		}
+		return fmt.Errorf("%w: %v", errUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		return fmt.Errorf("remote node %s: %w", address, storage.ErrStaleVersion)
+	case http.StatusServiceUnavailable:
+		return fmt.Errorf("remote node %s: %w", address, errReplicaBusy)
+	default:
+		return fmt.Errorf("remote node %s returned status %d", address, resp.StatusCode)
+	}
+	var result api.ReplicateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	return checkAck(address, want, result)
+}
+
+func (t *httpTransport) Replicate(ctx context.Context, address string, req api.ReplicateRequest) error {
+	return t.sendWrite(ctx, address, "/internal/storage/"+req.Key, req, sentAck(req.HintFor))
+}
+
+func (t *httpTransport) ReplicateBatch(ctx context.Context, address string, req api.ReplicateBatchRequest) error {
+	return t.sendWrite(ctx, address, "/internal/batch", req, api.AckApplied)
+}
+
+// Get treats a 404 that answers for key as the peer's reply that it holds
+// no copy, which counts toward a read quorum like any other; only a 404
+// without one, as from a peer that does not serve the path, is an error.
+func (t *httpTransport) Get(ctx context.Context, address, key string) (api.ReplicateGetResponse, error) {
+	resp, err := t.do(ctx, http.MethodGet, address, "/internal/storage/"+key, nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return api.ReplicateGetResponse{}, err
+	}
+	defer resp.Body.Close()
+	var result api.ReplicateGetResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode == http.StatusNotFound && (err != nil || result.Key != key || result.Found) {
+		return api.ReplicateGetResponse{}, fmt.Errorf("remote node %s returned status %d", address, resp.StatusCode)
+	}
+	return result, err
+}
+
+func (t *httpTransport) GetBatch(ctx context.Context, address string, keys []string) ([]api.ReplicateGetResponse, error) {
+	resp, err := t.do(ctx, http.MethodPost, address, "/internal/batch/get", api.ReplicateBatchGetRequest{Keys: keys}, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result api.ReplicateBatchGetResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+func (t *httpTransport) Metadata(ctx context.Context, address, key string) (api.ReplicaMetadata, error) {
+	var result api.ReplicaMetadata
+	err := t.getJSON(ctx, address, fmt.Sprintf("/internal/storage/%s?%s=true", key, metadataQueryParam), &result)
+	return result, err
+}
+
+func (t *httpTransport) Delete(ctx context.Context, address, key string) error {
+	resp, err := t.do(ctx, http.MethodDelete, address, "/internal/storage/"+key, nil, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (t *httpTransport) Join(ctx context.Context, address string, self api.Member) (api.Member, error) {
+	resp, err := t.do(ctx, http.MethodPost, address, "/internal/join", self, http.StatusOK, http.StatusServiceUnavailable)
+	if err != nil {
+		return api.Member{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			return api.Member{}, &joinThrottledError{time.Duration(seconds) * time.Second}
+		}
+		return api.Member{}, fmt.Errorf("seed %s returned status %d", address, resp.StatusCode)
+	}
+	var peer api.Member
+	if err := json.NewDecoder(resp.Body).Decode(&peer); err != nil {
+		return api.Member{}, err
+	}
+	return peer, nil
+}
+
+func (t *httpTransport) Leave(ctx context.Context, address string, self api.Member) error {
+	resp, err := t.do(ctx, http.MethodPost, address, "/internal/leave", self, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (t *httpTransport) Members(ctx context.Context, address string) ([]api.Member, error) {
+	var members []api.Member
+	err := t.getJSON(ctx, address, "/internal/members", &members)
+	return members, err
+}
+
+func (t *httpTransport) Ping(ctx context.Context, address string) error {
+	resp, err := t.do(ctx, http.MethodGet, address, "/internal/ping", nil, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (t *httpTransport) ListRange(ctx context.Context, address string, tr ring.TokenRange) (api.RangeListing, int, error) {
+	resp, err := t.do(ctx, http.MethodGet, address, fmt.Sprintf("/internal/range?start=%d&end=%d", tr.Start, tr.End), nil, http.StatusOK)
+	if err != nil {
+		return api.RangeListing{}, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return api.RangeListing{}, 0, err
+	}
+	var listing api.RangeListing
+	if err := json.Unmarshal(body, &listing); err != nil {
+		return api.RangeListing{}, 0, err
+	}
+	return listing, len(body), nil
+}
+
+func (t *httpTransport) Scan(ctx context.Context, address string, req api.KeyRangeRequest) (api.KeyRangeListing, error) {
+	query := url.Values{"prefix": {req.Prefix}, "start": {req.Start}, "end": {req.End}, "limit": {strconv.Itoa(req.Limit)}, "keys_only": {strconv.FormatBool(req.KeysOnly)}}
+	var listing api.KeyRangeListing
+	err := t.getJSON(ctx, address, "/internal/scan?"+query.Encode(), &listing)
+	return listing, err
+}
+
+func (t *httpTransport) Capacity(ctx context.Context, address string) (api.NodeCapacity, error) {
+	var result api.NodeCapacity
+	err := t.getJSON(ctx, address, "/internal/capacity", &result)
+	return result, err
+}
+
+func (t *httpTransport) Namespaces(ctx context.Context, address string) ([]api.Namespace, error) {
+	var list api.NamespacesResponse
+	err := t.getJSON(ctx, address, "/internal/namespaces", &list)
+	return list.Namespaces, err
+}
+
+func (t *httpTransport) PutNamespace(ctx context.Context, address string, ns api.Namespace) error {
+	return t.sendNamespace(ctx, http.MethodPut, address, ns)
+}
+
+func (t *httpTransport) DeleteNamespace(ctx context.Context, address string, ns api.Namespace) error {
+	return t.sendNamespace(ctx, http.MethodDelete, address, ns)
+}
+
+func (t *httpTransport) sendNamespace(ctx context.Context, method, address string, ns api.Namespace) error {
+	resp, err := t.do(ctx, method, address, "/internal/namespaces/"+ns.Name, ns, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Forget closes every idle connection, as the transport cannot close them
+// per host, and drops the codecs the peer at address advertised.
+func (t *httpTransport) Forget(address string) {
+	if t.codecs != nil {
+		t.codecs.forget(address)
+	}
+	t.client.CloseIdleConnections()
+}
+
+func (t *httpTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/internal/membership"
+	"github.com/amirderis/DHT/internal/storage"
+)
+
+// memNetwork connects nodes in one process: their requests to each other
+// go straight to the handlers of the node at the address, with no
+// listener. A node taken off the network is unreachable.
+type memNetwork struct {
+	mu    sync.Mutex
+	nodes map[string]http.Handler
+}
+
+func newMemNetwork() *memNetwork {
+	return &memNetwork{nodes: make(map[string]http.Handler)}
+}
+
+// transport returns the Transport a node on the network sends through.
+func (n *memNetwork) transport() Transport {
+	return &httpTransport{client: &http.Client{Transport: n}}
+}
+
+// node builds a node on the network at address id.
+func (n *memNetwork) node(t *testing.T, id string) *HTTPServer {
+	t.Helper()
+	cfg := &config.Config{NodeID: id, BindAddr: id, ReplicationFactor: 2, ReadQuorum: 2, WriteQuorum: 2}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Failed to validate config: %v", err)
+	}
+	s := NewHTTPServer(cfg, WithPeerTransport(n.transport()))
+	s.readyFlag.Store(true)
+	n.mu.Lock()
+	n.nodes[id] = s.server.Handler
+	n.mu.Unlock()
+	return s
+}
+
+func (n *memNetwork) remove(address string) {
+	n.mu.Lock()
+	delete(n.nodes, address)
+	n.mu.Unlock()
+}
+
+func (n *memNetwork) RoundTrip(r *http.Request) (*http.Response, error) {
+	n.mu.Lock()
+	h, ok := n.nodes[r.URL.Host]
+	n.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no node at %s", r.URL.Host)
+	}
+	req := r.Clone(r.Context())
+	req.RequestURI = r.URL.RequestURI()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+func TestMemoryTransport(t *testing.T) {
+	net := newMemNetwork()
+	a, b := net.node(t, "a"), net.node(t, "b")
+
+	peer, err := b.sendJoin("a")
+	if err != nil || peer.NodeID != "a" {
+		t.Fatalf("Expected b to join through a, got %+v, %v", peer, err)
+	}
+	if err := b.joinMember(peer); err != nil {
+		t.Fatalf("Failed to add a: %v", err)
+	}
+	if _, err := a.put(t.Context(), "key", []byte("value"), nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if value, ok := b.storage.Get("key"); !ok || string(value) != "value" {
+		t.Errorf("Expected the write to reach b, got %q", value)
+	}
+	got, err := b.get(t.Context(), "key", 2)
+	if err != nil || string(got.Value) != "value" {
+		t.Errorf("Expected to read the value from both nodes, got %+v, %v", got, err)
+	}
+	if !a.ping("b") {
+		t.Errorf("Expected b to answer a ping")
+	}
+
+	net.remove("b")
+	if a.ping("b") {
+		t.Errorf("Expected b to be gone")
+	}
+	value := storage.NewVersionedValue([]byte("v"), map[string]uint64{"a": 9})
+	if err := a.sendReplica(t.Context(), "b", "key", value, ""); !errors.Is(err, errUnreachable) {
+		t.Errorf("Expected a node off the network to be unreachable, got %v", err)
+	}
+	if _, err := a.put(t.Context(), "key", []byte("again"), nil, 2, time.Time{}); err == nil {
+		t.Errorf("Expected W=2 to fail with b gone")
+	}
+	if a.cluster.State("b") != membership.Dead {
+		t.Errorf("Expected a to mark b dead")
+	}
+}
+
+func TestRemoteNotFound(t *testing.T) {
+	net := newMemNetwork()
+	a, b := net.node(t, "a"), net.node(t, "b")
+	a.ring.JoinNode("b", "b", 1)
+	b.ring.JoinNode("a", "a", 1)
+
+	resp, err := a.readFromRemoteNode(t.Context(), "b", "missing")
+	if err != nil || resp.Found || resp.Key != "missing" {
+		t.Errorf("Expected b to answer that it holds no copy, got %+v, %v", resp, err)
+	}
+	got, err := a.get(t.Context(), "missing", 2)
+	if err != nil || got.Found {
+		t.Errorf("Expected a missing key to meet R=2, got %+v, %v", got, err)
+	}
+
+	// A 404 that is not a replica's answer is still a failed read
+	net.mu.Lock()
+	net.nodes["web"] = http.NotFoundHandler()
+	net.mu.Unlock()
+	if _, err := a.readFromRemoteNode(t.Context(), "web", "missing"); err == nil {
+		t.Errorf("Expected a 404 from a node without the storage endpoint to fail")
+	}
+}
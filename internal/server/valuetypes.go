@@ -0,0 +1,208 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// A PUT with X-Value-Type, or to a namespace with a value_type, writes a
+// value that replicas merge instead of keeping concurrent writes of it as
+// siblings: an OR-Set, sent as a JSON array of strings, or an LWW-Map, sent
+// as a JSON object. The coordinator reads the state stored under the key,
+// adds and removes the elements, or sets and deletes the fields, in which
+// the document differs from it, and writes the new state. Reads merge the
+// states they find and return the document they hold.
+
+// valueTypeHeader names the type of the value a PUT writes.
+const valueTypeHeader = "X-Value-Type"
+
+// valueType returns the type of the value a PUT of key writes, empty for
+// a plain value.
+func (s *HTTPServer) valueType(r *http.Request, key string) (string, error) {
+	requested := r.Header.Get(valueTypeHeader)
+	nsType := s.namespaceValueType(key)
+	switch {
+	case requested == "":
+		return nsType, nil
+	case !validValueType(requested):
+		return "", fmt.Errorf("unknown value type: %s", requested)
+	case nsType != "" && requested != nsType:
+		return "", fmt.Errorf("namespace %s holds %s values", storage.Namespace(key), nsType)
+	}
+	return requested, nil
+}
+
+func validValueType(valueType string) bool {
+	return valueType == api.ValueTypeORSet || valueType == api.ValueTypeLWWMap
+}
+
+// putTyped writes document under key as a value of valueType. Like an
+// increment, the write covers the versions it read and is retried from a
+// fresh read when refused as stale.
+func (s *HTTPServer) putTyped(ctx context.Context, key, valueType string, document []byte, readQuorum, writeQuorum int, expiresAt time.Time) (api.PutResponse, error) {
+	if err := s.checkStandby(); err != nil {
+		return api.PutResponse{}, err
+	}
+	if err := s.checkNamespace(key); err != nil {
+		return api.PutResponse{}, err
+	}
+	var err error
+	for range convergeAttempts {
+		var read api.GetResponse
+		if read, err = s.getValue(ctx, key, readQuorum); err != nil {
+			return api.PutResponse{}, err
+		}
+		var state []byte
+		if state, err = applyDocument(key, valueType, read, document, s.cfg.NodeID, s.hlc.Now()); err != nil {
+			return api.PutResponse{}, err
+		}
+		// A chunked state would not be merged by the replicas
+		if len(state) > s.cfg.ChunkSize {
+			return api.PutResponse{}, &opError{http.StatusRequestEntityTooLarge, fmt.Sprintf("%s value exceeds %d bytes", valueType, s.cfg.ChunkSize)}
+		}
+		var written api.PutResponse
+		if written, err = s.put(ctx, key, state, causalContext(read), writeQuorum, expiresAt); err == nil {
+			s.metrics.Count("typed_writes", 1)
+			return written, nil
+		}
+		var opErr *opError
+		if !errors.As(err, &opErr) || opErr.status != http.StatusConflict {
+			return api.PutResponse{}, err
+		}
+	}
+	return api.PutResponse{}, err
+}
+
+// applyDocument returns the state of valueType that a read of key found,
+// changed to hold document.
+func applyDocument(key, valueType string, read api.GetResponse, document []byte, nodeID string, now clock.Timestamp) ([]byte, error) {
+	values := readValues(read)
+	if valueType == api.ValueTypeORSet {
+		var elements []string
+		if err := json.Unmarshal(document, &elements); err != nil || elements == nil {
+			return nil, &opError{http.StatusBadRequest, "an orset value must be a JSON array of strings"}
+		}
+		set, ok := mergedORSet(values)
+		if !ok {
+			return nil, wrongTypeError(key, valueType)
+		}
+		wanted := make(map[string]bool, len(elements))
+		for _, element := range elements {
+			wanted[element] = true
+		}
+		for _, element := range set.Elements() {
+			if !wanted[element] {
+				set.Remove(element)
+			}
+		}
+		// One tag serves every element this write adds
+		tag := fmt.Sprintf("%s:%d.%d", nodeID, now.WallTime, now.Logical)
+		for element := range wanted {
+			if !set.Contains(element) {
+				set.Add(element, tag)
+			}
+		}
+		return set.Encode(), nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(document, &fields); err != nil || fields == nil {
+		return nil, &opError{http.StatusBadRequest, "an lwwmap value must be a JSON object"}
+	}
+	m, ok := mergedLWWMap(values)
+	if !ok {
+		return nil, wrongTypeError(key, valueType)
+	}
+	live := m.Live()
+	for name, value := range fields {
+		if current, ok := live[name]; !ok || !sameJSON(current, value) {
+			m.Set(name, storage.LWWField{Value: value, Timestamp: now, Node: nodeID})
+		}
+	}
+	for name := range live {
+		if _, ok := fields[name]; !ok {
+			m.Set(name, storage.LWWField{Timestamp: now, Node: nodeID, Deleted: true})
+		}
+	}
+	return m.Encode(), nil
+}
+
+func wrongTypeError(key, valueType string) error {
+	return &opError{http.StatusConflict, "key does not hold an " + valueType + " value: " + key}
+}
+
+func sameJSON(a, b json.RawMessage) bool {
+	var ca, cb bytes.Buffer
+	return json.Compact(&ca, a) == nil && json.Compact(&cb, b) == nil && bytes.Equal(ca.Bytes(), cb.Bytes())
+}
+
+// readValues returns the values a read found: one per sibling, none when
+// the key was not found.
+func readValues(read api.GetResponse) [][]byte {
+	if !read.Found {
+		return nil
+	}
+	if len(read.Siblings) == 0 {
+		return [][]byte{read.Value}
+	}
+	values := make([][]byte, len(read.Siblings))
+	for i, sibling := range read.Siblings {
+		values[i] = sibling.Value
+	}
+	return values
+}
+
+// mergedORSet merges values that all hold an ORSet.
+func mergedORSet(values [][]byte) (storage.ORSet, bool) {
+	var set storage.ORSet
+	for _, value := range values {
+		s, err := storage.DecodeORSet(value)
+		if !storage.IsORSet(value) || err != nil {
+			return storage.ORSet{}, false
+		}
+		set = set.Merge(s)
+	}
+	return set, true
+}
+
+// mergedLWWMap merges values that all hold an LWWMap.
+func mergedLWWMap(values [][]byte) (storage.LWWMap, bool) {
+	var m storage.LWWMap
+	for _, value := range values {
+		v, err := storage.DecodeLWWMap(value)
+		if !storage.IsLWWMap(value) || err != nil {
+			return storage.LWWMap{}, false
+		}
+		m = m.Merge(v)
+	}
+	return m, true
+}
+
+// typedDocument replaces the ORSet or LWWMap states a read found with the
+// single document they merge to. Any other read is returned as is.
+func typedDocument(response api.GetResponse) api.GetResponse {
+	values := readValues(response)
+	if len(values) == 0 {
+		return response
+	}
+	var document []byte
+	if set, ok := mergedORSet(values); ok {
+		document, _ = json.Marshal(set.Elements())
+	} else if m, ok := mergedLWWMap(values); ok {
+		document, _ = json.Marshal(m.Live())
+	} else {
+		return response
+	}
+	response.Value = document
+	response.Siblings = nil
+	return response
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+	"github.com/amirderis/DHT/pkg/api/dhtpb"
+)
+
+func TestTypedValues(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	do := func(s *HTTPServer, method, path, valueType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if valueType != "" {
+			req.Header.Set(valueTypeHeader, valueType)
+		}
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	value := func(s *HTTPServer, path string) string {
+		var resp api.GetResponse
+		json.NewDecoder(do(s, http.MethodGet, path, "", "").Body).Decode(&resp)
+		if len(resp.Siblings) > 0 {
+			t.Errorf("Expected %s to read without siblings, got %+v", path, resp.Siblings)
+		}
+		return string(resp.Value)
+	}
+
+	if rec := do(a, http.MethodPut, "/kv/tags", api.ValueTypeORSet, `["go","dht"]`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a set write, got %d: %s", rec.Code, rec.Body.String())
+	}
+	// Writes through each node from the same read: one adds, one removes
+	read, _ := a.getValue(t.Context(), "tags", 2)
+	added, _ := applyDocument("tags", api.ValueTypeORSet, read, []byte(`["go","dht","crdt"]`), "a", a.hlc.Now())
+	removed, _ := applyDocument("tags", api.ValueTypeORSet, read, []byte(`["go"]`), "b", b.hlc.Now())
+	a.versions.PutVersioned("tags", storage.NewVersionedValue(added, clock.VectorClock{"a": 2}))
+	b.versions.PutVersioned("tags", storage.NewVersionedValue(removed, clock.VectorClock{"a": 1, "b": 1}))
+	if got := value(a, "/kv/tags"); got != `["crdt","go"]` {
+		t.Errorf("Expected both concurrent changes to the set, got %s", got)
+	}
+	if rec := do(b, http.MethodPut, "/kv/tags", api.ValueTypeORSet, `["crdt"]`); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 writing over siblings, got %d", rec.Code)
+	}
+	if got := value(b, "/kv/tags"); got != `["crdt"]` {
+		t.Errorf("Expected the set to be rewritten, got %s", got)
+	}
+
+	// A namespace can make every value a map
+	if rec := do(a, http.MethodPut, "/namespaces/profiles", "", `{"value_type":"lwwmap"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a typed namespace, got %d", rec.Code)
+	}
+	if rec := do(a, http.MethodPut, "/kv/profiles/ann", "", `{"name":"Ann","city":"Oslo"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a map write, got %d: %s", rec.Code, rec.Body.String())
+	}
+	read, _ = a.getValue(t.Context(), "profiles/ann", 2)
+	renamed, _ := applyDocument("profiles/ann", api.ValueTypeLWWMap, read, []byte(`{"name":"Anne","city":"Oslo"}`), "a", a.hlc.Now())
+	moved, _ := applyDocument("profiles/ann", api.ValueTypeLWWMap, read, []byte(`{"name":"Ann","city":"Bergen","age":30}`), "b", b.hlc.Now())
+	a.versions.PutVersioned("profiles/ann", storage.NewVersionedValue(renamed, clock.VectorClock{"a": 2}))
+	b.versions.PutVersioned("profiles/ann", storage.NewVersionedValue(moved, clock.VectorClock{"a": 1, "b": 1}))
+	if got := value(b, "/kv/profiles/ann"); got != `{"age":30,"city":"Bergen","name":"Anne"}` {
+		t.Errorf("Expected each field's own latest write, got %s", got)
+	}
+
+	// gRPC writes to the namespace are merged into the map as well
+	k := &kvService{s: a}
+	if _, err := k.Put(t.Context(), &dhtpb.PutRequest{Key: "profiles/cat", Value: []byte(`{"name":"Cat"}`)}); err != nil {
+		t.Fatalf("Failed to put a map over gRPC: %v", err)
+	}
+	if rec := do(a, http.MethodPut, "/kv/profiles/cat", "", `{"name":"Cat","city":"Rome"}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 writing over a map written over gRPC, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := value(a, "/kv/profiles/cat"); got != `{"city":"Rome","name":"Cat"}` {
+		t.Errorf("Expected the map written over gRPC and HTTP, got %s", got)
+	}
+	if _, err := k.Put(t.Context(), &dhtpb.PutRequest{Key: "profiles/cat", Value: []byte(`["not","a","map"]`)}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a gRPC write that is not a map, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		path, valueType, body string
+		code                  int
+	}{
+		{"/kv/tags", "bag", `[]`, http.StatusBadRequest},
+		{"/kv/tags", api.ValueTypeORSet, `{"go":true}`, http.StatusBadRequest},
+		{"/kv/profiles/bob", api.ValueTypeORSet, `[]`, http.StatusBadRequest},
+		{"/kv/tags", api.ValueTypeLWWMap, `{}`, http.StatusConflict},
+	} {
+		if rec := do(a, http.MethodPut, tc.path, tc.valueType, tc.body); rec.Code != tc.code {
+			t.Errorf("Expected %d writing %s as %q, got %d", tc.code, tc.body, tc.valueType, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// causalContextHeader carries a value's vector clock as a JSON object. GET
+// responses set it and PUT requests send it back to declare which version
+// the write supersedes.
+const causalContextHeader = "X-Context"
+
+// ifMatchHeader makes a PUT conditional on a causal context: the write
+// only goes ahead if the context covers every version stored.
+const ifMatchHeader = "If-Match"
+
+// errTooManySiblings reports a write refused under SiblingOverflowReject
+// because it would leave more versions of its key stored than
+// cfg.MaxSiblings.
+var errTooManySiblings = errors.New("too many siblings")
+
+// parseCausalContext decodes the causal context of a PUT from header; an
+// empty header means the client did not read before writing.
+func parseCausalContext(header, raw string) (clock.VectorClock, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var causal clock.VectorClock
+	if err := json.Unmarshal([]byte(raw), &causal); err != nil {
+		return nil, fmt.Errorf("invalid %s header %q", header, raw)
+	}
+	return causal, nil
+}
+
+// setCausalContext sets the context a client sends back when it overwrites
+// the value it read: every version in the response, merged.
+func setCausalContext(w http.ResponseWriter, response api.GetResponse) {
+	if len(response.Versions) == 0 {
+		return
+	}
+	data, err := json.Marshal(causalContext(response))
+	if err != nil {
+		return
+	}
+	w.Header().Set(causalContextHeader, string(data))
+}
+
+// causalContext merges every version in a response.
+func causalContext(response api.GetResponse) clock.VectorClock {
+	context := clock.New()
+	for _, version := range response.Versions {
+		context = context.Merge(version)
+	}
+	return context
+}
+
+// readResponse is the GetResponse for read, a replica read or the result
+// of newestRead. When read has concurrent values they are all listed as
+// Siblings, and Versions holds their clocks followed by those of concurrent
+// tombstones, so that a write with the merged context supersedes them all.
+func readResponse(key string, read api.ReplicateGetResponse) api.GetResponse {
+	response := api.GetResponse{Key: key, Value: read.Value, Found: read.Found, ExpiresAt: read.ExpiresAt, ContentType: read.ContentType, Meta: read.Meta}
+	if !read.Found {
+		return response
+	}
+	found := foundVersions(read)
+	for _, version := range found {
+		if !clock.VectorClock(version.Version).IsEmpty() {
+			response.Versions = append(response.Versions, version.Version)
+		}
+	}
+	for _, version := range readVersions(read) {
+		if version.Tombstone {
+			response.Versions = append(response.Versions, version.Version)
+		}
+	}
+	if len(found) > 1 {
+		for _, version := range found {
+			response.Siblings = append(response.Siblings, api.Sibling{Value: version.Value, Version: version.Version})
+		}
+	}
+	return response
+}
+
+// conditionError fails a conditional PUT whose context does not cover the
+// versions stored, which it carries for the 412 answer.
+type conditionError struct {
+	current api.GetResponse
+}
+
+func (e *conditionError) Error() string {
+	return "causal context does not match the stored version of key: " + e.current.Key
+}
+
+// putIfMatch writes key only if causal equals or descends from every
+// version a read quorum holds; a key not stored anywhere matches any
+// context. It is optimistic: two writers that both match can still race
+// and leave siblings, but a writer that missed a version is refused with
+// a conditionError listing the current versions.
+func (s *HTTPServer) putIfMatch(ctx context.Context, key string, value []byte, causal clock.VectorClock, writeQuorum int, expiresAt time.Time) (api.PutResponse, error) {
+	if err := s.checkMatch(ctx, key, causal); err != nil {
+		return api.PutResponse{}, err
+	}
+	return s.put(ctx, key, value, causal, writeQuorum, expiresAt)
+}
+
+// checkMatch is the condition of putIfMatch, which needs the versions of
+// key but not its value: a chunked value is only reassembled for the
+// conditionError, so that a conditional write can stream its body.
+func (s *HTTPServer) checkMatch(ctx context.Context, key string, causal clock.VectorClock) error {
+	if err := s.checkStandby(); err != nil {
+		return err
+	}
+	if err := s.checkNamespace(key); err != nil {
+		return err
+	}
+	current, err := s.getValue(ctx, key, s.cfg.ReadQuorum)
+	if err != nil {
+		return err
+	}
+	for _, version := range current.Versions {
+		if !clock.Equal(causal, version) && clock.Compare(causal, version) <= 0 {
+			if current, err = s.assembleValue(ctx, key, current, s.cfg.ReadQuorum); err != nil {
+				return err
+			}
+			return &conditionError{current}
+		}
+	}
+	return nil
+}
+
+// writeConditionError answers 412 with the current value and its siblings,
+// and their merged context to retry with.
+func (s *HTTPServer) writeConditionError(ctx context.Context, w http.ResponseWriter, err *conditionError) {
+	response := err.current
+	setCausalContext(w, response)
+	response.Key = clientKey(ctx, response.Key)
+	w.WriteHeader(http.StatusPreconditionFailed)
+	s.writeJSON(w, response)
+}
+
+// nextVersion returns the clock of a new write to key: the client's causal
+// context or, without one, every clock the replicas hold, advanced by this
+// node. Local-only writes consult only the local clock. A context that the
+// local copy has moved past is rejected with ErrStaleVersion.
+func (s *HTTPServer) nextVersion(ctx context.Context, key string, causal clock.VectorClock, preferenceList []ring.NodeID, localOnly bool) (clock.VectorClock, error) {
+	current, _ := s.versions.GetVersioned(key)
+	base := causal
+	if base.IsEmpty() {
+		base = s.heldVersion(ctx, key, current, preferenceList, localOnly)
+	} else if current != nil && clock.Compare(base, current.Version) < 0 {
+		return nil, storage.ErrStaleVersion
+	} else if s.cfg.MaxSiblings > 0 && s.cfg.SiblingOverflow == config.SiblingOverflowReject {
+		if err := s.checkSiblings(base, s.heldVersions(ctx, key, current, preferenceList, localOnly)); err != nil {
+			return nil, err
+		}
+	}
+	return s.advance(base, current), nil
+}
+
+// checkSiblings fails with errTooManySiblings a write with context base
+// that would leave more than cfg.MaxSiblings versions of its key, counting
+// its own and every version of held, the clocks the replicas store, that
+// base does not cover. Under LWW storage collapses the versions past the
+// cap instead.
+func (s *HTTPServer) checkSiblings(base clock.VectorClock, held []clock.VectorClock) error {
+	var uncovered []clock.VectorClock
+	for _, version := range held {
+		if clock.Compare(version, base) < 0 || clock.Equal(version, base) {
+			continue
+		}
+		if !slices.ContainsFunc(uncovered, func(v clock.VectorClock) bool { return clock.Equal(v, version) }) {
+			uncovered = append(uncovered, version)
+		}
+	}
+	if len(uncovered)+1 <= s.cfg.MaxSiblings {
+		return nil
+	}
+	s.metrics.Count("sibling_overflows", 1)
+	return errTooManySiblings
+}
+
+// advance returns the version of a write based on base, advancing this
+// node's counter past that of current, the local copy if any.
+func (s *HTTPServer) advance(base clock.VectorClock, current *storage.VersionedValue) clock.VectorClock {
+	version := base.Copy()
+	if current != nil {
+		// A context concurrent with the local copy must not reuse its counter
+		version[s.cfg.NodeID] = max(version[s.cfg.NodeID], current.Context()[s.cfg.NodeID])
+	}
+	version.Increment(s.cfg.NodeID)
+	return version
+}
+
+// overflowsToLWW reports whether a read that found n versions returns the
+// latest of them instead, as each replica stores them once repaired. Every
+// replica holds at most cfg.MaxSiblings, but replicas that were apart can
+// hold more between them.
+func (s *HTTPServer) overflowsToLWW(n int) bool {
+	return maxStoredSiblings(s.cfg) > 0 && n > maxStoredSiblings(s.cfg)
+}
+
+// heldVersion merges the clocks the replicas of key hold, so that a blind
+// write is never rejected as stale. Unreachable replicas are skipped.
+func (s *HTTPServer) heldVersion(ctx context.Context, key string, current *storage.VersionedValue, preferenceList []ring.NodeID, localOnly bool) clock.VectorClock {
+	held := clock.New()
+	for _, version := range s.heldVersions(ctx, key, current, preferenceList, localOnly) {
+		held = held.Merge(version)
+	}
+	return held
+}
+
+// heldVersions returns the clock of every version of key the replicas
+// store, siblings included, current being the local copy. Unreachable
+// replicas and those without a copy are skipped.
+func (s *HTTPServer) heldVersions(ctx context.Context, key string, current *storage.VersionedValue, preferenceList []ring.NodeID, localOnly bool) []clock.VectorClock {
+	var held []clock.VectorClock
+	if current != nil {
+		for _, version := range current.Versions() {
+			held = append(held, version.Version)
+		}
+	}
+	if localOnly {
+		return held
+	}
+	for _, nodeID := range preferenceList {
+		if nodeID == ring.NodeID(s.cfg.NodeID) {
+			continue
+		}
+		for _, version := range s.replicaMetadata(ctx, nodeID, key).Versions {
+			held = append(held, version)
+		}
+	}
+	return held
+}
+
+// storeError maps a local storage failure onto the client-facing error.
+func storeError(key string, err error) error {
+	if errors.Is(err, storage.ErrStaleVersion) {
+		return &opError{http.StatusConflict, "a newer version is stored for key: " + key}
+	}
+	if errors.Is(err, errTooManySiblings) {
+		return &opError{http.StatusConflict, "write would leave too many siblings of key: " + key + "; write with the context of a read to resolve them"}
+	}
+	return &opError{http.StatusInternalServerError, "failed to store value"}
+}
+
+// replicaValue rebuilds the versioned value a replica message carries,
+// with the siblings of resp.
+func replicaValue(value []byte, version map[string]uint64, resp api.ReplicateGetResponse) *storage.VersionedValue {
+	vv := &storage.VersionedValue{
+		Value:       value,
+		Version:     clock.VectorClock(version).Copy(),
+		Timestamp:   resp.Timestamp,
+		ExpiresAt:   resp.ExpiresAt,
+		ContentType: resp.ContentType,
+		Meta:        resp.Meta,
+	}
+	for _, sibling := range resp.Siblings {
+		sv := replicaValue(sibling.Value, sibling.Version, sibling)
+		sv.Tombstone = sibling.Tombstone
+		vv.Siblings = append(vv.Siblings, sv)
+	}
+	vv.Seal()
+	return vv
+}
+
+// replicaSiblings lists the siblings of a stored value for a replica read.
+func replicaSiblings(key string, siblings []*storage.VersionedValue) []api.ReplicateGetResponse {
+	var reads []api.ReplicateGetResponse
+	for _, sibling := range siblings {
+		reads = append(reads, api.ReplicateGetResponse{
+			Key:         key,
+			Value:       sibling.Value,
+			Version:     sibling.Version,
+			Found:       !sibling.Tombstone,
+			ExpiresAt:   sibling.ExpiresAt,
+			Timestamp:   sibling.Timestamp,
+			Checksum:    sibling.Checksum,
+			Tombstone:   sibling.Tombstone,
+			ContentType: sibling.ContentType,
+			Meta:        sibling.Meta,
+		})
+	}
+	return reads
+}
+
+// maxStoredSiblings is the number of concurrent versions storage keeps of
+// a key, collapsing the rest into the latest write: one under LWW,
+// cfg.MaxSiblings when it overflows to LWW, and any number otherwise.
+func maxStoredSiblings(cfg *config.Config) int {
+	switch {
+	case cfg.LWW:
+		return 1
+	case cfg.SiblingOverflow == config.SiblingOverflowLWW:
+		return cfg.MaxSiblings
+	}
+	return 0
+}
+
+// errChecksumMismatch reports a value that was corrupted on its way here.
+var errChecksumMismatch = errors.New("value does not match its checksum")
+
+// replicateValue is replicaValue for an incoming replication request,
+// refusing a value or sibling that does not match the checksum the
+// coordinator sent.
+func replicateValue(req api.ReplicateRequest) (*storage.VersionedValue, error) {
+	if crc32.ChecksumIEEE(req.Value) != req.Checksum {
+		return nil, fmt.Errorf("key %s: %w", req.Key, errChecksumMismatch)
+	}
+	value := replicaValue(req.Value, req.Version, api.ReplicateGetResponse{Timestamp: req.Timestamp, ExpiresAt: req.ExpiresAt, ContentType: req.ContentType, Meta: req.Meta})
+	value.Tombstone = req.Tombstone
+	for _, sibling := range req.Siblings {
+		sibling.Key = req.Key
+		sv, err := replicateValue(sibling)
+		if err != nil {
+			return nil, err
+		}
+		value.Siblings = append(value.Siblings, sv)
+	}
+	return value, nil
+}
+
+// versioned reports whether a read carries a version: a value or a tombstone.
+func versioned(read api.ReplicateGetResponse) bool {
+	return read.Found || read.Tombstone
+}
+
+// readVersions returns the versions a replica read holds: the read itself
+// and each of its siblings, values and tombstones alike.
+func readVersions(read api.ReplicateGetResponse) []api.ReplicateGetResponse {
+	var versions []api.ReplicateGetResponse
+	if versioned(read) {
+		own := read
+		own.Siblings = nil
+		versions = append(versions, own)
+	}
+	for _, sibling := range read.Siblings {
+		if versioned(sibling) {
+			versions = append(versions, sibling)
+		}
+	}
+	return versions
+}
+
+// currentVersions returns the distinct versions among reads that no other
+// version read supersedes. More than one means the replicas hold
+// concurrent writes, whether as siblings of one replica or apart.
+func currentVersions(reads []replicaRead) []api.ReplicateGetResponse {
+	var all []api.ReplicateGetResponse
+	for _, r := range reads {
+		all = append(all, readVersions(r.ReplicateGetResponse)...)
+	}
+	var current []api.ReplicateGetResponse
+	for _, version := range all {
+		superseded := slices.ContainsFunc(all, func(other api.ReplicateGetResponse) bool {
+			return clock.Compare(version.Version, other.Version) < 0
+		})
+		if !superseded && !slices.ContainsFunc(current, func(kept api.ReplicateGetResponse) bool {
+			return clock.Equal(kept.Version, version.Version)
+		}) {
+			current = append(current, version)
+		}
+	}
+	return current
+}
+
+// newestRead picks the read to return from a quorum: the latest write among
+// the current versions, with the others as its siblings, so that writing it
+// back gives every replica the whole set. A value comes before concurrent
+// tombstones; the result is a tombstone only when every current version is
+// one, so a delete beats every older value.
+func newestRead(reads []replicaRead) api.ReplicateGetResponse {
+	current := currentVersions(reads)
+	if len(current) == 0 {
+		return api.ReplicateGetResponse{}
+	}
+	slices.SortStableFunc(current, func(a, b api.ReplicateGetResponse) int {
+		if a.Tombstone != b.Tombstone {
+			if a.Tombstone {
+				return 1
+			}
+			return -1
+		}
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+	newest := current[0]
+	newest.Siblings = current[1:]
+	if len(newest.Siblings) == 0 {
+		newest.Siblings = nil
+	}
+	return newest
+}
+
+// readContext merges the clocks of every version read holds.
+func readContext(read api.ReplicateGetResponse) clock.VectorClock {
+	context := clock.New()
+	for _, version := range readVersions(read) {
+		context = context.Merge(version.Version)
+	}
+	return context
+}
+
+// foundVersions returns the values, not tombstones, among read and its
+// siblings.
+func foundVersions(read api.ReplicateGetResponse) []api.ReplicateGetResponse {
+	var found []api.ReplicateGetResponse
+	for _, version := range readVersions(read) {
+		if version.Found {
+			found = append(found, version)
+		}
+	}
+	return found
+}
+
+// supersedesAll reports whether read is at least as new as every version
+// in reads and has no siblings of its own.
+func supersedesAll(read api.ReplicateGetResponse, reads []replicaRead) bool {
+	if len(read.Siblings) > 0 {
+		return false
+	}
+	for _, other := range reads {
+		for _, version := range readVersions(other.ReplicateGetResponse) {
+			if clock.Compare(read.Version, version.Version) <= 0 && !clock.Equal(read.Version, version.Version) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// staleReplicas lists the replicas whose read does not hold exactly the
+// versions of newest, the value or tombstone a quorum read returns and its
+// siblings.
+func staleReplicas(reads []replicaRead, newest api.ReplicateGetResponse) []ring.NodeID {
+	want := readVersions(newest)
+	var stale []ring.NodeID
+	for _, read := range reads {
+		held := readVersions(read.ReplicateGetResponse)
+		if len(held) != len(want) || slices.ContainsFunc(want, func(version api.ReplicateGetResponse) bool {
+			return !slices.ContainsFunc(held, func(h api.ReplicateGetResponse) bool { return clock.Equal(h.Version, version.Version) })
+		}) {
+			stale = append(stale, read.nodeID)
+		}
+	}
+	return stale
+}
@@ -0,0 +1,375 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestCausalContext(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.WriteQuorum = 1
+
+	put := func(value, context string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/kv/key", strings.NewReader(value))
+		if context != "" {
+			req.Header.Set(causalContextHeader, context)
+		}
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := put("v1", ""); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for put, got %d", rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kv/key", nil))
+	context := rec.Header().Get(causalContextHeader)
+	if context != `{"test-node":1}` {
+		t.Fatalf("Expected the stored version as context, got %q", context)
+	}
+
+	rec = put("v2", context)
+	var resp api.PutResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode put response: %v", err)
+	}
+	if rec.Code != http.StatusOK || resp.Version["test-node"] != 2 {
+		t.Errorf("Expected the write to advance the clock to 2, got %d %+v", rec.Code, resp)
+	}
+	if rec := put("v3", context); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a stale context, got %d", rec.Code)
+	}
+	if rec := put("v3", "not json"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid context, got %d", rec.Code)
+	}
+	if value, _ := s.storage.Get("key"); string(value) != "v2" {
+		t.Errorf("Expected v2 to be kept, got %q", value)
+	}
+}
+
+func TestConditionalPut(t *testing.T) {
+	s := newTestServer(t)
+	s.cfg.WriteQuorum = 1
+
+	put := func(value, header, context string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/kv/key", strings.NewReader(value))
+		req.Header.Set(header, context)
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := put("v1", ifMatchHeader, `{}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected a conditional put of a new key to succeed, got %d", rec.Code)
+	}
+	if rec := put("v2", ifMatchHeader, `{}`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for an empty context over a stored key, got %d", rec.Code)
+	}
+
+	// Another writer moves the key on
+	if rec := put("other", causalContextHeader, `{"x":1}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a put, got %d", rec.Code)
+	}
+	rec := put("v2", ifMatchHeader, `{"test-node":1}`)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected 412 for a context the key moved past, got %d", rec.Code)
+	}
+	var current api.GetResponse
+	if err := json.NewDecoder(rec.Body).Decode(&current); err != nil {
+		t.Fatalf("Failed to decode 412 response: %v", err)
+	}
+	if string(current.Value) != "other" || len(current.Versions) != 1 || current.Versions[0]["x"] != 1 {
+		t.Errorf("Expected the current version in the 412 response, got %+v", current)
+	}
+	context := rec.Header().Get(causalContextHeader)
+	if context == "" {
+		t.Fatalf("Expected the 412 response to carry the merged context")
+	}
+	if value, _ := s.storage.Get("key"); string(value) == "v2" {
+		t.Errorf("Expected a failed condition to leave the key alone")
+	}
+
+	if rec := put("v2", ifMatchHeader, context); rec.Code != http.StatusOK {
+		t.Errorf("Expected the merged context to match, got %d", rec.Code)
+	}
+	if value, _ := s.storage.Get("key"); string(value) != "v2" {
+		t.Errorf("Expected v2 to be written, got %q", value)
+	}
+	if rec := put("v3", ifMatchHeader, "not json"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid condition, got %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodPut, "/kv/key", strings.NewReader("v3"))
+	req.Header.Set(ifMatchHeader, context)
+	req.Header.Set(causalContextHeader, context)
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for both a context and a condition, got %d", rec.Code)
+	}
+}
+
+func TestBlindWritesFollowReplicaVersions(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+
+	if _, err := a.put(t.Context(), "key", []byte("v1"), nil, 2, time.Time{}); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	resp, err := b.put(t.Context(), "key", []byte("v2"), nil, 2, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if resp.Version["a"] != 1 || resp.Version["b"] != 1 {
+		t.Errorf("Expected the second write to descend from the first, got %v", resp.Version)
+	}
+	got, err := a.get(t.Context(), "key", 2)
+	if err != nil || string(got.Value) != "v2" {
+		t.Fatalf("Expected v2 from both replicas, got %+v, %v", got, err)
+	}
+	if len(got.Versions) != 1 || got.Versions[0]["b"] != 1 {
+		t.Errorf("Expected the version of v2, got %v", got.Versions)
+	}
+}
+
+func TestSiblings(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+
+	a.versions.PutVersioned("key", storage.NewVersionedValue([]byte("from-a"), clock.VectorClock{"a": 1}))
+	b.versions.PutVersioned("key", storage.NewVersionedValue([]byte("from-b"), clock.VectorClock{"b": 1}))
+
+	rec := httptest.NewRecorder()
+	a.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/kv/key", nil))
+	var resp api.GetResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode get response: %v", err)
+	}
+	if len(resp.Siblings) != 2 || len(resp.Versions) != 2 {
+		t.Fatalf("Expected 2 siblings with their versions, got %+v", resp)
+	}
+	values := []string{string(resp.Siblings[0].Value), string(resp.Siblings[1].Value)}
+	slices.Sort(values)
+	if values[0] != "from-a" || values[1] != "from-b" {
+		t.Errorf("Expected both concurrent values, got %q", values)
+	}
+	context := rec.Header().Get(causalContextHeader)
+	if context != `{"a":1,"b":1}` {
+		t.Fatalf("Expected a context covering both siblings, got %q", context)
+	}
+	waitFor(t, func() bool {
+		held, ok := a.versions.GetVersioned("key")
+		return ok && len(held.Versions()) == 2
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/kv/key", strings.NewReader("resolved"))
+	req.Header.Set(causalContextHeader, context)
+	rec = httptest.NewRecorder()
+	a.server.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a put superseding the siblings, got %d", rec.Code)
+	}
+	got, err := a.get(t.Context(), "key", 2)
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	if len(got.Siblings) != 0 || string(got.Value) != "resolved" {
+		t.Errorf("Expected the resolved value alone, got %+v", got)
+	}
+}
+
+func TestSiblingsSurviveReplication(t *testing.T) {
+	a, b := startTestNode(t, "a"), startTestNode(t, "b")
+	a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+	b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+	get := func(s *HTTPServer, readQuorum string) api.GetResponse {
+		req := httptest.NewRequest(http.MethodGet, "/kv/key", nil)
+		req.Header.Set(readConsistencyHeader, readQuorum)
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, req)
+		var resp api.GetResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+
+	// Each replica took one of two concurrent writes, then anti-entropy
+	// brings both to the same state
+	a.versions.PutVersioned("key", storage.NewVersionedValue([]byte("from-a"), clock.VectorClock{"a": 1}))
+	b.versions.PutVersioned("key", storage.NewVersionedValue([]byte("from-b"), clock.VectorClock{"b": 1}))
+	for _, node := range []*HTTPServer{a, b} {
+		for _, tr := range node.primaryRanges() {
+			if result := node.repairRange(t.Context(), tr); result.Error != "" {
+				t.Fatalf("Expected range %s-%s to be repaired, got %s", result.Start, result.End, result.Error)
+			}
+		}
+	}
+
+	for _, node := range []*HTTPServer{a, b} {
+		held, ok := node.versions.GetVersioned("key")
+		if !ok || len(held.Versions()) != 2 {
+			t.Fatalf("Expected %s to store both concurrent writes, got %+v", node.cfg.NodeID, held)
+		}
+		for _, readQuorum := range []string{"1", "2"} {
+			resp := get(node, readQuorum)
+			values := make([]string, 0, len(resp.Siblings))
+			for _, sibling := range resp.Siblings {
+				values = append(values, string(sibling.Value))
+			}
+			slices.Sort(values)
+			if !slices.Equal(values, []string{"from-a", "from-b"}) || len(resp.Versions) != 2 {
+				t.Errorf("Expected both siblings from %s at R=%s, got %+v", node.cfg.NodeID, readQuorum, resp)
+			}
+		}
+	}
+	if repairs := a.stats.readRepairs.Value() + b.stats.readRepairs.Value(); repairs != 0 {
+		t.Errorf("Expected replicas that agree on the siblings not to be repaired, got %d repairs", repairs)
+	}
+}
+
+func TestSiblingLimit(t *testing.T) {
+	pair := func(overflow string) (*HTTPServer, *HTTPServer) {
+		configure := func(cfg *config.Config) {
+			cfg.MaxSiblings = 1
+			cfg.SiblingOverflow = overflow
+		}
+		a, _ := startTestNodeWith(t, "a", configure)
+		b, _ := startTestNodeWith(t, "b", configure)
+		a.ring.JoinNode("b", b.cfg.BindAddr, 1)
+		b.ring.JoinNode("a", a.cfg.BindAddr, 1)
+		return a, b
+	}
+	siblings := func(a, b *HTTPServer, key string) {
+		a.versions.PutVersioned(key, storage.NewVersionedValue([]byte("from-a"), clock.VectorClock{"a": 1}))
+		b.versions.PutVersioned(key, storage.NewVersionedValue([]byte("from-b"), clock.VectorClock{"b": 1}))
+	}
+	put := func(s *HTTPServer, key string) int {
+		req := httptest.NewRequest(http.MethodPut, "/kv/"+key, strings.NewReader("mine"))
+		req.Header.Set(causalContextHeader, `{"a":1}`)
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	stored := func(s *HTTPServer, key string) []*storage.VersionedValue {
+		held, ok := s.versions.GetVersioned(key)
+		if !ok {
+			return nil
+		}
+		return held.Versions()
+	}
+
+	// Under LWW each replica stores at most one version
+	a, b := pair(config.SiblingOverflowLWW)
+	siblings(a, b, "stored")
+	a.versions.PutVersioned("stored", storage.NewVersionedValue([]byte("later"), clock.VectorClock{"c": 1}))
+	if held := stored(a, "stored"); len(held) != 1 || string(held[0].Value) != "later" || !clock.Equal(held[0].Version, clock.VectorClock{"a": 1, "c": 1}) {
+		t.Errorf("Expected the stored versions collapsed into the latest, got %+v", held)
+	}
+
+	// a read returns the latest of the versions the replicas hold between
+	// them and repairs both to it
+	siblings(a, b, "read")
+	got, err := a.get(t.Context(), "read", 2)
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	if len(got.Siblings) != 0 || string(got.Value) != "from-b" || len(got.Versions) != 1 {
+		t.Errorf("Expected the latest sibling alone, got %+v", got)
+	}
+	waitFor(t, func() bool {
+		held := stored(a, "read")
+		return len(held) == 1 && string(held[0].Value) == "from-b"
+	})
+
+	// and a write that misses a sibling supersedes it on every replica
+	siblings(a, b, "write")
+	if code := put(a, "write"); code != http.StatusOK {
+		t.Fatalf("Expected 200 for a write superseding the siblings, got %d", code)
+	}
+	for _, node := range []*HTTPServer{a, b} {
+		if held := stored(node, "write"); len(held) != 1 || string(held[0].Value) != "mine" {
+			t.Errorf("Expected %s to store the write alone, got %+v", node.cfg.NodeID, held)
+		}
+	}
+
+	// Under reject such a write is refused, while replicas still take
+	// every version repair brings them
+	a, b = pair(config.SiblingOverflowReject)
+	siblings(a, b, "reject")
+	if code := put(a, "reject"); code != http.StatusConflict {
+		t.Errorf("Expected 409 for a write past the sibling limit, got %d", code)
+	}
+	siblings(a, b, "reject-batch")
+	var batch api.BatchResponse
+	rec := httptest.NewRecorder()
+	a.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/kv/_batch", strings.NewReader(`{"items":[{"key":"reject-batch","value":"bWluZQ==","context":{"a":1}}]}`)))
+	json.NewDecoder(rec.Body).Decode(&batch)
+	if len(batch.Results) != 1 || batch.Results[0].Status != http.StatusConflict {
+		t.Errorf("Expected 409 for a batch write past the sibling limit, got %+v", batch)
+	}
+	if got, err := a.get(t.Context(), "reject", 2); err != nil || len(got.Siblings) != 2 {
+		t.Errorf("Expected both siblings to be kept and read, got %+v, %v", got, err)
+	}
+	waitFor(t, func() bool { return len(stored(a, "reject")) == 2 && len(stored(b, "reject")) == 2 })
+	if code := put(a, "reject"); code != http.StatusConflict {
+		t.Errorf("Expected 409 for a write past the stored siblings, got %d", code)
+	}
+}
+
+func TestVersionedReplicaProtocol(t *testing.T) {
+	s := newTestServer(t)
+	replicate := func(value string, version map[string]uint64, timestamp time.Time) int {
+		body, _ := json.Marshal(api.ReplicateRequest{
+			Key:       "key",
+			Value:     []byte(value),
+			Version:   version,
+			Timestamp: timestamp,
+			Checksum:  crc32.ChecksumIEEE([]byte(value)),
+		})
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/internal/storage/key", bytes.NewReader(body)))
+		return rec.Code
+	}
+	read := func() api.ReplicateGetResponse {
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/internal/storage/key", nil))
+		var resp api.ReplicateGetResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+	start := time.Now()
+
+	if code := replicate("v2", map[string]uint64{"a": 2}, start); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if code := replicate("v1", map[string]uint64{"a": 1}, start.Add(time.Second)); code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a stale version, got %d", code)
+	}
+	if resp := read(); string(resp.Value) != "v2" || !clock.Equal(resp.Version, clock.VectorClock{"a": 2}) {
+		t.Errorf("Expected the stale write to be ignored, got %q at %v", resp.Value, resp.Version)
+	}
+
+	// A concurrent write is kept alongside the stored one as a sibling
+	if code := replicate("b1", map[string]uint64{"b": 1}, start.Add(time.Second)); code != http.StatusOK {
+		t.Fatalf("Expected status 200 for a concurrent version, got %d", code)
+	}
+	resp := read()
+	if string(resp.Value) != "b1" || !clock.Equal(resp.Version, clock.VectorClock{"b": 1}) {
+		t.Errorf("Expected the later concurrent write first, got %q at %v", resp.Value, resp.Version)
+	}
+	if len(resp.Siblings) != 1 || string(resp.Siblings[0].Value) != "v2" || !clock.Equal(resp.Siblings[0].Version, clock.VectorClock{"a": 2}) {
+		t.Errorf("Expected v2 kept as a sibling, got %+v", resp.Siblings)
+	}
+}
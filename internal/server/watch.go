@@ -0,0 +1,281 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+	"github.com/amirderis/DHT/internal/storage"
+	"github.com/amirderis/DHT/pkg/api"
+	"github.com/amirderis/DHT/pkg/api/dhtpb"
+)
+
+// watchBuffer is how many events a watcher may lag behind before it is dropped.
+const watchBuffer = 64
+
+// watchHistory is how many recent events the hub keeps for watchers that
+// reconnect with a cursor.
+const watchHistory = 1024
+
+// watchEvent is a write to a key as watchers see it, or with rebalance
+// set the progress of ranges moving to or from this node. Seq numbers the
+// events of this process in the order they were published.
+type watchEvent struct {
+	seq       uint64
+	deleted   bool
+	key       string
+	value     []byte
+	version   clock.VectorClock
+	rebalance *api.RebalanceEvent
+}
+
+func (ev watchEvent) proto() *dhtpb.WatchEvent {
+	if ev.deleted {
+		return &dhtpb.WatchEvent{Type: dhtpb.WatchEvent_DELETE, Key: ev.key}
+	}
+	return &dhtpb.WatchEvent{Type: dhtpb.WatchEvent_PUT, Key: ev.key, Value: ev.value}
+}
+
+// watchHub fans out writes applied to local storage to gRPC Watch streams
+// and HTTP watches, keeping the last watchHistory of them.
+type watchHub struct {
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+	seq      uint64
+	history  []watchEvent // oldest first
+}
+
+// watcher receives the events for one key, or for every key under prefix
+// when key is empty, or only rebalance events when rebalance is set.
+type watcher struct {
+	key       string
+	prefix    string
+	rebalance bool
+	events    chan watchEvent
+}
+
+func (w *watcher) matches(ev watchEvent) bool {
+	switch {
+	case w.rebalance || ev.rebalance != nil:
+		return w.rebalance && ev.rebalance != nil
+	case w.key != "":
+		return ev.key == w.key
+	}
+	return strings.HasPrefix(ev.key, w.prefix)
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{watchers: make(map[*watcher]struct{})}
+}
+
+// subscribe registers a watcher for the events published from now on.
+func (h *watchHub) subscribe(prefix string) *watcher {
+	w, _, _ := h.subscribeAfter(&watcher{prefix: prefix}, math.MaxUint64)
+	return w
+}
+
+// subscribeAfter registers w and returns the events it matches that were
+// published after seq, reporting false when some of them are no longer
+// kept. Events published afterwards go to w.events, so none is missed or
+// seen twice between the two.
+func (h *watchHub) subscribeAfter(w *watcher, seq uint64) (*watcher, []watchEvent, bool) {
+	w.events = make(chan watchEvent, watchBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.watchers[w] = struct{}{}
+	complete := seq >= h.seq || (len(h.history) > 0 && seq+1 >= h.history[0].seq)
+	var missed []watchEvent
+	for _, ev := range h.history {
+		if ev.seq > seq && w.matches(ev) {
+			missed = append(missed, ev)
+		}
+	}
+	return w, missed, complete
+}
+
+func (h *watchHub) unsubscribe(w *watcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.watchers[w]; ok {
+		delete(h.watchers, w)
+		close(w.events)
+	}
+}
+
+// publish numbers ev and delivers it to every watcher it matches. Watchers
+// whose buffer is full are dropped and their channel closed rather than
+// blocking writes.
+func (h *watchHub) publish(ev watchEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ev.seq = h.seq
+	if len(h.history) == watchHistory {
+		h.history = append(h.history[:0], h.history[1:]...)
+	}
+	h.history = append(h.history, ev)
+	for w := range h.watchers {
+		if !w.matches(ev) {
+			continue
+		}
+		select {
+		case w.events <- ev:
+		default:
+			delete(h.watchers, w)
+			close(w.events)
+		}
+	}
+}
+
+// storeVersioned writes to local storage and notifies watchers. Storing
+// the tombstone of a chunked value schedules the cleanup of its chunks.
+func (s *HTTPServer) storeVersioned(key string, value *storage.VersionedValue) error {
+	if err := s.versions.PutVersioned(key, value); err != nil {
+		return err
+	}
+	if value.Tombstone {
+		if isManifest(value.Value) {
+			s.scheduleChunkCleanup(key, value.Value)
+		}
+		s.watches.publish(watchEvent{deleted: true, key: key, version: value.Version.Copy()})
+		return nil
+	}
+	s.watches.publish(watchEvent{key: key, value: append([]byte(nil), value.Value...), version: value.Version.Copy()})
+	return nil
+}
+
+// storeBatch writes a batch to local storage and notifies watchers of each item.
+func (s *HTTPServer) storeBatch(items []storage.KeyedVersionedValue) error {
+	if err := s.versions.PutBatch(items); err != nil {
+		return err
+	}
+	for _, item := range items {
+		s.watches.publish(watchEvent{deleted: item.Value.Tombstone, key: item.Key, value: append([]byte(nil), item.Value.Value...), version: item.Value.Version.Copy()})
+	}
+	return nil
+}
+
+// storeDelete removes a key from local storage and notifies watchers.
+func (s *HTTPServer) storeDelete(key string) error {
+	if err := s.storage.Delete(key); err != nil {
+		return err
+	}
+	s.watches.publish(watchEvent{deleted: true, key: key})
+	return nil
+}
+
+// watchKeepalive is how often an idle HTTP watch sends a comment, so that
+// proxies do not close it.
+const watchKeepalive = 15 * time.Second
+
+// handleWatch streams the events w matches as server-sent events, for
+// GET /kv/{key}/watch and GET /kv/_watch?prefix=p. Every event carries a
+// cursor as its id; a client that reconnects with it as Last-Event-ID (or
+// ?cursor=) first receives the events it missed. When those are no longer
+// kept, or the node restarted since, the stream starts with a reset event
+// instead and the client should reread what it watches. A watch sees the
+// writes this node stores and the writes it coordinates, so a client
+// watches a key on one of its replicas to see every write to it.
+func (s *HTTPServer) handleWatch(w http.ResponseWriter, r *http.Request, watch *watcher) {
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("cursor")
+	}
+	after, reset := uint64(math.MaxUint64), false
+	if cursor != "" {
+		incarnation, seq, ok := parseWatchCursor(cursor)
+		if !ok {
+			s.writeError(w, http.StatusBadRequest, "invalid cursor: "+cursor)
+			return
+		}
+		if incarnation == s.incarnation {
+			after = seq
+		} else {
+			reset = true
+		}
+	}
+	watch, missed, complete := s.watches.subscribeAfter(watch, after)
+	defer s.watches.unsubscribe(watch)
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if reset || !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, ev := range missed {
+		s.sendWatchEvent(r.Context(), w, ev)
+	}
+	rc.Flush()
+
+	keepalive := time.NewTicker(watchKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case ev, ok := <-watch.events:
+			if !ok {
+				// Fell behind; the client resumes from its last cursor
+				return
+			}
+			s.sendWatchEvent(r.Context(), w, ev)
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		case <-s.stopCh:
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// sendWatchEvent writes ev as a server-sent event, leaving out chunks of
+// chunked values.
+func (s *HTTPServer) sendWatchEvent(ctx context.Context, w http.ResponseWriter, ev watchEvent) {
+	if ev.rebalance != nil {
+		data, _ := json.Marshal(ev.rebalance)
+		fmt.Fprintf(w, "id: %d-%d\nevent: rebalance\ndata: %s\n\n", s.incarnation, ev.seq, data)
+		return
+	}
+	if chunkKeyPattern.MatchString(ev.key) {
+		return
+	}
+	event := api.WatchEvent{Type: api.WatchPut, Key: clientKey(ctx, ev.key), Version: ev.version}
+	switch {
+	case ev.deleted:
+		event.Type = api.WatchDelete
+	case !isManifest(ev.value):
+		event.Value = ev.value
+	}
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "id: %d-%d\nevent: %s\ndata: %s\n\n", s.incarnation, ev.seq, event.Type, data)
+}
+
+// parseWatchCursor splits the id of a watch event into the incarnation of
+// the node that sent it and the event's seq.
+func parseWatchCursor(cursor string) (uint64, uint64, bool) {
+	rawIncarnation, rawSeq, ok := strings.Cut(cursor, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	incarnation, err := strconv.ParseUint(rawIncarnation, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err := strconv.ParseUint(rawSeq, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return incarnation, seq, true
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestWatch(t *testing.T) {
+	s := startTestNode(t, "a")
+
+	type event struct{ id, typ, data string }
+	open := func(path, lastID string) (*http.Response, *bufio.Reader) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, "http://"+s.cfg.BindAddr+path, nil)
+		req.Header.Set("Accept", "text/event-stream")
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to watch %s: %v", path, err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("Expected an event stream, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+	next := func(r *bufio.Reader) event {
+		t.Helper()
+		var ev event
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Failed to read event: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "" && ev.typ != "":
+				return ev
+			case strings.HasPrefix(line, "id: "):
+				ev.id = line[len("id: "):]
+			case strings.HasPrefix(line, "event: "):
+				ev.typ = line[len("event: "):]
+			case strings.HasPrefix(line, "data: "):
+				ev.data = line[len("data: "):]
+			}
+		}
+	}
+	put := func(key, value string) {
+		t.Helper()
+		if _, err := s.put(t.Context(), key, []byte(value), nil, 1, time.Time{}); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+
+	resp, stream := open("/kv/k1/watch", "")
+	put("k2", "other")
+	put("k1", "v1")
+	first := next(stream)
+	var got api.WatchEvent
+	if err := json.Unmarshal([]byte(first.data), &got); err != nil || first.typ != api.WatchPut || got.Key != "k1" || string(got.Value) != "v1" || len(got.Version) == 0 {
+		t.Fatalf("Expected a put of k1, got %+v (%v)", first, err)
+	}
+	resp.Body.Close()
+
+	// Reconnecting with the last cursor replays what was missed
+	put("k1", "v2")
+	if err := s.Delete(t.Context(), "k1"); err != nil {
+		t.Fatalf("Failed to delete k1: %v", err)
+	}
+	resp, stream = open("/kv/k1/watch", first.id)
+	if ev := next(stream); ev.typ != api.WatchPut || !strings.Contains(ev.data, base64.StdEncoding.EncodeToString([]byte("v2"))) {
+		t.Errorf("Expected the missed put of v2, got %+v", ev)
+	}
+	if ev := next(stream); ev.typ != api.WatchDelete {
+		t.Errorf("Expected the missed delete, got %+v", ev)
+	}
+	resp.Body.Close()
+
+	// A cursor from an earlier run of the node cannot be resumed
+	resp, stream = open("/kv/_watch?prefix=k", fmt.Sprintf("%d-1", s.incarnation+1))
+	if ev := next(stream); ev.typ != "reset" {
+		t.Errorf("Expected a reset, got %+v", ev)
+	}
+	put("k3", "v3")
+	if ev := next(stream); !strings.Contains(ev.data, `"key":"k3"`) {
+		t.Errorf("Expected the prefix watch to see k3, got %+v", ev)
+	}
+	resp.Body.Close()
+
+	// Without asking for an event stream, a key ending in /watch is read
+	plain, err := http.Get("http://" + s.cfg.BindAddr + "/kv/k1/watch")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	plain.Body.Close()
+	if plain.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a read of the key k1/watch, got %d", plain.StatusCode)
+	}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// counterMagic prefixes a stored value that holds a Counter.
+const counterMagic = "\x00dht-counter\x00"
+
+// Counter is a counter that replicas update without coordinating. Each node
+// adds what it counts to its own entries, which only ever grow, and the
+// value is their sum. A replica merges every counter it is sent with the
+// one it holds entry by entry, keeping the larger count, so that no
+// increment is lost to another; only a delete replaces a counter.
+type Counter struct {
+	Incr map[string]uint64 `json:"incr,omitempty"`
+	Decr map[string]uint64 `json:"decr,omitempty"`
+}
+
+// IsCounter reports whether a stored value holds a Counter.
+func IsCounter(value []byte) bool {
+	return bytes.HasPrefix(value, []byte(counterMagic))
+}
+
+// DecodeCounter parses a value stored by Counter.Encode.
+func DecodeCounter(value []byte) (Counter, error) {
+	var c Counter
+	err := json.Unmarshal(bytes.TrimPrefix(value, []byte(counterMagic)), &c)
+	return c, err
+}
+
+// Encode returns the value that stores c.
+func (c Counter) Encode() []byte {
+	data, _ := json.Marshal(c)
+	return append([]byte(counterMagic), data...)
+}
+
+// Add counts delta, which may be negative, against nodeID's entries.
+func (c *Counter) Add(nodeID string, delta int64) {
+	if delta >= 0 {
+		c.Incr = addCount(c.Incr, nodeID, uint64(delta))
+	} else {
+		c.Decr = addCount(c.Decr, nodeID, uint64(-delta))
+	}
+}
+
+func addCount(counts map[string]uint64, nodeID string, n uint64) map[string]uint64 {
+	if counts == nil {
+		counts = make(map[string]uint64)
+	}
+	counts[nodeID] += n
+	return counts
+}
+
+// Value returns the sum of every node's increments less its decrements.
+func (c Counter) Value() int64 {
+	var total int64
+	for _, n := range c.Incr {
+		total += int64(n)
+	}
+	for _, n := range c.Decr {
+		total -= int64(n)
+	}
+	return total
+}
+
+// Merge returns the counter that has counted everything c and other have.
+func (c Counter) Merge(other Counter) Counter {
+	return Counter{Incr: mergeCounts(c.Incr, other.Incr), Decr: mergeCounts(c.Decr, other.Decr)}
+}
+
+func mergeCounts(a, b map[string]uint64) map[string]uint64 {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	merged := make(map[string]uint64, len(a)+len(b))
+	for nodeID, n := range a {
+		merged[nodeID] = n
+	}
+	for nodeID, n := range b {
+		merged[nodeID] = max(merged[nodeID], n)
+	}
+	return merged
+}
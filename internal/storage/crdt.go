@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"sort"
+
+	"github.com/amirderis/DHT/internal/clock"
+)
+
+// Besides Counter, a value may hold an ORSet or an LWWMap. Like a counter,
+// each is a state that replicas merge with the one they hold whatever the
+// versions of the two, so concurrent writes of it never become siblings.
+
+const (
+	orSetMagic  = "\x00dht-orset\x00"
+	lwwMapMagic = "\x00dht-lwwmap\x00"
+)
+
+// Converges reports whether value holds a Counter, ORSet or LWWMap, which
+// replicas merge rather than overwrite.
+func Converges(value []byte) bool {
+	return IsCounter(value) || IsORSet(value) || IsLWWMap(value)
+}
+
+// mergeConverging returns the merge of two live values that both hold the
+// same converging type, and false for any other pair.
+func mergeConverging(a, b *VersionedValue) ([]byte, bool) {
+	if a.Tombstone || b.Tombstone {
+		return nil, false
+	}
+	switch {
+	case IsCounter(a.Value) && IsCounter(b.Value):
+		ca, errA := DecodeCounter(a.Value)
+		cb, errB := DecodeCounter(b.Value)
+		if errA == nil && errB == nil {
+			return ca.Merge(cb).Encode(), true
+		}
+	case IsORSet(a.Value) && IsORSet(b.Value):
+		sa, errA := DecodeORSet(a.Value)
+		sb, errB := DecodeORSet(b.Value)
+		if errA == nil && errB == nil {
+			return sa.Merge(sb).Encode(), true
+		}
+	case IsLWWMap(a.Value) && IsLWWMap(b.Value):
+		ma, errA := DecodeLWWMap(a.Value)
+		mb, errB := DecodeLWWMap(b.Value)
+		if errA == nil && errB == nil {
+			return ma.Merge(mb).Encode(), true
+		}
+	}
+	return nil, false
+}
+
+// ORSet is an observed-remove set of strings. Every add of an element is
+// tagged uniquely, and a remove only removes the tags it observed, so an
+// add concurrent with a remove of the same element wins.
+type ORSet struct {
+	// Adds and Removes map each element to its add tags and to those of
+	// them that were removed.
+	Adds    map[string][]string `json:"adds,omitempty"`
+	Removes map[string][]string `json:"removes,omitempty"`
+}
+
+// IsORSet reports whether a stored value holds an ORSet.
+func IsORSet(value []byte) bool {
+	return bytes.HasPrefix(value, []byte(orSetMagic))
+}
+
+// DecodeORSet parses a value stored by ORSet.Encode.
+func DecodeORSet(value []byte) (ORSet, error) {
+	var s ORSet
+	err := json.Unmarshal(bytes.TrimPrefix(value, []byte(orSetMagic)), &s)
+	return s, err
+}
+
+// Encode returns the value that stores s.
+func (s ORSet) Encode() []byte {
+	data, _ := json.Marshal(s)
+	return append([]byte(orSetMagic), data...)
+}
+
+// Contains reports whether element has an add that was not removed.
+func (s ORSet) Contains(element string) bool {
+	for _, tag := range s.Adds[element] {
+		if !slices.Contains(s.Removes[element], tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Elements returns the elements of s in sorted order.
+func (s ORSet) Elements() []string {
+	elements := []string{}
+	for element := range s.Adds {
+		if s.Contains(element) {
+			elements = append(elements, element)
+		}
+	}
+	sort.Strings(elements)
+	return elements
+}
+
+// Add adds element under tag, which no other add may share.
+func (s *ORSet) Add(element, tag string) {
+	if s.Adds == nil {
+		s.Adds = make(map[string][]string)
+	}
+	s.Adds[element] = append(s.Adds[element], tag)
+}
+
+// Remove removes every add of element that s holds.
+func (s *ORSet) Remove(element string) {
+	if s.Removes == nil {
+		s.Removes = make(map[string][]string)
+	}
+	s.Removes[element] = mergeTags(s.Removes[element], s.Adds[element])
+}
+
+// Merge returns the set holding every add and remove of s and other.
+func (s ORSet) Merge(other ORSet) ORSet {
+	return ORSet{Adds: mergeTagSets(s.Adds, other.Adds), Removes: mergeTagSets(s.Removes, other.Removes)}
+}
+
+func mergeTagSets(a, b map[string][]string) map[string][]string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	merged := make(map[string][]string, len(a)+len(b))
+	for element, tags := range a {
+		merged[element] = mergeTags(nil, tags)
+	}
+	for element, tags := range b {
+		merged[element] = mergeTags(merged[element], tags)
+	}
+	return merged
+}
+
+// mergeTags returns the sorted union of two lists of tags.
+func mergeTags(a, b []string) []string {
+	merged := append(slices.Clone(a), b...)
+	slices.Sort(merged)
+	return slices.Compact(merged)
+}
+
+// LWWMap is a map of JSON values in which every field is written and
+// deleted on its own: of two writes of a field, the one with the later
+// timestamp wins, ties going to the higher node ID.
+type LWWMap struct {
+	Fields map[string]LWWField `json:"fields,omitempty"`
+}
+
+// LWWField is the last write of a field of an LWWMap. A deleted field
+// keeps its timestamp so that older writes of it stay overridden.
+type LWWField struct {
+	Value     json.RawMessage `json:"value,omitempty"`
+	Timestamp clock.Timestamp `json:"timestamp"`
+	Node      string          `json:"node"`
+	Deleted   bool            `json:"deleted,omitempty"`
+}
+
+// after reports whether f was written after other.
+func (f LWWField) after(other LWWField) bool {
+	if f.Timestamp != other.Timestamp {
+		return other.Timestamp.Before(f.Timestamp)
+	}
+	return f.Node > other.Node
+}
+
+// IsLWWMap reports whether a stored value holds an LWWMap.
+func IsLWWMap(value []byte) bool {
+	return bytes.HasPrefix(value, []byte(lwwMapMagic))
+}
+
+// DecodeLWWMap parses a value stored by LWWMap.Encode.
+func DecodeLWWMap(value []byte) (LWWMap, error) {
+	var m LWWMap
+	err := json.Unmarshal(bytes.TrimPrefix(value, []byte(lwwMapMagic)), &m)
+	return m, err
+}
+
+// Encode returns the value that stores m.
+func (m LWWMap) Encode() []byte {
+	data, _ := json.Marshal(m)
+	return append([]byte(lwwMapMagic), data...)
+}
+
+// Live returns the fields of m that are not deleted, with their values.
+func (m LWWMap) Live() map[string]json.RawMessage {
+	live := make(map[string]json.RawMessage)
+	for name, f := range m.Fields {
+		if !f.Deleted {
+			live[name] = f.Value
+		}
+	}
+	return live
+}
+
+// Set writes a field, unless it already holds a later write.
+func (m *LWWMap) Set(name string, f LWWField) {
+	if m.Fields == nil {
+		m.Fields = make(map[string]LWWField)
+	}
+	if current, ok := m.Fields[name]; !ok || f.after(current) {
+		m.Fields[name] = f
+	}
+}
+
+// Merge returns the map holding the later write of every field of m and other.
+func (m LWWMap) Merge(other LWWMap) LWWMap {
+	var merged LWWMap
+	for name, f := range m.Fields {
+		merged.Set(name, f)
+	}
+	for name, f := range other.Fields {
+		merged.Set(name, f)
+	}
+	return merged
+}
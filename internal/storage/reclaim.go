@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Under memory pressure an InMemory store first reclaims data no reader can
+// see any more before it evicts live entries: expired values, found through
+// a TTL index ordered by expiry, and then tombstones older than the
+// tombstone grace period, oldest deletion first. ReapExpired drains the
+// same TTL index.
+
+// ttlIndex is a min-heap of the entries that expire, soonest first.
+type ttlIndex []*entry
+
+func (h ttlIndex) Len() int           { return len(h) }
+func (h ttlIndex) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+
+func (h ttlIndex) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].ttlIndex = i
+	h[j].ttlIndex = j
+}
+
+func (h *ttlIndex) Push(x any) {
+	e := x.(*entry)
+	e.ttlIndex = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *ttlIndex) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	e.ttlIndex = -1
+	return e
+}
+
+// index adds a newly stored entry to the TTL index and the tombstone queue.
+// Callers must hold s.mu.
+func (s *InMemory) index(e *entry) {
+	e.ttlIndex = -1
+	if !e.expiresAt.IsZero() {
+		heap.Push(&s.ttl, e)
+	}
+	if e.tombstone {
+		e.tombstone = false
+		s.markTombstone(e)
+	}
+}
+
+// unindex drops a removed entry from the TTL index and the tombstone queue.
+// Callers must hold s.mu.
+func (s *InMemory) unindex(e *entry) {
+	if e.ttlIndex >= 0 {
+		heap.Remove(&s.ttl, e.ttlIndex)
+	}
+	if e.deleted != nil {
+		s.tombstones.Remove(e.deleted)
+		e.deleted = nil
+	}
+}
+
+// markTombstone turns e into a tombstone deleted now. Callers must hold s.mu.
+func (s *InMemory) markTombstone(e *entry) {
+	if e.tombstone {
+		return
+	}
+	e.tombstone = true
+	e.deletedAt = time.Now()
+	e.deleted = s.tombstones.PushBack(e)
+}
+
+// nextExpired returns the entry of the TTL index that expired first, if
+// any has. Callers must hold s.mu.
+func (s *InMemory) nextExpired(now time.Time) (*entry, bool) {
+	if len(s.ttl) == 0 || !s.ttl[0].expired(now) {
+		return nil, false
+	}
+	return s.ttl[0], true
+}
+
+// nextCollectable returns the oldest tombstone past the grace period, if
+// any. A zero grace period keeps tombstones. Callers must hold s.mu.
+func (s *InMemory) nextCollectable(now time.Time) (*entry, bool) {
+	if s.limits.TombstoneGrace <= 0 || s.tombstones.Len() == 0 {
+		return nil, false
+	}
+	e := s.tombstones.Front().Value.(*entry)
+	if now.Sub(e.deletedAt) < s.limits.TombstoneGrace {
+		return nil, false
+	}
+	return e, true
+}
+
+// purge removes expired entries, then collectable tombstones, until the
+// store is within its limits or nothing is left to reclaim. Callers must
+// hold s.mu.
+func (s *InMemory) purge(now time.Time) {
+	for s.overLimits() {
+		e, ok := s.nextExpired(now)
+		if !ok {
+			e, ok = s.nextCollectable(now)
+		}
+		if !ok {
+			return
+		}
+		s.removeElement(s.data[e.key])
+		s.purges++
+	}
+}
@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"container/list"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultShards is the shard count used by the node's in-memory store.
+const DefaultShards = 32
+
+// Sharded spreads keys over several InMemory stores by key hash so that
+// writes to different keys rarely contend on the same lock. Limits apply to
+// the shards together: a write that takes the store over them purges what
+// readers cannot see from every shard, then evicts the least recently used
+// entries across shards.
+type Sharded struct {
+	shards []*InMemory
+	limits Limits
+	usage  *usage
+	closed atomic.Bool // set by closing the versioned view
+}
+
+// usage is the size of a Sharded store, kept by its shards as they change,
+// and the clock that orders their entries by last use.
+type usage struct {
+	keys  atomic.Int64
+	bytes atomic.Int64
+	clock atomic.Uint64
+}
+
+var _ Engine = (*Sharded)(nil)
+
+func NewSharded(shards int) *Sharded {
+	return NewShardedWithLimits(shards, Limits{})
+}
+
+func NewShardedWithLimits(shards int, limits Limits) *Sharded {
+	if shards <= 0 {
+		shards = DefaultShards
+	}
+	s := &Sharded{shards: make([]*InMemory, shards), limits: limits, usage: &usage{}}
+	for i := range s.shards {
+		s.shards[i] = NewInMemoryWithLimits(limits)
+		s.shards[i].usage = s.usage
+	}
+	return s
+}
+
+// evict brings the store back within its limits after a write of written,
+// which is never evicted. It runs after the write has released its shard,
+// locking one shard at a time, so a concurrent write may briefly take the
+// store over its limits until its own evict runs.
+func (s *Sharded) evict(written string) {
+	if !s.overLimits() {
+		return
+	}
+	now := time.Now()
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		shard.purge(now)
+		shard.mu.Unlock()
+	}
+	for s.overLimits() {
+		shard := s.leastRecentlyUsed(written)
+		if shard == nil {
+			return
+		}
+		shard.mu.Lock()
+		if el := evictable(shard, written); el != nil && shard.overLimits() {
+			shard.removeElement(el)
+			shard.evictions++
+		}
+		shard.mu.Unlock()
+	}
+}
+
+func (s *Sharded) overLimits() bool {
+	if s.limits.MaxKeys > 0 && s.usage.keys.Load() > int64(s.limits.MaxKeys) {
+		return true
+	}
+	return s.limits.MaxBytes > 0 && s.usage.bytes.Load() > s.limits.MaxBytes
+}
+
+// leastRecentlyUsed returns the shard whose least recently used entry,
+// other than written, was used the longest ago, or nil if all are empty.
+func (s *Sharded) leastRecentlyUsed(written string) *InMemory {
+	var oldest *InMemory
+	var used uint64
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+		if el := evictable(shard, written); el != nil && (oldest == nil || el.Value.(*entry).used < used) {
+			oldest, used = shard, el.Value.(*entry).used
+		}
+		shard.mu.Unlock()
+	}
+	return oldest
+}
+
+// evictable returns the least recently used entry of shard other than
+// written, if any. Callers must hold shard.mu.
+func evictable(shard *InMemory, written string) *list.Element {
+	el := shard.lru.Back()
+	if el != nil && el.Value.(*entry).key == written {
+		el = el.Prev()
+	}
+	return el
+}
+
+// shardIndex hashes key with FNV-1a, inlined to avoid allocating a hasher.
+func (s *Sharded) shardIndex(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % uint32(len(s.shards)))
+}
+
+func (s *Sharded) shard(key string) *InMemory {
+	return s.shards[s.shardIndex(key)]
+}
+
+func (s *Sharded) Get(key string) ([]byte, bool) {
+	return s.shard(key).Get(key)
+}
+
+func (s *Sharded) GetChecked(key string) (KeyedValue, bool, error) {
+	return s.shard(key).GetChecked(key)
+}
+
+func (s *Sharded) Put(key string, value []byte) error {
+	return s.PutWithExpiry(key, value, time.Time{})
+}
+
+func (s *Sharded) PutWithExpiry(key string, value []byte, expiresAt time.Time) error {
+	err := s.shard(key).PutWithExpiry(key, value, expiresAt)
+	s.evict(key)
+	return err
+}
+
+func (s *Sharded) Delete(key string) error {
+	return s.shard(key).Delete(key)
+}
+
+// PutBatch locks every shard the batch touches, in index order to avoid
+// deadlocking with concurrent batches, so the batch is applied atomically.
+func (s *Sharded) PutBatch(items []KeyedValue) error {
+	if len(items) == 0 {
+		return nil
+	}
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	unlock := s.lockShards(keys)
+	for _, item := range items {
+		s.shard(item.Key).put(item.Key, item.Value, item.ExpiresAt)
+	}
+	unlock()
+	s.evict(items[len(items)-1].Key)
+	return nil
+}
+
+// lockShards locks the shards of keys in index order and returns the
+// function that unlocks them.
+func (s *Sharded) lockShards(keys []string) (unlock func()) {
+	touched := make([]bool, len(s.shards))
+	for _, key := range keys {
+		touched[s.shardIndex(key)] = true
+	}
+	for i, t := range touched {
+		if t {
+			s.shards[i].mu.Lock()
+		}
+	}
+	return func() {
+		for i, t := range touched {
+			if t {
+				s.shards[i].mu.Unlock()
+			}
+		}
+	}
+}
+
+func (s *Sharded) ReapExpired() int {
+	removed := 0
+	for _, shard := range s.shards {
+		removed += shard.ReapExpired()
+	}
+	return removed
+}
+
+func (s *Sharded) Len() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+func (s *Sharded) Evictions() uint64 {
+	var n uint64
+	for _, shard := range s.shards {
+		n += shard.Evictions()
+	}
+	return n
+}
+
+func (s *Sharded) Purges() uint64 {
+	var n uint64
+	for _, shard := range s.shards {
+		n += shard.Purges()
+	}
+	return n
+}
+
+func (s *Sharded) Scan(prefix, cursor string, limit int) ([]string, string) {
+	keys := make([]string, 0)
+	for _, shard := range s.shards {
+		shardKeys, _ := shard.Scan(prefix, cursor, 0)
+		keys = append(keys, shardKeys...)
+	}
+	return paginate(keys, limit)
+}
+
+// Snapshot holds every shard's lock while copying so the result reflects a
+// single point in time across shards.
+func (s *Sharded) Snapshot(prefix string) []KeyedValue {
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+	}
+	now := time.Now()
+	var items []KeyedValue
+	for _, shard := range s.shards {
+		items = shard.snapshotLocked(prefix, now, items)
+	}
+	for _, shard := range s.shards {
+		shard.mu.Unlock()
+	}
+	sortByKey(items)
+	return items
+}
+
+func (s *Sharded) Stats() Stats {
+	total := Stats{Namespaces: make(map[string]NamespaceStats)}
+	for _, shard := range s.shards {
+		st := shard.Stats()
+		total.Keys += st.Keys
+		total.Bytes += st.Bytes
+		total.Tombstones += st.Tombstones
+		for name, ns := range st.Namespaces {
+			sum := total.Namespaces[name]
+			sum.Keys += ns.Keys
+			sum.Bytes += ns.Bytes
+			sum.Tombstones += ns.Tombstones
+			total.Namespaces[name] = sum
+		}
+	}
+	return total
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+)
+
+func TestShardedBasicOperations(t *testing.T) {
+	s := NewSharded(4)
+	for i := range 20 {
+		s.Put("key/"+strconv.Itoa(i), []byte(strconv.Itoa(i)))
+	}
+	if v, found := s.Get("key/7"); !found || string(v) != "7" {
+		t.Errorf("Expected key/7=7, got %q, %v", v, found)
+	}
+	s.Delete("key/7")
+	if _, found := s.Get("key/7"); found {
+		t.Error("Expected deleted key to be gone")
+	}
+	if n := s.Len(); n != 19 {
+		t.Errorf("Expected 19 keys, got %d", n)
+	}
+	if st := s.Stats(); st.Keys != 19 || st.Namespaces["key"].Keys != 19 {
+		t.Errorf("Expected stats across shards to add up to 19 keys, got %+v", st)
+	}
+}
+
+func TestShardedScanAcrossShards(t *testing.T) {
+	s := NewSharded(4)
+	for _, k := range []string{"user/3", "user/1", "order/1", "user/2", "user/4"} {
+		s.Put(k, []byte("v"))
+	}
+
+	keys, next := s.Scan("user/", "", 3)
+	if len(keys) != 3 || keys[0] != "user/1" || keys[2] != "user/3" {
+		t.Fatalf("Expected [user/1 user/2 user/3], got %v", keys)
+	}
+	keys, next = s.Scan("user/", next, 3)
+	if len(keys) != 1 || keys[0] != "user/4" || next != "" {
+		t.Errorf("Expected final page [user/4], got %v, %q", keys, next)
+	}
+}
+
+func TestShardedPutBatchAndLimits(t *testing.T) {
+	s := NewShardedWithLimits(2, Limits{MaxKeys: 10})
+	items := make([]KeyedValue, 0, 8)
+	for i := range 8 {
+		items = append(items, KeyedValue{Key: strconv.Itoa(i), Value: []byte("v")})
+	}
+	items = append(items, KeyedValue{Key: "expired", Value: []byte("v"), ExpiresAt: time.Now().Add(-time.Second)})
+	if err := s.PutBatch(items); err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	if n := s.Len(); n != 8 {
+		t.Errorf("Expected 8 live keys, got %d", n)
+	}
+	if removed := s.ReapExpired(); removed != 1 {
+		t.Errorf("Expected 1 reaped key, got %d", removed)
+	}
+
+	for i := range 100 {
+		s.Put("more/"+strconv.Itoa(i), []byte("v"))
+	}
+	if n := s.Len(); n > 10 {
+		t.Errorf("Expected at most 10 keys across shards, got %d", n)
+	}
+	if s.Evictions() == 0 {
+		t.Error("Expected evictions once over the limit")
+	}
+}
+
+func TestShardedLimitsApplyAcrossShards(t *testing.T) {
+	s := NewShardedWithLimits(DefaultShards, Limits{MaxKeys: 10, MaxBytes: 200})
+	for i := range 100 {
+		s.Put("key/"+strconv.Itoa(i), []byte("v"))
+	}
+	if n := s.Len(); n != 10 {
+		t.Errorf("Expected MaxKeys to hold across %d shards, got %d keys", DefaultShards, n)
+	}
+	// Eviction is least recently used across shards
+	s.Get("key/90")
+	s.Put("key/100", []byte("v"))
+	for _, key := range []string{"key/90", "key/92", "key/99", "key/100"} {
+		if _, found := s.Get(key); !found {
+			t.Errorf("Expected recently used %s to be kept", key)
+		}
+	}
+	if _, found := s.Get("key/91"); found {
+		t.Errorf("Expected the least recently used key/91 to be evicted")
+	}
+
+	for i := range 10 {
+		s.Put("big/"+strconv.Itoa(i), make([]byte, 50))
+	}
+	if st := s.Stats(); st.Bytes > 200 {
+		t.Errorf("Expected MaxBytes to hold across shards, got %d bytes", st.Bytes)
+	}
+}
+
+// Run with -cpu=1,8,16 to compare lock contention as cores are added.
+func BenchmarkParallelPut(b *testing.B) {
+	engines := []struct {
+		name   string
+		engine Engine
+	}{
+		{"InMemory", NewInMemory()},
+		{"Sharded", NewSharded(DefaultShards)},
+	}
+	value := []byte("value")
+	for _, e := range engines {
+		b.Run(e.name, func(b *testing.B) {
+			var worker atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				prefix := strconv.FormatInt(worker.Add(1), 10) + "/"
+				i := 0
+				for pb.Next() {
+					e.engine.Put(prefix+strconv.Itoa(i%1024), value)
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestShardedSnapshot(t *testing.T) {
+	s := NewSharded(4)
+	for _, k := range []string{"user/2", "user/1", "order/1"} {
+		s.Put(k, []byte(k))
+	}
+
+	items := s.Snapshot("user/")
+	s.Put("user/1", []byte("changed"))
+	if len(items) != 2 || items[0].Key != "user/1" || string(items[0].Value) != "user/1" || items[1].Key != "user/2" {
+		t.Errorf("Expected sorted copies of user/1 and user/2, got %+v", items)
+	}
+}
+
+func TestShardedVersionedView(t *testing.T) {
+	s := NewSharded(4)
+	v := s.Versioned()
+
+	if err := v.PutVersioned("key", NewVersionedValue([]byte("v2"), clock.VectorClock{"a": 2})); err != nil {
+		t.Fatalf("Failed to put versioned value: %v", err)
+	}
+	if err := v.PutVersioned("key", NewVersionedValue([]byte("v1"), clock.VectorClock{"a": 1})); !errors.Is(err, ErrStaleVersion) {
+		t.Errorf("Expected ErrStaleVersion for an older clock, got %v", err)
+	}
+	item, ok, err := s.GetChecked("key")
+	if err != nil || !ok || string(item.Value) != "v2" || item.Version["a"] != 2 {
+		t.Errorf("Expected the engine view to see v2 with its clock, got %+v, %v, %v", item, ok, err)
+	}
+
+	if err := v.DeleteVersioned("key"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, ok := s.Get("key"); ok {
+		t.Errorf("Expected a tombstone to read as missing through the engine view")
+	}
+	if got, ok := v.GetVersioned("key"); !ok || !got.Tombstone {
+		t.Errorf("Expected the versioned view to return the tombstone, got %+v", got)
+	}
+	if st := s.Stats(); st.Keys != 0 || st.Tombstones != 1 {
+		t.Errorf("Expected one tombstone and no keys, got %+v", st)
+	}
+}
+
+func TestShardedCollapsesSiblingsPastLimit(t *testing.T) {
+	v := NewShardedWithLimits(4, Limits{MaxSiblings: 1}).Versioned()
+	first := NewVersionedValue([]byte("first"), clock.VectorClock{"node1": 1})
+	second := NewVersionedValue([]byte("second"), clock.VectorClock{"node2": 1})
+	second.Timestamp = first.Timestamp.Add(time.Second)
+	v.PutVersioned("key", second)
+	v.PutVersioned("key", first)
+
+	got, _ := v.GetVersioned("key")
+	if string(got.Value) != "second" || len(got.Siblings) != 0 {
+		t.Errorf("Expected the later write alone, got %q with %+v", got.Value, got.Siblings)
+	}
+	if !clock.Equal(got.Version, clock.VectorClock{"node1": 1, "node2": 1}) {
+		t.Errorf("Expected a clock merging both writes, got %s", got.Version)
+	}
+}
+
+func TestShardedPurgesTombstonesPastGrace(t *testing.T) {
+	s := NewShardedWithLimits(1, Limits{MaxKeys: 2, TombstoneGrace: time.Millisecond})
+	v := s.Versioned()
+	s.Put("b", []byte("2"))
+	s.Put("a", []byte("1"))
+	v.DeleteVersioned("a")
+
+	// The tombstone is still within its grace period, so live b goes first
+	s.Put("c", []byte("3"))
+	if _, found := s.Get("b"); found || s.Evictions() != 1 {
+		t.Errorf("Expected b to be evicted, got %d evictions", s.Evictions())
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	s.Put("d", []byte("4"))
+	if _, ok := v.GetVersioned("a"); ok {
+		t.Errorf("Expected the tombstone for a to be purged")
+	}
+	if _, found := s.Get("c"); !found {
+		t.Errorf("Expected live key c to survive")
+	}
+	if s.Purges() != 1 || s.Evictions() != 1 {
+		t.Errorf("Expected 1 purge and 1 eviction, got %d purges and %d evictions", s.Purges(), s.Evictions())
+	}
+}
@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"fmt"
+	"hash/crc32"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+)
+
+var _ VersionedEngine = (*shardedVersioned)(nil)
+
+// Versioned returns a VersionedEngine over the same shards, for writes that
+// carry vector clocks. Both views see the same keys: values written through
+// the Engine interface carry an empty clock, and tombstones left by
+// DeleteVersioned read as missing through it.
+func (s *Sharded) Versioned() VersionedEngine {
+	return &shardedVersioned{s}
+}
+
+type shardedVersioned struct {
+	s *Sharded
+}
+
+// versionedLocked returns a copy of the entry for key, including a
+// tombstone. Callers must hold s.mu.
+func (s *InMemory) versionedLocked(key string, now time.Time) (*VersionedValue, bool) {
+	el, ok := s.data[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if e.expired(now) {
+		return nil, false
+	}
+	value := make([]byte, len(e.value))
+	copy(value, e.value)
+	return &VersionedValue{
+		Value:       value,
+		Version:     e.version.Copy(),
+		Timestamp:   e.updatedAt,
+		Tombstone:   e.tombstone,
+		ExpiresAt:   e.expiresAt,
+		Checksum:    e.checksum,
+		ContentType: e.contentType,
+		Meta:        maps.Clone(e.meta),
+		Siblings:    copySiblings(e.siblings),
+	}, true
+}
+
+// context merges the clocks of e and its siblings.
+func (e *entry) context() clock.VectorClock {
+	context := e.version.Copy()
+	for _, sibling := range e.siblings {
+		context = context.Merge(sibling.Version)
+	}
+	return context
+}
+
+// putVersionedLocked stores a resolved value. Callers must hold s.mu.
+func (s *InMemory) putVersionedLocked(key string, vv *VersionedValue) {
+	updatedAt := vv.Timestamp
+	if updatedAt.IsZero() {
+		updatedAt = time.Now()
+	}
+	s.store(&entry{
+		key:         key,
+		value:       vv.Value,
+		expiresAt:   vv.ExpiresAt,
+		updatedAt:   updatedAt,
+		checksum:    crc32.ChecksumIEEE(vv.Value),
+		version:     vv.Version.Copy(),
+		tombstone:   vv.Tombstone,
+		contentType: vv.ContentType,
+		meta:        maps.Clone(vv.Meta),
+		siblings:    copySiblings(vv.Siblings),
+	})
+}
+
+// resolveLocked is resolveWrite against the live value held for key.
+// Callers must hold s.mu.
+func (s *InMemory) resolveLocked(key string, incoming *VersionedValue) (*VersionedValue, error) {
+	current, ok := s.versionedLocked(key, time.Now())
+	if !ok {
+		current = nil
+	}
+	return resolveWrite(key, current, incoming, s.limits)
+}
+
+func (v *shardedVersioned) GetVersioned(key string) (*VersionedValue, bool) {
+	val, err := v.GetVersionedChecked(key)
+	if err != nil {
+		return nil, false
+	}
+	return val, true
+}
+
+func (v *shardedVersioned) GetVersionedChecked(key string) (*VersionedValue, error) {
+	shard := v.s.shard(key)
+	shard.mu.Lock()
+	value, ok := shard.versionedLocked(key, time.Now())
+	shard.mu.Unlock()
+	if !ok || v.s.closed.Load() {
+		return nil, fmt.Errorf("key %s: %w", key, ErrNotFound)
+	}
+	if err := value.Verify(); err != nil {
+		return nil, fmt.Errorf("key %s: %w", key, err)
+	}
+	return value, nil
+}
+
+func (v *shardedVersioned) PutVersioned(key string, value *VersionedValue) error {
+	if value == nil {
+		return fmt.Errorf("cannot store nil versioned value")
+	}
+	if v.s.closed.Load() {
+		return ErrClosed
+	}
+	shard := v.s.shard(key)
+	shard.mu.Lock()
+	resolved, err := shard.resolveLocked(key, value)
+	if err == nil {
+		shard.putVersionedLocked(key, resolved)
+	}
+	shard.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	v.s.evict(key)
+	return nil
+}
+
+// PutBatch stores every item or, if any item is stale, none of them. Shards
+// are locked in index order like Sharded.PutBatch.
+func (v *shardedVersioned) PutBatch(items []KeyedVersionedValue) error {
+	for _, item := range items {
+		if item.Value == nil {
+			return fmt.Errorf("cannot store nil versioned value for key %s", item.Key)
+		}
+	}
+	if v.s.closed.Load() {
+		return ErrClosed
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	unlock := v.s.lockShards(keys)
+	resolved := make([]*VersionedValue, len(items))
+	for i, item := range items {
+		r, err := v.s.shard(item.Key).resolveLocked(item.Key, item.Value)
+		if err != nil {
+			unlock()
+			return err
+		}
+		resolved[i] = r
+	}
+	for i, item := range items {
+		v.s.shard(item.Key).putVersionedLocked(item.Key, resolved[i])
+	}
+	unlock()
+	v.s.evict(items[len(items)-1].Key)
+	return nil
+}
+
+// DeleteVersioned leaves a tombstone under the key's current clock.
+func (v *shardedVersioned) DeleteVersioned(key string) error {
+	if v.s.closed.Load() {
+		return ErrClosed
+	}
+	shard := v.s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	el, ok := shard.data[key]
+	if !ok {
+		return fmt.Errorf("key %s not found", key)
+	}
+	shard.markTombstone(el.Value.(*entry))
+	return nil
+}
+
+func (v *shardedVersioned) ReapExpired() int {
+	return v.s.ReapExpired()
+}
+
+func (v *shardedVersioned) Scan(prefix, cursor string, limit int) ([]ScanEntry, string) {
+	now := time.Now()
+	byKey := make(map[string]ScanEntry)
+	keys := make([]string, 0)
+	for _, shard := range v.s.shards {
+		shard.mu.Lock()
+		for k, el := range shard.data {
+			e := el.Value.(*entry)
+			if k > cursor && strings.HasPrefix(k, prefix) && !e.expired(now) {
+				keys = append(keys, k)
+				byKey[k] = ScanEntry{Key: k, Version: e.context(), Tombstone: e.tombstone, Timestamp: e.updatedAt, ExpiresAt: e.expiresAt, Checksum: e.checksum, Siblings: len(e.siblings)}
+			}
+		}
+		shard.mu.Unlock()
+	}
+
+	keys, next := paginate(keys, limit)
+	page := make([]ScanEntry, 0, len(keys))
+	for _, k := range keys {
+		page = append(page, byKey[k])
+	}
+	return page, next
+}
+
+func (v *shardedVersioned) Sample(n int) ([]SampleEntry, int) {
+	now := time.Now()
+	r := newReservoir(n)
+	for _, shard := range v.s.shards {
+		shard.mu.Lock()
+		for k, el := range shard.data {
+			e := el.Value.(*entry)
+			if e.tombstone || e.expired(now) {
+				continue
+			}
+			if i := r.slot(); i >= 0 {
+				r.items[i] = SampleEntry{Key: k, Size: len(e.value), Version: e.version.Copy()}
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return r.items, r.seen
+}
+
+func (v *shardedVersioned) Stats() Stats {
+	return v.s.Stats()
+}
+
+func (v *shardedVersioned) Tombstones(prefix string, limit int) ([]TombstoneEntry, int) {
+	now := time.Now()
+	entries := make([]TombstoneEntry, 0)
+	for _, shard := range v.s.shards {
+		shard.mu.Lock()
+		for el := shard.tombstones.Front(); el != nil; el = el.Next() {
+			e := el.Value.(*entry)
+			if strings.HasPrefix(e.key, prefix) && !e.expired(now) {
+				entries = append(entries, TombstoneEntry{Key: e.key, Version: e.version.Copy(), DeletedAt: e.deletedAt})
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return sortTombstones(entries, limit), len(entries)
+}
+
+// PurgeTombstones walks each shard's tombstones oldest deletion first, so
+// it stops at the first one deleted too recently.
+func (v *shardedVersioned) PurgeTombstones(prefix string, olderThan time.Duration) int {
+	now := time.Now()
+	removed := 0
+	for _, shard := range v.s.shards {
+		shard.mu.Lock()
+		for el := shard.tombstones.Front(); el != nil; {
+			e := el.Value.(*entry)
+			if now.Sub(e.deletedAt) < olderThan {
+				break
+			}
+			el = el.Next()
+			if strings.HasPrefix(e.key, prefix) {
+				shard.removeElement(shard.data[e.key])
+				removed++
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return removed
+}
+
+// Close makes later versioned writes fail with ErrClosed and reads report
+// not found. The Engine view is unaffected.
+func (v *shardedVersioned) Close() error {
+	v.s.closed.Store(true)
+	return nil
+}
@@ -1,48 +1,478 @@
 package storage
 
-import "sync"
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"maps"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/clock"
+)
+
+// ErrCorrupt reports a stored value that no longer matches its checksum.
+var ErrCorrupt = errors.New("stored value failed checksum verification")
 
 type Engine interface {
+	// Get returns a copy of the value for key. Corrupt values are treated as missing.
 	Get(key string) (value []byte, ok bool)
+	// GetChecked is Get but also returns the expiry and reports ErrCorrupt
+	// when the stored value fails checksum verification.
+	GetChecked(key string) (item KeyedValue, ok bool, err error)
 	Put(key string, value []byte) error
+	// PutWithExpiry stores a value that reads treat as missing once expiresAt
+	// has passed. A zero expiresAt means the value never expires.
+	PutWithExpiry(key string, value []byte, expiresAt time.Time) error
 	Delete(key string) error
+	// ReapExpired physically removes expired entries and returns how many were removed.
+	ReapExpired() int
+	// Len returns the number of live (unexpired) keys.
+	Len() int
+	// Evictions returns how many live entries were evicted to stay within memory bounds.
+	Evictions() uint64
+	// Purges returns how many expired entries and tombstones were dropped
+	// to stay within memory bounds before live entries had to be evicted.
+	Purges() uint64
+	// Scan returns up to limit live keys with the given prefix that sort after
+	// cursor, in ascending order, plus the cursor for the next page. The next
+	// cursor is empty once the scan is complete.
+	Scan(prefix, cursor string, limit int) (keys []string, next string)
+	// Snapshot copies every live entry with the given prefix at a single
+	// point in time, sorted by key.
+	Snapshot(prefix string) []KeyedValue
+	// PutBatch applies all writes atomically with respect to other operations.
+	PutBatch(items []KeyedValue) error
+	// Stats summarizes the live data held by the engine.
+	Stats() Stats
+}
+
+// Store is an engine together with a versioned view over the same keys,
+// which is what a node serves from.
+type Store interface {
+	Engine
+	Versioned() VersionedEngine
+}
+
+var _ Store = (*Sharded)(nil)
+
+// Stats describes the live data in an engine. Namespaces break the totals
+// down by the part of the key before the first "/" ("" for keys without one).
+type Stats struct {
+	Keys       int
+	Bytes      int64 // logical key plus value bytes
+	Tombstones int
+	Namespaces map[string]NamespaceStats
+}
+
+// NamespaceStats is the share of Stats belonging to one namespace.
+type NamespaceStats struct {
+	Keys       int
+	Bytes      int64
+	Tombstones int
+}
+
+// Namespace returns the namespace a key is accounted under in Stats.
+func Namespace(key string) string {
+	ns, _, found := strings.Cut(key, "/")
+	if !found {
+		return ""
+	}
+	return ns
+}
+
+// add accounts one entry under its namespace.
+func (st *Stats) add(key string, size int64, tombstone bool) {
+	if st.Namespaces == nil {
+		st.Namespaces = make(map[string]NamespaceStats)
+	}
+	ns := st.Namespaces[Namespace(key)]
+	if tombstone {
+		st.Tombstones++
+		ns.Tombstones++
+	} else {
+		st.Keys++
+		ns.Keys++
+	}
+	st.Bytes += size
+	ns.Bytes += size
+	st.Namespaces[Namespace(key)] = ns
+}
+
+// KeyedValue is a single write in a batch.
+type KeyedValue struct {
+	Key       string
+	Value     []byte
+	ExpiresAt time.Time
+	// UpdatedAt is when the value was written and Version the vector clock
+	// it was written with through the versioned view. Reads fill them in;
+	// writes ignore them.
+	UpdatedAt time.Time
+	Version   clock.VectorClock
+	// ContentType and Meta are those the value was written with.
+	ContentType string
+	Meta        map[string]string
+	// Siblings are the versions stored alongside the value through the
+	// versioned view. Reads fill them in; writes ignore them.
+	Siblings []*VersionedValue
+}
+
+type entry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+	updatedAt time.Time
+	checksum  uint32            // CRC32 of value
+	version   clock.VectorClock // empty unless written through the versioned view
+	tombstone bool
+	// contentType and meta describe the value; see VersionedValue
+	contentType string
+	meta        map[string]string
+	siblings    []*VersionedValue // concurrent versions; see VersionedValue
+	deletedAt   time.Time         // when the entry became a tombstone
+	deleted     *list.Element     // in InMemory.tombstones while a tombstone
+	ttlIndex    int               // position in InMemory.ttl, -1 when not indexed
+	used        uint64            // usage.clock when last written or read, in a shard
+}
+
+// keyed returns the entry as a KeyedValue holding value, a copy of its value.
+func (e *entry) keyed(value []byte) KeyedValue {
+	return KeyedValue{
+		Key:         e.key,
+		Value:       value,
+		ExpiresAt:   e.expiresAt,
+		UpdatedAt:   e.updatedAt,
+		Version:     e.version.Copy(),
+		ContentType: e.contentType,
+		Meta:        maps.Clone(e.meta),
+		Siblings:    copySiblings(e.siblings),
+	}
+}
+
+// live reports whether reads through the Engine interface see the entry.
+func (e *entry) live(now time.Time) bool {
+	return !e.tombstone && !e.expired(now)
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// Limits bounds the size of an in-memory store. A zero field means unbounded.
+type Limits struct {
+	MaxKeys  int
+	MaxBytes int64
+	// TombstoneGrace is how long a tombstone is kept before it may be
+	// dropped to make room; zero keeps tombstones until they are evicted
+	// like live entries.
+	TombstoneGrace time.Duration
+	// MaxSiblings caps the concurrent versions the versioned view keeps of
+	// a key; past it they collapse into the latest. Zero keeps them all.
+	MaxSiblings int
 }
 
 // InMemory is a simple in-memory map-backed store for development/testing.
+// When limits are set, expired entries and old tombstones are purged to
+// make room, then the least recently used entries are evicted.
 type InMemory struct {
-	mu   sync.RWMutex
-	data map[string][]byte
+	mu         sync.Mutex
+	data       map[string]*list.Element
+	lru        *list.List // front is most recently used
+	ttl        ttlIndex
+	tombstones *list.List // oldest deletion first
+	limits     Limits
+	bytes      int64
+	evictions  uint64
+	purges     uint64
+	// usage is shared by the shards of a Sharded store, whose limits apply
+	// to all of them together; nil for a store of its own.
+	usage *usage
 }
 
 func NewInMemory() *InMemory {
-	return &InMemory{data: make(map[string][]byte)}
+	return NewInMemoryWithLimits(Limits{})
+}
+
+func NewInMemoryWithLimits(limits Limits) *InMemory {
+	return &InMemory{
+		data:       make(map[string]*list.Element),
+		lru:        list.New(),
+		tombstones: list.New(),
+		limits:     limits,
+	}
 }
 
 func (s *InMemory) Get(key string) ([]byte, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	v, ok := s.data[key]
-	if !ok {
+	item, ok, err := s.GetChecked(key)
+	if err != nil {
 		return nil, false
 	}
+	return item.Value, ok
+}
+
+func (s *InMemory) GetChecked(key string) (KeyedValue, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.data[key]
+	if !ok {
+		return KeyedValue{}, false, nil
+	}
+	e := el.Value.(*entry)
+	if !e.live(time.Now()) {
+		return KeyedValue{}, false, nil
+	}
+	if crc32.ChecksumIEEE(e.value) != e.checksum {
+		return KeyedValue{}, false, fmt.Errorf("key %s: %w", key, ErrCorrupt)
+	}
+	s.lru.MoveToFront(el)
+	s.touch(e)
 	// copy to avoid external mutation
-	out := make([]byte, len(v))
-	copy(out, v)
-	return out, true
+	out := make([]byte, len(e.value))
+	copy(out, e.value)
+	return e.keyed(out), true, nil
 }
 
 func (s *InMemory) Put(key string, value []byte) error {
+	return s.PutWithExpiry(key, value, time.Time{})
+}
+
+func (s *InMemory) PutWithExpiry(key string, value []byte, expiresAt time.Time) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.put(key, value, expiresAt)
+	return nil
+}
+
+func (s *InMemory) PutBatch(items []KeyedValue) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range items {
+		s.put(item.Key, item.Value, item.ExpiresAt)
+	}
+	return nil
+}
+
+// put stores a copy of value and evicts as needed. Callers must hold s.mu.
+func (s *InMemory) put(key string, value []byte, expiresAt time.Time) {
 	v := make([]byte, len(value))
 	copy(v, value)
-	s.data[key] = v
-	return nil
+	s.store(&entry{key: key, value: v, expiresAt: expiresAt, updatedAt: time.Now(), checksum: crc32.ChecksumIEEE(v)})
+}
+
+// store replaces the entry for e.key and evicts as needed. Callers must hold s.mu.
+func (s *InMemory) store(e *entry) {
+	if el, ok := s.data[e.key]; ok {
+		s.removeElement(el)
+	}
+	s.data[e.key] = s.lru.PushFront(e)
+	s.account(1, e.size())
+	s.touch(e)
+	s.index(e)
+	// A shard leaves eviction to its Sharded store, which evicts across
+	// shards
+	if s.usage == nil {
+		s.evict()
+	}
 }
 
 func (s *InMemory) Delete(key string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.data, key)
+	if el, ok := s.data[key]; ok {
+		s.removeElement(el)
+	}
 	return nil
 }
+
+func (s *InMemory) ReapExpired() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	removed := 0
+	for e, ok := s.nextExpired(now); ok; e, ok = s.nextExpired(now) {
+		s.removeElement(s.data[e.key])
+		removed++
+	}
+	return removed
+}
+
+func (s *InMemory) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	n := 0
+	for _, el := range s.data {
+		if el.Value.(*entry).live(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// Stats reports unexpired entries. Delete removes keys outright, so only
+// deletes through the versioned view leave tombstones.
+func (s *InMemory) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	st := Stats{Namespaces: make(map[string]NamespaceStats)}
+	for key, el := range s.data {
+		e := el.Value.(*entry)
+		if !e.expired(now) {
+			st.add(key, e.size(), e.tombstone)
+		}
+	}
+	return st
+}
+
+func (s *InMemory) Evictions() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.evictions
+}
+
+func (s *InMemory) Purges() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.purges
+}
+
+func (s *InMemory) Scan(prefix, cursor string, limit int) ([]string, string) {
+	s.mu.Lock()
+	now := time.Now()
+	keys := make([]string, 0)
+	for key, el := range s.data {
+		if key > cursor && strings.HasPrefix(key, prefix) && el.Value.(*entry).live(now) {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.Unlock()
+
+	return paginate(keys, limit)
+}
+
+func (s *InMemory) Snapshot(prefix string) []KeyedValue {
+	s.mu.Lock()
+	items := s.snapshotLocked(prefix, time.Now(), nil)
+	s.mu.Unlock()
+	sortByKey(items)
+	return items
+}
+
+// snapshotLocked appends copies of the live entries with prefix to items.
+// Callers must hold s.mu.
+func (s *InMemory) snapshotLocked(prefix string, now time.Time, items []KeyedValue) []KeyedValue {
+	for key, el := range s.data {
+		e := el.Value.(*entry)
+		if !strings.HasPrefix(key, prefix) || !e.live(now) {
+			continue
+		}
+		value := make([]byte, len(e.value))
+		copy(value, e.value)
+		items = append(items, e.keyed(value))
+	}
+	return items
+}
+
+func sortByKey(items []KeyedValue) {
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+}
+
+// paginate sorts keys and truncates them to limit, returning the cursor for
+// the next page when more keys remain. A non-positive limit returns everything.
+func paginate(keys []string, limit int) ([]string, string) {
+	sort.Strings(keys)
+	if limit <= 0 || len(keys) <= limit {
+		return keys, ""
+	}
+	keys = keys[:limit]
+	return keys, keys[limit-1]
+}
+
+// reservoir draws a uniform random sample from entries seen one at a time,
+// without knowing their number in advance.
+type reservoir struct {
+	items []SampleEntry
+	n     int
+	seen  int
+}
+
+func newReservoir(n int) *reservoir {
+	return &reservoir{items: make([]SampleEntry, 0, max(n, 0)), n: n}
+}
+
+// slot returns the index the next entry takes in the sample, or -1 when
+// it is left out.
+func (r *reservoir) slot() int {
+	r.seen++
+	if len(r.items) < r.n {
+		r.items = append(r.items, SampleEntry{})
+		return len(r.items) - 1
+	}
+	if i := rand.IntN(r.seen); i < r.n {
+		return i
+	}
+	return -1
+}
+
+// evict purges what readers cannot see, then drops least recently used
+// entries until the store is within its limits. The most recently written
+// entry is never evicted. Callers must hold s.mu.
+func (s *InMemory) evict() {
+	s.purge(time.Now())
+	for s.lru.Len() > 1 && s.overLimits() {
+		s.removeElement(s.lru.Back())
+		s.evictions++
+	}
+}
+
+func (s *InMemory) overLimits() bool {
+	keys, bytes := int64(s.lru.Len()), s.bytes
+	if s.usage != nil {
+		keys, bytes = s.usage.keys.Load(), s.usage.bytes.Load()
+	}
+	if s.limits.MaxKeys > 0 && keys > int64(s.limits.MaxKeys) {
+		return true
+	}
+	return s.limits.MaxBytes > 0 && bytes > s.limits.MaxBytes
+}
+
+// account adds keys and bytes to the size of the store and of the Sharded
+// store it is a shard of. Callers must hold s.mu.
+func (s *InMemory) account(keys int, bytes int64) {
+	s.bytes += bytes
+	if s.usage != nil {
+		s.usage.keys.Add(int64(keys))
+		s.usage.bytes.Add(bytes)
+	}
+}
+
+// touch marks e as the most recently used entry across the shards of a
+// Sharded store. Callers must hold s.mu.
+func (s *InMemory) touch(e *entry) {
+	if s.usage != nil {
+		e.used = s.usage.clock.Add(1)
+	}
+}
+
+// removeElement unlinks an entry from both the map and the LRU list. Callers must hold s.mu.
+func (s *InMemory) removeElement(el *list.Element) {
+	e := s.lru.Remove(el).(*entry)
+	s.unindex(e)
+	delete(s.data, e.key)
+	s.account(-1, -e.size())
+}
+
+// size approximates the memory held by an entry as key plus value length,
+// counting the values of its siblings.
+func (e *entry) size() int64 {
+	size := int64(len(e.key) + len(e.value))
+	for _, sibling := range e.siblings {
+		size += int64(len(sibling.Value))
+	}
+	return size
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInMemoryExpiry(t *testing.T) {
+	s := NewInMemory()
+	if err := s.PutWithExpiry("expired", []byte("old"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("Failed to put expired key: %v", err)
+	}
+	if err := s.PutWithExpiry("live", []byte("new"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to put live key: %v", err)
+	}
+	s.Put("forever", []byte("value"))
+
+	if _, found := s.Get("expired"); found {
+		t.Error("Expected expired key to be treated as not found")
+	}
+	if v, found := s.Get("live"); !found || string(v) != "new" {
+		t.Errorf("Expected live key to be found with value new, got %q, %v", v, found)
+	}
+
+	if n := s.Len(); n != 2 {
+		t.Errorf("Expected 2 live keys, got %d", n)
+	}
+
+	if removed := s.ReapExpired(); removed != 1 {
+		t.Errorf("Expected 1 reaped key, got %d", removed)
+	}
+	if _, ok := s.data["expired"]; ok {
+		t.Error("Expected expired key to be physically removed")
+	}
+	if _, found := s.Get("forever"); !found {
+		t.Error("Expected key without expiry to survive reaping")
+	}
+}
+
+func TestInMemoryLRUEviction(t *testing.T) {
+	s := NewInMemoryWithLimits(Limits{MaxKeys: 2})
+	s.Put("a", []byte("1"))
+	s.Put("b", []byte("2"))
+
+	// Touch a so that b becomes the least recently used
+	s.Get("a")
+	s.Put("c", []byte("3"))
+
+	if _, found := s.Get("b"); found {
+		t.Error("Expected least recently used key b to be evicted")
+	}
+	if _, found := s.Get("a"); !found {
+		t.Error("Expected recently read key a to survive eviction")
+	}
+	if s.Evictions() != 1 {
+		t.Errorf("Expected 1 eviction, got %d", s.Evictions())
+	}
+}
+
+func TestInMemoryByteLimit(t *testing.T) {
+	s := NewInMemoryWithLimits(Limits{MaxBytes: 12})
+	s.Put("k1", []byte("aaaa"))
+	s.Put("k2", []byte("bbbb"))
+	s.Put("k1", []byte("cc"))
+
+	if s.bytes > 12 {
+		t.Errorf("Expected at most 12 bytes, got %d", s.bytes)
+	}
+	if v, found := s.Get("k1"); !found || string(v) != "cc" {
+		t.Errorf("Expected overwritten k1 to be cc, got %q, %v", v, found)
+	}
+	if s.Evictions() != 0 {
+		t.Errorf("Expected overwrite not to evict, got %d evictions", s.Evictions())
+	}
+
+	s.Put("k3", []byte("dddd"))
+	if s.Evictions() != 1 {
+		t.Errorf("Expected 1 eviction, got %d", s.Evictions())
+	}
+}
+
+func TestInMemoryPurgesExpiredBeforeEvicting(t *testing.T) {
+	s := NewInMemoryWithLimits(Limits{MaxKeys: 2})
+	s.Put("a", []byte("1"))
+	s.PutWithExpiry("b", []byte("2"), time.Now().Add(time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	s.Put("c", []byte("3"))
+
+	if _, found := s.Get("a"); !found {
+		t.Error("Expected the least recently used live key a to survive")
+	}
+	if s.Purges() != 1 || s.Evictions() != 0 {
+		t.Errorf("Expected 1 purge and no eviction, got %d purges and %d evictions", s.Purges(), s.Evictions())
+	}
+	if len(s.ttl) != 0 {
+		t.Errorf("Expected the purged key to leave the TTL index, got %d entries", len(s.ttl))
+	}
+}
+
+func TestInMemoryScan(t *testing.T) {
+	s := NewInMemory()
+	for _, k := range []string{"user/3", "user/1", "order/1", "user/2", "user/4"} {
+		s.Put(k, []byte("v"))
+	}
+	s.PutWithExpiry("user/0", []byte("v"), time.Now().Add(-time.Second))
+
+	keys, next := s.Scan("user/", "", 2)
+	if len(keys) != 2 || keys[0] != "user/1" || keys[1] != "user/2" {
+		t.Fatalf("Expected [user/1 user/2], got %v", keys)
+	}
+	if next != "user/2" {
+		t.Errorf("Expected next cursor user/2, got %q", next)
+	}
+
+	keys, next = s.Scan("user/", next, 2)
+	if len(keys) != 2 || keys[0] != "user/3" || keys[1] != "user/4" {
+		t.Fatalf("Expected [user/3 user/4], got %v", keys)
+	}
+
+	if next != "" {
+		t.Errorf("Expected empty cursor after final page, got %q", next)
+	}
+}
+
+func TestInMemoryPutBatch(t *testing.T) {
+	s := NewInMemory()
+	err := s.PutBatch([]KeyedValue{
+		{Key: "a", Value: []byte("1")},
+		{Key: "b", Value: []byte("2")},
+		{Key: "c", Value: []byte("3"), ExpiresAt: time.Now().Add(-time.Second)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	if v, found := s.Get("b"); !found || string(v) != "2" {
+		t.Errorf("Expected b=2, got %q, %v", v, found)
+	}
+	if _, found := s.Get("c"); found {
+		t.Error("Expected expired batch item to be treated as not found")
+	}
+}
+
+func TestInMemoryChecksum(t *testing.T) {
+	s := NewInMemory()
+	s.Put("k", []byte("value"))
+	if _, _, err := s.GetChecked("k"); err != nil {
+		t.Fatalf("Expected intact value to verify, got %v", err)
+	}
+
+	// Flip a byte behind the engine's back
+	s.data["k"].Value.(*entry).value[0] ^= 0xff
+
+	if _, _, err := s.GetChecked("k"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt, got %v", err)
+	}
+	if _, found := s.Get("k"); found {
+		t.Error("Expected corrupt value to be treated as not found")
+	}
+
+	s.Put("k", []byte("repaired"))
+	if item, found, err := s.GetChecked("k"); err != nil || !found || string(item.Value) != "repaired" {
+		t.Errorf("Expected overwrite to repair the value, got %q, %v, %v", item.Value, found, err)
+	}
+}
+
+func TestInMemoryStats(t *testing.T) {
+	s := NewInMemory()
+	s.Put("user/1", []byte("abc"))
+	s.Put("user/2", []byte("de"))
+	s.Put("plain", []byte("x"))
+	s.PutWithExpiry("user/3", []byte("gone"), time.Now().Add(-time.Second))
+
+	st := s.Stats()
+	if st.Keys != 3 || st.Tombstones != 0 {
+		t.Errorf("Expected 3 keys and no tombstones, got %+v", st)
+	}
+	if st.Bytes != int64(len("user/1abc")+len("user/2de")+len("plainx")) {
+		t.Errorf("Expected logical bytes of live entries, got %d", st.Bytes)
+	}
+	if ns := st.Namespaces["user"]; ns.Keys != 2 || ns.Bytes != 17 {
+		t.Errorf("Expected user namespace with 2 keys and 17 bytes, got %+v", ns)
+	}
+	if ns := st.Namespaces[""]; ns.Keys != 1 {
+		t.Errorf("Expected 1 key without a namespace, got %+v", ns)
+	}
+}
@@ -1,7 +1,13 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/amirderis/DHT/internal/clock"
@@ -13,16 +19,72 @@ type VersionedValue struct {
 	Version   clock.VectorClock `json:"version"`
 	Timestamp time.Time         `json:"timestamp"`
 	Tombstone bool
+	// ExpiresAt is the point after which the value is treated as not found.
+	// A zero value means the value never expires.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	// Checksum is the CRC32 of Value, set by Seal and checked by Verify.
+	Checksum uint32 `json:"checksum"`
+	// ContentType and Meta describe the value to the clients reading it.
+	// They are kept and replicated with it but never interpreted.
+	ContentType string            `json:"content_type,omitempty"`
+	Meta        map[string]string `json:"meta,omitempty"`
+	// Siblings are the versions of the key stored alongside this one:
+	// writes whose clocks are concurrent with it and with each other, kept
+	// until a write whose clock descends from all of them. The value itself
+	// is the latest of them by Timestamp, preferring values to tombstones.
+	Siblings []*VersionedValue `json:"siblings,omitempty"`
 }
 
 // NewVersionedValue creates a new versioned value with the given data and vector clock.
 func NewVersionedValue(value []byte, version clock.VectorClock) *VersionedValue {
-	return &VersionedValue{
+	vv := &VersionedValue{
 		Value:     value,
 		Version:   version,
 		Timestamp: time.Now(),
 		Tombstone: false,
 	}
+	vv.Seal()
+	return vv
+}
+
+// Seal records the checksum of the current value and of its siblings.
+func (vv *VersionedValue) Seal() {
+	vv.Checksum = crc32.ChecksumIEEE(vv.Value)
+	for _, sibling := range vv.Siblings {
+		sibling.Seal()
+	}
+}
+
+// Verify returns ErrCorrupt if the value or one of its siblings no longer
+// matches its checksum.
+func (vv *VersionedValue) Verify() error {
+	if crc32.ChecksumIEEE(vv.Value) != vv.Checksum {
+		return ErrCorrupt
+	}
+	for _, sibling := range vv.Siblings {
+		if err := sibling.Verify(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Versions returns the value and its siblings, the value first, each
+// without siblings of its own.
+func (vv *VersionedValue) Versions() []*VersionedValue {
+	own := *vv
+	own.Siblings = nil
+	return append([]*VersionedValue{&own}, vv.Siblings...)
+}
+
+// Context merges the clocks of the value and its siblings: a write under a
+// clock descending from it supersedes all of them.
+func (vv *VersionedValue) Context() clock.VectorClock {
+	context := vv.Version.Copy()
+	for _, sibling := range vv.Siblings {
+		context = context.Merge(sibling.Version)
+	}
+	return context
 }
 
 // Copy creates a deep copy of the versioned value.
@@ -36,11 +98,33 @@ func (vv *VersionedValue) Copy() *VersionedValue {
 	copy(valueCopy, vv.Value)
 
 	return &VersionedValue{
-		Value:     valueCopy,
-		Version:   vv.Version.Copy(),
-		Timestamp: vv.Timestamp,
-		Tombstone: vv.Tombstone,
+		Value:       valueCopy,
+		Version:     vv.Version.Copy(),
+		Timestamp:   vv.Timestamp,
+		Tombstone:   vv.Tombstone,
+		ExpiresAt:   vv.ExpiresAt,
+		Checksum:    vv.Checksum,
+		ContentType: vv.ContentType,
+		Meta:        maps.Clone(vv.Meta),
+		Siblings:    copySiblings(vv.Siblings),
+	}
+}
+
+// copySiblings returns deep copies of siblings, nil when there are none.
+func copySiblings(siblings []*VersionedValue) []*VersionedValue {
+	if len(siblings) == 0 {
+		return nil
 	}
+	copies := make([]*VersionedValue, len(siblings))
+	for i, sibling := range siblings {
+		copies[i] = sibling.Copy()
+	}
+	return copies
+}
+
+// IsExpired returns true if the value carries an expiry that is not after now.
+func (vv *VersionedValue) IsExpired(now time.Time) bool {
+	return vv != nil && !vv.ExpiresAt.IsZero() && !now.Before(vv.ExpiresAt)
 }
 
 // IsEmpty returns true if the versioned value has no data.
@@ -51,100 +135,374 @@ func (vv *VersionedValue) IsEmpty() bool {
 // VersionedEngine extends the basic Engine interface to handle versioned data.
 type VersionedEngine interface {
 	// Basic operations with versioned data
+	// GetVersioned returns a copy of the value for key, including tombstones.
+	// Missing, expired and corrupt values are reported as not found.
 	GetVersioned(key string) (*VersionedValue, bool)
+	// GetVersionedChecked is GetVersioned but reports ErrNotFound for missing
+	// values and ErrCorrupt when the stored value fails checksum verification.
+	GetVersionedChecked(key string) (*VersionedValue, error)
+	// PutVersioned stores value, and its siblings, unless every version it
+	// carries happens before one stored, in which case ErrStaleVersion is
+	// returned. Stored versions the write's clocks descend from are dropped
+	// and concurrent ones kept as siblings, up to the engine's MaxSiblings.
+	// Two Counters, ORSets or LWWMaps are always merged into one, whatever
+	// their versions.
 	PutVersioned(key string, value *VersionedValue) error
 	DeleteVersioned(key string) error
+	// ReapExpired physically removes expired values and returns how many were removed.
+	ReapExpired() int
+	// Scan returns up to limit live entries with the given prefix that sort
+	// after cursor, in ascending key order, plus the cursor for the next page.
+	Scan(prefix, cursor string, limit int) (entries []ScanEntry, next string)
+	// Sample returns up to n live values chosen uniformly at random, in no
+	// particular order, and the number of live values they were chosen from.
+	Sample(n int) (entries []SampleEntry, total int)
+	// PutBatch applies all writes atomically with respect to other operations.
+	PutBatch(items []KeyedVersionedValue) error
+	// Stats summarizes the live values and tombstones held by the engine.
+	Stats() Stats
+	// Tombstones returns up to limit unexpired tombstones with the given
+	// prefix, oldest deletion first, and how many there are in all.
+	Tombstones(prefix string, limit int) (entries []TombstoneEntry, total int)
+	// PurgeTombstones removes the tombstones with the given prefix that were
+	// deleted at least olderThan ago and returns how many it removed.
+	PurgeTombstones(prefix string, olderThan time.Duration) int
+	// Close releases the engine; later writes fail with ErrClosed.
+	Close() error
+}
+
+var (
+	// ErrNotFound reports a key with no live value.
+	ErrNotFound = errors.New("key not found")
+	// ErrStaleVersion reports a write whose version happens before the stored one.
+	ErrStaleVersion = errors.New("version is older than the stored version")
+	// ErrClosed reports use of an engine after Close.
+	ErrClosed = errors.New("engine is closed")
+)
+
+// KeyedVersionedValue is a single write in a batch.
+type KeyedVersionedValue struct {
+	Key   string
+	Value *VersionedValue
+}
+
+// ScanEntry is a key together with the version of its current value.
+type ScanEntry struct {
+	Key     string            `json:"key"`
+	Version clock.VectorClock `json:"version"`
+	// Tombstone, Timestamp, ExpiresAt and Checksum are the rest of the
+	// entry's metadata, so that copies of it can be compared in full.
+	Tombstone bool      `json:"tombstone,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	Checksum  uint32    `json:"checksum"`
+	// Siblings counts the versions stored alongside the entry's own, whose
+	// clocks Version then merges.
+	Siblings int `json:"siblings,omitempty"`
+}
+
+// SampleEntry is a key together with the size and version of its value.
+type SampleEntry struct {
+	Key     string            `json:"key"`
+	Size    int               `json:"size"`
+	Version clock.VectorClock `json:"version"`
+}
+
+// TombstoneEntry is a deleted key with the clock it was deleted under.
+type TombstoneEntry struct {
+	Key       string
+	Version   clock.VectorClock
+	DeletedAt time.Time
 }
 
-var _ VersionedEngine = (*VersionedInMemoryChannel)(nil)
-
-type VersionedInMemoryChannel struct {
-	data map[string]*VersionedValue
-	cw   chan dataCommand    //for writing
-	cr   chan VersionedValue //for reading
-}
-
-func NewVersionedInMemoryChannel() *VersionedInMemoryChannel {
-	versionedMemory := &VersionedInMemoryChannel{
-		data: make(map[string]*VersionedValue),
-		cw:   make(chan dataCommand),
-		cr:   make(chan VersionedValue),
-	}
-	go readMessage(versionedMemory)
-	return versionedMemory
-}
-
-func readMessage(v *VersionedInMemoryChannel) {
-	for {
-		dataCommand := <-v.cw
-		key := dataCommand.key
-		switch dataCommand.command {
-		case Get:
-			if value, ok := v.data[key]; ok {
-				v.cr <- *value.Copy()
-			} else {
-				v.cr <- *NewVersionedValue(nil, nil)
-			}
-		case Put:
-			v.data[key] = dataCommand.value
-		case Delete:
-			if value, ok := v.data[key]; ok {
-				value.Tombstone = true
-			}
-		default:
-			panic("Unknown command")
+// sortTombstones orders entries oldest deletion first, then by key, and
+// returns the first limit of them; a limit of zero or less keeps them all.
+func sortTombstones(entries []TombstoneEntry, limit int) []TombstoneEntry {
+	slices.SortFunc(entries, func(a, b TombstoneEntry) int {
+		if c := a.DeletedAt.Compare(b.DeletedAt); c != 0 {
+			return c
 		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
 	}
+	return entries
 }
 
-func (v *VersionedInMemoryChannel) GetVersioned(key string) (*VersionedValue, bool) {
-	d := dataCommand{
-		command: Get,
-		key:     key,
+var _ VersionedEngine = (*VersionedInMemory)(nil)
+
+// VersionedInMemory is a mutex-guarded map of versioned values for development/testing.
+type VersionedInMemory struct {
+	mu     sync.RWMutex
+	data   map[string]*VersionedValue
+	closed bool
+}
+
+func NewVersionedInMemory() *VersionedInMemory {
+	return &VersionedInMemory{data: make(map[string]*VersionedValue)}
+}
+
+func (v *VersionedInMemory) GetVersioned(key string) (*VersionedValue, bool) {
+	val, err := v.GetVersionedChecked(key)
+	if err != nil {
+		return nil, false
 	}
-	v.cw <- d
-	val := <-v.cr
-	return &val, true
+	return val, true
 }
 
-func (v *VersionedInMemoryChannel) PutVersioned(key string, value *VersionedValue) error {
+func (v *VersionedInMemory) GetVersionedChecked(key string) (*VersionedValue, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	value, ok := v.data[key]
+	if !ok || value.IsExpired(time.Now()) {
+		return nil, fmt.Errorf("key %s: %w", key, ErrNotFound)
+	}
+	if err := value.Verify(); err != nil {
+		return nil, fmt.Errorf("key %s: %w", key, err)
+	}
+	return value.Copy(), nil
+}
+
+func (v *VersionedInMemory) PutVersioned(key string, value *VersionedValue) error {
 	if value == nil {
 		return fmt.Errorf("cannot store nil versioned value")
 	}
-	d := dataCommand{
-		command: Put,
-		key:     key,
-		value:   value.Copy(),
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return ErrClosed
+	}
+	resolved, err := v.resolve(key, value)
+	if err != nil {
+		return err
+	}
+	v.data[key] = resolved
+	return nil
+}
+
+// PutBatch stores every item or, if any item is stale, none of them.
+func (v *VersionedInMemory) PutBatch(items []KeyedVersionedValue) error {
+	for _, item := range items {
+		if item.Value == nil {
+			return fmt.Errorf("cannot store nil versioned value for key %s", item.Key)
+		}
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return ErrClosed
+	}
+	resolved := make([]*VersionedValue, len(items))
+	for i, item := range items {
+		r, err := v.resolve(item.Key, item.Value)
+		if err != nil {
+			return err
+		}
+		resolved[i] = r
+	}
+	for i, item := range items {
+		v.data[item.Key] = resolved[i]
 	}
-	v.cw <- d
-	fmt.Println("PUT VALUE FOR KEY ", key)
 	return nil
 }
 
-func (v *VersionedInMemoryChannel) DeleteVersioned(key string) error {
-	if value, ok := v.data[key]; ok {
-		d := dataCommand{
-			command: Delete,
-			key:     key,
-			value:   value,
+// resolve returns the sealed copy to store when incoming is written to key.
+// Callers must hold v.mu.
+func (v *VersionedInMemory) resolve(key string, incoming *VersionedValue) (*VersionedValue, error) {
+	current, ok := v.data[key]
+	if !ok || current.IsExpired(time.Now()) {
+		current = nil
+	}
+	return resolveWrite(key, current, incoming, Limits{})
+}
+
+// resolveWrite returns the sealed copy to store when incoming is written
+// over current, which is nil when the key holds no live value. Of the
+// versions the two carry, those another one's clock descends from are
+// dropped, and of two with equal clocks incoming's is kept. limits caps
+// the versions left.
+func resolveWrite(key string, current, incoming *VersionedValue, limits Limits) (*VersionedValue, error) {
+	resolved := incoming.Copy()
+	resolved.Seal()
+	if current == nil {
+		return limitSiblings(resolved.Versions(), limits), nil
+	}
+	if merged, ok := mergeConverging(current, incoming); ok {
+		// Whatever their versions, two counters, sets or maps are merged,
+		// so that a replica never drops changes the write it takes has not
+		// seen
+		if current.Timestamp.After(incoming.Timestamp) {
+			resolved = current.Copy()
 		}
-		v.cw <- d
-	} else {
+		resolved.Value = merged
+		resolved.Version = current.Version.Merge(incoming.Version)
+		resolved.Seal()
+		return resolved, nil
+	}
+
+	var kept []*VersionedValue
+	for _, version := range resolved.Versions() {
+		if !slices.ContainsFunc(current.Siblings, version.happensBefore) && !version.happensBefore(current) {
+			kept = append(kept, version)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("key %s: %w (%s < %s)", key, ErrStaleVersion, incoming.Version, current.Context())
+	}
+	for _, version := range current.Copy().Versions() {
+		if !slices.ContainsFunc(kept, func(newer *VersionedValue) bool {
+			return version.happensBefore(newer) || clock.Equal(version.Version, newer.Version)
+		}) {
+			kept = append(kept, version)
+		}
+	}
+	return limitSiblings(kept, limits), nil
+}
+
+// happensBefore reports whether other's clock descends from vv's.
+func (vv *VersionedValue) happensBefore(other *VersionedValue) bool {
+	return clock.Compare(vv.Version, other.Version) < 0
+}
+
+// limitSiblings stores versions, concurrent with each other, as the latest
+// of them with the others as its siblings; a value is stored in preference
+// to a later delete, so that readers still see it. More than
+// limits.MaxSiblings collapse into the latest alone, under a clock merging
+// them all, so that the latest write wins.
+func limitSiblings(versions []*VersionedValue, limits Limits) *VersionedValue {
+	slices.SortStableFunc(versions, func(a, b *VersionedValue) int {
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+	if limits.MaxSiblings > 0 && len(versions) > limits.MaxSiblings {
+		latest := versions[0]
+		for _, version := range versions[1:] {
+			latest.Version = latest.Version.Merge(version.Version)
+		}
+		return latest
+	}
+	if i := slices.IndexFunc(versions, func(v *VersionedValue) bool { return !v.Tombstone }); i > 0 {
+		versions = append(append([]*VersionedValue{versions[i]}, versions[:i]...), versions[i+1:]...)
+	}
+	latest := versions[0]
+	if len(versions) > 1 {
+		latest.Siblings = versions[1:]
+	}
+	return latest
+}
+
+func (v *VersionedInMemory) DeleteVersioned(key string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return ErrClosed
+	}
+	value, ok := v.data[key]
+	if !ok {
 		return fmt.Errorf("key %s not found", key)
 	}
+	value.Tombstone = true
 	return nil
 }
 
-type dataCommand struct {
-	command
-	key   string
-	value *VersionedValue
+func (v *VersionedInMemory) ReapExpired() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := time.Now()
+	removed := 0
+	for k, value := range v.data {
+		if value.IsExpired(now) {
+			delete(v.data, k)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (v *VersionedInMemory) Scan(prefix, cursor string, limit int) ([]ScanEntry, string) {
+	v.mu.RLock()
+	now := time.Now()
+	byKey := make(map[string]ScanEntry)
+	keys := make([]string, 0)
+	for k, value := range v.data {
+		if k > cursor && strings.HasPrefix(k, prefix) && !value.IsExpired(now) {
+			keys = append(keys, k)
+			byKey[k] = ScanEntry{Key: k, Version: value.Context(), Tombstone: value.Tombstone, Timestamp: value.Timestamp, ExpiresAt: value.ExpiresAt, Checksum: value.Checksum, Siblings: len(value.Siblings)}
+		}
+	}
+	v.mu.RUnlock()
+
+	keys, next := paginate(keys, limit)
+	page := make([]ScanEntry, 0, len(keys))
+	for _, k := range keys {
+		page = append(page, byKey[k])
+	}
+	return page, next
 }
 
-type command int
+func (v *VersionedInMemory) Sample(n int) ([]SampleEntry, int) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	now := time.Now()
+	r := newReservoir(n)
+	for k, value := range v.data {
+		if value.Tombstone || value.IsExpired(now) {
+			continue
+		}
+		if i := r.slot(); i >= 0 {
+			r.items[i] = SampleEntry{Key: k, Size: len(value.Value), Version: value.Version.Copy()}
+		}
+	}
+	return r.items, r.seen
+}
 
-const (
-	Get command = iota
-	Put
-	Delete
-)
+func (v *VersionedInMemory) Stats() Stats {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	now := time.Now()
+	st := Stats{Namespaces: make(map[string]NamespaceStats)}
+	for k, value := range v.data {
+		if !value.IsExpired(now) {
+			st.add(k, int64(len(k)+len(value.Value)), value.Tombstone)
+		}
+	}
+	return st
+}
+
+// Tombstones reports a tombstone as deleted when it was written, as this
+// engine does not track deletions apart from writes.
+func (v *VersionedInMemory) Tombstones(prefix string, limit int) ([]TombstoneEntry, int) {
+	v.mu.RLock()
+	now := time.Now()
+	entries := make([]TombstoneEntry, 0)
+	for k, value := range v.data {
+		if value.Tombstone && strings.HasPrefix(k, prefix) && !value.IsExpired(now) {
+			entries = append(entries, TombstoneEntry{Key: k, Version: value.Version.Copy(), DeletedAt: value.Timestamp})
+		}
+	}
+	v.mu.RUnlock()
+	return sortTombstones(entries, limit), len(entries)
+}
+
+func (v *VersionedInMemory) PurgeTombstones(prefix string, olderThan time.Duration) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := time.Now()
+	removed := 0
+	for k, value := range v.data {
+		if value.Tombstone && strings.HasPrefix(k, prefix) && now.Sub(value.Timestamp) >= olderThan {
+			delete(v.data, k)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Close drops all values. Reads then report not found and writes fail with ErrClosed.
+func (v *VersionedInMemory) Close() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.closed = true
+	v.data = make(map[string]*VersionedValue)
+	return nil
+}
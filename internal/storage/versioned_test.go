@@ -1,6 +1,9 @@
 package storage
 
 import (
+	"errors"
+	"hash/crc32"
+	"slices"
 	"strconv"
 	"sync"
 	"testing"
@@ -61,7 +64,7 @@ func TestEmpty(t *testing.T) {
 
 func TestVersionedEngine(t *testing.T) {
 	const key = "some key"
-	ve := NewVersionedInMemoryChannel()
+	ve := NewVersionedInMemory()
 	one := []byte(strconv.Itoa(1))
 	ve.PutVersioned(key, NewVersionedValue(one, clock.VectorClock{"node1": 1}))
 	wg := sync.WaitGroup{}
@@ -96,3 +99,328 @@ func TestVersionedEngine(t *testing.T) {
 	}
 	ve.DeleteVersioned(key)
 }
+
+func TestVersionedExpiry(t *testing.T) {
+	ve := NewVersionedInMemory()
+	v := NewVersionedValue([]byte("value"), clock.VectorClock{"node1": 1})
+	v.ExpiresAt = time.Now().Add(-time.Second)
+	if !v.IsExpired(time.Now()) {
+		t.Error("Expected value to be expired")
+	}
+	ve.PutVersioned("key", v)
+
+	got, _ := ve.GetVersioned("key")
+	if !got.IsEmpty() {
+		t.Errorf("Expected expired value to be empty on read, got %s", got.Value)
+	}
+	if removed := ve.ReapExpired(); removed != 1 {
+		t.Errorf("Expected 1 reaped value, got %d", removed)
+	}
+}
+
+func TestVersionedScan(t *testing.T) {
+	ve := NewVersionedInMemory()
+	ve.PutVersioned("a/2", NewVersionedValue([]byte("2"), clock.VectorClock{"node1": 2}))
+	ve.PutVersioned("a/1", NewVersionedValue([]byte("1"), clock.VectorClock{"node1": 1}))
+	ve.PutVersioned("b/1", NewVersionedValue([]byte("3"), clock.VectorClock{"node1": 3}))
+
+	entries, next := ve.Scan("a/", "", 0)
+	if len(entries) != 2 || entries[0].Key != "a/1" || entries[1].Key != "a/2" {
+		t.Fatalf("Expected entries a/1 and a/2, got %v", entries)
+	}
+	if next != "" {
+		t.Errorf("Expected empty cursor, got %q", next)
+	}
+	if entries[1].Version["node1"] != 2 {
+		t.Errorf("Expected version 2 for a/2, got %v", entries[1].Version)
+	}
+	if entries[1].Checksum != crc32.ChecksumIEEE([]byte("2")) || entries[1].Timestamp.IsZero() || entries[1].Tombstone {
+		t.Errorf("Expected the metadata of a/2, got %+v", entries[1])
+	}
+}
+
+func TestVersionedAttributes(t *testing.T) {
+	for name, ve := range map[string]VersionedEngine{"in-memory": NewVersionedInMemory(), "sharded": NewSharded(4).Versioned()} {
+		value := NewVersionedValue([]byte("{}"), clock.VectorClock{"node1": 1})
+		value.ContentType = "application/json"
+		value.Meta = map[string]string{"owner": "alice"}
+		ve.PutVersioned("key", value)
+		value.Meta["owner"] = "bob"
+
+		got, ok := ve.GetVersioned("key")
+		if !ok || got.ContentType != "application/json" || got.Meta["owner"] != "alice" {
+			t.Errorf("%s: Expected the attributes stored as written, got %+v", name, got)
+		}
+	}
+}
+
+func TestVersionedSample(t *testing.T) {
+	for name, ve := range map[string]VersionedEngine{"in-memory": NewVersionedInMemory(), "sharded": NewSharded(4).Versioned()} {
+		for i := range 50 {
+			ve.PutVersioned(strconv.Itoa(i), NewVersionedValue([]byte("value"), clock.VectorClock{"node1": uint64(i + 1)}))
+		}
+		ve.DeleteVersioned("0")
+
+		entries, total := ve.Sample(10)
+		if len(entries) != 10 || total != 49 {
+			t.Fatalf("%s: Expected 10 of 49 keys, got %d of %d", name, len(entries), total)
+		}
+		seen := make(map[string]bool)
+		for _, e := range entries {
+			if e.Key == "0" || seen[e.Key] || e.Size != 5 || len(e.Version) == 0 {
+				t.Errorf("%s: Expected distinct live keys with size and version, got %+v", name, e)
+			}
+			seen[e.Key] = true
+		}
+		if entries, total := ve.Sample(100); len(entries) != 49 || total != 49 {
+			t.Errorf("%s: Expected every key when asking for more, got %d of %d", name, len(entries), total)
+		}
+	}
+}
+
+func TestVersionedTombstones(t *testing.T) {
+	for name, ve := range map[string]VersionedEngine{"in-memory": NewVersionedInMemory(), "sharded": NewSharded(4).Versioned()} {
+		for _, key := range []string{"a/1", "a/2", "a/3", "b/1"} {
+			ve.PutVersioned(key, NewVersionedValue([]byte("value"), clock.VectorClock{"node1": 1}))
+		}
+		for _, key := range []string{"a/1", "a/3", "b/1"} {
+			ve.DeleteVersioned(key)
+		}
+
+		entries, total := ve.Tombstones("a/", 1)
+		if len(entries) != 1 || total != 2 || entries[0].Version["node1"] != 1 || entries[0].DeletedAt.IsZero() {
+			t.Errorf("%s: Expected 1 of 2 tombstones in a/ with their clock, got %+v of %d", name, entries, total)
+		}
+		if n := ve.PurgeTombstones("a/", time.Hour); n != 0 {
+			t.Errorf("%s: Expected no tombstone deleted an hour ago, purged %d", name, n)
+		}
+		if n := ve.PurgeTombstones("a/", 0); n != 2 {
+			t.Errorf("%s: Expected both tombstones in a/ purged, got %d", name, n)
+		}
+		if entries, total := ve.Tombstones("", 0); total != 1 || entries[0].Key != "b/1" {
+			t.Errorf("%s: Expected only b/1 left, got %+v", name, entries)
+		}
+		if _, ok := ve.GetVersioned("a/2"); !ok {
+			t.Errorf("%s: Expected the live key to survive the purge", name)
+		}
+	}
+}
+
+func TestVersionedPutBatch(t *testing.T) {
+	ve := NewVersionedInMemory()
+	err := ve.PutBatch([]KeyedVersionedValue{
+		{Key: "a", Value: NewVersionedValue([]byte("1"), clock.VectorClock{"node1": 1})},
+		{Key: "b", Value: NewVersionedValue([]byte("2"), clock.VectorClock{"node1": 1})},
+	})
+	if err != nil {
+		t.Fatalf("Failed to put batch: %v", err)
+	}
+	if v, _ := ve.GetVersioned("b"); string(v.Value) != "2" {
+		t.Errorf("Expected b=2, got %q", v.Value)
+	}
+
+	err = ve.PutBatch([]KeyedVersionedValue{{Key: "c", Value: nil}})
+	if err == nil {
+		t.Error("Expected error for nil value in batch")
+	}
+}
+
+func TestVersionedChecksum(t *testing.T) {
+	v := NewVersionedValue([]byte("value"), clock.VectorClock{"node1": 1})
+	if err := v.Verify(); err != nil {
+		t.Fatalf("Expected new value to verify, got %v", err)
+	}
+	v.Value[0] ^= 0xff
+	if err := v.Verify(); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt after mutation, got %v", err)
+	}
+
+	ve := NewVersionedInMemory()
+	ve.PutVersioned("key", v)
+	if _, err := ve.GetVersionedChecked("key"); err != nil {
+		t.Fatalf("Expected PutVersioned to reseal the value, got %v", err)
+	}
+
+	// Corrupt the stored copy behind the engine's back
+	ve.data["key"].Checksum++
+	if _, err := ve.GetVersionedChecked("key"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for stored value, got %v", err)
+	}
+	if _, found := ve.GetVersioned("key"); found {
+		t.Error("Expected corrupt value to be reported as not found")
+	}
+}
+
+func TestVersionedStats(t *testing.T) {
+	ve := NewVersionedInMemory()
+	ve.PutVersioned("user/1", NewVersionedValue([]byte("abc"), clock.VectorClock{"node1": 1}))
+	ve.PutVersioned("user/2", NewVersionedValue([]byte("de"), clock.VectorClock{"node1": 1}))
+	ve.DeleteVersioned("user/2")
+
+	st := ve.Stats()
+	if st.Keys != 1 || st.Tombstones != 1 {
+		t.Errorf("Expected 1 key and 1 tombstone, got %+v", st)
+	}
+	if ns := st.Namespaces["user"]; ns.Keys != 1 || ns.Tombstones != 1 {
+		t.Errorf("Expected user namespace with 1 key and 1 tombstone, got %+v", ns)
+	}
+}
+
+func TestVersionedNotFound(t *testing.T) {
+	ve := NewVersionedInMemory()
+	if v, found := ve.GetVersioned("missing"); found || v != nil {
+		t.Errorf("Expected missing key to be not found, got %v, %v", v, found)
+	}
+	if _, err := ve.GetVersionedChecked("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := ve.DeleteVersioned("missing"); err == nil {
+		t.Error("Expected error when deleting a missing key")
+	}
+}
+
+func TestVersionedRejectsStaleWrites(t *testing.T) {
+	ve := NewVersionedInMemory()
+	ve.PutVersioned("key", NewVersionedValue([]byte("new"), clock.VectorClock{"node1": 2}))
+
+	err := ve.PutVersioned("key", NewVersionedValue([]byte("old"), clock.VectorClock{"node1": 1}))
+	if !errors.Is(err, ErrStaleVersion) {
+		t.Errorf("Expected ErrStaleVersion, got %v", err)
+	}
+	if v, _ := ve.GetVersioned("key"); string(v.Value) != "new" {
+		t.Errorf("Expected stale write to be ignored, got %q", v.Value)
+	}
+
+	err = ve.PutBatch([]KeyedVersionedValue{
+		{Key: "other", Value: NewVersionedValue([]byte("1"), clock.VectorClock{"node1": 1})},
+		{Key: "key", Value: NewVersionedValue([]byte("old"), clock.VectorClock{"node1": 1})},
+	})
+	if !errors.Is(err, ErrStaleVersion) {
+		t.Errorf("Expected ErrStaleVersion for batch, got %v", err)
+	}
+	if _, found := ve.GetVersioned("other"); found {
+		t.Error("Expected no item of a rejected batch to be stored")
+	}
+}
+
+func TestVersionedKeepsConcurrentWritesAsSiblings(t *testing.T) {
+	ve := NewVersionedInMemory()
+	first := NewVersionedValue([]byte("first"), clock.VectorClock{"node1": 1})
+	second := NewVersionedValue([]byte("second"), clock.VectorClock{"node2": 1})
+	second.Timestamp = first.Timestamp.Add(time.Second)
+	ve.PutVersioned("key", first)
+	ve.PutVersioned("key", second)
+
+	v, _ := ve.GetVersioned("key")
+	if string(v.Value) != "second" || !clock.Equal(v.Version, second.Version) {
+		t.Errorf("Expected the later concurrent write under its own clock, got %q %s", v.Value, v.Version)
+	}
+	if len(v.Siblings) != 1 || string(v.Siblings[0].Value) != "first" || !clock.Equal(v.Siblings[0].Version, first.Version) {
+		t.Fatalf("Expected the earlier write kept as a sibling, got %+v", v.Siblings)
+	}
+
+	// A write descending from one sibling replaces only that one
+	third := NewVersionedValue([]byte("third"), clock.VectorClock{"node1": 2})
+	third.Timestamp = second.Timestamp.Add(time.Second)
+	ve.PutVersioned("key", third)
+	v, _ = ve.GetVersioned("key")
+	if string(v.Value) != "third" || len(v.Siblings) != 1 || string(v.Siblings[0].Value) != "second" {
+		t.Errorf("Expected third with second as its sibling, got %q with %+v", v.Value, v.Siblings)
+	}
+	if err := ve.PutVersioned("key", first); !errors.Is(err, ErrStaleVersion) {
+		t.Errorf("Expected a superseded sibling to be stale, got %v", err)
+	}
+
+	// A write descending from every sibling replaces them all
+	ve.PutVersioned("key", NewVersionedValue([]byte("resolved"), v.Context().Merge(clock.VectorClock{"node1": 3})))
+	if v, _ = ve.GetVersioned("key"); string(v.Value) != "resolved" || len(v.Siblings) != 0 {
+		t.Errorf("Expected the resolving write alone, got %q with %+v", v.Value, v.Siblings)
+	}
+}
+
+func TestVersionedMergesConcurrentCounters(t *testing.T) {
+	for name, ve := range map[string]VersionedEngine{"in-memory": NewVersionedInMemory(), "sharded": NewSharded(4).Versioned()} {
+		var a, b Counter
+		a.Add("node1", 5)
+		b.Add("node1", 2)
+		b.Add("node2", 3)
+		b.Add("node2", -1)
+		ve.PutVersioned("counter", NewVersionedValue(a.Encode(), clock.VectorClock{"node1": 2}))
+		ve.PutVersioned("counter", NewVersionedValue(b.Encode(), clock.VectorClock{"node1": 1, "node2": 2}))
+
+		v, _ := ve.GetVersioned("counter")
+		merged, err := DecodeCounter(v.Value)
+		if err != nil || merged.Value() != 7 {
+			t.Errorf("%s: Expected concurrent counters to merge to 7, got %d, %v", name, merged.Value(), err)
+		}
+		if !clock.Equal(v.Version, clock.VectorClock{"node1": 2, "node2": 2}) {
+			t.Errorf("%s: Expected merged clock, got %s", name, v.Version)
+		}
+
+		// Even a counter the stored one supersedes is merged rather than refused
+		var c Counter
+		c.Add("node3", 4)
+		if err := ve.PutVersioned("counter", NewVersionedValue(c.Encode(), clock.VectorClock{"node1": 1})); err != nil {
+			t.Errorf("%s: Expected an older counter to be merged, got %v", name, err)
+		}
+		v, _ = ve.GetVersioned("counter")
+		if merged, _ := DecodeCounter(v.Value); merged.Value() != 11 || !clock.Equal(v.Version, clock.VectorClock{"node1": 2, "node2": 2}) {
+			t.Errorf("%s: Expected 11 under the stored clock, got %d under %s", name, merged.Value(), v.Version)
+		}
+
+		// A delete replaces the counter, and a counter written over it starts afresh
+		ve.PutVersioned("counter", &VersionedValue{Version: clock.VectorClock{"node1": 3, "node2": 2}, Tombstone: true})
+		ve.PutVersioned("counter", NewVersionedValue(c.Encode(), clock.VectorClock{"node1": 4, "node2": 2}))
+		v, _ = ve.GetVersioned("counter")
+		if merged, _ := DecodeCounter(v.Value); merged.Value() != 4 {
+			t.Errorf("%s: Expected a counter written after a delete to start afresh, got %d", name, merged.Value())
+		}
+	}
+}
+
+func TestVersionedMergesSetsAndMaps(t *testing.T) {
+	ve := NewVersionedInMemory()
+	var base ORSet
+	base.Add("red", "n1:1")
+	base.Add("blue", "n1:1")
+	left, right := base.Merge(ORSet{}), base.Merge(ORSet{})
+	left.Remove("red")
+	right.Add("red", "n2:1") // an add concurrent with the remove wins
+	right.Remove("blue")
+	ve.PutVersioned("set", NewVersionedValue(left.Encode(), clock.VectorClock{"n1": 2}))
+	ve.PutVersioned("set", NewVersionedValue(right.Encode(), clock.VectorClock{"n2": 1}))
+	v, _ := ve.GetVersioned("set")
+	set, err := DecodeORSet(v.Value)
+	if elements := set.Elements(); err != nil || !slices.Equal(elements, []string{"red"}) {
+		t.Errorf("Expected concurrent sets to merge to [red], got %v, %v", elements, err)
+	}
+
+	at := func(wall int64) clock.Timestamp { return clock.Timestamp{WallTime: wall} }
+	var older, newer LWWMap
+	older.Set("name", LWWField{Value: []byte(`"ann"`), Timestamp: at(1), Node: "n1"})
+	older.Set("city", LWWField{Value: []byte(`"oslo"`), Timestamp: at(3), Node: "n1"})
+	newer.Set("name", LWWField{Value: []byte(`"anne"`), Timestamp: at(2), Node: "n2"})
+	newer.Set("city", LWWField{Timestamp: at(2), Node: "n2", Deleted: true})
+	ve.PutVersioned("map", NewVersionedValue(older.Encode(), clock.VectorClock{"n1": 1}))
+	ve.PutVersioned("map", NewVersionedValue(newer.Encode(), clock.VectorClock{"n2": 1}))
+	v, _ = ve.GetVersioned("map")
+	m, err := DecodeLWWMap(v.Value)
+	live := m.Live()
+	if err != nil || len(live) != 2 || string(live["name"]) != `"anne"` || string(live["city"]) != `"oslo"` {
+		t.Errorf("Expected the later write of each field, got %s, %v", live, err)
+	}
+}
+
+func TestVersionedClose(t *testing.T) {
+	ve := NewVersionedInMemory()
+	ve.PutVersioned("key", NewVersionedValue([]byte("v"), clock.VectorClock{"node1": 1}))
+	if err := ve.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if _, found := ve.GetVersioned("key"); found {
+		t.Error("Expected closed engine to hold no values")
+	}
+	if err := ve.PutVersioned("key", NewVersionedValue([]byte("v"), clock.VectorClock{"node1": 2})); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package dhtpb
+
+import (
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+// The functions below convert between the protobuf messages and the JSON
+// types of pkg/api that the HTTP endpoints exchange, so either transport
+// can hand the other's messages to the same code. Times travel as Unix
+// nanoseconds, with zero standing for the zero time.
+
+// FromGetResponse converts a client read to its protobuf form. Its version
+// is the causal context that supersedes every version read.
+func FromGetResponse(resp api.GetResponse) *GetResponse {
+	var version map[string]uint64
+	for _, v := range resp.Versions {
+		if version == nil {
+			version = make(map[string]uint64, len(v))
+		}
+		for node, counter := range v {
+			version[node] = max(version[node], counter)
+		}
+	}
+	return &GetResponse{
+		Key:         resp.Key,
+		Value:       resp.Value,
+		Found:       resp.Found,
+		Version:     version,
+		Checksum:    resp.Checksum,
+		Siblings:    convertAll(resp.Siblings, FromSibling),
+		ContentType: resp.ContentType,
+		Meta:        resp.Meta,
+		ExpiresAt:   unixNano(resp.ExpiresAt),
+	}
+}
+
+// FromSibling converts one of several concurrent versions to its protobuf
+// form.
+func FromSibling(sibling api.Sibling) *Sibling {
+	return &Sibling{Value: sibling.Value, Version: sibling.Version}
+}
+
+// FromReplicateRequest converts a replica write to its protobuf form.
+func FromReplicateRequest(req api.ReplicateRequest) *ReplicateRequest {
+	return &ReplicateRequest{
+		Key:         req.Key,
+		Value:       req.Value,
+		Version:     req.Version,
+		ExpiresAt:   unixNano(req.ExpiresAt),
+		Timestamp:   unixNano(req.Timestamp),
+		Checksum:    req.Checksum,
+		HintFor:     req.HintFor,
+		Tombstone:   req.Tombstone,
+		ContentType: req.ContentType,
+		Meta:        req.Meta,
+		Siblings:    convertAll(req.Siblings, FromReplicateRequest),
+	}
+}
+
+// API converts a replica write to its JSON form.
+func (x *ReplicateRequest) API() api.ReplicateRequest {
+	return api.ReplicateRequest{
+		Key:         x.GetKey(),
+		Value:       x.GetValue(),
+		Version:     x.GetVersion(),
+		ExpiresAt:   unixNanoTime(x.GetExpiresAt()),
+		Timestamp:   unixNanoTime(x.GetTimestamp()),
+		Checksum:    x.GetChecksum(),
+		HintFor:     x.GetHintFor(),
+		Tombstone:   x.GetTombstone(),
+		ContentType: x.GetContentType(),
+		Meta:        x.GetMeta(),
+		Siblings:    convertAll(x.GetSiblings(), (*ReplicateRequest).API),
+	}
+}
+
+// FromReplicateGetResponse converts a replica read to its protobuf form.
+func FromReplicateGetResponse(resp api.ReplicateGetResponse) *ReplicateGetResponse {
+	return &ReplicateGetResponse{
+		Key:         resp.Key,
+		Value:       resp.Value,
+		Version:     resp.Version,
+		Found:       resp.Found,
+		ExpiresAt:   unixNano(resp.ExpiresAt),
+		Timestamp:   unixNano(resp.Timestamp),
+		Checksum:    resp.Checksum,
+		Corrupt:     resp.Corrupt,
+		Tombstone:   resp.Tombstone,
+		SyncedAt:    unixNano(resp.SyncedAt),
+		ContentType: resp.ContentType,
+		Meta:        resp.Meta,
+		Siblings:    convertAll(resp.Siblings, FromReplicateGetResponse),
+	}
+}
+
+// API converts a replica read to its JSON form.
+func (x *ReplicateGetResponse) API() api.ReplicateGetResponse {
+	return api.ReplicateGetResponse{
+		Key:         x.GetKey(),
+		Value:       x.GetValue(),
+		Version:     x.GetVersion(),
+		Found:       x.GetFound(),
+		ExpiresAt:   unixNanoTime(x.GetExpiresAt()),
+		Timestamp:   unixNanoTime(x.GetTimestamp()),
+		Checksum:    x.GetChecksum(),
+		Corrupt:     x.GetCorrupt(),
+		Tombstone:   x.GetTombstone(),
+		SyncedAt:    unixNanoTime(x.GetSyncedAt()),
+		ContentType: x.GetContentType(),
+		Meta:        x.GetMeta(),
+		Siblings:    convertAll(x.GetSiblings(), (*ReplicateGetResponse).API),
+	}
+}
+
+// API converts a replica write's acknowledgement to its JSON form.
+func (x *ReplicateResponse) API() api.ReplicateResponse {
+	return api.ReplicateResponse{Success: x.GetSuccess(), Error: x.GetError(), Ack: x.GetAck()}
+}
+
+// FromMember converts a node incarnation to its protobuf form.
+func FromMember(m api.Member) *Member {
+	return &Member{NodeId: m.NodeID, Address: m.Address, Incarnation: m.Incarnation, Placement: m.Placement, Meta: m.Meta}
+}
+
+// API converts a node incarnation to its JSON form.
+func (x *Member) API() api.Member {
+	return api.Member{NodeID: x.GetNodeId(), Address: x.GetAddress(), Incarnation: x.GetIncarnation(), Placement: x.GetPlacement(), Meta: x.GetMeta()}
+}
+
+// FromRangeEntry converts a range listing entry to its protobuf form.
+func FromRangeEntry(entry api.RangeEntry) *RangeEntry {
+	return &RangeEntry{
+		Key:       entry.Key,
+		Version:   entry.Version,
+		Tombstone: entry.Tombstone,
+		Timestamp: unixNano(entry.Timestamp),
+		ExpiresAt: unixNano(entry.ExpiresAt),
+		Checksum:  entry.Checksum,
+		Siblings:  uint32(entry.Siblings),
+	}
+}
+
+// API converts a range listing entry to its JSON form.
+func (x *RangeEntry) API() api.RangeEntry {
+	return api.RangeEntry{
+		Key:       x.GetKey(),
+		Version:   x.GetVersion(),
+		Tombstone: x.GetTombstone(),
+		Timestamp: unixNanoTime(x.GetTimestamp()),
+		ExpiresAt: unixNanoTime(x.GetExpiresAt()),
+		Checksum:  x.GetChecksum(),
+		Siblings:  int(x.GetSiblings()),
+	}
+}
+
+// FromRingResponse converts a ring topology to its protobuf form.
+func FromRingResponse(resp api.RingResponse) *RingResponse {
+	return &RingResponse{
+		Epoch:             resp.Epoch,
+		Vnodes:            uint32(resp.VNodes),
+		ReplicationFactor: uint32(resp.ReplicationFactor),
+		Nodes:             resp.Nodes,
+	}
+}
+
+// API converts a ring topology to its JSON form.
+func (x *RingResponse) API() api.RingResponse {
+	nodes := x.GetNodes()
+	if nodes == nil {
+		nodes = make(map[string]string)
+	}
+	return api.RingResponse{
+		Epoch:             x.GetEpoch(),
+		VNodes:            int(x.GetVnodes()),
+		ReplicationFactor: int(x.GetReplicationFactor()),
+		Nodes:             nodes,
+	}
+}
+
+// convertAll converts each of items, leaving none as nil.
+func convertAll[From, To any](items []From, convert func(From) To) []To {
+	if len(items) == 0 {
+		return nil
+	}
+	converted := make([]To, len(items))
+	for i, item := range items {
+		converted[i] = convert(item)
+	}
+	return converted
+}
+
+// unixNanoTime converts a protobuf timestamp to a time, mapping zero to the zero time.
+func unixNanoTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// unixNano converts a time to a protobuf timestamp, mapping the zero time to zero.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
@@ -0,0 +1,72 @@
+package dhtpb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+func TestConvertRoundTrip(t *testing.T) {
+	now := time.Unix(0, time.Now().UnixNano())
+
+	write := api.ReplicateRequest{
+		Key:         "key",
+		Value:       []byte("value"),
+		Version:     map[string]uint64{"a": 2, "b": 1},
+		Timestamp:   now,
+		Checksum:    7,
+		HintFor:     "c",
+		Tombstone:   true,
+		ContentType: "image/png",
+		Meta:        map[string]string{"owner": "alice"},
+		Siblings:    []api.ReplicateRequest{{Key: "key", Value: []byte("sibling"), Version: map[string]uint64{"c": 1}, Timestamp: now, Checksum: 8}},
+	}
+	var decoded ReplicateRequest
+	if data, err := proto.Marshal(FromReplicateRequest(write)); err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	} else if err := proto.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if got := decoded.API(); !reflect.DeepEqual(got, write) {
+		t.Errorf("Expected %+v after the wire, got %+v", write, got)
+	}
+	if !decoded.API().ExpiresAt.IsZero() {
+		t.Errorf("Expected an unset expiry to stay the zero time")
+	}
+
+	read := api.ReplicateGetResponse{Key: "key", Value: []byte("value"), Found: true, ExpiresAt: now, SyncedAt: now, Checksum: 7, ContentType: "application/json",
+		Siblings: []api.ReplicateGetResponse{{Key: "key", Version: map[string]uint64{"c": 1}, Timestamp: now, Tombstone: true}}}
+	if got := FromReplicateGetResponse(read).API(); !reflect.DeepEqual(got, read) {
+		t.Errorf("Expected %+v, got %+v", read, got)
+	}
+
+	entry := api.RangeEntry{Key: "key", Version: map[string]uint64{"a": 1}, Tombstone: true, Timestamp: now, Checksum: 7, Siblings: 2}
+	if got := FromRangeEntry(entry).API(); !reflect.DeepEqual(got, entry) {
+		t.Errorf("Expected %+v, got %+v", entry, got)
+	}
+
+	get := api.GetResponse{Key: "key", Value: []byte("b"), Found: true, Checksum: 7, ExpiresAt: now, ContentType: "image/png", Meta: map[string]string{"owner": "alice"},
+		Versions: []map[string]uint64{{"a": 2, "b": 1}, {"a": 1, "c": 3}},
+		Siblings: []api.Sibling{{Value: []byte("a"), Version: map[string]uint64{"a": 2, "b": 1}}, {Value: []byte("b"), Version: map[string]uint64{"a": 1, "c": 3}}}}
+	if got := FromGetResponse(get); !reflect.DeepEqual(got.GetVersion(), map[string]uint64{"a": 2, "b": 1, "c": 3}) || len(got.GetSiblings()) != 2 ||
+		got.GetContentType() != get.ContentType || !reflect.DeepEqual(got.GetMeta(), get.Meta) || got.GetExpiresAt() != now.UnixNano() {
+		t.Errorf("Expected the read converted with the merged version, its attributes and expiry, got %v", got)
+	}
+
+	member := api.Member{NodeID: "a", Address: "127.0.0.1:8080", Incarnation: 3, Meta: map[string]string{api.MetaDatacenter: "eu-west", api.MetaCodecs: "snappy,none"}}
+	if got := FromMember(member).API(); !reflect.DeepEqual(got, member) {
+		t.Errorf("Expected %+v, got %+v", member, got)
+	}
+
+	topology := api.RingResponse{Epoch: 4, VNodes: 64, ReplicationFactor: 3, Nodes: map[string]string{"a": "127.0.0.1:8080"}}
+	if got := FromRingResponse(topology).API(); !reflect.DeepEqual(got, topology) {
+		t.Errorf("Expected %+v, got %+v", topology, got)
+	}
+	if got := (&RingResponse{}).API(); got.Nodes == nil {
+		t.Errorf("Expected an empty ring to list no nodes rather than null")
+	}
+}
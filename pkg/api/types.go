@@ -1,10 +1,14 @@
 package api
 
+import "time"
+
 // Basic request/response types for client API (subject to change).
 
 type PutRequest struct {
 	Key   string `json:"key"`
 	Value []byte `json:"value"`
+	// Context is the version returned by the read this write is based on.
+	Context map[string]uint64 `json:"context,omitempty"`
 }
 
 type PutResponse struct {
@@ -12,32 +16,883 @@ type PutResponse struct {
 }
 
 type GetResponse struct {
-	Key      string              `json:"key"`
-	Value    []byte              `json:"value,omitempty"`
+	Key   string `json:"key"`
+	Value []byte `json:"value,omitempty"`
+	// Versions lists the clock of every version read, one per sibling.
+	// Passing them back merged as the causal context of a PUT supersedes
+	// all of them.
 	Versions []map[string]uint64 `json:"versions,omitempty"`
 	Found    bool                `json:"found"`
+	// Checksum is the CRC32 (IEEE) of Value, letting clients detect
+	// corruption in transit.
+	Checksum uint32 `json:"checksum,omitempty"`
+	// Siblings holds the causally concurrent versions the replicas
+	// returned, in the order of Versions. It is empty when one version
+	// supersedes the others; otherwise Value is the latest write among
+	// them.
+	Siblings []Sibling `json:"siblings,omitempty"`
+	// ExpiresAt is when the value expires, set by the TTL it was written
+	// with, and TTLSeconds the whole seconds left until then, rounded up.
+	ExpiresAt  time.Time `json:"expires_at,omitzero"`
+	TTLSeconds int64     `json:"ttl_seconds,omitempty"`
+	// ContentType and Meta are the Content-Type and X-Meta-* headers the
+	// value was written with.
+	ContentType string            `json:"content_type,omitempty"`
+	Meta        map[string]string `json:"meta,omitempty"`
 }
 
-// Internal replication types
+// CounterIncrement is the body of POST /counters/{key}/incr. Delta may be
+// negative to decrement the counter.
+type CounterIncrement struct {
+	Delta int64 `json:"delta"`
+}
 
-type ReplicateRequest struct {
+// CounterResponse is the value of a counter, answered by a read or an
+// increment of it. Version is the clock the counter is stored under.
+type CounterResponse struct {
 	Key     string            `json:"key"`
+	Value   int64             `json:"value"`
+	Version map[string]uint64 `json:"version,omitempty"`
+}
+
+// BatchRequest is the body of POST /kv/_batch: it reads Keys, or writes
+// Items when there are any.
+type BatchRequest struct {
+	Keys  []string    `json:"keys,omitempty"`
+	Items []BatchItem `json:"items,omitempty"`
+}
+
+// BatchItem is one write of a batch.
+type BatchItem struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+	// Context is the version returned by the read this write is based on.
+	Context map[string]uint64 `json:"context,omitempty"`
+}
+
+// BatchResponse answers the keys or items of a BatchRequest in order.
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// BatchResult is the outcome for one key of a batch. Status is what a GET
+// or PUT of the key alone would have answered; a read carries the fields
+// of a GetResponse, a write the Version of a PutResponse.
+type BatchResult struct {
+	Key      string              `json:"key"`
+	Status   int                 `json:"status"`
+	Error    string              `json:"error,omitempty"`
+	Value    []byte              `json:"value,omitempty"`
+	Found    bool                `json:"found,omitempty"`
+	Versions []map[string]uint64 `json:"versions,omitempty"`
+	Checksum uint32              `json:"checksum,omitempty"`
+	Siblings []Sibling           `json:"siblings,omitempty"`
+	Version  map[string]uint64   `json:"version,omitempty"`
+}
+
+// Sibling is one of several concurrent versions of a value.
+type Sibling struct {
 	Value   []byte            `json:"value"`
 	Version map[string]uint64 `json:"version"`
 }
 
+// Internal replication types
+
+type ReplicateRequest struct {
+	Key       string            `json:"key"`
+	Value     []byte            `json:"value"`
+	Version   map[string]uint64 `json:"version"`
+	ExpiresAt time.Time         `json:"expires_at,omitzero"`
+	// Timestamp is when the coordinator accepted the write; it orders
+	// concurrent versions.
+	Timestamp time.Time `json:"timestamp,omitzero"`
+	// Checksum is the CRC32 (IEEE) of Value. Replicas refuse values that
+	// do not match it.
+	Checksum uint32 `json:"checksum"`
+	// HintFor names the down replica this write is meant for when the
+	// receiver is only a fallback for it; the receiver keeps it as a hint.
+	HintFor string `json:"hint_for,omitempty"`
+	// Tombstone marks a delete; Value then holds the deleted value.
+	Tombstone   bool              `json:"tombstone,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Meta        map[string]string `json:"meta,omitempty"`
+	// Siblings are the versions stored alongside this one, concurrent with
+	// it and with each other; the receiver keeps them all.
+	Siblings []ReplicateRequest `json:"siblings,omitempty"`
+}
+
+// ReplicateBatchRequest carries several replica writes applied in one storage batch.
+type ReplicateBatchRequest struct {
+	Items []ReplicateRequest `json:"items"`
+}
+
+// ReplicateBatchGetRequest asks a replica, at /internal/batch/get, for its
+// copies of several keys at once.
+type ReplicateBatchGetRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// ReplicateBatchGetResponse answers the keys of a ReplicateBatchGetRequest
+// in order.
+type ReplicateBatchGetResponse struct {
+	Items []ReplicateGetResponse `json:"items"`
+}
+
 type ReplicateResponse struct {
 	Success bool   `json:"success"`
 	Error   string `json:"error,omitempty"`
+	// Ack is how the node took the write: AckApplied, AckBuffered or
+	// AckStale. Nodes predating it leave it empty.
+	Ack string `json:"ack,omitempty"`
 }
 
+// The acknowledgements a node gives a replica write, which a write's
+// X-Consistency-Ack chooses between.
+const (
+	// AckApplied means the replica stored the write.
+	AckApplied = "applied"
+	// AckBuffered means the node kept the write as a hint for the replica
+	// it stands in for, to hand it off once that replica is back.
+	AckBuffered = "buffered"
+	// AckStale means the replica holds a newer version and rejected the
+	// write.
+	AckStale = "stale"
+)
+
 type ReplicateGetRequest struct {
 	Key string `json:"key"`
 }
 
 type ReplicateGetResponse struct {
+	Key       string            `json:"key"`
+	Value     []byte            `json:"value,omitempty"`
+	Version   map[string]uint64 `json:"version,omitempty"`
+	Found     bool              `json:"found"`
+	ExpiresAt time.Time         `json:"expires_at,omitzero"`
+	Timestamp time.Time         `json:"timestamp,omitzero"`
+	// Checksum is the CRC32 (IEEE) of Value, verified by the coordinator.
+	Checksum uint32 `json:"checksum"`
+	// Corrupt reports that the replica's copy failed checksum verification.
+	Corrupt bool `json:"corrupt,omitempty"`
+	// Tombstone reports a deleted key; Found is false and Version is the
+	// clock of the delete, so that it supersedes older values.
+	Tombstone bool `json:"tombstone,omitempty"`
+	// SyncedAt is when the replica last exchanged data with its peers;
+	// bounded staleness reads compare it against their bound.
+	SyncedAt    time.Time         `json:"synced_at,omitzero"`
+	ContentType string            `json:"content_type,omitempty"`
+	Meta        map[string]string `json:"meta,omitempty"`
+	// Siblings are the versions the replica stores alongside this one,
+	// concurrent with it and with each other.
+	Siblings []ReplicateGetResponse `json:"siblings,omitempty"`
+}
+
+// KeyMetadata describes a key and where it is placed without transferring
+// its value. It is served at /kv/{key}?metadata=true; the top-level fields
+// come from the most recently updated replica holding the key.
+type KeyMetadata struct {
 	Key     string            `json:"key"`
-	Value   []byte            `json:"value,omitempty"`
+	Found   bool              `json:"found"`
 	Version map[string]uint64 `json:"version,omitempty"`
+	// Size is the length of the value, after reassembly for chunked values.
+	Size      int       `json:"size"`
+	Chunks    int       `json:"chunks,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	// Tombstone reports a deleted key whose tombstone is still held.
+	Tombstone bool `json:"tombstone"`
+	// Reads sums the reads the replicas served of the key, as far as they
+	// count them, and LastRead is the latest of them. A key that is rarely
+	// read may have no count at all.
+	Reads    uint64            `json:"reads,omitempty"`
+	LastRead time.Time         `json:"last_read,omitzero"`
+	Replicas []ReplicaMetadata `json:"replicas"`
+}
+
+// ReplicaMetadata is one preference list member's view of a key. Replicas
+// serve it at /internal/storage/{key}?metadata=true.
+type ReplicaMetadata struct {
+	NodeID  string            `json:"node_id"`
+	Address string            `json:"address"`
 	Found   bool              `json:"found"`
+	Version map[string]uint64 `json:"version,omitempty"`
+	// Versions lists the clock of each version stored, one per sibling;
+	// Version merges them.
+	Versions []map[string]uint64 `json:"versions,omitempty"`
+	Size     int                 `json:"size,omitempty"`
+	Chunks   int                 `json:"chunks,omitempty"`
+	// Digest is the hex SHA-256 of the stored value, letting a coordinator
+	// compare replicas without transferring values.
+	Digest    string    `json:"digest,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	Tombstone bool      `json:"tombstone,omitempty"`
+	Corrupt   bool      `json:"corrupt,omitempty"`
+	Reads     uint64    `json:"reads,omitempty"`
+	LastRead  time.Time `json:"last_read,omitzero"`
+	// Error is set when the replica could not be reached.
+	Error string `json:"error,omitempty"`
+}
+
+// Types of WatchEvent.
+const (
+	WatchPut    = "put"
+	WatchDelete = "delete"
+)
+
+// WatchEvent is a write to a key, sent as the data of a server-sent event
+// by the watches at /kv/{key}/watch and /kv/_watch. Values of chunked
+// writes are left out and must be read.
+type WatchEvent struct {
+	Type    string            `json:"type"`
+	Key     string            `json:"key"`
+	Value   []byte            `json:"value,omitempty"`
+	Version map[string]uint64 `json:"version,omitempty"`
+}
+
+// ScanResponse is one page of a scan served at /scan. Cursor is empty on
+// the last page; otherwise it continues the scan after this page, from the
+// same snapshot until CursorExpiresAt and from current data after it.
+type ScanResponse struct {
+	Items           []ScanItem `json:"items"`
+	Cursor          string     `json:"cursor,omitempty"`
+	CursorExpiresAt time.Time  `json:"cursor_expires_at,omitzero"`
+}
+
+// ScanItem is a key and its value as of the start of the scan.
+type ScanItem struct {
+	Key       string            `json:"key"`
+	Value     []byte            `json:"value"`
+	ExpiresAt time.Time         `json:"expires_at,omitzero"`
+	Version   map[string]uint64 `json:"version,omitempty"`
+}
+
+// KeyRangeResponse is one page of the keys in a range, served at GET /kv/
+// in key order. Cursor is empty on the last page; otherwise it continues
+// the range after the last key of this page.
+type KeyRangeResponse struct {
+	Items  []ScanItem `json:"items"`
+	Cursor string     `json:"cursor,omitempty"`
+}
+
+// KeyRangeRequest asks a replica for the first Limit keys under Prefix
+// from Start up to but not including End, which is unbounded when empty.
+// With KeysOnly the replica leaves out the values.
+type KeyRangeRequest struct {
+	Prefix   string `json:"prefix,omitempty"`
+	Start    string `json:"start,omitempty"`
+	End      string `json:"end,omitempty"`
+	Limit    int    `json:"limit"`
+	KeysOnly bool   `json:"keys_only,omitempty"`
+}
+
+// KeyRangeListing is a replica's copies of the keys a KeyRangeRequest
+// covers, tombstones included, in key order. Next is set to the last key
+// the replica looked at when it stopped at the limit before the end of
+// the range.
+type KeyRangeListing struct {
+	Items []ReplicateGetResponse `json:"items"`
+	Next  string                 `json:"next,omitempty"`
+}
+
+// RingResponse is the topology served at /ring. Clients rebuild the ring
+// from it to route keys and compare Epoch with the X-Ring-Epoch response
+// header to notice when it goes stale.
+type RingResponse struct {
+	Epoch             uint64            `json:"epoch"`
+	VNodes            int               `json:"vnodes"`
+	ReplicationFactor int               `json:"replication_factor"`
+	Nodes             map[string]string `json:"nodes"`
+}
+
+// Namespace is a named partition of the key space. Keys of the form
+// "{namespace}/{key}" may only be used once their namespace is created.
+type Namespace struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// CoalesceWindowMillis, when positive, merges PUTs to the same key that
+	// arrive within this many milliseconds so only the last is replicated.
+	CoalesceWindowMillis int64 `json:"coalesce_window_ms,omitempty"`
+	// ValueType, when set, makes every value written to the namespace of
+	// that type, as if each PUT carried it in X-Value-Type.
+	ValueType string `json:"value_type,omitempty"`
+	// Keys and Bytes are the answering node's share of the namespace's data.
+	Keys  int   `json:"keys,omitempty"`
+	Bytes int64 `json:"bytes,omitempty"`
+}
+
+// Value types that replicas merge instead of keeping concurrent writes as
+// siblings. An ORSet value is written and read as a JSON array of strings,
+// an LWWMap value as a JSON object.
+const (
+	ValueTypeORSet  = "orset"
+	ValueTypeLWWMap = "lwwmap"
+)
+
+// NamespacesResponse lists the namespaces served at /namespaces.
+type NamespacesResponse struct {
+	Namespaces []Namespace `json:"namespaces"`
+}
+
+// Member identifies a node incarnation. Nodes POST their own Member to
+// /internal/join on startup and receive the peer's Member in reply.
+type Member struct {
+	NodeID      string `json:"node_id"`
+	Address     string `json:"address"`
+	Incarnation uint64 `json:"incarnation"`
+	// Placement is the fingerprint of how the node places keys on the
+	// ring. A join between nodes whose fingerprints differ is refused.
+	Placement string `json:"placement,omitempty"`
+	// Meta is the membership metadata the node announces about itself,
+	// such as its datacenter under MetaDatacenter.
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+const (
+	// MetaDatacenter is the Member.Meta key naming the datacenter of a
+	// node.
+	MetaDatacenter = "dc"
+	// MetaCodecs is the Member.Meta key listing the codecs a node
+	// compresses internal bodies with, comma separated in its order of
+	// preference.
+	MetaCodecs = "codecs"
+)
+
+// Operational types
+
+// StatsResponse is the lightweight snapshot served at /stats.
+type StatsResponse struct {
+	NodeID            string    `json:"node_id"`
+	Version           string    `json:"version"`
+	Time              time.Time `json:"time"`
+	UptimeSeconds     float64   `json:"uptime_seconds"`
+	ReplicationFactor int       `json:"replication_factor"`
+	ReadQuorum        int       `json:"read_quorum"`
+	WriteQuorum       int       `json:"write_quorum"`
+	KeyCount          int       `json:"key_count"`
+	Evictions         uint64    `json:"evictions"`
+	// Purges counts expired values and tombstones dropped to make room
+	// before live values had to be evicted.
+	Purges          uint64 `json:"purges"`
+	Requests        int64  `json:"requests"`
+	Panics          int64  `json:"panics"`
+	CoalescedWrites int64  `json:"coalesced_writes"`
+	// IdempotentReplays counts writes answered with the response to an
+	// earlier request carrying the same Idempotency-Key.
+	IdempotentReplays int64 `json:"idempotent_replays"`
+	// LocalReads, BoundedReads, DigestReads and QuorumReads count reads by
+	// how much of the value had to cross the network, see the read path
+	// constants.
+	LocalReads   int64 `json:"local_reads"`
+	BoundedReads int64 `json:"bounded_reads"`
+	DigestReads  int64 `json:"digest_reads"`
+	QuorumReads  int64 `json:"quorum_reads"`
+	// ReadRepairs counts replicas overwritten because a quorum read found
+	// them stale, missing the value or corrupt.
+	ReadRepairs     int64             `json:"read_repairs"`
+	QPS             float64           `json:"qps"`
+	ClientErrorRate float64           `json:"client_error_rate"`
+	ServerErrorRate float64           `json:"server_error_rate"`
+	Peers           map[string]string `json:"peers"`
+	// HintedHandoff reports whether the node keeps hints for peers that
+	// are down, and HintBacklog and HintBytes what it has queued.
+	HintedHandoff bool  `json:"hinted_handoff"`
+	HintBacklog   int   `json:"hint_backlog"`
+	HintBytes     int64 `json:"hint_bytes"`
+	// OnDisk reports whether the node keeps data on disk, and DiskPercent
+	// how full the file system holding it is.
+	OnDisk      bool    `json:"on_disk"`
+	DiskPercent float64 `json:"disk_percent"`
+}
+
+// StorageStatsResponse is the storage engine summary served at /admin/storage.
+type StorageStatsResponse struct {
+	Keys       int                       `json:"keys"`
+	Bytes      int64                     `json:"bytes"`
+	Tombstones int                       `json:"tombstones"`
+	Namespaces map[string]NamespaceStats `json:"namespaces"`
+}
+
+// NamespaceStats is the share of StorageStatsResponse in one key namespace.
+type NamespaceStats struct {
+	Keys       int   `json:"keys"`
+	Bytes      int64 `json:"bytes"`
+	Tombstones int   `json:"tombstones"`
+}
+
+// SampleResponse is a uniform random sample of the live keys a node holds,
+// served at /admin/sample. Total is the number of keys it was drawn from.
+type SampleResponse struct {
+	NodeID   string       `json:"node_id"`
+	Total    int          `json:"total"`
+	MeanSize float64      `json:"mean_size"`
+	Items    []SampleItem `json:"items"`
+}
+
+// SampleItem is one sampled key with the size and version of its value.
+type SampleItem struct {
+	Key     string            `json:"key"`
+	Size    int               `json:"size"`
+	Version map[string]uint64 `json:"version"`
+}
+
+// HotKeysResponse lists the keys a node served the most reads of, most
+// read first, served at /admin/hotkeys. Counts are approximate: Reads
+// overstates a key's reads by at most Error.
+type HotKeysResponse struct {
+	NodeID string   `json:"node_id"`
+	Keys   []HotKey `json:"keys"`
+}
+
+// HotKey is one key of a HotKeysResponse.
+type HotKey struct {
+	Key      string    `json:"key"`
+	Reads    uint64    `json:"reads"`
+	Error    uint64    `json:"error,omitempty"`
+	LastRead time.Time `json:"last_read"`
+}
+
+// MirrorReport describes the traffic mirrored to a shadow cluster and is
+// served at /admin/mirror.
+type MirrorReport struct {
+	Target  string  `json:"target"`
+	Percent float64 `json:"percent"`
+	// Mirrored counts requests sent to the mirror; Dropped counts sampled
+	// requests skipped because too many were in flight.
+	Mirrored int64 `json:"mirrored"`
+	Dropped  int64 `json:"dropped"`
+	// Failed counts mirrored requests that got no answer.
+	Failed int64 `json:"failed"`
+	// Diverged counts mirrored requests answered differently than on this
+	// cluster; Samples holds the most recent of them, oldest first.
+	Diverged int64              `json:"diverged"`
+	Samples  []MirrorDivergence `json:"samples"`
+}
+
+// MirrorDivergence is one mirrored request the shadow cluster answered differently.
+type MirrorDivergence struct {
+	Key    string    `json:"key"`
+	Op     string    `json:"op"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// NodeCapacity is how close one node is to its limits, served at
+// /internal/capacity. Percentages are zero for a dimension the node has
+// no limit for.
+type NodeCapacity struct {
+	NodeID        string  `json:"node_id"`
+	MemoryPercent float64 `json:"memory_percent"`
+	DiskPercent   float64 `json:"disk_percent"`
+	// QPS is the request rate since the previous capacity reading and
+	// QPSPercent its share of the rate the node is sized for.
+	QPS        float64 `json:"qps"`
+	QPSPercent float64 `json:"qps_percent"`
+	// Score is the highest percentage, i.e. the limit the node hits first.
+	Score float64 `json:"score"`
+	Error string  `json:"error,omitempty"`
+}
+
+// Capacity states of a cluster, from its score and the configured thresholds.
+const (
+	CapacityLow    = "low"
+	CapacityNormal = "normal"
+	CapacityHigh   = "high"
+)
+
+// ClusterCapacity aggregates the capacity of every ring member for
+// autoscalers and is served at /admin/capacity.
+type ClusterCapacity struct {
+	Time time.Time `json:"time"`
+	// Score averages the scores of the nodes that answered; MaxScore is
+	// the score of the busiest one.
+	Score    float64        `json:"score"`
+	MaxScore float64        `json:"max_score"`
+	State    string         `json:"state"`
+	Nodes    []NodeCapacity `json:"nodes"`
+}
+
+// CapacityEvent is posted to the capacity webhook when the cluster
+// capacity state changes.
+type CapacityEvent struct {
+	Previous string          `json:"previous"`
+	State    string          `json:"state"`
+	Capacity ClusterCapacity `json:"capacity"`
+}
+
+// Alert states.
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertEvent is logged, and posted to the alert webhook, when an alert
+// rule of a node starts or stops firing.
+type AlertEvent struct {
+	NodeID    string    `json:"node_id"`
+	Rule      string    `json:"rule"` // e.g. "hint_backlog>1000"
+	Metric    string    `json:"metric"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	State     string    `json:"state"` // AlertFiring or AlertResolved
+	Time      time.Time `json:"time"`
+}
+
+// AlertStatus is where an alert rule stood at its last check. Value and
+// Since are unset until the rule's metric was first read.
+type AlertStatus struct {
+	Rule  string    `json:"rule"`
+	State string    `json:"state"`
+	Value float64   `json:"value"`
+	Since time.Time `json:"since"`
+}
+
+// AlertsResponse lists the alert rules of a node.
+type AlertsResponse struct {
+	NodeID string        `json:"node_id"`
+	Alerts []AlertStatus `json:"alerts"`
+}
+
+// StatsSample summarizes one minute or one hour of a node's activity.
+// Counters count events within the period; Keys and Bytes are the largest
+// values seen in it.
+type StatsSample struct {
+	Time         time.Time `json:"time"` // start of the period
+	Requests     int64     `json:"requests"`
+	ClientErrors int64     `json:"client_errors"`
+	ServerErrors int64     `json:"server_errors"`
+	ReadRepairs  int64     `json:"read_repairs"`
+	Evictions    uint64    `json:"evictions"`
+	QPS          float64   `json:"qps"`
+	Keys         int       `json:"keys"`
+	Bytes        int64     `json:"bytes"`
+}
+
+// StatsHistory is served at /admin/stats/history, oldest sample first.
+type StatsHistory struct {
+	Resolution string        `json:"resolution"`
+	Samples    []StatsSample `json:"samples"`
+}
+
+// SnapshotRequest asks a node, at POST /admin/snapshot, to snapshot its
+// storage once its hybrid logical clock reaches At.
+type SnapshotRequest struct {
+	ID string    `json:"id"`
+	At time.Time `json:"at"`
+}
+
+// NodeSnapshot describes a snapshot one node wrote to its data directory.
+type NodeSnapshot struct {
+	ID     string `json:"id"`
+	NodeID string `json:"node_id"`
+	// Address is filled in by dhtctl; nodes leave it empty.
+	Address string `json:"address,omitempty"`
+	// HLCWallTime and HLCLogical are the node's hybrid logical clock when
+	// the snapshot was taken.
+	HLCWallTime int64  `json:"hlc_wall_time"`
+	HLCLogical  uint32 `json:"hlc_logical"`
+	Keys        int    `json:"keys"`
+	Bytes       int64  `json:"bytes"`
+	// Path is the snapshot file on the node and SHA256 the hex digest of
+	// its contents.
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// SnapshotEntry is one stored value in a snapshot file.
+type SnapshotEntry struct {
+	Key         string            `json:"key"`
+	Value       []byte            `json:"value"`
+	Version     map[string]uint64 `json:"version,omitempty"`
+	UpdatedAt   time.Time         `json:"updated_at,omitzero"`
+	ExpiresAt   time.Time         `json:"expires_at,omitzero"`
+	ContentType string            `json:"content_type,omitempty"`
+	Meta        map[string]string `json:"meta,omitempty"`
+}
+
+// ClusterSnapshot is the manifest dhtctl snapshot --cluster records,
+// linking the snapshots every node took at about the same time.
+type ClusterSnapshot struct {
+	ID        string         `json:"id"`
+	At        time.Time      `json:"at"`
+	RingEpoch uint64         `json:"ring_epoch,omitempty"`
+	Nodes     []NodeSnapshot `json:"nodes"`
+	// Failed maps the address of each node that did not take its
+	// snapshot to the error; a manifest with failures is incomplete.
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// SnapshotFile is the contents of a node's snapshot file. POST
+// /admin/restore takes one as its body.
+type SnapshotFile struct {
+	NodeSnapshot
+	Entries []SnapshotEntry `json:"entries"`
+}
+
+// RestoreResponse reports how the entries of one snapshot file were
+// written to their owners in the restoring cluster's ring.
+type RestoreResponse struct {
+	ID     string `json:"id"`
+	NodeID string `json:"node_id"`
+	// Restored entries reached every owner, or at least the write quorum
+	// with hints kept for the rest. Current entries were already held at
+	// a newer version, and Expired ones were skipped.
+	Restored int `json:"restored"`
+	Current  int `json:"current"`
+	Expired  int `json:"expired"`
+	Failed   int `json:"failed"`
+	// Errors holds the first few failures.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ImportResponse is the result of POST /admin/import.
+type ImportResponse struct {
+	// Imported records were written with the write quorum; Expired ones
+	// were skipped.
+	Imported int `json:"imported"`
+	Expired  int `json:"expired"`
+	Failed   int `json:"failed"`
+	// Errors holds the first few failures.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// RangeListing is what a replica holds in one token range: the version of
+// every key, tombstones included. Anti-entropy compares listings.
+type RangeListing struct {
+	Entries []RangeEntry `json:"entries"`
+}
+
+// RangeEntry is one key of a RangeListing, with the metadata it is stored
+// with so that a node streaming the range can verify its copy.
+type RangeEntry struct {
+	Key       string            `json:"key"`
+	Version   map[string]uint64 `json:"version,omitempty"`
+	Tombstone bool              `json:"tombstone,omitempty"`
+	Timestamp time.Time         `json:"timestamp,omitzero"`
+	ExpiresAt time.Time         `json:"expires_at,omitzero"`
+	// Checksum is the CRC32 (IEEE) of the value; a tombstone's is not
+	// compared, as tombstones are read without their value.
+	Checksum uint32 `json:"checksum,omitempty"`
+	// Siblings counts the versions stored alongside the entry's own, whose
+	// clocks Version then merges.
+	Siblings int `json:"siblings,omitempty"`
+}
+
+// RepairStatus is the progress of anti-entropy on one node, served at
+// /admin/repair/status.
+type RepairStatus struct {
+	NodeID string `json:"node_id"`
+	// Ranges counts the token ranges this node is the primary replica of
+	// and so repairs; Repaired those repaired at least once.
+	Ranges   int `json:"ranges"`
+	Repaired int `json:"repaired"`
+	// OldestRepair is the last repair of the range repaired longest ago,
+	// zero while some range was never repaired.
+	OldestRepair     time.Time     `json:"oldest_repair,omitzero"`
+	Interval         string        `json:"interval"`
+	RateBytes        int64         `json:"rate_bytes"`
+	Concurrency      int           `json:"concurrency"`
+	BytesTransferred int64         `json:"bytes_transferred"`
+	RangeStatus      []RangeRepair `json:"range_status"`
+}
+
+// RepairReport is the outcome of a repair an operator ran with POST
+// /admin/repair: the token ranges repaired and the keys compared, pushed
+// to and pulled from other replicas across all of them.
+type RepairReport struct {
+	NodeID string        `json:"node_id"`
+	Ranges []RangeRepair `json:"ranges"`
+	Keys   int           `json:"keys"`
+	Pushed int           `json:"pushed"`
+	Pulled int           `json:"pulled"`
+}
+
+// ReplicaAudit is the outcome of a replica count audit, served at
+// /admin/audit: of the keys sampled, how many had fewer live copies than
+// replicas, and how many of those were copied to the replicas lacking
+// them. Unreachable counts replicas that did not answer, which an audit
+// cannot repair.
+type ReplicaAudit struct {
+	NodeID          string    `json:"node_id"`
+	At              time.Time `json:"at"`
+	Sampled         int       `json:"sampled"`
+	UnderReplicated int       `json:"under_replicated"`
+	Repaired        int       `json:"repaired"`
+	Unreachable     int       `json:"unreachable"`
+	// Keys lists the under-replicated keys, at most 20 of them.
+	Keys []AuditedKey `json:"keys,omitempty"`
+}
+
+// AuditedKey is an under-replicated key found by an audit: the replicas
+// that should hold it and those that did.
+type AuditedKey struct {
+	Key      string   `json:"key"`
+	Replicas []string `json:"replicas"`
+	Live     []string `json:"live"`
+	Repaired bool     `json:"repaired"`
+}
+
+// RangeRepair is the anti-entropy state of one token range. Start and End
+// are the hex ring positions bounding it, as (Start, End].
+type RangeRepair struct {
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Replicas []string `json:"replicas"`
+	Running  bool     `json:"running,omitempty"`
+	// The last repair: when it finished, how many keys it compared and
+	// how many it pushed to or pulled from other replicas.
+	LastRepaired time.Time `json:"last_repaired,omitzero"`
+	Keys         int       `json:"keys"`
+	Pushed       int       `json:"pushed"`
+	Pulled       int       `json:"pulled"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// BootstrapStatus is the progress of a joining node streaming the token
+// ranges it took over from their previous owners, served at
+// /admin/bootstrap/status. The node reports ready once it is done.
+type BootstrapStatus struct {
+	NodeID string `json:"node_id"`
+	// State is "joining", "streaming", "done" or "failed"; a failed
+	// bootstrap leaves the ranges it could not stream to anti-entropy.
+	State string `json:"state"`
+	// Ranges counts the token ranges to stream and Streamed those done.
+	Ranges     int       `json:"ranges"`
+	Streamed   int       `json:"streamed"`
+	Keys       int       `json:"keys"`
+	Bytes      int64     `json:"bytes"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+	Errors     []string  `json:"errors,omitempty"`
+}
+
+// DecommissionStatus is the progress of a node handing its token ranges to
+// their new owners before it leaves the ring, served at
+// /admin/decommission.
+type DecommissionStatus struct {
+	NodeID string `json:"node_id"`
+	// State is "active" until a decommission starts, then "streaming",
+	// and finally "left" or, when some range could not be handed off,
+	// "failed" with the node still in the ring.
+	State string `json:"state"`
+	// Ranges counts the token ranges that change owners and HandedOff
+	// those whose new owners were verified to hold every key.
+	Ranges     int       `json:"ranges"`
+	HandedOff  int       `json:"handed_off"`
+	Keys       int       `json:"keys"`
+	Bytes      int64     `json:"bytes"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+	Errors     []string  `json:"errors,omitempty"`
+}
+
+// Rebalance operations and the events they publish on
+// /admin/rebalance/watch.
+const (
+	RebalanceBootstrap    = "bootstrap"
+	RebalanceDecommission = "decommission"
+
+	RebalanceStarted     = "started"
+	RebalanceRangeMoved  = "range_moved"
+	RebalanceRangeFailed = "range_failed"
+	RebalanceFinished    = "finished"
+)
+
+// RebalanceEvent reports the progress of a node streaming the token ranges
+// it gained when it joined, or handing off those it loses by leaving.
+type RebalanceEvent struct {
+	NodeID    string `json:"node_id"`
+	Operation string `json:"operation"` // RebalanceBootstrap or RebalanceDecommission
+	Type      string `json:"type"`
+	// Range is the range moved or failed, as "(start, end]"; Error says
+	// why it failed.
+	Range string `json:"range,omitempty"`
+	Error string `json:"error,omitempty"`
+	// State, Ranges, Moved, Keys and Bytes are those of the operation's
+	// status after the event; Percent is Moved as a share of Ranges.
+	State   string    `json:"state"`
+	Ranges  int       `json:"ranges"`
+	Moved   int       `json:"moved"`
+	Percent float64   `json:"percent"`
+	Keys    int       `json:"keys"`
+	Bytes   int64     `json:"bytes"`
+	Time    time.Time `json:"time"`
+}
+
+// MemberState is a ring member as the answering node sees it, listed by
+// /admin/members. State is "alive" or "dead".
+type MemberState struct {
+	Member
+	State string `json:"state"`
+	// Codecs are the codecs the member advertised, in its order of
+	// preference.
+	Codecs []string `json:"codecs,omitempty"`
+	// Codec is the codec this node compresses the bodies it sends the
+	// member with.
+	Codec string `json:"codec,omitempty"`
+}
+
+// MemberRemoval reports the eviction of a dead node, answered by
+// /admin/members/{id}/remove.
+type MemberRemoval struct {
+	Member Member `json:"member"`
+	// Errors lists the peers that could not be told to remove the node;
+	// they keep it in their rings until told again.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Eviction records a dead node evicted by an operator, as listed at
+// /admin/members/evictions on the node the eviction was requested from.
+type Eviction struct {
+	Member Member    `json:"member"`
+	At     time.Time `json:"at"`
+	// From is the address the request came from, and Operator the
+	// operator it named in X-Operator, if any.
+	From     string `json:"from"`
+	Operator string `json:"operator,omitempty"`
+	// Errors lists the peers that could not be told to remove the node.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// TombstoneList lists the oldest tombstones a node holds, served at
+// /admin/tombstones. Total counts every tombstone that matched.
+type TombstoneList struct {
+	NodeID     string      `json:"node_id"`
+	Total      int         `json:"total"`
+	Tombstones []Tombstone `json:"tombstones"`
+}
+
+// Tombstone is a deleted key with the version it was deleted under.
+type Tombstone struct {
+	Key       string            `json:"key"`
+	Version   map[string]uint64 `json:"version"`
+	DeletedAt time.Time         `json:"deleted_at"`
+}
+
+// TombstonePurge reports the tombstones /admin/tombstones/purge removed.
+// Grace is the age they had to reach, empty when the purge was forced.
+type TombstonePurge struct {
+	NodeID string `json:"node_id"`
+	Purged int    `json:"purged"`
+	Grace  string `json:"grace,omitempty"`
+}
+
+// StandbyStatus is the state of a warm standby node, served at
+// /admin/standby.
+type StandbyStatus struct {
+	// Primary is the node the standby shadows and whose ID it takes over.
+	Primary        string `json:"primary"`
+	PrimaryAddress string `json:"primary_address,omitempty"`
+	// State is "syncing" while the standby copies the primary's ranges
+	// and "promoted" once it has taken over the primary's tokens.
+	State string `json:"state"`
+	// Keys and Bytes count what the standby copied from the primary.
+	Keys  int   `json:"keys"`
+	Bytes int64 `json:"bytes"`
+	// LastSync is when the standby last copied every range of the
+	// primary, and PrimarySeen when the primary last answered a ping.
+	LastSync    time.Time `json:"last_sync,omitzero"`
+	PrimarySeen time.Time `json:"primary_seen,omitzero"`
+	PromotedAt  time.Time `json:"promoted_at,omitzero"`
+	Errors      []string  `json:"errors,omitempty"`
 }
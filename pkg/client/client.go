@@ -0,0 +1,310 @@
+// Package client is a Go SDK for the DHT's HTTP API. It routes each key to
+// the node that owns it and follows ring changes by watching the
+// X-Ring-Epoch response header. Each node counts its own epoch, so the
+// client remembers the last epoch seen from every node it talks to.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/pkg/api"
+)
+
+const (
+	ringEpochHeader = "X-Ring-Epoch"
+	// checksumHeader carries the CRC32 (IEEE) of a PUT body so the node
+	// can refuse a value corrupted in transit.
+	checksumHeader = "X-Checksum"
+)
+
+// ErrChecksumMismatch reports a value that does not match the checksum the
+// node sent with it, i.e. one corrupted between the node and the client.
+var ErrChecksumMismatch = errors.New("value does not match its checksum")
+
+// StatusError is a non-success response from a node.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.Code, e.Message)
+}
+
+// KV is the key-value API of a Client. Code that takes a KV rather than a
+// *Client can be tested against the in-memory fake.Client without nodes.
+type KV interface {
+	Get(ctx context.Context, key string, opts ...CallOption) (api.GetResponse, error)
+	Put(ctx context.Context, key string, value []byte, opts ...CallOption) (api.PutResponse, error)
+	Delete(ctx context.Context, key string, opts ...CallOption) error
+}
+
+var _ KV = (*Client)(nil)
+
+// Client routes requests by key. It is safe for concurrent use.
+type Client struct {
+	http       *http.Client
+	seeds      []string
+	maxRetries int
+
+	mu     sync.RWMutex
+	ring   *ring.Ring
+	epochs map[string]uint64 // node address -> last epoch seen from it
+}
+
+// New returns a client that bootstraps its topology from any of seeds (host:port).
+func New(seeds []string) *Client {
+	return &Client{
+		http:       &http.Client{Timeout: 5 * time.Second},
+		seeds:      seeds,
+		maxRetries: 3,
+		epochs:     make(map[string]uint64),
+	}
+}
+
+// Nodes returns the client's current view of the ring as node ID -> address.
+func (c *Client) Nodes() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	nodes := make(map[string]string)
+	if c.ring != nil {
+		for nodeID, address := range c.ring.GetNodes() {
+			nodes[string(nodeID)] = address
+		}
+	}
+	return nodes
+}
+
+// Refresh reloads the topology from the first known node or seed that answers.
+func (c *Client) Refresh(ctx context.Context) error {
+	return c.refresh(ctx, "")
+}
+
+// refresh reloads the topology, asking preferred first when it is set.
+func (c *Client) refresh(ctx context.Context, preferred string) error {
+	candidates := c.candidates()
+	if preferred != "" {
+		candidates = append([]string{preferred}, candidates...)
+	}
+	var lastErr error
+	for _, addr := range candidates {
+		topology, err := c.fetchRing(ctx, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		r := ring.New(topology.VNodes)
+		for nodeID, address := range topology.Nodes {
+			r.AddNode(ring.NodeID(nodeID), address)
+		}
+		c.mu.Lock()
+		c.ring = r
+		c.epochs[addr] = topology.Epoch
+		c.mu.Unlock()
+		return nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no seed nodes configured")
+	}
+	return fmt.Errorf("failed to refresh topology: %w", lastErr)
+}
+
+// candidates lists known ring members followed by the seeds.
+func (c *Client) candidates() []string {
+	var addrs []string
+	c.mu.RLock()
+	if c.ring != nil {
+		for _, address := range c.ring.GetNodes() {
+			addrs = append(addrs, address)
+		}
+	}
+	c.mu.RUnlock()
+	return append(addrs, c.seeds...)
+}
+
+func (c *Client) fetchRing(ctx context.Context, addr string) (api.RingResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/ring", addr), nil)
+	if err != nil {
+		return api.RingResponse{}, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return api.RingResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return api.RingResponse{}, fmt.Errorf("node %s returned status %d", addr, resp.StatusCode)
+	}
+	var topology api.RingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&topology); err != nil {
+		return api.RingResponse{}, err
+	}
+	return topology, nil
+}
+
+// Get returns the value for key. A missing key is not an error.
+func (c *Client) Get(ctx context.Context, key string, opts ...CallOption) (api.GetResponse, error) {
+	var response api.GetResponse
+	body, status, err := c.do(ctx, http.MethodGet, key, nil, opts)
+	if err != nil {
+		return response, err
+	}
+	if status != http.StatusOK && status != http.StatusNotFound {
+		return response, statusError(status, body)
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return response, err
+	}
+	if response.Found && crc32.ChecksumIEEE(response.Value) != response.Checksum {
+		return api.GetResponse{}, fmt.Errorf("key %s: %w", key, ErrChecksumMismatch)
+	}
+	return response, nil
+}
+
+// Put stores value under key.
+func (c *Client) Put(ctx context.Context, key string, value []byte, opts ...CallOption) (api.PutResponse, error) {
+	var response api.PutResponse
+	body, status, err := c.do(ctx, http.MethodPut, key, value, opts)
+	if err != nil {
+		return response, err
+	}
+	if status != http.StatusOK {
+		return response, statusError(status, body)
+	}
+	err = json.Unmarshal(body, &response)
+	return response, err
+}
+
+// Delete removes key.
+func (c *Client) Delete(ctx context.Context, key string, opts ...CallOption) error {
+	body, status, err := c.do(ctx, http.MethodDelete, key, nil, opts)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusNoContent && status != http.StatusOK {
+		return statusError(status, body)
+	}
+	return nil
+}
+
+// do sends a key request to the key's owner and retries it after refreshing
+// the topology when the node is unreachable, reports that it no longer holds
+// the key, or fails after its ring epoch has moved on.
+func (c *Client) do(ctx context.Context, method, key string, value []byte, opts []CallOption) ([]byte, int, error) {
+	o := resolveOptions(ctx, opts)
+	key = o.key(key)
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	c.mu.RLock()
+	loaded := c.ring != nil
+	c.mu.RUnlock()
+	if !loaded {
+		if err := c.Refresh(ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		addr, known, seen, err := c.owner(key)
+		if err != nil {
+			return nil, 0, err
+		}
+		body, status, epoch, err := c.send(ctx, method, addr, key, value, o, known, seen)
+		changed := false
+		if err == nil {
+			changed = seen && epoch != known
+			c.mu.Lock()
+			c.epochs[addr] = epoch
+			c.mu.Unlock()
+		}
+		switch {
+		case err != nil:
+			lastErr = err
+		case status == http.StatusMisdirectedRequest:
+			lastErr = statusError(status, body)
+		case changed && status >= http.StatusInternalServerError:
+			lastErr = statusError(status, body)
+		default:
+			if changed {
+				// The request succeeded; pick up the new ring for the next one
+				c.refresh(ctx, addr)
+			}
+			return body, status, nil
+		}
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		if err := c.refresh(ctx, addr); err != nil {
+			return nil, 0, err
+		}
+	}
+	return nil, 0, fmt.Errorf("giving up on key %s after %d attempts: %w", key, c.maxRetries+1, lastErr)
+}
+
+// owner returns the address of the first replica for key and the last epoch
+// seen from that node, if any.
+func (c *Client) owner(key string) (addr string, epoch uint64, seen bool, err error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	prefList, err := c.ring.GetPreferenceList(key, 1)
+	if err != nil {
+		return "", 0, false, err
+	}
+	addr, _ = c.ring.GetNodeAddress(prefList[0])
+	epoch, seen = c.epochs[addr]
+	return addr, epoch, seen, nil
+}
+
+// send issues one request, stating the node's epoch the route was based on when known.
+func (c *Client) send(ctx context.Context, method, addr, key string, value []byte, o callOptions, epoch uint64, seen bool) ([]byte, int, uint64, error) {
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("http://%s/kv/%s", addr, url.PathEscape(key)), bytes.NewReader(value))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	o.setHeaders(ctx, method, req.Header)
+	if seen {
+		req.Header.Set(ringEpochHeader, strconv.FormatUint(epoch, 10))
+	}
+	if method == http.MethodPut {
+		req.Header.Set(checksumHeader, strconv.FormatUint(uint64(crc32.ChecksumIEEE(value)), 10))
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	respEpoch, _ := strconv.ParseUint(resp.Header.Get(ringEpochHeader), 10, 64)
+	return body, resp.StatusCode, respEpoch, nil
+}
+
+func statusError(status int, body []byte) error {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) != nil || payload.Error == "" {
+		payload.Error = http.StatusText(status)
+	}
+	return &StatusError{Code: status, Message: payload.Error}
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/internal/ring"
+	"github.com/amirderis/DHT/internal/server"
+)
+
+type testNode struct {
+	id   string
+	addr string
+	srv  *server.HTTPServer
+}
+
+func startNode(t *testing.T, id string) *testNode {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	cfg := &config.Config{NodeID: id, BindAddr: l.Addr().String(), ReplicationFactor: 1, ReadQuorum: 1, WriteQuorum: 1}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Failed to validate config: %v", err)
+	}
+	srv := server.NewHTTPServer(cfg)
+	ts := httptest.NewUnstartedServer(srv.Handler())
+	ts.Listener.Close()
+	ts.Listener = l
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return &testNode{id: id, addr: cfg.BindAddr, srv: srv}
+}
+
+func TestClientRetriesAfterTopologyChange(t *testing.T) {
+	a := startNode(t, "a")
+	c := New([]string{a.addr})
+	ctx := context.Background()
+
+	if _, err := c.Put(ctx, "warmup", []byte("v")); err != nil {
+		t.Fatalf("Failed to put through single node: %v", err)
+	}
+
+	// Node b joins; only the servers learn about it
+	b := startNode(t, "b")
+	a.srv.Ring().JoinNode("b", b.addr, 1)
+	b.srv.Ring().JoinNode("a", a.addr, 1)
+
+	var key string
+	for i := 0; ; i++ {
+		key = "key-" + strconv.Itoa(i)
+		if owners, _ := a.srv.Ring().GetPreferenceList(key, 1); owners[0] == ring.NodeID("b") {
+			break
+		}
+	}
+
+	if _, err := c.Put(ctx, key, []byte("value")); err != nil {
+		t.Fatalf("Expected put to succeed after retrying on the new owner: %v", err)
+	}
+	if len(c.Nodes()) != 2 {
+		t.Errorf("Expected client to refresh to 2 nodes, got %v", c.Nodes())
+	}
+	resp, err := c.Get(ctx, key)
+	if err != nil || !resp.Found || string(resp.Value) != "value" {
+		t.Errorf("Expected to read back value from the new owner, got %+v, %v", resp, err)
+	}
+}
+
+func TestClientCallOptions(t *testing.T) {
+	a := startNode(t, "a")
+	c := New([]string{a.addr})
+	var mu sync.Mutex
+	var sent []*http.Request
+	c.http.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		sent = append(sent, req)
+		mu.Unlock()
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	last := func() *http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return sent[len(sent)-1]
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, "http://"+a.addr+"/namespaces/orders", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to create namespace: %v", err)
+	}
+	resp.Body.Close()
+
+	// Options on the context apply to every call, options on a call win
+	ctx := WithOptions(context.Background(), Bucket("orders"), Consistency("all"))
+	if _, err := c.Put(ctx, "order-1", []byte("value"), IdempotencyKey("put-1"), Timeout(time.Second)); err != nil {
+		t.Fatalf("Failed to put with options: %v", err)
+	}
+	put := last()
+	if put.URL.Path != "/kv/orders/order-1" {
+		t.Errorf("Expected the key to be addressed in its bucket, got %s", put.URL.Path)
+	}
+	if put.Header.Get(writeConsistencyHeader) != "all" || put.Header.Get(idempotencyKeyHeader) != "put-1" {
+		t.Errorf("Expected the write consistency and idempotency key to be sent, got %v", put.Header)
+	}
+	if timeout, err := strconv.Atoi(put.Header.Get(timeoutHeader)); err != nil || timeout <= 0 || timeout > 1000 {
+		t.Errorf("Expected the remaining timeout to be sent, got %q", put.Header.Get(timeoutHeader))
+	}
+
+	got, err := c.Get(ctx, "order-1", Consistency("one"))
+	if err != nil || !got.Found || string(got.Value) != "value" {
+		t.Errorf("Expected to read the value from the bucket, got %+v, %v", got, err)
+	}
+	if get := last(); get.Header.Get(readConsistencyHeader) != "one" || get.Header.Get(timeoutHeader) != "" {
+		t.Errorf("Expected only the read consistency to be sent, got %v", get.Header)
+	}
+	if got, _ := c.Get(context.Background(), "order-1"); got.Found {
+		t.Errorf("Expected the key outside the bucket to be missing, got %+v", got)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
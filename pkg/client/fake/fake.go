@@ -0,0 +1,289 @@
+// Package fake is an in-memory stand-in for the client SDK, for testing
+// applications without running nodes. A Client keeps every key in one map,
+// versions each write as a single node's vector clock would, and can be
+// told to answer slowly or to fail, so that an application's timeout and
+// error handling can be tested too.
+//
+// Code under test takes a client.KV, which both *client.Client and
+// *fake.Client implement:
+//
+//	kv := fake.New()
+//	kv.SetFailure(func(op fake.Op, key string) error {
+//		if op == fake.OpPut {
+//			return fake.StatusError(http.StatusServiceUnavailable, "quorum not reached")
+//		}
+//		return nil
+//	})
+package fake
+
+import (
+	"context"
+	"hash/crc32"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/api"
+	"github.com/amirderis/DHT/pkg/client"
+)
+
+// Op names the call a failure applies to.
+type Op string
+
+const (
+	OpGet    Op = "get"
+	OpPut    Op = "put"
+	OpDelete Op = "delete"
+)
+
+// DefaultNodeID is the node the versions of a Client count writes for
+// unless New is given another.
+const DefaultNodeID = "fake"
+
+// Client is an in-memory client.KV. Create one with New; it is safe for
+// concurrent use.
+type Client struct {
+	nodeID string
+
+	mu         sync.Mutex
+	values     map[string]*entry
+	idempotent map[idempotencyKey]result
+	latency    time.Duration
+	failure    func(op Op, key string) error
+	calls      map[Op]int
+}
+
+// entry is a key's latest write. A deleted key keeps its entry, as a node
+// keeps a tombstone, so that a later write still gets a newer version.
+type entry struct {
+	value   []byte
+	version uint64
+	deleted bool
+}
+
+type idempotencyKey struct {
+	key   string
+	token string
+}
+
+// result is the outcome of a write sent with an idempotency key.
+type result struct {
+	op       Op
+	response api.PutResponse
+}
+
+// An Option configures a Client.
+type Option func(*Client)
+
+// WithNodeID names the node the versions of writes are counted for.
+func WithNodeID(id string) Option {
+	return func(c *Client) { c.nodeID = id }
+}
+
+// WithLatency delays every call by d, as SetLatency does.
+func WithLatency(d time.Duration) Option {
+	return func(c *Client) { c.latency = d }
+}
+
+// New returns an empty Client.
+func New(opts ...Option) *Client {
+	c := &Client{
+		nodeID:     DefaultNodeID,
+		values:     make(map[string]*entry),
+		idempotent: make(map[idempotencyKey]result),
+		calls:      make(map[Op]int),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+var _ client.KV = (*Client)(nil)
+
+// SetLatency delays every later call by d before it takes effect. A call
+// whose context ends first, or whose Timeout passes first, fails with the
+// context's error and has no effect.
+func (c *Client) SetLatency(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latency = d
+}
+
+// SetFailure makes every later call for which fail returns an error fail
+// with it, without effect; nil lets every call through again. fail is
+// called with the key the call addresses, its bucket included.
+func (c *Client) SetFailure(fail func(op Op, key string) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failure = fail
+}
+
+// StatusError returns the error a node's response with status and message
+// is reported as, for use with SetFailure.
+func StatusError(status int, message string) error {
+	return &client.StatusError{Code: status, Message: message}
+}
+
+// Calls returns how many calls of op have been made, failed ones included.
+func (c *Client) Calls(op Op) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[op]
+}
+
+// Keys returns the keys that hold a value, in no particular order.
+func (c *Client) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.values))
+	for key, e := range c.values {
+		if !e.deleted {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Reset drops every key and remembered idempotency key, and the call
+// counts. Latency and failures stay as they were set.
+func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.values)
+	clear(c.idempotent)
+	clear(c.calls)
+}
+
+// Get returns the value for key. A missing key is not an error.
+func (c *Client) Get(ctx context.Context, key string, opts ...client.CallOption) (api.GetResponse, error) {
+	key, _, err := c.begin(ctx, OpGet, key, opts)
+	if err != nil {
+		return api.GetResponse{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.values[key]
+	if !ok || e.deleted {
+		return api.GetResponse{Key: key}, nil
+	}
+	return api.GetResponse{
+		Key:      key,
+		Value:    append([]byte(nil), e.value...),
+		Versions: []map[string]uint64{c.clock(e)},
+		Found:    true,
+		Checksum: crc32.ChecksumIEEE(e.value),
+	}, nil
+}
+
+// Put stores value under key with a version newer than any the key had.
+// A retry with the IdempotencyKey of an earlier Put of the key returns
+// that Put's response without writing again.
+func (c *Client) Put(ctx context.Context, key string, value []byte, opts ...client.CallOption) (api.PutResponse, error) {
+	key, token, err := c.begin(ctx, OpPut, key, opts)
+	if err != nil {
+		return api.PutResponse{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if response, replayed, err := c.replay(OpPut, key, token); replayed || err != nil {
+		return response, err
+	}
+	e := c.write(key)
+	e.value = append([]byte(nil), value...)
+	response := api.PutResponse{Version: c.clock(e)}
+	c.remember(OpPut, key, token, response)
+	return response, nil
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (c *Client) Delete(ctx context.Context, key string, opts ...client.CallOption) error {
+	key, token, err := c.begin(ctx, OpDelete, key, opts)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, replayed, err := c.replay(OpDelete, key, token); replayed || err != nil {
+		return err
+	}
+	e := c.write(key)
+	e.value, e.deleted = nil, true
+	c.remember(OpDelete, key, token, api.PutResponse{})
+	return nil
+}
+
+// begin counts a call, waits out the latency within the call's deadline
+// and applies any failure. It returns the key the call addresses and its
+// idempotency key.
+func (c *Client) begin(ctx context.Context, op Op, key string, opts []client.CallOption) (string, string, error) {
+	o := client.Resolve(ctx, opts...)
+	key = o.Key(key)
+	c.mu.Lock()
+	c.calls[op]++
+	latency, fail := c.latency, c.failure
+	c.mu.Unlock()
+
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return "", "", ctx.Err()
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return "", "", err
+	}
+	if fail != nil {
+		if err := fail(op, key); err != nil {
+			return "", "", err
+		}
+	}
+	return key, o.IdempotencyKey, nil
+}
+
+// replay returns the response remembered for a write with token, or the
+// error a node answers when token was used for another kind of write.
+func (c *Client) replay(op Op, key, token string) (api.PutResponse, bool, error) {
+	if token == "" {
+		return api.PutResponse{}, false, nil
+	}
+	r, ok := c.idempotent[idempotencyKey{key, token}]
+	if !ok {
+		return api.PutResponse{}, false, nil
+	}
+	if r.op != op {
+		return api.PutResponse{}, false, StatusError(http.StatusUnprocessableEntity, "Idempotency-Key "+token+" was already used for another write of this key")
+	}
+	return api.PutResponse{Version: maps.Clone(r.response.Version)}, true, nil
+}
+
+func (c *Client) remember(op Op, key, token string, response api.PutResponse) {
+	if token != "" {
+		c.idempotent[idempotencyKey{key, token}] = result{op: op, response: api.PutResponse{Version: maps.Clone(response.Version)}}
+	}
+}
+
+// write returns key's entry with its version bumped.
+func (c *Client) write(key string) *entry {
+	e, ok := c.values[key]
+	if !ok {
+		e = &entry{}
+		c.values[key] = e
+	}
+	e.version++
+	e.deleted = false
+	return e
+}
+
+func (c *Client) clock(e *entry) map[string]uint64 {
+	return map[string]uint64{c.nodeID: e.version}
+}
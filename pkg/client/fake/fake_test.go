@@ -0,0 +1,117 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/client"
+)
+
+func TestReadsWritesAndVersions(t *testing.T) {
+	c := New(WithNodeID("n1"))
+	ctx := t.Context()
+
+	if got, err := c.Get(ctx, "missing"); err != nil || got.Found {
+		t.Errorf("Expected a missing key to be not found without error, got %+v, %v", got, err)
+	}
+	first, err := c.Put(ctx, "user:1", []byte("alice"))
+	if err != nil || first.Version["n1"] != 1 {
+		t.Fatalf("Expected the first write at version 1, got %v, %v", first.Version, err)
+	}
+	second, _ := c.Put(ctx, "user:1", []byte("bob"))
+	if second.Version["n1"] != 2 {
+		t.Errorf("Expected the second write at version 2, got %v", second.Version)
+	}
+	got, err := c.Get(ctx, "user:1")
+	if err != nil || !got.Found || string(got.Value) != "bob" || got.Versions[0]["n1"] != 2 || got.Checksum != crc32.ChecksumIEEE([]byte("bob")) {
+		t.Errorf("Expected the latest write read back, got %+v, %v", got, err)
+	}
+
+	// The value read is a copy
+	got.Value[0] = 'X'
+	if again, _ := c.Get(ctx, "user:1"); string(again.Value) != "bob" {
+		t.Errorf("Expected the stored value unchanged, got %q", again.Value)
+	}
+
+	if err := c.Delete(ctx, "user:1"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if got, _ := c.Get(ctx, "user:1"); got.Found {
+		t.Errorf("Expected the key deleted, got %+v", got)
+	}
+	if third, _ := c.Put(ctx, "user:1", []byte("carol")); third.Version["n1"] != 4 {
+		t.Errorf("Expected a write after the delete to supersede it, got %v", third.Version)
+	}
+
+	c.Put(ctx, "a", []byte("v"), client.Bucket("orders"))
+	if got, _ := c.Get(ctx, "orders/a"); !got.Found {
+		t.Errorf("Expected the bucket to prefix the key, got %+v", got)
+	}
+	keys := c.Keys()
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"orders/a", "user:1"}) {
+		t.Errorf("Expected the keys holding values, got %v", keys)
+	}
+	if c.Calls(OpPut) != 4 || c.Calls(OpGet) != 5 || c.Calls(OpDelete) != 1 {
+		t.Errorf("Expected the calls counted, got %d gets, %d puts, %d deletes", c.Calls(OpGet), c.Calls(OpPut), c.Calls(OpDelete))
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	c := New()
+	ctx := t.Context()
+	first, _ := c.Put(ctx, "k", []byte("v1"), client.IdempotencyKey("put-1"))
+	retry, _ := c.Put(ctx, "k", []byte("v1"), client.IdempotencyKey("put-1"))
+	if retry.Version[DefaultNodeID] != first.Version[DefaultNodeID] {
+		t.Errorf("Expected the retry to get the original version, got %v after %v", retry.Version, first.Version)
+	}
+	if got, _ := c.Get(ctx, "k"); got.Versions[0][DefaultNodeID] != 1 {
+		t.Errorf("Expected the retry not to write again, got %v", got.Versions)
+	}
+
+	var status *client.StatusError
+	if err := c.Delete(ctx, "k", client.IdempotencyKey("put-1")); !errors.As(err, &status) || status.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected a reused key refused with 422, got %v", err)
+	}
+}
+
+func TestLatencyAndFailures(t *testing.T) {
+	c := New(WithLatency(50 * time.Millisecond))
+	ctx := t.Context()
+
+	if _, err := c.Put(ctx, "k", []byte("v"), client.Timeout(time.Millisecond)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the call to time out, got %v", err)
+	}
+	if got, _ := c.Get(ctx, "k"); got.Found {
+		t.Errorf("Expected the timed out write to have no effect, got %+v", got)
+	}
+	c.SetLatency(0)
+
+	c.SetFailure(func(op Op, key string) error {
+		if op == OpPut && key == "k" {
+			return StatusError(http.StatusServiceUnavailable, "quorum not reached")
+		}
+		return nil
+	})
+	var status *client.StatusError
+	if _, err := c.Put(ctx, "k", []byte("v")); !errors.As(err, &status) || status.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the injected failure, got %v", err)
+	}
+	if _, err := c.Put(ctx, "other", []byte("v")); err != nil {
+		t.Errorf("Expected other keys to be written, got %v", err)
+	}
+	c.SetFailure(nil)
+	if _, err := c.Put(ctx, "k", []byte("v")); err != nil {
+		t.Errorf("Expected the write to go through once failures are cleared, got %v", err)
+	}
+
+	c.Reset()
+	if len(c.Keys()) != 0 || c.Calls(OpPut) != 0 {
+		t.Errorf("Expected Reset to empty the client, got %v and %d puts", c.Keys(), c.Calls(OpPut))
+	}
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	readConsistencyHeader  = "X-Consistency-R"
+	writeConsistencyHeader = "X-Consistency-W"
+	timeoutHeader          = "X-Timeout"
+	idempotencyKeyHeader   = "Idempotency-Key"
+)
+
+// A CallOption tunes a single Get, Put or Delete, so that one client can
+// serve workloads that need different guarantees. Options are passed to
+// the call or attached to its context with WithOptions; those passed to
+// the call win.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	consistency    string
+	timeout        time.Duration
+	idempotencyKey string
+	bucket         string
+}
+
+// Consistency sets how many replicas the call must reach: a count or one
+// of "one", "quorum" and "all". It is the read quorum of a Get and the
+// write quorum of a Put or Delete.
+func Consistency(level string) CallOption {
+	return func(o *callOptions) { o.consistency = level }
+}
+
+// Timeout bounds the call, retries included, and tells the coordinating
+// node to stop waiting for replicas once it has passed. Each request to a
+// node stays within the client's own request timeout as well.
+func Timeout(d time.Duration) CallOption {
+	return func(o *callOptions) { o.timeout = d }
+}
+
+// IdempotencyKey names a Put or Delete so that the node can recognise a
+// retry of it, sent as the Idempotency-Key header.
+func IdempotencyKey(key string) CallOption {
+	return func(o *callOptions) { o.idempotencyKey = key }
+}
+
+// Bucket addresses the key within the namespace bucket, as
+// "{bucket}/{key}".
+func Bucket(name string) CallOption {
+	return func(o *callOptions) { o.bucket = name }
+}
+
+type optionsContextKey struct{}
+
+// WithOptions returns a context carrying opts, which apply to every call
+// made with it after any options ctx already carries.
+func WithOptions(ctx context.Context, opts ...CallOption) context.Context {
+	inherited, _ := ctx.Value(optionsContextKey{}).([]CallOption)
+	return context.WithValue(ctx, optionsContextKey{}, append(inherited[:len(inherited):len(inherited)], opts...))
+}
+
+// resolveOptions applies the options carried by ctx, then opts.
+func resolveOptions(ctx context.Context, opts []CallOption) callOptions {
+	var o callOptions
+	inherited, _ := ctx.Value(optionsContextKey{}).([]CallOption)
+	for _, opt := range append(inherited[:len(inherited):len(inherited)], opts...) {
+		opt(&o)
+	}
+	return o
+}
+
+// Options are the settings a call resolves its options to, for
+// implementations of KV other than Client.
+type Options struct {
+	Consistency    string
+	Timeout        time.Duration
+	IdempotencyKey string
+	Bucket         string
+}
+
+// Resolve applies the options carried by ctx, then opts, as a call does.
+func Resolve(ctx context.Context, opts ...CallOption) Options {
+	o := resolveOptions(ctx, opts)
+	return Options{Consistency: o.consistency, Timeout: o.timeout, IdempotencyKey: o.idempotencyKey, Bucket: o.bucket}
+}
+
+// Key returns the key a call with these options addresses.
+func (o Options) Key(key string) string {
+	return callOptions{bucket: o.Bucket}.key(key)
+}
+
+// key returns the key the call addresses.
+func (o callOptions) key(key string) string {
+	if o.bucket == "" {
+		return key
+	}
+	return o.bucket + "/" + key
+}
+
+// setHeaders adds the options of a method request to header, passing on
+// what remains of the call's timeout by ctx's deadline.
+func (o callOptions) setHeaders(ctx context.Context, method string, header http.Header) {
+	if o.consistency != "" {
+		if method == http.MethodGet {
+			header.Set(readConsistencyHeader, o.consistency)
+		} else {
+			header.Set(writeConsistencyHeader, o.consistency)
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok && o.timeout > 0 {
+		header.Set(timeoutHeader, strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 1), 10))
+	}
+	if o.idempotencyKey != "" && method != http.MethodGet {
+		header.Set(idempotencyKeyHeader, o.idempotencyKey)
+	}
+}
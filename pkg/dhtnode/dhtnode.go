@@ -0,0 +1,163 @@
+// Package dhtnode embeds a DHT node in a Go program. The node joins its
+// cluster and serves peers over HTTP like a dhtnode daemon, while the
+// program reads and writes through direct method calls that skip HTTP and
+// report failures as the *client.StatusError the SDK would return. It
+// suits edge deployments and tests that do not want a separate process.
+package dhtnode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/amirderis/DHT/internal/config"
+	"github.com/amirderis/DHT/internal/server"
+	"github.com/amirderis/DHT/pkg/api"
+	"github.com/amirderis/DHT/pkg/client"
+)
+
+// Option configures a Node.
+type Option func(*options)
+
+type options struct {
+	cfg    *config.Config
+	server []server.Option
+}
+
+// WithNodeID sets the node's ID; by default it comes from DataDir or the
+// hostname.
+func WithNodeID(id string) Option {
+	return func(o *options) { o.cfg.NodeID = id }
+}
+
+// WithBindAddr sets the address peers and HTTP clients reach the node on;
+// the default is ":8080". Peers are told this address, so in a cluster it
+// must name a port rather than ":0".
+func WithBindAddr(addr string) Option {
+	return func(o *options) { o.cfg.BindAddr = addr }
+}
+
+// WithSeeds sets the nodes (host:port) the node joins the cluster through.
+func WithSeeds(seeds ...string) Option {
+	return func(o *options) { o.cfg.SeedsCSV = strings.Join(seeds, ",") }
+}
+
+// WithReplication sets the replication factor and the read and write
+// quorums.
+func WithReplication(n, r, w int) Option {
+	return func(o *options) {
+		o.cfg.ReplicationFactor, o.cfg.ReadQuorum, o.cfg.WriteQuorum = n, r, w
+	}
+}
+
+// WithDataDir sets the directory the node keeps its identity, hints, stats
+// history and snapshots in.
+func WithDataDir(dir string) Option {
+	return func(o *options) { o.cfg.DataDir = dir }
+}
+
+// WithMemoryLimits bounds the keys and bytes the node holds; zero means
+// unbounded.
+func WithMemoryLimits(maxKeys int, maxBytes int64) Option {
+	return func(o *options) { o.cfg.MaxKeys, o.cfg.MaxBytes = maxKeys, maxBytes }
+}
+
+// WithGRPCAddr serves the gRPC API on addr as well.
+func WithGRPCAddr(addr string) Option {
+	return func(o *options) { o.cfg.GRPCAddr = addr }
+}
+
+// WithAdminAddr serves the health, stats and admin endpoints on addr
+// instead of the bind address.
+func WithAdminAddr(addr string) Option {
+	return func(o *options) { o.cfg.AdminAddr = addr }
+}
+
+// WithLogger sends the node's log messages to logger instead of standard
+// output; a *log.Logger will do.
+func WithLogger(logger server.Logger) Option {
+	return func(o *options) { o.server = append(o.server, server.WithLogger(logger)) }
+}
+
+// Node is a DHT node running in this process. It is safe for concurrent
+// use.
+type Node struct {
+	srv *server.HTTPServer
+	cfg *config.Config
+}
+
+// New configures a node with the daemon's defaults changed by opts. It
+// does not start it.
+func New(opts ...Option) (*Node, error) {
+	o := options{cfg: config.Defaults()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := o.cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Node{srv: server.NewHTTPServer(o.cfg, o.server...), cfg: o.cfg}, nil
+}
+
+// ID returns the node's ID.
+func (n *Node) ID() string {
+	return n.cfg.NodeID
+}
+
+// Addr returns the address the node serves peers and HTTP clients on.
+func (n *Node) Addr() string {
+	return n.cfg.BindAddr
+}
+
+// Start starts the node's listeners and background work and joins its
+// seeds; it returns once they are up, possibly before the node is Ready.
+func (n *Node) Start() error {
+	return n.srv.Start()
+}
+
+// Stop stops the node, letting requests in flight finish within ctx.
+func (n *Node) Stop(ctx context.Context) error {
+	return n.srv.Stop(ctx)
+}
+
+// Ready reports whether the node has joined its cluster and taken over
+// the data of the ranges it now owns.
+func (n *Node) Ready() bool {
+	return n.srv.Ready()
+}
+
+// Get returns the value for key. A missing key is not an error.
+func (n *Node) Get(ctx context.Context, key string) (api.GetResponse, error) {
+	response, err := n.srv.Get(ctx, key)
+	return response, statusError(err)
+}
+
+// Put stores value under key.
+func (n *Node) Put(ctx context.Context, key string, value []byte) (api.PutResponse, error) {
+	return n.PutTTL(ctx, key, value, 0)
+}
+
+// PutTTL stores value under key until ttl has passed.
+func (n *Node) PutTTL(ctx context.Context, key string, value []byte, ttl time.Duration) (api.PutResponse, error) {
+	response, err := n.srv.Put(ctx, key, value, ttl)
+	return response, statusError(err)
+}
+
+// Delete removes key.
+func (n *Node) Delete(ctx context.Context, key string) error {
+	return statusError(n.srv.Delete(ctx, key))
+}
+
+// statusError reports err as the response a node would have answered an
+// HTTP request with.
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var statusErr *client.StatusError
+	if errors.As(err, &statusErr) {
+		return err
+	}
+	return &client.StatusError{Code: server.ErrorStatus(err), Message: err.Error()}
+}
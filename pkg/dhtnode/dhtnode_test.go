@@ -0,0 +1,77 @@
+package dhtnode
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/amirderis/DHT/pkg/client"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestEmbeddedNode(t *testing.T) {
+	n, err := New(WithNodeID("embedded"), WithBindAddr(freeAddr(t)), WithReplication(1, 1, 1))
+	if err != nil {
+		t.Fatalf("Failed to configure node: %v", err)
+	}
+	if err := n.Start(); err != nil {
+		t.Fatalf("Failed to start node: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := n.Stop(ctx); err != nil {
+			t.Errorf("Failed to stop node: %v", err)
+		}
+	}()
+	if !n.Ready() {
+		t.Errorf("Expected a node without seeds to be ready")
+	}
+	if n.cfg.AccessTrackedKeys != 10000 || n.cfg.RepairRate != 1<<20 {
+		t.Errorf("Expected the daemon's flag defaults, got %+v", n.cfg)
+	}
+	ctx := context.Background()
+
+	if _, err := n.Put(ctx, "key", []byte("value")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	resp, err := n.Get(ctx, "key")
+	if err != nil || !resp.Found || string(resp.Value) != "value" {
+		t.Errorf("Expected to read back value, got %+v, %v", resp, err)
+	}
+
+	// The same data is served over HTTP
+	resp, err = client.New([]string{n.Addr()}).Get(ctx, "key")
+	if err != nil || string(resp.Value) != "value" {
+		t.Errorf("Expected HTTP clients to read value, got %+v, %v", resp, err)
+	}
+
+	if err := n.Delete(ctx, "key"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if resp, err := n.Get(ctx, "key"); err != nil || resp.Found {
+		t.Errorf("Expected key to be gone, got %+v, %v", resp, err)
+	}
+
+	_, err = n.Put(ctx, "", []byte("value"))
+	var statusErr *client.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusBadRequest {
+		t.Errorf("Expected a 400 StatusError for an empty key, got %v", err)
+	}
+	_, err = n.PutTTL(ctx, "key", []byte("value"), -time.Second)
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusBadRequest {
+		t.Errorf("Expected a 400 StatusError for a negative ttl, got %v", err)
+	}
+}